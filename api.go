@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// Request body for /assemble
+type apiAssembleRequest struct {
+	Arch         string `json:"arch"`
+	Instructions string `json:"instructions"`
+	Syntax       string `json:"syntax"`
+}
+
+// Request body for /disassemble, opcodes are given as hex in the same format the !disassemble command accepts
+type apiDisassembleRequest struct {
+	Arch    string `json:"arch"`
+	Opcodes string `json:"opcodes"`
+	Syntax  string `json:"syntax"`
+}
+
+// A single instruction in a response. /assemble sets instruction, /disassemble sets mnemonic and operands.
+type apiInstruction struct {
+	Instruction string `json:"instruction,omitempty"`
+	Mnemonic    string `json:"mnemonic,omitempty"`
+	OpStr       string `json:"operands,omitempty"`
+	Offset      uint64 `json:"offset"`
+	Bytes       string `json:"bytes"`
+}
+
+// A system call in a /syscall response
+type apiSyscall struct {
+	Arch   string `json:"arch"`
+	Number uint64 `json:"number"`
+	Name   string `json:"name"`
+}
+
+// Response body for every endpoint, only one of the fields is set
+type apiResponse struct {
+	Error        string           `json:"error,omitempty"`
+	Instructions []apiInstruction `json:"instructions,omitempty"`
+	Syscall      *apiSyscall      `json:"syscall,omitempty"`
+}
+
+// Converts instructions from the asm package into their JSON representation
+func apiInstructions(ins []asm.Insn) []apiInstruction {
+	var out []apiInstruction
+
+	for _, i := range ins {
+		out = append(out, apiInstruction{
+			Instruction: i.Source,
+			Mnemonic:    i.Mnemonic,
+			OpStr:       i.OpStr,
+			Offset:      i.Address,
+			Bytes:       strings.TrimSpace(formatOpcodes(i.Bytes)),
+		})
+	}
+
+	return out
+}
+
+// Starts the HTTP API if a listen address is configured. Runs until the process exits.
+func startAPIServer() {
+	listen := getConfigPropertyAsStr("api", "listen")
+
+	if listen == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/assemble", apiAssemble)
+	mux.HandleFunc("/disassemble", apiDisassemble)
+	mux.HandleFunc("/syscall", apiSyscallLookup)
+	mux.HandleFunc("/healthz", apiHealth)
+
+	if manualMirrorEnabled() {
+		mux.HandleFunc("/manuals/", serveMirroredManual)
+	}
+
+	go func() {
+		fmt.Println("[INFO] HTTP API listening on " + listen)
+
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			fmt.Println("[ERROR] HTTP API stopped, ", err)
+		}
+	}()
+}
+
+// Writes a JSON response with the given status code
+func apiWrite(w http.ResponseWriter, status int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Decodes a POSTed JSON body into v, writing an error response and returning false on failure
+func apiDecode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		apiWrite(w, http.StatusMethodNotAllowed, apiResponse{Error: "only POST is supported"})
+		return false
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024*1024)).Decode(v); err != nil {
+		apiWrite(w, http.StatusBadRequest, apiResponse{Error: "invalid JSON body"})
+		return false
+	}
+
+	return true
+}
+
+// POST /assemble {"arch": "x64", "instructions": "push rbp; mov rbp, rsp"}
+func apiAssemble(w http.ResponseWriter, r *http.Request) {
+	var req apiAssembleRequest
+
+	if !apiDecode(w, r, &req) {
+		return
+	}
+
+	ins, err := assemble(req.Arch, req.Instructions, asmOptions{syntax: req.Syntax})
+
+	if err != nil {
+		apiWrite(w, http.StatusBadRequest, apiResponse{Error: err.Error()})
+		return
+	}
+
+	apiWrite(w, http.StatusOK, apiResponse{Instructions: apiInstructions(ins)})
+}
+
+// POST /disassemble {"arch": "x64", "opcodes": "55 48 89 e5"}
+func apiDisassemble(w http.ResponseWriter, r *http.Request) {
+	var req apiDisassembleRequest
+
+	if !apiDecode(w, r, &req) {
+		return
+	}
+
+	opcodes, err := parseOpcodes(req.Opcodes)
+
+	if err != nil {
+		apiWrite(w, http.StatusBadRequest, apiResponse{Error: err.Error()})
+		return
+	}
+
+	ins, err := disassemble(req.Arch, opcodes, asmOptions{syntax: req.Syntax})
+
+	if err != nil {
+		apiWrite(w, http.StatusBadRequest, apiResponse{Error: err.Error()})
+		return
+	}
+
+	apiWrite(w, http.StatusOK, apiResponse{Instructions: apiInstructions(ins)})
+}
+
+// Finds the system call table for an architecture name or one of its aliases
+func apiSyscallTable(arch string) (string, []string, bool) {
+	for name, table := range syscallTables {
+		if canonicalArch(name) == canonicalArch(arch) {
+			return name, table, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// GET /syscall?arch=x64&nr=59 or /syscall?arch=x64&name=execve
+func apiSyscallLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiWrite(w, http.StatusMethodNotAllowed, apiResponse{Error: "only GET is supported"})
+		return
+	}
+
+	query := r.URL.Query()
+	arch, table, ok := apiSyscallTable(query.Get("arch"))
+
+	if !ok {
+		apiWrite(w, http.StatusBadRequest, apiResponse{Error: "arch has to be one of x86, x64 or arm64"})
+		return
+	}
+
+	if name := query.Get("name"); name != "" {
+		for number, known := range table {
+			if known == name {
+				apiWrite(w, http.StatusOK, apiResponse{Syscall: &apiSyscall{arch, uint64(number), name}})
+				return
+			}
+		}
+
+		apiWrite(w, http.StatusNotFound, apiResponse{Error: "no system call named " + name + " on " + arch})
+		return
+	}
+
+	number, err := strconv.ParseUint(query.Get("nr"), 0, 64)
+
+	if err != nil {
+		apiWrite(w, http.StatusBadRequest, apiResponse{Error: "give the system call as nr (a number) or name"})
+		return
+	}
+
+	if number >= uint64(len(table)) || table[number] == "" {
+		apiWrite(w, http.StatusNotFound, apiResponse{Error: "no system call " + strconv.FormatUint(number, 10) + " on " + arch})
+		return
+	}
+
+	apiWrite(w, http.StatusOK, apiResponse{Syscall: &apiSyscall{arch, number, table[number]}})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Longest input shown in an audit log entry, longer input is truncated
+const maxAuditInputLength = 500
+
+// An audit log entry, as written to the audit log file
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	GuildID string    `json:"guild_id"`
+	Channel string    `json:"channel_id"`
+	UserID  string    `json:"user_id"`
+	User    string    `json:"user"`
+	Command string    `json:"command"`
+	Input   string    `json:"input"`
+}
+
+// Serializes writes to the audit log file
+var auditFileLock sync.Mutex
+
+// Logs a command invocation to the guild's audit channel and the operator's audit log file, if either is set up
+func auditCommand(s Responder, m *discordgo.MessageCreate, command Command, args []string) {
+	if command.dev {
+		return
+	}
+
+	entry := auditEntry{
+		Time:    time.Now().UTC(),
+		GuildID: m.GuildID,
+		Channel: m.ChannelID,
+		UserID:  m.Author.ID,
+		User:    m.Author.String(),
+		Command: command.name,
+		Input:   strings.Join(args[1:], " "),
+	}
+
+	if len(entry.Input) > maxAuditInputLength {
+		entry.Input = entry.Input[:maxAuditInputLength] + "..."
+	}
+
+	if channel := getGuildSettings(guildScope(m)).AuditChannel; channel != "" && m.GuildID != "" {
+		msg := "`" + entry.User + "` (" + entry.UserID + ") ran `" + CommandPrefix + entry.Command + "` in <#" + entry.Channel + ">"
+
+		if entry.Input != "" {
+			msg += ": ```" + strings.Replace(entry.Input, "```", "'''", -1) + "```"
+		}
+
+		go func() {
+			if _, err := s.ChannelMessageSend(channel, msg); err != nil {
+				fmt.Println("[ERROR] Failed to send to audit channel " + channel + ", ", err)
+			}
+		}()
+	}
+
+	if file := getConfigPropertyAsStr("audit", "file"); file != "" {
+		go writeAuditFile(file, entry)
+	}
+}
+
+// Appends an entry to the audit log file as a line of JSON
+func writeAuditFile(file string, entry auditEntry) {
+	auditFileLock.Lock()
+	defer auditFileLock.Unlock()
+
+	raw, err := json.Marshal(entry)
+
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to open audit log file, ", err)
+		return
+	}
+
+	defer f.Close()
+
+	_, _ = f.Write(append(raw, '\n'))
+}
+
+// Parses a channel mention (<#id>) or a bare channel ID
+func parseChannelMention(str string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(str, "<#"), ">")
+}
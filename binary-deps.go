@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Libraries that come with the system, anything else has to ship with the binary or be installed for it
+var (
+	systemELFLibraries = StrList{"libc.so.6", "libm.so.6", "libdl.so.2", "libpthread.so.0", "librt.so.1",
+		"libutil.so.1", "libresolv.so.2", "libcrypt.so.1", "libnsl.so.1", "ld-linux.so.2", "ld-linux-x86-64.so.2",
+		"ld-linux-aarch64.so.1", "ld-linux-armhf.so.3", "libgcc_s.so.1", "libstdc++.so.6", "libz.so.1",
+		"libselinux.so.1", "libcap.so.2", "libacl.so.1", "libattr.so.1", "libtinfo.so.6", "libncursesw.so.6",
+		"libreadline.so.8", "libssl.so.3", "libcrypto.so.3", "libssl.so.1.1", "libcrypto.so.1.1", "libpcre2-8.so.0",
+		"libsystemd.so.0", "libc.so", "libc++.so.1", "liblog.so", "libandroid.so"}
+	systemDLLs = StrList{"kernel32.dll", "kernelbase.dll", "ntdll.dll", "user32.dll", "gdi32.dll", "advapi32.dll",
+		"shell32.dll", "ole32.dll", "oleaut32.dll", "comctl32.dll", "comdlg32.dll", "ws2_32.dll", "wsock32.dll",
+		"wininet.dll", "winhttp.dll", "crypt32.dll", "bcrypt.dll", "secur32.dll", "shlwapi.dll", "version.dll",
+		"iphlpapi.dll", "rpcrt4.dll", "urlmon.dll", "psapi.dll", "dbghelp.dll", "setupapi.dll", "winmm.dll",
+		"imm32.dll", "uxtheme.dll", "dwmapi.dll", "netapi32.dll", "wtsapi32.dll", "userenv.dll", "mpr.dll",
+		"msvcrt.dll", "ucrtbase.dll", "mscoree.dll", "winspool.drv", "gdiplus.dll", "d3d9.dll", "d3d11.dll",
+		"dxgi.dll", "opengl32.dll", "ntoskrnl.exe", "hal.dll"}
+)
+
+// A library a binary needs, with the number of symbols or functions it takes from it and anything odd about it
+type binaryDependency struct {
+	Name    string
+	Symbols int
+	Notes   []string
+}
+
+// Returns one of a PE's data directories, empty if the optional header doesn't have it
+func (bin *binaryFile) peDataDirectory(index int) pe.DataDirectory {
+	switch header := bin.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if header.NumberOfRvaAndSizes > uint32(index) {
+			return header.DataDirectory[index]
+		}
+	case *pe.OptionalHeader64:
+		if header.NumberOfRvaAndSizes > uint32(index) {
+			return header.DataDirectory[index]
+		}
+	}
+
+	return pe.DataDirectory{}
+}
+
+// Reads bytes at an RVA of a PE, cut short at the end of the file
+func (bin *binaryFile) rvaData(rva uint32, length uint32) ([]byte, bool) {
+	offset, ok := bin.rvaOffset(rva)
+
+	if !ok || uint64(offset) >= uint64(len(bin.Data)) {
+		return nil, false
+	}
+
+	end := uint64(offset) + uint64(length)
+	if end > uint64(len(bin.Data)) {
+		end = uint64(len(bin.Data))
+	}
+
+	return bin.Data[offset:end], true
+}
+
+// Reads a null terminated string at an RVA of a PE
+func (bin *binaryFile) rvaString(rva uint32) string {
+	data, _ := bin.rvaData(rva, 256)
+
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+
+	return string(data)
+}
+
+// Lists the DLLs in a PE's import directory, or its delay load import directory, with how many functions are
+// imported from each and how many of those are by ordinal
+func (bin *binaryFile) peImports(delay bool) ([]binaryDependency, []int) {
+	index, size := pe.IMAGE_DIRECTORY_ENTRY_IMPORT, uint32(20)
+	if delay {
+		index, size = pe.IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT, 32
+	}
+
+	dir := bin.peDataDirectory(index)
+	descriptors, ok := bin.rvaData(dir.VirtualAddress, dir.Size)
+
+	if dir.VirtualAddress == 0 || !ok {
+		return nil, nil
+	}
+
+	thunkSize := uint32(4)
+	if _, ok := bin.pe.OptionalHeader.(*pe.OptionalHeader64); ok {
+		thunkSize = 8
+	}
+
+	var deps []binaryDependency
+	var ordinals []int
+
+	for pos := uint32(0); uint64(pos) + uint64(size) <= uint64(len(descriptors)); pos += size {
+		// IMAGE_IMPORT_DESCRIPTOR has the name at 12 and the lookup table at 0 (the IAT at 16 if there's no lookup
+		// table), the delay load descriptor has the name at 4 and the lookup table at 16
+		nameRVA, lookupRVA := binary.LittleEndian.Uint32(descriptors[pos + 12:]), binary.LittleEndian.Uint32(descriptors[pos:])
+		if lookupRVA == 0 {
+			lookupRVA = binary.LittleEndian.Uint32(descriptors[pos + 16:])
+		}
+
+		if delay {
+			nameRVA, lookupRVA = binary.LittleEndian.Uint32(descriptors[pos + 4:]), binary.LittleEndian.Uint32(descriptors[pos + 16:])
+		}
+
+		if nameRVA == 0 {
+			break
+		}
+
+		dep := binaryDependency{Name: bin.rvaString(nameRVA)}
+		byOrdinal := 0
+		thunks, _ := bin.rvaData(lookupRVA, 0x10000 * thunkSize)
+
+		for n := uint32(0); n + thunkSize <= uint32(len(thunks)); n += thunkSize {
+			var thunk, ordinalFlag uint64
+
+			if thunkSize == 8 {
+				thunk, ordinalFlag = binary.LittleEndian.Uint64(thunks[n:]), 1 << 63
+			} else {
+				thunk, ordinalFlag = uint64(binary.LittleEndian.Uint32(thunks[n:])), 1 << 31
+			}
+
+			if thunk == 0 {
+				break
+			}
+
+			dep.Symbols++
+
+			if thunk & ordinalFlag != 0 {
+				byOrdinal++
+			}
+		}
+
+		deps = append(deps, dep)
+		ordinals = append(ordinals, byOrdinal)
+	}
+
+	return deps, ordinals
+}
+
+// Lists the libraries a binary needs, DT_NEEDED for ELFs and imported DLLs for PEs, with notes on the ones that are
+// unusual, like libraries loaded from a path. The second result has notes on the binary as a whole.
+func (bin *binaryFile) dependencies() ([]binaryDependency, []string, error) {
+	if bin.pe != nil {
+		return bin.peDependencies()
+	}
+
+	if bin.elf == nil {
+		return nil, nil, errors.New("only ELF and PE files have dependencies")
+	}
+
+	var notes []string
+	tags, err := bin.dynamicTags()
+
+	if err != nil {
+		if bin.elf.SectionByType(elf.SHT_DYNAMIC) == nil {
+			return nil, []string{"statically linked, it doesn't need any libraries"}, nil
+		}
+
+		return nil, nil, err
+	}
+
+	// Symbols name the library they're from when they're versioned, so they can be counted per library
+	counts := make(map[string]int)
+	imported, _ := bin.elf.ImportedSymbols()
+
+	for _, sym := range imported {
+		counts[sym.Library]++
+	}
+
+	var deps []binaryDependency
+
+	for _, tag := range tags {
+		switch tag.Tag {
+		case "NEEDED":
+			dep := binaryDependency{Name: tag.Value, Symbols: counts[tag.Value]}
+
+			switch {
+			case strings.Contains(tag.Value, "/"):
+				dep.Notes = append(dep.Notes, "loaded from a path instead of searched for")
+			case !strings.Contains(tag.Value, ".so"):
+				dep.Notes = append(dep.Notes, "not named like a shared library")
+			case !systemELFLibraries.contains(tag.Value):
+				dep.Notes = append(dep.Notes, "not a common system library")
+			}
+
+			deps = append(deps, dep)
+		case "RPATH", "RUNPATH":
+			notes = append(notes, tag.Tag + " " + tag.Value)
+
+			for _, dir := range strings.Split(tag.Value, ":") {
+				if dir == "" || !strings.HasPrefix(dir, "/") && !strings.HasPrefix(dir, "$ORIGIN") {
+					notes = append(notes, tag.Tag + " has a relative directory ('" + dir + "'), libraries are searched for from the working directory")
+				} else if strings.HasPrefix(dir, "/tmp") || strings.HasPrefix(dir, "/dev/shm") || strings.HasPrefix(dir, "/var/tmp") {
+					notes = append(notes, tag.Tag + " has a world writable directory (" + dir + ")")
+				}
+			}
+		}
+	}
+
+	if bin.elf.Type == elf.ET_EXEC || bin.elf.Type == elf.ET_DYN {
+		interp := ""
+
+		for _, prog := range bin.elf.Progs {
+			if prog.Type == elf.PT_INTERP {
+				data := make([]byte, prog.Filesz)
+				if _, err := prog.ReadAt(data, 0); err == nil {
+					interp = strings.TrimRight(string(data), "\x00")
+				}
+			}
+		}
+
+		if interp != "" {
+			notes = append(notes, "interpreter " + interp)
+		} else if bin.elf.Type == elf.ET_EXEC {
+			notes = append(notes, "no interpreter, so the libraries won't be loaded unless something else loads them")
+		}
+	}
+
+	if len(deps) == 0 {
+		notes = append(notes, "it has a dynamic section but doesn't need any libraries, not even libc")
+	}
+
+	return deps, notes, nil
+}
+
+// Lists the DLLs a PE imports from, delay loaded ones included
+func (bin *binaryFile) peDependencies() ([]binaryDependency, []string, error) {
+	var notes []string
+	imports, ordinals := bin.peImports(false)
+	delayed, delayedOrdinals := bin.peImports(true)
+
+	for n := range delayed {
+		delayed[n].Notes = append(delayed[n].Notes, "delay loaded")
+	}
+
+	deps := append(imports, delayed...)
+	ordinals = append(ordinals, delayedOrdinals...)
+	total := 0
+	names := StrList{}
+
+	for n := range deps {
+		dep := &deps[n]
+		name := strings.ToLower(dep.Name)
+		total += dep.Symbols
+		names = append(names, name)
+
+		switch {
+		case dep.Name == "":
+			dep.Name = "(unnamed)"
+			dep.Notes = append(dep.Notes, "the import has no DLL name")
+		case strings.ContainsAny(dep.Name, "/\\"):
+			dep.Notes = append(dep.Notes, "loaded from a path instead of searched for")
+		case strings.HasPrefix(name, "api-ms-win-") || strings.HasPrefix(name, "ext-ms-"):
+		case strings.HasPrefix(name, "msvcp") || strings.HasPrefix(name, "vcruntime") || strings.HasPrefix(name, "msvcr"):
+			dep.Notes = append(dep.Notes, "Visual C++ runtime, it's installed with the redistributable")
+		case !systemDLLs.contains(name):
+			dep.Notes = append(dep.Notes, "not a system DLL")
+		}
+
+		if ordinals[n] > 0 && ordinals[n] == dep.Symbols {
+			dep.Notes = append(dep.Notes, "only imported by ordinal")
+		} else if dep.Symbols == 0 {
+			dep.Notes = append(dep.Notes, "no functions are imported from it")
+		}
+	}
+
+	switch {
+	case len(deps) == 0:
+		notes = append(notes, "it doesn't import anything, so it's likely packed or resolves every API at run time")
+	case names.contains("mscoree.dll") && len(deps) == 1:
+		notes = append(notes, "it only imports mscoree.dll, so it's a .NET assembly, use a .NET decompiler for it")
+	case total <= 5:
+		notes = append(notes, "it imports very few functions, so it's likely packed or resolves its APIs with GetProcAddress")
+	}
+
+	if bin.pe.Characteristics & pe.IMAGE_FILE_DLL == 0 && !names.contains("kernel32.dll") && !names.contains("ntdll.dll") &&
+		!names.contains("mscoree.dll") && len(deps) > 0 {
+		notes = append(notes, "it doesn't import from kernel32.dll or ntdll.dll, which nearly every executable does")
+	}
+
+	return deps, notes, nil
+}
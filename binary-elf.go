@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A relocation entry of an ELF
+type elfRelocation struct {
+	Section   string
+	Offset    uint64
+	Type      string
+	Symbol    string
+	Addend    int64
+	HasAddend bool
+}
+
+// A tag of an ELF's dynamic section, with its value formatted
+type elfDynamicTag struct {
+	Tag   string
+	Value string
+}
+
+// Names of the DT_FLAGS_1 bits worth knowing about, i.e. for checking how a binary was linked
+var elfFlags1 = []struct {
+	bit  uint64
+	name string
+}{
+	{0x1, "NOW"}, {0x2, "GLOBAL"}, {0x8, "NODELETE"}, {0x10, "LOADFLTR"}, {0x20, "INITFIRST"}, {0x40, "NOOPEN"},
+	{0x80, "ORIGIN"}, {0x800, "NODEFLIB"}, {0x8000000, "PIE"},
+}
+
+// Names a relocation type for the ELF's machine
+func elfRelocationType(machine elf.Machine, typ uint32) string {
+	switch machine {
+	case elf.EM_X86_64:
+		return elf.R_X86_64(typ).String()
+	case elf.EM_386:
+		return elf.R_386(typ).String()
+	case elf.EM_ARM:
+		return elf.R_ARM(typ).String()
+	case elf.EM_AARCH64:
+		return elf.R_AARCH64(typ).String()
+	case elf.EM_PPC:
+		return elf.R_PPC(typ).String()
+	case elf.EM_PPC64:
+		return elf.R_PPC64(typ).String()
+	case elf.EM_MIPS:
+		return elf.R_MIPS(typ).String()
+	case elf.EM_RISCV:
+		return elf.R_RISCV(typ).String()
+	}
+
+	return strconv.FormatUint(uint64(typ), 10)
+}
+
+// Returns the symbols of the symbol table a relocation section refers to, indexed like the table (0 is the null
+// symbol)
+func elfLinkedSymbols(f *elf.File, section *elf.Section) []string {
+	if int(section.Link) >= len(f.Sections) {
+		return nil
+	}
+
+	var symbols []elf.Symbol
+
+	switch f.Sections[section.Link].Type {
+	case elf.SHT_DYNSYM:
+		symbols, _ = f.DynamicSymbols()
+	case elf.SHT_SYMTAB:
+		symbols, _ = f.Symbols()
+	}
+
+	names := []string{""}
+	for _, sym := range symbols {
+		names = append(names, sym.Name)
+	}
+
+	return names
+}
+
+// Lists the relocation entries in every SHT_REL and SHT_RELA section of an ELF
+func (bin *binaryFile) relocations() ([]elfRelocation, error) {
+	if bin.elf == nil {
+		return nil, errors.New("only ELF files have relocation sections")
+	}
+
+	f := bin.elf
+	is64 := f.Class == elf.ELFCLASS64
+	var relocs []elfRelocation
+
+	for _, section := range f.Sections {
+		if section.Type != elf.SHT_REL && section.Type != elf.SHT_RELA {
+			continue
+		}
+
+		data, err := section.Data()
+		if err != nil {
+			continue
+		}
+
+		rela := section.Type == elf.SHT_RELA
+		symbols := elfLinkedSymbols(f, section)
+
+		// Entries are an offset and an info word, followed by an addend in RELA sections
+		size := 8
+		if is64 {
+			size = 16
+		}
+
+		if rela {
+			size += size / 2
+		}
+
+		for pos := 0; pos + size <= len(data); pos += size {
+			var offset, info uint64
+			var addend int64
+			var sym, typ uint32
+
+			if is64 {
+				offset = f.ByteOrder.Uint64(data[pos:])
+				info = f.ByteOrder.Uint64(data[pos + 8:])
+				sym, typ = uint32(info >> 32), uint32(info)
+
+				if rela {
+					addend = int64(f.ByteOrder.Uint64(data[pos + 16:]))
+				}
+			} else {
+				offset = uint64(f.ByteOrder.Uint32(data[pos:]))
+				info = uint64(f.ByteOrder.Uint32(data[pos + 4:]))
+				sym, typ = uint32(info >> 8), uint32(info & 0xff)
+
+				if rela {
+					addend = int64(int32(f.ByteOrder.Uint32(data[pos + 8:])))
+				}
+			}
+
+			name := ""
+			if int(sym) < len(symbols) {
+				name = symbols[sym]
+			}
+
+			relocs = append(relocs, elfRelocation{section.Name, offset, elfRelocationType(f.Machine, typ), name, addend, rela})
+		}
+	}
+
+	return relocs, nil
+}
+
+// Reads a string from the dynamic string table
+func elfDynamicString(strtab []byte, offset uint64) string {
+	if offset >= uint64(len(strtab)) {
+		return "(bad string offset 0x" + strconv.FormatUint(offset, 16) + ")"
+	}
+
+	end := bytes.IndexByte(strtab[offset:], 0)
+	if end < 0 {
+		end = len(strtab) - int(offset)
+	}
+
+	return string(strtab[offset:offset + uint64(end)])
+}
+
+// An entry of an ELF's dynamic section, as it's stored
+type elfDynamicEntry struct {
+	Tag   elf.DynTag
+	Value uint64
+}
+
+// Reads the entries of an ELF's dynamic section, and the string table its names are in
+func (bin *binaryFile) dynamicEntries() ([]elfDynamicEntry, []byte, error) {
+	if bin.elf == nil {
+		return nil, nil, errors.New("only ELF files have a dynamic section")
+	}
+
+	f := bin.elf
+	section := f.SectionByType(elf.SHT_DYNAMIC)
+
+	if section == nil {
+		return nil, nil, errors.New("the ELF has no dynamic section, it's statically linked")
+	}
+
+	data, err := section.Data()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var strtab []byte
+	if int(section.Link) < len(f.Sections) {
+		strtab, _ = f.Sections[section.Link].Data()
+	}
+
+	size := 8
+	if f.Class == elf.ELFCLASS64 {
+		size = 16
+	}
+
+	var entries []elfDynamicEntry
+
+	for pos := 0; pos + size <= len(data); pos += size {
+		var tag, value uint64
+
+		if size == 16 {
+			tag, value = f.ByteOrder.Uint64(data[pos:]), f.ByteOrder.Uint64(data[pos + 8:])
+		} else {
+			tag, value = uint64(f.ByteOrder.Uint32(data[pos:])), uint64(f.ByteOrder.Uint32(data[pos + 4:]))
+		}
+
+		if elf.DynTag(tag) == elf.DT_NULL {
+			break
+		}
+
+		entries = append(entries, elfDynamicEntry{elf.DynTag(tag), value})
+	}
+
+	return entries, strtab, nil
+}
+
+// Lists the tags of an ELF's dynamic section, with library names and flags decoded
+func (bin *binaryFile) dynamicTags() ([]elfDynamicTag, error) {
+	entries, strtab, err := bin.dynamicEntries()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []elfDynamicTag
+
+	for _, entry := range entries {
+		dt, value := entry.Tag, entry.Value
+		formatted := fmt.Sprintf("0x%x", value)
+
+		switch dt {
+		case elf.DT_NEEDED, elf.DT_SONAME, elf.DT_RPATH, elf.DT_RUNPATH:
+			formatted = elfDynamicString(strtab, value)
+		case elf.DT_FLAGS:
+			formatted = elf.DynFlag(value).String()
+		case elf.DT_FLAGS_1:
+			var names []string
+
+			for _, flag := range elfFlags1 {
+				if value & flag.bit != 0 {
+					names = append(names, "DF_1_" + flag.name)
+				}
+			}
+
+			formatted = fmt.Sprintf("0x%x %s", value, strings.Join(names, "+"))
+		case elf.DT_PLTRELSZ, elf.DT_RELASZ, elf.DT_RELSZ, elf.DT_RELAENT, elf.DT_RELENT, elf.DT_STRSZ, elf.DT_SYMENT,
+			elf.DT_RELACOUNT, elf.DT_RELCOUNT, elf.DT_VERNEEDNUM, elf.DT_VERDEFNUM:
+			formatted = strconv.FormatUint(value, 10)
+		}
+
+		tags = append(tags, elfDynamicTag{strings.TrimPrefix(dt.String(), "DT_"), formatted})
+	}
+
+	return tags, nil
+}
+
+// Checks if the dynamic linker resolves every symbol at load time (BIND_NOW), which full RELRO needs
+func elfBindNow(tags []elfDynamicTag) bool {
+	for _, tag := range tags {
+		if tag.Tag == "BIND_NOW" || (tag.Tag == "FLAGS" && strings.Contains(tag.Value, "DF_BIND_NOW")) ||
+			(tag.Tag == "FLAGS_1" && strings.Contains(tag.Value, "DF_1_NOW")) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// A function found in an uploaded binary. Source says how it was found: "symbol", "prologue", "call" or "signature",
+// for library functions named from a signature pack in Library.
+type binaryFunction struct {
+	Name    string
+	Addr    uint64
+	Size    uint64
+	Source  string
+	Library string
+}
+
+// Matches a function reference in command arguments, i.e. "@func:main" or "@func:0x401000"
+var funcRefRegexp = regexp.MustCompile(`^@func:(\S+)$`)
+
+// Mnemonics of direct calls, their target is the start of a function
+var callMnemonics = StrList{"call", "callq", "bl", "blx", "jal", "bal", "bla"}
+
+// Byte sequences that start a function on x86, a frame pointer setup or an endbr
+var x86Prologues = map[string][][]byte{
+	"x86": {{0x55, 0x89, 0xe5}, {0x55, 0x8b, 0xec}, {0xf3, 0x0f, 0x1e, 0xfb}},
+	"x64": {{0x55, 0x48, 0x89, 0xe5}, {0x55, 0x48, 0x8b, 0xec}, {0xf3, 0x0f, 0x1e, 0xfa}},
+}
+
+// Bytes compilers pad between x86 functions with, a prologue only counts if it's after one of these or a ret
+var x86Padding = []byte{0xc3, 0xcc, 0x90, 0x00}
+
+// Returns the disassembly of every executable section, worked out once per binary. Empty if the architecture isn't
+// supported.
+func (bin *binaryFile) instructions() []asm.Insn {
+	bin.codeOnce.Do(func() {
+		if bin.Arch == "" {
+			return
+		}
+
+		remaining := maxObjdumpInstructions
+
+		for _, section := range bin.Sections {
+			code := bin.sectionData(section)
+
+			if !section.Exec || len(code) == 0 || remaining <= 0 {
+				continue
+			}
+
+			ins, _ := linearSweep(bin.Arch, code, section.Addr, remaining)
+			remaining -= len(ins)
+			bin.code = append(bin.code, ins...)
+		}
+	})
+
+	return bin.code
+}
+
+// Returns the functions in the binary, from the symbol table, prologues in executable sections, and the targets of
+// direct calls. Functions without a symbol are named from the signature packs if they match one, or like IDA names
+// them otherwise, "sub_401000".
+func (bin *binaryFile) functions() []binaryFunction {
+	bin.funcsOnce.Do(func() {
+		found := make(map[uint64]binaryFunction)
+
+		add := func(fn binaryFunction) {
+			// ARM symbols have the low bit set for Thumb code
+			if bin.Arch == "arm" || bin.Arch == "thumb" {
+				fn.Addr &^= 1
+			}
+
+			if _, ok := bin.sectionAt(fn.Addr); !ok {
+				return
+			}
+
+			if existing, ok := found[fn.Addr]; ok && existing.Source == "symbol" {
+				return
+			}
+
+			found[fn.Addr] = fn
+		}
+
+		for _, sym := range bin.Symbols {
+			if sym.Func {
+				add(binaryFunction{Name: sym.Name, Addr: sym.Addr, Size: sym.Size, Source: "symbol"})
+			}
+		}
+
+		for _, addr := range bin.prologues() {
+			add(binaryFunction{Addr: addr, Source: "prologue"})
+		}
+
+		for _, i := range bin.instructions() {
+			if !callMnemonics.contains(i.Mnemonic) {
+				continue
+			}
+
+			if target, err := strconv.ParseUint(strings.TrimPrefix(i.OpStr, "#"), 0, 64); err == nil {
+				add(binaryFunction{Addr: target, Source: "call"})
+			}
+		}
+
+		for _, fn := range found {
+			if fn.Name == "" {
+				fn.Name = "sub_" + strconv.FormatUint(fn.Addr, 16)
+			}
+
+			bin.funcs = append(bin.funcs, fn)
+		}
+
+		sort.Slice(bin.funcs, func(i, j int) bool {
+			return bin.funcs[i].Addr < bin.funcs[j].Addr
+		})
+
+		// Functions without a size run up to the next function or the end of their section
+		for i := range bin.funcs {
+			if bin.funcs[i].Size != 0 {
+				continue
+			}
+
+			section, _ := bin.sectionAt(bin.funcs[i].Addr)
+			end := section.Addr + section.Size
+
+			if i + 1 < len(bin.funcs) && bin.funcs[i + 1].Addr < end {
+				end = bin.funcs[i + 1].Addr
+			}
+
+			bin.funcs[i].Size = end - bin.funcs[i].Addr
+		}
+
+		// Stripped static binaries get their library functions named from the signature packs
+		for i, fn := range bin.funcs {
+			if fn.Source == "symbol" {
+				continue
+			}
+
+			if name, library, ok := matchSignature(bin.Arch, bin.functionData(fn)); ok {
+				bin.funcs[i].Name = name
+				bin.funcs[i].Source = "signature"
+				bin.funcs[i].Library = library
+			}
+		}
+	})
+
+	return bin.funcs
+}
+
+// Finds the addresses of function prologues in the executable sections
+func (bin *binaryFile) prologues() []uint64 {
+	var found []uint64
+
+	for _, section := range bin.Sections {
+		code := bin.sectionData(section)
+
+		if !section.Exec {
+			continue
+		}
+
+		switch bin.Arch {
+		case "x86", "x64":
+			for offset := 0; offset < len(code); offset++ {
+				if offset > 0 && bytes.IndexByte(x86Padding, code[offset - 1]) < 0 {
+					continue
+				}
+
+				for _, prologue := range x86Prologues[bin.Arch] {
+					if bytes.HasPrefix(code[offset:], prologue) {
+						found = append(found, section.Addr + uint64(offset))
+						break
+					}
+				}
+			}
+		case "arm64":
+			for offset := 0; offset + 4 <= len(code); offset += 4 {
+				word := binary.LittleEndian.Uint32(code[offset:])
+
+				// stp x29, x30, [sp, #-n]! and paciasp
+				if word&0xffc07fff == 0xa9807bfd || word == 0xd503233f {
+					found = append(found, section.Addr + uint64(offset))
+				}
+			}
+		case "arm":
+			for offset := 0; offset + 4 <= len(code); offset += 4 {
+				// push {..., lr}
+				if binary.LittleEndian.Uint32(code[offset:])&0xffff4000 == 0xe92d4000 {
+					found = append(found, section.Addr + uint64(offset))
+				}
+			}
+		case "thumb":
+			for offset := 0; offset + 2 <= len(code); offset += 2 {
+				// push {..., lr}
+				if code[offset + 1] == 0xb5 {
+					found = append(found, section.Addr + uint64(offset))
+				}
+			}
+		}
+	}
+
+	return found
+}
+
+// Finds a function by name, or by address in hex (i.e. "0x401000" or "sub_401000")
+func (bin *binaryFile) findFunction(name string) (binaryFunction, bool) {
+	funcs := bin.functions()
+
+	for _, fn := range funcs {
+		if fn.Name == name {
+			return fn, true
+		}
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(name), "sub_"), "0x"), 16, 64)
+
+	if err != nil {
+		return binaryFunction{}, false
+	}
+
+	for _, fn := range funcs {
+		if fn.Addr == addr {
+			return fn, true
+		}
+	}
+
+	return binaryFunction{}, false
+}
+
+// Returns the bytes of a function
+func (bin *binaryFile) functionData(fn binaryFunction) []byte {
+	section, ok := bin.sectionAt(fn.Addr)
+
+	if !ok {
+		return nil
+	}
+
+	code := bin.sectionData(section)
+	start := fn.Addr - section.Addr
+	end := start + fn.Size
+
+	if start >= uint64(len(code)) {
+		return nil
+	}
+
+	if end > uint64(len(code)) {
+		end = uint64(len(code))
+	}
+
+	return code[start:end]
+}
+
+// Replaces any @func:name arguments with the architecture and bytes of the function in the user's binary, so
+// "!disassemble @func:main" disassembles main. The architecture is only added when the reference is the first
+// argument, "!disassemble x64 @func:main" works too.
+func expandFunctionRefs(userID string, args []string) ([]string, error) {
+	var expanded []string
+
+	for n, arg := range args {
+		match := funcRefRegexp.FindStringSubmatch(arg)
+
+		if match == nil {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		bin, ok := lastSessionBinary(userID)
+
+		if !ok {
+			return nil, errors.New("You haven't uploaded a binary in the last hour, attach one to `!funcs` first.")
+		}
+
+		fn, ok := bin.findFunction(match[1])
+
+		if !ok {
+			return nil, errors.New("There is no function named '" + match[1] + "' in " + bin.Name + ", `!funcs` lists them.")
+		}
+
+		if n == 1 {
+			expanded = append(expanded, bin.Arch)
+		}
+
+		expanded = append(expanded, strings.Fields(formatOpcodes(bin.functionData(fn)))...)
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// A byte pattern with wildcards, written like IDA writes them ("48 8B ?? ?? E8"). Mask is false for wildcard bytes.
+type bytePattern struct {
+	Bytes []byte
+	Mask  []bool
+}
+
+// Parses a byte pattern, "?" and "??" are wildcards. Bytes can be space separated or written together ("488B??E8").
+func parseBytePattern(args []string) (bytePattern, error) {
+	var pattern bytePattern
+
+	for _, arg := range args {
+		arg = strings.TrimPrefix(strings.ToLower(arg), "0x")
+
+		// A lone "?" is a whole byte, like in IDA
+		if arg == "?" {
+			arg = "??"
+		}
+
+		if len(arg) % 2 != 0 {
+			return bytePattern{}, errors.New("'" + arg + "' isn't a whole number of bytes")
+		}
+
+		for n := 0; n < len(arg); n += 2 {
+			token := arg[n:n + 2]
+
+			if token == "??" {
+				pattern.Bytes = append(pattern.Bytes, 0)
+				pattern.Mask = append(pattern.Mask, false)
+				continue
+			}
+
+			b, err := hex.DecodeString(token)
+
+			if err != nil {
+				return bytePattern{}, errors.New("'" + token + "' isn't a hex byte or a ?? wildcard")
+			}
+
+			pattern.Bytes = append(pattern.Bytes, b[0])
+			pattern.Mask = append(pattern.Mask, true)
+		}
+	}
+
+	if len(pattern.Bytes) == 0 {
+		return bytePattern{}, errors.New("the pattern is empty")
+	}
+
+	for _, set := range pattern.Mask {
+		if set {
+			return pattern, nil
+		}
+	}
+
+	return bytePattern{}, errors.New("the pattern is all wildcards")
+}
+
+// Checks if the pattern matches the start of data
+func (p bytePattern) matchAt(data []byte) bool {
+	if len(data) < len(p.Bytes) {
+		return false
+	}
+
+	for n, b := range p.Bytes {
+		if p.Mask[n] && data[n] != b {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the offsets the pattern matches at, at most limit of them. Returns false if there were more.
+func (p bytePattern) find(data []byte, limit int) ([]int, bool) {
+	var found []int
+
+	for offset := 0; offset + len(p.Bytes) <= len(data); offset++ {
+		if !p.matchAt(data[offset:]) {
+			continue
+		}
+
+		if len(found) == limit {
+			return found, false
+		}
+
+		found = append(found, offset)
+	}
+
+	return found, true
+}
+
+// Formats the pattern like IDA, i.e. "48 8B ?? ?? E8"
+func (p bytePattern) String() string {
+	var tokens []string
+
+	for n, b := range p.Bytes {
+		if p.Mask[n] {
+			tokens = append(tokens, strings.ToUpper(hex.EncodeToString([]byte{b})))
+		} else {
+			tokens = append(tokens, "??")
+		}
+	}
+
+	return strings.Join(tokens, " ")
+}
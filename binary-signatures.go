@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A library function's signature, its first bytes with the ones relocations change as wildcards
+type signature struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+
+	pattern bytePattern
+}
+
+// Signatures of the functions in a library, built with signatures/build-signatures.sh
+type signaturePack struct {
+	Name       string      `json:"name"`
+	Arch       string      `json:"arch"`
+	Signatures []signature `json:"signatures"`
+}
+
+// Signature packs loaded from signatures/*.json
+var (
+	signaturePacks []signaturePack
+	signatureLock  sync.RWMutex
+)
+
+// Loads the signature packs that !funcs names library functions in stripped binaries with
+func loadSignatures() {
+	paths, err := filepath.Glob(filepath.Join("signatures", "*.json"))
+	if err != nil {
+		fmt.Println("[ERROR] Failed to load signatures, " + err.Error())
+		return
+	}
+
+	var packs []signaturePack
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Println("[ERROR] Failed to load signature pack " + path + ", " + err.Error())
+			continue
+		}
+
+		var pack signaturePack
+		if err := json.Unmarshal(data, &pack); err != nil {
+			fmt.Println("[ERROR] Failed to load signature pack " + path + ", " + err.Error())
+			continue
+		}
+
+		var valid []signature
+
+		for _, sig := range pack.Signatures {
+			pattern, err := parseBytePattern(strings.Fields(sig.Pattern))
+
+			if err != nil {
+				fmt.Println("[ERROR] Skipping the " + sig.Name + " signature in " + path + ", " + err.Error())
+				continue
+			}
+
+			sig.pattern = pattern
+			valid = append(valid, sig)
+		}
+
+		pack.Signatures = valid
+		packs = append(packs, pack)
+	}
+
+	signatureLock.Lock()
+	signaturePacks = packs
+	signatureLock.Unlock()
+}
+
+// Finds the library function code starts with, returns its name and the name of the pack it's from
+func matchSignature(arch string, code []byte) (string, string, bool) {
+	signatureLock.RLock()
+	defer signatureLock.RUnlock()
+
+	for _, pack := range signaturePacks {
+		if pack.Arch != arch {
+			continue
+		}
+
+		for _, sig := range pack.Signatures {
+			if sig.pattern.matchAt(code) {
+				return sig.Name, pack.Name, true
+			}
+		}
+	}
+
+	return "", "", false
+}
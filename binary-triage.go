@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Entropy (in bits per byte) above which data is likely compressed or encrypted, code and data rarely reach it
+const packedEntropy = 7.2
+
+// Sections packers and protectors name after themselves
+var packerSections = map[string]string{
+	"UPX0": "UPX", "UPX1": "UPX", "UPX2": "UPX", ".upx": "UPX", ".aspack": "ASPack", ".adata": "ASPack",
+	".MPRESS1": "MPRESS", ".MPRESS2": "MPRESS", ".petite": "Petite", ".vmp0": "VMProtect", ".vmp1": "VMProtect",
+	".vmp2": "VMProtect", ".themida": "Themida", ".winlice": "Themida", ".nsp0": "NsPack", ".nsp1": "NsPack",
+	".enigma1": "Enigma Protector", ".enigma2": "Enigma Protector", ".y0da": "yoda's Crypter", ".yP": "yoda's Protector",
+	".perplex": "Perplex", ".packed": "RLPack", ".RLPack": "RLPack", "pebundle": "PEBundle", "PEC2": "PECompact",
+	"PEC2TO": "PECompact", ".pelock": "PELock", ".spack": "Simple Pack", ".ccg": "CCG", ".boom": "The Boomerang",
+	"MEW": "MEW", ".kkrunchy": "kkrunchy", "FSG!": "FSG",
+}
+
+// Strings packers leave in the files they pack
+var packerStrings = []struct {
+	magic []byte
+	name  string
+}{
+	{[]byte("UPX!"), "UPX"}, {[]byte("$Info: This file is packed with the UPX"), "UPX"}, {[]byte("MPRESS"), "MPRESS"},
+	{[]byte("ASPack"), "ASPack"}, {[]byte("PECompact2"), "PECompact"}, {[]byte("Themida"), "Themida"},
+	{[]byte("Enigma protector"), "Enigma Protector"}, {[]byte("ExeStealth"), "ExeStealth"},
+	{[]byte("Nullsoft Install System"), "NSIS installer"}, {[]byte("Inno Setup"), "Inno Setup installer"},
+	{[]byte("PyInstaller"), "PyInstaller"}, {[]byte("_MEIPASS"), "PyInstaller"},
+}
+
+// Prefixes of the section names compilers and linkers make, anything else is worth a look
+var (
+	elfSectionPrefixes = StrList{".text", ".data", ".bss", ".rodata", ".init", ".fini", ".preinit_array", ".plt",
+		".got", ".dynamic", ".dynsym", ".dynstr", ".symtab", ".strtab", ".shstrtab", ".rel", ".note", ".eh_frame",
+		".gnu", ".interp", ".comment", ".debug", ".tbss", ".tdata", ".ctors", ".dtors", ".jcr", ".ARM",
+		".gcc_except_table", ".go", ".noptr", ".typelink", ".itablink", ".gosymtab", ".stapsdt", ".tm_clone_table",
+		".sdata", ".sbss", ".MIPS", ".reginfo", ".riscv", ".toc", ".opd", ".branch_lt", ".fixup", "__libc_", ".hash",
+		".sframe", ".probes", ".zdebug", ".tohost", ".srodata", ".lit", ".pdr", ".mdebug", ".glink", ".jump_table"}
+	peSectionPrefixes = StrList{".text", ".rdata", ".data", ".bss", ".idata", ".edata", ".rsrc", ".reloc", ".pdata",
+		".xdata", ".tls", ".CRT", ".didat", ".gfids", ".00cfg", ".debug", "CODE", "DATA", "BSS", ".textbss",
+		".orpc", ".sxdata", ".voltbl", ".buildid", ".eh_fram", ".ndata", "INIT", "PAGE", ".symtab", ".retplne",
+		".fptable", ".wixburn", ".cormeta", ".sdata", "/", ".gehcont", ".mrdata", "_RDATA", ".detourc", ".detourd"}
+)
+
+// Computes the Shannon entropy of data in bits per byte, from 0 (one byte repeated) to 8 (random)
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	entropy := 0.0
+
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+
+		p := float64(count) / float64(len(data))
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// Checks if a section name is one compilers and linkers make
+func standardSectionName(format string, name string) bool {
+	prefixes := elfSectionPrefixes
+	if format == "PE" {
+		prefixes = peSectionPrefixes
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return name == ""
+}
+
+// Returns the PE's image base, which the virtual addresses in its headers are relative to
+func (bin *binaryFile) peImageBase() uint64 {
+	switch header := bin.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(header.ImageBase)
+	case *pe.OptionalHeader64:
+		return header.ImageBase
+	}
+
+	return 0
+}
+
+// Lists the callbacks in the PE's TLS directory, which Windows runs before the entry point. Malware uses them to run
+// anti-debugging checks before a debugger stops at the entry.
+func (bin *binaryFile) tlsCallbacks() []uint64 {
+	dir := bin.peDataDirectory(pe.IMAGE_DIRECTORY_ENTRY_TLS)
+	tls, ok := bin.rvaData(dir.VirtualAddress, dir.Size)
+
+	if dir.VirtualAddress == 0 || !ok {
+		return nil
+	}
+
+	// IMAGE_TLS_DIRECTORY has the callback array's address after the raw data bounds and the index's address
+	pointerSize := bin.pointerSize()
+
+	readPointer := func(data []byte) uint64 {
+		if pointerSize == 8 {
+			return binary.LittleEndian.Uint64(data)
+		}
+
+		return uint64(binary.LittleEndian.Uint32(data))
+	}
+
+	if len(tls) < pointerSize * 4 {
+		return nil
+	}
+
+	base := bin.peImageBase()
+	array := readPointer(tls[pointerSize * 3:])
+
+	if array < base {
+		return nil
+	}
+
+	var callbacks []uint64
+	data, _ := bin.rvaData(uint32(array - base), 64 * uint32(pointerSize))
+
+	for pos := 0; pos + pointerSize <= len(data); pos += pointerSize {
+		callback := readPointer(data[pos:])
+
+		if callback == 0 {
+			break
+		}
+
+		callbacks = append(callbacks, callback)
+	}
+
+	return callbacks
+}
+
+// Counts the constructors in an ELF's .preinit_array and .init_array, which run before main
+func (bin *binaryFile) elfConstructors() int {
+	count := 0
+
+	for _, section := range bin.elf.Sections {
+		if section.Type == elf.SHT_INIT_ARRAY || section.Type == elf.SHT_PREINIT_ARRAY {
+			count += int(section.Size) / bin.pointerSize()
+		}
+	}
+
+	return count
+}
+
+// Reads the PDB path from a PE's CodeView debug entry, which often has the developer's user name and project
+func (bin *binaryFile) pdbPath() string {
+	dir := bin.peDataDirectory(pe.IMAGE_DIRECTORY_ENTRY_DEBUG)
+	entries, ok := bin.rvaData(dir.VirtualAddress, dir.Size)
+
+	if dir.VirtualAddress == 0 || !ok {
+		return ""
+	}
+
+	// IMAGE_DEBUG_DIRECTORY entries are 28 bytes, with the type at 12 and the data's file offset at 24
+	for pos := 0; pos + 28 <= len(entries); pos += 28 {
+		if binary.LittleEndian.Uint32(entries[pos + 12:]) != 2 {
+			continue
+		}
+
+		offset := uint64(binary.LittleEndian.Uint32(entries[pos + 24:]))
+
+		// RSDS entries have a GUID and an age before the path
+		if offset + 24 > uint64(len(bin.Data)) || !bytes.HasPrefix(bin.Data[offset:], []byte("RSDS")) {
+			continue
+		}
+
+		path := bin.Data[offset + 24:]
+		if end := bytes.IndexByte(path, 0); end >= 0 {
+			path = path[:end]
+		}
+
+		if len(path) > 260 {
+			path = path[:260]
+		}
+
+		return string(path)
+	}
+
+	return ""
+}
+
+// Lists the ELF or PE sections with anything suspicious about them: unusual names, writable code, high entropy, or
+// code sections with much more memory than file data, which something unpacks into at run time
+func (bin *binaryFile) suspiciousSections() []string {
+	var found []string
+
+	check := func(name string, data []byte, exec bool, write bool, virtualSize uint64) {
+		var reasons []string
+
+		if !standardSectionName(bin.Format, name) {
+			reasons = append(reasons, "unusual name")
+		}
+
+		if exec && write {
+			reasons = append(reasons, "writable and executable")
+		}
+
+		if len(data) >= 512 {
+			if entropy := shannonEntropy(data); entropy > packedEntropy {
+				reasons = append(reasons, fmt.Sprintf("entropy %.2f", entropy))
+			}
+		}
+
+		if exec && virtualSize > 0x1000 && virtualSize > uint64(len(data)) * 4 {
+			reasons = append(reasons, fmt.Sprintf("0x%x bytes in memory but 0x%x in the file", virtualSize, len(data)))
+		}
+
+		if len(reasons) > 0 {
+			found = append(found, "`" + name + "`: " + strings.Join(reasons, ", "))
+		}
+	}
+
+	if bin.pe != nil {
+		for n, section := range bin.pe.Sections {
+			check(section.Name, bin.sectionData(bin.Sections[n]), section.Characteristics & pe.IMAGE_SCN_MEM_EXECUTE != 0,
+				section.Characteristics & pe.IMAGE_SCN_MEM_WRITE != 0, uint64(section.VirtualSize))
+		}
+	} else {
+		for _, section := range bin.elf.Sections {
+			if section.Type == elf.SHT_NULL || section.Type == elf.SHT_NOBITS {
+				continue
+			}
+
+			data, _ := section.Data()
+			check(section.Name, data, section.Flags & elf.SHF_EXECINSTR != 0, section.Flags & elf.SHF_WRITE != 0, 0)
+		}
+
+		// Packed ELFs often have no section headers, only segments, so those are checked for writable code too
+		for _, prog := range bin.elf.Progs {
+			if prog.Type == elf.PT_LOAD && prog.Flags & elf.PF_X != 0 && prog.Flags & elf.PF_W != 0 {
+				found = append(found, fmt.Sprintf("segment at 0x%x: writable and executable", prog.Vaddr))
+			}
+		}
+	}
+
+	return found
+}
+
+// Lists hints that the binary is packed or protected, from section names, strings packers leave, entropy and where
+// the entry point is
+func (bin *binaryFile) packerHints() []string {
+	var hints []string
+	seen := make(map[string]bool)
+
+	add := func(hint string) {
+		if !seen[hint] {
+			seen[hint] = true
+			hints = append(hints, hint)
+		}
+	}
+
+	for _, section := range bin.Sections {
+		if packer, ok := packerSections[section.Name]; ok {
+			add(packer + " (section `" + section.Name + "`)")
+		}
+	}
+
+	// Packers write their strings near the start, searching all of a large file would find them by chance
+	head := bin.Data
+	if len(head) > 0x10000 {
+		head = head[:0x10000]
+	}
+
+	for _, str := range packerStrings {
+		if bytes.Contains(head, str.magic) {
+			add(str.name + " (string \"" + string(str.magic) + "\")")
+		}
+	}
+
+	if entropy := shannonEntropy(bin.Data); entropy > packedEntropy {
+		add(fmt.Sprintf("the whole file has an entropy of %.2f", entropy))
+	}
+
+	if section, ok := bin.sectionAt(bin.Entry); !ok && bin.Entry != 0 {
+		add("the entry point isn't in any section")
+	} else if ok && !section.Exec {
+		add("the entry point is in `" + section.Name + "`, which isn't executable")
+	} else if ok && bin.pe != nil && section.Name != bin.Sections[0].Name && !strings.HasPrefix(section.Name, ".text") &&
+		section.Name == bin.Sections[len(bin.Sections) - 1].Name {
+		add("the entry point is in the last section, `" + section.Name + "`")
+	}
+
+	if bin.elf != nil && len(bin.elf.Sections) == 0 {
+		add("the ELF has no section headers")
+	}
+
+	return hints
+}
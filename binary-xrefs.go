@@ -0,0 +1,180 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/pe"
+	"encoding/binary"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// A reference to an address. Kind is "call", "jump", "data" (an instruction operand) or "pointer" (a value in a data
+// section); Index is the referencing instruction's index in instructions(), or -1 for pointers.
+type binaryXref struct {
+	From    uint64
+	Kind    string
+	Index   int
+	Section string
+}
+
+// Matches hex numbers in operands, Capstone prints addresses in hex
+var operandHexRegexp = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+
+// Matches x64 RIP-relative operands, i.e. "[rip + 0x2fe2]"
+var ripRelativeRegexp = regexp.MustCompile(`\[rip ([+-]) (0x[0-9a-fA-F]+)\]`)
+
+// Branches other than calls on the non-x86 architectures, which otherwise start with "b" (b, b.eq, bne, beqz, ...)
+var compareBranchMnemonics = StrList{"cbz", "cbnz", "tbz", "tbnz"}
+
+// Returns the size of a pointer in the binary
+func (bin *binaryFile) pointerSize() int {
+	if bin.elf != nil && bin.elf.Class == elf.ELFCLASS64 {
+		return 8
+	}
+
+	if bin.pe != nil {
+		if _, ok := bin.pe.OptionalHeader.(*pe.OptionalHeader64); ok {
+			return 8
+		}
+	}
+
+	return 4
+}
+
+// Checks if a section holds the program's data, rather than metadata for the loader like symbol and relocation tables
+func (bin *binaryFile) isDataSection(section binarySection) bool {
+	if bin.elf == nil {
+		return true
+	}
+
+	switch bin.elf.Section(section.Name).Type {
+	case elf.SHT_PROGBITS, elf.SHT_INIT_ARRAY, elf.SHT_FINI_ARRAY, elf.SHT_PREINIT_ARRAY:
+		return true
+	}
+
+	return false
+}
+
+// Returns the binary's byte order
+func (bin *binaryFile) byteOrder() binary.ByteOrder {
+	if bin.elf != nil {
+		return bin.elf.ByteOrder
+	}
+
+	return binary.LittleEndian
+}
+
+// Classifies an instruction that references an address as a call, jump or data reference
+func (bin *binaryFile) referenceKind(i asm.Insn) string {
+	if callMnemonics.contains(i.Mnemonic) {
+		return "call"
+	}
+
+	if bin.Arch == "x86" || bin.Arch == "x64" {
+		if strings.HasPrefix(i.Mnemonic, "j") || strings.HasPrefix(i.Mnemonic, "loop") {
+			return "jump"
+		}
+
+		return "data"
+	}
+
+	if strings.HasPrefix(i.Mnemonic, "b") || strings.HasPrefix(i.Mnemonic, "j") || compareBranchMnemonics.contains(i.Mnemonic) {
+		return "jump"
+	}
+
+	return "data"
+}
+
+// Returns the addresses an instruction's operands refer to
+func instructionTargets(i asm.Insn) []uint64 {
+	var targets []uint64
+
+	// RIP-relative operands are relative to the next instruction, the displacement itself isn't an address
+	if match := ripRelativeRegexp.FindStringSubmatch(i.OpStr); match != nil {
+		disp, _ := strconv.ParseUint(match[2], 0, 64)
+		next := i.Address + uint64(len(i.Bytes))
+
+		if match[1] == "-" {
+			return []uint64{next - disp}
+		}
+
+		return []uint64{next + disp}
+	}
+
+	for _, number := range operandHexRegexp.FindAllString(i.OpStr, -1) {
+		if value, err := strconv.ParseUint(number, 0, 64); err == nil {
+			targets = append(targets, value)
+		}
+	}
+
+	return targets
+}
+
+// Finds every reference to an address, from instruction operands in the executable sections and pointers in the
+// data sections
+func (bin *binaryFile) xrefs(addr uint64) []binaryXref {
+	var refs []binaryXref
+
+	for n, i := range bin.instructions() {
+		for _, target := range instructionTargets(i) {
+			if target == addr {
+				section, _ := bin.sectionAt(i.Address)
+				refs = append(refs, binaryXref{i.Address, bin.referenceKind(i), n, section.Name})
+				break
+			}
+		}
+	}
+
+	size := bin.pointerSize()
+	order := bin.byteOrder()
+
+	for _, section := range bin.Sections {
+		data := bin.sectionData(section)
+
+		if section.Exec || section.Addr == 0 || !bin.isDataSection(section) {
+			continue
+		}
+
+		for offset := 0; offset + size <= len(data); offset += size {
+			var value uint64
+
+			if size == 8 {
+				value = order.Uint64(data[offset:])
+			} else {
+				value = uint64(order.Uint32(data[offset:]))
+			}
+
+			if value == addr {
+				refs = append(refs, binaryXref{section.Addr + uint64(offset), "pointer", -1, section.Name})
+			}
+		}
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].From < refs[j].From
+	})
+
+	return refs
+}
+
+// Names an address relative to the function it's in, i.e. "main+0x1a"
+func (bin *binaryFile) addressName(addr uint64) string {
+	funcs := bin.functions()
+	n := sort.Search(len(funcs), func(i int) bool {
+		return funcs[i].Addr > addr
+	}) - 1
+
+	if n < 0 || addr >= funcs[n].Addr + funcs[n].Size {
+		return "0x" + strconv.FormatUint(addr, 16)
+	}
+
+	if addr == funcs[n].Addr {
+		return funcs[n].Name
+	}
+
+	return funcs[n].Name + "+0x" + strconv.FormatUint(addr - funcs[n].Addr, 16)
+}
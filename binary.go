@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/pe"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// How long an uploaded binary is kept for follow-up commands
+const binarySessionTTL = time.Hour
+
+// A section of an uploaded binary
+type binarySection struct {
+	Name   string
+	Addr   uint64
+	Offset uint64
+	Size   uint64
+	Exec   bool
+}
+
+// A symbol of an uploaded binary
+type binarySymbol struct {
+	Name string
+	Addr uint64
+	Size uint64
+	Func bool
+}
+
+// An uploaded ELF or PE file, parsed far enough for the binary analysis commands
+type binaryFile struct {
+	Name   string
+	Data   []byte
+	Format string
+
+	// Architecture name for the assembler core, empty if it isn't one the core supports
+	Arch    string
+	Machine string
+
+	Entry    uint64
+	Sections []binarySection
+	Symbols  []binarySymbol
+
+	// The parsed file, one of these is set depending on the format
+	elf *elf.File
+	pe  *pe.File
+
+	// Analysis results, worked out the first time a command needs them
+	codeOnce  sync.Once
+	code      []asm.Insn
+	funcsOnce sync.Once
+	funcs     []binaryFunction
+}
+
+// A binary a user uploaded, so commands after the first don't need the attachment again
+type binarySession struct {
+	file    *binaryFile
+	updated time.Time
+}
+
+var (
+	binarySessions    = make(map[string]binarySession)
+	binarySessionLock sync.Mutex
+)
+
+// Returned when a command needs a binary and the user hasn't uploaded one
+var errNoBinary = errors.New("attach an ELF or PE binary to the command, it's kept for an hour for follow-up commands")
+
+// Architecture names for ELF machines
+var elfArchs = map[elf.Machine]string{
+	elf.EM_386:     "x86",
+	elf.EM_X86_64:  "x64",
+	elf.EM_ARM:     "arm",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_PPC:     "ppc",
+	elf.EM_PPC64:   "ppc64",
+	elf.EM_MIPS:    "mips",
+}
+
+// Architecture names for PE machines
+var peArchs = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "x86",
+	pe.IMAGE_FILE_MACHINE_AMD64: "x64",
+	pe.IMAGE_FILE_MACHINE_ARM:   "arm",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "thumb",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+}
+
+// Parses an ELF or PE file
+func parseBinary(name string, data []byte) (*binaryFile, error) {
+	if bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+		return parseELF(name, data)
+	}
+
+	if bytes.HasPrefix(data, []byte("MZ")) {
+		return parsePE(name, data)
+	}
+
+	return nil, errors.New("the file isn't an ELF or PE binary")
+}
+
+// Parses an ELF file's sections and symbols
+func parseELF(name string, data []byte) (*binaryFile, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, errors.New("couldn't parse the ELF, " + err.Error())
+	}
+
+	bin := &binaryFile{
+		Name:    name,
+		Data:    data,
+		Format:  "ELF",
+		Arch:    elfArchs[f.Machine],
+		Machine: strings.TrimPrefix(f.Machine.String(), "EM_"),
+		Entry:   f.Entry,
+		elf:     f,
+	}
+
+	// 64-bit MIPS, and little endian MIPS and PowerPC, have their own names
+	little := f.Data == elf.ELFDATA2LSB
+
+	switch {
+	case f.Machine == elf.EM_MIPS && f.Class == elf.ELFCLASS64 && little:
+		bin.Arch = "mips64el"
+	case f.Machine == elf.EM_MIPS && f.Class == elf.ELFCLASS64:
+		bin.Arch = "mips64"
+	case f.Machine == elf.EM_MIPS && little:
+		bin.Arch = "mipsel"
+	case f.Machine == elf.EM_PPC && little:
+		bin.Arch = "ppc32le"
+	case f.Machine == elf.EM_PPC64 && little:
+		bin.Arch = "ppc64le"
+	}
+
+	for _, section := range f.Sections {
+		if section.Type == elf.SHT_NULL {
+			continue
+		}
+
+		size := section.Size
+		if section.Type == elf.SHT_NOBITS {
+			size = 0
+		}
+
+		bin.Sections = append(bin.Sections, binarySection{
+			Name:   section.Name,
+			Addr:   section.Addr,
+			Offset: section.Offset,
+			Size:   size,
+			Exec:   section.Flags&elf.SHF_EXECINSTR != 0,
+		})
+	}
+
+	symbols, _ := f.Symbols()
+	dynamic, _ := f.DynamicSymbols()
+
+	for _, sym := range append(symbols, dynamic...) {
+		if sym.Name == "" || sym.Value == 0 || sym.Section == elf.SHN_UNDEF {
+			continue
+		}
+
+		typ := elf.ST_TYPE(sym.Info)
+
+		if typ != elf.STT_FUNC && typ != elf.STT_OBJECT && typ != elf.STT_NOTYPE {
+			continue
+		}
+
+		bin.Symbols = append(bin.Symbols, binarySymbol{
+			Name: sym.Name,
+			Addr: sym.Value,
+			Size: sym.Size,
+			Func: typ == elf.STT_FUNC,
+		})
+	}
+
+	bin.sortSymbols()
+	return bin, nil
+}
+
+// Parses a PE file's sections. PEs rarely have a symbol table, so the entry point is the only symbol that's added.
+func parsePE(name string, data []byte) (*binaryFile, error) {
+	f, err := pe.NewFile(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, errors.New("couldn't parse the PE, " + err.Error())
+	}
+
+	var imageBase uint64
+	var entry uint32
+
+	switch header := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase = uint64(header.ImageBase)
+		entry = header.AddressOfEntryPoint
+	case *pe.OptionalHeader64:
+		imageBase = header.ImageBase
+		entry = header.AddressOfEntryPoint
+	}
+
+	bin := &binaryFile{
+		Name:    name,
+		Data:    data,
+		Format:  "PE",
+		Arch:    peArchs[f.Machine],
+		Machine: peMachineName(f.Machine),
+		Entry:   imageBase + uint64(entry),
+		pe:      f,
+	}
+
+	for _, section := range f.Sections {
+		size := uint64(section.Size)
+		if section.VirtualSize != 0 && uint64(section.VirtualSize) < size {
+			size = uint64(section.VirtualSize)
+		}
+
+		bin.Sections = append(bin.Sections, binarySection{
+			Name:   section.Name,
+			Addr:   imageBase + uint64(section.VirtualAddress),
+			Offset: uint64(section.Offset),
+			Size:   size,
+			Exec:   section.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0,
+		})
+	}
+
+	for _, sym := range f.Symbols {
+		if sym.SectionNumber <= 0 || int(sym.SectionNumber) > len(f.Sections) || sym.Name == "" {
+			continue
+		}
+
+		bin.Symbols = append(bin.Symbols, binarySymbol{
+			Name: sym.Name,
+			Addr: imageBase + uint64(f.Sections[sym.SectionNumber - 1].VirtualAddress) + uint64(sym.Value),
+			// Function symbols in COFF have the derived type "function" (0x20)
+			Func: sym.Type&0xf0 == 0x20,
+		})
+	}
+
+	if entry != 0 {
+		bin.Symbols = append(bin.Symbols, binarySymbol{Name: "entry", Addr: bin.Entry, Func: true})
+	}
+
+	bin.sortSymbols()
+	return bin, nil
+}
+
+// Names the PE machine types the assembler core knows, and a hex value for the rest
+func peMachineName(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "I386"
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "AMD64"
+	case pe.IMAGE_FILE_MACHINE_ARM:
+		return "ARM"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "ARMNT"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "ARM64"
+	}
+
+	return "0x" + strings.ToUpper(strconv.FormatUint(uint64(machine), 16))
+}
+
+// Sorts symbols by address and drops duplicates, the static and dynamic symbol tables often both list a symbol
+func (bin *binaryFile) sortSymbols() {
+	sort.SliceStable(bin.Symbols, func(i, j int) bool {
+		return bin.Symbols[i].Addr < bin.Symbols[j].Addr
+	})
+
+	var unique []binarySymbol
+	seen := make(map[binarySymbol]bool)
+
+	for _, sym := range bin.Symbols {
+		key := binarySymbol{Name: sym.Name, Addr: sym.Addr}
+
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		unique = append(unique, sym)
+	}
+
+	bin.Symbols = unique
+}
+
+// Returns the bytes of a section, empty for sections that take no space in the file
+func (bin *binaryFile) sectionData(section binarySection) []byte {
+	if section.Offset >= uint64(len(bin.Data)) {
+		return nil
+	}
+
+	end := section.Offset + section.Size
+	if end > uint64(len(bin.Data)) {
+		end = uint64(len(bin.Data))
+	}
+
+	return bin.Data[section.Offset:end]
+}
+
+// Returns the section that contains the virtual address
+func (bin *binaryFile) sectionAt(addr uint64) (binarySection, bool) {
+	for _, section := range bin.Sections {
+		if section.Addr != 0 && addr >= section.Addr && addr < section.Addr + section.Size {
+			return section, true
+		}
+	}
+
+	return binarySection{}, false
+}
+
+// Returns the section that contains the file offset, if it's loaded at an address
+func (bin *binaryFile) sectionAtOffset(offset uint64) (binarySection, bool) {
+	for _, section := range bin.Sections {
+		if section.Addr != 0 && offset >= section.Offset && offset < section.Offset + section.Size {
+			return section, true
+		}
+	}
+
+	return binarySection{}, false
+}
+
+// Returns a copy of the binary with the bytes at the file offset replaced. A patch can't grow the file.
+func (bin *binaryFile) patched(offset uint64, patch []byte) (*binaryFile, error) {
+	if offset + uint64(len(patch)) > uint64(len(bin.Data)) {
+		return nil, errors.New("the patch runs past the end of the file, which is 0x" + strconv.FormatUint(uint64(len(bin.Data)), 16) + " bytes")
+	}
+
+	data := append([]byte{}, bin.Data...)
+	copy(data[offset:], patch)
+
+	return parseBinary(bin.Name, data)
+}
+
+// Returns the names of the symbols at each address
+func (bin *binaryFile) symbolNames() map[uint64][]string {
+	names := make(map[uint64][]string)
+
+	for _, sym := range bin.Symbols {
+		names[sym.Addr] = append(names[sym.Addr], sym.Name)
+	}
+
+	return names
+}
+
+// Downloads a message attachment
+func downloadAttachment(attachment *discordgo.MessageAttachment) ([]byte, error) {
+	resp, err := http.Get(attachment.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Discord returned " + resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Returns the binary attached to the message, or the one the user uploaded last if there's no attachment
+func sessionBinary(m *discordgo.MessageCreate) (*binaryFile, error) {
+	if len(m.Attachments) > 0 {
+		data, err := downloadAttachment(m.Attachments[0])
+
+		if err != nil {
+			return nil, errors.New("couldn't download the attachment, " + err.Error())
+		}
+
+		bin, err := parseBinary(m.Attachments[0].Filename, data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		setSessionBinary(m.Author.ID, bin)
+		return bin, nil
+	}
+
+	bin, ok := lastSessionBinary(m.Author.ID)
+
+	if !ok {
+		return nil, errNoBinary
+	}
+
+	return bin, nil
+}
+
+// Returns the binary the user uploaded last, if it hasn't expired
+func lastSessionBinary(userID string) (*binaryFile, bool) {
+	binarySessionLock.Lock()
+	defer binarySessionLock.Unlock()
+
+	session, ok := binarySessions[userID]
+
+	if !ok || time.Since(session.updated) > binarySessionTTL {
+		delete(binarySessions, userID)
+		return nil, false
+	}
+
+	session.updated = time.Now()
+	binarySessions[userID] = session
+
+	return session.file, true
+}
+
+// Makes the binary the one the user's follow-up commands work on, and drops other users' expired binaries
+func setSessionBinary(userID string, bin *binaryFile) {
+	binarySessionLock.Lock()
+	defer binarySessionLock.Unlock()
+
+	for id, session := range binarySessions {
+		if time.Since(session.updated) > binarySessionTTL {
+			delete(binarySessions, id)
+		}
+	}
+
+	binarySessions[userID] = binarySession{bin, time.Now()}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A blocked user or guild. Temporary blocks have an expiry, permanent ones don't.
+type block struct {
+	Reason  string    `json:"reason"`
+	Expires time.Time `json:"expires,omitempty"`
+
+	// Set once the user has appealed, each block can only be appealed once
+	Appealed bool `json:"appealed,omitempty"`
+}
+
+// Persistent blocklist of users and guilds, keyed by ID
+type blocklist struct {
+	Users  map[string]block `json:"users"`
+	Guilds map[string]block `json:"guilds"`
+}
+
+var (
+	blocks    blocklist
+	blockLock sync.Mutex
+)
+
+// Recent command and failure timestamps per user, used to detect spam
+var (
+	recentCommands = make(map[string][]time.Time)
+	recentFailures = make(map[string][]time.Time)
+	recentAppeals  = make(map[string][]time.Time)
+
+	// Users that were already told they're blocked, so they aren't DM'd for every message
+	blockNotified = make(map[string]bool)
+)
+
+// Commands blocked users can still use
+var blockExempt = StrList{"appeal"}
+
+// Spam limits, read from the [abuse] section of config.ini
+var (
+	AbuseMaxCommands    int
+	AbuseMaxFailures    int
+	AbuseWindow         time.Duration
+	AbuseBlockDuration  time.Duration
+	AbuseAppealCooldown time.Duration
+)
+
+// Reads the spam limits from config.ini
+func loadAbuse() {
+	AbuseMaxCommands = getConfigPropertyAsInt("abuse", "max_commands", 10)
+	AbuseMaxFailures = getConfigPropertyAsInt("abuse", "max_failures", 8)
+	AbuseWindow = time.Duration(getConfigPropertyAsInt("abuse", "window_seconds", 30)) * time.Second
+	AbuseBlockDuration = time.Duration(getConfigPropertyAsInt("abuse", "block_minutes", 10)) * time.Minute
+	AbuseAppealCooldown = time.Duration(getConfigPropertyAsInt("abuse", "appeal_cooldown_minutes", 5)) * time.Minute
+}
+
+// Loads the blocklist from the data directory
+func loadBlocklist() {
+	list := blocklist{}
+
+	if err := loadStore("blocklist", &list); err != nil {
+		fmt.Println("[ERROR] Failed to load the blocklist, " + err.Error())
+	}
+
+	if list.Users == nil {
+		list.Users = make(map[string]block)
+	}
+
+	if list.Guilds == nil {
+		list.Guilds = make(map[string]block)
+	}
+
+	blockLock.Lock()
+	blocks = list
+	blockLock.Unlock()
+}
+
+// Checks if a block is still in effect
+func (b block) active() bool {
+	return b.Expires.IsZero() || time.Now().Before(b.Expires)
+}
+
+// Describes how long the block lasts for
+func (b block) duration() string {
+	if b.Expires.IsZero() {
+		return "permanently"
+	}
+
+	return "until " + b.Expires.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// Adds now to the key's timestamps and drops the ones older than the window, returning how many are left. Keys with
+// nothing left in the window are dropped too, so the map only holds the ones seen recently.
+func countRecent(recent map[string][]time.Time, key string, window time.Duration, now time.Time) int {
+	for k, times := range recent {
+		var kept []time.Time
+
+		for _, t := range times {
+			if now.Sub(t) < window {
+				kept = append(kept, t)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(recent, k)
+		} else {
+			recent[k] = kept
+		}
+	}
+
+	recent[key] = append(recent[key], now)
+
+	return len(recent[key])
+}
+
+// Checks if the user or guild is blocked, for messages that aren't commands so don't count towards the rate limits
+func userBlocked(userID string, guildID string) bool {
+	if DeveloperList.contains(userID) {
+		return false
+	}
+
+	blockLock.Lock()
+	defer blockLock.Unlock()
+
+	if b, ok := blocks.Guilds[guildID]; ok && guildID != "" && b.active() {
+		return true
+	}
+
+	b, ok := blocks.Users[userID]
+	return ok && b.active()
+}
+
+// Checks the blocklist and rate limits for the message author, returns false if the command shouldn't run.
+// Users that trip the spam limits are blocked temporarily.
+func checkBlocklist(s Responder, m *discordgo.MessageCreate, command Command) bool {
+	if blockExempt.contains(command.name) || DeveloperList.contains(m.Author.ID) {
+		return true
+	}
+
+	blockLock.Lock()
+
+	if b, ok := blocks.Guilds[m.GuildID]; ok && m.GuildID != "" && b.active() {
+		blockLock.Unlock()
+		return false
+	}
+
+	if b, ok := blocks.Users[m.Author.ID]; ok {
+		if b.active() {
+			notify := !blockNotified[m.Author.ID]
+			blockNotified[m.Author.ID] = true
+			blockLock.Unlock()
+
+			if notify {
+				notifyBlocked(s, m.Author.ID, b)
+			}
+
+			return false
+		}
+
+		// The temporary block has run out
+		delete(blocks.Users, m.Author.ID)
+		delete(blockNotified, m.Author.ID)
+		_ = saveStore("blocklist", blocks)
+	}
+
+	spamming := countRecent(recentCommands, m.Author.ID, AbuseWindow, time.Now()) > AbuseMaxCommands && AbuseMaxCommands > 0
+	blockLock.Unlock()
+
+	if spamming {
+		tempBlock(s, m.Author.ID, "Sending too many commands")
+		return false
+	}
+
+	return true
+}
+
+// Records a failed command (i.e. bad usage) for the user, temporarily blocking them if it keeps happening
+func recordFailure(s Responder, userID string) {
+	if DeveloperList.contains(userID) {
+		return
+	}
+
+	blockLock.Lock()
+	failing := countRecent(recentFailures, userID, AbuseWindow, time.Now()) > AbuseMaxFailures && AbuseMaxFailures > 0
+	blockLock.Unlock()
+
+	if failing {
+		tempBlock(s, userID, "Too many failed commands")
+	}
+}
+
+// Blocks a user for the configured temporary block duration
+func tempBlock(s Responder, userID string, reason string) {
+	b := block{
+		Reason:  reason,
+		Expires: time.Now().Add(AbuseBlockDuration),
+	}
+
+	blockLock.Lock()
+	blocks.Users[userID] = b
+	blockNotified[userID] = true
+	delete(recentCommands, userID)
+	delete(recentFailures, userID)
+	err := saveStore("blocklist", blocks)
+	blockLock.Unlock()
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to save the blocklist, " + err.Error())
+	}
+
+	fmt.Println("[INFO] Temporarily blocked user " + userID + ": " + reason)
+	notifyBlocked(s, userID, b)
+}
+
+// DMs a blocked user to tell them why, and how to appeal
+func notifyBlocked(s Responder, userID string, b block) {
+	channel, err := s.UserChannelCreate(userID)
+
+	if err != nil {
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(channel.ID, "You've been blocked from using REBot " + b.duration() + ". Reason: " + b.Reason +
+		"\nIf you think this is a mistake, you can appeal by sending me `" + CommandPrefix + "appeal {message ...}`.")
+}
+
+// Sends a message to every developer in a DM
+func notifyDevelopers(s Responder, msg string) int {
+	sent := 0
+
+	for _, dev := range DeveloperList {
+		channel, err := s.UserChannelCreate(dev)
+
+		if err != nil {
+			continue
+		}
+
+		if _, err := s.ChannelMessageSend(channel.ID, msg); err == nil {
+			sent++
+		}
+	}
+
+	return sent
+}
+
+// Forwards a block appeal to the developers. Appeals skip the rate limits, so each block only gets one, or a
+// blocked user could flood the developers' DMs, and each user has to wait out a cooldown between tries.
+func cmdAppeal(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	blockLock.Lock()
+
+	// Only the first try during the cooldown is told to wait, the rest get no reply
+	if AbuseAppealCooldown > 0 {
+		if tries := countRecent(recentAppeals, m.Author.ID, AbuseAppealCooldown, time.Now()); tries > 1 {
+			blockLock.Unlock()
+
+			if tries == 2 {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Please wait a few minutes before appealing again.")
+			}
+
+			return
+		}
+	}
+	b, blocked := blocks.Users[m.Author.ID]
+
+	if !blocked || !b.active() {
+		blockLock.Unlock()
+		_, _ = s.ChannelMessageSend(m.ChannelID, "You're not blocked!")
+		return
+	}
+
+	if b.Appealed {
+		blockLock.Unlock()
+		_, _ = s.ChannelMessageSend(m.ChannelID, "You've already appealed this block, the developers will look at it.")
+		return
+	}
+
+	appealed := b
+	appealed.Appealed = true
+	blocks.Users[m.Author.ID] = appealed
+	err := saveStore("blocklist", blocks)
+	blockLock.Unlock()
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to save the blocklist, " + err.Error())
+	}
+
+	msg := "Block appeal from `" + m.Author.String() + "` (" + m.Author.ID + "), blocked " + b.duration() + " for: " + b.Reason +
+		"```" + strings.Join(args[1:], " ") + "```Unblock with `" + CommandPrefix + "unblock user " + m.Author.ID + "`"
+
+	if notifyDevelopers(s, msg) == 0 {
+		// Nobody got it, so it doesn't use up the appeal
+		blockLock.Lock()
+
+		if current, ok := blocks.Users[m.Author.ID]; ok && current == appealed {
+			current.Appealed = false
+			blocks.Users[m.Author.ID] = current
+			_ = saveStore("blocklist", blocks)
+		}
+
+		blockLock.Unlock()
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I couldn't deliver your appeal. Try again later.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Your appeal has been sent.")
+}
+
+// Blocks a user or guild, optionally for a number of minutes
+func cmdBlock(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	usage := "Usage: " + CommandPrefix + "block [user|guild] [id] {minutes} {reason ...}"
+	kind := strings.ToLower(args[1])
+
+	if kind != "user" && kind != "guild" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	id := strings.Trim(args[2], "<@!>")
+	b := block{Reason: "No reason given"}
+	reason := args[3:]
+
+	if len(reason) > 0 {
+		if minutes, err := strconv.Atoi(reason[0]); err == nil {
+			if minutes <= 0 {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, a block has to last at least a minute. Leave the minutes out to block permanently.")
+				return
+			}
+
+			b.Expires = time.Now().Add(time.Duration(minutes) * time.Minute)
+			reason = reason[1:]
+		}
+	}
+
+	if len(reason) > 0 {
+		b.Reason = strings.Join(reason, " ")
+	}
+
+	blockLock.Lock()
+
+	if kind == "user" {
+		blocks.Users[id] = b
+		delete(blockNotified, id)
+	} else {
+		blocks.Guilds[id] = b
+	}
+
+	err := saveStore("blocklist", blocks)
+	blockLock.Unlock()
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to save the blocklist, " + err.Error())
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the blocklist.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Blocked " + kind + " " + id + " " + b.duration() + ".")
+}
+
+// Removes a user or guild from the blocklist
+func cmdUnblock(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	kind := strings.ToLower(args[1])
+	id := strings.Trim(args[2], "<@!>")
+
+	blockLock.Lock()
+
+	if kind == "user" {
+		delete(blocks.Users, id)
+		delete(blockNotified, id)
+	} else if kind == "guild" {
+		delete(blocks.Guilds, id)
+	} else {
+		blockLock.Unlock()
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "unblock [user|guild] [id]")
+		return
+	}
+
+	err := saveStore("blocklist", blocks)
+	blockLock.Unlock()
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to save the blocklist, " + err.Error())
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the blocklist.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Unblocked " + kind + " " + id + ".")
+}
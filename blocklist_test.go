@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountRecent(t *testing.T) {
+	now := time.Now()
+	recent := map[string][]time.Time{
+		"stale":  {now.Add(-time.Minute)},
+		"active": {now.Add(-time.Minute), now.Add(-time.Second)},
+	}
+
+	if n := countRecent(recent, "new", 30 * time.Second, now); n != 1 {
+		t.Errorf("got %d, want 1", n)
+	}
+
+	// Users with nothing left in the window are forgotten, the rest keep what's still in it
+	if _, ok := recent["stale"]; ok || len(recent["active"]) != 1 || len(recent) != 2 {
+		t.Errorf("got %v, want only active and new left", recent)
+	}
+}
+
+func TestBlockMinutes(t *testing.T) {
+	for _, content := range []string{"!block user 123 0 spam", "!block user 123 -5 spam"} {
+		replies := runHandler(cmdBlock, content).sent()
+
+		if len(replies) != 1 || !strings.HasPrefix(replies[0].content, "Sorry, a block has to last") {
+			t.Errorf("%q: got %+v, want the block refused", content, replies)
+		}
+	}
+}
+
+func TestAppealCooldown(t *testing.T) {
+	AbuseAppealCooldown = 5 * time.Minute
+	recentAppeals = make(map[string][]time.Time)
+
+	f := &fakeResponder{}
+	m := testMessage("!appeal please")
+
+	for n := 0; n < 3; n++ {
+		cmdAppeal(cmdArguments{f, m, strings.Split(m.Content, " ")})
+	}
+
+	// The tries after the first are held back, and only told to wait once
+	replies := f.sent()
+
+	if len(replies) != 2 || replies[0].content != "You're not blocked!" || !strings.HasPrefix(replies[1].content, "Please wait") {
+		t.Errorf("got %+v, want one answer and one request to wait", replies)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// A relative branch instruction !reljmp can encode
+type branchForm struct {
+	name string
+
+	// Where the offset is taken from, relative to the branch's own address. x86 takes it from the next
+	// instruction, ARM from pc, which is 8 bytes ahead in ARM state and 4 in Thumb.
+	bias int64
+
+	// The offset is stored divided by scale, in a signed field this many bits wide
+	scale int64
+	bits  uint
+
+	// Makes the instruction's bytes from the stored offset, already divided by scale
+	encode func(imm uint32) []byte
+}
+
+// Architectures !reljmp knows the branches of
+const branchArchs = "x86, x86_16, x86_64/x64, arm, thumb, arm64"
+
+// Makes an x86 branch from its opcode and an offset field of the given size
+func x86Branch(name string, opcode []byte, size int) branchForm {
+	return branchForm{name, int64(len(opcode) + size), 1, uint(size * 8), func(imm uint32) []byte {
+		out := make([]byte, 4)
+		binary.LittleEndian.PutUint32(out, imm)
+
+		return append(append([]byte{}, opcode...), out[:size]...)
+	}}
+}
+
+// Makes an ARM or ARM64 instruction word's bytes
+func armWordOf(word uint32) []byte {
+	out := make([]byte, 4)
+	binary.LittleEndian.PutUint32(out, word)
+
+	return out
+}
+
+// Makes a Thumb instruction's bytes from its halfwords
+func thumbHalfwords(halfwords ...uint32) []byte {
+	out := make([]byte, 2 * len(halfwords))
+
+	for n, h := range halfwords {
+		binary.LittleEndian.PutUint16(out[2 * n:], uint16(h))
+	}
+
+	return out
+}
+
+// Makes a 32-bit Thumb-2 b or bl, which store the top bits of the offset as J1 and J2, the sign XNORed with them
+func thumbLongBranch(second uint32) func(uint32) []byte {
+	return func(imm uint32) []byte {
+		s := imm >> 23 & 1
+		j1, j2 := ^(imm >> 22 ^ s) & 1, ^(imm >> 21 ^ s) & 1
+
+		return thumbHalfwords(0xf000 | s << 10 | imm >> 11 & 0x3ff, second | j1 << 13 | j2 << 11 | imm & 0x7ff)
+	}
+}
+
+// The relative branches of each architecture, conditional ones are shown with eq and the rest of the conditions
+// are the same encoding with a different condition field
+var branchForms = map[string][]branchForm{
+	"x86": {
+		x86Branch("jmp short", []byte{0xeb}, 1),
+		x86Branch("jmp", []byte{0xe9}, 4),
+		x86Branch("call", []byte{0xe8}, 4),
+		x86Branch("je short", []byte{0x74}, 1),
+		x86Branch("je", []byte{0x0f, 0x84}, 4),
+	},
+	"x86_16": {
+		x86Branch("jmp short", []byte{0xeb}, 1),
+		x86Branch("jmp", []byte{0xe9}, 2),
+		x86Branch("call", []byte{0xe8}, 2),
+		x86Branch("je short", []byte{0x74}, 1),
+		x86Branch("je", []byte{0x0f, 0x84}, 2),
+	},
+	"arm": {
+		{"b", 8, 4, 24, func(imm uint32) []byte { return armWordOf(0xea000000 | imm & 0xffffff) }},
+		{"bl", 8, 4, 24, func(imm uint32) []byte { return armWordOf(0xeb000000 | imm & 0xffffff) }},
+		{"beq", 8, 4, 24, func(imm uint32) []byte { return armWordOf(0x0a000000 | imm & 0xffffff) }},
+	},
+	"thumb": {
+		{"b.n", 4, 2, 11, func(imm uint32) []byte { return thumbHalfwords(0xe000 | imm & 0x7ff) }},
+		{"beq.n", 4, 2, 8, func(imm uint32) []byte { return thumbHalfwords(0xd000 | imm & 0xff) }},
+		{"b.w", 4, 2, 24, thumbLongBranch(0x9000)},
+		{"bl", 4, 2, 24, thumbLongBranch(0xd000)},
+		{"beq.w", 4, 2, 20, func(imm uint32) []byte {
+			// The conditional form has no room for the XNOR, its J1 and J2 are the offset's bits as they are
+			return thumbHalfwords(0xf000 | (imm >> 19 & 1) << 10 | imm >> 11 & 0x3f, 0x8000 | (imm >> 17 & 1) << 13 | (imm >> 18 & 1) << 11 | imm & 0x7ff)
+		}},
+	},
+	"arm64": {
+		{"b", 0, 4, 26, func(imm uint32) []byte { return armWordOf(0x14000000 | imm & 0x3ffffff) }},
+		{"bl", 0, 4, 26, func(imm uint32) []byte { return armWordOf(0x94000000 | imm & 0x3ffffff) }},
+		{"b.eq", 0, 4, 19, func(imm uint32) []byte { return armWordOf(0x54000000 | (imm & 0x7ffff) << 5) }},
+		{"cbz x0", 0, 4, 19, func(imm uint32) []byte { return armWordOf(0xb4000000 | (imm & 0x7ffff) << 5) }},
+		{"tbz x0, #0", 0, 4, 14, func(imm uint32) []byte { return armWordOf(0x36000000 | (imm & 0x3fff) << 5) }},
+	},
+}
+
+// Parses a hex address, with or without 0x in front
+func parseHexAddress(text string) (uint64, bool) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(text), "0x"), 16, 64)
+	return addr, err == nil
+}
+
+// Works out the bytes of the branches from one address to another
+func cmdReljmp(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+	forms := branchForms[asmArch]
+
+	// 64-bit x86 branches are the same as 32-bit ones, a 32-bit offset from the next instruction
+	if (StrList{"x64", "x86_64", "x86-64"}).contains(asmArch) {
+		forms = branchForms["x86"]
+	}
+
+	if forms == nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, branchArchs))
+		return
+	}
+
+	if len(rest) != 2 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, give the address of the branch and the address it should go to, i.e. '!reljmp x64 401000 401234'.")
+		return
+	}
+
+	from, okFrom := parseHexAddress(rest[0])
+	to, okTo := parseHexAddress(rest[1])
+
+	if !okFrom || !okTo {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + strings.Join(rest, " ") + "' aren't two hex addresses.")
+		return
+	}
+
+	out := ""
+
+	for _, form := range forms {
+		offset := int64(to - from) - form.bias
+		limit := form.scale << (form.bits - 1)
+		line := padRight(form.name, " ", 12)
+
+		switch {
+		case offset % form.scale != 0:
+			out += line + "can't, the target isn't " + strconv.Itoa(int(form.scale)) + " byte aligned\n"
+			continue
+		case offset < -limit || offset >= limit:
+			out += line + "out of range, it reaches -0x" + strconv.FormatInt(limit, 16) + " to +0x" + strconv.FormatInt(limit - form.scale, 16) + "\n"
+			continue
+		}
+
+		code := form.encode(uint32(offset / form.scale))
+		line += padRight(formatOpcodes(code), " ", 13) + padRight(signedOffset(offset), " ", 12)
+
+		// Disassembling it back is a check on the encoding, and shows the target the way a disassembler would
+		if ins, err := asm.Disassemble(asmArch, code, from); err == nil && len(ins) == 1 {
+			line += strings.TrimSpace(ins[0].Mnemonic + " " + ins[0].OpStr)
+		}
+
+		out += line + "\n"
+	}
+
+	content := "Branches from 0x" + strconv.FormatUint(from, 16) + " to 0x" + strconv.FormatUint(to, 16) + ", the offset is from "
+
+	switch forms[0].bias {
+	case 0:
+		content += "the branch itself"
+	case 4, 8:
+		content += "pc, " + strconv.Itoa(int(forms[0].bias)) + " bytes past the branch"
+	default:
+		content += "the next instruction"
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, content + ":```\n" + out + "```")
+}
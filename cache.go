@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Commands whose replies only depend on their arguments and the user's preferences, so a repeat of the same input
+// can be answered from the cache instead of running the engines again
+var cacheableCommands = StrList{
+	"assemble", "disassemble", "disas-modes", "explain", "encoding", "armimm", "reljmp", "time", "perm", "align",
+	"alphaenc", "chunk", "bin", "seccomp",
+}
+
+// How long replies are cached and how many are kept, read from the [cache] section of config.ini. A TTL of 0 turns
+// the cache off.
+var (
+	CacheTTL        time.Duration
+	CacheMaxEntries int
+)
+
+// A message a handler sent, kept to be sent again. Files are read into memory, since their readers can only be
+// read once.
+type cachedSend struct {
+	content string
+	embed   *discordgo.MessageEmbed
+	complex *discordgo.MessageSend
+	files   []cachedFile
+}
+
+type cachedFile struct {
+	name, contentType string
+	data              []byte
+}
+
+// The replies to one command, until they expire
+type cachedResponse struct {
+	sends   []cachedSend
+	expires time.Time
+}
+
+// Cached replies keyed by the command, its arguments and the preferences it ran with
+var (
+	responseCache     = map[string]cachedResponse{}
+	responseCacheLock sync.Mutex
+)
+
+// Reads the cache's TTL and size from config.ini
+func loadCache() {
+	CacheTTL = time.Duration(getConfigPropertyAsInt("cache", "ttl_seconds", 60)) * time.Second
+	CacheMaxEntries = getConfigPropertyAsInt("cache", "max_entries", 256)
+
+	responseCacheLock.Lock()
+	responseCache = map[string]cachedResponse{}
+	responseCacheLock.Unlock()
+}
+
+// Works out the key a command's reply is cached under, false if it can't be cached. Whitespace in the arguments
+// doesn't change the key, and attachments can't be cached.
+func responseCacheKey(m *discordgo.MessageCreate, command Command, args []string) (string, bool) {
+	if CacheTTL <= 0 || len(m.Attachments) > 0 || !cacheableCommands.contains(command.name) {
+		return "", false
+	}
+
+	prefs := getUserPrefs(m.Author.ID)
+	input := strings.Join(strings.Fields(strings.Join(args[1:], " ")), " ")
+	key := command.name + "\x00" + input + "\x00" + prefs.Arch + "\x00" + prefs.Syntax + "\x00" + prefs.Format + "\x00" + prefs.Render
+
+	// Guilds can highlight the same output differently
+	if len(args) > 1 {
+		arch, _ := splitArchitectureArgs(m.Author.ID, args)
+		key += "\x00" + fenceLanguage(guildScope(m), command.name, arch)
+	}
+
+	return key, true
+}
+
+// Sends the cached replies for the key to the channel, false if there aren't any
+func replayCachedResponse(s Responder, channelID string, key string) bool {
+	responseCacheLock.Lock()
+	cached, ok := responseCache[key]
+	responseCacheLock.Unlock()
+
+	if !ok || time.Now().After(cached.expires) {
+		return false
+	}
+
+	for _, send := range cached.sends {
+		switch {
+		case send.complex != nil:
+			data := *send.complex
+			data.Files = nil
+
+			for _, file := range send.files {
+				data.Files = append(data.Files, &discordgo.File{Name: file.name, ContentType: file.contentType, Reader: bytes.NewReader(file.data)})
+			}
+
+			_, _ = s.ChannelMessageSendComplex(channelID, &data)
+		case send.embed != nil:
+			_, _ = s.ChannelMessageSendEmbed(channelID, send.embed)
+		default:
+			_, _ = s.ChannelMessageSend(channelID, send.content)
+		}
+	}
+
+	return true
+}
+
+// Caches the replies a handler sent under the key, dropping expired replies and then the oldest ones to make room
+func storeCachedResponse(key string, sends []cachedSend) {
+	responseCacheLock.Lock()
+	defer responseCacheLock.Unlock()
+
+	now := time.Now()
+
+	for cachedKey, cached := range responseCache {
+		if now.After(cached.expires) {
+			delete(responseCache, cachedKey)
+		}
+	}
+
+	for len(responseCache) >= CacheMaxEntries && len(responseCache) > 0 {
+		oldest := ""
+
+		for cachedKey, cached := range responseCache {
+			if oldest == "" || cached.expires.Before(responseCache[oldest].expires) {
+				oldest = cachedKey
+			}
+		}
+
+		delete(responseCache, oldest)
+	}
+
+	if CacheMaxEntries > 0 {
+		responseCache[key] = cachedResponse{sends, now.Add(CacheTTL)}
+	}
+}
+
+// Passes a handler's replies on to the real Responder and keeps a copy of them. A reply that fails, or goes to any
+// other channel, means the response isn't cached.
+type recordingResponder struct {
+	Responder
+	channelID string
+	sends     []cachedSend
+	failed    bool
+}
+
+func (r *recordingResponder) record(channelID string, send cachedSend, err error) {
+	if err != nil || channelID != r.channelID {
+		r.failed = true
+		return
+	}
+
+	r.sends = append(r.sends, send)
+}
+
+func (r *recordingResponder) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := r.Responder.ChannelMessageSend(channelID, content, options...)
+	r.record(channelID, cachedSend{content: content}, err)
+
+	return msg, err
+}
+
+func (r *recordingResponder) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := r.Responder.ChannelMessageSendEmbed(channelID, embed, options...)
+	r.record(channelID, cachedSend{embed: embed}, err)
+
+	return msg, err
+}
+
+func (r *recordingResponder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	send := cachedSend{complex: data}
+
+	for _, file := range data.Files {
+		content, err := ioutil.ReadAll(file.Reader)
+
+		if err != nil {
+			r.failed = true
+		}
+
+		file.Reader = bytes.NewReader(content)
+		send.files = append(send.files, cachedFile{file.Name, file.ContentType, content})
+	}
+
+	msg, err := r.Responder.ChannelMessageSendComplex(channelID, data, options...)
+	r.record(channelID, send, err)
+
+	return msg, err
+}
+
+// Runs a command's handler, answering from the cache when the same input was run recently
+func runCached(s Responder, m *discordgo.MessageCreate, command Command, args []string) {
+	key, ok := responseCacheKey(m, command, args)
+
+	if !ok {
+		command.handler(cmdArguments{s, m, args})
+		return
+	}
+
+	if replayCachedResponse(s, m.ChannelID, key) {
+		return
+	}
+
+	recorder := &recordingResponder{Responder: s, channelID: m.ChannelID}
+	command.handler(cmdArguments{recorder, m, args})
+
+	if !recorder.failed && len(recorder.sends) > 0 {
+		storeCachedResponse(key, recorder.sends)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A run of at least 8 '?' in a challenge's flag makes it salted: every user gets a copy of the file with the run
+// replaced by characters only their copy has, so a flag that's passed around can be traced back
+var saltedFlagRegexp = regexp.MustCompile(`\?{8,64}`)
+
+// Recent flag submissions per challenge and user, for the attempt limit
+var (
+	flagAttempts    = make(map[string][]time.Time)
+	flagAttemptLock sync.Mutex
+)
+
+// Checks if every user gets their own flag
+func (c *challenge) salted() bool {
+	return saltedFlagRegexp.MatchString(c.Flag)
+}
+
+// Makes the secret users' flags are derived from
+func newChallengeSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// Returns the flag for the user. A salted flag's run of '?' is replaced with an HMAC of the user's ID, so it can't be
+// worked out without the challenge's secret.
+func (c *challenge) userFlag(userID string) string {
+	if !c.salted() {
+		return c.Flag
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write([]byte(c.Name + ":" + userID))
+	salt := hex.EncodeToString(mac.Sum(nil))
+
+	return saltedFlagRegexp.ReplaceAllStringFunc(c.Flag, func(run string) string {
+		return salt[:len(run)]
+	})
+}
+
+// Returns the user's copy of the challenge's file, with the flag in it replaced by theirs if it's salted
+func (c *challenge) userFile(userID string) ([]byte, error) {
+	data, err := c.fileData()
+
+	if err != nil || !c.salted() {
+		return data, err
+	}
+
+	if !bytes.Contains(data, []byte(c.Flag)) {
+		return nil, errors.New("the flag isn't in the challenge's file")
+	}
+
+	return bytes.Replace(data, []byte(c.Flag), []byte(c.userFlag(userID)), -1), nil
+}
+
+// Compares flags in constant time, so how long a wrong answer takes to check doesn't give away how much of it's right
+func flagsEqual(answer string, flag string) bool {
+	return subtle.ConstantTimeCompare([]byte(answer), []byte(flag)) == 1
+}
+
+// Records a flag submission, returning false if the user has used up their attempts for the challenge. The limit is
+// set in the [challenges] section of config.ini.
+func allowFlagAttempt(challengeName string, userID string) bool {
+	maxAttempts := getConfigPropertyAsInt("challenges", "max_attempts", 5)
+	window := time.Duration(getConfigPropertyAsInt("challenges", "attempt_window_minutes", 60)) * time.Minute
+
+	if maxAttempts <= 0 {
+		return true
+	}
+
+	key := strings.ToLower(challengeName) + ":" + userID
+
+	flagAttemptLock.Lock()
+	defer flagAttemptLock.Unlock()
+
+	return countRecent(flagAttempts, key, window, time.Now()) <= maxAttempts
+}
+
+// Checks a user's answer to the challenge. For salted challenges, a wrong answer that's another user's flag returns
+// that user's ID, since it was shared.
+func (c *challenge) checkFlag(userID string, answer string) (bool, string) {
+	if flagsEqual(answer, c.userFlag(userID)) {
+		return true, ""
+	}
+
+	if !c.salted() {
+		return false, ""
+	}
+
+	for _, other := range c.Copies {
+		if other != userID && flagsEqual(answer, c.userFlag(other)) {
+			return false, other
+		}
+	}
+
+	return false, ""
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A reversing challenge, registered by a developer and posted to the challenge channel on a schedule
+type challenge struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Flag        string           `json:"flag"`
+	Points      int              `json:"points"`
+	File        string           `json:"file,omitempty"`
+	Author      string           `json:"author"`
+	Created     time.Time        `json:"created"`
+	Posted      time.Time        `json:"posted,omitempty"`
+	Guild       string           `json:"guild,omitempty"`
+	Solves      []challengeSolve `json:"solves,omitempty"`
+
+	// Salted challenges give every user their own flag, derived from the secret, and remember who got a copy
+	Secret string   `json:"secret,omitempty"`
+	Copies []string `json:"copies,omitempty"`
+}
+
+// A user that found a challenge's flag
+type challengeSolve struct {
+	User string    `json:"user"`
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
+// Stores every challenge, in the order they're posted in
+var (
+	challenges    []challenge
+	challengeLock sync.Mutex
+)
+
+// Challenge names are used in !flag, so they're kept simple like snippet names
+var challengeNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,32}$`)
+
+// Loads the challenges from the data directory
+func loadChallenges() {
+	var list []challenge
+
+	if err := loadStore("challenges", &list); err != nil {
+		fmt.Println("[ERROR] Failed to load challenges, " + err.Error())
+	}
+
+	challengeLock.Lock()
+	challenges = list
+	challengeLock.Unlock()
+}
+
+// Returns the directory challenge files are kept in
+func challengeDir() string {
+	return filepath.Join(storeDir(), "challenges")
+}
+
+// Finds a challenge by name, the caller has to hold challengeLock
+func findChallenge(name string) *challenge {
+	for n := range challenges {
+		if strings.EqualFold(challenges[n].Name, name) {
+			return &challenges[n]
+		}
+	}
+
+	return nil
+}
+
+// Returns the most recently posted challenge, the caller has to hold challengeLock
+func currentChallenge() *challenge {
+	var current *challenge
+
+	for n := range challenges {
+		if !challenges[n].Posted.IsZero() && (current == nil || challenges[n].Posted.After(current.Posted)) {
+			current = &challenges[n]
+		}
+	}
+
+	return current
+}
+
+// Checks if the user has solved the challenge
+func (c *challenge) solvedBy(userID string) bool {
+	for _, solve := range c.Solves {
+		if solve.User == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reads the challenge's file from the data directory
+func (c *challenge) fileData() ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(challengeDir(), c.Name + "-" + c.File))
+}
+
+// Sends the challenge's description, with its file attached if it has one. Salted challenges' files are only sent
+// in DMs, as a copy with the user's own flag in it.
+func sendChallenge(s Responder, channelID string, heading string, c challenge, userID string) (*discordgo.Message, error) {
+	content := heading + " **" + c.Name + "** (" + strconv.Itoa(c.Points) + " points)\n" + c.Description + "\n"
+
+	if c.salted() && userID == "" {
+		content += "Everyone gets their own copy of this one, DM me `" + CommandPrefix + "challenge " + c.Name + "` for yours. "
+	}
+
+	content += "Found the flag? DM it to me with `" + CommandPrefix + "flag " + c.Name + " <flag>`."
+
+	if c.File == "" || (c.salted() && userID == "") {
+		return s.ChannelMessageSend(channelID, content)
+	}
+
+	data, err := c.userFile(userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: content,
+		Files:   []*discordgo.File{{Name: c.File, ContentType: "application/octet-stream", Reader: bytes.NewReader(data)}},
+	})
+}
+
+// Posts the next challenge that hasn't been posted yet to the challenge channel
+func postNextChallenge(s Responder) (string, error) {
+	channelID := getConfigPropertyAsStr("challenges", "channel")
+
+	if channelID == "" {
+		return "", fmt.Errorf("there's no challenge channel set in config.ini")
+	}
+
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+
+	for n := range challenges {
+		if !challenges[n].Posted.IsZero() {
+			continue
+		}
+
+		msg, err := sendChallenge(s, channelID, "**Challenge of the week:**", challenges[n], "")
+
+		if err != nil {
+			return "", err
+		}
+
+		challenges[n].Posted = time.Now()
+		challenges[n].Guild = msg.GuildID
+
+		return challenges[n].Name, saveStore("challenges", challenges)
+	}
+
+	return "", fmt.Errorf("there are no challenges left to post, add one with %schallenge add", CommandPrefix)
+}
+
+// Returns how long until the next weekly post on the weekday at the "HH:MM" UTC time
+func untilNextWeeklyPost(day time.Weekday, at string, now time.Time) (time.Duration, error) {
+	wait, err := untilNextPost(at, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for now.UTC().Add(wait).Weekday() != day {
+		wait += 24 * time.Hour
+	}
+
+	return wait, nil
+}
+
+// Parses a weekday name, i.e. "monday"
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), name) {
+			return day, true
+		}
+	}
+
+	return 0, false
+}
+
+// Starts posting a challenge to the challenge channel once a week, if one is configured
+func startChallengeSchedule(s Responder) {
+	if getConfigPropertyAsStr("challenges", "channel") == "" {
+		return
+	}
+
+	dayName := getConfigPropertyAsStr("challenges", "day")
+	at := getConfigPropertyAsStr("challenges", "time")
+
+	if dayName == "" {
+		dayName = "monday"
+	}
+
+	if at == "" {
+		at = "12:00"
+	}
+
+	day, ok := parseWeekday(dayName)
+
+	if _, err := untilNextWeeklyPost(day, at, time.Now()); err != nil || !ok {
+		fmt.Println("[ERROR] Invalid challenge schedule '" + dayName + " " + at + "', expected a weekday and HH:MM")
+		return
+	}
+
+	go func() {
+		for {
+			wait, _ := untilNextWeeklyPost(day, at, time.Now())
+			time.Sleep(wait)
+
+			if name, err := postNextChallenge(s); err != nil {
+				fmt.Println("[ERROR] Skipping the weekly challenge, " + err.Error())
+			} else {
+				fmt.Println("[INFO] Posted challenge '" + name + "'.")
+			}
+		}
+	}()
+
+	fmt.Println("[INFO] Posting challenges every " + day.String() + " at " + at + " UTC.")
+}
+
+// Shows the users with the most challenge points
+func challengeScoreboard(s Responder, m *discordgo.MessageCreate) {
+	type entry struct {
+		name   string
+		points int
+		solves int
+	}
+
+	scores := make(map[string]*entry)
+
+	challengeLock.Lock()
+	for _, c := range challenges {
+		for _, solve := range c.Solves {
+			if scores[solve.User] == nil {
+				scores[solve.User] = &entry{name: solve.Name}
+			}
+
+			scores[solve.User].points += c.Points
+			scores[solve.User].solves++
+		}
+	}
+	challengeLock.Unlock()
+
+	var entries []*entry
+	for _, e := range scores {
+		entries = append(entries, e)
+	}
+
+	if len(entries) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Nobody has solved a challenge yet.")
+		return
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].points != entries[b].points {
+			return entries[a].points > entries[b].points
+		}
+
+		return entries[a].name < entries[b].name
+	})
+
+	out := "**Challenge leaderboard:**\n"
+
+	for n, e := range entries {
+		if n == 10 {
+			break
+		}
+
+		out += fmt.Sprintf("%d. %s - %d points (%d solved)\n", n + 1, e.name, e.points, e.solves)
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, out)
+}
+
+// Registers a challenge from a DM, with the attached file if there is one
+func addChallenge(s Responder, m *discordgo.MessageCreate, args []string) {
+	if len(args) < 5 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "challenge add [name] [points] [flag] {description ...}, with the challenge's file attached.")
+		return
+	}
+
+	// The flag is in the message, so it shouldn't be sent where other users can see it
+	if m.GuildID != "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Add challenges in a DM, or everyone here will see the flag!")
+		return
+	}
+
+	name := args[2]
+	points, err := strconv.Atoi(args[3])
+
+	if !challengeNameRegexp.MatchString(name) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Challenge names can only contain letters, numbers, '_' and '-', and can be up to 32 characters long.")
+		return
+	}
+
+	if err != nil || points <= 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "The points have to be a positive number.")
+		return
+	}
+
+	c := challenge{
+		Name:        name,
+		Description: strings.Join(args[5:], " "),
+		Flag:        args[4],
+		Points:      points,
+		Author:      m.Author.ID,
+		Created:     time.Now(),
+	}
+
+	if c.salted() {
+		if len(m.Attachments) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Salted flags (with a run of '?' in them) need a file to put each user's flag in.")
+			return
+		}
+
+		if c.Secret, err = newChallengeSecret(); err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, couldn't make the challenge's secret, " + err.Error() + ".")
+			return
+		}
+	}
+
+	if len(m.Attachments) > 0 {
+		data, err := downloadAttachment(m.Attachments[0])
+
+		if err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, couldn't download the attachment, " + err.Error() + ".")
+			return
+		}
+
+		c.File = filepath.Base(m.Attachments[0].Filename)
+
+		if c.salted() && !bytes.Contains(data, []byte(c.Flag)) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "The flag has a run of '?' in it, so every user gets their own, but the file doesn't contain it to replace.")
+			return
+		}
+
+		if err := os.MkdirAll(challengeDir(), 0755); err == nil {
+			err = ioutil.WriteFile(filepath.Join(challengeDir(), c.Name + "-" + c.File), data, 0644)
+		}
+
+		if err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, couldn't save the file, " + err.Error() + ".")
+			return
+		}
+	}
+
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+
+	if findChallenge(name) != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "There's already a challenge called '" + name + "'.")
+		return
+	}
+
+	challenges = append(challenges, c)
+
+	if err := saveStore("challenges", challenges); err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, couldn't save the challenge, " + err.Error() + ".")
+		return
+	}
+
+	queued := 0
+	for _, other := range challenges {
+		if other.Posted.IsZero() {
+			queued++
+		}
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Added challenge '" + name + "', it's number " + strconv.Itoa(queued) + " in the queue.")
+}
+
+// Shows the current challenge, or manages challenges for developers
+func cmdChallenge(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	sub := ""
+	if len(args) > 1 {
+		sub = strings.ToLower(args[1])
+	}
+
+	staff := DeveloperList.contains(m.Author.ID)
+
+	switch sub {
+	case "scores", "leaderboard":
+		challengeScoreboard(s, m)
+		return
+	case "add":
+		if staff {
+			addChallenge(s, m, args)
+			return
+		}
+	case "post":
+		if staff {
+			name, err := postNextChallenge(s)
+
+			if err != nil {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+			} else {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Posted challenge '" + name + "'.")
+			}
+
+			return
+		}
+	case "remove":
+		if staff && len(args) > 2 {
+			challengeLock.Lock()
+			c := findChallenge(args[2])
+
+			if c != nil {
+				if c.File != "" {
+					_ = os.Remove(filepath.Join(challengeDir(), c.Name + "-" + c.File))
+				}
+
+				for n := range challenges {
+					if &challenges[n] == c {
+						challenges = append(challenges[:n], challenges[n + 1:]...)
+						break
+					}
+				}
+
+				_ = saveStore("challenges", challenges)
+			}
+			challengeLock.Unlock()
+
+			if c == nil {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "There's no challenge called '" + args[2] + "'.")
+			} else {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Removed challenge '" + args[2] + "'.")
+			}
+
+			return
+		}
+	case "list":
+		out := ""
+
+		challengeLock.Lock()
+		for _, c := range challenges {
+			if !c.Posted.IsZero() {
+				out += fmt.Sprintf("%s - %d points, %d solves, posted %s\n", c.Name, c.Points, len(c.Solves), c.Posted.UTC().Format("2006-01-02"))
+			} else if staff {
+				out += fmt.Sprintf("%s - %d points, queued\n", c.Name, c.Points)
+			}
+		}
+		challengeLock.Unlock()
+
+		if out == "" {
+			out = "There are no challenges yet.\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "```" + out + "```")
+		return
+	}
+
+	challengeLock.Lock()
+	var c *challenge
+
+	if sub != "" {
+		c = findChallenge(sub)
+	} else {
+		c = currentChallenge()
+	}
+
+	var found challenge
+	if c != nil && !c.Posted.IsZero() {
+		found = *c
+	}
+
+	// Users who got a copy of a salted challenge are remembered, so their flag can be recognized if it's shared
+	userID := ""
+	if m.GuildID == "" {
+		userID = m.Author.ID
+
+		if found.salted() && !StrList(c.Copies).contains(userID) {
+			c.Copies = append(c.Copies, userID)
+			_ = saveStore("challenges", challenges)
+		}
+	}
+	challengeLock.Unlock()
+
+	if found.Name == "" {
+		if sub != "" {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There's no challenge called '" + args[1] + "'.")
+		} else {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "No challenges have been posted yet.")
+		}
+
+		return
+	}
+
+	if _, err := sendChallenge(s, m.ChannelID, "**Challenge:**", found, userID); err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, couldn't send the challenge, " + err.Error() + ".")
+	}
+}
+
+// Checks a flag for a challenge, submitted in a DM
+func cmdFlag(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	if m.GuildID != "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Send flags in a DM, so nobody else sees them!")
+		return
+	}
+
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+
+	c := currentChallenge()
+	answer := args[1]
+
+	if len(args) > 2 {
+		c = findChallenge(args[1])
+		answer = args[2]
+	}
+
+	if c == nil || c.Posted.IsZero() {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "There's no challenge called that, the current one is used if you only give a flag.")
+		return
+	}
+
+	if c.solvedBy(m.Author.ID) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "You've already solved " + c.Name + "!")
+		return
+	}
+
+	if !allowFlagAttempt(c.Name, m.Author.ID) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "You've tried too many flags for " + c.Name + ", take a break and try again later.")
+		return
+	}
+
+	correct, sharedBy := c.checkFlag(m.Author.ID, answer)
+
+	if sharedBy != "" {
+		notifyDevelopers(s, "`" + m.Author.String() + "` (" + m.Author.ID + ") submitted the flag for challenge '" + c.Name +
+			"' that was made for <@" + sharedBy + "> (" + sharedBy + ").")
+	}
+
+	if !correct {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "That's not the flag for " + c.Name + ", keep going!")
+		return
+	}
+
+	c.Solves = append(c.Solves, challengeSolve{User: m.Author.ID, Name: m.Author.Username, Time: time.Now()})
+
+	if err := saveStore("challenges", challenges); err != nil {
+		fmt.Println("[ERROR] Failed to save challenges, " + err.Error())
+	}
+
+	// Points go to the leaderboard of the guild the challenge was posted in
+	scope := c.Guild
+	if scope == "" {
+		scope = globalPointsScope
+	}
+
+	_, granted := awardPoints(s, scope, m.Author.ID, m.Author.Username, c.Points)
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Correct! You solved " + c.Name + " for " + strconv.Itoa(c.Points) +
+		" points, you're solver #" + strconv.Itoa(len(c.Solves)) + "." + rewardNote(granted))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const cliUsage = `Usage: rebot cli <command> [arguments ...]
+
+Runs a command as it would be sent to the bot, without the prefix. config.ini is used when there's one in the
+working directory, otherwise every setting takes its default.
+
+Examples:
+  rebot cli assemble x64 "push rbp; mov rbp, rsp"
+  rebot cli disassemble x64 55 48 89 e5
+  rebot cli info rop
+  rebot cli manual x86 cpuid
+  rebot cli retrick`
+
+// Runs a single command locally and prints the replies to the terminal, returns the process exit code. Text files
+// are printed with the replies, any other files are saved to the working directory.
+func runCLI(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprintln(stdout, cliUsage)
+		return 2
+	}
+
+	// There might not be a config.ini, the defaults are enough to run the commands that don't need Discord
+	if _, err := os.Stat("config.ini"); os.IsNotExist(err) {
+		useDefaultConfig()
+	}
+
+	loadAll()
+
+	replied := false
+	content := CommandPrefix + strings.TrimPrefix(strings.Join(args, " "), CommandPrefix)
+
+	handleTextMessage("cli", "local", "terminal", content, func(reply textReply) {
+		replied = true
+
+		if reply.content != "" {
+			fmt.Fprintln(stdout, plainText(reply.content))
+		}
+
+		for _, file := range reply.files {
+			if utf8.Valid(file.data) {
+				fmt.Fprintln(stdout, strings.TrimRight(string(file.data), "\n"))
+				continue
+			}
+
+			if _, err := os.Stat(file.name); err == nil {
+				fmt.Fprintln(stderr, file.name + " already exists, it wasn't overwritten.")
+				continue
+			}
+
+			if err := ioutil.WriteFile(file.name, file.data, 0644); err != nil {
+				fmt.Fprintln(stderr, "Failed to save " + file.name + ", " + err.Error())
+				continue
+			}
+
+			fmt.Fprintln(stdout, "Saved " + file.name + ".")
+		}
+	})
+
+	// Unknown commands get no reply at all
+	if !replied {
+		fmt.Fprintln(stderr, cliUsage)
+		return 1
+	}
+
+	return 0
+}
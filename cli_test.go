@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunCLIWithoutConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebot-cli")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	wd, _ := os.Getwd()
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	configLock.Lock()
+	loaded := config
+	config = nil
+	configLock.Unlock()
+
+	defer func() {
+		_ = os.Chdir(wd)
+
+		configLock.Lock()
+		config = loaded
+		configLock.Unlock()
+	}()
+
+	// There's no config.ini here, the command still runs with the defaults
+	var stdout, stderr bytes.Buffer
+
+	if code := runCLI([]string{"motivation"}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), motivationalJapaneseFisherman) {
+		t.Errorf("got %d, %q, %q, want the motivation", code, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+
+	if code := runCLI([]string{"notacommand"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "Usage: rebot cli") {
+		t.Errorf("got %d, %q, want the usage", code, stderr.String())
+	}
+}
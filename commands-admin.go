@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Number of commands handled since startup, shown by !admin stats
+var commandCount uint64
+
+// Owner-only bot management, dispatches to the !admin subcommands
+func cmdAdmin(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	switch strings.ToLower(args[1]) {
+	case "stats":
+		adminStats(params)
+	case "guilds":
+		adminGuilds(params)
+	case "reload":
+		cmdReload(params)
+	case "shutdown":
+		cmdDie(params)
+	case "announce":
+		adminAnnounce(params)
+	default:
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "admin [stats|guilds|reload|shutdown|announce] {message ...}")
+	}
+}
+
+// Shows general statistics about the running bot
+func adminStats(params cmdArguments) {
+	var mem runtime.MemStats
+	var embedFields []embedField
+
+	s := params.s
+	m := params.m
+
+	runtime.ReadMemStats(&mem)
+
+	embedFields = append(embedFields,
+		embedField{
+			name:   "Uptime",
+			value:  time.Since(startTime).Round(time.Second).String(),
+			inline: true,
+		},
+		embedField{
+			name:   "Guilds",
+			value:  strconv.Itoa(len(s.Guilds())),
+			inline: true,
+		},
+		embedField{
+			name:   "Commands Handled",
+			value:  strconv.FormatUint(atomic.LoadUint64(&commandCount), 10),
+			inline: true,
+		},
+		embedField{
+			name:   "Goroutines",
+			value:  strconv.Itoa(runtime.NumGoroutine()),
+			inline: true,
+		},
+		embedField{
+			name:   "Allocated",
+			value:  strconv.FormatUint(mem.Alloc/1024, 10) + " KiB",
+			inline: true,
+		})
+
+	discordSendEmbeddedMsg(s, m.ChannelID, embedFields, "", 0x57D5FF, "")
+}
+
+// Lists the guilds the bot is in
+func adminGuilds(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	out := ""
+
+	for _, guild := range s.Guilds() {
+		out += guild.ID + "  " + guild.Name + "\n"
+	}
+
+	if out == "" {
+		out = "(none)\n"
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "I'm in " + strconv.Itoa(len(s.Guilds())) + " guilds: ```" + out + "```")
+}
+
+// Broadcasts a message to every channel configured in the [admin] section of config.ini
+func adminAnnounce(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	if len(args) < 3 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "admin announce {message ...}")
+		return
+	}
+
+	channels := strings.Fields(strings.Replace(getConfigPropertyAsStr("admin", "announce_channels"), ",", " ", -1))
+
+	if len(channels) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "No announcement channels are configured.")
+		return
+	}
+
+	msg := "📢 " + strings.Join(args[2:], " ")
+	sent := 0
+
+	for _, channel := range channels {
+		if _, err := s.ChannelMessageSend(channel, msg); err != nil {
+			fmt.Println("[ERROR] Failed to send announcement to " + channel + ", ", err)
+			continue
+		}
+
+		sent++
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Announcement sent to " + strconv.Itoa(sent) + "/" + strconv.Itoa(len(channels)) + " channels.")
+}
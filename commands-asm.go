@@ -2,338 +2,667 @@ package main
 
 import (
 	"encoding/hex"
-	"math/rand"
+	"errors"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/bnagy/gapstone"
-	"github.com/keystone-engine/keystone/bindings/go/keystone"
+	"github.com/i509VCB/REBot/pkg/asm"
 )
 
-// Assembles the given instructions into opcodes via the given architecture
-func cmdAssemble(params cmdArguments) {
-	s := params.s
-	m := params.m
-	args := params.args
+// Returned when the user's opcodes aren't valid hex
+var errInvalidOpcodes = errors.New("invalid opcodes")
 
-	asmArch  	 := args[1]
-	instructions := ""
+// Options for the assembler/disassembler core
+type asmOptions struct {
+	// "intel" (the default) or "att", only used for x86
+	syntax string
 
-	// Stitch together the rest of the arguments for the instructions
-	if len(args) > 2 {
-		for i := 2; i < len(args); i++ {
-			instructions += args[i] + " "
-		}
+	// Address of the first instruction, for patching instructions into a binary
+	base uint64
+
+	// Fill in Capstone's detail (groups and implicit registers) when disassembling
+	detail bool
+}
+
+// Converts the options to the ones the asm package takes
+func (o asmOptions) options() []asm.Option {
+	opts := []asm.Option{asm.WithSyntax(o.syntax), asm.WithBase(o.base)}
+
+	if o.detail {
+		opts = append(opts, asm.WithDetail())
 	}
 
-	if arch, mode := parseArchitectureKeystone(asmArch); arch != ^keystone.Architecture(0) && mode != ^keystone.Mode(0) {
-		outMsg := "Assembly: ```x86asm\n"
+	return opts
+}
 
-		// Longest instruction string, used for display padding
-		maxInstructionLength := 0
+// Output formats for assembled instructions, the first is the default
+var assemblyFormats = []string{"listing", "hex", "c", "python"}
 
-		// Offset counter, used only in display output
-		offset := 0
+// Formats bytes as space separated hex, i.e. "90 90 c3 "
+func formatOpcodes(ops []byte) string {
+	opcodes := ""
 
-		// ';' is the termination character in assembly
-		ins := strings.Split(instructions, ";")
+	for _, op := range ops {
+		// Format to hex representation, and pad to 2 chars.
+		opcodes += padLeft(strconv.FormatInt(int64(op), 16), "0", 2) + " "
+	}
 
-		// Use the keystone library for assembly
-		if ks, err := keystone.New(arch, mode); err == nil {
-			defer ks.Close()
+	return opcodes
+}
 
-			// Determine longest instruction for display padding
-			for _, i := range ins {
-				instructionLength := len(strings.TrimSpace(i))
-				if instructionLength > maxInstructionLength {
-					maxInstructionLength = instructionLength
-				}
-			}
+// Assembles the given ';' separated instructions into opcodes via the given architecture, enforcing the input limits
+func assemble(asmArch string, instructions string, opts asmOptions) ([]asm.Insn, error) {
+	if !asm.CanAssemble(asmArch) {
+		return nil, asm.ErrArchNotSupported
+	}
+
+	// Reject pathological inputs before they reach the engine
+	if count := len(asm.SplitInstructions(instructions)); MaxInstructions > 0 && count > MaxInstructions {
+		return nil, limitError{"instructions", count, MaxInstructions}
+	}
+
+	return asm.Assemble(asmArch, instructions, opts.options()...)
+}
+
+// Formats assembled instructions into aligned listing lines, with any warnings as comments after their instruction.
+// Mixed ARM and Thumb code has a comment at the start of each region saying which state it's in.
+func formatAssembly(ins []asm.Insn, warnings []asm.Warning) string {
+	out := ""
+
+	// Longest instruction string, used for display padding
+	maxInstructionLength := 0
+	mixed := false
 
-			// Get each instruction's opcodes individually to format nicely
-			for _, i := range ins {
-				// Use intel syntax for x86 because AT&T syntax is ugly
-				if arch == keystone.ARCH_X86 {
-					if err := ks.Option(keystone.OPT_SYNTAX, keystone.OPT_SYNTAX_INTEL); err != nil {
-						_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to set keystone option")
-						return
-					}
-				}
-
-				if ops, _, ok := ks.Assemble(i, 0); ok {
-					opcodes := ""
-
-					for _, op := range ops {
-						// Format to hex representation, and pad to 2 chars.
-						opcodes += padLeft(strconv.FormatInt(int64(op), 16), "0", 2) + " "
-					}
-
-					// Beautify the output
-					if opcodes != "" {
-						outMsg += padRight(strings.TrimSpace(i), " ", maxInstructionLength) + "  ; "
-						outMsg += "+" + strconv.Itoa(offset) + " = "
-						outMsg += opcodes + "\n"
-					}
-
-					// String is always encoded as a number of hex bytes followed by a space, i.e. 3-chars
-					offset += len(opcodes) / 3
-
-				} else {
-					// Keystone assembler failed
-					_, _ = s.ChannelMessageSend(m.ChannelID, "Could not assemble the given assembly. Are the instructions valid?")
-					return
-				}
+	for _, i := range ins {
+		if len(i.Source) > maxInstructionLength {
+			maxInstructionLength = len(i.Source)
+		}
+
+		if i.Thumb != ins[0].Thumb {
+			mixed = true
+		}
+	}
+
+	// Beautify the output
+	for n, i := range ins {
+		if mixed && (n == 0 || i.Thumb != ins[n-1].Thumb) {
+			if i.Thumb {
+				out += "; thumb\n"
+			} else {
+				out += "; arm\n"
 			}
+		}
 
-			// Keystone assembler succeeded, give the user the output
-			_, _ = s.ChannelMessageSend(m.ChannelID, outMsg + "```")
-			return
+		out += padRight(i.Source, " ", maxInstructionLength) + "  ; "
+		out += "+" + strconv.FormatUint(i.Address, 10) + " = "
+		out += formatOpcodes(i.Bytes) + "\n"
+
+		for _, w := range warnings {
+			if w.Index == n {
+				out += "; warning: " + w.Message + "\n"
+			}
 		}
+	}
 
-		// If we reached this point, it's because keystone's engine failed to initialize
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Keystone engine is not working! :(")
-	} else {
-		supportedArchs := "```"
-		supportedArchs += "x86, x86_16, x86_64/x64, arm, thumb, arm64/aarch64, ppc/ppc32, ppc64, mips/mips32, mips64"
-		supportedArchs += "```"
+	return out
+}
 
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Architecture not supported! Supported architectures: " + supportedArchs)
+// Formats warnings for output formats that can't have comments, one line per warning
+func formatWarnings(warnings []asm.Warning) string {
+	out := ""
+
+	for _, w := range warnings {
+		out += "Warning, instruction #" + strconv.Itoa(w.Index+1) + " " + w.Message + "\n"
 	}
+
+	return out
 }
 
-// Disassembles the given opcodes into instructions via the architecture
-func cmdDisassemble(params cmdArguments) {
-	s := params.s
-	m := params.m
-	args := params.args
+// Formats assembled instructions in one of the assemblyFormats, anything unknown falls back to a listing
+func formatAssemblyAs(ins []asm.Insn, format string, warnings []asm.Warning) string {
+	var opcodes []byte
 
-	asmArch := args[1]
-	opcodes := ""
+	for _, i := range ins {
+		opcodes = append(opcodes, i.Bytes...)
+	}
 
-	// Stitch together the rest of the arguments for the opcodes
-	if len(args) > 2 {
-		for i := 2; i < len(args); i++ {
-			opcodes += args[i]
-		}
+	switch format {
+	case "hex":
+		return hex.EncodeToString(opcodes) + "\n"
+	case "c":
+		return "unsigned char code[] = \"" + escapedBytes(opcodes) + "\";\n"
+	case "python":
+		return "code = b\"" + escapedBytes(opcodes) + "\"\n"
+	default:
+		return formatAssembly(ins, warnings)
+	}
+}
+
+// Formats bytes as a string literal of \x escapes, i.e. "\x90\x90\xc3"
+func escapedBytes(ops []byte) string {
+	out := ""
+
+	for _, op := range ops {
+		out += "\\x" + padLeft(strconv.FormatInt(int64(op), 16), "0", 2)
 	}
-	
-	// Allow some flexibility in input (ie. allow 0x, ;)
+
+	return out
+}
+
+// Decodes user supplied opcodes into raw bytes, allowing some flexibility in input (ie. allow 0x, ;)
+func parseOpcodes(opcodes string) ([]byte, error) {
 	opcodes = strings.Replace(opcodes, ";", "", -1)
 	opcodes = strings.Replace(opcodes, "0x", "", -1)
+	opcodes = strings.Join(strings.Fields(opcodes), "")
 
-	if arch, mode := parseArchitectureCapstone(asmArch); arch != -1 && mode != -1 {
-		outMsg := "Disassembly: ```x86asm\n"
+	// We need to decode the string as capstone only accepts raw binary data for input
+	opcodesBinary, err := hex.DecodeString(opcodes)
 
-		// Max str lengths, used for display padding
-		maxMnemonicLength 	:= 0
-		maxOpStrLength 		:= 0
+	if err != nil {
+		// Failed to decode the string into raw binary data - must be invalid hex
+		return nil, errInvalidOpcodes
+	}
 
-		// Offset counter, used only in display output
-		offset := 0
+	return opcodesBinary, nil
+}
 
-		// Use the gapstone library for disassembly
-		if gs, err := gapstone.New(arch, uint(mode)); err == nil {
-			defer gs.Close()
+// Decodes opcodes for AVR, whose instructions are 16-bit little endian words. Words written like the datasheets
+// write them, "0x940c", are swapped into their bytes in memory, anything else is taken as bytes like parseOpcodes.
+func parseAVROpcodes(opcodes string) ([]byte, error) {
+	var out []byte
 
-			// Use intel syntax for x86 because AT&T syntax is ugly
-			if arch == gapstone.CS_ARCH_X86 {
-				if err := gs.SetOption(gapstone.CS_OPT_SYNTAX, gapstone.CS_OPT_SYNTAX_INTEL); err != nil {
-					_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to set gapstone option")
-					return
-				}
-			}
+	for _, field := range strings.Fields(strings.Replace(opcodes, ";", " ", -1)) {
+		if digits := strings.TrimPrefix(field, "0x"); digits != field && len(digits) == 4 {
+			word, err := strconv.ParseUint(digits, 16, 16)
 
-			// We need to decode the string as capstone only accepts raw binary data for input
-			if opcodesBinary, err := hex.DecodeString(opcodes); err == nil {
-				if ins, err := gs.Disasm(opcodesBinary, 0, 0); err == nil {
-					// Find the longest strings for display padding
-					for _, i := range ins {
-						mnemonicLength := len(i.Mnemonic)
-						opStrLength := len(i.OpStr)
-
-						if mnemonicLength > maxMnemonicLength {
-							maxMnemonicLength = mnemonicLength
-						}
-
-						if opStrLength > maxOpStrLength {
-							maxOpStrLength = opStrLength
-						}
-					}
-
-					for _, i := range ins {
-						instructionOpCodes := ""
-						ops := i.Bytes
-
-						for _, op := range ops {
-							instructionOpCodes += padLeft(strconv.FormatInt(int64(op), 16), "0", 2) + " "
-						}
-
-						// Beautify the output
-						outMsg += padRight(i.Mnemonic, " ", maxMnemonicLength) + " " + padRight(i.OpStr, " ", maxOpStrLength) + "  ; "
-						outMsg += "+" + strconv.Itoa(offset) + " = "
-						outMsg += instructionOpCodes + "\n"
-
-						// String is always encoded as a number of hex bytes followed by a space, i.e. 3-chars
-						offset += len(instructionOpCodes) / 3
-					}
-				} else {
-					// Capstone disassembler failed
-					_, _ = s.ChannelMessageSend(m.ChannelID, "Could not disassemble the given opcodes. Are the opcodes valid?")
-					return
-				}
-
-				// Disassembler succeeded, give the user the output
-				_, _ = s.ChannelMessageSend(m.ChannelID, outMsg + "```")
-				return
-			} else {
-				// Failed to decode the string into raw binary data - must be invalid hex
-				_, _ = s.ChannelMessageSend(m.ChannelID, "Invalid opcodes.")
-				return
+			if err != nil {
+				return nil, errInvalidOpcodes
 			}
+
+			out = append(out, byte(word), byte(word >> 8))
+			continue
+		}
+
+		code, err := parseOpcodes(field)
+
+		if err != nil {
+			return nil, err
 		}
 
-		// If we reached this point, it's because capstone's engine failed to initialize
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Capstone engine is not working! :(")
+		out = append(out, code...)
+	}
+
+	return out, nil
+}
+
+// Disassembles the given opcodes into instructions via the architecture, enforcing the input limits
+func disassemble(asmArch string, opcodes []byte, opts asmOptions) ([]asm.Insn, error) {
+	if !asm.CanDisassemble(asmArch) {
+		return nil, asm.ErrArchNotSupported
+	}
+
+	// Reject pathological inputs before they reach the engine
+	if MaxOpcodeBytes > 0 && len(opcodes) > MaxOpcodeBytes {
+		return nil, limitError{"opcode bytes", len(opcodes), MaxOpcodeBytes}
+	}
+
+	return asm.Disassemble(asmArch, opcodes, 0, opts.options()...)
+}
+
+// Formats disassembled instructions into aligned listing lines
+func formatDisassembly(ins []asm.Insn) string {
+	return formatAnnotatedDisassembly(ins, nil)
+}
+
+// Formats disassembled instructions into aligned listing lines, with each instruction's notes in a comment after
+// its opcodes
+func formatAnnotatedDisassembly(ins []asm.Insn, notes [][]string) string {
+	out := ""
+
+	// Max str lengths, used for display padding
+	maxMnemonicLength := 0
+	maxOpStrLength := 0
+
+	// Find the longest strings for display padding
+	for _, i := range ins {
+		if len(i.Mnemonic) > maxMnemonicLength {
+			maxMnemonicLength = len(i.Mnemonic)
+		}
+
+		if len(i.OpStr) > maxOpStrLength {
+			maxOpStrLength = len(i.OpStr)
+		}
+	}
+
+	// Notes line up after the longest opcodes
+	maxOpcodesLength := 0
+
+	for n, i := range ins {
+		if length := len("+" + strconv.FormatUint(i.Address, 10) + " = " + formatOpcodes(i.Bytes)); n < len(notes) && length > maxOpcodesLength {
+			maxOpcodesLength = length
+		}
+	}
+
+	// Beautify the output
+	for n, i := range ins {
+		line := padRight(i.Mnemonic, " ", maxMnemonicLength) + " " + padRight(i.OpStr, " ", maxOpStrLength) + "  ; "
+		line += "+" + strconv.FormatUint(i.Address, 10) + " = "
+		line += formatOpcodes(i.Bytes)
+
+		if n < len(notes) && len(notes[n]) > 0 {
+			line = padRight(line, " ", maxMnemonicLength + maxOpStrLength + 5 + maxOpcodesLength) + "; " + strings.Join(notes[n], ", ")
+		}
+
+		out += line + "\n"
+	}
+
+	return out
+}
+
+// Disassembles the opcodes with their arguments, return values and stack frame setup annotated, for the
+// architectures explainArchs lists. The others, and AT&T syntax the annotations can't read, are disassembled as usual.
+func annotatedDisassembly(asmArch string, opcodes []byte, opts asmOptions) (string, error) {
+	if instructionFamily(asmArch) == "" || opts.syntax == "att" {
+		ins, err := disassemble(asmArch, opcodes, opts)
+
+		if err != nil {
+			return "", err
+		}
+
+		if isRISCV(asmArch) {
+			return formatAnnotatedDisassembly(ins, riscvNotes(ins)) + disassemblyStopNote(ins, opcodes) + riscvStopNote(asmArch, ins, opcodes), nil
+		}
+
+		return formatDisassembly(ins) + disassemblyStopNote(ins, opcodes), nil
+	}
+
+	opts.detail = true
+	ins, err := disassemble(asmArch, opcodes, opts)
+
+	if err != nil {
+		return "", err
+	}
+
+	convention, notes := annotateDisassembly(asmArch, ins)
+	out := formatAnnotatedDisassembly(ins, notes) + disassemblyStopNote(ins, opcodes)
+
+	if convention != "" {
+		out = "; arguments are for the " + convention + " calling convention\n" + out
+	}
+
+	return out, nil
+}
+
+// Maps an assembler/disassembler core error to the message shown to the user, including the engine's reason
+func asmErrorMessage(err error, supportedArchs string) string {
+	msg := ""
+
+	switch {
+	case errors.Is(err, asm.ErrArchNotSupported):
+		return "Architecture not supported! Supported architectures: ```" + supportedArchs + "```"
+	case errors.Is(err, asm.ErrKeystoneEngine):
+		msg = "Keystone engine is not working! :("
+	case errors.Is(err, asm.ErrKeystoneOption):
+		msg = "Failed to set keystone option"
+	case errors.Is(err, asm.ErrAssemble):
+		msg = "Could not assemble the given assembly."
+	case errors.Is(err, asm.ErrCapstoneEngine):
+		msg = "Capstone engine is not working! :("
+	case errors.Is(err, asm.ErrCapstoneOption):
+		msg = "Failed to set gapstone option"
+	case errors.Is(err, asm.ErrDisassemble):
+		msg = "Could not disassemble the given opcodes."
+	case errors.Is(err, errInvalidOpcodes):
+		return "Invalid opcodes."
+	default:
+		return err.Error()
+	}
+
+	var engineErr *asm.EngineError
+
+	if !errors.As(err, &engineErr) {
+		return msg
+	}
+
+	if engineErr.Instruction != "" {
+		msg += " Instruction #" + strconv.Itoa(engineErr.Index+1) + " `" + strings.Replace(engineErr.Instruction, "`", "'", -1) + "` failed."
+	}
+
+	if engineErr.Reason != "" {
+		msg += " Reason: " + engineErr.Reason
+	}
+
+	return msg
+}
+
+// Notes where the disassembly stopped early, Capstone gives up at the first invalid instruction
+func disassemblyStopNote(ins []asm.Insn, opcodes []byte) string {
+	decoded := 0
+
+	for _, i := range ins {
+		decoded += len(i.Bytes)
+	}
+
+	if decoded >= len(opcodes) {
+		return ""
+	}
+
+	// Show the first few bytes that failed to decode
+	end := decoded + 4
+
+	if end > len(opcodes) {
+		end = len(opcodes)
+	}
+
+	return "; stopped at +" + strconv.Itoa(decoded) + ", " + strings.TrimSpace(formatOpcodes(opcodes[decoded:end])) +
+		" isn't a valid instruction in this mode\n"
+}
+
+// RISC-V architectures without the C extension, with the one that has it
+var riscvWithoutCompressed = map[string]string{"rv32g": "rv32gc", "rv64g": "rv64gc"}
+
+// Checks if the architecture is one of the RISC-V ones
+func isRISCV(asmArch string) bool {
+	return strings.HasPrefix(asmArch, "riscv") || strings.HasPrefix(asmArch, "rv")
+}
+
+// Marks RISC-V's 2-byte instructions as compressed, so it's clear which ones the C extension gave
+func riscvNotes(ins []asm.Insn) [][]string {
+	notes := make([][]string, len(ins))
+
+	for n, i := range ins {
+		if len(i.Bytes) == 2 {
+			notes[n] = []string{"compressed"}
+		}
+	}
+
+	return notes
+}
+
+// Explains a RISC-V disassembly that stopped at a compressed instruction because the C extension was left out.
+// Instructions that aren't compressed have the bottom two bits of their first byte set.
+func riscvStopNote(asmArch string, ins []asm.Insn, opcodes []byte) string {
+	decoded := 0
+
+	for _, i := range ins {
+		decoded += len(i.Bytes)
+	}
+
+	withCompressed, ok := riscvWithoutCompressed[asmArch]
+
+	if !ok || decoded + 2 > len(opcodes) || opcodes[decoded] & 3 == 3 {
+		return ""
+	}
+
+	return "; that looks like a compressed instruction, which " + asmArch + " leaves out, disassemble as " + withCompressed + " to decode it\n"
+}
+
+// Checks if either the assembler or the disassembler supports the given architecture
+func isKnownArchitecture(asmArch string) bool {
+	return asm.CanAssemble(asmArch) || asm.CanDisassemble(asmArch)
+}
+
+// Commands that take an architecture before their input, and fall back to the user's saved one without it
+var defaultArchCommands = StrList{
+	"assemble", "disassemble", "explain", "pseudo", "stackframe", "encoding", "reljmp", "ropchain", "sctest", "strace",
+}
+
+// The number of arguments a command needs from a user. The architecture can be left out when the user has saved a
+// default one, so !disassemble 4889e5 is enough, but an architecture given without any input still isn't.
+func requiredArgCount(userID string, command Command, args []string) int {
+	if defaultArchCommands.contains(command.name) && len(args) > 1 && !isKnownArchitecture(args[1]) && getUserPrefs(userID).Arch != "" {
+		return command.requiredArgs - 1
+	}
+
+	return command.requiredArgs
+}
+
+// Splits command arguments into the architecture and the input. When the first argument isn't an architecture
+// but the user has saved a default one, the default is used and every argument is treated as input. Input in a
+// code block is taken out of it.
+func splitArchitectureArgs(userID string, args []string) (string, []string) {
+	if prefs := getUserPrefs(userID); !isKnownArchitecture(args[1]) && prefs.Arch != "" {
+		return prefs.Arch, unfenceArgs(args[1:])
+	}
+
+	return args[1], unfenceArgs(args[2:])
+}
+
+// The language tag that can follow a code block's opening fence, i.e. "x86asm" or "nasm"
+var fenceLanguageRegexp = regexp.MustCompile(`^[A-Za-z0-9_+#.-]*$`)
+
+// Takes input out of a ``` code block, dropping the fence and its language tag. The block's lines are kept as lines,
+// a listing has an instruction on each.
+func unfenceArgs(args []string) []string {
+	text := strings.Join(args, " ")
+	start := strings.Index(text, "```")
+
+	if start < 0 {
+		return args
+	}
+
+	end := strings.LastIndex(text, "```")
+
+	after := ""
+
+	// An unclosed block runs to the end of the message
+	if end == start {
+		end = len(text)
 	} else {
-		supportedArchs := "```"
-		supportedArchs += "x86, x86_64/x64, arm, thumb, arm64/aarch64, ppc/ppc32, ppc64, mips/mips32, mips64"
-		supportedArchs += "```"
+		after = strings.TrimSpace(text[end + 3:])
+	}
 
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Architecture not supported! Supported architectures: " + supportedArchs)
+	inner := text[start + 3:end]
+
+	if newline := strings.Index(inner, "\n"); newline >= 0 && fenceLanguageRegexp.MatchString(strings.TrimSpace(inner[:newline])) {
+		inner = inner[newline + 1:]
+	}
+
+	var lines []string
+
+	for _, line := range strings.Split(inner, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
 	}
+
+	text = strings.TrimSpace(text[:start]) + " " + strings.Join(lines, "\n") + " " + after
+
+	return strings.Split(strings.TrimSpace(text), " ")
 }
 
-// Gives a PDF link to the manual for the given architecture
-func cmdManual(params cmdArguments) {
-	var url string
+// Supported architecture lists, shown when the user gives one we don't know
+const (
+	supportedArchsKeystone = asm.AssembleArchs
+	supportedArchsCapstone = asm.DisassembleArchs
+)
 
+// Assembles the given instructions into opcodes via the given architecture
+func cmdAssemble(params cmdArguments) {
 	s := params.s
 	m := params.m
 	args := params.args
 
-	asmArgs := args[1]
+	prefs := getUserPrefs(m.Author.ID)
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+	instructions := ""
 
-	if asmArgs == "x86" || asmArgs == "x86_16" || asmArgs == "x64" || asmArgs == "x86_64" || asmArgs == "x86-64" {
-		url = "https://www.intel.com/content/dam/www/public/us/en/documents/manuals/64-ia-32-architectures-software-developer-instruction-set-reference-manual-325383.pdf"
-	} else if asmArgs == "arm" || asmArgs == "aarch64" || asmArgs == "arm64" {
-		url = "https://static.docs.arm.com/ddi0487/ca/DDI0487C_a_armv8_arm.pdf"
-	} else if asmArgs == "ppc" || asmArgs == "ppc32" || asmArgs == "ppc64" {
-		url = "http://www.plantation-productions.com/Webster/www.writegreatcode.com/Vol2/wgc2_OB.pdf"
-	} else if asmArgs == "mips" || asmArgs == "mips32" || asmArgs == "mips64" {
-		url = "https://www.cs.cmu.edu/afs/cs/academic/class/15740-f97/public/doc/mips-isa.pdf"
-	} else {
-		supportedArchs := "```"
-		supportedArchs += "x86, x86_16, x86_64/x64, arm, arm64/aarch64, ppc/ppc32, ppc64, mips/mips32, mips64"
-		supportedArchs += "```"
+	// Stitch together the rest of the arguments for the instructions
+	for _, arg := range rest {
+		instructions += arg + " "
+	}
+
+	ins, err := assemble(asmArch, instructions, prefs.asmOptions())
 
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Architecture not supported! Supported architectures: " + supportedArchs)
+	if err != nil {
+		msg := asmErrorMessage(err, supportedArchsKeystone)
+
+		// Show the instructions that did assemble before the one that failed, as a file if they don't fit
+		if len(ins) > 0 {
+			listing := formatAssembly(ins, nil)
+
+			if len(msg) + len(listing) >= maxListingMessageLength {
+				sendTextFile(s, m.ChannelID, msg, "assembly.txt", listing)
+				return
+			}
+
+			msg = "Assembled up to the failed instruction: ```" + fenceLanguage(guildScope(m), "assemble", asmArch) + "\n" + listing + "```" + msg
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, msg)
 		return
 	}
 
-	_, _ = s.ChannelMessageSend(m.ChannelID, "Here you go: " + url)
+	// Keystone assembler succeeded, give the user the output
+	// Flag anything suspicious, other formats can't have comments so the warnings go after the code block
+	warnings := asm.Lint(asmArch, ins, prefs.asmOptions().options()...)
+	listing := formatAssemblyAs(ins, prefs.Format, warnings)
+	notes := ""
+
+	if prefs.Format != "" && prefs.Format != "listing" {
+		notes = formatWarnings(warnings)
+	}
+
+	outMsg := "Assembly: ```" + fenceLanguage(guildScope(m), "assemble", asmArch) + "\n" + listing + "```" + notes
+
+	// The limit is on the formatted message, which spaced out opcodes can take well past it
+	if len(outMsg) >= maxListingMessageLength {
+		sendTextFile(s, m.ChannelID, "Assembly:", "assembly.txt", listing + notes)
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, outMsg)
 }
 
-// Gives a random reverse engineering trick
-func cmdReTrick(params cmdArguments) {
+// Disassembles the given opcodes into instructions via the architecture
+func cmdDisassemble(params cmdArguments) {
 	s := params.s
 	m := params.m
+	args := params.args
+
+	prefs := getUserPrefs(m.Author.ID)
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+	opcodes := ""
+
+	// Stitch together the rest of the arguments for the opcodes, AVR words are told apart by the spaces between them
+	for _, arg := range rest {
+		opcodes += arg + " "
+	}
+
+	// Unknown architectures take priority over bad input in error messages
+	if !asm.CanDisassemble(asmArch) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, supportedArchsCapstone))
+		return
+	}
+
+	opcodesBinary, err := parseOpcodes(opcodes)
+
+	if asmArch == "avr" {
+		opcodesBinary, err = parseAVROpcodes(opcodes)
+	}
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, supportedArchsCapstone))
+		return
+	}
 
-	rand.Seed(time.Now().Unix())
+	reply, err := disassemblyReply(guildScope(m), asmArch, opcodesBinary, prefs)
 
-	tricks := []string {
-		"When possible, use a debugger to trace user input in a function",
-		"Viewing strings is very helpful",
-		"IDA: IDA has a quick action dropdown to the right of the breakdown bar https://i.imgur.com/TmtXE1O.png",
-		"IDA: You can view functions that call a target function and functions the target function calls with View -> Open subviews -> Function calls https://i.imgur.com/bdB0Rge.png",
-		"IDA: Hit 'k' to convert 'rbp+var_xxx' format in instructions into 'rbp-xxxh'",
-		"IDA: When in Graph View, the 'Graph overview' window can be used to quickly navigate around large functions https://i.imgur.com/8IqPs1r.png",
-		"Intel x86 can be tricky, `mov eax, eax` may seem like a NOP, but it also implicitly clears the upper 32-bits of the rax register",
-		"Intel x86 can be tricky, `cmpxchg` instructions implicitly modify the value of the RAX register, regardless of operands",
-		"When you see instructions that check the value of one offset from a register, then the register is set to a value from another offset in a loop - it's probably a linked list",
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, supportedArchsCapstone))
+		return
 	}
 
-	// Pick a random one
-	n := rand.Int() % len(tricks)
-	_, _ = s.ChannelMessageSend(m.ChannelID, tricks[n])
+	// Disassembler succeeded, give the user the output
+	_, _ = s.ChannelMessageSendComplex(m.ChannelID, reply)
 }
 
-// Gives a random exploit development trick
-func cmdExploitTrick(params cmdArguments) {
+// Architectures and modes !disas-modes tries, the ones an unknown blob is most often in
+var disassemblyModes = []string{"x86_16", "x86", "x64", "arm", "thumb", "arm64"}
+
+// Most instructions !disas-modes lists for each mode, the summary says how far the rest decoded
+const maxModeInstructions = 12
+
+// Disassembles the same opcodes in each architecture and mode in disassemblyModes, ranked by how much of the
+// opcodes each one decodes, to help work out which one an unknown blob is in
+func cmdDisasModes(params cmdArguments) {
 	s := params.s
 	m := params.m
+	args := params.args
 
-	rand.Seed(time.Now().Unix())
+	prefs := getUserPrefs(m.Author.ID)
+	opcodes, err := parseOpcodes(strings.Join(unfenceArgs(args[1:]), ""))
 
-	tricks := []string {
-		"Use infloop gadgets in ROP chains for blind debugging",
-		"For use-after-free exploits, try empty heap spraying after code execution to stabilize the process if it's a critical object",
-		"The power of going straight from a bug to PC/IP control is overrated, other primitives like arbitrary R/W are often easier and just as powerful",
-		"When writing shellcode, use `xor [reg], [reg]` to avoid null bytes. This can also be used for patches, as `xor` instructions typically use less opcodes than `mov` instructions.",
-		"When the patch is smaller than the original code, NOPS are your friend",
-		"You don't always need a separate infoleak bug to defeat ASLR, sometimes you can use the context of other registers to calculate from.",
-		"When looking for vulnerabilities in large software, map out attack surface first - it sucks to find a bug then realize it's in code that's unreachable later on.",
-		"When looking for integer overflows in x86, `ja/jump above or jb/jump below` is an unsigned compare, `jg/jump greater or jl/jump lower` is a signed compare.",
-		"If you're using gdb to debug exploits, use PEDA https://github.com/longld/peda",
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, supportedArchsCapstone))
+		return
 	}
 
-	// Pick a random one
-	n := rand.Int() % len(tricks)
-	_, _ = s.ChannelMessageSend(m.ChannelID, tricks[n])
-}
+	type modeResult struct {
+		arch    string
+		ins     []asm.Insn
+		decoded int
+	}
 
-// Returns the proper keystone architecture based on the user input string
-func parseArchitectureKeystone(arch string) (keystone.Architecture, keystone.Mode) {
-	switch arch {
-	case "x86_16":
-		return keystone.ARCH_X86, keystone.MODE_16
-	case "x86":
-		return keystone.ARCH_X86, keystone.MODE_32
-	case "x64", "x86_64", "x86-64":
-		return keystone.ARCH_X86, keystone.MODE_64
-	case "arm":
-		return keystone.ARCH_ARM, keystone.MODE_ARM
-	case "thumb":
-		return keystone.ARCH_ARM, keystone.MODE_THUMB
-	case "aarch64", "arm64":
-		return keystone.ARCH_ARM64, keystone.MODE_LITTLE_ENDIAN
-	case "ppc", "ppc32":
-		return keystone.ARCH_PPC, keystone.MODE_PPC32 | keystone.MODE_BIG_ENDIAN
-	case "ppc64":
-		return keystone.ARCH_PPC, keystone.MODE_PPC64
-	case "mips", "mips32":
-		return keystone.ARCH_MIPS, keystone.MODE_MIPS32 | keystone.MODE_BIG_ENDIAN
-	case "mips64":
-		return keystone.ARCH_MIPS, keystone.MODE_MIPS64
-	default:
-		return ^keystone.Architecture(0), ^keystone.Mode(0)
+	var results []modeResult
+
+	for _, arch := range disassemblyModes {
+		ins, err := disassemble(arch, opcodes, prefs.asmOptions())
+
+		// Limits apply to the opcodes whatever the mode, so the first failure is the only one worth reporting
+		var limitErr limitError
+		if errors.As(err, &limitErr) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, supportedArchsCapstone))
+			return
+		}
+
+		result := modeResult{arch: arch, ins: ins}
+		for _, i := range ins {
+			result.decoded += len(i.Bytes)
+		}
+
+		results = append(results, result)
 	}
-}
 
-// Returns the proper capstone architecture based on the user input string
-func parseArchitectureCapstone(arch string) (int, int) {
-	switch arch {
-	case "x86_16":
-		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_16
-	case "x86":
-		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_32
-	case "x64", "x86_64", "x86-64":
-		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_64
-	case "arm":
-		return gapstone.CS_ARCH_ARM, gapstone.CS_MODE_ARM
-	case "thumb":
-		return gapstone.CS_ARCH_ARM, gapstone.CS_MODE_THUMB
-	case "aarch64", "arm64":
-		return gapstone.CS_ARCH_ARM64, gapstone.CS_MODE_ARM
-	case "ppc", "ppc32":
-		return gapstone.CS_ARCH_PPC, gapstone.CS_MODE_BIG_ENDIAN
-	case "ppc64":
-		return gapstone.CS_ARCH_PPC, gapstone.CS_MODE_LITTLE_ENDIAN
-	case "mips", "mips32":
-		return gapstone.CS_ARCH_MIPS, gapstone.CS_MODE_MIPS32 | gapstone.CS_MODE_BIG_ENDIAN
-	case "mips64":
-		return gapstone.CS_ARCH_MIPS, gapstone.CS_MODE_MIPS64 | gapstone.CS_MODE_LITTLE_ENDIAN
-	default:
-		return -1, -1
+	// Modes that decode more of the bytes are more likely the right one, ties keep the order above
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].decoded > results[b].decoded
+	})
+
+	summary := ""
+	listings := ""
+
+	for _, result := range results {
+		summary += padRight(result.arch, " ", 7) + strconv.Itoa(result.decoded) + "/" + strconv.Itoa(len(opcodes)) +
+			" bytes, " + strconv.Itoa(len(result.ins)) + " instructions\n"
+
+		listings += "\n; " + result.arch + "\n"
+
+		if len(result.ins) == 0 {
+			listings += "; nothing decodes in this mode\n"
+			continue
+		}
+
+		ins := result.ins
+		if len(ins) > maxModeInstructions {
+			ins = ins[:maxModeInstructions]
+		}
+
+		listings += formatDisassembly(ins)
+
+		if len(result.ins) > len(ins) {
+			listings += "; ... " + strconv.Itoa(len(result.ins) - len(ins)) + " more\n"
+		} else {
+			listings += disassemblyStopNote(result.ins, opcodes)
+		}
 	}
+
+	content := "Most likely " + results[0].arch + ", it decodes the most bytes:"
+	if results[0].decoded == 0 {
+		content = "None of the modes decode these bytes:"
+	}
+
+	sendListing(s, m.ChannelID, content, "modes.txt", summary + listings)
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Skips tests that need Keystone when it isn't built in
+func requireKeystone(t *testing.T) {
+	if _, err := assemble("x64", "nop", asmOptions{}); err != nil {
+		t.Skip("Keystone isn't available: " + err.Error())
+	}
+}
+
+func TestAssembleUnknownArchitecture(t *testing.T) {
+	replies := runHandler(cmdAssemble, "!asm z80 nop").sent()
+
+	if len(replies) != 1 || !strings.HasPrefix(replies[0].content, "Architecture not supported!") || !strings.Contains(replies[0].content, supportedArchsKeystone) {
+		t.Errorf("got %+v, want one reply listing the architectures", replies)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	requireKeystone(t)
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"!asm x64 nop", "nop  ; +0 = 90"},
+		{"!asm x64 xor eax, eax; ret", "xor eax, eax  ; +0 = 31 c0"},
+		{"!asm x86 push ebp", "push ebp  ; +0 = 55"},
+		{"!asm arm bx lr", "bx lr  ; +0 = 1e ff 2f e1"},
+		{"!asm arm64 ret", "ret  ; +0 = c0 03 5f d6"},
+		{"!asm mips jr $ra", "jr $ra  ; +0 = 03 e0 00 08"},
+		{"!asm mipsel jr $ra", "jr $ra  ; +0 = 08 00 e0 03"},
+		{"!asm mips64 jr $ra", "jr $ra  ; +0 = 03 e0 00 08"},
+	}
+
+	for _, test := range tests {
+		replies := runHandler(cmdAssemble, test.source).sent()
+
+		if len(replies) != 1 || !strings.HasPrefix(replies[0].content, "Assembly: ```") || !strings.Contains(replies[0].content, test.want) {
+			t.Errorf("%q: got %+v, want a listing with %q", test.source, replies, test.want)
+		}
+	}
+}
+
+func TestAssembleError(t *testing.T) {
+	requireKeystone(t)
+
+	// The instructions before the one that failed are still shown
+	replies := runHandler(cmdAssemble, "!asm x64 nop; notaninstruction").sent()
+
+	if len(replies) != 1 || !strings.HasPrefix(replies[0].content, "Assembled up to the failed instruction:") || !strings.Contains(replies[0].content, "nop") {
+		t.Errorf("got %+v, want the listing up to the error", replies)
+	}
+}
+
+func TestAssembleLongListing(t *testing.T) {
+	requireKeystone(t)
+
+	// Too long for a message, so it's sent as a file
+	replies := runHandler(cmdAssemble, "!asm x64 " + strings.Repeat("mov rax, 0x1122334455667788; ", 60)).sent()
+
+	if len(replies) != 1 || replies[0].files["assembly.txt"] == "" {
+		t.Fatalf("got %+v, want the listing as assembly.txt", replies)
+	}
+
+	if lines := strings.Count(replies[0].files["assembly.txt"], "\n"); lines < 60 {
+		t.Errorf("the file has %d lines, want all 60 instructions", lines)
+	}
+}
@@ -0,0 +1,1133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"debug/pe"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// Most instructions !objdump lists, so a large binary can't produce a gigantic file
+const maxObjdumpInstructions = 200000
+
+// Instructions !objdump sweeps between checks for the job being cancelled
+const objdumpSweepBatch = 4096
+
+// Listings longer than this are sent as a file, Discord messages are limited to 2000 characters
+const maxListingMessageLength = 1900
+
+// Smallest instruction size for each architecture, invalid bytes are skipped in steps of this
+var instructionAlignment = map[string]int{
+	"arm": 4, "arm64": 4, "aarch64": 4, "thumb": 2, "ppc": 4, "ppc32": 4, "ppc64": 4, "mips": 4, "mips32": 4, "mips64": 4,
+	"mipsel": 4, "mips64el": 4, "mipsr6": 4, "ppc32be": 4, "ppc32le": 4, "ppc64be": 4, "ppc64le": 4, "avr": 2, "tricore": 2, "tricore13": 2,
+	"riscv": 2, "riscv32": 2, "rv32gc": 2, "riscv64": 2, "rv64gc": 2, "rv32g": 4, "rv64g": 4,
+}
+
+// Disassembles code from start to end, unlike asm.Disassemble it carries on past invalid bytes, which are
+// listed as "(bad)". Returns false if it stopped at the instruction limit.
+func linearSweep(arch string, code []byte, base uint64, limit int) ([]asm.Insn, bool) {
+	var out []asm.Insn
+
+	step := instructionAlignment[arch]
+	if step == 0 {
+		step = 1
+	}
+
+	for offset := 0; offset < len(code); {
+		if len(out) >= limit {
+			return out, false
+		}
+
+		ins, err := asm.Disassemble(arch, code[offset:], base + uint64(offset))
+
+		if err != nil || len(ins) == 0 {
+			end := offset + step
+			if end > len(code) {
+				end = len(code)
+			}
+
+			out = append(out, asm.Insn{Address: base + uint64(offset), Bytes: code[offset:end], Mnemonic: "(bad)"})
+			offset = end
+			continue
+		}
+
+		for _, i := range ins {
+			out = append(out, i)
+			offset += len(i.Bytes)
+		}
+	}
+
+	return out, true
+}
+
+// Sends a file attachment
+func sendFile(s Responder, channelID string, content string, name string, contentType string, data io.Reader) {
+	_, _ = s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: content,
+		Files: []*discordgo.File{{
+			Name:        name,
+			ContentType: contentType,
+			Reader:      data,
+		}},
+	})
+}
+
+// Sends text as a file attachment
+func sendTextFile(s Responder, channelID string, content string, name string, text string) {
+	sendFile(s, channelID, content, name, "text/plain", strings.NewReader(text))
+}
+
+// Sends a listing in a code block, or as a file attachment if it's too long for a message
+func sendListing(s Responder, channelID string, content string, name string, text string) {
+	if len(content) + len(text) < maxListingMessageLength {
+		_, _ = s.ChannelMessageSend(channelID, content + " ```\n" + text + "```")
+		return
+	}
+
+	sendTextFile(s, channelID, content, name, text)
+}
+
+// Formats an objdump style listing of the binary's executable sections, with symbol labels. A cancelled context
+// stops it part way, with the listing so far.
+func objdumpListing(ctx context.Context, bin *binaryFile) (string, bool) {
+	var out strings.Builder
+	remaining := maxObjdumpInstructions
+	labels := bin.symbolNames()
+
+	out.WriteString(bin.Name + ":     file format " + strings.ToLower(bin.Format) + "-" + strings.ToLower(bin.Machine) + "\n")
+
+	for _, section := range bin.Sections {
+		code := bin.sectionData(section)
+
+		if !section.Exec || len(code) == 0 {
+			continue
+		}
+
+		out.WriteString("\n\nDisassembly of section " + section.Name + ":\n")
+
+		// Swept a batch at a time, so a cancelled job stops part way through a large section
+		for offset := 0; offset < len(code); {
+			if ctx.Err() != nil || remaining <= 0 {
+				return out.String(), false
+			}
+
+			batch := remaining
+
+			if batch > objdumpSweepBatch {
+				batch = objdumpSweepBatch
+			}
+
+			ins, _ := linearSweep(bin.Arch, code[offset:], section.Addr + uint64(offset), batch)
+			remaining -= len(ins)
+
+			for _, i := range ins {
+				for _, label := range labels[i.Address] {
+					out.WriteString(fmt.Sprintf("\n%016x <%s>:\n", i.Address, label))
+				}
+
+				out.WriteString(fmt.Sprintf("%8x:\t%-24s\t%s %s\n", i.Address, formatOpcodes(i.Bytes), i.Mnemonic, i.OpStr))
+				offset += len(i.Bytes)
+			}
+		}
+	}
+
+	return out.String(), true
+}
+
+// Disassembles every executable section of an attached binary, and sends the listing as a file
+func cmdObjdump(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	if bin.Arch == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + bin.Format + " files for " + bin.Machine + " can't be disassembled. Supported architectures: ```" + supportedArchsCapstone + "```")
+		return
+	}
+
+	reportProgress(s, "disassembling " + bin.Name)
+	listing, complete := objdumpListing(jobContext(s), bin)
+	content := "Here's the disassembly of " + bin.Name + " (" + bin.Arch + ")."
+
+	if !complete {
+		content += " It stopped after " + strconv.Itoa(maxObjdumpInstructions) + " instructions."
+	}
+
+	sendTextFile(s, m.ChannelID, content, bin.Name + ".objdump.txt", listing)
+}
+
+// Lists the functions in an attached binary
+func cmdFuncs(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	funcs := bin.functions()
+
+	if len(funcs) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "No functions were found in " + bin.Name + ".")
+		return
+	}
+
+	var listing strings.Builder
+
+	for _, fn := range funcs {
+		name := fn.Name
+		if fn.Library != "" {
+			name += " (" + fn.Library + ")"
+		}
+
+		listing.WriteString(fmt.Sprintf("%016x %8x  %-9s  %s\n", fn.Addr, fn.Size, fn.Source, name))
+	}
+
+	sendListing(s, m.ChannelID, "Found " + strconv.Itoa(len(funcs)) + " functions in " + bin.Name + ":", bin.Name + ".funcs.txt", listing.String())
+}
+
+// Parses an address argument, either a function name or a hex address
+func parseBinaryAddress(bin *binaryFile, arg string) (uint64, bool) {
+	if fn, ok := bin.findFunction(arg); ok {
+		return fn.Addr, true
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(arg), "0x"), 16, 64)
+	return addr, err == nil
+}
+
+// Lists the references to an address in the user's binary, with the instructions around each one
+func cmdXref(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	addr, ok := parseBinaryAddress(bin, args[1])
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "'" + args[1] + "' isn't a function in " + bin.Name + " or a hex address.")
+		return
+	}
+
+	refs := bin.xrefs(addr)
+	name := bin.addressName(addr)
+
+	if len(refs) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Nothing in " + bin.Name + " refers to " + name + ".")
+		return
+	}
+
+	code := bin.instructions()
+	var listing strings.Builder
+
+	for _, ref := range refs {
+		listing.WriteString(fmt.Sprintf("%s from %s (0x%x, %s):\n", ref.Kind, bin.addressName(ref.From), ref.From, ref.Section))
+
+		if ref.Index < 0 {
+			listing.WriteString("\n")
+			continue
+		}
+
+		for n := ref.Index - 1; n <= ref.Index + 1; n++ {
+			if n < 0 || n >= len(code) {
+				continue
+			}
+
+			marker := "  "
+			if n == ref.Index {
+				marker = "> "
+			}
+
+			listing.WriteString(fmt.Sprintf("%s%8x:  %s %s\n", marker, code[n].Address, code[n].Mnemonic, code[n].OpStr))
+		}
+
+		listing.WriteString("\n")
+	}
+
+	sendListing(s, m.ChannelID, "Found " + strconv.Itoa(len(refs)) + " references to " + name + " in " + bin.Name + ":", bin.Name + ".xrefs.txt", listing.String())
+}
+
+// Bytes !hexdump shows in a message, longer dumps are sent as a file
+const hexdumpPageBytes = 256
+
+// Most bytes !hexdump sends in one file
+const maxHexdumpBytes = 64 * 1024
+
+// Formats bytes like hexdump -C, with offsets starting at base
+func formatHexdump(data []byte, base uint64) string {
+	var out strings.Builder
+
+	for line := 0; line < len(data); line += 16 {
+		end := line + 16
+		if end > len(data) {
+			end = len(data)
+		}
+
+		out.WriteString(fmt.Sprintf("%08x  ", base + uint64(line)))
+
+		for n := line; n < line + 16; n++ {
+			if n < end {
+				out.WriteString(fmt.Sprintf("%02x ", data[n]))
+			} else {
+				out.WriteString("   ")
+			}
+
+			if n == line + 7 {
+				out.WriteString(" ")
+			}
+		}
+
+		out.WriteString(" |")
+
+		for _, b := range data[line:end] {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+
+			out.WriteByte(b)
+		}
+
+		out.WriteString("|\n")
+	}
+
+	return out.String()
+}
+
+// Decodes bytes given inline as hex or base64
+func parseInlineBytes(text string) ([]byte, error) {
+	if data, err := parseOpcodes(text); err == nil {
+		return data, nil
+	}
+
+	if data, err := base64.StdEncoding.DecodeString(text); err == nil {
+		return data, nil
+	}
+
+	if data, err := base64.RawStdEncoding.DecodeString(text); err == nil {
+		return data, nil
+	}
+
+	return nil, errors.New("the bytes aren't valid hex or base64")
+}
+
+// What !hexdump dumps. Args are the offset and length arguments, which inline bytes don't take, and Kept is set if
+// the data is kept for the next page.
+type hexdumpSource struct {
+	Data []byte
+	Name string
+	Args []string
+	Kept bool
+}
+
+// Works out what !hexdump dumps. An attachment is dumped whatever its format, without an attachment the arguments
+// are the bytes to dump, unless they're numbers and the user has a binary from an earlier command.
+func hexdumpInput(m *discordgo.MessageCreate, args []string) (hexdumpSource, error) {
+	if len(m.Attachments) > 0 {
+		data, err := downloadAttachment(m.Attachments[0])
+
+		if err != nil {
+			return hexdumpSource{}, errors.New("couldn't download the attachment, " + err.Error())
+		}
+
+		// ELF and PE attachments are kept for the other binary commands
+		bin, err := parseBinary(m.Attachments[0].Filename, data)
+
+		if err == nil {
+			setSessionBinary(m.Author.ID, bin)
+		}
+
+		return hexdumpSource{data, m.Attachments[0].Filename, args, err == nil}, nil
+	}
+
+	numbers := len(args) <= 2
+	for _, arg := range args {
+		if _, err := strconv.ParseUint(arg, 0, 64); err != nil {
+			numbers = false
+		}
+	}
+
+	if bin, ok := lastSessionBinary(m.Author.ID); ok && numbers {
+		return hexdumpSource{bin.Data, bin.Name, args, true}, nil
+	}
+
+	if len(args) == 0 {
+		return hexdumpSource{}, errors.New("attach a file, or give the bytes to dump as hex or base64")
+	}
+
+	data, err := parseInlineBytes(strings.Join(args, ""))
+	return hexdumpSource{data, "bytes", nil, false}, err
+}
+
+// Dumps an attachment, the user's binary or inline bytes as hex and ASCII, a page at a time
+func cmdHexdump(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	source, err := hexdumpInput(m, args[1:])
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	data := source.Data
+	offset := uint64(0)
+	length := uint64(hexdumpPageBytes)
+
+	// Inline bytes are dumped in full, they're only as long as a message
+	if source.Args == nil {
+		length = uint64(len(data))
+	}
+
+	if len(source.Args) > 0 {
+		offset, err = strconv.ParseUint(source.Args[0], 0, 64)
+	}
+
+	if err == nil && len(source.Args) > 1 {
+		length, err = strconv.ParseUint(source.Args[1], 0, 64)
+	}
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "The offset and length have to be numbers, i.e. `!hexdump 0x1000 0x100`.")
+		return
+	}
+
+	if offset >= uint64(len(data)) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "The offset is past the end of " + source.Name + ", which is 0x" + strconv.FormatUint(uint64(len(data)), 16) + " bytes.")
+		return
+	}
+
+	if length > maxHexdumpBytes {
+		length = maxHexdumpBytes
+	}
+
+	end := offset + length
+	if end > uint64(len(data)) {
+		end = uint64(len(data))
+	}
+
+	content := fmt.Sprintf("%s, 0x%x-0x%x of 0x%x bytes.", source.Name, offset, end, len(data))
+
+	if end < uint64(len(data)) {
+		next := fmt.Sprintf("!hexdump 0x%x", end)
+
+		if length != hexdumpPageBytes {
+			next += fmt.Sprintf(" 0x%x", length)
+		}
+
+		content += " Next page: `" + next + "`"
+
+		if !source.Kept {
+			content += " with the file attached again"
+		}
+	}
+
+	dump := formatHexdump(data[offset:end], offset)
+
+	if end - offset <= hexdumpPageBytes {
+		_, _ = s.ChannelMessageSend(m.ChannelID, content + " ```\n" + dump + "```")
+		return
+	}
+
+	sendTextFile(s, m.ChannelID, content, source.Name + ".hexdump.txt", dump)
+}
+
+// Disassembles the patched bytes of a binary before and after the patch, for the !patch and !patchasm replies. Empty
+// if the patch isn't in an executable section.
+func patchPreview(scope string, before *binaryFile, after *binaryFile, offset uint64, length int) string {
+	section, ok := before.sectionAtOffset(offset)
+
+	if !ok || !section.Exec || before.Arch == "" {
+		return ""
+	}
+
+	addr := section.Addr + offset - section.Offset
+	end := offset + uint64(length)
+
+	// The instruction the patch ends in is shown in full
+	if end + 16 <= section.Offset + section.Size {
+		end += 16
+	} else {
+		end = section.Offset + section.Size
+	}
+
+	listing := func(bin *binaryFile) string {
+		ins, _ := linearSweep(bin.Arch, bin.Data[offset:end], addr, maxObjdumpInstructions)
+		out := ""
+
+		for _, i := range ins {
+			if i.Address >= addr + uint64(length) {
+				break
+			}
+
+			out += fmt.Sprintf("%8x:  %-24s  %s %s\n", i.Address, formatOpcodes(i.Bytes), i.Mnemonic, i.OpStr)
+		}
+
+		return out
+	}
+
+	language := fenceLanguage(scope, "patch", before.Arch)
+
+	return "Before: ```" + language + "\n" + listing(before) + "```After: ```" + language + "\n" + listing(after) + "```"
+}
+
+// Sends the patched binary, with a preview of the patched instructions, and keeps it for the next command
+func sendPatchedBinary(s Responder, m *discordgo.MessageCreate, before *binaryFile, after *binaryFile, offset uint64, length int) {
+	setSessionBinary(m.Author.ID, after)
+
+	content := fmt.Sprintf("Patched 0x%x bytes at offset 0x%x of %s.", length, offset, after.Name)
+	preview := patchPreview(guildScope(m), before, after, offset, length)
+
+	if len(content) + len(preview) < maxListingMessageLength {
+		content += " " + preview
+	}
+
+	sendFile(s, m.ChannelID, content, "patched_" + after.Name, "application/octet-stream", bytes.NewReader(after.Data))
+}
+
+// Patches bytes at a file offset of the user's binary, and sends back the patched file
+func cmdPatch(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	offset, err := strconv.ParseUint(args[1], 0, 64)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "The offset has to be a number, i.e. `!patch 0x1234 90 90`.")
+		return
+	}
+
+	patch, err := parseOpcodes(strings.Join(args[2:], ""))
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "The patch has to be hex bytes, i.e. `!patch 0x1234 90 90`.")
+		return
+	}
+
+	patched, err := bin.patched(offset, patch)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	sendPatchedBinary(s, m, bin, patched, offset, len(patch))
+}
+
+// Assembles instructions into the user's binary at a file offset, and sends back the patched file. The patch can't
+// end partway through an instruction, unless "pad" is given to fill the rest of it with NOPs.
+func cmdPatchAsm(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	offset, err := strconv.ParseUint(args[1], 0, 64)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "The offset has to be a number, i.e. `!patchasm 0x1234 pad xor eax, eax`.")
+		return
+	}
+
+	rest := args[2:]
+	pad := strings.ToLower(rest[0]) == "pad"
+
+	if pad {
+		rest = rest[1:]
+	}
+
+	section, ok := bin.sectionAtOffset(offset)
+
+	if !ok || !section.Exec {
+		_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Offset 0x%x isn't in an executable section of %s.", offset, bin.Name))
+		return
+	}
+
+	if !asm.CanAssemble(bin.Arch) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, supportedArchsKeystone))
+		return
+	}
+
+	addr := section.Addr + offset - section.Offset
+	opts := getUserPrefs(m.Author.ID).asmOptions()
+	opts.base = addr
+
+	ins, err := assemble(bin.Arch, strings.Join(rest, " "), opts)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, supportedArchsKeystone))
+		return
+	}
+
+	var patch []byte
+	for _, i := range ins {
+		patch = append(patch, i.Bytes...)
+	}
+
+	sectionEnd := section.Offset + section.Size
+
+	if offset + uint64(len(patch)) > sectionEnd {
+		_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("The patch is 0x%x bytes, which runs past the end of %s.", len(patch), section.Name))
+		return
+	}
+
+	// Find where the instruction the patch ends in ends, so it isn't left half overwritten
+	end := offset + uint64(len(patch)) + 16
+	if end > sectionEnd {
+		end = sectionEnd
+	}
+
+	covered := 0
+	original, _ := linearSweep(bin.Arch, bin.Data[offset:end], addr, maxObjdumpInstructions)
+
+	for _, i := range original {
+		if covered >= len(patch) {
+			break
+		}
+
+		covered += len(i.Bytes)
+	}
+
+	if covered > len(patch) {
+		if !pad {
+			_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("The patch is 0x%x bytes, which ends partway through an instruction, the instructions it overwrites are 0x%x bytes. Add `pad` after the offset to fill the rest with NOPs.", len(patch), covered))
+			return
+		}
+
+		nop, err := asm.Assemble(bin.Arch, "nop")
+
+		if err != nil || len(nop) == 0 || (covered - len(patch)) % len(nop[0].Bytes) != 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("The 0x%x bytes after the patch can't be filled with NOPs.", covered - len(patch)))
+			return
+		}
+
+		for len(patch) < covered {
+			patch = append(patch, nop[0].Bytes...)
+		}
+	}
+
+	patched, err := bin.patched(offset, patch)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	sendPatchedBinary(s, m, bin, patched, offset, len(patch))
+}
+
+// Most !scan matches that are listed
+const maxScanMatches = 100
+
+// Searches the user's binary for a byte pattern with wildcards, and disassembles each match
+func cmdScan(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	pattern, err := parseBytePattern(args[1:])
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ". Patterns are hex bytes with ?? wildcards, i.e. `!scan 48 8B ?? ?? E8`.")
+		return
+	}
+
+	matches, complete := pattern.find(bin.Data, maxScanMatches)
+
+	if len(matches) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "`" + pattern.String() + "` isn't in " + bin.Name + ".")
+		return
+	}
+
+	var listing strings.Builder
+
+	for _, offset := range matches {
+		section, ok := bin.sectionAtOffset(uint64(offset))
+
+		if !ok {
+			listing.WriteString(fmt.Sprintf("offset 0x%x\n\n", offset))
+			continue
+		}
+
+		addr := section.Addr + uint64(offset) - section.Offset
+		listing.WriteString(fmt.Sprintf("offset 0x%x, %s (0x%x, %s)\n", offset, bin.addressName(addr), addr, section.Name))
+
+		if section.Exec && bin.Arch != "" {
+			end := uint64(offset + len(pattern.Bytes) + 16)
+			if end > section.Offset + section.Size {
+				end = section.Offset + section.Size
+			}
+
+			ins, _ := linearSweep(bin.Arch, bin.Data[offset:end], addr, maxObjdumpInstructions)
+
+			for _, i := range ins {
+				if i.Address >= addr + uint64(len(pattern.Bytes)) {
+					break
+				}
+
+				listing.WriteString(fmt.Sprintf("  %8x:  %-24s  %s %s\n", i.Address, formatOpcodes(i.Bytes), i.Mnemonic, i.OpStr))
+			}
+		}
+
+		listing.WriteString("\n")
+	}
+
+	content := "Found `" + pattern.String() + "` " + strconv.Itoa(len(matches)) + " times in " + bin.Name + ":"
+
+	if !complete {
+		content = "Found `" + pattern.String() + "` more than " + strconv.Itoa(maxScanMatches) + " times in " + bin.Name + ", here are the first " + strconv.Itoa(maxScanMatches) + ":"
+	}
+
+	sendListing(s, m.ChannelID, content, bin.Name + ".scan.txt", listing.String())
+}
+
+// Most bytes of files !peres extract attaches, Discord won't take a bigger upload
+const maxExtractedBytes = 8 * 1024 * 1024
+
+// Most characters of a manifest !peres shows
+const maxManifestLength = 1500
+
+// Lists the resources in a PE with its version info and manifest, and with "extract" attaches its icons and any
+// executables embedded in its resources
+func cmdPeRes(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	resources, err := bin.resources()
+
+	if err != nil && len(resources) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	var listing strings.Builder
+	var version, manifest []byte
+
+	for _, res := range resources {
+		listing.WriteString(fmt.Sprintf("%s/%s  lang %d  rva 0x%x  0x%x bytes\n", res.Type, res.Name, res.Lang, res.RVA, len(res.Data)))
+
+		switch res.TypeID {
+		case 16:
+			version = res.Data
+		case 24:
+			manifest = res.Data
+		}
+	}
+
+	if err != nil {
+		listing.WriteString("(the rest of the resource directory is malformed)\n")
+	}
+
+	if version != nil {
+		fileVersion, strs, err := parseVersionInfo(version)
+
+		listing.WriteString("\nVersion info:\n")
+
+		if err != nil {
+			listing.WriteString("  (" + err.Error() + ")\n")
+		}
+
+		if fileVersion != "" {
+			listing.WriteString("  FileVersion (fixed): " + fileVersion + "\n")
+		}
+
+		for _, str := range strs {
+			listing.WriteString("  " + str[0] + ": " + str[1] + "\n")
+		}
+	}
+
+	if manifest != nil {
+		text := strings.TrimSpace(string(manifest))
+
+		if len(text) > maxManifestLength {
+			text = text[:maxManifestLength] + "\n..."
+		}
+
+		listing.WriteString("\nManifest:\n" + text + "\n")
+	}
+
+	content := "Found " + strconv.Itoa(len(resources)) + " resources in " + bin.Name + ":"
+
+	if len(args) < 2 || strings.ToLower(args[1]) != "extract" {
+		sendListing(s, m.ChannelID, content, bin.Name + ".resources.txt", listing.String())
+		return
+	}
+
+	// Icons are rebuilt into .ico files, other resources are only attached if they're executables
+	var files []*discordgo.File
+	total := 0
+
+	addFile := func(name string, data []byte) {
+		if len(files) >= 10 || total + len(data) > maxExtractedBytes {
+			return
+		}
+
+		files = append(files, &discordgo.File{Name: name, ContentType: "application/octet-stream", Reader: bytes.NewReader(data)})
+		total += len(data)
+	}
+
+	icons := peIcons(resources)
+	var iconNames []string
+
+	for name := range icons {
+		iconNames = append(iconNames, name)
+	}
+
+	sort.Strings(iconNames)
+
+	for _, name := range iconNames {
+		addFile("icon_" + name + ".ico", icons[name])
+	}
+
+	for _, res := range resources {
+		if bytes.HasPrefix(res.Data, []byte("MZ")) || bytes.HasPrefix(res.Data, []byte(elf.ELFMAG)) {
+			addFile(strings.ToLower(res.Type) + "_" + res.Name + ".bin", res.Data)
+		}
+	}
+
+	if len(files) == 0 {
+		content += " There are no icons or embedded executables to extract."
+	}
+
+	listing.WriteString("\n")
+	files = append([]*discordgo.File{{Name: bin.Name + ".resources.txt", ContentType: "text/plain", Reader: strings.NewReader(listing.String())}}, files...)
+
+	_, _ = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Content: content, Files: files})
+}
+
+// Lists the relocation entries of the user's ELF, optionally only the ones for symbols matching a filter
+func cmdReloc(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	relocs, err := bin.relocations()
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	filter := ""
+	if len(args) > 1 {
+		filter = strings.ToLower(args[1])
+	}
+
+	var listing strings.Builder
+	count := 0
+	section := ""
+
+	for _, reloc := range relocs {
+		if filter != "" && !strings.Contains(strings.ToLower(reloc.Symbol), filter) {
+			continue
+		}
+
+		if reloc.Section != section {
+			section = reloc.Section
+			listing.WriteString("\n" + section + ":\n")
+		}
+
+		target := reloc.Symbol
+		if reloc.HasAddend {
+			if target == "" {
+				target = fmt.Sprintf("0x%x", reloc.Addend)
+			} else if reloc.Addend != 0 {
+				target += fmt.Sprintf(" %+#x", reloc.Addend)
+			}
+		}
+
+		listing.WriteString(fmt.Sprintf("%016x  %-22s %s\n", reloc.Offset, reloc.Type, target))
+		count++
+	}
+
+	if count == 0 {
+		if filter != "" {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There are no relocations for symbols matching '" + args[1] + "' in " + bin.Name + ".")
+		} else {
+			_, _ = s.ChannelMessageSend(m.ChannelID, bin.Name + " has no relocations.")
+		}
+
+		return
+	}
+
+	content := "Found " + strconv.Itoa(count) + " relocations in " + bin.Name + ":"
+	sendListing(s, m.ChannelID, content, bin.Name + ".reloc.txt", strings.TrimPrefix(listing.String(), "\n"))
+}
+
+// Lists the tags of the user's ELF's dynamic section, with whether symbols are bound at load time
+func cmdDynamic(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	tags, err := bin.dynamicTags()
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	var listing strings.Builder
+
+	for _, tag := range tags {
+		listing.WriteString(fmt.Sprintf("%-16s %s\n", tag.Tag, tag.Value))
+	}
+
+	content := bin.Name + " has " + strconv.Itoa(len(tags)) + " dynamic tags, symbols are bound lazily:"
+	if elfBindNow(tags) {
+		content = bin.Name + " has " + strconv.Itoa(len(tags)) + " dynamic tags, symbols are bound at load time (BIND_NOW):"
+	}
+
+	sendListing(s, m.ChannelID, content, bin.Name + ".dynamic.txt", listing.String())
+}
+
+// Lists the libraries the user's binary needs, like ldd without loading it, and flags unusual ones
+func cmdDeps(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	deps, notes, err := bin.dependencies()
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	var listing strings.Builder
+
+	for _, dep := range deps {
+		line := fmt.Sprintf("%-28s %4d symbols", dep.Name, dep.Symbols)
+
+		if len(dep.Notes) > 0 {
+			line += "  ! " + strings.Join(dep.Notes, ", ")
+		}
+
+		listing.WriteString(line + "\n")
+	}
+
+	if len(notes) > 0 {
+		if len(deps) > 0 {
+			listing.WriteString("\n")
+		}
+
+		for _, note := range notes {
+			listing.WriteString("- " + note + "\n")
+		}
+	}
+
+	content := bin.Name + " needs " + strconv.Itoa(len(deps)) + " libraries:"
+	sendListing(s, m.ChannelID, content, bin.Name + ".deps.txt", listing.String())
+}
+
+// Joins lines for an embed field, which can't be longer than 1024 characters, or gives a placeholder if there are
+// none
+func embedLines(lines []string, none string) string {
+	if len(lines) == 0 {
+		return none
+	}
+
+	value := ""
+
+	for n, line := range lines {
+		if len(value) + len(line) > 1000 {
+			return value + "... and " + strconv.Itoa(len(lines) - n) + " more"
+		}
+
+		value += line + "\n"
+	}
+
+	return value
+}
+
+// Sums up the user's binary for a first look: its format, symbols, linking, entropy, packer hints, suspicious
+// sections and the code that runs before the entry point
+func cmdTriage(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	bin, err := sessionBinary(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	arch := bin.Arch
+	if arch == "" {
+		arch = "not supported by the disassembler"
+	}
+
+	kind := ""
+	if bin.elf != nil {
+		kind = strings.TrimPrefix(bin.elf.Type.String(), "ET_")
+	} else if bin.pe.Characteristics & pe.IMAGE_FILE_DLL != 0 {
+		kind = "DLL"
+	} else {
+		kind = "EXE"
+	}
+
+	var fields []embedField
+	fields = append(fields, embedField{
+		name:   "File",
+		value:  fmt.Sprintf("%s\n%s %s, %s (%s)\n0x%x bytes, entry 0x%x", bin.Name, bin.Format, kind, bin.Machine, arch, len(bin.Data), bin.Entry),
+		inline: false,
+	})
+
+	// PEs always have the entry symbol, so only the others count
+	symbols := 0
+	for _, sym := range bin.Symbols {
+		if bin.pe == nil || sym.Name != "entry" {
+			symbols++
+		}
+	}
+
+	symbolInfo := "Stripped, no symbol table"
+	if bin.elf != nil && bin.elf.SectionByType(elf.SHT_SYMTAB) != nil {
+		symbolInfo = strconv.Itoa(symbols) + " symbols"
+	} else if bin.pe != nil && symbols > 0 {
+		symbolInfo = strconv.Itoa(symbols) + " COFF symbols"
+	} else if bin.elf != nil && symbols > 0 {
+		symbolInfo = "Stripped, " + strconv.Itoa(symbols) + " dynamic symbols"
+	}
+
+	if bin.elf != nil && bin.elf.Section(".debug_info") != nil {
+		symbolInfo += ", has DWARF debug info"
+	}
+
+	if bin.pe != nil {
+		if pdb := bin.pdbPath(); pdb != "" {
+			symbolInfo += "\nPDB: `" + pdb + "`"
+		}
+	}
+
+	fields = append(fields, embedField{name: "Symbols", value: symbolInfo, inline: true})
+
+	deps, notes, err := bin.dependencies()
+	linking := ""
+
+	if err != nil {
+		linking = "Couldn't read the imports, " + err.Error()
+	} else if bin.elf != nil && len(deps) == 0 && bin.elf.SectionByType(elf.SHT_DYNAMIC) == nil {
+		linking = "Static"
+	} else {
+		imports := 0
+		for _, dep := range deps {
+			imports += dep.Symbols
+		}
+
+		linking = fmt.Sprintf("Dynamic, %d libraries and %d imports (see !deps)", len(deps), imports)
+	}
+
+	fields = append(fields, embedField{name: "Linking", value: linking, inline: true})
+	fields = append(fields, embedField{name: "Entropy", value: fmt.Sprintf("%.2f bits per byte", shannonEntropy(bin.Data)), inline: true})
+
+	hints := bin.packerHints()
+
+	// The import notes are about packing too, like a PE with almost no imports
+	for _, note := range notes {
+		if strings.Contains(note, "packed") {
+			hints = append(hints, note)
+		}
+	}
+
+	fields = append(fields, embedField{name: "Packer hints", value: embedLines(hints, "None found"), inline: false})
+
+	suspicious := bin.suspiciousSections()
+	fields = append(fields, embedField{name: "Suspicious sections", value: embedLines(suspicious, "None found"), inline: false})
+
+	if bin.pe != nil {
+		var callbacks []string
+
+		for _, callback := range bin.tlsCallbacks() {
+			callbacks = append(callbacks, fmt.Sprintf("0x%x", callback))
+		}
+
+		fields = append(fields, embedField{name: "TLS callbacks (run before the entry point)", value: embedLines(callbacks, "None"), inline: false})
+	} else {
+		fields = append(fields, embedField{name: "Constructors (run before main)", value: strconv.Itoa(bin.elfConstructors()), inline: false})
+	}
+
+	// Red when there's anything to look at first
+	color := 0x57D5FF
+	if len(hints) > 0 || len(suspicious) > 0 {
+		color = 0xE74C3C
+	}
+
+	discordSendEmbeddedMsg(s, m.ChannelID, fields, "Triage of " + bin.Name, color, "")
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FILETIME counts 100 nanosecond intervals from 1601, this is how many of them there are before 1970
+const filetimeUnixOffset = 116444736000000000
+
+// A way of reading a number as a timestamp, used by !time
+type timestampFormat struct {
+	name string
+
+	// Returns the time the value is in this format, ok is false if it can't be one
+	convert func(value uint64) (time.Time, bool)
+}
+
+// The formats !time tries, in the order they're shown
+var timestampFormats = []timestampFormat{
+	{"Unix seconds", func(value uint64) (time.Time, bool) {
+		return time.Unix(int64(value), 0).UTC(), value < 1 << 40
+	}},
+	{"Unix milliseconds", func(value uint64) (time.Time, bool) {
+		return time.Unix(int64(value / 1000), int64(value % 1000) * int64(time.Millisecond)).UTC(), value < 1 << 50
+	}},
+	{"Windows FILETIME", func(value uint64) (time.Time, bool) {
+		if value < filetimeUnixOffset || value > 1 << 62 {
+			return time.Time{}, false
+		}
+
+		value -= filetimeUnixOffset
+		return time.Unix(int64(value / 10000000), int64(value % 10000000) * 100).UTC(), true
+	}},
+	{"DOS date and time", func(value uint64) (time.Time, bool) {
+		// The date is the high word and the time the low word, seconds are stored halved
+		date, clock := value >> 16, value & 0xffff
+		year, month, day := int(date >> 9) + 1980, int(date >> 5 & 0xf), int(date & 0x1f)
+		hour, minute, second := int(clock >> 11), int(clock >> 5 & 0x3f), int(clock & 0x1f) * 2
+
+		if value > 0xffffffff || month < 1 || month > 12 || day < 1 || hour > 23 || minute > 59 || second > 59 {
+			return time.Time{}, false
+		}
+
+		t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+		return t, t.Day() == day
+	}},
+}
+
+// Timestamps outside these years are taken to be some other kind of number
+var (
+	earliestTimestamp = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	latestTimestamp   = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Describes how long ago (or how far ahead) a time is, roughly
+func relativeTime(t time.Time) string {
+	d := time.Since(t)
+	suffix := " ago"
+
+	if d < 0 {
+		d, suffix = -d, " from now"
+	}
+
+	amount, unit := int64(d / time.Minute), "minute"
+
+	switch {
+	case d >= 365 * 24 * time.Hour:
+		amount, unit = int64(d / (365 * 24 * time.Hour)), "year"
+	case d >= 24 * time.Hour:
+		amount, unit = int64(d / (24 * time.Hour)), "day"
+	case d >= time.Hour:
+		amount, unit = int64(d / time.Hour), "hour"
+	}
+
+	if amount != 1 {
+		unit += "s"
+	}
+
+	return strconv.FormatInt(amount, 10) + " " + unit + suffix
+}
+
+// Parses the value given to !time, a decimal or hex number, or bytes from a hex dump read as little endian
+func parseTimestampValue(args []string) (uint64, bool) {
+	if len(args) == 1 {
+		text := strings.ToLower(args[0])
+
+		// Hex without a 0x in front is only hex if it couldn't be decimal
+		if strings.ContainsAny(text, "abcdef") && !strings.HasPrefix(text, "0x") {
+			text = "0x" + text
+		}
+
+		value, err := strconv.ParseUint(text, 0, 64)
+		return value, err == nil
+	}
+
+	code, err := parseOpcodes(strings.Join(args, ""))
+
+	if err != nil || len(code) > 8 {
+		return 0, false
+	}
+
+	padded := make([]byte, 8)
+	copy(padded, code)
+
+	return binary.LittleEndian.Uint64(padded), true
+}
+
+// Converts a number to every timestamp format it could be in
+func cmdTime(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	value, ok := parseTimestampValue(args[1:])
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + strings.Join(args[1:], " ") + "' isn't a number I can read. Give a decimal or hex number, or up to 8 bytes from a hex dump.")
+		return
+	}
+
+	out := ""
+
+	for _, format := range timestampFormats {
+		t, ok := format.convert(value)
+
+		if !ok || t.Before(earliestTimestamp) || t.After(latestTimestamp) {
+			continue
+		}
+
+		out += padRight(format.name, " ", 19) + t.Format("2006-01-02 15:04:05") + " UTC (" + relativeTime(t) + ")\n"
+	}
+
+	if out == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + strconv.FormatUint(value, 10) + " (0x" + strconv.FormatUint(value, 16) + ") doesn't look like a Unix, FILETIME or DOS timestamp between 1980 and 2100.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, strconv.FormatUint(value, 10) + " (0x" + strconv.FormatUint(value, 16) + ") could be: ```\n" + out + "```")
+}
+
+// File types in the top bits of st_mode, with the character ls shows for them
+var fileTypeBits = map[uint64]string{0140000: "s", 0120000: "l", 0100000: "-", 060000: "b", 040000: "d", 020000: "c", 010000: "p"}
+
+// Names of the permission bits, as !perm describes a class's
+var permissionNames = []string{"read", "write", "execute"}
+
+// Parses a mode as octal ("4755", or a whole st_mode like "100644") or symbolic ("rwsr-xr-x", with or without the
+// file type in front)
+func parseMode(text string) (uint64, bool) {
+	text = strings.TrimPrefix(text, "0o")
+
+	if mode, err := strconv.ParseUint(text, 8, 32); err == nil {
+		return mode, mode <= 0177777
+	}
+
+	mode := uint64(0)
+
+	// A regular file's "-" is left out, so "-rwsr-xr-x" is 4755 like it's given to chmod
+	if len(text) == 10 {
+		found := text[0] == '-'
+
+		for bits, char := range fileTypeBits {
+			if text[:1] == char && char != "-" {
+				mode, found = bits, true
+			}
+		}
+
+		if !found {
+			return 0, false
+		}
+
+		text = text[1:]
+	}
+
+	if len(text) != 9 {
+		return 0, false
+	}
+
+	// setuid, setgid and sticky show as s or t in place of the class's x, in capitals if x isn't set
+	special := []string{"sS", "sS", "tT"}
+
+	for class := 0; class < 3; class++ {
+		triple := text[class * 3 : class * 3 + 3]
+		shift := uint(6 - class * 3)
+
+		for n, char := range "rw" {
+			if triple[n] == byte(char) {
+				mode |= 1 << (shift + uint(2 - n))
+			} else if triple[n] != '-' {
+				return 0, false
+			}
+		}
+
+		switch {
+		case triple[2] == 'x':
+			mode |= 1 << shift
+		case triple[2] == special[class][0]:
+			mode |= 1 << shift | 1 << uint(11 - class)
+		case triple[2] == special[class][1]:
+			mode |= 1 << uint(11 - class)
+		case triple[2] != '-':
+			return 0, false
+		}
+	}
+
+	return mode, true
+}
+
+// Formats a mode like ls -l does, i.e. "-rwsr-xr-x"
+func symbolicMode(mode uint64) string {
+	out := []byte("rwxrwxrwx")
+
+	for n := range out {
+		if mode & (1 << uint(8 - n)) == 0 {
+			out[n] = '-'
+		}
+	}
+
+	special := []struct {
+		bit  uint64
+		pos  int
+		char byte
+	}{{04000, 2, 's'}, {02000, 5, 's'}, {01000, 8, 't'}}
+
+	for _, sp := range special {
+		if mode & sp.bit == 0 {
+			continue
+		}
+
+		if out[sp.pos] == 'x' {
+			out[sp.pos] = sp.char
+		} else {
+			out[sp.pos] = sp.char - 'a' + 'A'
+		}
+	}
+
+	// Modes without a file type are shown as regular files
+	fileType, ok := fileTypeBits[mode &^ 07777]
+
+	if mode &^ 07777 == 0 {
+		fileType = "-"
+	} else if !ok {
+		fileType = "?"
+	}
+
+	return fileType + string(out)
+}
+
+// Converts between octal and symbolic file permissions, with what the special bits mean
+func cmdPerm(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	mode, ok := parseMode(args[1])
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + args[1] + "' isn't a mode I can read. Give it in octal (i.e. 4755) or like ls shows it (i.e. rwsr-xr-x).")
+		return
+	}
+
+	symbolic := symbolicMode(mode)
+	out := padLeft(strconv.FormatUint(mode, 8), "0", 4) + " = " + symbolic + "\n\n"
+	classes := []string{"owner", "group", "other"}
+	chmod := []string{}
+
+	for class, name := range classes {
+		bits := mode >> uint(6 - class * 3) & 7
+		var names []string
+		letters := ""
+
+		for n, permission := range permissionNames {
+			if bits & (4 >> uint(n)) != 0 {
+				names = append(names, permission)
+				letters += "rwx"[n : n + 1]
+			}
+		}
+
+		if len(names) == 0 {
+			names = []string{"nothing"}
+		}
+
+		out += padRight(name, " ", 7) + symbolic[1 + class * 3 : 4 + class * 3] + "  " + joinWords(names) + "\n"
+		chmod = append(chmod, "ugo"[class : class + 1] + "=" + letters)
+	}
+
+	for n, special := range []string{"u+s", "g+s", "+t"} {
+		if mode & (04000 >> uint(n)) != 0 {
+			chmod = append(chmod, special)
+		}
+	}
+
+	var notes []string
+
+	if mode & 04000 != 0 {
+		notes = append(notes, "setuid: runs with the privileges of the file's owner, not the user running it. A setuid root binary that can be made to run a shell or write files is a privilege escalation.")
+	}
+
+	if mode & 02000 != 0 {
+		notes = append(notes, "setgid: runs with the privileges of the file's group. On a directory, files created in it get the directory's group.")
+	}
+
+	if mode & 01000 != 0 {
+		notes = append(notes, "sticky: on a directory like /tmp, only a file's owner (or root) can delete or rename it.")
+	}
+
+	if mode & 02 != 0 {
+		notes = append(notes, "world writable: any user can change it, which is worth a look if something privileged runs or reads it.")
+	}
+
+	out += "\nchmod " + padLeft(strconv.FormatUint(mode & 07777, 8), "0", 3) + ", or chmod " + strings.Join(chmod, ",") + "\n"
+
+	if len(notes) > 0 {
+		out += "\n" + strings.Join(notes, "\n")
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "```\n" + out + "```")
+}
+
+// Named alignments !align takes in place of a number
+var namedAlignments = map[string]uint64{"page": 0x1000, "hugepage": 0x200000, "word": 4, "qword": 8, "stack": 16}
+
+// Shows where an address sits relative to an alignment, a page by default
+func cmdAlign(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	addr, ok := parseHexAddress(args[1])
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + args[1] + "' isn't a hex address.")
+		return
+	}
+
+	name := "page"
+	if len(args) > 2 {
+		name = strings.ToLower(args[2])
+	}
+
+	align, named := namedAlignments[name]
+
+	if !named {
+		var err error
+		align, err = strconv.ParseUint(name, 0, 64)
+
+		if err != nil || align == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + args[2] + "' isn't an alignment. Give a size like 16 or 0x1000, or page, hugepage, word, qword or stack.")
+			return
+		}
+	}
+
+	hex := func(value uint64) string {
+		return "0x" + strconv.FormatUint(value, 16)
+	}
+
+	offset := addr % align
+	base := addr - offset
+	out := padRight("address", " ", 14) + hex(addr) + "\n"
+	out += padRight("alignment", " ", 14) + hex(align) + " (" + strconv.FormatUint(align, 10) + " bytes)\n"
+
+	if align & (align - 1) == 0 {
+		out += padRight("mask", " ", 14) + "& ~" + hex(align - 1) + "\n"
+	}
+
+	out += padRight("base", " ", 14) + hex(base) + "\n"
+	out += padRight("offset", " ", 14) + hex(offset) + " (" + strconv.FormatUint(offset, 10) + ")\n"
+
+	if offset == 0 {
+		out += padRight("next aligned", " ", 14) + hex(addr) + ", it's already aligned\n"
+	} else {
+		out += padRight("next aligned", " ", 14) + hex(base + align) + " (+" + hex(align - offset) + ")\n"
+	}
+
+	if name == "page" || name == "hugepage" {
+		out += "\nmprotect() and mmap() take " + hex(base) + ", the start of the page"
+		if name == "page" {
+			out += ", the 2MB huge page it's in starts at " + hex(addr &^ 0x1fffff)
+		}
+		out += "\n"
+	}
+
+	// A stack 8 bytes off 16 is what makes movaps crash in system(), usually after a ROP chain
+	if align == 16 && offset == 8 {
+		out += "\nIt's 8 bytes off 16, which is where rsp is right after a call. If it's rsp at a call, functions using SSE (like system()) crash on movaps: add a ret gadget to the chain to realign it.\n"
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "```\n" + out + "```")
+}
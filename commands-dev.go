@@ -118,6 +118,21 @@ func cmdUptime(params cmdArguments) {
 	discordSendEmbeddedMsg(s, m.ChannelID, embedFields, "", 0x00BFFF, "https://i.imgur.com/2yCS7A7.png")
 }
 
+// Reloads config.ini without restarting the bot
+func cmdReload(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	if err := reloadAll(); err != nil {
+		fmt.Println("[ERROR] Failed to reload config.ini, " + err.Error())
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to reload config.ini: " + err.Error())
+		return
+	}
+
+	fmt.Println("[INFO] Configuration reloaded.")
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Configuration reloaded!")
+}
+
 // Restarts the bot.
 func cmdRestart(params cmdArguments) {
 	var embedFields []embedField
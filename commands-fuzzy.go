@@ -0,0 +1,150 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/i509VCB/REBot/pkg/fuzzyhash"
+)
+
+// Matches fuzzy hashes given as arguments
+var (
+	ssdeepHashRegexp = regexp.MustCompile(`^\d+:[A-Za-z0-9+/]*:[A-Za-z0-9+/]*$`)
+	tlshHashRegexp   = regexp.MustCompile(`^(?i)(T1)?[0-9a-f]{70}$`)
+)
+
+// A file or hash to compare, with the hashes that could be worked out for it
+type fuzzyInput struct {
+	Name   string
+	SSDeep string
+	TLSH   string
+}
+
+// Hashes a file. TLSH needs at least 50 bytes with some variety, so it's left empty for files that don't have that.
+func hashFile(name string, data []byte) fuzzyInput {
+	input := fuzzyInput{Name: name}
+	input.SSDeep, _ = fuzzyhash.SSDeep(data)
+	input.TLSH, _ = fuzzyhash.TLSH(data)
+
+	return input
+}
+
+// Hashes the message's attachments, or the user's binary if there aren't any
+func fuzzyAttachments(m *discordgo.MessageCreate) ([]fuzzyInput, error) {
+	var inputs []fuzzyInput
+
+	for _, attachment := range m.Attachments {
+		data, err := downloadAttachment(attachment)
+
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, hashFile(attachment.Filename, data))
+	}
+
+	return inputs, nil
+}
+
+// Computes the ssdeep and TLSH hashes of attachments, or of the user's binary
+func cmdFuzzyHash(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	inputs, err := fuzzyAttachments(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, couldn't download the attachment, " + err.Error() + ".")
+		return
+	}
+
+	if len(inputs) == 0 {
+		bin, ok := lastSessionBinary(m.Author.ID)
+
+		if !ok {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Attach the files to hash.")
+			return
+		}
+
+		inputs = append(inputs, hashFile(bin.Name, bin.Data))
+	}
+
+	out := ""
+
+	for _, input := range inputs {
+		tlsh := input.TLSH
+		if tlsh == "" {
+			tlsh = "(the file is too short or uniform, TLSH needs at least 50 varied bytes)"
+		}
+
+		out += input.Name + ":\nssdeep: " + input.SSDeep + "\nTLSH:   " + tlsh + "\n\n"
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "```" + strings.TrimSpace(out) + "```")
+}
+
+// Compares two files or fuzzy hashes, given as attachments or arguments. With only one, it's compared to the
+// user's binary.
+func cmdFuzzyCmp(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	inputs, err := fuzzyAttachments(m)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, couldn't download the attachment, " + err.Error() + ".")
+		return
+	}
+
+	for _, arg := range args[1:] {
+		switch {
+		case ssdeepHashRegexp.MatchString(arg):
+			inputs = append(inputs, fuzzyInput{Name: "hash " + strconv.Itoa(len(inputs) + 1), SSDeep: arg})
+		case tlshHashRegexp.MatchString(arg):
+			inputs = append(inputs, fuzzyInput{Name: "hash " + strconv.Itoa(len(inputs) + 1), TLSH: arg})
+		default:
+			_, _ = s.ChannelMessageSend(m.ChannelID, "'" + arg + "' isn't an ssdeep or TLSH hash.")
+			return
+		}
+	}
+
+	if len(inputs) == 1 {
+		if bin, ok := lastSessionBinary(m.Author.ID); ok {
+			inputs = append([]fuzzyInput{hashFile(bin.Name, bin.Data)}, inputs...)
+		}
+	}
+
+	if len(inputs) != 2 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Give two files or hashes to compare, i.e. attach two files, or one and its hash.")
+		return
+	}
+
+	a, b := inputs[0], inputs[1]
+	out := ""
+
+	if a.SSDeep != "" && b.SSDeep != "" {
+		score, err := fuzzyhash.SSDeepCompare(a.SSDeep, b.SSDeep)
+
+		if err == nil {
+			out += "ssdeep: " + strconv.Itoa(score) + "% similar\n"
+		}
+	}
+
+	if a.TLSH != "" && b.TLSH != "" {
+		diff, err := fuzzyhash.TLSHDiff(a.TLSH, b.TLSH)
+
+		if err == nil {
+			out += "TLSH:   distance " + strconv.Itoa(diff) + " (0 is the same, under 100 is usually related)\n"
+		}
+	}
+
+	if out == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "There's no hash both " + a.Name + " and " + b.Name + " have to compare.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, a.Name + " and " + b.Name + ": ```" + out + "```")
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A chapter or section of a manual, from the search index in manuals/index/<arch>.json
+type manualSection struct {
+	Section string `json:"section"`
+	Title   string `json:"title"`
+
+	// Page in the PDF, zero if the index was written by hand rather than built from the PDF's bookmarks
+	Page int `json:"page,omitempty"`
+}
+
+// A manual that !manual links to, from manuals/manuals.json
+type manual struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Title   string   `json:"title"`
+	URL     string   `json:"url"`
+
+	// Manuals split into volumes, like the Intel SDM, list them here so they can be asked for by name
+	Documents []manualDocument `json:"documents,omitempty"`
+
+	// Common topics and the section of a document that covers them, i.e. "paging"
+	Topics []manualTopic `json:"topics,omitempty"`
+}
+
+// One volume or companion document of a manual
+type manualDocument struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Title   string   `json:"title"`
+	URL     string   `json:"url"`
+}
+
+// A topic and where it's covered
+type manualTopic struct {
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases"`
+	Document string   `json:"document"`
+	Section  string   `json:"section"`
+}
+
+// Returns the manual's document with the given name or alias
+func (man manual) document(name string) (manualDocument, bool) {
+	for _, doc := range man.Documents {
+		if doc.Name == name || StrList(doc.Aliases).contains(name) {
+			return doc, true
+		}
+	}
+
+	return manualDocument{}, false
+}
+
+// Returns the names of the manual's documents
+func (man manual) documentNames() []string {
+	var names []string
+
+	for _, doc := range man.Documents {
+		names = append(names, doc.Name)
+	}
+
+	return names
+}
+
+// Returns the manual's topic with the given name or alias
+func (man manual) topic(name string) (manualTopic, bool) {
+	for _, topic := range man.Topics {
+		if topic.Name == name || StrList(topic.Aliases).contains(name) {
+			return topic, true
+		}
+	}
+
+	return manualTopic{}, false
+}
+
+// Loaded manuals and their search indexes, by manual name
+var (
+	manuals     []manual
+	manualIndex = make(map[string][]manualSection)
+	manualLock  sync.RWMutex
+)
+
+// Returns the manual for the given architecture name or alias
+func findManual(arch string) (manual, bool) {
+	manualLock.RLock()
+	defer manualLock.RUnlock()
+
+	for _, man := range manuals {
+		if man.Name == arch || StrList(man.Aliases).contains(arch) {
+			return man, true
+		}
+	}
+
+	return manual{}, false
+}
+
+// Lists the architectures !manual supports, for error messages
+func supportedArchsManual() string {
+	manualLock.RLock()
+	defer manualLock.RUnlock()
+
+	var names []string
+
+	for _, man := range manuals {
+		names = append(names, strings.Join(append([]string{man.Name}, man.Aliases...), "/"))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Returns the link to the manual for the given architecture. Guilds can override the link with
+// "!settings manual", the scope is empty outside of Discord.
+func manualURL(scope string, arch string) (string, bool) {
+	man, ok := findManual(arch)
+
+	if !ok {
+		return "", false
+	}
+
+	if override, ok := getGuildSettings(scope).ManualURLs[man.Name]; ok && scope != "" {
+		return override, true
+	}
+
+	if man.URL == "" {
+		return "", true
+	}
+
+	return mirroredURL(man.Name, man.URL), true
+}
+
+// Returns the name a manual's search index is stored under
+func manualName(arch string) string {
+	if man, ok := findManual(arch); ok {
+		return man.Name
+	}
+
+	return arch
+}
+
+// Loads the manuals and their search indexes, a manual without an index just can't be searched
+func loadManuals() {
+	data, err := ioutil.ReadFile(filepath.Join("manuals", "manuals.json"))
+	if err != nil {
+		fmt.Println("[ERROR] Failed to load manuals, " + err.Error())
+		return
+	}
+
+	var list []manual
+	if err := json.Unmarshal(data, &list); err != nil {
+		fmt.Println("[ERROR] Failed to load manuals, " + err.Error())
+		return
+	}
+
+	index := make(map[string][]manualSection)
+
+	paths, err := filepath.Glob(filepath.Join("manuals", "index", "*.json"))
+	if err != nil {
+		fmt.Println("[ERROR] Failed to load manual indexes, " + err.Error())
+		return
+	}
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Println("[ERROR] Failed to load manual index " + path + ", " + err.Error())
+			continue
+		}
+
+		var sections []manualSection
+		if err := json.Unmarshal(data, &sections); err != nil {
+			fmt.Println("[ERROR] Failed to load manual index " + path + ", " + err.Error())
+			continue
+		}
+
+		index[strings.TrimSuffix(filepath.Base(path), ".json")] = sections
+	}
+
+	manualLock.Lock()
+	manuals = list
+	manualIndex = index
+	manualLock.Unlock()
+}
+
+// Finds the sections of a manual whose titles contain every term
+func searchManual(name string, terms []string) ([]manualSection, bool) {
+	manualLock.RLock()
+	defer manualLock.RUnlock()
+
+	sections, ok := manualIndex[name]
+	if !ok {
+		return nil, false
+	}
+
+	var found []manualSection
+
+	for _, section := range sections {
+		title := strings.ToLower(section.Section + " " + section.Title)
+		matches := true
+
+		for _, term := range terms {
+			if !strings.Contains(title, strings.ToLower(term)) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			found = append(found, section)
+		}
+	}
+
+	return found, true
+}
+
+// Builds the reply to "manual search [architecture] [terms ...]"
+func manualSearchReply(scope string, arch string, terms []string) (string, error) {
+	arch = strings.ToLower(arch)
+	manualLink, ok := manualURL(scope, arch)
+
+	if !ok {
+		return "", errors.New("Architecture not supported! Supported architectures: ```" + supportedArchsManual() + "```")
+	}
+
+	out := ""
+
+	// A single term might be an instruction, which has a better reference than the manual's chapter on it
+	if len(terms) == 1 {
+		if link, ok := instructionURL(arch, terms[0]); ok {
+			out += "Instruction reference: " + link + "\n"
+		}
+	}
+
+	found, ok := searchManual(manualName(arch), terms)
+
+	if !ok && out == "" {
+		return "", errors.New("The " + arch + " manual hasn't been indexed for searching yet, here's the full manual: " + manualLink)
+	}
+
+	for i, section := range found {
+		if i == 5 {
+			out += "... and " + strconv.Itoa(len(found) - i) + " more, try adding more terms\n"
+			break
+		}
+
+		out += "**" + section.Section + "** " + section.Title
+
+		if section.Page > 0 {
+			out += " - page " + strconv.Itoa(section.Page) + ": <" + manualLink + "#page=" + strconv.Itoa(section.Page) + ">"
+		}
+
+		out += "\n"
+	}
+
+	if out == "" {
+		return "", errors.New("Nothing in the " + arch + " manual matched your search.")
+	}
+
+	return out + "Manual: <" + manualLink + ">", nil
+}
+
+// Instruction mnemonics that can be looked up, i.e. "cmpxchg16b" or "ld1.8b"
+var mnemonicRegexp = regexp.MustCompile(`^[a-z][a-z0-9.]{0,23}$`)
+
+// x86 condition code suffixes, felixcloutier.com groups instructions like "jne" under one page per family
+var x86ConditionCodes = StrList{"a", "ae", "b", "be", "c", "e", "g", "ge", "l", "le", "na", "nae", "nb", "nbe", "nc", "ne",
+	"ng", "nge", "nl", "nle", "no", "np", "ns", "nz", "o", "p", "pe", "po", "s", "z"}
+
+// x86 instructions that share a page on felixcloutier.com with other mnemonics
+var x86SharedPages = map[string]string{
+	"loop": "loop:loopcc", "loope": "loop:loopcc", "loopne": "loop:loopcc", "loopz": "loop:loopcc", "loopnz": "loop:loopcc",
+	"rep": "rep:repe:repz:repne:repnz", "repe": "rep:repe:repz:repne:repnz", "repz": "rep:repe:repz:repne:repnz",
+	"repne": "rep:repe:repz:repne:repnz", "repnz": "rep:repe:repz:repne:repnz",
+	"jcxz": "jcc", "jecxz": "jcc", "jrcxz": "jcc",
+}
+
+// Returns the felixcloutier.com page name for an x86 mnemonic
+func x86ReferencePage(mnemonic string) string {
+	if page, ok := x86SharedPages[mnemonic]; ok {
+		return page
+	}
+
+	for _, family := range []string{"cmov", "set", "fcmov", "j"} {
+		if strings.HasPrefix(mnemonic, family) && x86ConditionCodes.contains(strings.TrimPrefix(mnemonic, family)) {
+			return family + "cc"
+		}
+	}
+
+	return mnemonic
+}
+
+// Returns a link to the reference page of a single instruction, only x86 and ARM have per-instruction references
+func instructionURL(arch string, mnemonic string) (string, bool) {
+	mnemonic = strings.ToLower(mnemonic)
+
+	if !mnemonicRegexp.MatchString(mnemonic) {
+		return "", false
+	}
+
+	switch manualName(arch) {
+	case "x86":
+		return "https://www.felixcloutier.com/x86/" + x86ReferencePage(mnemonic), true
+	case "arm", "armv7", "arm-r", "arm-m", "armv7-m", "armv6-m":
+		// ARM's pages are titled by encoding rather than mnemonic, so the closest stable link is a search
+		return "https://developer.arm.com/search#q=" + url.QueryEscape(strings.ToUpper(mnemonic)) + "&f-navigationhierarchiescontenttype=Reference", true
+	}
+
+	return "", false
+}
+
+// Builds the reply to "manual [architecture] {instruction}" or "manual search [architecture] [terms ...]",
+// shared by the Discord command and text frontends
+func manualReply(scope string, args []string) (string, error) {
+	if strings.ToLower(args[0]) == "search" {
+		if len(args) < 3 {
+			return "", errors.New("Usage: " + CommandPrefix + "manual search [architecture] [terms ...]")
+		}
+
+		return manualSearchReply(scope, args[1], args[2:])
+	}
+
+	arch := strings.ToLower(args[0])
+	manualLink, ok := manualURL(scope, arch)
+
+	if !ok {
+		return "", errors.New("Architecture not supported! Supported architectures: ```" + supportedArchsManual() + "```")
+	}
+
+	man, _ := findManual(arch)
+
+	if len(args) < 2 {
+		// Collections like "abi" have no single document to link, only their documents
+		if manualLink == "" {
+			return "Which one? Try one of: " + strings.Join(man.documentNames(), ", "), nil
+		}
+
+		return "Here you go: " + manualLink, nil
+	}
+
+	// Volumes and topics come before instructions, so "!manual x86 paging" isn't looked up as a mnemonic
+	query := strings.ToLower(strings.Join(args[1:], " "))
+
+	if doc, ok := man.document(query); ok {
+		return "Here's " + man.Title + ", " + doc.Title + ": " + mirroredURL(man.Name + "-" + doc.Name, doc.URL), nil
+	}
+
+	if topic, ok := man.topic(query); ok {
+		if doc, ok := man.document(topic.Document); ok {
+			return "**" + topic.Name + "** is covered in " + doc.Title + ", " + topic.Section + ": " + mirroredURL(man.Name + "-" + doc.Name, doc.URL), nil
+		}
+	}
+
+	if link, ok := instructionURL(arch, args[1]); ok {
+		return "Here's the reference for `" + strings.ToLower(args[1]) + "`: " + link, nil
+	}
+
+	if len(man.Documents) > 0 || len(man.Topics) > 0 {
+		names := man.documentNames()
+
+		for _, topic := range man.Topics {
+			names = append(names, topic.Name)
+		}
+
+		reply := "I don't know '" + query + "', try one of: " + strings.Join(names, ", ") + "."
+
+		if manualLink != "" {
+			reply += " Here's the full manual: " + manualLink
+		}
+
+		return reply, nil
+	}
+
+	return "There's no per-instruction reference for " + arch + ", here's the full manual: " + manualLink, nil
+}
+
+// Gives a PDF link to the manual for the given architecture, or the reference page for one of its instructions
+func cmdManual(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	reply, err := manualReply(guildScope(m), args[1:])
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, err.Error())
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, reply)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Most bytes a generated YARA rule matches, longer strings make slow rules
+const maxYaraBytes = 1024
+
+// YARA rule names are identifiers
+var yaraNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+// Wildcards the operand bytes of instructions in a pattern taken from the binary at the file offset. Addresses
+// (branch targets and RIP-relative or absolute operands) change with relocations and recompiles, so "mask" wildcards
+// those, and "maskall" wildcards every immediate and displacement too.
+func maskOperands(bin *binaryFile, pattern bytePattern, offset uint64, all bool) {
+	section, ok := bin.sectionAtOffset(offset)
+
+	if !ok || !section.Exec || bin.Arch == "" {
+		return
+	}
+
+	addr := section.Addr + offset - section.Offset
+	ins, _ := linearSweep(bin.Arch, pattern.Bytes, addr, maxObjdumpInstructions)
+	x86 := bin.Arch == "x86" || bin.Arch == "x64"
+
+	for _, i := range ins {
+		start := int(i.Address - addr)
+		size := len(i.Bytes)
+
+		if i.Mnemonic == "(bad)" || !operandHexRegexp.MatchString(i.OpStr) {
+			continue
+		}
+
+		// Small numbers are usually constants and offsets into structures, rather than addresses
+		isAddress := ripRelativeRegexp.MatchString(i.OpStr) || bin.referenceKind(i) != "data"
+		for _, target := range instructionTargets(i) {
+			if target >= 0x1000 {
+				isAddress = true
+			}
+		}
+
+		if !isAddress && !all {
+			continue
+		}
+
+		// x86 operands are the last bytes of the instruction, only 32-bit ones are masked since 8-bit relative jumps
+		// don't change. Fixed width instructions keep the opcode in their most significant byte.
+		from, to := start + 1, start + size
+
+		if x86 {
+			if size < 5 {
+				continue
+			}
+
+			from = start + size - 4
+		} else if bin.byteOrder() == binary.LittleEndian {
+			from, to = start, start + size - 1
+		}
+
+		for n := from; n < to && n < len(pattern.Mask); n++ {
+			pattern.Mask[n] = false
+		}
+	}
+}
+
+// Formats a YARA rule matching the pattern. Rules for bytes from a binary also check its file format's magic.
+func formatYaraRule(name string, pattern bytePattern, source string, format string) string {
+	condition := "$code"
+
+	switch format {
+	case "ELF":
+		condition = "uint32(0) == 0x464C457F and $code"
+	case "PE":
+		condition = "uint16(0) == 0x5A4D and $code"
+	}
+
+	// Long strings are wrapped, 16 bytes to a line like a hexdump
+	tokens := strings.Fields(pattern.String())
+	var lines []string
+
+	for n := 0; n < len(tokens); n += 16 {
+		end := n + 16
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+
+		lines = append(lines, strings.Join(tokens[n:end], " "))
+	}
+
+	return "rule " + name + "\n{\n" +
+		"    meta:\n" +
+		"        description = \"Generated by REBot from " + source + "\"\n" +
+		"        date = \"" + time.Now().UTC().Format("2006-01-02") + "\"\n" +
+		"    strings:\n" +
+		"        $code = {\n            " + strings.Join(lines, "\n            ") + "\n        }\n" +
+		"    condition:\n" +
+		"        " + condition + "\n}\n"
+}
+
+// Generates a YARA rule from hex bytes, or from a range of the user's binary with its addresses optionally masked
+func cmdYaraGen(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	name := args[1]
+
+	if !yaraNameRegexp.MatchString(name) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Rule names can only contain letters, numbers and '_', and can't start with a number.")
+		return
+	}
+
+	var pattern bytePattern
+	var source, format string
+	rest := args[2:]
+
+	if bounds := strings.Split(rest[0], ","); len(bounds) == 2 {
+		bin, err := sessionBinary(m)
+
+		if err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+			return
+		}
+
+		offset, err := strconv.ParseUint(bounds[0], 0, 64)
+		length, lenErr := strconv.ParseUint(bounds[1], 0, 64)
+
+		if err != nil || lenErr != nil || length == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "The offset and length have to be numbers, i.e. `!yaragen my_rule 0x1234,32 mask`.")
+			return
+		}
+
+		if !checkLimit(s, m.ChannelID, "rule bytes", int(length), maxYaraBytes) {
+			return
+		}
+
+		if offset + length > uint64(len(bin.Data)) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("The bytes run past the end of %s, which is 0x%x bytes.", bin.Name, len(bin.Data)))
+			return
+		}
+
+		pattern = bytePattern{append([]byte{}, bin.Data[offset:offset + length]...), make([]bool, length)}
+		for n := range pattern.Mask {
+			pattern.Mask[n] = true
+		}
+
+		if len(rest) > 1 && (rest[1] == "mask" || rest[1] == "maskall") {
+			maskOperands(bin, pattern, offset, rest[1] == "maskall")
+		}
+
+		if !strings.ContainsAny(strings.Replace(pattern.String(), "??", "", -1), "0123456789ABCDEF") {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Every byte was masked, pick bytes with more than just operands in them.")
+			return
+		}
+
+		source = fmt.Sprintf("0x%x bytes at offset 0x%x of %s", length, offset, bin.Name)
+		format = bin.Format
+	} else {
+		var err error
+		pattern, err = parseBytePattern(rest)
+
+		if err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ". Give the bytes as hex with ?? wildcards, or as an offset and length in your binary, i.e. `!yaragen my_rule 0x1234,32`.")
+			return
+		}
+
+		if !checkLimit(s, m.ChannelID, "rule bytes", len(pattern.Bytes), maxYaraBytes) {
+			return
+		}
+
+		source = "hex bytes"
+	}
+
+	rule := formatYaraRule(name, pattern, source, format)
+	sendListing(s, m.ChannelID, "Here's your rule:", name + ".yar", rule)
+}
@@ -1,12 +1,15 @@
 package main
 
 import(
+	"strings"
+	"sync/atomic"
+
 	"github.com/bwmarrin/discordgo"
 )
 
 // Packs command arguments into one struct to avoid unused argument warnings
 type cmdArguments struct {
-	s 	 *discordgo.Session
+	s 	 Responder
 	m 	 *discordgo.MessageCreate
 	args []string
 }
@@ -28,10 +31,16 @@ type Command struct {
 var commandMap map[string]Command
 
 // Command handler; parses the name and passes the arguments on to the correct handler
-func command(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cmd string) {
+func command(s Responder, m *discordgo.MessageCreate, args []string, cmd string) {
 	var command Command
 	var ok bool
 
+	// Guild aliases are expanded before routing, so "!dis 90" can become "!disassemble x64 90"
+	if _, ok = commandMap[cmd]; !ok {
+		args = expandAlias(guildScope(m), args)
+		cmd = args[0]
+	}
+
 	// If we can't find the command, look for an alias
 	if command, ok = commandMap[cmd]; !ok {
 		foundCmd := false
@@ -54,14 +63,92 @@ func command(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cm
 		return
 	}
 
+	// Blocked users and guilds, and users that are spamming, don't get to run anything or get any reply
+	if !checkBlocklist(s, m, command) {
+		return
+	}
+
+	// Guild admins can keep commands to their own channels
+	if channels, ok := channelAllowed(m, command); !ok {
+		var mentions []string
+
+		for _, channel := range channels {
+			mentions = append(mentions, "<#" + channel + ">")
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, CommandPrefix + command.name + " can only be used in " + joinWords(mentions) + ".")
+		return
+	}
+
+	// A command sent as a reply can take its input from the message it replies to
+	m, args = replyInput(m, command, args)
+
+	// Expand saved snippets and function references before the argument count is checked, since they can expand into
+	// several arguments
+	rawArgs := args
+	args, err := expandSnippets(guildScope(m), args)
+
+	if err == nil {
+		args, err = expandFunctionRefs(m.Author.ID, args)
+	}
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, err.Error())
+		recordFailure(s, m.Author.ID)
+		return
+	}
+
 	// Ensure the required argument count is met
-	if len(args) < command.requiredArgs {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: !" + command.name + " " + command.usage)
+	if len(args) < requiredArgCount(m.Author.ID, command, args) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + command.name + " " + command.usage)
+		recordFailure(s, m.Author.ID)
+		return
+	}
+
+	// The same command again within a few seconds is pointed at the first answer instead of being run twice
+	s, ok = checkDuplicate(s, m, command, args)
+
+	if !ok {
+		return
+	}
+
+	// Remember the command as it was given, so it can be re-run with !last or !redo
+	addHistory(m.Author.ID, command, rawArgs)
+
+	// Attachments over the size limit are rejected before any handler gets to download them
+	for _, attachment := range m.Attachments {
+		if !checkLimit(s, m.ChannelID, "attachment bytes", attachment.Size, MaxAttachmentBytes) {
+			return
+		}
+	}
+
+	// All good, log and call handler
+	auditCommand(s, m, command, args)
+	atomic.AddUint64(&commandCount, 1)
+
+	if heavyCommands.contains(command.name) {
+		runJob(s, m, command, args)
 		return
 	}
 
-	// All good, call handler
-	command.handler(cmdArguments{s, m, args})
+	runCached(s, m, command, args)
+}
+
+// Splits a message into the command and its arguments, on spaces. The first line, up to any code block, is split on
+// any whitespace, so "!asm x64" can go on a line of its own. Newlines after it are kept in the arguments, so the
+// lines of a listing stay apart, and a code block is left to the command to take apart.
+func splitCommandArgs(cmd string) []string {
+	end := strings.Index(cmd, "\n")
+
+	if fence := strings.Index(cmd, "```"); fence >= 0 && (end < 0 || fence < end) {
+		end = fence
+	}
+
+	if end < 0 {
+		return strings.Split(cmd, " ")
+	}
+
+	return append(strings.Fields(cmd[:end]), strings.Split(cmd[end:], " ")...)
 }
 
 // Search for an alias
@@ -95,11 +182,256 @@ func buildCommandMap() {
 		cmdDisassemble,
 		false)
 
-	addCommand("cve",
+	addCommand("disas-modes",
+		[]string{"modes"},
+		2,
+		"{opcodes ...}",
+		cmdDisasModes,
+		false)
+
+	addCommand("explain",
+		[]string{"ex"},
+		3,
+		"[architecture] {opcodes|instructions ...}",
+		cmdExplain,
+		false)
+
+	addCommand("pseudo",
+		[]string{"lift"},
+		3,
+		"[architecture] {opcodes ...}",
+		cmdPseudo,
+		false)
+
+	addCommand("stackframe",
+		[]string{"frame"},
+		3,
+		"[architecture] {opcodes ...}",
+		cmdStackframe,
+		false)
+
+	addCommand("encoding",
+		[]string{"enc"},
+		3,
+		"[architecture] {opcodes ...}",
+		cmdEncoding,
+		false)
+
+	addCommand("armimm",
+		[]string{"imm"},
+		2,
+		"[value]",
+		cmdArmimm,
+		false)
+
+	addCommand("reljmp",
+		[]string{"branch"},
+		3,
+		"[architecture] [from] [to]",
+		cmdReljmp,
+		false)
+
+	addCommand("prefs",
+		[]string{"preferences"},
+		0,
+		"[arch|syntax|format|reset] {value}",
+		cmdPrefs,
+		false)
+
+	addCommand("save",
+		[]string{},
+		3,
+		"[name] {content ...}",
+		cmdSave,
+		false)
+
+	addCommand("get",
+		[]string{},
+		2,
+		"[name]",
+		cmdGet,
+		false)
+
+	addCommand("list",
+		[]string{"snippets"},
+		0,
+		"",
+		cmdList,
+		false)
+
+	addCommand("last",
+		[]string{},
+		0,
+		"",
+		cmdLast,
+		false)
+
+	addCommand("redo",
+		[]string{},
+		2,
+		"[n] {overrides ...}",
+		cmdRedo,
+		false)
+
+	addCommand("history",
+		[]string{},
+		0,
+		"",
+		cmdHistory,
+		false)
+
+	addCommand("cancel",
+		[]string{},
+		2,
+		"[job id]",
+		cmdCancel,
+		false)
+
+	addCommand("settings",
 		[]string{},
 		2,
-		"[CVE Identifier]",
-		cmdCve,
+		"[aliases|alias|unalias|audit] {arguments ...}",
+		cmdSettings,
+		false)
+
+	addCommand("appeal",
+		[]string{},
+		2,
+		"{message ...}",
+		cmdAppeal,
+		false)
+
+	addCommand("objdump",
+		[]string{},
+		1,
+		"{attachment}",
+		cmdObjdump,
+		false)
+
+	addCommand("funcs",
+		[]string{"functions"},
+		1,
+		"{attachment}",
+		cmdFuncs,
+		false)
+
+	addCommand("xref",
+		[]string{"xrefs"},
+		2,
+		"[address|function] {attachment}",
+		cmdXref,
+		false)
+
+	addCommand("hexdump",
+		[]string{"hd", "xxd"},
+		1,
+		"{offset} {length} {attachment}, or {hex|base64 ...}",
+		cmdHexdump,
+		false)
+
+	addCommand("patch",
+		[]string{},
+		3,
+		"[offset] [bytes ...] {attachment}",
+		cmdPatch,
+		false)
+
+	addCommand("patchasm",
+		[]string{},
+		3,
+		"[offset] {pad} [instructions ...] {attachment}",
+		cmdPatchAsm,
+		false)
+
+	addCommand("scan",
+		[]string{},
+		2,
+		"[pattern ...] {attachment}",
+		cmdScan,
+		false)
+
+	addCommand("yaragen",
+		[]string{"yara"},
+		3,
+		"[name] [bytes ...|offset,length] {mask|maskall}",
+		cmdYaraGen,
+		false)
+
+	addCommand("fuzzyhash",
+		[]string{"ssdeep", "tlsh"},
+		1,
+		"{attachments ...}",
+		cmdFuzzyHash,
+		false)
+
+	addCommand("fuzzycmp",
+		[]string{},
+		1,
+		"{hashes ...} {attachments ...}",
+		cmdFuzzyCmp,
+		false)
+
+	addCommand("peres",
+		[]string{"resources"},
+		1,
+		"{extract} {attachment}",
+		cmdPeRes,
+		false)
+
+	addCommand("reloc",
+		[]string{"relocs", "relocations"},
+		1,
+		"{symbol filter} {attachment}",
+		cmdReloc,
+		false)
+
+	addCommand("dynamic",
+		[]string{"dyn"},
+		1,
+		"{attachment}",
+		cmdDynamic,
+		false)
+
+	addCommand("deps",
+		[]string{"ldd", "imports"},
+		1,
+		"{attachment}",
+		cmdDeps,
+		false)
+
+	addCommand("triage",
+		[]string{},
+		1,
+		"{attachment}",
+		cmdTriage,
+		false)
+
+	addCommand("quiz",
+		[]string{},
+		1,
+		"{architecture} {easy|medium|hard|scores|skip}",
+		cmdQuiz,
+		false)
+
+	addCommand("challenge",
+		[]string{"challenges"},
+		1,
+		"{name|list|scores}",
+		cmdChallenge,
+		false)
+
+	addCommand("flag",
+		[]string{},
+		2,
+		"{challenge} [flag]",
+		cmdFlag,
+		false)
+
+	addCommand("leaderboard",
+		[]string{"lb", "points"},
+		1,
+		"{all|seasons|reset}",
+		cmdLeaderboard,
 		false)
 
 	addCommand("info",
@@ -110,26 +442,103 @@ func buildCommandMap() {
 		false)
 
 	addCommand("manual",
-		[]string{},
+		[]string{"ref"},
 		2,
-		"[architecture]",
+		"[architecture] {instruction|volume|topic}",
 		cmdManual,
 		false)
 
 	addCommand("retrick",
 		[]string{},
 		0,
-		"",
+		"{category}",
 		cmdReTrick,
 		false)
 
 	addCommand("exploittrick",
 		[]string{"expltrick"},
 		0,
-		"",
+		"{category}",
 		cmdExploitTrick,
 		false)
 
+	addCommand("trick",
+		[]string{},
+		2,
+		"[id|submit|search|queue|approve|reject|sync] {arguments ...}",
+		cmdTrick,
+		false)
+
+	addCommand("time",
+		[]string{"timestamp"},
+		2,
+		"[value|bytes ...]",
+		cmdTime,
+		false)
+
+	addCommand("perm",
+		[]string{"chmod"},
+		2,
+		"[octal|rwx]",
+		cmdPerm,
+		false)
+
+	addCommand("align",
+		[]string{"page"},
+		2,
+		"[address] {page|size}",
+		cmdAlign,
+		false)
+
+	addCommand("fmtstr",
+		[]string{"fmt"},
+		4,
+		"[address] [value] [offset] {printed=n} {hhn|hn} {x86|x64}",
+		cmdFmtstr,
+		false)
+
+	addCommand("ropchain",
+		[]string{"rop"},
+		3,
+		"[architecture] [gadgets, registers and calls ...]",
+		cmdRopchain,
+		false)
+
+	addCommand("ret2dlresolve",
+		[]string{"ret2dl"},
+		1,
+		"{function} {argument ...} {at=address} {attachment}",
+		cmdRet2dlresolve,
+		false)
+
+	addCommand("alphaenc",
+		[]string{"alnum"},
+		2,
+		"{print} {register} [opcodes ...]",
+		cmdAlphaenc,
+		false)
+
+	addCommand("chunk",
+		[]string{"heap"},
+		2,
+		"[prev_size] [size] {fd bk ...} {x86}",
+		cmdChunk,
+		false)
+
+	addCommand("bin",
+		[]string{"malloc"},
+		2,
+		"[request size] {glibc version} {x86}",
+		cmdBin,
+		false)
+
+	addCommand("seccomp",
+		[]string{"bpf"},
+		1,
+		"{x86/x64/arm64} [filter bytes or dump ...] {attachment}",
+		cmdSeccomp,
+		false)
+
 	addCommand("commands",
 		[]string{"cmds"},
 		0,
@@ -202,6 +611,34 @@ func buildCommandMap() {
 		cmdUptime,
 		true)
 
+	addCommand("admin",
+		[]string{},
+		2,
+		"[stats|guilds|reload|shutdown|announce] {message ...}",
+		cmdAdmin,
+		true)
+
+	addCommand("block",
+		[]string{"ban"},
+		3,
+		"[user|guild] [id] {minutes} {reason ...}",
+		cmdBlock,
+		true)
+
+	addCommand("unblock",
+		[]string{"unban"},
+		3,
+		"[user|guild] [id]",
+		cmdUnblock,
+		true)
+
+	addCommand("reload",
+		[]string{},
+		0,
+		"",
+		cmdReload,
+		true)
+
 	addCommand("restart",
 		[]string{"refresh"},
 		0,
@@ -215,6 +652,10 @@ func buildCommandMap() {
 		"",
 		cmdDie,
 		true)
+
+	// Optional Module Commands
+
+	loadModules()
 }
 
 // Adds a command to the command map
@@ -230,32 +671,164 @@ func addCommand(name string, aliases []string, requiredArgs int, usage string, h
 	commandMap[name] = cmd
 }
 
+// A category of commands in the !commands list
+type helpCategory struct {
+	name string
+	lines []string
+}
+
+// Packs the categories of the command list into pages no longer than limit, keeping categories together unless one is
+// too long for a page by itself, when it's split between lines
+func helpPages(categories []helpCategory, limit int) []string {
+	var pages []string
+	page := ""
+
+	add := func(text string) {
+		if page != "" && len(page) + len(text) > limit {
+			pages = append(pages, page)
+			page = ""
+		}
+
+		page += text
+	}
+
+	for _, category := range categories {
+		block := category.name + ":\n"
+
+		for _, line := range category.lines {
+			block += line + "\n"
+		}
+
+		if len(block) <= limit {
+			add(block)
+			continue
+		}
+
+		add(category.name + ":\n")
+
+		for _, line := range category.lines {
+			add(line + "\n")
+		}
+	}
+
+	if page != "" {
+		pages = append(pages, page)
+	}
+
+	return pages
+}
+
 // Sends a list of commands
 func cmdCommands(params cmdArguments) {
 	s := params.s
 	m := params.m
 
-	commands := "```"
-	commands += "!assemble/asm [architecture] {instructions ...} - Assembles given instructions into opcodes. Instructions are separated by a ';'.\n"
-	commands += "!disassemble/disasm [architecture] {opcodes ...} - Disassembles given opcodes into instructions. Give in 'bb' format separated by a space.\n"
-	commands += "!cve [cve identifier] - Displays information on a given CVE from NVD.\n"
-	commands += "!info [identifier] - Gives information on the given word (like a dictionary).\n"
-	commands += "!retrick - Gives you a random RE trick.\n"
-	commands += "!expltrick = Gives you a random exploit dev trick.\n"
-	commands += "!manual [architecture] - Links a PDF manual for the given architecture.\n"
-	commands += "!motivation - you can do it!\n"
-	//commands += "!readelf [link] {options ...} - Reads and gives information about the ELF given by the link.\n"
-	commands += "!commands/cmds - You are here.\n"
-	commands += "```"
-
-	_, _ = s.ChannelMessageSend(m.ChannelID, "Here's a list of my commands: " + commands)
+	categories := []helpCategory {
+		{"Assembly", []string {
+			"!assemble/asm [architecture] {instructions ...} - Assembles given instructions into opcodes. Instructions are separated by a ';', or go one per line (in a code block or not) with ';' and '#' starting comments, so objdump output can be pasted as is. ARM and Thumb code can switch state with .arm and .thumb lines.",
+			"!disassemble/disasm [architecture] {opcodes ...} - Disassembles given opcodes into instructions. Give in 'bb' format separated by a space, a code block works too. AVR opcodes can also be 16-bit words, i.e. '0x940c 0x0034'.",
+			"!disas-modes {opcodes ...} - Disassembles opcodes as x86 (16, 32 and 64-bit), ARM, Thumb and ARM64 side by side, to work out which one an unknown blob is.",
+			"!explain [architecture] {opcodes|instructions ...} - Explains what each instruction does in plain English, and what registers are set up for the calls after them.",
+			"!pseudo [architecture] {opcodes ...} - Lifts a short snippet of opcodes (up to 256 bytes) to C-like pseudocode, with the compares and branches turned into if statements.",
+			"!encoding/enc [architecture] {opcodes ...} - Breaks an x86 instruction's encoding down into its prefixes, REX or VEX, opcode, ModRM, SIB, displacement and immediate, or an ARM or Thumb instruction (bytes or a word like 0xe3a00001) into its bitfields.",
+			"!armimm/imm [value] - Checks whether a constant can be an immediate in ARM, Thumb-2 and AArch64 instructions, or which instructions load it if it can't.",
+			"!reljmp/branch [architecture] [from] [to] - Encodes the jumps, calls and branches from one hex address to another, i.e. to patch a jump into a binary.",
+			"!stackframe/frame [architecture] {opcodes ...} - Draws a function's stack frame from its prologue and stack accesses: saved registers, the canary, locals and the return address.",
+		}},
+		{"Preferences and snippets", []string {
+			"!prefs [arch|syntax|format|render|reset] {value} - Saves your default architecture, x86 syntax (intel/att), assembly output format (listing/hex/c/python) and whether disassembly is sent as text or an image. With an architecture saved, !disassemble 4889e5 works without one.",
+			"!save [name] {content ...} - Saves a snippet of assembly or bytes for this server, keeping its lines. Only you or a server admin can save over it. Use it in other commands with @snippet:name.",
+			"!get [name] - Shows a saved snippet.",
+			"!list - Lists this server's saved snippets.",
+			"!history - Lists your recent commands.",
+			"!cancel [job id] - Stops a long running command you started, the ID is on its working message.",
+			"!last - Re-runs your last command.",
+			"!redo [n] {overrides ...} - Re-runs your nth most recent command, replacing its arguments with any you give (i.e. a different architecture).",
+			"!settings [aliases|alias|unalias|audit|packs|pack|manual|highlight|rewards|reward|channels|allow|disallow] {arguments ...} - Lists or changes this server's command aliases (i.e. '!settings alias dis disassemble x64'), audit log channel, enabled trick packs (i.e. '!settings pack ghidra on') and manual links (i.e. '!settings manual x86 <url>'), the language output is highlighted as (i.e. '!settings highlight mips nasm'), roles given at a number of points (i.e. '!settings reward <role id> 100') and the channels commands are limited to (i.e. '!settings allow #re-tools disassemble emulate'). Changes need server admin.",
+		}},
+		{"Binaries", []string {
+			"!objdump {attachment} - Disassembles the executable sections of an attached ELF or PE, and sends the listing as a file. Binary commands use the last binary you attached if you don't attach one.",
+			"!funcs {attachment} - Lists the functions in a binary, from its symbols, prologues and call targets. Disassemble one with i.e. '!disassemble @func:main'.",
+			"!xref [address|function] {attachment} - Lists the calls, jumps and data references to an address in a binary, with the instructions around them.",
+			"!hexdump {offset} {length} {attachment} - Dumps a file as hex and ASCII, 256 bytes at a time, or the hex or base64 bytes you give it (i.e. '!hexdump SGVsbG8=').",
+			"!patch [offset] [bytes ...] {attachment} - Overwrites the bytes at a file offset of a binary, and sends back the patched file. Binary commands after it work on the patched file.",
+			"!patchasm [offset] {pad} [instructions ...] {attachment} - Assembles instructions into a binary at a file offset, 'pad' fills the rest of the last instruction it overwrites with NOPs (i.e. '!patchasm 0x1234 pad xor eax, eax').",
+			"!scan [pattern ...] {attachment} - Searches a binary for bytes, with ?? wildcards (i.e. '!scan 48 8B ?? ?? E8'), and disassembles each match.",
+			"!yaragen [name] [bytes ...|offset,length] {mask|maskall} - Makes a YARA rule from hex bytes, or from bytes in your binary (i.e. '!yaragen my_rule 0x1234,32 mask'). 'mask' wildcards addresses in instructions, 'maskall' every immediate.",
+			"!fuzzyhash {attachments ...} - Gives the ssdeep and TLSH hashes of files.",
+			"!fuzzycmp {hashes ...} {attachments ...} - Compares two files or their ssdeep or TLSH hashes, i.e. an attachment and a hash from a report.",
+			"!peres {extract} {attachment} - Lists the resources in a PE, with its version info and manifest. 'extract' attaches its icons and any executables embedded in it.",
+			"!reloc {symbol filter} {attachment} - Lists the relocation entries of an ELF with their types and symbols.",
+			"!dynamic {attachment} - Lists the tags of an ELF's dynamic section, i.e. NEEDED, RPATH, INIT/FINI and BIND_NOW.",
+			"!deps {attachment} - Lists the libraries an ELF needs or the DLLs a PE imports, and flags unusual or missing ones.",
+			"!triage {attachment} - Sums up a binary for a first look: symbols, linking, entropy, packer hints, suspicious sections and TLS callbacks.",
+		}},
+		{"Games", []string {
+			"!quiz {architecture} {easy|medium|hard} - Posts the bytes of a random instruction, the first to reply with the instruction scores points. '!quiz scores' shows the leaderboard and '!quiz skip' gives up.",
+			"!challenge {name|list|scores} - Shows this week's reversing challenge, or an older one, the challenges so far or the leaderboard.",
+			"!flag {challenge} [flag] - Submits a flag for this week's challenge, or the one named. Send it in a DM!",
+			"!leaderboard {all|seasons|reset} - Shows this server's points from quizzes and challenges for the season, all time, or the winners of past seasons. Admins can end the season with 'reset'.",
+		}},
+		{"Reference", []string {
+			"!info [identifier] - Gives information on the given word (like a dictionary).",
+			"!retrick {category} - Gives you a random RE trick, optionally from a category (" + strings.Join(trickCategoryNames(trickKindRE), ", ") + ").",
+			"!expltrick {category} - Gives you a random exploit dev trick, optionally from a category (" + strings.Join(trickCategoryNames(trickKindExploit), ", ") + ").",
+			"!trick submit [category] [text ...] - Submits a trick of your own, with any screenshots attached. It's given out by !retrick/!expltrick, credited to you, once a developer approves it. Works in DMs too.",
+			"!trick [id] - Shows a specific trick, i.e. '!trick 42'.",
+			"!trick search [keywords ...] - Searches the RE and exploit dev tricks.",
+			"!manual/ref [architecture] {instruction|volume|topic} - Links a PDF manual for the given architecture, the reference page for one instruction (x86 and ARM), or a volume or topic of it (i.e. '!manual x86 vol3' or '!manual x86 paging'). ARM profiles and versions have their own manuals, i.e. arm-m, arm-r, armv7.",
+			"!manual abi [target] - Links the ABI and calling convention document for a target, i.e. sysv, ms-x64, aapcs64, o32.",
+			"!manual search [architecture] [terms ...] - Searches the chapters and sections of an architecture's manual.",
+		}},
+		{"Converters", []string {
+			"!time/timestamp [value|bytes ...] - Converts a number (or up to 8 little endian bytes) to a date, read as a Unix timestamp in seconds or milliseconds, a Windows FILETIME and a DOS date and time.",
+			"!perm/chmod [octal|rwx] - Converts file permissions between octal (4755) and symbolic (rwsr-xr-x), and explains the setuid, setgid and sticky bits.",
+			"!align/page [address] {page|size} - Shows an address's page (or other alignment) base, its offset into it and the next aligned address, i.e. for mprotect() or a misaligned stack.",
+		}},
+		{"Exploit dev", []string {
+			"!fmtstr/fmt [address] [value] [offset] {printed=n} {hhn|hn} {x86|x64} - Makes a format string payload that writes a hex value to an address with %hhn or %hn, given the argument number of your buffer (i.e. '!fmtstr 601018 401156 6').",
+			"!ropchain/rop [architecture] [gadgets, registers and calls ...] - Packs a ROP chain as pwntools code from gadgets ('address: instructions'), register values and addresses to call, separated by '|' (i.e. '!ropchain x64 401234: pop rdi; ret | rdi=404000 | 401050').",
+			"!ret2dlresolve/ret2dl {function} {argument ...} {at=address} {attachment} - Builds the fake relocation, symbol and name for a ret2dlresolve against the attached or session ELF (x86 or x64, lazy binding), that resolve function (system) and call it with argument (/bin/sh).",
+			"!alphaenc/alnum {print} {register} [opcodes ...] - Encodes x86 code as alphanumeric characters, or printable ones with 'print', behind a decoder that needs its own address in register (eax).",
+			"!chunk/heap [prev_size] [size] {fd bk ...} {x86} - Decodes a glibc heap chunk's header, given as hex bytes or gdb words (i.e. '!chunk 0x0 0x91'), with its flags, usable size and the bins it's freed into.",
+			"!bin/malloc [request size] {glibc version} {x86} - Gives the chunk size a malloc request gets and its tcache, fastbin and small or large bin, for a glibc version (i.e. '!bin 0x88 2.27').",
+			"!seccomp/bpf {x86/x64/arm64} [filter bytes or dump ...] {attachment} - Disassembles a seccomp filter like seccomp-tools and sums up what it does with each system call.",
+		}},
+	}
+
+	var modules []string
+
+	for _, mod := range loadedModules {
+		modules = append(modules, mod.Help()...)
+	}
+
+	if len(modules) > 0 {
+		categories = append(categories, helpCategory {"Modules", modules})
+	}
+
+	categories = append(categories, helpCategory {"Other", []string {"!motivation - you can do it!", "!commands/cmds - You are here."}})
+
+	// The whole list is far over Discord's message limit, so it goes out a few categories per message
+	pages := helpPages(categories, maxListingMessageLength)
+
+	for n, page := range pages {
+		content := "```" + page + "```"
+
+		if n == 0 {
+			content = "Here's a list of my commands: " + content
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, content)
+	}
 }
 
+// Motivation!
+const motivationalJapaneseFisherman = "https://www.youtube.com/watch?v=0Lq0d-cPpS4"
+
 // Motivation!
 func cmdMotivation(params cmdArguments) {
 	s := params.s
 	m := params.m
 
-	motivationalJapaneseFisherman := "https://www.youtube.com/watch?v=0Lq0d-cPpS4"
 	_, _ = s.ChannelMessageSend(m.ChannelID, motivationalJapaneseFisherman)
 }
\ No newline at end of file
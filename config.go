@@ -3,23 +3,136 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
 
 	"github.com/go-ini/ini"
 )
 
+// The loaded config.ini, shared by every lookup until the next reload
+var (
+	config     *ini.File
+	configLock sync.RWMutex
+)
+
+// Input size limits, read from the [limits] section of config.ini
+var (
+	MaxInstructions    int
+	MaxOpcodeBytes     int
+	MaxAttachmentBytes int
+)
+
+// Returns the loaded config.ini, loading it on first use
+func loadedConfig() *ini.File {
+	configLock.RLock()
+	cfg := config
+	configLock.RUnlock()
+
+	if cfg == nil {
+		if err := reloadConfig(); err != nil {
+			fmt.Println("[ERROR] Critical error attempting to load config.ini! " + err.Error())
+			os.Exit(1)
+		}
+
+		configLock.RLock()
+		cfg = config
+		configLock.RUnlock()
+	}
+
+	return cfg
+}
+
 // Searches and reads a property from config.ini as a string
 func getConfigPropertyAsStr(section string, prop string) string {
+	// Read cfg value as string
+	cfg := loadedConfig()
+	val := cfg.Section(section).Key(prop).String()
+
+	// Commands read the config on every message, so reads are only logged when debugging it
+	if cfg.Section("config").Key("debug").MustBool(false) {
+		fmt.Println("[CONFIG] Read '" + section + "', Key '" + prop + "', set to: '" + val + "'!")
+	}
+
+	return val
+}
+
+// Reads a token or password from config.ini. Unlike getConfigPropertyAsStr it never prints the value, even with
+// [config] debug on, so secrets stay out of the log.
+func getConfigSecret(section string, prop string) string {
+	return loadedConfig().Section(section).Key(prop).String()
+}
+
+// Re-reads config.ini from disk, keeping the old config if the new one fails to parse
+func reloadConfig() error {
 	cfg, err := ini.InsensitiveLoad("config.ini")
 
 	if err != nil {
-		fmt.Println("[ERROR] Critical error attempting to load config.ini! " + err.Error())
-		os.Exit(1)
+		return err
 	}
 
-	// Read cfg value as string
-	val := cfg.Section(section).Key(prop).String()
+	configLock.Lock()
+	config = cfg
+	configLock.Unlock()
+
+	return nil
+}
 
-	fmt.Println("[CONFIG] Read '" + section + "', Key '" + prop + "', set to: '" + val + "'!")
+// Uses an empty config, so every setting takes its default. The CLI runs on this when there's no config.ini.
+func useDefaultConfig() {
+	configLock.Lock()
+	config = ini.Empty()
+	configLock.Unlock()
+}
+
+// Lists the keys set in a section of config.ini
+func getConfigSectionKeys(section string) []string {
+	return loadedConfig().Section(section).KeyStrings()
+}
+
+// Searches and reads a property from config.ini as an integer, falling back to def if it's missing or invalid
+func getConfigPropertyAsInt(section string, prop string, def int) int {
+	val, err := strconv.Atoi(getConfigPropertyAsStr(section, prop))
+
+	if err != nil {
+		return def
+	}
 
 	return val
 }
+
+// Reads the input size limits from config.ini
+func loadLimits() {
+	MaxInstructions = getConfigPropertyAsInt("limits", "max_instructions", 64)
+	MaxOpcodeBytes = getConfigPropertyAsInt("limits", "max_opcode_bytes", 1024)
+	MaxAttachmentBytes = getConfigPropertyAsInt("limits", "max_attachment_bytes", 8*1024*1024)
+}
+
+// Reads the command prefix from config.ini, defaulting to '!'
+func loadPrefix() {
+	CommandPrefix = getConfigPropertyAsStr("discord", "prefix")
+
+	if CommandPrefix == "" {
+		CommandPrefix = "!"
+	}
+}
+
+// Reloads config.ini and everything derived from it, without dropping the Discord session
+func reloadAll() error {
+	if err := reloadConfig(); err != nil {
+		return err
+	}
+
+	loadPrefix()
+	loadLimits()
+	loadCache()
+	loadHighlight()
+	loadJobs()
+	loadAbuse()
+	loadDedupe()
+	buildDictionaryMap()
+	loadTricks()
+	loadManuals()
+	loadSignatures()
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A command that was just run in a channel, and the first message that answered it. The message ID is empty while
+// the command is still running.
+type recentRequest struct {
+	at        time.Time
+	messageID string
+}
+
+// How long a command is remembered for, read from the [abuse] section of config.ini. 0 turns deduplication off.
+var DedupeWindow time.Duration
+
+// Commands run in the last few seconds, keyed by channel, user and the command as given
+var (
+	recentRequests     = make(map[string]recentRequest)
+	recentRequestsLock sync.Mutex
+)
+
+// Reads how long commands are remembered for from config.ini
+func loadDedupe() {
+	DedupeWindow = time.Duration(getConfigPropertyAsInt("abuse", "dedupe_seconds", 5)) * time.Second
+}
+
+// Checks if a repeat of the command would get the same answer. Only the commands whose replies can be cached are,
+// and the heavy ones when the binary is attached; quizzes, random picks and anything working on or changing the
+// session's binary aren't.
+func isDeterministic(m *discordgo.MessageCreate, command Command) bool {
+	return cacheableCommands.contains(command.name) || (len(m.Attachments) > 0 && heavyCommands.contains(command.name))
+}
+
+// Remembers the first message a handler sends to the channel it was run in
+type firstReplyResponder struct {
+	Responder
+	channelID string
+	key       string
+}
+
+func (r *firstReplyResponder) remember(channelID string, msg *discordgo.Message, err error) {
+	if err != nil || msg == nil || msg.ID == "" || channelID != r.channelID {
+		return
+	}
+
+	recentRequestsLock.Lock()
+	defer recentRequestsLock.Unlock()
+
+	if request, ok := recentRequests[r.key]; ok && request.messageID == "" {
+		request.messageID = msg.ID
+		recentRequests[r.key] = request
+	}
+}
+
+func (r *firstReplyResponder) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := r.Responder.ChannelMessageSend(channelID, content, options...)
+	r.remember(channelID, msg, err)
+
+	return msg, err
+}
+
+func (r *firstReplyResponder) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := r.Responder.ChannelMessageSendEmbed(channelID, embed, options...)
+	r.remember(channelID, msg, err)
+
+	return msg, err
+}
+
+func (r *firstReplyResponder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := r.Responder.ChannelMessageSendComplex(channelID, data, options...)
+	r.remember(channelID, msg, err)
+
+	return msg, err
+}
+
+// Checks if the same user just ran the same command in the channel, i.e. a retry over a flaky connection. Duplicates are
+// pointed at the first answer and false is returned; otherwise the command is remembered and the Responder its
+// handler should answer through is returned.
+func checkDuplicate(s Responder, m *discordgo.MessageCreate, command Command, args []string) (Responder, bool) {
+	if DedupeWindow <= 0 || !isDeterministic(m, command) {
+		return s, true
+	}
+
+	key := m.ChannelID + "\x00" + m.Author.ID + "\x00" + command.name + "\x00" + strings.Join(strings.Fields(strings.Join(args[1:], " ")), " ")
+
+	// A retry uploads its attachments again, so they're told apart by name and size
+	for _, attachment := range m.Attachments {
+		key += "\x00" + attachment.Filename + "\x00" + strconv.Itoa(attachment.Size)
+	}
+
+	now := time.Now()
+
+	recentRequestsLock.Lock()
+
+	for recentKey, request := range recentRequests {
+		if now.Sub(request.at) > DedupeWindow {
+			delete(recentRequests, recentKey)
+		}
+	}
+
+	request, duplicate := recentRequests[key]
+
+	if !duplicate {
+		recentRequests[key] = recentRequest{at: now}
+	}
+
+	recentRequestsLock.Unlock()
+
+	if !duplicate {
+		return &firstReplyResponder{s, m.ChannelID, key}, true
+	}
+
+	if request.messageID == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "That was just asked, the answer is on its way.")
+		return nil, false
+	}
+
+	guild := m.GuildID
+
+	if guild == "" {
+		guild = "@me"
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "That was just answered: https://discord.com/channels/" + guild + "/" + m.ChannelID + "/" + request.messageID)
+	return nil, false
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Forgets the requests earlier tests made
+func forgetRequests() {
+	DedupeWindow = 5 * time.Second
+
+	recentRequestsLock.Lock()
+	recentRequests = make(map[string]recentRequest)
+	recentRequestsLock.Unlock()
+}
+
+// A message in a channel of its own
+func dedupeMessage(channelID string, content string) (*discordgo.MessageCreate, []string) {
+	m := testMessage(content)
+	m.ChannelID = channelID
+
+	return m, strings.Split(content, " ")
+}
+
+func TestCheckDuplicateAnswered(t *testing.T) {
+	forgetRequests()
+
+	f := &fakeResponder{}
+	command := Command{name: "disassemble"}
+	m, args := dedupeMessage("dedupe-answered", "!disasm x64 90")
+
+	first, ok := checkDuplicate(f, m, command, args)
+
+	if !ok || first == nil {
+		t.Fatal("the first request wasn't let through")
+	}
+
+	// The first reply is what retries are pointed at
+	answer, _ := first.ChannelMessageSend(m.ChannelID, "nop")
+
+	// Spaced differently, it's still the same command
+	m, args = dedupeMessage("dedupe-answered", "!disasm  x64   90")
+
+	if _, ok := checkDuplicate(f, m, command, args); ok {
+		t.Fatal("the retry was let through")
+	}
+
+	replies := f.sent()
+	want := "That was just answered: https://discord.com/channels/300/dedupe-answered/" + answer.ID
+
+	if len(replies) != 2 || replies[1].content != want {
+		t.Errorf("got %+v, want %q", replies, want)
+	}
+}
+
+func TestCheckDuplicateRunning(t *testing.T) {
+	forgetRequests()
+
+	f := &fakeResponder{}
+	command := Command{name: "objdump"}
+	m, args := dedupeMessage("dedupe-running", "!objdump")
+	m.Attachments = []*discordgo.MessageAttachment{{Filename: "a.out", Size: 4096}}
+
+	if _, ok := checkDuplicate(f, m, command, args); !ok {
+		t.Fatal("the first request wasn't let through")
+	}
+
+	if _, ok := checkDuplicate(f, m, command, args); ok {
+		t.Fatal("the retry was let through")
+	}
+
+	if replies := f.sent(); len(replies) != 1 || !strings.Contains(replies[0].content, "on its way") {
+		t.Errorf("got %+v, want to be told the answer is coming", replies)
+	}
+}
+
+func TestCheckDuplicateDifferent(t *testing.T) {
+	forgetRequests()
+
+	f := &fakeResponder{}
+	command := Command{name: "disassemble"}
+	m, args := dedupeMessage("dedupe-different", "!disasm x64 90")
+
+	if _, ok := checkDuplicate(f, m, command, args); !ok {
+		t.Fatal("the first request wasn't let through")
+	}
+
+	// Other input, or another attachment, is a new request
+	m, args = dedupeMessage("dedupe-different", "!disasm x64 c3")
+
+	if _, ok := checkDuplicate(f, m, command, args); !ok {
+		t.Error("a command with other arguments was taken as a retry")
+	}
+
+	m, args = dedupeMessage("dedupe-different", "!disasm x64 90")
+	m.Attachments = []*discordgo.MessageAttachment{{Filename: "a.bin", Size: 16}}
+
+	if _, ok := checkDuplicate(f, m, command, args); !ok {
+		t.Error("a command with an attachment was taken as a retry")
+	}
+
+	// And only replies in the channel it was run in count as its answer
+	first, _ := checkDuplicate(f, m, Command{name: "assemble"}, args)
+	_, _ = first.ChannelMessageSend("somewhere-else", "in a DM")
+
+	if _, ok := checkDuplicate(f, m, Command{name: "assemble"}, args); ok {
+		t.Fatal("the retry was let through")
+	}
+
+	if replies := f.sent(); !strings.Contains(replies[len(replies) - 1].content, "on its way") {
+		t.Errorf("got %+v, want to be told the answer is coming", replies)
+	}
+}
+
+func TestCheckDuplicateOtherUser(t *testing.T) {
+	forgetRequests()
+
+	f := &fakeResponder{}
+	command := Command{name: "disassemble"}
+	m, args := dedupeMessage("dedupe-user", "!disasm x64 90")
+
+	if _, ok := checkDuplicate(f, m, command, args); !ok {
+		t.Fatal("the first request wasn't let through")
+	}
+
+	// Someone else asking the same thing isn't retrying
+	m, args = dedupeMessage("dedupe-user", "!disasm x64 90")
+	m.Author.ID = "401"
+
+	if _, ok := checkDuplicate(f, m, command, args); !ok {
+		t.Error("another user's command was taken as a retry")
+	}
+}
+
+func TestCheckDuplicateNotDeterministic(t *testing.T) {
+	forgetRequests()
+
+	f := &fakeResponder{}
+
+	// A new question, a new pick or the session's binary after a patch can each answer differently
+	for _, test := range []struct {
+		name    string
+		content string
+	}{
+		{"quiz", "!quiz x64"},
+		{"trick", "!trick"},
+		{"patch", "!patch 0x10 90"},
+		{"objdump", "!objdump"},
+	} {
+		m, args := dedupeMessage("dedupe-stateful", test.content)
+
+		for n := 0; n < 2; n++ {
+			if _, ok := checkDuplicate(f, m, Command{name: test.name}, args); !ok {
+				t.Errorf("%q was taken as a retry", test.content)
+			}
+		}
+	}
+
+	if replies := f.sent(); len(replies) != 0 {
+		t.Errorf("got %+v, want no replies", replies)
+	}
+}
@@ -4,6 +4,7 @@ import(
 	"os"
 	"errors"
 	"strings"
+	"sync"
 	"io/ioutil"
 	"encoding/json"
 )
@@ -16,31 +17,39 @@ type Info struct {
 	Updated string `json:"updated"`
 }
 
-// Holds a list of dictionary definitions to aliases/synonyms
-var dictionaryMap map[string][]string
+// Holds a list of dictionary definitions to aliases/synonyms. !reload rebuilds it while !info reads it, so it's
+// swapped in whole under the lock.
+var (
+	dictionaryMap  map[string][]string
+	dictionaryLock sync.RWMutex
+)
 
 // Build the dictionary map
 func buildDictionaryMap() {
-	dictionaryMap = make(map[string][]string)
+	aliases := make(map[string][]string)
 
 	// Add definition aliases/synonyms here
-	dictionaryMap["buffer overflow"] = []string{"bof", "buf overflow"}
-	dictionaryMap["uaf"] = []string{"use-after-free", "use after free"}
-	dictionaryMap["integer overflow"] = []string{"int overflow"}
-	dictionaryMap["arbitrary rw"] = []string{"arbitrary r/w", "r/w", "rw", "arb rw", "arb. r/w", "arb. rw"}
-	dictionaryMap["code execution"] = []string{"arbitrary code execution", "code exec", "rce", "ace"}
-	dictionaryMap["aslr"] = []string{"address space layout randomization"}
-	dictionaryMap["dep"] = []string{"data execution prevention", "nx", "no execute", "no-execute", "W^X"}
-	dictionaryMap["smap"] = []string{"supervisor mode access prevention"}
-	dictionaryMap["smep"] = []string{"supervisor mode execution prevention"}
-	dictionaryMap["userland"] = []string{"usermode", "ring3"}
-	dictionaryMap["kernel"] = []string{"kernelmode", "ring0"}
-	dictionaryMap["sandbox"] = []string{"sandboxing", "jail", "jailing"}
-	dictionaryMap["rop"] = []string{"return-oriented-programming", "return oriented programming"}
-	dictionaryMap["jop"] = []string{"jump-oriented-programming", "jump oriented programming"}
-	dictionaryMap["uninit access"] = []string{"uninitialized read", "uninit read", "uninitialized access"}
-	dictionaryMap["race"] = []string{"races", "race condition", "race condition"}
-	dictionaryMap["re"] = []string{"reverse engineering", "reverse engineer"}
+	aliases["buffer overflow"] = []string{"bof", "buf overflow"}
+	aliases["uaf"] = []string{"use-after-free", "use after free"}
+	aliases["integer overflow"] = []string{"int overflow"}
+	aliases["arbitrary rw"] = []string{"arbitrary r/w", "r/w", "rw", "arb rw", "arb. r/w", "arb. rw"}
+	aliases["code execution"] = []string{"arbitrary code execution", "code exec", "rce", "ace"}
+	aliases["aslr"] = []string{"address space layout randomization"}
+	aliases["dep"] = []string{"data execution prevention", "nx", "no execute", "no-execute", "W^X"}
+	aliases["smap"] = []string{"supervisor mode access prevention"}
+	aliases["smep"] = []string{"supervisor mode execution prevention"}
+	aliases["userland"] = []string{"usermode", "ring3"}
+	aliases["kernel"] = []string{"kernelmode", "ring0"}
+	aliases["sandbox"] = []string{"sandboxing", "jail", "jailing"}
+	aliases["rop"] = []string{"return-oriented-programming", "return oriented programming"}
+	aliases["jop"] = []string{"jump-oriented-programming", "jump oriented programming"}
+	aliases["uninit access"] = []string{"uninitialized read", "uninit read", "uninitialized access"}
+	aliases["race"] = []string{"races", "race condition", "race condition"}
+	aliases["re"] = []string{"reverse engineering", "reverse engineer"}
+
+	dictionaryLock.Lock()
+	dictionaryMap = aliases
+	dictionaryLock.Unlock()
 }
 
 // Searches the dictionary for a given definition
@@ -51,12 +60,16 @@ func getDictionaryItem(item string) (Info, error) {
 	// Convert to lowercase
 	item = strings.ToLower(item)
 
+	dictionaryLock.RLock()
+	aliases := dictionaryMap
+	dictionaryLock.RUnlock()
+
 	// Check if definition exists
-	if _, ok := dictionaryMap[item]; !ok {
+	if _, ok := aliases[item]; !ok {
 		// If definition doesn't exist, check if an alias exists
 		foundDefinition := false
 
-		for key, definition := range dictionaryMap {
+		for key, definition := range aliases {
 			for _, alias := range definition {
 				if item == alias {
 					file = key
@@ -0,0 +1,796 @@
+package main
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// ARM's condition codes, by their encoding
+var armConditionCodes = []string{"eq", "ne", "cs", "cc", "mi", "pl", "vs", "vc", "hi", "ls", "ge", "lt", "gt", "le", "al"}
+
+// Data processing opcodes, ARM's and Thumb-2's modified immediate ones share them
+var armDataOpcodes = []string{"and", "eor", "sub", "rsb", "add", "adc", "sbc", "rsc", "tst", "teq", "cmp", "cmn", "orr", "mov", "bic", "mvn"}
+
+// Thumb's 16-bit data processing opcodes, 010000 followed by these
+var thumbDataOpcodes = []string{"and", "eor", "lsl", "lsr", "asr", "adc", "sbc", "ror", "tst", "rsb", "cmp", "cmn", "orr", "mul", "bic", "mvn"}
+
+var armShiftTypes = []string{"lsl", "lsr", "asr", "ror"}
+
+// Converts an instruction word like the manuals write it, "0xe3a00001", to its bytes in memory. 32-bit Thumb-2
+// words are the first halfword followed by the second, like "0xf04f0001".
+func armWordBytes(arch string, text string) ([]byte, error) {
+	digits := strings.TrimPrefix(text, "0x")
+	word, err := strconv.ParseUint(digits, 16, 32)
+
+	if err != nil {
+		return nil, errInvalidOpcodes
+	}
+
+	code := make([]byte, 4)
+
+	switch {
+	case arch == "thumb" && len(digits) <= 4:
+		binary.LittleEndian.PutUint16(code, uint16(word))
+		return code[:2], nil
+	case arch == "thumb":
+		binary.LittleEndian.PutUint16(code, uint16(word >> 16))
+		binary.LittleEndian.PutUint16(code[2:], uint16(word))
+	default:
+		binary.LittleEndian.PutUint32(code, uint32(word))
+	}
+
+	return code, nil
+}
+
+// Reads an ARM instruction word from its bytes
+func armWord(code []byte) uint32 {
+	padded := make([]byte, 4)
+	copy(padded, code)
+
+	return binary.LittleEndian.Uint32(padded)
+}
+
+// Returns bits hi to lo of the word
+func bitsOf(word uint32, hi uint, lo uint) uint32 {
+	return word >> lo & (1 << (hi - lo + 1) - 1)
+}
+
+// Makes a field of bits hi to lo of the word, with where it is and what it means
+func bitField(word uint32, name string, hi uint, lo uint, note string) encodingField {
+	where := "bits " + strconv.Itoa(int(hi)) + "-" + strconv.Itoa(int(lo))
+	if hi == lo {
+		where = "bit " + strconv.Itoa(int(hi))
+	}
+
+	if note != "" {
+		where += ": " + note
+	}
+
+	return encodingField{name: name, bits: binaryDigits(int(bitsOf(word, hi, lo)), int(hi - lo + 1)), notes: []string{where}}
+}
+
+// Names an ARM register by its number
+func armRegisterName(n uint32) string {
+	switch n {
+	case 13:
+		return "sp"
+	case 14:
+		return "lr"
+	case 15:
+		return "pc"
+	}
+
+	return "r" + strconv.Itoa(int(n))
+}
+
+// Lists the registers set in a register list's bits
+func armRegisterList(list uint32) string {
+	var regs []string
+
+	for n := uint32(0); n < 16; n++ {
+		if list & (1 << n) != 0 {
+			regs = append(regs, armRegisterName(n))
+		}
+	}
+
+	return "{" + strings.Join(regs, ", ") + "}"
+}
+
+// Describes a condition field
+func armConditionNote(cond uint32) string {
+	if int(cond) >= len(armConditionCodes) {
+		return "unconditional"
+	}
+
+	code := armConditionCodes[cond]
+
+	if code == "al" {
+		return "al, always"
+	}
+
+	return code + ", if " + armConditions[code]
+}
+
+// Describes a one bit flag, by what it means set and clear
+func flagNote(word uint32, bit uint, set string, clear string) string {
+	if bitsOf(word, bit, bit) == 1 {
+		return set
+	}
+
+	return clear
+}
+
+// Sign extends the low bits of a value
+func signExtend(value uint32, bits uint) int64 {
+	shift := 64 - bits
+	return int64(uint64(value) << shift) >> shift
+}
+
+// Formats a signed offset in hex
+func signedOffset(offset int64) string {
+	if offset < 0 {
+		return "-0x" + strconv.FormatInt(-offset, 16)
+	}
+
+	return "+0x" + strconv.FormatInt(offset, 16)
+}
+
+// Breaks a 32-bit ARM (A32) instruction word into its bitfields
+func armEncoding(word uint32) []encodingField {
+	w := word
+	cond := bitsOf(w, 31, 28)
+	fields := []encodingField{bitField(w, "cond", 31, 28, armConditionNote(cond))}
+
+	reg := func(name string, hi uint, lo uint) encodingField {
+		return bitField(w, name, hi, lo, armRegisterName(bitsOf(w, hi, lo)))
+	}
+
+	indexing := []encodingField{
+		bitField(w, "P", 24, 24, flagNote(w, 24, "pre-indexed, the offset is applied before the access", "post-indexed, the offset is applied after the access")),
+		bitField(w, "U", 23, 23, flagNote(w, 23, "the offset is added", "the offset is subtracted")),
+	}
+
+	switch {
+	case cond == 15 && bitsOf(w, 27, 25) == 5:
+		offset := signExtend(bitsOf(w, 23, 0) << 2 | bitsOf(w, 24, 24) << 1, 26)
+		fields = append(fields, bitField(w, "op", 27, 25, "blx with an immediate, it switches to Thumb"),
+			bitField(w, "H", 24, 24, "bit 1 of the offset, since Thumb code only needs halfword alignment"),
+			bitField(w, "imm24", 23, 0, "offset " + signedOffset(offset) + " from pc, which is 8 bytes past the instruction"))
+	case cond == 15:
+		fields = append(fields, bitField(w, "op", 27, 0, "an unconditional instruction (cond 1111), see !manual for its fields"))
+	case bitsOf(w, 27, 4) == 0x12fff1 || bitsOf(w, 27, 4) == 0x12fff3:
+		fields = append(fields, bitField(w, "op", 27, 4, flagNote(w, 5, "blx, call the register's address", "bx, jump to the register's address") +
+			", switching to Thumb if its bit 0 is set"), reg("Rm", 3, 0))
+	case bitsOf(w, 27, 24) == 0 && bitsOf(w, 7, 4) == 9:
+		names := map[uint32]string{0: "mul", 1: "mla", 4: "umull", 5: "umlal", 6: "smull", 7: "smlal"}
+		long := bitsOf(w, 23, 23) == 1
+		fields = append(fields, bitField(w, "op", 27, 24, "multiply"), bitField(w, "opc", 23, 21, names[bitsOf(w, 23, 21)]),
+			bitField(w, "S", 20, 20, flagNote(w, 20, "sets the flags", "leaves the flags alone")))
+
+		if long {
+			fields = append(fields, reg("RdHi", 19, 16), reg("RdLo", 15, 12))
+		} else {
+			fields = append(fields, reg("Rd", 19, 16), reg("Ra", 15, 12))
+		}
+
+		fields = append(fields, reg("Rm", 11, 8), bitField(w, "1001", 7, 4, "marks a multiply"), reg("Rn", 3, 0))
+	case bitsOf(w, 27, 25) == 0 && bitsOf(w, 7, 7) == 1 && bitsOf(w, 4, 4) == 1:
+		// Halfword, signed byte and doubleword loads and stores fit in the data processing space
+		sizes := map[uint32]string{1: "halfword", 2: "signed byte (a doubleword for a store)", 3: "signed halfword (a doubleword for a store)"}
+		fields = append(fields, bitField(w, "op", 27, 25, "extra load or store"))
+		fields = append(fields, indexing...)
+		fields = append(fields, bitField(w, "I", 22, 22, flagNote(w, 22, "the offset is an immediate, split in two", "the offset is a register")),
+			bitField(w, "W", 21, 21, flagNote(w, 21, "writes the address back to Rn", "doesn't write back")),
+			bitField(w, "L", 20, 20, flagNote(w, 20, "load", "store")), reg("Rn", 19, 16), reg("Rt", 15, 12))
+
+		if bitsOf(w, 22, 22) == 1 {
+			fields = append(fields, bitField(w, "imm4H", 11, 8, "high half of the offset, #0x" + strconv.FormatUint(uint64(bitsOf(w, 11, 8) << 4 | bitsOf(w, 3, 0)), 16)))
+		} else {
+			fields = append(fields, bitField(w, "0000", 11, 8, ""))
+		}
+
+		fields = append(fields, bitField(w, "1", 7, 7, ""), bitField(w, "SH", 6, 5, sizes[bitsOf(w, 6, 5)]), bitField(w, "1", 4, 4, ""))
+
+		if bitsOf(w, 22, 22) == 1 {
+			fields = append(fields, bitField(w, "imm4L", 3, 0, "low half of the offset"))
+		} else {
+			fields = append(fields, reg("Rm", 3, 0))
+		}
+	case bitsOf(w, 27, 20) == 0x30 || bitsOf(w, 27, 20) == 0x34:
+		imm := bitsOf(w, 19, 16) << 12 | bitsOf(w, 11, 0)
+		fields = append(fields, bitField(w, "op", 27, 20, flagNote(w, 22, "movt, sets the top 16 bits", "movw, sets the register to a 16-bit immediate")),
+			bitField(w, "imm4", 19, 16, "top 4 bits of #0x" + strconv.FormatUint(uint64(imm), 16)), reg("Rd", 15, 12),
+			bitField(w, "imm12", 11, 0, "the other 12 bits"))
+	case bitsOf(w, 27, 26) == 0 && bitsOf(w, 24, 23) == 2 && bitsOf(w, 20, 20) == 0:
+		fields = append(fields, bitField(w, "op", 27, 0, "a miscellaneous instruction (mrs, msr, clz and so on), see !manual for its fields"))
+	case bitsOf(w, 27, 26) == 0:
+		opcode := armDataOpcodes[bitsOf(w, 24, 21)]
+		fields = append(fields, bitField(w, "op", 27, 26, "data processing"),
+			bitField(w, "I", 25, 25, flagNote(w, 25, "operand 2 is an immediate", "operand 2 is a register")),
+			bitField(w, "opcode", 24, 21, opcode), bitField(w, "S", 20, 20, flagNote(w, 20, "sets the flags", "leaves the flags alone")))
+
+		rn := reg("Rn", 19, 16)
+		if opcode == "mov" || opcode == "mvn" {
+			rn.notes[0] += " (" + opcode + " doesn't use it)"
+		}
+
+		rd := reg("Rd", 15, 12)
+		if (StrList{"tst", "teq", "cmp", "cmn"}).contains(opcode) {
+			rd.notes[0] += " (" + opcode + " only sets the flags)"
+		}
+
+		fields = append(fields, rn, rd)
+		fields = append(fields, armOperand2(w)...)
+	case bitsOf(w, 27, 26) == 1 && !(bitsOf(w, 25, 25) == 1 && bitsOf(w, 4, 4) == 1):
+		fields = append(fields, bitField(w, "op", 27, 26, "load or store"),
+			bitField(w, "I", 25, 25, flagNote(w, 25, "the offset is a shifted register", "the offset is a 12-bit immediate")))
+		fields = append(fields, indexing...)
+		fields = append(fields, bitField(w, "B", 22, 22, flagNote(w, 22, "a byte", "a word")),
+			bitField(w, "W", 21, 21, flagNote(w, 21, "writes the address back to Rn", "doesn't write back")),
+			bitField(w, "L", 20, 20, flagNote(w, 20, "load", "store")), reg("Rn", 19, 16), reg("Rt", 15, 12))
+
+		if bitsOf(w, 25, 25) == 0 {
+			fields = append(fields, bitField(w, "imm12", 11, 0, "offset #0x" + strconv.FormatUint(uint64(bitsOf(w, 11, 0)), 16)))
+		} else {
+			fields = append(fields, armShiftedRegister(w)...)
+		}
+	case bitsOf(w, 27, 26) == 1:
+		fields = append(fields, bitField(w, "op", 27, 0, "a media instruction, see !manual for its fields"))
+	case bitsOf(w, 27, 25) == 4:
+		fields = append(fields, bitField(w, "op", 27, 25, "load or store multiple"))
+		fields = append(fields, indexing...)
+		fields = append(fields, bitField(w, "S", 22, 22, flagNote(w, 22, "user mode registers, or restores CPSR when loading pc", "the current mode's registers")),
+			bitField(w, "W", 21, 21, flagNote(w, 21, "writes the address back to Rn", "doesn't write back")),
+			bitField(w, "L", 20, 20, flagNote(w, 20, "load (ldm, or pop from sp)", "store (stm, or push to sp)")), reg("Rn", 19, 16),
+			bitField(w, "register_list", 15, 0, armRegisterList(bitsOf(w, 15, 0))))
+	case bitsOf(w, 27, 25) == 5:
+		offset := signExtend(bitsOf(w, 23, 0) << 2, 26)
+		fields = append(fields, bitField(w, "op", 27, 25, "branch"), bitField(w, "L", 24, 24, flagNote(w, 24, "bl, saves the return address in lr", "b")),
+			bitField(w, "imm24", 23, 0, "offset " + signedOffset(offset) + " (imm24 times 4) from pc, which is 8 bytes past the instruction"))
+	case bitsOf(w, 27, 24) == 15:
+		fields = append(fields, bitField(w, "op", 27, 24, "svc, a system call"),
+			bitField(w, "imm24", 23, 0, "#0x" + strconv.FormatUint(uint64(bitsOf(w, 23, 0)), 16) + ", ignored by Linux (which takes the number from r7)"))
+	default:
+		fields = append(fields, bitField(w, "op", 27, 25, "coprocessor, VFP or NEON"),
+			bitField(w, "fields", 24, 0, "see !manual for this instruction's fields"))
+	}
+
+	return fields
+}
+
+// Breaks down a data processing instruction's second operand, an immediate or a shifted register
+func armOperand2(w uint32) []encodingField {
+	if bitsOf(w, 25, 25) == 1 {
+		rotate, imm8 := bitsOf(w, 11, 8), bitsOf(w, 7, 0)
+		value := imm8 >> (2 * rotate) | imm8 << (32 - 2 * rotate)
+
+		if rotate == 0 {
+			value = imm8
+		}
+
+		return []encodingField{bitField(w, "rotate", 11, 8, "imm8 is rotated right by twice this, " + strconv.Itoa(int(2 * rotate))),
+			bitField(w, "imm8", 7, 0, "#0x" + strconv.FormatUint(uint64(value), 16) + " once rotated")}
+	}
+
+	return armShiftedRegister(w)
+}
+
+// Breaks down a register shifted by an immediate or by another register
+func armShiftedRegister(w uint32) []encodingField {
+	shift := armShiftTypes[bitsOf(w, 6, 5)]
+	rm := bitField(w, "Rm", 3, 0, armRegisterName(bitsOf(w, 3, 0)))
+
+	if bitsOf(w, 4, 4) == 1 {
+		return []encodingField{bitField(w, "Rs", 11, 8, "shifted by " + armRegisterName(bitsOf(w, 11, 8))),
+			bitField(w, "0", 7, 7, ""), bitField(w, "type", 6, 5, shift), bitField(w, "1", 4, 4, "shifted by a register"), rm}
+	}
+
+	amount := bitField(w, "imm5", 11, 7, shift + " #" + strconv.Itoa(int(bitsOf(w, 11, 7))))
+
+	switch {
+	case bitsOf(w, 11, 7) == 0 && shift == "lsl":
+		amount.notes[0] = "bits 11-7: no shift"
+	case bitsOf(w, 11, 7) == 0 && shift == "ror":
+		amount.notes[0] = "bits 11-7: rrx, rotate right by 1 through the carry flag"
+	case bitsOf(w, 11, 7) == 0:
+		amount.notes[0] = "bits 11-7: " + shift + " #32"
+	}
+
+	return []encodingField{amount, bitField(w, "type", 6, 5, shift), bitField(w, "0", 4, 4, "shifted by an immediate"), rm}
+}
+
+// Breaks a Thumb instruction into its bitfields, 16-bit ones or the two halfwords of a 32-bit Thumb-2 one
+func thumbEncoding(code []byte) []encodingField {
+	if len(code) < 2 {
+		return nil
+	}
+
+	first := uint32(binary.LittleEndian.Uint16(code))
+
+	if len(code) >= 4 && bitsOf(first, 15, 11) >= 0x1d {
+		return thumb2Encoding(first << 16 | uint32(binary.LittleEndian.Uint16(code[2:])))
+	}
+
+	return thumb16Encoding(first)
+}
+
+// Breaks a 16-bit Thumb instruction into its bitfields
+func thumb16Encoding(h uint32) []encodingField {
+	low := func(name string, hi uint, lo uint) encodingField {
+		return bitField(h, name, hi, lo, armRegisterName(bitsOf(h, hi, lo)))
+	}
+
+	imm := func(name string, hi uint, lo uint, scale uint32, note string) encodingField {
+		value := bitsOf(h, hi, lo) * scale
+		return bitField(h, name, hi, lo, "#0x" + strconv.FormatUint(uint64(value), 16) + note)
+	}
+
+	switch {
+	case bitsOf(h, 15, 11) == 3:
+		// add and sub with a register or a 3-bit immediate
+		operand := low("Rm", 8, 6)
+		if bitsOf(h, 10, 10) == 1 {
+			operand = imm("imm3", 8, 6, 1, "")
+		}
+
+		return []encodingField{bitField(h, "op", 15, 11, "add or subtract"), bitField(h, "I", 10, 10, flagNote(h, 10, "an immediate", "a register")),
+			bitField(h, "sub", 9, 9, flagNote(h, 9, "subs", "adds")), operand, low("Rn", 5, 3), low("Rd", 2, 0)}
+	case bitsOf(h, 15, 13) == 0:
+		return []encodingField{bitField(h, "op", 15, 13, "shift by an immediate"), bitField(h, "type", 12, 11, armShiftTypes[bitsOf(h, 12, 11)] + "s"),
+			imm("imm5", 10, 6, 1, ""), low("Rm", 5, 3), low("Rd", 2, 0)}
+	case bitsOf(h, 15, 13) == 1:
+		names := []string{"movs", "cmp", "adds", "subs"}
+		return []encodingField{bitField(h, "op", 15, 13, "8-bit immediate"), bitField(h, "opc", 12, 11, names[bitsOf(h, 12, 11)]),
+			low("Rdn", 10, 8), imm("imm8", 7, 0, 1, "")}
+	case bitsOf(h, 15, 10) == 0x10:
+		return []encodingField{bitField(h, "op", 15, 10, "data processing on low registers"), bitField(h, "opc", 9, 6, thumbDataOpcodes[bitsOf(h, 9, 6)]),
+			low("Rm", 5, 3), low("Rdn", 2, 0)}
+	case bitsOf(h, 15, 10) == 0x11:
+		names := []string{"add", "cmp", "mov", "bx or blx"}
+		rdn := bitsOf(h, 7, 7) << 3 | bitsOf(h, 2, 0)
+		fields := []encodingField{bitField(h, "op", 15, 10, "high registers and branch exchange"), bitField(h, "opc", 9, 8, names[bitsOf(h, 9, 8)])}
+
+		if bitsOf(h, 9, 8) == 3 {
+			return append(fields, bitField(h, "L", 7, 7, flagNote(h, 7, "blx", "bx")), low("Rm", 6, 3), bitField(h, "000", 2, 0, ""))
+		}
+
+		return append(fields, bitField(h, "DN", 7, 7, "top bit of Rdn, " + armRegisterName(rdn)), low("Rm", 6, 3), bitField(h, "Rdn", 2, 0, "rest of Rdn"))
+	case bitsOf(h, 15, 11) == 9:
+		return []encodingField{bitField(h, "op", 15, 11, "ldr from a pc relative address"), low("Rt", 10, 8),
+			imm("imm8", 7, 0, 4, " (imm8 times 4) past pc rounded down to a word, pc is 4 bytes past the instruction")}
+	case bitsOf(h, 15, 12) == 5:
+		names := []string{"str", "strh", "strb", "ldrsb", "ldr", "ldrh", "ldrb", "ldrsh"}
+		return []encodingField{bitField(h, "op", 15, 12, "load or store with a register offset"), bitField(h, "opB", 11, 9, names[bitsOf(h, 11, 9)]),
+			low("Rm", 8, 6), low("Rn", 5, 3), low("Rt", 2, 0)}
+	case bitsOf(h, 15, 13) == 3 || bitsOf(h, 15, 12) == 8:
+		size, scale, name := "a word", uint32(4), "B"
+
+		if bitsOf(h, 15, 12) == 8 {
+			size, scale, name = "a halfword", 2, "op"
+		} else if bitsOf(h, 12, 12) == 1 {
+			size, scale = "a byte", 1
+		}
+
+		fields := []encodingField{bitField(h, "op", 15, 13, "load or store " + size + " with an immediate offset")}
+
+		if name == "B" {
+			fields = append(fields, bitField(h, "B", 12, 12, flagNote(h, 12, "a byte", "a word")))
+		} else {
+			fields[0] = bitField(h, "op", 15, 12, "load or store " + size + " with an immediate offset")
+		}
+
+		return append(fields, bitField(h, "L", 11, 11, flagNote(h, 11, "load", "store")),
+			imm("imm5", 10, 6, scale, " offset"), low("Rn", 5, 3), low("Rt", 2, 0))
+	case bitsOf(h, 15, 12) == 9:
+		return []encodingField{bitField(h, "op", 15, 12, "load or store relative to sp"), bitField(h, "L", 11, 11, flagNote(h, 11, "load", "store")),
+			low("Rt", 10, 8), imm("imm8", 7, 0, 4, " (imm8 times 4) offset from sp")}
+	case bitsOf(h, 15, 12) == 10:
+		return []encodingField{bitField(h, "op", 15, 12, "add to pc or sp"), bitField(h, "SP", 11, 11, flagNote(h, 11, "add to sp", "adr, add to pc")),
+			low("Rd", 10, 8), imm("imm8", 7, 0, 4, " (imm8 times 4)")}
+	case bitsOf(h, 15, 8) == 0xb0:
+		return []encodingField{bitField(h, "op", 15, 8, "adjust sp"), bitField(h, "S", 7, 7, flagNote(h, 7, "sub sp", "add sp")),
+			imm("imm7", 6, 0, 4, " (imm7 times 4)")}
+	case bitsOf(h, 15, 12) == 11 && bitsOf(h, 10, 9) == 2:
+		extra := flagNote(h, 11, "pc", "lr")
+		list := bitsOf(h, 7, 0) | bitsOf(h, 8, 8) << 14
+
+		if bitsOf(h, 11, 11) == 1 {
+			list = bitsOf(h, 7, 0) | bitsOf(h, 8, 8) << 15
+		}
+
+		return []encodingField{bitField(h, "op", 15, 12, "miscellaneous"), bitField(h, "L", 11, 11, flagNote(h, 11, "pop", "push")),
+			bitField(h, "10", 10, 9, ""), bitField(h, "R", 8, 8, flagNote(h, 8, "includes " + extra, "doesn't include " + extra)),
+			bitField(h, "register_list", 7, 0, armRegisterList(list))}
+	case bitsOf(h, 15, 12) == 11 && bitsOf(h, 10, 10) == 0 && bitsOf(h, 8, 8) == 1:
+		offset := bitsOf(h, 9, 9) << 6 | bitsOf(h, 7, 3) << 1
+		return []encodingField{bitField(h, "op", 15, 12, "miscellaneous"), bitField(h, "nz", 11, 11, flagNote(h, 11, "cbnz", "cbz")),
+			bitField(h, "0", 10, 10, ""), bitField(h, "i", 9, 9, "top bit of the offset"), bitField(h, "1", 8, 8, ""),
+			bitField(h, "imm5", 7, 3, "offset +0x" + strconv.FormatUint(uint64(offset), 16) + " from pc, 4 bytes past the instruction"), low("Rn", 2, 0)}
+	case bitsOf(h, 15, 8) == 0xbf && bitsOf(h, 3, 0) != 0:
+		return []encodingField{bitField(h, "op", 15, 8, "it, makes up to 4 following instructions conditional"),
+			bitField(h, "firstcond", 7, 4, armConditionNote(bitsOf(h, 7, 4))),
+			bitField(h, "mask", 3, 0, "how many instructions, and whether each has the condition or its opposite")}
+	case bitsOf(h, 15, 12) == 12:
+		return []encodingField{bitField(h, "op", 15, 12, "load or store multiple"), bitField(h, "L", 11, 11, flagNote(h, 11, "ldm", "stm")),
+			low("Rn", 10, 8), bitField(h, "register_list", 7, 0, armRegisterList(bitsOf(h, 7, 0)))}
+	case bitsOf(h, 15, 8) == 0xdf:
+		return []encodingField{bitField(h, "op", 15, 8, "svc, a system call"), imm("imm8", 7, 0, 1, ", ignored by Linux (which takes the number from r7)")}
+	case bitsOf(h, 15, 12) == 13 && bitsOf(h, 11, 8) < 14:
+		offset := signExtend(bitsOf(h, 7, 0) << 1, 9)
+		return []encodingField{bitField(h, "op", 15, 12, "conditional branch"), bitField(h, "cond", 11, 8, armConditionNote(bitsOf(h, 11, 8))),
+			bitField(h, "imm8", 7, 0, "offset " + signedOffset(offset) + " (imm8 times 2) from pc, 4 bytes past the instruction")}
+	case bitsOf(h, 15, 11) == 0x1c:
+		offset := signExtend(bitsOf(h, 10, 0) << 1, 12)
+		return []encodingField{bitField(h, "op", 15, 11, "branch"),
+			bitField(h, "imm11", 10, 0, "offset " + signedOffset(offset) + " (imm11 times 2) from pc, 4 bytes past the instruction")}
+	}
+
+	return []encodingField{bitField(h, "op", 15, 0, "see !manual for this instruction's fields")}
+}
+
+// Expands a Thumb-2 modified immediate, which repeats a byte across the word or rotates one with its top bit set
+func thumbExpandImm(imm12 uint32) uint32 {
+	b := imm12 & 0xff
+
+	switch {
+	case imm12 >> 10 != 0:
+		value := 0x80 | imm12 & 0x7f
+		rotate := imm12 >> 7
+		return value >> rotate | value << (32 - rotate)
+	case imm12 >> 8 == 1:
+		return b << 16 | b
+	case imm12 >> 8 == 2:
+		return b << 24 | b << 8
+	case imm12 >> 8 == 3:
+		return b << 24 | b << 16 | b << 8 | b
+	}
+
+	return b
+}
+
+// Breaks a 32-bit Thumb-2 instruction into its bitfields, the first halfword is the top 16 bits of the word
+func thumb2Encoding(w uint32) []encodingField {
+	reg := func(name string, hi uint, lo uint) encodingField {
+		return bitField(w, name, hi, lo, armRegisterName(bitsOf(w, hi, lo)))
+	}
+
+	switch {
+	case bitsOf(w, 31, 27) == 0x1e && bitsOf(w, 15, 15) == 1 && (bitsOf(w, 14, 14) == 1 || bitsOf(w, 12, 12) == 1):
+		// The offset's top bits are stored as J1 and J2, which are the sign bit XNORed with them
+		s := bitsOf(w, 26, 26)
+		i1, i2 := ^(bitsOf(w, 13, 13) ^ s) & 1, ^(bitsOf(w, 11, 11) ^ s) & 1
+		offset := signExtend(s << 24 | i1 << 23 | i2 << 22 | bitsOf(w, 25, 16) << 12 | bitsOf(w, 10, 0) << 1, 25)
+
+		return []encodingField{bitField(w, "op", 31, 27, "branch"), bitField(w, "S", 26, 26, "sign of the offset"),
+			bitField(w, "imm10", 25, 16, "offset " + signedOffset(offset) + " from pc, 4 bytes past the instruction"),
+			bitField(w, "1", 15, 15, ""), bitField(w, "L", 14, 14, flagNote(w, 14, "saves the return address in lr", "b.w")),
+			bitField(w, "J1", 13, 13, "I1 = not (J1 xor S)"), bitField(w, "T", 12, 12, flagNote(w, 12, "stays in Thumb", "blx, switching to ARM")),
+			bitField(w, "J2", 11, 11, "I2 = not (J2 xor S)"), bitField(w, "imm11", 10, 0, "low bits of the offset, which is S:I1:I2:imm10:imm11 times 2")}
+	case bitsOf(w, 31, 27) == 0x1e && bitsOf(w, 15, 14) == 2 && bitsOf(w, 12, 12) == 0 && bitsOf(w, 25, 23) != 7:
+		// The conditional form has no room for the XNOR, its J1 and J2 are the offset's bits as they are
+		offset := signExtend(bitsOf(w, 26, 26) << 20 | bitsOf(w, 11, 11) << 19 | bitsOf(w, 13, 13) << 18 | bitsOf(w, 21, 16) << 12 | bitsOf(w, 10, 0) << 1, 21)
+
+		return []encodingField{bitField(w, "op", 31, 27, "conditional branch"), bitField(w, "S", 26, 26, "sign of the offset"),
+			bitField(w, "cond", 25, 22, armConditionNote(bitsOf(w, 25, 22))),
+			bitField(w, "imm6", 21, 16, "offset " + signedOffset(offset) + " from pc, 4 bytes past the instruction"),
+			bitField(w, "10", 15, 14, ""), bitField(w, "J1", 13, 13, "bit 18 of the offset"), bitField(w, "0", 12, 12, ""),
+			bitField(w, "J2", 11, 11, "bit 19 of the offset"), bitField(w, "imm11", 10, 0, "low bits of the offset, which is S:J2:J1:imm6:imm11 times 2")}
+	case bitsOf(w, 31, 27) == 0x1e && bitsOf(w, 15, 15) == 0 && bitsOf(w, 25, 25) == 0:
+		names := map[uint32]string{0: "and (tst if Rd is pc)", 1: "bic", 2: "orr (mov if Rn is pc)", 3: "orn (mvn if Rn is pc)", 4: "eor (teq if Rd is pc)",
+			8: "add (cmn if Rd is pc)", 10: "adc", 11: "sbc", 13: "sub (cmp if Rd is pc)", 14: "rsb"}
+		imm12 := bitsOf(w, 26, 26) << 11 | bitsOf(w, 14, 12) << 8 | bitsOf(w, 7, 0)
+
+		return []encodingField{bitField(w, "op", 31, 27, "data processing"), bitField(w, "i", 26, 26, "top bit of the immediate"),
+			bitField(w, "0", 25, 25, "a modified immediate"), bitField(w, "opcode", 24, 21, names[bitsOf(w, 24, 21)]),
+			bitField(w, "S", 20, 20, flagNote(w, 20, "sets the flags", "leaves the flags alone")), reg("Rn", 19, 16), bitField(w, "0", 15, 15, ""),
+			bitField(w, "imm3", 14, 12, "middle bits of the immediate"), reg("Rd", 11, 8),
+			bitField(w, "imm8", 7, 0, "i:imm3:imm8 expands to #0x" + strconv.FormatUint(uint64(thumbExpandImm(imm12)), 16))}
+	case bitsOf(w, 31, 27) == 0x1e && bitsOf(w, 15, 15) == 0:
+		names := map[uint32]string{0: "addw", 4: "movw", 10: "subw", 12: "movt"}
+		imm := bitsOf(w, 26, 26) << 11 | bitsOf(w, 14, 12) << 8 | bitsOf(w, 7, 0)
+		rn := reg("Rn", 19, 16)
+
+		if bitsOf(w, 24, 20) == 4 || bitsOf(w, 24, 20) == 12 {
+			imm |= bitsOf(w, 19, 16) << 12
+			rn = bitField(w, "imm4", 19, 16, "top 4 bits of the immediate")
+		}
+
+		name := names[bitsOf(w, 24, 20)]
+		if name == "" {
+			name = "a bitfield or saturate instruction, see !manual"
+		}
+
+		return []encodingField{bitField(w, "op", 31, 27, "data processing"), bitField(w, "i", 26, 26, ""), bitField(w, "1", 25, 25, "a plain binary immediate"),
+			bitField(w, "op", 24, 20, name), rn, bitField(w, "0", 15, 15, ""), bitField(w, "imm3", 14, 12, ""), reg("Rd", 11, 8),
+			bitField(w, "imm8", 7, 0, "the immediate is #0x" + strconv.FormatUint(uint64(imm), 16))}
+	case bitsOf(w, 31, 25) == 0x7c && bitsOf(w, 23, 23) == 1:
+		sizes := []string{"a byte", "a halfword", "a word", "?"}
+		return []encodingField{bitField(w, "op", 31, 25, "load or store"), bitField(w, "S", 24, 24, flagNote(w, 24, "sign extends", "zero extends a load")),
+			bitField(w, "1", 23, 23, "a 12-bit offset"), bitField(w, "size", 22, 21, sizes[bitsOf(w, 22, 21)]),
+			bitField(w, "L", 20, 20, flagNote(w, 20, "load", "store")), reg("Rn", 19, 16), reg("Rt", 15, 12),
+			bitField(w, "imm12", 11, 0, "offset #0x" + strconv.FormatUint(uint64(bitsOf(w, 11, 0)), 16))}
+	case bitsOf(w, 31, 25) == 0x7c && bitsOf(w, 11, 11) == 1:
+		sizes := []string{"a byte", "a halfword", "a word", "?"}
+		return []encodingField{bitField(w, "op", 31, 25, "load or store"), bitField(w, "S", 24, 24, flagNote(w, 24, "sign extends", "zero extends a load")),
+			bitField(w, "0", 23, 23, "an 8-bit offset"), bitField(w, "size", 22, 21, sizes[bitsOf(w, 22, 21)]),
+			bitField(w, "L", 20, 20, flagNote(w, 20, "load", "store")), reg("Rn", 19, 16), reg("Rt", 15, 12), bitField(w, "1", 11, 11, ""),
+			bitField(w, "P", 10, 10, flagNote(w, 10, "pre-indexed", "post-indexed")), bitField(w, "U", 9, 9, flagNote(w, 9, "added", "subtracted")),
+			bitField(w, "W", 8, 8, flagNote(w, 8, "writes back", "doesn't write back")),
+			bitField(w, "imm8", 7, 0, "offset #0x" + strconv.FormatUint(uint64(bitsOf(w, 7, 0)), 16))}
+	}
+
+	return []encodingField{bitField(w, "hw1", 31, 16, "first halfword, a 32-bit Thumb-2 instruction"),
+		bitField(w, "hw2", 15, 0, "second halfword, see !manual for this instruction's fields")}
+}
+
+// Finds the rotation that makes a value an A32 modified immediate, an 8-bit value rotated right by an even amount
+func armRotatedImm(value uint32) (rotate uint32, imm8 uint32, ok bool) {
+	for rotate = 0; rotate < 16; rotate++ {
+		imm8 = value << (2 * rotate) | value >> (32 - 2 * rotate)
+
+		if rotate == 0 {
+			imm8 = value
+		}
+
+		if imm8 < 0x100 {
+			return rotate, imm8, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// Finds the 12-bit Thumb-2 modified immediate a value is encoded as, if it's one of the patterns thumbExpandImm takes
+func thumbModifiedImm(value uint32) (uint32, bool) {
+	b, high := value & 0xff, value >> 8 & 0xff
+
+	switch value {
+	case b:
+		return b, true
+	case b << 16 | b:
+		return 0x100 | b, true
+	case high << 24 | high << 8:
+		return 0x200 | high, true
+	case b << 24 | b << 16 | b << 8 | b:
+		return 0x300 | b, true
+	}
+
+	// Otherwise it's 1bcdefgh rotated right by 8 to 31
+	for rotate := uint32(8); rotate < 32; rotate++ {
+		unrotated := value << rotate | value >> (32 - rotate)
+
+		if unrotated >= 0x80 && unrotated < 0x100 {
+			return rotate << 7 | unrotated & 0x7f, true
+		}
+	}
+
+	return 0, false
+}
+
+// Finds the N, immr and imms fields of an AArch64 logical (bitmask) immediate: a run of ones, rotated, repeated
+// across the register in elements of 2 to 64 bits
+func arm64LogicalImm(value uint64, regBits uint) (n uint64, immr uint64, imms uint64, ok bool) {
+	if regBits == 32 {
+		value = value & 0xffffffff | value << 32
+	}
+
+	if value == 0 || value == ^uint64(0) {
+		return 0, 0, 0, false
+	}
+
+	size := uint(64)
+
+	// The smallest element that repeats to make the value
+	for size > 2 {
+		half := size / 2
+		mask := uint64(1) << half - 1
+
+		if value & mask != value >> half & mask {
+			break
+		}
+
+		size = half
+	}
+
+	if size == 64 && regBits == 32 {
+		return 0, 0, 0, false
+	}
+
+	mask := ^uint64(0) >> (64 - size)
+	element := value & mask
+	ones := uint(0)
+
+	for bit := uint(0); bit < size; bit++ {
+		ones += uint(element >> bit & 1)
+	}
+
+	for r := uint(0); r < size; r++ {
+		rotated := (element >> r | element << (size - r)) & mask
+
+		if rotated == 1 << ones - 1 {
+			if size == 64 {
+				n = 1
+			}
+
+			return n, uint64((size - r) % size), uint64(^(size * 2 - 1) & 0x3f | (ones - 1)), true
+		}
+	}
+
+	return 0, 0, 0, false
+}
+
+// Splits a value into the movz (or movn) and movk instructions that build it 16 bits at a time
+func arm64MoveSequence(value uint64, reg string) []string {
+	zeros, ones := 0, 0
+
+	for shift := uint(0); shift < 64; shift += 16 {
+		switch value >> shift & 0xffff {
+		case 0:
+			zeros++
+		case 0xffff:
+			ones++
+		}
+	}
+
+	// With more 0xffff chunks than zero ones, starting from all ones with movn takes fewer instructions
+	fill, first := uint64(0), "movz"
+	if ones > zeros {
+		fill, first = 0xffff, "movn"
+	}
+
+	var out []string
+
+	for shift := uint(0); shift < 64; shift += 16 {
+		chunk := value >> shift & 0xffff
+
+		if chunk == fill {
+			continue
+		}
+
+		ins, imm := "movk", chunk
+
+		if len(out) == 0 {
+			ins = first
+			if first == "movn" {
+				imm = ^chunk & 0xffff
+			}
+		}
+
+		line := ins + " " + reg + ", #0x" + strconv.FormatUint(imm, 16)
+		if shift != 0 {
+			line += ", lsl #" + strconv.Itoa(int(shift))
+		}
+
+		out = append(out, line)
+	}
+
+	// Every chunk was the fill, so the first instruction alone makes it
+	if len(out) == 0 {
+		out = append(out, first + " " + reg + ", #0x0")
+	}
+
+	return out
+}
+
+// Parses the value given to !armimm, negative values are taken as two's complement
+func parseImmediate(text string) (uint64, bool) {
+	if strings.HasPrefix(text, "-") {
+		value, err := strconv.ParseInt(text, 0, 64)
+		return uint64(value), err == nil
+	}
+
+	value, err := strconv.ParseUint(text, 0, 64)
+	return value, err == nil
+}
+
+// Checks whether a constant can be an immediate in ARM, Thumb-2 and AArch64 instructions, or how to load it if not
+func cmdArmimm(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	value, ok := parseImmediate(args[1])
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + args[1] + "' isn't a number I can read. Give it in decimal or hex, i.e. 0xff000000 or -1.")
+		return
+	}
+
+	hex := "#0x" + strconv.FormatUint(value, 16)
+	out := ""
+
+	// A 32-bit value, or a negative one that still fits in 32 bits
+	word, fits32 := uint32(value), value < 1 << 32 || int64(value) >= -1 << 31
+
+	if fits32 {
+		hex = "#0x" + strconv.FormatUint(uint64(word), 16)
+		out += "ARM (A32)\n"
+
+		if rotate, imm8, ok := armRotatedImm(word); ok {
+			out += "  yes: imm8 0x" + strconv.FormatUint(uint64(imm8), 16) + " rotated right by " + strconv.Itoa(int(rotate * 2)) + ", i.e. mov r0, " + hex + "\n"
+		} else {
+			out += "  no, it isn't 8 bits rotated right by an even amount\n"
+		}
+
+		if _, _, ok := armRotatedImm(^word); ok {
+			out += "  its inverse #0x" + strconv.FormatUint(uint64(^word), 16) + " is, so mvn r0, #0x" + strconv.FormatUint(uint64(^word), 16) + " or bic with it works\n"
+		}
+
+		if _, _, ok := armRotatedImm(-word); ok && word != 0 {
+			out += "  its negation #0x" + strconv.FormatUint(uint64(-word), 16) + " is, so sub or cmn with it works in place of add or cmp\n"
+		}
+
+		out += "\nThumb-2\n"
+
+		if imm12, ok := thumbModifiedImm(word); ok {
+			out += "  yes: i:imm3:imm8 = 0x" + strconv.FormatUint(uint64(imm12), 16) + ", i.e. mov.w r0, " + hex + "\n"
+		} else if word < 0x1000 {
+			out += "  not as a modified immediate, but addw, subw or movw take it as a plain 12-bit immediate\n"
+		} else {
+			out += "  no, it isn't 8 bits repeated (0x00XY00XY, 0xXY00XY00, 0xXYXYXYXY) or 1bcdefgh rotated\n"
+		}
+
+		if _, ok := thumbModifiedImm(^word); ok {
+			out += "  its inverse #0x" + strconv.FormatUint(uint64(^word), 16) + " is, so mvn r0, #0x" + strconv.FormatUint(uint64(^word), 16) + " works\n"
+		}
+
+		out += "\n"
+	}
+
+	out += "AArch64\n"
+
+	if value < 0x1000 || value & 0xfff == 0 && value < 0x1000000 {
+		out += "  add, sub, cmp: yes, as a 12-bit immediate"
+		if value >= 0x1000 {
+			out += " shifted left by 12, #0x" + strconv.FormatUint(value >> 12, 16) + ", lsl #12"
+		}
+		out += "\n"
+	} else {
+		out += "  add, sub, cmp: no, they take 12 bits, optionally shifted left by 12\n"
+	}
+
+	for _, reg := range []uint{64, 32} {
+		if reg == 32 && !fits32 {
+			continue
+		}
+
+		v := value
+		if reg == 32 {
+			v = uint64(word)
+		}
+
+		name := map[uint]string{64: "x", 32: "w"}[reg]
+
+		if n, immr, imms, ok := arm64LogicalImm(v, reg); ok {
+			out += "  and, orr, eor (" + name + "): yes, N=" + strconv.Itoa(int(n)) + " immr=" + strconv.Itoa(int(immr)) + " imms=" + strconv.Itoa(int(imms)) + "\n"
+		} else {
+			out += "  and, orr, eor (" + name + "): no, it isn't a rotated run of ones repeated across the register\n"
+		}
+	}
+
+	// What to write when no single instruction takes it
+	var load []string
+
+	if fits32 {
+		if _, _, ok := armRotatedImm(word); !ok {
+			if _, _, ok := armRotatedImm(^word); !ok {
+				load = append(load, "ARM:     movw r0, #0x" + strconv.FormatUint(uint64(word & 0xffff), 16) + "; movt r0, #0x" + strconv.FormatUint(uint64(word >> 16), 16) + " (ARMv6T2 and later, Thumb-2 too), or ldr r0, =" + hex[1:] + " for a literal pool")
+			}
+		}
+	}
+
+	if _, _, _, ok := arm64LogicalImm(value, 64); !ok {
+		if sequence := arm64MoveSequence(value, "x0"); len(sequence) > 1 {
+			load = append(load, "AArch64: " + strings.Join(sequence, "; ") + ", or ldr x0, =0x" + strconv.FormatUint(value, 16) + " for a literal pool")
+		} else {
+			load = append(load, "AArch64: " + sequence[0] + " loads it in one instruction")
+		}
+	}
+
+	if len(load) > 0 {
+		out += "\nTo load it into a register:\n" + strings.Join(load, "\n") + "\n"
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "0x" + strconv.FormatUint(value, 16) + " as an immediate:```\n" + out + "```")
+}
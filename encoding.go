@@ -0,0 +1,677 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// Architectures !encoding can break instructions down for
+const encodingArchs = "x86, x86_16, x86_64/x64, arm, thumb"
+
+// A field of an instruction's encoding, i.e. its ModRM byte, with what each part of it means
+type encodingField struct {
+	name  string
+	bytes []byte
+	notes []string
+
+	// Set instead of bytes for fields that aren't whole bytes, like ARM's, to the field's bits
+	bits string
+}
+
+// What x86's legacy prefixes do
+var x86PrefixNotes = map[byte]string{
+	0xf0: "lock, makes the memory access atomic",
+	0xf2: "repne, repeats a string instruction while the values aren't equal",
+	0xf3: "rep/repe, repeats a string instruction",
+	0x2e: "cs segment override (before a jcc, a hint that the branch isn't taken)",
+	0x36: "ss segment override",
+	0x3e: "ds segment override (before a jcc, a hint that the branch is taken)",
+	0x26: "es segment override",
+	0x64: "fs segment override",
+	0x65: "gs segment override",
+	0x66: "operand size override",
+	0x67: "address size override",
+}
+
+// One-byte opcodes that are followed by a ModRM byte
+var x86ModRMOpcodes = func() map[byte]bool {
+	modrm := make(map[byte]bool)
+
+	// The ALU instructions, add through cmp, have ModRM forms in the first 4 of every 8 opcodes
+	for op := 0x00; op < 0x40; op += 8 {
+		for n := 0; n < 4; n++ {
+			modrm[byte(op + n)] = true
+		}
+	}
+
+	for _, op := range []int{0x62, 0x63, 0x69, 0x6b, 0xc0, 0xc1, 0xc4, 0xc5, 0xc6, 0xc7, 0xd0, 0xd1, 0xd2, 0xd3, 0xf6, 0xf7, 0xfe, 0xff} {
+		modrm[byte(op)] = true
+	}
+
+	for op := 0x80; op <= 0x8f; op++ {
+		modrm[byte(op)] = true
+	}
+
+	for op := 0xd8; op <= 0xdf; op++ {
+		modrm[byte(op)] = true
+	}
+
+	return modrm
+}()
+
+// Two-byte (0F) opcodes that aren't followed by a ModRM byte, nearly all of them are
+var x86NoModRMOpcodes0F = func() map[byte]bool {
+	none := map[byte]bool{0x05: true, 0x06: true, 0x07: true, 0x08: true, 0x09: true, 0x0b: true, 0x0e: true,
+		0x77: true, 0xa0: true, 0xa1: true, 0xa2: true, 0xa8: true, 0xa9: true, 0xaa: true}
+
+	for op := 0x30; op <= 0x37; op++ {
+		none[byte(op)] = true
+	}
+
+	// Jumps with a 32-bit offset, and bswap with the register in the opcode
+	for op := 0x80; op <= 0x8f; op++ {
+		none[byte(op)] = true
+	}
+
+	for op := 0xc8; op <= 0xcf; op++ {
+		none[byte(op)] = true
+	}
+
+	return none
+}()
+
+// Opcodes whose ModRM reg field is part of the opcode, written /0 to /7 in the manuals
+var (
+	x86GroupOpcodes   = []byte{0x80, 0x81, 0x82, 0x83, 0x8f, 0xc0, 0xc1, 0xc6, 0xc7, 0xd0, 0xd1, 0xd2, 0xd3, 0xd8, 0xd9, 0xda, 0xdb, 0xdc, 0xdd, 0xde, 0xdf, 0xf6, 0xf7, 0xfe, 0xff}
+	x86GroupOpcodes0F = []byte{0x00, 0x01, 0x0d, 0x18, 0x1f, 0x71, 0x72, 0x73, 0xae, 0xba, 0xc7}
+)
+
+// Registers Capstone names in x86 operands, by the number the encoding gives them
+var x86RegisterNumbers = func() map[string]int {
+	numbers := map[string]int{"ah": 4, "ch": 5, "dh": 6, "bh": 7, "es": 0, "cs": 1, "ss": 2, "ds": 3, "fs": 4, "gs": 5}
+	sets := [][]string{
+		{"rax", "rcx", "rdx", "rbx", "rsp", "rbp", "rsi", "rdi"},
+		{"eax", "ecx", "edx", "ebx", "esp", "ebp", "esi", "edi"},
+		{"ax", "cx", "dx", "bx", "sp", "bp", "si", "di"},
+		{"al", "cl", "dl", "bl", "spl", "bpl", "sil", "dil"},
+	}
+
+	for _, set := range sets {
+		for n, reg := range set {
+			numbers[reg] = n
+		}
+	}
+
+	for n := 0; n < 32; n++ {
+		if n >= 8 && n < 16 {
+			for _, suffix := range []string{"", "d", "w", "b"} {
+				numbers["r" + strconv.Itoa(n) + suffix] = n
+			}
+		}
+
+		for _, prefix := range []string{"xmm", "ymm", "zmm"} {
+			numbers[prefix + strconv.Itoa(n)] = n
+		}
+
+		if n < 8 {
+			for _, prefix := range []string{"mm", "k", "dr"} {
+				numbers[prefix + strconv.Itoa(n)] = n
+			}
+
+			numbers["st(" + strconv.Itoa(n) + ")"] = n
+		}
+
+		if n < 16 {
+			numbers["cr" + strconv.Itoa(n)] = n
+		}
+	}
+
+	return numbers
+}()
+
+// Register names in an x86 operand string
+var x86RegisterTokenRegexp = regexp.MustCompile(`[a-z][a-z0-9]*(\(\d\))?`)
+
+// Finds the register numbered n in the instruction's operands, looking in its memory operands or the others
+func x86OperandRegister(ins asm.Insn, n int, memory bool) string {
+	for _, op := range splitOperands(ins.OpStr) {
+		if strings.Contains(op, "[") != memory {
+			continue
+		}
+
+		// Only the address in a memory operand has registers
+		if memory {
+			op = op[strings.Index(op, "[") : strings.LastIndex(op, "]") + 1]
+		}
+
+		for _, token := range x86RegisterTokenRegexp.FindAllString(op, -1) {
+			if number, ok := x86RegisterNumbers[token]; ok && number == n {
+				return token
+			}
+		}
+	}
+
+	return "register " + strconv.Itoa(n)
+}
+
+// Formats a value as binary with the given number of digits
+func binaryDigits(value int, digits int) string {
+	return padLeft(strconv.FormatInt(int64(value), 2), "0", digits)
+}
+
+// Reads a little endian value of up to 8 bytes
+func littleEndian(b []byte) uint64 {
+	value := uint64(0)
+
+	for n := len(b) - 1; n >= 0; n-- {
+		value = value << 8 | uint64(b[n])
+	}
+
+	return value
+}
+
+// Formats a little endian value as signed hex, like displacements are written
+func signedHex(b []byte) string {
+	value := int64(littleEndian(b))
+
+	if shift := uint(64 - 8 * len(b)); shift > 0 {
+		value = value << shift >> shift
+	}
+
+	if value < 0 {
+		return "-0x" + strconv.FormatInt(-value, 16)
+	}
+
+	return "0x" + strconv.FormatInt(value, 16)
+}
+
+// Breaks an x86 instruction's encoding into its fields. bits is the mode it's decoded in, 16, 32 or 64. The
+// instruction's length comes from Capstone, so whatever is left after the ModRM, SIB and displacement is the
+// immediate.
+func x86Encoding(bits int, ins asm.Insn) []encodingField {
+	code := ins.Bytes
+	var fields []encodingField
+	pos := 0
+
+	operandSize, addressSize := 32, bits
+	if bits == 16 {
+		operandSize = 16
+	}
+
+	var prefixes []byte
+
+	for pos < len(code) && x86PrefixNotes[code[pos]] != "" {
+		prefixes = append(prefixes, code[pos])
+
+		switch code[pos] {
+		case 0x66:
+			operandSize = 48 - operandSize
+		case 0x67:
+			if bits == 64 {
+				addressSize = 32
+			} else {
+				addressSize = 48 - bits
+			}
+		}
+
+		pos++
+	}
+
+	// Set from REX, VEX or EVEX, the extra bit for the ModRM and SIB fields so they reach r8-r15
+	rexW, rexR, rexX, rexB := 0, 0, 0, 0
+	vex := false
+	opcodeMap := ""
+
+	switch {
+	case bits == 64 && pos < len(code) && code[pos] & 0xf0 == 0x40:
+		rex := int(code[pos])
+		rexW, rexR, rexX, rexB = rex >> 3 & 1, rex >> 2 & 1, rex >> 1 & 1, rex & 1
+
+		notes := []string{"0100 " + strconv.Itoa(rexW) + strconv.Itoa(rexR) + strconv.Itoa(rexX) + strconv.Itoa(rexB)}
+		if rexW == 1 {
+			notes = append(notes, "W=1: 64-bit operands")
+			operandSize = 64
+		}
+
+		notes = append(notes, "R=" + strconv.Itoa(rexR) + " X=" + strconv.Itoa(rexX) + " B=" + strconv.Itoa(rexB) + ": extend ModRM.reg, SIB.index and ModRM.rm/SIB.base to reach r8-r15")
+		fields = append(fields, encodingField{name: "REX", bytes: code[pos : pos + 1], notes: notes})
+		pos++
+	case pos + 2 < len(code) && (code[pos] == 0xc4 || code[pos] == 0xc5 || code[pos] == 0x62) && (bits == 64 || code[pos + 1] >= 0xc0):
+		// Outside 64-bit mode these are les, lds and bound unless the next byte couldn't be their ModRM
+		vex = true
+		p := code[pos:]
+		var notes []string
+		size, vvvv, l, pp := 2, 0, 0, 0
+		maps := map[int]string{1: "0F", 2: "0F38", 3: "0F3A", 5: "MAP5", 6: "MAP6"}
+
+		switch p[0] {
+		case 0xc5:
+			rexR = int(p[1] >> 7 ^ 1)
+			vvvv, l, pp = int(p[1] >> 3 & 0xf ^ 0xf), int(p[1] >> 2 & 1), int(p[1] & 3)
+			opcodeMap = "0F"
+			notes = append(notes, "2-byte VEX, R=" + strconv.Itoa(rexR) + " (stored inverted)")
+		case 0xc4:
+			size = 3
+			rexR, rexX, rexB = int(p[1] >> 7 ^ 1), int(p[1] >> 6 & 1 ^ 1), int(p[1] >> 5 & 1 ^ 1)
+			rexW, vvvv, l, pp = int(p[2] >> 7), int(p[2] >> 3 & 0xf ^ 0xf), int(p[2] >> 2 & 1), int(p[2] & 3)
+			opcodeMap = maps[int(p[1] & 0x1f)]
+			notes = append(notes, "3-byte VEX, R=" + strconv.Itoa(rexR) + " X=" + strconv.Itoa(rexX) + " B=" + strconv.Itoa(rexB) +
+				" (stored inverted), map " + opcodeMap + ", W=" + strconv.Itoa(rexW))
+		default:
+			size = 4
+			if pos + 3 >= len(code) {
+				size = len(code) - pos
+				break
+			}
+
+			rexR, rexX, rexB = int(p[1] >> 7 ^ 1), int(p[1] >> 6 & 1 ^ 1), int(p[1] >> 5 & 1 ^ 1)
+			rexW, vvvv, pp = int(p[2] >> 7), int(p[2] >> 3 & 0xf ^ 0xf) | int(p[3] >> 3 & 1 ^ 1) << 4, int(p[2] & 3)
+			l = int(p[3] >> 5 & 3)
+			opcodeMap = maps[int(p[1] & 7)]
+
+			notes = append(notes, "EVEX, R=" + strconv.Itoa(rexR) + " X=" + strconv.Itoa(rexX) + " B=" + strconv.Itoa(rexB) +
+				" R'=" + strconv.Itoa(int(p[1] >> 4 & 1 ^ 1)) + " (stored inverted), map " + opcodeMap + ", W=" + strconv.Itoa(rexW))
+			notes = append(notes, "z=" + strconv.Itoa(int(p[3] >> 7)) + " (zero masked lanes), b=" + strconv.Itoa(int(p[3] >> 4 & 1)) +
+				" (broadcast or rounding), mask k" + strconv.Itoa(int(p[3] & 7)))
+		}
+
+		if rexW == 1 {
+			operandSize = 64
+		}
+
+		lengths := []string{"128", "256", "512", "?"}
+		if source := x86OperandRegister(ins, vvvv, false); vvvv == 0 && strings.HasPrefix(source, "register ") {
+			notes = append(notes, "vvvv=1111: no extra source, L: " + lengths[l] + "-bit vectors")
+		} else {
+			notes = append(notes, "vvvv: " + source + " (the extra source), L: " + lengths[l] + "-bit vectors")
+		}
+
+		if pp != 0 {
+			notes = append(notes, "pp=" + binaryDigits(pp, 2) + ": implied " + []string{"", "66", "F3", "F2"}[pp] + " prefix")
+		}
+
+		name := map[byte]string{0xc4: "VEX", 0xc5: "VEX", 0x62: "EVEX"}[p[0]]
+		fields = append(fields, encodingField{name: name, bytes: code[pos : pos + size], notes: notes})
+		pos += size
+	}
+
+	// Legacy prefixes can also be part of the opcode, picking an SSE instruction
+	var prefixFields []encodingField
+
+	for _, prefix := range prefixes {
+		note := x86PrefixNotes[prefix]
+		twoByte := !vex && pos + 1 < len(code) && code[pos] == 0x0f
+
+		switch {
+		case twoByte && (prefix == 0xf2 || prefix == 0xf3) && code[pos + 1] & 0xf0 != 0x80,
+			twoByte && prefix == 0x66 && strings.Contains(ins.OpStr, "xmm"):
+			note = "mandatory prefix, it's part of the opcode (" + note + " otherwise)"
+		case prefix == 0x66:
+			note += ", " + strconv.Itoa(operandSize) + "-bit operands"
+		case prefix == 0x67:
+			note += ", " + strconv.Itoa(addressSize) + "-bit addresses"
+		case prefix == 0xf2 && pos < len(code) && (code[pos] == 0xe8 || code[pos] == 0xe9 || code[pos] == 0xc3):
+			note = "bnd, the branch keeps its MPX bounds"
+		}
+
+		prefixFields = append(prefixFields, encodingField{name: "prefix", bytes: []byte{prefix}, notes: []string{note}})
+	}
+
+	fields = append(prefixFields, fields...)
+
+	if pos >= len(code) {
+		return fields
+	}
+
+	// The opcode, with the escape bytes that pick the opcode map
+	start := pos
+	modrm := true
+	group := false
+	var opcodeNotes []string
+
+	if opcodeMap == "" {
+		switch {
+		case code[pos] == 0x0f && pos + 1 < len(code) && (code[pos + 1] == 0x38 || code[pos + 1] == 0x3a):
+			opcodeMap = "0F" + strings.ToUpper(strconv.FormatInt(int64(code[pos + 1]), 16))
+			pos += 2
+		case code[pos] == 0x0f && pos + 1 < len(code):
+			opcodeMap = "0F"
+			pos++
+			modrm = !x86NoModRMOpcodes0F[code[pos]]
+			group = bytesContain(x86GroupOpcodes0F, code[pos])
+		default:
+			modrm = x86ModRMOpcodes[code[pos]]
+			group = bytesContain(x86GroupOpcodes, code[pos])
+
+			// Outside 64-bit mode, c4 and c5 are les and lds here
+			if bits == 64 && (code[pos] == 0xc4 || code[pos] == 0xc5) {
+				modrm = false
+			}
+		}
+	} else if opcodeMap == "0F" && code[pos] == 0x77 {
+		// vzeroupper and vzeroall
+		modrm = false
+	} else if opcodeMap == "0F" && code[pos] >= 0x71 && code[pos] <= 0x73 {
+		group = true
+	}
+
+	op := code[pos]
+	pos++
+
+	if opcodeMap == "" {
+		opcodeNotes = append(opcodeNotes, "one-byte opcode " + strconv.FormatInt(int64(op), 16))
+	} else if vex {
+		opcodeNotes = append(opcodeNotes, "opcode " + strconv.FormatInt(int64(op), 16) + " in the " + opcodeMap + " map")
+	} else {
+		opcodeNotes = append(opcodeNotes, "opcode " + strconv.FormatInt(int64(op), 16) + " after the " + opcodeMap + " escape")
+	}
+
+	// Some opcodes have the register in their low 3 bits instead of a ModRM byte
+	if inRange := func(low, high byte) bool { return op >= low && op <= high }; opcodeMap == "" && (inRange(0x50, 0x5f) ||
+		inRange(0x91, 0x97) || inRange(0xb0, 0xbf)) || opcodeMap == "0F" && !vex && inRange(0xc8, 0xcf) {
+		reg := int(op & 7) | rexB << 3
+		opcodeNotes = append(opcodeNotes, "the low 3 bits " + binaryDigits(int(op & 7), 3) + rexBit(bits, "B", rexB) +
+			" pick the register: " + x86OperandRegister(ins, reg, false))
+	}
+
+	if opcodeMap == "" && op & 0xfe == 0xa0 || opcodeMap == "" && op & 0xfe == 0xa2 {
+		// The moffs forms of mov have an address instead of a ModRM byte
+		modrm = false
+	}
+
+	fields = append(fields, encodingField{name: "opcode", bytes: code[start:pos], notes: opcodeNotes})
+
+	if modrm && pos < len(code) {
+		fields = append(fields, x86ModRM(ins, code[pos:], bits, addressSize, group, rexR, rexX, rexB, &pos)...)
+	}
+
+	// 3DNow! instructions put their opcode where an immediate would be
+	if pos < len(code) && opcodeMap == "0F" && !vex && op == 0x0f {
+		fields = append(fields, encodingField{name: "opcode", bytes: code[pos:], notes: []string{"3DNow! opcode suffix, after the ModRM"}})
+		return fields
+	}
+
+	if pos >= len(code) {
+		return fields
+	}
+
+	rest := code[pos:]
+
+	switch {
+	case opcodeMap == "" && (op >= 0x70 && op <= 0x7f || op >= 0xe0 && op <= 0xe3 || op == 0xe8 || op == 0xe9 || op == 0xeb),
+		opcodeMap == "0F" && !vex && op >= 0x80 && op <= 0x8f:
+		fields = append(fields, encodingField{name: "rel" + strconv.Itoa(8 * len(rest)), bytes: rest, notes: []string{"branch offset " + signedHex(rest) + " from the end of the instruction, to " + ins.OpStr}})
+	case opcodeMap == "" && op >= 0xa0 && op <= 0xa3:
+		fields = append(fields, encodingField{name: "moffs", bytes: rest, notes: []string{"memory address 0x" + strconv.FormatUint(littleEndian(rest), 16)}})
+	case opcodeMap == "" && (op == 0x9a || op == 0xea) && len(rest) > 2:
+		fields = append(fields, encodingField{name: "offset", bytes: rest[:len(rest) - 2], notes: []string{"far pointer offset 0x" + strconv.FormatUint(littleEndian(rest[:len(rest) - 2]), 16)}},
+			encodingField{name: "segment", bytes: rest[len(rest) - 2:], notes: []string{"far pointer segment 0x" + strconv.FormatUint(littleEndian(rest[len(rest) - 2:]), 16)}})
+	case opcodeMap == "" && op == 0xc8 && len(rest) == 3:
+		fields = append(fields, encodingField{name: "imm16", bytes: rest[:2], notes: []string{"bytes of locals, 0x" + strconv.FormatUint(littleEndian(rest[:2]), 16)}},
+			encodingField{name: "imm8", bytes: rest[2:], notes: []string{"nesting level " + strconv.Itoa(int(rest[2]))}})
+	default:
+		note := "0x" + strconv.FormatUint(littleEndian(rest), 16)
+		if signed := signedHex(rest); strings.HasPrefix(signed, "-") {
+			note += " (" + signed + " signed)"
+		}
+
+		fields = append(fields, encodingField{name: "imm" + strconv.Itoa(8 * len(rest)), bytes: rest, notes: []string{note}})
+	}
+
+	return fields
+}
+
+// Checks if a byte is in the list
+func bytesContain(list []byte, b byte) bool {
+	for _, item := range list {
+		if item == b {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Breaks down the ModRM byte at the start of code, and the SIB byte and displacement after it. pos is moved past
+// them.
+func x86ModRM(ins asm.Insn, code []byte, bits int, addressSize int, group bool, rexR int, rexX int, rexB int, pos *int) []encodingField {
+	modrm := int(code[0])
+	mod, reg, rm := modrm >> 6, modrm >> 3 & 7, modrm & 7
+	var fields []encodingField
+	dispSize := 0
+
+	notes := []string{binaryDigits(mod, 2) + " " + binaryDigits(reg, 3) + " " + binaryDigits(rm, 3)}
+	modNotes := []string{"a memory operand", "memory with an 8-bit displacement", "memory with a 32-bit displacement", "a register operand"}
+
+	if addressSize == 16 {
+		modNotes[2] = "memory with a 16-bit displacement"
+	}
+
+	notes = append(notes, "mod=" + binaryDigits(mod, 2) + ": r/m is " + modNotes[mod])
+
+	if group {
+		notes = append(notes, "reg=" + binaryDigits(reg, 3) + ": opcode extension /" + strconv.Itoa(reg))
+	} else {
+		notes = append(notes, "reg=" + binaryDigits(reg, 3) + rexBit(bits, "R", rexR) + ": " + x86OperandRegister(ins, reg | rexR << 3, false))
+	}
+
+	sib := false
+
+	switch {
+	case mod == 3:
+		notes = append(notes, "r/m=" + binaryDigits(rm, 3) + rexBit(bits, "B", rexB) + ": " + x86OperandRegister(ins, rm | rexB << 3, false))
+	case addressSize == 16:
+		// 16-bit addressing has its own table of base and index registers, and no SIB byte
+		addresses := []string{"bx + si", "bx + di", "bp + si", "bp + di", "si", "di", "bp", "bx"}
+		address := addresses[rm]
+
+		if mod == 0 && rm == 6 {
+			address, dispSize = "disp16", 2
+		}
+
+		if mod != 0 {
+			address += " + disp"
+		}
+
+		notes = append(notes, "r/m=" + binaryDigits(rm, 3) + ": [" + address + "]")
+	case rm == 4:
+		sib = true
+		notes = append(notes, "r/m=100: a SIB byte follows")
+	case mod == 0 && rm == 5:
+		dispSize = 4
+		if x86RIPRelative(ins) {
+			notes = append(notes, "r/m=101 with mod=00: [rip + disp32], relative to the next instruction")
+		} else {
+			notes = append(notes, "r/m=101 with mod=00: [disp32], an absolute address")
+		}
+	default:
+		address := x86OperandRegister(ins, rm | rexB << 3, true)
+
+		if mod != 0 {
+			address += " + disp"
+		}
+
+		notes = append(notes, "r/m=" + binaryDigits(rm, 3) + rexBit(bits, "B", rexB) + ": [" + address + "]")
+	}
+
+	fields = append(fields, encodingField{name: "ModRM", bytes: code[:1], notes: notes})
+	*pos++
+
+	if sib && len(code) > 1 {
+		b := int(code[1])
+		scale, index, base := b >> 6, b >> 3 & 7, b & 7
+		sibNotes := []string{binaryDigits(scale, 2) + " " + binaryDigits(index, 3) + " " + binaryDigits(base, 3),
+			"scale=" + binaryDigits(scale, 2) + ": index times " + strconv.Itoa(1 << uint(scale))}
+
+		if index == 4 && rexX == 0 {
+			sibNotes = append(sibNotes, "index=100: no index")
+		} else {
+			sibNotes = append(sibNotes, "index=" + binaryDigits(index, 3) + rexBit(bits, "X", rexX) + ": " + x86OperandRegister(ins, index | rexX << 3, true))
+		}
+
+		if base == 5 && mod == 0 {
+			sibNotes = append(sibNotes, "base=101 with mod=00: no base, a 32-bit displacement")
+			dispSize = 4
+		} else {
+			sibNotes = append(sibNotes, "base=" + binaryDigits(base, 3) + rexBit(bits, "B", rexB) + ": " + x86OperandRegister(ins, base | rexB << 3, true))
+		}
+
+		fields = append(fields, encodingField{name: "SIB", bytes: code[1:2], notes: sibNotes})
+		*pos++
+	}
+
+	switch {
+	case mod == 1:
+		dispSize = 1
+	case mod == 2 && addressSize == 16:
+		dispSize = 2
+	case mod == 2:
+		dispSize = 4
+	}
+
+	start := 1
+	if sib {
+		start = 2
+	}
+
+	if dispSize > 0 && start + dispSize <= len(code) {
+		disp := code[start : start + dispSize]
+		fields = append(fields, encodingField{name: "disp" + strconv.Itoa(8 * dispSize), bytes: disp, notes: []string{"displacement " + signedHex(disp)}})
+		*pos += dispSize
+	}
+
+	return fields
+}
+
+// Shows the REX (or VEX) bit a ModRM or SIB field is extended with, in 64-bit mode where there is one
+func rexBit(bits int, name string, bit int) string {
+	if bits != 64 {
+		return ""
+	}
+
+	return " (with REX." + name + " " + strconv.Itoa(bit) + ")"
+}
+
+// Checks if Capstone shows the instruction's memory operand relative to the instruction pointer
+func x86RIPRelative(ins asm.Insn) bool {
+	return strings.Contains(ins.OpStr, "[rip") || strings.Contains(ins.OpStr, "[eip")
+}
+
+// Shows the field as it's drawn, its bits if it's a bitfield and its bytes in hex otherwise
+func (field encodingField) text() string {
+	if field.bits != "" {
+		return field.bits
+	}
+
+	var out []string
+	for _, c := range field.bytes {
+		out = append(out, padLeft(strconv.FormatInt(int64(c), 16), "0", 2))
+	}
+
+	return strings.Join(out, " ")
+}
+
+// Draws the fields as a diagram under the instruction's bytes, with what each field means below it
+func formatEncoding(fields []encodingField) string {
+	top, bottom := "", ""
+	nameWidth, textWidth := 0, 0
+
+	for n, field := range fields {
+		width := len(field.text())
+		if len(field.name) > width {
+			width = len(field.name)
+		}
+
+		separator := " | "
+		if n == 0 {
+			separator = ""
+		}
+
+		top += separator + padRight(field.text(), " ", width)
+		bottom += separator + padRight(field.name, " ", width)
+
+		if len(field.name) > nameWidth {
+			nameWidth = len(field.name)
+		}
+
+		if len(field.text()) > textWidth {
+			textWidth = len(field.text())
+		}
+	}
+
+	out := strings.TrimRight(top, " ") + "\n" + strings.TrimRight(bottom, " ") + "\n\n"
+
+	for _, field := range fields {
+		indent := strings.Repeat(" ", textWidth + nameWidth + 4)
+
+		for n, note := range field.notes {
+			if n == 0 {
+				out += padRight(field.text(), " ", textWidth + 2) + padRight(field.name, " ", nameWidth + 2) + note + "\n"
+			} else {
+				out += indent + note + "\n"
+			}
+		}
+	}
+
+	return out
+}
+
+// Breaks a single instruction's encoding down into its fields
+func cmdEncoding(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+
+	bits := map[string]int{"x86_16": 16, "x86": 32, "x64": 64, "x86_64": 64, "x86-64": 64}[asmArch]
+
+	if bits == 0 && asmArch != "arm" && asmArch != "thumb" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, encodingArchs))
+		return
+	}
+
+	var code []byte
+	var err error
+
+	// ARM instructions can be given as the word the manuals write them as, i.e. 0xe3a00001
+	if len(rest) == 1 && strings.HasPrefix(rest[0], "0x") && bits == 0 {
+		code, err = armWordBytes(asmArch, rest[0])
+	} else {
+		code, err = parseOpcodes(strings.Join(rest, ""))
+	}
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, encodingArchs))
+		return
+	}
+
+	ins, err := disassemble(asmArch, code, asmOptions{})
+
+	if err != nil || len(ins) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrDisassemble, encodingArchs))
+		return
+	}
+
+	content := "`" + strings.TrimSpace(ins[0].Mnemonic + " " + ins[0].OpStr) + "` is encoded as:"
+
+	if len(ins[0].Bytes) < len(code) {
+		content += " (only the first instruction is broken down, it's " + strconv.Itoa(len(ins[0].Bytes)) + " of the " + strconv.Itoa(len(code)) + " bytes)"
+	}
+
+	var fields []encodingField
+
+	switch {
+	case bits != 0:
+		fields = x86Encoding(bits, ins[0])
+	case asmArch == "arm":
+		fields = armEncoding(armWord(ins[0].Bytes))
+	default:
+		fields = thumbEncoding(ins[0].Bytes)
+	}
+
+	sendListing(s, m.ChannelID, content, "encoding.txt", formatEncoding(fields))
+}
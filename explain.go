@@ -0,0 +1,1505 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// The calling convention an architecture's code is explained with, so !explain can say what registers are for.
+// Registers are matched by canonicalRegister, so "eax" matches rax and "w0" matches x0.
+type callingConvention struct {
+	name string
+
+	// Argument registers in order, empty when arguments are pushed onto the stack
+	args []string
+
+	// Arguments are pushed onto the stack right to left, like cdecl
+	stackArgs bool
+
+	// Size of a stack slot, for working out which argument a stack address above the frame is. 0 when it isn't
+	// worth guessing, like on ARM where the frame record can be anywhere in the frame.
+	stackSlot int
+
+	// Register the return value is in
+	ret string
+
+	// Stack and frame pointers
+	sp string
+	fp string
+
+	// Registers a function has to save before using, so they keep their values for its caller
+	calleeSaved []string
+
+	// The caller leaves 32 bytes above the return address for the callee to save its register arguments in
+	shadowSpace bool
+
+	// Set before calls to variadic functions, i.e. al is the number of vector registers used on System V
+	varargs string
+
+	// Register the system call number goes in, as it's shown to users, and the system call's arguments
+	syscallNum  string
+	syscallArgs []string
+}
+
+// Returns the calling convention !explain assumes for the architecture, ok is false if it doesn't know the
+// architecture at all
+func callingConventionFor(arch string) (callingConvention, bool) {
+	switch arch {
+	case "x86_16":
+		return callingConvention{sp: "sp", fp: "bp"}, true
+	case "x86":
+		return callingConvention{name: "cdecl", stackArgs: true, stackSlot: 4, ret: "eax", sp: "esp", fp: "ebp", syscallNum: "eax",
+			calleeSaved: []string{"ebx", "esi", "edi", "ebp"}, syscallArgs: []string{"ebx", "ecx", "edx", "esi", "edi", "ebp"}}, true
+	case "x64", "x86_64", "x86-64":
+		return callingConvention{name: "System V", args: []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}, ret: "rax",
+			stackSlot: 8, sp: "rsp", fp: "rbp", varargs: "rax", syscallNum: "rax",
+			calleeSaved: []string{"rbx", "rbp", "r12", "r13", "r14", "r15"}, syscallArgs: []string{"rdi", "rsi", "rdx", "r10", "r8", "r9"}}, true
+	case "arm":
+		return callingConvention{name: "AAPCS", args: []string{"r0", "r1", "r2", "r3"}, ret: "r0", sp: "sp", fp: "r11",
+			calleeSaved: []string{"r4", "r5", "r6", "r7", "r8", "r9", "r10", "r11"}, syscallNum: "r7",
+			syscallArgs: []string{"r0", "r1", "r2", "r3", "r4", "r5", "r6"}}, true
+	case "thumb":
+		// Thumb code uses r7 as the frame pointer, since r11 is awkward to reach with 16-bit instructions
+		return callingConvention{name: "AAPCS", args: []string{"r0", "r1", "r2", "r3"}, ret: "r0", sp: "sp", fp: "r7",
+			calleeSaved: []string{"r4", "r5", "r6", "r7", "r8", "r9", "r10", "r11"}, syscallNum: "r7",
+			syscallArgs: []string{"r0", "r1", "r2", "r3", "r4", "r5", "r6"}}, true
+	case "arm64", "aarch64":
+		return callingConvention{name: "AAPCS64", args: []string{"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7"}, ret: "x0",
+			sp: "sp", fp: "x29", calleeSaved: []string{"x19", "x20", "x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28", "x29"},
+			syscallNum: "x8", syscallArgs: []string{"x0", "x1", "x2", "x3", "x4", "x5"}}, true
+	default:
+		return callingConvention{}, false
+	}
+}
+
+// Calling conventions code for the architecture might use besides callingConventionFor's, that
+// detectCallingConvention tells apart by how the code uses its registers
+func otherCallingConventions(arch string) []callingConvention {
+	switch arch {
+	case "x64", "x86_64", "x86-64":
+		return []callingConvention{{name: "Microsoft x64", args: []string{"rcx", "rdx", "r8", "r9"}, ret: "rax", sp: "rsp",
+			fp: "rbp", shadowSpace: true, calleeSaved: []string{"rbx", "rbp", "rdi", "rsi", "r12", "r13", "r14", "r15"},
+			syscallNum: "eax", syscallArgs: []string{"r10", "rdx", "r8", "r9"}}}
+	default:
+		return nil
+	}
+}
+
+// Works out which calling convention the code uses, by which one makes the most sense of the arguments it passes
+// to calls and reads from its callers. Code that doesn't give it away gets callingConventionFor's.
+func detectCallingConvention(arch string, ins []explainedInsn) callingConvention {
+	family := instructionFamily(arch)
+	best, _ := callingConventionFor(arch)
+	bestScore := best.score(family, ins)
+
+	for _, cc := range otherCallingConventions(arch) {
+		if score := cc.score(family, ins); score > bestScore {
+			best, bestScore = cc, score
+		}
+	}
+
+	// stdcall is cdecl where the callee frees the arguments, with ret 8 and so on
+	for _, e := range ins {
+		if best.name == "cdecl" && e.base == "ret" && len(e.ops) == 1 {
+			best.name = "stdcall"
+		}
+	}
+
+	return best
+}
+
+// Scores how well the calling convention fits the code. Arguments only count when they're set up from the 1st
+// argument on, since setting up a 3rd without a 1st means they're something else in this convention.
+func (cc callingConvention) score(family string, ins []explainedInsn) int {
+	inOrder := func(args map[int]bool) int {
+		n := 0
+		for args[n + 1] {
+			n++
+		}
+
+		return n
+	}
+
+	score := 0
+	outgoing := make(map[int]bool)
+	incoming := make(map[int]bool)
+
+	for n, e := range explainDataflow(family, cc, ins) {
+		for _, note := range e {
+			if note.kind == "arg" {
+				outgoing[note.arg] = true
+			} else if note.kind == "incoming" && !strings.HasPrefix(note.from, "[") {
+				incoming[note.arg] = true
+			}
+		}
+
+		if ins[n].call {
+			score += inOrder(outgoing)
+			outgoing = make(map[int]bool)
+		}
+
+		// Microsoft x64 functions often start by saving their register arguments in the shadow space
+		if base, offset, ok := baseOffset(ins[n].firstOperand()); ok && cc.shadowSpace && ins[n].base == "mov" &&
+			sameRegister(family, base, cc.sp) && len(ins[n].ops) == 2 {
+			if arg := registerIndex(family, cc.args, ins[n].ops[1].reg); arg >= 0 && offset == int64(8 * (arg + 1)) {
+				score++
+			}
+		}
+	}
+
+	return score + inOrder(incoming)
+}
+
+// Returns the family of instruction sets the architecture's mnemonics and operands come from
+func instructionFamily(arch string) string {
+	switch arch {
+	case "x86_16", "x86", "x64", "x86_64", "x86-64":
+		return "x86"
+	case "arm", "thumb":
+		return "arm"
+	case "arm64", "aarch64":
+		return "arm64"
+	default:
+		return ""
+	}
+}
+
+// The narrower names of the x86 general purpose registers, mapped to the 64-bit register they're part of
+var x86RegisterAliases = func() map[string]string {
+	aliases := make(map[string]string)
+
+	for _, r := range []string{"a", "b", "c", "d"} {
+		for _, alias := range []string{"r" + r + "x", "e" + r + "x", r + "x", r + "l", r + "h"} {
+			aliases[alias] = "r" + r + "x"
+		}
+	}
+
+	for _, r := range []string{"si", "di", "bp", "sp"} {
+		for _, alias := range []string{"r" + r, "e" + r, r, r + "l"} {
+			aliases[alias] = "r" + r
+		}
+	}
+
+	for _, r := range []string{"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15"} {
+		for _, alias := range []string{r, r + "d", r + "w", r + "b"} {
+			aliases[alias] = r
+		}
+	}
+
+	return aliases
+}()
+
+// The names Capstone gives ARM registers with a special use
+var armRegisterAliases = map[string]string{"sb": "r9", "sl": "r10", "fp": "r11", "ip": "r12", "r13": "sp", "r14": "lr", "r15": "pc"}
+
+// Returns the register the name refers to, so "eax" and "rax" or "w0" and "x0" compare as the same register
+func canonicalRegister(family string, reg string) string {
+	switch family {
+	case "x86":
+		if full, ok := x86RegisterAliases[reg]; ok {
+			return full
+		}
+	case "arm":
+		if full, ok := armRegisterAliases[reg]; ok {
+			return full
+		}
+	case "arm64":
+		switch {
+		case reg == "wsp":
+			return "sp"
+		case reg == "fp":
+			return "x29"
+		case reg == "lr":
+			return "x30"
+		case reg == "wzr":
+			return "xzr"
+		case len(reg) > 1 && reg[0] == 'w' && reg[1] >= '0' && reg[1] <= '9':
+			return "x" + reg[1:]
+		}
+	}
+
+	return reg
+}
+
+// Returns the position of the register in the list, or -1 if it's not in it
+func registerIndex(family string, regs []string, reg string) int {
+	reg = canonicalRegister(family, reg)
+
+	for n, r := range regs {
+		if canonicalRegister(family, r) == reg {
+			return n
+		}
+	}
+
+	return -1
+}
+
+// An instruction operand, picked apart from Capstone's operand string
+type asmOperand struct {
+	text string
+
+	// Set when the operand is a register
+	reg string
+
+	// Set when the operand is memory, the address expression inside the brackets with x86's segment separate
+	mem     string
+	segment string
+
+	// Size of an x86 memory operand, i.e. "qword"
+	size string
+
+	// ARM register lists, i.e. {r4, lr}
+	list []string
+
+	// ARM pre-indexed addresses, like [sp, #-0x10]!, update the base register before the access
+	writeback bool
+
+	// ARM shifts and extends as Capstone writes them, i.e. "lsl #2"
+	shift string
+}
+
+// Register names as Capstone writes them, immediates always start with a digit or '#'
+var registerRegexp = regexp.MustCompile(`^[a-z][a-z0-9._]*$`)
+
+// ARM shift and extend operands, which belong to the operand before them
+var armShiftRegexp = regexp.MustCompile(`^(lsl|lsr|asr|ror|rrx|msl|[us]xt[bhwx])\b`)
+
+// Splits an operand string on the commas that separate operands, not the ones inside brackets or register lists
+func splitOperands(opStr string) []string {
+	var ops []string
+	depth := 0
+	start := 0
+
+	for n, c := range opStr {
+		switch c {
+		case '[', '{', '(':
+			depth++
+		case ']', '}', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				ops = append(ops, strings.TrimSpace(opStr[start:n]))
+				start = n + 1
+			}
+		}
+	}
+
+	if rest := strings.TrimSpace(opStr[start:]); rest != "" {
+		ops = append(ops, rest)
+	}
+
+	return ops
+}
+
+// Picks apart an instruction's operands
+func parseOperands(family string, opStr string) []asmOperand {
+	var ops []asmOperand
+
+	for _, part := range splitOperands(opStr) {
+		if family != "x86" && len(ops) > 0 && armShiftRegexp.MatchString(part) {
+			ops[len(ops) - 1].shift = part
+			continue
+		}
+
+		ops = append(ops, parseOperand(family, part))
+	}
+
+	return ops
+}
+
+// Picks apart a single operand
+func parseOperand(family string, part string) asmOperand {
+	op := asmOperand{text: part}
+
+	switch {
+	case strings.HasPrefix(part, "{"):
+		for _, reg := range strings.Split(strings.Trim(part, "{}"), ",") {
+			op.list = append(op.list, strings.TrimSpace(reg))
+		}
+	case strings.Contains(part, "[") && strings.Contains(part, "]"):
+		open := strings.Index(part, "[")
+		inner := part[open + 1 : strings.LastIndex(part, "]")]
+
+		if family != "x86" {
+			op.mem = armAddress(inner)
+			op.writeback = strings.HasSuffix(part, "!")
+			break
+		}
+
+		prefix := part[:open]
+
+		if n := strings.Index(prefix, " ptr "); n >= 0 {
+			op.size = prefix[:n]
+			prefix = prefix[n + len(" ptr "):]
+		}
+
+		op.segment = strings.TrimSuffix(strings.TrimSpace(prefix), ":")
+		op.mem = inner
+	case registerRegexp.MatchString(part):
+		op.reg = part
+	}
+
+	return op
+}
+
+// Rewrites an ARM address like "sp, #-0x10" as "sp - 0x10", and "x1, w2, sxtw #2" as "x1 + (sxtw(w2) << 2)"
+func armAddress(inner string) string {
+	parts := splitOperands(inner)
+
+	if len(parts) == 0 {
+		return inner
+	}
+
+	terms := []string{parts[0]}
+	signs := []string{""}
+
+	for _, part := range parts[1:] {
+		switch {
+		case strings.HasPrefix(part, "#-"):
+			terms, signs = append(terms, part[2:]), append(signs, " - ")
+		case strings.HasPrefix(part, "#"):
+			terms, signs = append(terms, part[1:]), append(signs, " + ")
+		case strings.HasPrefix(part, "-"):
+			terms, signs = append(terms, part[1:]), append(signs, " - ")
+		case armShiftRegexp.MatchString(part):
+			terms[len(terms) - 1] = shiftExpression(terms[len(terms) - 1], part)
+		default:
+			terms, signs = append(terms, part), append(signs, " + ")
+		}
+	}
+
+	out := ""
+
+	for n, term := range terms {
+		out += signs[n] + term
+	}
+
+	return out
+}
+
+// Applies an ARM shift or extend to a value as a C expression, i.e. "lsl #2" to x2 is "(x2 << 2)"
+func shiftExpression(value string, shift string) string {
+	fields := strings.Fields(shift)
+	amount := ""
+
+	if len(fields) > 1 {
+		amount = strings.TrimPrefix(fields[1], "#")
+	}
+
+	switch fields[0] {
+	case "lsl", "msl":
+		return "(" + value + " << " + amount + ")"
+	case "lsr", "asr":
+		return "(" + value + " >> " + amount + ")"
+	case "ror":
+		return "ror(" + value + ", " + amount + ")"
+	case "rrx":
+		return "rrx(" + value + ")"
+	}
+
+	if amount != "" && amount != "0" {
+		return "(" + fields[0] + "(" + value + ") << " + amount + ")"
+	}
+
+	return fields[0] + "(" + value + ")"
+}
+
+// Describes an ARM shift or extend operand, i.e. "lsl #2" is "shifted left by 2"
+func describeShift(shift string) string {
+	fields := strings.Fields(shift)
+	amount := ""
+
+	if len(fields) > 1 {
+		amount = strings.TrimPrefix(fields[1], "#")
+	}
+
+	switch fields[0] {
+	case "lsl", "msl":
+		return "shifted left by " + amount
+	case "lsr":
+		return "shifted right by " + amount
+	case "asr":
+		return "shifted right by " + amount + " keeping its sign"
+	case "ror":
+		return "rotated right by " + amount
+	case "rrx":
+		return "rotated right through the carry flag"
+	}
+
+	// Extends are [us]xt followed by the size being extended from
+	out := "zero extended"
+	if fields[0][0] == 's' {
+		out = "sign extended"
+	}
+
+	out += map[byte]string{'b': " from a byte", 'h': " from 2 bytes", 'w': " from 4 bytes", 'x': ""}[fields[0][3]]
+
+	if amount != "" && amount != "0" {
+		out += " and shifted left by " + amount
+	}
+
+	return out
+}
+
+// Sizes of x86 memory operands
+var x86OperandSizes = map[string]string{
+	"byte":    "the byte",
+	"word":    "the 2 bytes",
+	"dword":   "the 4 bytes",
+	"qword":   "the 8 bytes",
+	"tbyte":   "the 10 bytes",
+	"xmmword": "the 16 bytes",
+	"ymmword": "the 32 bytes",
+	"zmmword": "the 64 bytes",
+}
+
+// Works out how many bytes an ARM load or store accesses from its size suffix ("b", "h", "sw" or none) and the
+// register it uses
+func armAccessBytes(suffix string, pair bool, reg string) int {
+	switch suffix {
+	case "b", "sb":
+		return 1
+	case "h", "sh":
+		return 2
+	case "sw":
+		return 4
+	}
+
+	size := 4
+	if strings.HasPrefix(reg, "x") || strings.HasPrefix(reg, "d") {
+		size = 8
+	} else if strings.HasPrefix(reg, "q") {
+		size = 16
+	}
+
+	// Pairs access two registers' worth
+	if pair {
+		size *= 2
+	}
+
+	return size
+}
+
+// Architectures !explain knows the instructions of
+const explainArchs = "x86, x86_16, x86_64/x64, arm, thumb, arm64/aarch64"
+
+// What x86 instructions do. Keys are mnemonics, or a mnemonic and its operand count ("imul/3") when that changes
+// what it does. {0} is the first operand's value, {a0} its address and {cond} the instruction's condition.
+var x86ExplainTemplates = map[string]string{
+	"mov":     "copy {1} into {0}",
+	"movabs":  "copy {1} into {0}",
+	"movzx":   "copy {1} into {0}, padding it with zeroes",
+	"movsx":   "copy {1} into {0}, sign extending it",
+	"movsxd":  "copy {1} into {0}, sign extending it",
+	"lea":     "load the address of {a1} into {0}",
+	"add":     "add {1} to {0}",
+	"adc":     "add {1} and the carry flag to {0}",
+	"sub":     "subtract {1} from {0}",
+	"sbb":     "subtract {1} and the carry flag from {0}",
+	"mul/1":   "multiply the accumulator (al, ax, eax or rax) by {0}, unsigned, the high half of the result goes in dx, edx or rdx",
+	"imul/1":  "multiply the accumulator (al, ax, eax or rax) by {0}, signed, the high half of the result goes in dx, edx or rdx",
+	"imul/2":  "multiply {0} by {1}, signed",
+	"imul/3":  "set {0} to {1} times {2}, signed",
+	"div/1":   "divide the accumulator (with the high half in dx, edx or rdx) by {0}, unsigned, the quotient goes in eax and the remainder in edx",
+	"idiv/1":  "divide the accumulator (with the high half in dx, edx or rdx) by {0}, signed, the quotient goes in eax and the remainder in edx",
+	"and":     "bitwise AND {0} with {1}",
+	"or":      "bitwise OR {0} with {1}",
+	"xor":     "bitwise XOR {0} with {1}",
+	"not":     "flip every bit of {0}",
+	"neg":     "negate {0}",
+	"inc":     "add 1 to {0}",
+	"dec":     "subtract 1 from {0}",
+	"shl":     "shift {0} left by {1} bits",
+	"sal":     "shift {0} left by {1} bits",
+	"shr":     "shift {0} right by {1} bits, filling with zeroes",
+	"sar":     "shift {0} right by {1} bits, keeping its sign",
+	"rol":     "rotate {0} left by {1} bits",
+	"ror":     "rotate {0} right by {1} bits",
+	"cmp":     "compare {0} with {1}, setting the flags for the next conditional instruction",
+	"test":    "bitwise AND {0} with {1} without keeping the result, only setting the flags",
+	"bt":      "copy bit {1} of {0} into the carry flag",
+	"push":    "push {0} onto the stack",
+	"pop":     "pop the top of the stack into {0}",
+	"call":    "call {0}",
+	"ret":     "return to the caller",
+	"ret/1":   "return to the caller, then free {0} bytes of arguments from the stack",
+	"leave":   "tear down the stack frame, setting the stack pointer back to the frame pointer and popping the caller's frame pointer",
+	"enter":   "set up a stack frame with {0} bytes of local variables",
+	"jmp":     "jump to {0}",
+	"jcc":     "jump to {0} if {cond}",
+	"cmovcc":  "copy {1} into {0} if {cond}",
+	"setcc":   "set {0} to 1 if {cond}, otherwise 0",
+	"jcxz":    "jump to {0} if cx is zero",
+	"jecxz":   "jump to {0} if ecx is zero",
+	"jrcxz":   "jump to {0} if rcx is zero",
+	"loop":    "subtract 1 from ecx (or rcx) and jump to {0} if it isn't zero yet",
+	"xchg":    "swap {0} and {1}",
+	"cdq":     "sign extend eax into edx:eax, usually before a signed division",
+	"cqo":     "sign extend rax into rdx:rax, usually before a signed division",
+	"cdqe":    "sign extend eax into rax",
+	"cwde":    "sign extend ax into eax",
+	"cld":     "clear the direction flag, so string instructions work upwards through memory",
+	"nop":     "do nothing",
+	"endbr64": "mark this as somewhere indirect branches can go for CET, otherwise it does nothing",
+	"endbr32": "mark this as somewhere indirect branches can go for CET, otherwise it does nothing",
+	"int/1":   "raise software interrupt {0}",
+	"int3":    "trigger a breakpoint, debuggers put these where they want to stop",
+	"hlt":     "stop the CPU until the next interrupt",
+	"ud2":     "raise an invalid opcode exception, compilers use it to mark code that can't be reached",
+	"rep stosb": "fill rcx (or ecx) bytes starting at [rdi] with al, often used to zero a buffer",
+	"rep stosd": "fill rcx (or ecx) dwords starting at [rdi] with eax, often used to zero a buffer",
+	"rep stosq": "fill rcx qwords starting at [rdi] with rax, often used to zero a buffer",
+	"rep movsb": "copy rcx (or ecx) bytes from [rsi] to [rdi], like memcpy",
+	"rep movsd": "copy rcx (or ecx) dwords from [rsi] to [rdi], like memcpy",
+	"rep movsq": "copy rcx qwords from [rsi] to [rdi], like memcpy",
+}
+
+// What ARM and ARM64 instructions do, like x86ExplainTemplates. Loads and stores are all under ldr, str, ldp and
+// stp, since their mnemonics only differ in size.
+var armExplainTemplates = map[string]string{
+	"mov":   "copy {1} into {0}",
+	"mvn":   "copy {1} with every bit flipped into {0}",
+	"movw":  "set {0} to {1}",
+	"movt":  "set the top 16 bits of {0} to {1}, keeping the bottom half",
+	"add/2": "add {1} to {0}",
+	"add/3": "set {0} to {1} + {2}",
+	"adc/3": "set {0} to {1} + {2} + the carry flag",
+	"sub/2": "subtract {1} from {0}",
+	"sub/3": "set {0} to {1} - {2}",
+	"rsb/3": "set {0} to {2} - {1}",
+	"mul/2": "multiply {0} by {1}",
+	"mul/3": "set {0} to {1} * {2}",
+	"mla/4": "set {0} to {1} * {2} + {3}",
+	"mls/4": "set {0} to {3} - {1} * {2}",
+	"sdiv/3": "set {0} to {1} / {2}, signed",
+	"udiv/3": "set {0} to {1} / {2}, unsigned",
+	"and/2": "bitwise AND {0} with {1}",
+	"and/3": "set {0} to {1} AND {2}",
+	"orr/2": "bitwise OR {0} with {1}",
+	"orr/3": "set {0} to {1} OR {2}",
+	"eor/2": "bitwise XOR {0} with {1}",
+	"eor/3": "set {0} to {1} XOR {2}",
+	"bic/3": "set {0} to {1} with the bits set in {2} cleared",
+	"lsl/2": "shift {0} left by {1}",
+	"lsl/3": "set {0} to {1} shifted left by {2}",
+	"lsr/2": "shift {0} right by {1}, filling with zeroes",
+	"lsr/3": "set {0} to {1} shifted right by {2}, filling with zeroes",
+	"asr/2": "shift {0} right by {1}, keeping its sign",
+	"asr/3": "set {0} to {1} shifted right by {2}, keeping its sign",
+	"ror/3": "set {0} to {1} rotated right by {2}",
+	"neg/2": "set {0} to -{1}",
+	"cmp":   "compare {0} with {1}, setting the flags for the next conditional instruction",
+	"cmn":   "compare {0} with -{1}, setting the flags for the next conditional instruction",
+	"tst":   "bitwise AND {0} with {1} without keeping the result, only setting the flags",
+	"teq":   "bitwise XOR {0} with {1} without keeping the result, only setting the flags",
+	"ldr/2": "load {1} into {0}",
+	"ldr/3": "load {1} into {0}, then add {2} to the base register",
+	"str/2": "store {0} to {1}",
+	"str/3": "store {0} to {1}, then add {2} to the base register",
+	"ldp/3": "load {2} into {0} and {1}",
+	"ldp/4": "load {2} into {0} and {1}, then add {3} to the base register",
+	"stp/3": "store {0} and {1} to {2}",
+	"stp/4": "store {0} and {1} to {2}, then add {3} to the base register",
+	"push":  "push {0} onto the stack",
+	"pop":   "pop {0} off the stack",
+	"b":     "jump to {0}",
+	"bl":    "call {0}",
+	"blx":   "call {0}",
+	"bx":    "jump to the address in {0}",
+	"cbz":   "jump to {1} if {0} is zero",
+	"cbnz":  "jump to {1} if {0} isn't zero",
+	"adr":   "load the address {1} into {0}",
+	"sxtb":  "copy the bottom byte of {1} into {0}, sign extending it",
+	"sxth":  "copy the bottom 2 bytes of {1} into {0}, sign extending them",
+	"uxtb":  "copy the bottom byte of {1} into {0}, padding it with zeroes",
+	"uxth":  "copy the bottom 2 bytes of {1} into {0}, padding them with zeroes",
+	"nop":   "do nothing",
+	"svc":   "make a system call",
+}
+
+// ARM64 instructions ARM doesn't have, or that mean something else there
+var arm64ExplainTemplates = map[string]string{
+	"adrp":   "load the address of the 4KB page holding {1} into {0}, the low 12 bits are usually added by the next instruction",
+	"movz":   "set {0} to {1}",
+	"movn":   "set {0} to {1} with every bit flipped",
+	"movk":   "set 16 bits of {0} to {1}, keeping the rest",
+	"madd/4": "set {0} to {1} * {2} + {3}",
+	"msub/4": "set {0} to {3} - {1} * {2}",
+	"mneg/3": "set {0} to -({1} * {2})",
+	"br":     "jump to the address in {0}",
+	"blr":    "call the function at the address in {0}",
+	"ret":    "return to the caller",
+	"tbz":    "jump to {2} if bit {1} of {0} is zero",
+	"tbnz":   "jump to {2} if bit {1} of {0} is set",
+	"csel":   "set {0} to {1} if {3}, otherwise {2}",
+	"csinc":  "set {0} to {1} if {3}, otherwise {2} + 1",
+	"csneg":  "set {0} to {1} if {3}, otherwise -{2}",
+	"cset":   "set {0} to 1 if {1}, otherwise 0",
+	"csetm":  "set {0} to all ones if {1}, otherwise 0",
+	"cinc":   "set {0} to {1} + 1 if {2}, otherwise {1}",
+	"sxtw":   "copy the bottom 4 bytes of {1} into {0}, sign extending them",
+	"uxtw":   "copy the bottom 4 bytes of {1} into {0}, padding them with zeroes",
+	"mvn":    "copy {1} with every bit flipped into {0}",
+}
+
+// What x86 condition codes test, after the j, cmov or set
+var x86Conditions = map[string]string{
+	"e": "they were equal (the zero flag is set)", "z": "the result was zero",
+	"ne": "they weren't equal (the zero flag isn't set)", "nz": "the result wasn't zero",
+	"g": "it was greater, signed", "nle": "it was greater, signed",
+	"ge": "it was greater or equal, signed", "nl": "it was greater or equal, signed",
+	"l": "it was less, signed", "nge": "it was less, signed",
+	"le": "it was less or equal, signed", "ng": "it was less or equal, signed",
+	"a": "it was above, unsigned", "nbe": "it was above, unsigned",
+	"ae": "it was above or equal, unsigned", "nb": "it was above or equal, unsigned", "nc": "the carry flag isn't set",
+	"b": "it was below, unsigned", "nae": "it was below, unsigned", "c": "the carry flag is set",
+	"be": "it was below or equal, unsigned", "na": "it was below or equal, unsigned",
+	"s": "the result was negative", "ns": "the result wasn't negative",
+	"o": "it overflowed", "no": "it didn't overflow",
+	"p": "the parity flag is set", "pe": "the parity flag is set", "np": "the parity flag isn't set", "po": "the parity flag isn't set",
+}
+
+// What ARM condition codes test
+var armConditions = map[string]string{
+	"eq": "they were equal", "ne": "they weren't equal",
+	"cs": "it was higher or the same, unsigned", "hs": "it was higher or the same, unsigned",
+	"cc": "it was lower, unsigned", "lo": "it was lower, unsigned",
+	"mi": "the result was negative", "pl": "the result was positive or zero",
+	"vs": "it overflowed", "vc": "it didn't overflow",
+	"hi": "it was higher, unsigned", "ls": "it was lower or the same, unsigned",
+	"ge": "it was greater or equal, signed", "lt": "it was less, signed",
+	"gt": "it was greater, signed", "le": "it was less or equal, signed",
+	"al": "always",
+}
+
+// ARM loads and stores, with their size suffix and ARM's optional condition
+var armLoadStoreRegexp = regexp.MustCompile(`^(ld|st)u?r(s?[bh]|sw|d)?(eq|ne|cs|hs|cc|lo|mi|pl|vs|vc|hi|ls|ge|lt|gt|le|al)?$`)
+
+// ARM64 instructions that take a condition as their last operand
+var arm64ConditionalSelects = StrList{"csel", "csinc", "csinv", "csneg", "cset", "csetm", "cinc", "cinv", "cneg", "ccmp", "ccmn"}
+
+// Instructions that don't write to their first operand, so it isn't a register being set up for what comes next
+var explainReadOnly = StrList{"cmp", "cmn", "tst", "teq", "test", "bt", "push", "str", "stp", "call", "bl", "blx",
+	"blr", "b", "br", "bx", "jmp", "jcc", "jcxz", "jecxz", "jrcxz", "loop", "cbz", "cbnz", "tbz", "tbnz", "ret", "svc",
+	"syscall", "sysenter", "int", "nop"}
+
+// An instruction being explained, with what !explain worked out about it
+type explainedInsn struct {
+	asm.Insn
+
+	// The mnemonic its template is under, without its condition, flag setting or size suffixes
+	base string
+
+	// The instruction's condition code, what it tests, and the template that explains the instruction
+	condCode string
+	cond     string
+	template string
+
+	// ARM instructions with an s suffix set the flags
+	setsFlags bool
+
+	// The size suffix of an ARM load or store, i.e. "b" for ldrb
+	access string
+
+	ops []asmOperand
+
+	call    bool
+	syscall bool
+	jump    bool
+	ret     bool
+}
+
+// Looks up the template for a mnemonic with the given number of operands
+func explainTemplate(family string, mnemonic string, operands int) (string, bool) {
+	tables := []map[string]string{x86ExplainTemplates}
+
+	if family == "arm64" {
+		tables = []map[string]string{arm64ExplainTemplates, armExplainTemplates}
+	} else if family == "arm" {
+		tables = []map[string]string{armExplainTemplates}
+	}
+
+	for _, table := range tables {
+		if template, ok := table[mnemonic + "/" + strconv.Itoa(operands)]; ok {
+			return template, true
+		}
+
+		if template, ok := table[mnemonic]; ok {
+			return template, true
+		}
+	}
+
+	return "", false
+}
+
+// Works out the instruction's base mnemonic, condition and template
+func (e *explainedInsn) decode(family string) {
+	n := len(e.ops)
+	mnemonic := strings.TrimSuffix(strings.TrimSuffix(e.Mnemonic, ".w"), ".n")
+	e.base = mnemonic
+
+	if template, ok := explainTemplate(family, mnemonic, n); ok {
+		e.base, e.template = mnemonic, template
+		return
+	}
+
+	if family == "x86" {
+		for _, prefix := range []string{"j", "cmov", "set"} {
+			if cond, ok := x86Conditions[strings.TrimPrefix(mnemonic, prefix)]; ok && strings.HasPrefix(mnemonic, prefix) {
+				e.base, e.cond, e.condCode = prefix + "cc", cond, strings.TrimPrefix(mnemonic, prefix)
+				e.template, _ = explainTemplate(family, e.base, n)
+				return
+			}
+		}
+
+		return
+	}
+
+	// ARM64's conditional branches are b.eq and so on
+	if cond, ok := armConditions[strings.TrimPrefix(mnemonic, "b.")]; ok && strings.HasPrefix(mnemonic, "b.") {
+		e.base, e.cond, e.condCode = "b", cond, strings.TrimPrefix(mnemonic, "b.")
+		e.template, _ = explainTemplate(family, e.base, n)
+		return
+	}
+
+	if match := armLoadStoreRegexp.FindStringSubmatch(mnemonic); match != nil {
+		e.base = match[1] + "r"
+		e.access = match[2]
+		e.cond, e.condCode = armConditions[match[3]], match[3]
+
+		// ldrd and strd load and store pairs, like ARM64's ldp and stp
+		if e.access == "d" {
+			e.base = match[1] + "p"
+		}
+
+		e.template, _ = explainTemplate(family, e.base, n)
+		return
+	}
+
+	// ARM instructions can have a condition after them, and an s before that if they set the flags
+	candidates := []string{mnemonic}
+
+	if family == "arm" && len(mnemonic) > 2 {
+		if cond, ok := armConditions[mnemonic[len(mnemonic) - 2:]]; ok {
+			candidates = []string{mnemonic[:len(mnemonic) - 2], mnemonic}
+			e.cond, e.condCode = cond, mnemonic[len(mnemonic) - 2:]
+		}
+	}
+
+	for _, candidate := range candidates {
+		if template, ok := explainTemplate(family, candidate, n); ok {
+			e.base, e.template = candidate, template
+			return
+		}
+
+		if template, ok := explainTemplate(family, strings.TrimSuffix(candidate, "s"), n); ok && strings.HasSuffix(candidate, "s") {
+			e.base, e.template, e.setsFlags = strings.TrimSuffix(candidate, "s"), template, true
+			return
+		}
+
+		// The condition only counts if it was the condition
+		e.cond, e.condCode = "", ""
+	}
+}
+
+// Checks if Capstone put the instruction in the group
+func (e *explainedInsn) inGroup(group string) bool {
+	for _, g := range e.Groups {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Works out what the instruction does to control flow, from Capstone's groups and the mnemonics it doesn't group
+func (e *explainedInsn) classify(family string) {
+	last := ""
+	if len(e.ops) > 0 {
+		last = e.ops[len(e.ops) - 1].text
+	}
+
+	switch {
+	case e.base == "syscall" || e.base == "sysenter" || e.base == "svc" || e.base == "int" && last == "0x80":
+		e.syscall = true
+	case e.inGroup("call") || e.base == "call" || e.base == "bl" || e.base == "blx" || e.base == "blr":
+		e.call = true
+	case e.inGroup("ret") || e.base == "ret" || e.base == "bx" && canonicalRegister(family, last) == "lr" ||
+		e.base == "pop" && len(e.ops) > 0 && StrList(e.ops[0].list).contains("pc"):
+		e.ret = true
+	case e.inGroup("jump") || StrList{"jmp", "jcc", "jcxz", "jecxz", "jrcxz", "loop", "b", "br", "bx", "cbz", "cbnz", "tbz", "tbnz"}.contains(e.base):
+		e.jump = true
+	}
+}
+
+// Returns the register the instruction sets, if it sets one
+func (e *explainedInsn) writes() string {
+	if len(e.ops) == 0 || e.ops[0].reg == "" || explainReadOnly.contains(e.base) {
+		return ""
+	}
+
+	return e.ops[0].reg
+}
+
+// Checks if the instruction reads the register, as an operand or in an address
+func (e *explainedInsn) reads(family string, reg string) bool {
+	ops := e.ops
+	if e.writes() != "" && e.base != "xchg" {
+		ops = ops[1:]
+	}
+
+	reg = canonicalRegister(family, reg)
+
+	for _, op := range ops {
+		if op.reg != "" && canonicalRegister(family, op.reg) == reg {
+			return true
+		}
+
+		for _, token := range strings.Fields(op.mem) {
+			if canonicalRegister(family, token) == reg {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Checks if two register names are the same register
+func sameRegister(family string, a string, b string) bool {
+	return a != "" && b != "" && canonicalRegister(family, a) == canonicalRegister(family, b)
+}
+
+// Describes an operand's value, i.e. "the 8 bytes at [rbp - 0x20] (a local variable)"
+func (e *explainedInsn) value(family string, cc callingConvention, n int) string {
+	if n >= len(e.ops) {
+		return "?"
+	}
+
+	op := e.ops[n]
+	out := op.text
+
+	switch {
+	case op.list != nil:
+		out = joinWords(op.list)
+	case op.mem != "":
+		size := "the value"
+
+		if family == "x86" {
+			if known, ok := x86OperandSizes[op.size]; ok {
+				size = known
+			}
+		} else if len(e.ops) > 0 {
+			size = "the " + strconv.Itoa(armAccessBytes(e.access, e.base == "ldp" || e.base == "stp", e.ops[0].reg)) + " bytes"
+
+			if size == "the 1 bytes" {
+				size = "the byte"
+			}
+		}
+
+		if op.segment != "" {
+			out = size + " at " + op.segment + ":[" + op.mem + "]"
+		} else {
+			out = size + " at [" + op.mem + "]"
+		}
+
+		fields := strings.Fields(op.mem)
+
+		switch {
+		case op.writeback:
+			out += ", moving " + fields[0] + " there first"
+		case sameRegister(family, fields[0], cc.fp) && len(fields) == 3 && fields[1] == "-":
+			out += " (a local variable)"
+		case sameRegister(family, fields[0], cc.fp) && len(fields) == 3 && fields[1] == "+" && cc.stackArgs:
+			if offset, err := strconv.ParseInt(fields[2], 0, 64); err == nil && offset >= 8 {
+				out += " (an argument passed on the stack)"
+			}
+		}
+	case op.reg == "":
+		out = strings.TrimPrefix(op.text, "#")
+	}
+
+	if op.shift != "" {
+		out += " " + describeShift(op.shift)
+	}
+
+	return out
+}
+
+// Describes the address an operand refers to, for instructions like lea that use the address instead of the value
+func (e *explainedInsn) address(family string, cc callingConvention, n int) string {
+	if n < len(e.ops) && e.ops[n].mem != "" {
+		return "[" + e.ops[n].mem + "]"
+	}
+
+	return e.value(family, cc, n)
+}
+
+// Checks if an operand is the stack canary glibc keeps in thread local storage
+func isStackCanary(op asmOperand) bool {
+	return op.segment == "fs" && op.mem == "0x28" || op.segment == "gs" && op.mem == "0x14"
+}
+
+// Explains the instructions that mean more than their template says, returns "" if the instruction isn't one
+func (e *explainedInsn) special(family string, cc callingConvention) string {
+	ops := e.ops
+	reg := func(n int, want string) bool {
+		return n < len(ops) && sameRegister(family, ops[n].reg, want)
+	}
+	imm := func(n int) string {
+		return e.value(family, cc, n)
+	}
+
+	// sub rsp, 0x20 and sub sp, sp, #0x20 both move the stack pointer by a constant
+	last := len(ops) - 1
+	adjustsStack := len(ops) > 1 && reg(0, cc.sp) && (last == 1 || reg(1, cc.sp)) && ops[last].reg == "" && ops[last].mem == ""
+
+	// Things x86 and ARM both do
+	switch {
+	case e.zeroes():
+		return "set " + ops[0].reg + " to 0, " + strings.ToUpper(e.base) + "ing a register with itself is the usual way to zero it"
+	case e.base == "test" && len(ops) == 2 && reg(1, ops[0].reg):
+		return "check if " + ops[0].reg + " is zero, setting the flags for the next conditional instruction"
+	case e.syscall && !(e.base == "int" && cc.syscallNum == ""):
+		if e.base == "int" {
+			return "make a 32-bit Linux system call, its number is in eax"
+		}
+
+		return "make a system call, its number is in " + cc.syscallNum
+	case e.ret && e.base != "pop" && !(e.base == "ret" && len(ops) > 0):
+		return "return to the caller"
+	case e.base == "mov" && len(ops) == 2 && reg(0, cc.fp) && reg(1, cc.sp),
+		e.base == "add" && len(ops) == 3 && reg(0, cc.fp) && reg(1, cc.sp):
+		return "point the frame pointer at the stack, setting up this function's stack frame"
+	case e.base == "sub" && adjustsStack:
+		return "make room for " + imm(len(ops) - 1) + " bytes of local variables on the stack"
+	case e.base == "add" && adjustsStack:
+		return "free " + imm(len(ops) - 1) + " bytes of the stack"
+	}
+
+	if family == "x86" {
+		switch {
+		case e.base == "push" && reg(0, cc.fp):
+			return "save the caller's frame pointer"
+		case e.base == "pop" && reg(0, cc.fp):
+			return "restore the caller's frame pointer"
+		case e.base == "mov" && len(ops) == 2 && isStackCanary(ops[1]):
+			return "load the stack canary into " + ops[0].reg + ", it's checked before returning to catch buffer overflows"
+		case (e.base == "xor" || e.base == "sub" || e.base == "cmp") && len(ops) == 2 && isStackCanary(ops[1]):
+			return "compare " + ops[0].reg + " with the stack canary, it only changes if a buffer overflow wrote over it"
+		case (e.call || e.jump) && len(ops) == 1 && ops[0].mem != "":
+			if e.call {
+				return "call the function whose address is stored at [" + ops[0].mem + "]"
+			}
+
+			return "jump to the address stored at [" + ops[0].mem + "]"
+		case (e.call || e.base == "jmp") && len(ops) == 1 && ops[0].reg != "":
+			if e.call {
+				return "call the function at the address in " + ops[0].reg
+			}
+
+			return "jump to the address in " + ops[0].reg
+		}
+
+		return ""
+	}
+
+	// ARM saves the return address in lr, it has to be pushed before any calls and popped into pc to return
+	switch {
+	case e.base == "push" && len(ops) == 1 && StrList(ops[0].list).contains("lr"):
+		return "save " + joinWords(ops[0].list) + " on the stack, lr is the return address"
+	case e.base == "pop" && e.ret:
+		var rest []string
+
+		for _, r := range ops[0].list {
+			if r != "pc" {
+				rest = append(rest, r)
+			}
+		}
+
+		if len(rest) == 0 {
+			return "return to the caller, popping the return address into pc"
+		}
+
+		return "restore " + joinWords(rest) + " from the stack and return, popping the return address into pc"
+	case e.base == "stp" && len(ops) == 3 && reg(0, "x29") && reg(1, "x30") && ops[2].writeback:
+		return "save the frame pointer and return address (x29 and x30) on the stack, moving sp down first"
+	case e.base == "ldp" && len(ops) == 4 && reg(0, "x29") && reg(1, "x30"):
+		return "restore the frame pointer and return address (x29 and x30) from the stack, then free " + imm(3) + " bytes of it"
+	}
+
+	return ""
+}
+
+// Explains what the instruction does, by itself
+func (e *explainedInsn) explain(family string, cc callingConvention) string {
+	if out := e.special(family, cc); out != "" {
+		return out
+	}
+
+	if e.template == "" {
+		return "no plain English for " + e.Mnemonic + " yet, try " + CommandPrefix + "manual"
+	}
+
+	// ARM64's conditional selects take their condition as an operand
+	cond := e.cond
+	ops := e.ops
+
+	if family == "arm64" && arm64ConditionalSelects.contains(e.base) && len(ops) > 0 {
+		cond = armConditions[ops[len(ops) - 1].text]
+		e.ops[len(ops) - 1] = asmOperand{text: cond}
+	}
+
+	out := explainPlaceholderRegexp.ReplaceAllStringFunc(e.template, func(placeholder string) string {
+		match := explainPlaceholderRegexp.FindStringSubmatch(placeholder)
+
+		if match[2] == "cond" {
+			return cond
+		}
+
+		n, _ := strconv.Atoi(match[2])
+
+		if match[1] == "a" {
+			return e.address(family, cc, n)
+		}
+
+		return e.value(family, cc, n)
+	})
+
+	if cond != "" && !strings.Contains(e.template, "{cond}") && !arm64ConditionalSelects.contains(e.base) {
+		out += " if " + cond
+	}
+
+	if e.setsFlags {
+		out += ", and set the flags"
+	}
+
+	return out
+}
+
+// Placeholders in explanation templates
+var explainPlaceholderRegexp = regexp.MustCompile(`\{(a?)(\d|cond)\}`)
+
+// Picks apart disassembled instructions for explaining them
+func explainInstructions(arch string, ins []asm.Insn) []explainedInsn {
+	family := instructionFamily(arch)
+	var out []explainedInsn
+
+	for _, i := range ins {
+		e := explainedInsn{Insn: i, ops: parseOperands(family, i.OpStr)}
+		e.decode(family)
+		e.classify(family)
+		out = append(out, e)
+	}
+
+	return out
+}
+
+// Something the dataflow analysis worked out an instruction is for
+type dataflowNote struct {
+	// "arg" sets up an argument for the next call, "stack arg" pushes or stores one, "target" is the function
+	// called, "varargs" the vector register count, "syscall" and "syscall arg" set up a system call, "ret" is the
+	// return value, "uses ret" reads the return value of a call and "incoming" reads one of the function's own
+	// arguments
+	kind string
+
+	// The argument, counting from 1
+	arg int
+
+	// Where an incoming argument is read from
+	from string
+}
+
+// Explains the note as part of a sentence, for !explain
+func (note dataflowNote) explain() string {
+	switch note.kind {
+	case "arg", "stack arg":
+		return ordinal(note.arg) + " argument for the following call"
+	case "target":
+		return "the function the following call calls"
+	case "varargs":
+		return "the number of vector registers used for arguments, for variadic functions like printf"
+	case "syscall":
+		return "the system call number"
+	case "syscall arg":
+		return ordinal(note.arg) + " argument for the system call"
+	case "ret":
+		return "the return value"
+	case "uses ret":
+		return "uses the return value of the call before it"
+	case "incoming":
+		return note.from + " is this function's " + ordinal(note.arg) + " argument"
+	}
+
+	return ""
+}
+
+// Describes the note in a few words, for the comments in disassembly
+func (note dataflowNote) short() string {
+	switch note.kind {
+	case "arg", "stack arg":
+		return "arg " + strconv.Itoa(note.arg) + " of the call"
+	case "target":
+		return "call target"
+	case "varargs":
+		return "vector register count for varargs"
+	case "syscall":
+		return "syscall number"
+	case "syscall arg":
+		return "syscall arg " + strconv.Itoa(note.arg)
+	case "ret":
+		return "return value"
+	case "uses ret":
+		return "uses the call's return value"
+	case "incoming":
+		return note.from + " = arg " + strconv.Itoa(note.arg)
+	}
+
+	return ""
+}
+
+// Parses a memory operand made of a register and a constant offset, like "rbp + 0x10"
+func baseOffset(op asmOperand) (string, int64, bool) {
+	fields := strings.Fields(op.mem)
+
+	if len(fields) == 1 && registerRegexp.MatchString(fields[0]) {
+		return fields[0], 0, true
+	}
+
+	if len(fields) != 3 || fields[1] != "+" && fields[1] != "-" {
+		return "", 0, false
+	}
+
+	offset, err := strconv.ParseInt(fields[1] + fields[2], 0, 64)
+	return fields[0], offset, err == nil
+}
+
+// Works out which stack argument a frame pointer relative address is, above the saved frame pointer and return
+// address. Returns 0 if it isn't one.
+func (cc callingConvention) stackArgument(family string, op asmOperand) int {
+	base, offset, ok := baseOffset(op)
+
+	if !ok || cc.stackSlot == 0 || !sameRegister(family, base, cc.fp) || offset < int64(2 * cc.stackSlot) {
+		return 0
+	}
+
+	return len(cc.args) + int(offset) / cc.stackSlot - 1
+}
+
+// Works out what registers and pushes are for from the instructions around them: arguments being set up for a
+// call or system call, return values, where a call's return value gets used, and where the function reads its own
+// arguments
+func explainDataflow(family string, cc callingConvention, ins []explainedInsn) [][]dataflowNote {
+	notes := make([][]dataflowNote, len(ins))
+
+	for n, e := range ins {
+		reg := e.writes()
+
+		if reg == "" {
+			continue
+		}
+
+		// Find what uses the register next, if it isn't overwritten or left behind by a branch first
+		read := false
+
+		for _, next := range ins[n + 1:] {
+			switch {
+			case next.call:
+				if len(next.ops) > 0 && sameRegister(family, next.ops[0].reg, reg) {
+					notes[n] = append(notes[n], dataflowNote{kind: "target"})
+				} else if arg := registerIndex(family, cc.args, reg); arg >= 0 {
+					notes[n] = append(notes[n], dataflowNote{kind: "arg", arg: arg + 1})
+				} else if sameRegister(family, reg, cc.varargs) && !read {
+					// The vector register count is set right before the call, anything read on the way was a
+					// value passing through
+					notes[n] = append(notes[n], dataflowNote{kind: "varargs"})
+				}
+			case next.syscall:
+				if sameRegister(family, reg, cc.syscallNum) {
+					notes[n] = append(notes[n], dataflowNote{kind: "syscall"})
+				} else if arg := registerIndex(family, cc.syscallArgs, reg); arg >= 0 {
+					notes[n] = append(notes[n], dataflowNote{kind: "syscall arg", arg: arg + 1})
+				}
+			case next.ret:
+				if sameRegister(family, reg, cc.ret) {
+					notes[n] = append(notes[n], dataflowNote{kind: "ret"})
+				}
+			case !next.jump && !sameRegister(family, next.writes(), reg):
+				read = read || next.reads(family, reg)
+				continue
+			}
+
+			break
+		}
+	}
+
+	// cdecl pushes arguments right to left, so the push closest to the call is the 1st argument. Compilers that
+	// make room for them first store them at [esp], [esp + 4] and so on instead.
+	for n, e := range ins {
+		if !cc.stackArgs || !e.call {
+			continue
+		}
+
+		arg := 0
+
+		for k := n - 1; k >= 0; k-- {
+			prev := ins[k]
+
+			if prev.call || prev.jump || prev.ret || sameRegister(family, prev.writes(), cc.sp) {
+				break
+			}
+
+			if prev.base == "push" {
+				if len(prev.ops) > 0 && sameRegister(family, prev.ops[0].reg, cc.fp) {
+					break
+				}
+
+				arg++
+				notes[k] = append(notes[k], dataflowNote{kind: "stack arg", arg: arg})
+			} else if base, offset, ok := baseOffset(prev.firstOperand()); ok && prev.base == "mov" && sameRegister(family, base, cc.sp) && offset >= 0 {
+				notes[k] = append(notes[k], dataflowNote{kind: "stack arg", arg: int(offset) / cc.stackSlot + 1})
+			}
+		}
+	}
+
+	// The first thing after a call to read the return register is using what it returned
+	afterCall := false
+
+	for n, e := range ins {
+		if afterCall && cc.ret != "" && e.reads(family, cc.ret) {
+			notes[n] = append(notes[n], dataflowNote{kind: "uses ret"})
+			afterCall = false
+		}
+
+		if e.call {
+			afterCall = true
+		} else if sameRegister(family, e.writes(), cc.ret) {
+			afterCall = false
+		}
+	}
+
+	// The function's own arguments are the argument registers it reads before writing to them, and the stack
+	// slots above its frame. Calls clobber the argument registers, so nothing after one counts.
+	written := make(map[string]bool)
+	seen := make(map[int]bool)
+
+	for n, e := range ins {
+		for arg, reg := range cc.args {
+			if written[canonicalRegister(family, reg)] || seen[arg] || !e.reads(family, reg) || e.zeroes() {
+				continue
+			}
+
+			from := reg
+
+			for _, op := range e.ops {
+				if sameRegister(family, op.reg, reg) {
+					from = op.reg
+				}
+			}
+
+			seen[arg] = true
+			notes[n] = append(notes[n], dataflowNote{kind: "incoming", arg: arg + 1, from: from})
+		}
+
+		for _, op := range e.ops {
+			if arg := cc.stackArgument(family, op); arg > 0 && !seen[arg - 1] && !e.call {
+				seen[arg - 1] = true
+				notes[n] = append(notes[n], dataflowNote{kind: "incoming", arg: arg, from: "[" + op.mem + "]"})
+			}
+		}
+
+		if e.call || e.syscall {
+			for _, reg := range cc.args {
+				written[canonicalRegister(family, reg)] = true
+			}
+		}
+
+		if reg := e.writes(); reg != "" {
+			written[canonicalRegister(family, reg)] = true
+		}
+	}
+
+	return notes
+}
+
+// Returns the instruction's first operand, or an empty one if it has none
+func (e *explainedInsn) firstOperand() asmOperand {
+	if len(e.ops) == 0 {
+		return asmOperand{}
+	}
+
+	return e.ops[0]
+}
+
+// Checks if the instruction zeroes a register by XORing or subtracting it from itself, which doesn't really read it
+func (e *explainedInsn) zeroes() bool {
+	ops := e.ops
+
+	switch e.base {
+	case "xor", "sub", "pxor", "xorps":
+		return len(ops) == 2 && ops[0].reg != "" && ops[0].reg == ops[1].reg
+	case "eor", "vpxor", "vxorps":
+		return len(ops) == 3 && ops[1].reg != "" && ops[1].reg == ops[2].reg
+	}
+
+	return false
+}
+
+// Checks if the instruction only builds or tears down the stack frame: the frame pointer, saving and restoring
+// registers, and making room for locals
+func (e *explainedInsn) frameSetup(family string, cc callingConvention) bool {
+	ops := e.ops
+	reg := func(n int, want string) bool {
+		return n < len(ops) && sameRegister(family, ops[n].reg, want)
+	}
+
+	switch {
+	case StrList{"endbr64", "endbr32", "leave"}.contains(e.base):
+		return true
+	case e.base == "pop" && !e.ret:
+		return true
+	case e.base == "push" && (!cc.stackArgs || reg(0, cc.fp)):
+		// Only cdecl's pushes can be arguments
+		return true
+	case e.base == "stp" || e.base == "ldp":
+		return len(ops) > 2 && reg(0, "x29") && reg(1, "x30")
+	case e.base == "mov" && reg(0, cc.fp) && reg(1, cc.sp), e.base == "add" && reg(0, cc.fp) && reg(1, cc.sp):
+		return true
+	case (e.base == "sub" || e.base == "add") && len(ops) > 1 && reg(0, cc.sp) && ops[len(ops) - 1].reg == "" && ops[len(ops) - 1].mem == "":
+		return true
+	}
+
+	return false
+}
+
+// Annotates disassembly with the stack frame's setup and teardown, and what the dataflow analysis works out
+// registers and stack slots are for. Returns the calling convention the annotations are for, "" if there aren't
+// any about arguments.
+func annotateDisassembly(arch string, ins []asm.Insn) (string, [][]string) {
+	family := instructionFamily(arch)
+	explained := explainInstructions(arch, ins)
+	cc := detectCallingConvention(arch, explained)
+	notes := make([][]string, len(ins))
+	convention := ""
+
+	// Frame setup before anything else is the prologue, and frame setup right before a return is the epilogue
+	body := false
+
+	for n, e := range explained {
+		if !e.frameSetup(family, cc) {
+			body = body || !e.ret && e.base != "nop"
+			continue
+		}
+
+		if !body {
+			if e.base == "sub" && len(e.ops) > 1 {
+				notes[n] = append(notes[n], "prologue, " + e.value(family, cc, len(e.ops) - 1) + " bytes of locals")
+			} else {
+				notes[n] = append(notes[n], "prologue")
+			}
+
+			continue
+		}
+
+		next := n + 1
+		for next < len(explained) && explained[next].frameSetup(family, cc) {
+			next++
+		}
+
+		if next < len(explained) && explained[next].ret {
+			notes[n] = append(notes[n], "epilogue")
+		}
+	}
+
+	for n, flow := range explainDataflow(family, cc, explained) {
+		for _, note := range flow {
+			notes[n] = append(notes[n], note.short())
+
+			if note.kind != "syscall" && note.kind != "syscall arg" {
+				convention = cc.name
+			}
+		}
+	}
+
+	return convention, notes
+}
+
+// Explains each instruction in plain English, given as opcodes or assembly
+func cmdExplain(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+	family := instructionFamily(asmArch)
+
+	if family == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, explainArchs))
+		return
+	}
+
+	input := strings.Join(rest, " ")
+	code, err := parseOpcodes(input)
+
+	// Anything that isn't hex is assembly, explained as what it assembles to
+	if err != nil {
+		ins, err := assemble(asmArch, input, asmOptions{})
+
+		if err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, explainArchs))
+			return
+		}
+
+		for _, i := range ins {
+			code = append(code, i.Bytes...)
+		}
+	}
+
+	ins, err := disassemble(asmArch, code, asmOptions{detail: true})
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, explainArchs))
+		return
+	}
+
+	explained := explainInstructions(asmArch, ins)
+	cc := detectCallingConvention(asmArch, explained)
+	notes := explainDataflow(family, cc, explained)
+
+	width := 0
+
+	for _, e := range explained {
+		if len(e.Mnemonic + " " + e.OpStr) > width {
+			width = len(e.Mnemonic + " " + e.OpStr)
+		}
+	}
+
+	out := ""
+
+	for n, e := range explained {
+		out += padRight(e.Mnemonic + " " + e.OpStr, " ", width) + "  ; " + e.explain(family, cc)
+
+		var explained []string
+
+		for _, note := range notes[n] {
+			explained = append(explained, note.explain())
+		}
+
+		if len(explained) > 0 {
+			out += " — " + strings.Join(explained, ", ")
+		}
+
+		out += "\n"
+	}
+
+	content := "Explanation:"
+	if cc.name != "" {
+		content = "Explanation, assuming the " + cc.name + " calling convention:"
+	}
+
+	sendListing(s, m.ChannelID, content, "explain.txt", out + disassemblyStopNote(ins, code))
+}
@@ -0,0 +1,1248 @@
+package main
+
+import (
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// One %n write of a format string payload
+type fmtstrWrite struct {
+	addr  uint64
+	value uint64
+}
+
+// Builds a format string that writes value to addr with %hhn (size 1) or %hn (size 2) writes. The addresses go
+// after the format string, which is padded to a whole word, since 64-bit addresses have null bytes that would end
+// it. offset is the printf argument number of the start of the buffer, and printed is how much is printed before it.
+func fmtstrPayload(addr uint64, value uint64, offset int, printed int, size int, wordSize int) (string, []fmtstrWrite, []int) {
+	var writes []fmtstrWrite
+
+	for n := 0; n < wordSize; n += size {
+		writes = append(writes, fmtstrWrite{addr + uint64(n), value >> uint(8 * n) & (1 << uint(8 * size) - 1)})
+	}
+
+	// Writing the smallest values first keeps the padding between them short
+	sort.SliceStable(writes, func(a int, b int) bool {
+		return writes[a].value < writes[b].value
+	})
+
+	specifier := map[int]string{1: "hhn", 2: "hn"}[size]
+	modulus := 1 << uint(8 * size)
+	format := ""
+	var pads []int
+
+	// The argument numbers depend on the format's length and the length on the numbers, so go until it settles
+	for length := 0; ; {
+		format = ""
+		pads = nil
+		count := printed
+		arg := offset + length / wordSize
+
+		for n, write := range writes {
+			pad := (int(write.value) - count % modulus + modulus) % modulus
+
+			if pad > 0 {
+				format += "%" + strconv.Itoa(pad) + "c"
+			}
+
+			format += "%" + strconv.Itoa(arg + n) + "$" + specifier
+			count += pad
+			pads = append(pads, pad)
+		}
+
+		if len(format) <= length {
+			format += strings.Repeat("a", length - len(format))
+			break
+		}
+
+		length = (len(format) + wordSize - 1) / wordSize * wordSize
+	}
+
+	return format, writes, pads
+}
+
+// Generates a format string payload that writes a value to an address
+func cmdFmtstr(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	usage := "Sorry, give the address to write to, the value and the offset of your buffer in printf's arguments, i.e. '!fmtstr 601018 deadbeef 6'. Add 'printed=n' if something is printed before it, 'hn' for 2 byte writes and 'x86' for a 32-bit target."
+
+	if len(args) < 4 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	addr, okAddr := parseHexAddress(args[1])
+	value, okValue := parseHexAddress(args[2])
+	offset, err := strconv.Atoi(args[3])
+
+	if !okAddr || !okValue || err != nil || offset < 1 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	size, wordSize, printed := 1, 8, 0
+
+	for _, option := range args[4:] {
+		option = strings.ToLower(option)
+
+		switch {
+		case option == "hhn":
+			size = 1
+		case option == "hn":
+			size = 2
+		case option == "x86" || option == "32":
+			wordSize = 4
+		case option == "x64" || option == "x86_64" || option == "64":
+			wordSize = 8
+		case strings.HasPrefix(option, "printed="):
+			printed, err = strconv.Atoi(strings.TrimPrefix(option, "printed="))
+
+			if err != nil || printed < 0 {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + option + "' isn't a number of bytes printed.")
+				return
+			}
+		default:
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I don't know the option '" + option + "'. " + usage[len("Sorry, "):])
+			return
+		}
+	}
+
+	if wordSize == 4 && (addr > 0xffffffff || value > 0xffffffff) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, the address and value have to fit in 32 bits for a 32-bit target.")
+		return
+	}
+
+	format, writes, pads := fmtstrPayload(addr, value, offset, printed, size, wordSize)
+	pack := map[int]string{4: "p32", 8: "p64"}[wordSize]
+	payload := "payload = b\"" + format + "\""
+
+	for _, write := range writes {
+		payload += " + " + pack + "(0x" + strconv.FormatUint(write.addr, 16) + ")"
+	}
+
+	out := payload + "\n\n"
+	count := printed
+
+	for n, write := range writes {
+		count += pads[n]
+		arg := offset + len(format) / wordSize + n
+
+		out += "arg " + padRight(strconv.Itoa(arg), " ", 4) + "0x" + strconv.FormatUint(write.addr, 16) + " <- 0x" + padLeft(strconv.FormatUint(write.value, 16), "0", size * 2)
+		out += " (" + strconv.Itoa(count) + " printed so far)\n"
+	}
+
+	writeSize := map[int]string{1: "byte", 2: "short"}[size]
+	out += "\n" + strconv.Itoa(len(format) + len(writes) * wordSize) + " bytes. With pwntools: fmtstr_payload(" + strconv.Itoa(offset) + ", {0x" + strconv.FormatUint(addr, 16) + ": 0x" + strconv.FormatUint(value, 16) + "}"
+
+	if printed > 0 {
+		out += ", numbwritten=" + strconv.Itoa(printed)
+	}
+
+	out += ", write_size='" + writeSize + "')\n"
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "```python\n" + out + "```")
+}
+
+// What a gadget takes off the stack, worked out from its instructions by readGadget
+type ropGadget struct {
+	addr   uint64
+	source string
+
+	// Registers loaded from the stack, by their offset from sp when the gadget starts
+	loads map[int]string
+
+	// The offset the gadget takes its next address from, -1 if it doesn't return through the stack
+	next int
+
+	// How far the gadget moves sp
+	advance int
+
+	// Instructions that !ropchain doesn't know what do to the stack, assumed to leave it alone
+	unknown []string
+}
+
+// How the architectures !ropchain knows the gadgets of return, their word size and whether they're big endian
+var ropArchs = map[string]struct {
+	family    string
+	wordSize  int
+	bigEndian bool
+}{
+	"x86": {"x86", 4, false}, "x64": {"x86", 8, false}, "x86_64": {"x86", 8, false}, "x86-64": {"x86", 8, false},
+	"arm": {"arm", 4, false}, "thumb": {"arm", 4, false}, "arm64": {"arm64", 8, false}, "aarch64": {"arm64", 8, false},
+	"mips": {"mips", 4, true}, "mips32": {"mips", 4, true}, "mips64": {"mips", 8, true}, "mipsel": {"mips", 4, false},
+	"mips64el": {"mips", 8, false}, "mipsr6": {"mips", 4, true},
+}
+
+// Architectures !ropchain knows the gadgets of
+const ropchainArchs = "x86, x86_64/x64, arm, thumb, arm64/aarch64, mips/mips32, mipsel, mips64, mips64el, mipsr6"
+
+// Numbers of ARM registers, to put a pop's register list in the order it loads them
+var armRegisterNumbers = map[string]int{"sb": 9, "sl": 10, "fp": 11, "ip": 12, "sp": 13, "lr": 14, "pc": 15}
+
+// Gives an ARM register's number, from r0 to r15 or its other name
+func armRegisterNumber(name string) (int, bool) {
+	if n, ok := armRegisterNumbers[name]; ok {
+		return n, true
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(name, "r"))
+	return n, err == nil && strings.HasPrefix(name, "r") && n < 16
+}
+
+// Names a register like readGadget does, lower case and without MIPS' $
+func normalizeRegister(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "$"))
+}
+
+// Parses a number in a gadget's operands, like 0x10, #0x10 or 16
+func gadgetNumber(text string) (int, bool) {
+	value, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(text), "#"), 0, 64)
+	return int(value), err == nil
+}
+
+// Works out what a gadget's instructions, separated by ';', take off the stack. family is "x86", "arm", "arm64" or
+// "mips", which decides how the gadget returns.
+func readGadget(family string, addr uint64, source string, wordSize int) ropGadget {
+	g := ropGadget{addr: addr, source: strings.TrimSpace(source), loads: map[int]string{}, next: -1}
+	sp := 0
+	stackRegs := StrList{"sp", "esp", "rsp", "$sp", "$29", "wsp"}
+
+	// Where the return address register was loaded from, for ARM's bx lr, ARM64's ret and MIPS' jr $ra
+	loadedFrom := map[string]int{}
+
+	load := func(reg string, offset int) {
+		g.loads[offset] = reg
+		loadedFrom[reg] = offset
+	}
+
+	for _, ins := range asm.SplitInstructions(source) {
+		ins = strings.ToLower(strings.TrimSpace(ins))
+		mnemonic, operands := ins, ""
+
+		if space := strings.IndexAny(ins, " \t"); space >= 0 {
+			mnemonic, operands = ins[:space], strings.TrimSpace(ins[space:])
+		}
+
+		ops := splitOperands(operands)
+
+		for n := range ops {
+			ops[n] = strings.TrimSpace(ops[n])
+		}
+
+		switch {
+		case family == "x86" && mnemonic == "pop":
+			load(normalizeRegister(operands), sp)
+			sp += wordSize
+		case family == "x86" && (mnemonic == "ret" || mnemonic == "retn"):
+			// ret pops its address, and then however many bytes it's given
+			g.next = sp
+			sp += wordSize
+
+			if extra, ok := gadgetNumber(operands); ok {
+				sp += extra
+			}
+
+			g.advance = sp
+			return g
+		case family == "arm64" && mnemonic == "ret":
+			reg := "x30"
+			if operands != "" {
+				reg = operands
+			}
+
+			if offset, ok := loadedFrom[reg]; ok {
+				g.next = offset
+				delete(g.loads, offset)
+			}
+
+			g.advance = sp
+			return g
+		case StrList{"pop", "ldm", "ldmia", "ldmfd", "pop.w", "ldm.w"}.contains(mnemonic) && strings.Contains(operands, "{"):
+			if mnemonic != "pop" && mnemonic != "pop.w" && !strings.HasPrefix(operands, "sp!") {
+				g.unknown = append(g.unknown, ins)
+				continue
+			}
+
+			list := stribet(operands, "{", "}")
+			var numbers []int
+
+			for _, part := range strings.Split(list, ",") {
+				bounds := strings.Split(part, "-")
+				first, okFirst := armRegisterNumber(normalizeRegister(bounds[0]))
+				last, okLast := first, okFirst
+
+				if len(bounds) == 2 {
+					last, okLast = armRegisterNumber(normalizeRegister(bounds[1]))
+				}
+
+				if !okFirst || !okLast {
+					continue
+				}
+
+				for n := first; n <= last; n++ {
+					numbers = append(numbers, n)
+				}
+			}
+
+			sort.Ints(numbers)
+			returns := false
+
+			for _, n := range numbers {
+				reg := armRegisterName(uint32(n))
+
+				if reg == "pc" {
+					g.next = sp
+					returns = true
+				} else {
+					load(reg, sp)
+				}
+
+				sp += wordSize
+			}
+
+			if returns {
+				g.advance = sp
+				return g
+			}
+		case mnemonic == "bx" && len(ops) == 1:
+			reg := normalizeRegister(ops[0])
+			if n, ok := armRegisterNumber(reg); ok {
+				reg = armRegisterName(uint32(n))
+			}
+
+			if offset, ok := loadedFrom[reg]; ok {
+				g.next = offset
+				delete(g.loads, offset)
+			}
+
+			g.advance = sp
+			return g
+		case mnemonic == "jr" && len(ops) == 1:
+			// The instruction after jr is in its delay slot and runs first, so keep going for it
+			if offset, ok := loadedFrom[normalizeRegister(ops[0])]; ok {
+				g.next = offset
+				delete(g.loads, offset)
+			}
+		case (mnemonic == "ldr" || mnemonic == "ldp") && len(ops) >= 2:
+			// ARM64's loads from sp: [sp, #n], [sp, #n]! (sp moves first) or [sp], #n (sp moves after)
+			regs := ops[:1]
+			if mnemonic == "ldp" {
+				regs = ops[:2]
+			}
+
+			memory := strings.Join(ops[len(regs):], ", ")
+			address := stribet(memory, "[", "]")
+			parts := strings.Split(address, ",")
+
+			if !stackRegs.contains(strings.TrimSpace(parts[0])) {
+				g.unknown = append(g.unknown, ins)
+				continue
+			}
+
+			offset := 0
+			if len(parts) == 2 {
+				offset, _ = gadgetNumber(parts[1])
+			}
+
+			post := 0
+			if after := strings.SplitN(memory, "],", 2); len(after) == 2 {
+				post, _ = gadgetNumber(after[1])
+			}
+
+			if strings.HasSuffix(memory, "!") {
+				sp += offset
+				offset = 0
+			}
+
+			for n, reg := range regs {
+				load(normalizeRegister(reg), sp + offset + n * wordSize)
+			}
+
+			sp += post
+		case (mnemonic == "lw" || mnemonic == "ld") && len(ops) == 2 && strings.Contains(ops[1], "("):
+			// MIPS' lw $reg, offset($sp)
+			if !stackRegs.contains(stribet(ops[1], "(", ")")) {
+				g.unknown = append(g.unknown, ins)
+				continue
+			}
+
+			offset, _ := gadgetNumber(ops[1][:strings.Index(ops[1], "(")])
+			load(normalizeRegister(ops[0]), sp + offset)
+		case StrList{"add", "addiu", "daddiu", "addi", "add.w"}.contains(mnemonic) && len(ops) >= 2 && stackRegs.contains(ops[0]):
+			// add sp, sp, #n or add rsp, n
+			if amount, ok := gadgetNumber(ops[len(ops) - 1]); ok {
+				sp += amount
+			}
+		default:
+			g.unknown = append(g.unknown, ins)
+		}
+	}
+
+	g.advance = sp
+	return g
+}
+
+// A word of a ROP chain, with what it's for
+type ropWord struct {
+	value   uint64
+	comment string
+}
+
+// A ROP chain as it's built up by !ropchain
+type ropChain struct {
+	words    []ropWord
+	wordSize int
+	junk     uint64
+
+	// The slot the next address goes in, the one the last gadget returns through. -1 appends it.
+	next int
+}
+
+// Adds the address of a gadget or function, in the slot the last gadget returns through
+func (c *ropChain) jump(addr uint64, comment string) {
+	if c.next >= 0 {
+		c.words[c.next] = ropWord{addr, comment}
+		c.next = -1
+		return
+	}
+
+	c.words = append(c.words, ropWord{addr, comment})
+}
+
+// Adds a gadget and the words it takes off the stack, with the values of any registers in values it loads
+func (c *ropChain) gadget(g ropGadget, entry uint64, values map[string]uint64) {
+	c.jump(entry, g.source)
+	base := len(c.words)
+
+	for n := 0; n < g.advance / c.wordSize; n++ {
+		c.words = append(c.words, ropWord{c.junk, "junk"})
+	}
+
+	for offset, reg := range g.loads {
+		for base + offset / c.wordSize >= len(c.words) {
+			c.words = append(c.words, ropWord{c.junk, "junk"})
+		}
+
+		if value, ok := values[reg]; ok {
+			c.words[base + offset / c.wordSize] = ropWord{value, reg}
+			delete(values, reg)
+		} else {
+			c.words[base + offset / c.wordSize] = ropWord{c.junk, reg + " (junk)"}
+		}
+	}
+
+	c.next = -1
+	if g.next >= 0 {
+		c.next = base + g.next / c.wordSize
+		c.words[c.next].comment = "where the gadget returns to (junk, nothing comes after it)"
+	}
+}
+
+// Picks the gadget that sets the most of the registers still to be set, with the fewest words if they tie
+func pickGadget(gadgets []ropGadget, values map[string]uint64) (ropGadget, bool) {
+	best, bestCount := ropGadget{}, 0
+
+	for _, g := range gadgets {
+		count := 0
+
+		for _, reg := range g.loads {
+			if _, ok := values[reg]; ok {
+				count++
+			}
+		}
+
+		if g.next >= 0 && (count > bestCount || count == bestCount && count > 0 && g.advance < best.advance) {
+			best, bestCount = g, count
+		}
+	}
+
+	return best, bestCount > 0
+}
+
+// Builds a ROP chain from gadgets and the register values and calls wanted, as pwntools code
+func cmdRopchain(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+	arch, ok := ropArchs[asmArch]
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, ropchainArchs))
+		return
+	}
+
+	usage := "Give the gadgets as 'address: instructions', then the registers to set and the addresses to call, separated by '|'. I.e. '!ropchain x64 401234: pop rdi; ret | 401236: pop rsi; pop r15; ret | rdi=404000 rsi=0 | 401050'."
+
+	if len(rest) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	var gadgets []ropGadget
+	var steps []string
+
+	for _, item := range strings.Split(strings.Join(rest, " "), "|") {
+		item = strings.TrimSpace(item)
+
+		if colon := strings.Index(item, ":"); colon > 0 {
+			if addr, ok := parseHexAddress(strings.TrimSpace(item[:colon])); ok {
+				gadgets = append(gadgets, readGadget(arch.family, addr, item[colon + 1:], arch.wordSize))
+				continue
+			}
+		}
+
+		if item != "" {
+			steps = append(steps, item)
+		}
+	}
+
+	junk := uint64(0x4141414141414141) >> uint(64 - 8 * arch.wordSize)
+	chain := ropChain{wordSize: arch.wordSize, junk: junk, next: -1}
+	values := map[string]uint64{}
+	var notes []string
+
+	// Thumb gadgets are returned to with bit 0 set, so pop {pc} and bx stay in Thumb
+	entry := func(addr uint64) uint64 {
+		if asmArch == "thumb" {
+			return addr | 1
+		}
+
+		return addr
+	}
+
+	// Sets the registers asked for so far with gadgets, before whatever comes next
+	setRegisters := func() bool {
+		for len(values) > 0 {
+			g, ok := pickGadget(gadgets, values)
+
+			if !ok {
+				var missing []string
+				for reg := range values {
+					missing = append(missing, reg)
+				}
+
+				sort.Strings(missing)
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, none of the gadgets load " + joinWords(missing) + " from the stack and return.")
+				return false
+			}
+
+			chain.gadget(g, entry(g.addr), values)
+		}
+
+		return true
+	}
+
+	for _, step := range steps {
+		fields := strings.Fields(step)
+
+		switch {
+		case strings.Contains(step, "="):
+			for _, field := range fields {
+				parts := strings.SplitN(field, "=", 2)
+				value, ok := parseHexAddress(parts[len(parts) - 1])
+
+				if len(parts) != 2 || !ok {
+					_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + field + "' isn't a register and a hex value, like rdi=404000.")
+					return
+				}
+
+				values[normalizeRegister(parts[0])] = value
+			}
+		case len(fields) == 2 && fields[0] == "raw":
+			value, ok := parseHexAddress(fields[1])
+
+			if !ok {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + fields[1] + "' isn't a hex value.")
+				return
+			}
+
+			chain.words = append(chain.words, ropWord{value, "raw value"})
+		case len(fields) == 1:
+			addr, ok := parseHexAddress(fields[0])
+
+			if !ok {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I can't read '" + step + "'. " + usage)
+				return
+			}
+
+			if !setRegisters() {
+				return
+			}
+
+			// An address of one of the gadgets runs it as it is, i.e. a lone ret to align the stack
+			known := false
+			for _, g := range gadgets {
+				if g.addr == addr && !known {
+					chain.gadget(g, entry(g.addr), map[string]uint64{})
+					known = true
+				}
+			}
+
+			if known {
+				continue
+			}
+
+			chain.jump(addr, "0x" + strconv.FormatUint(addr, 16))
+
+			// An x86 function returns to the word after it, other architectures return to a register
+			if arch.family == "x86" {
+				chain.words = append(chain.words, ropWord{junk, "return address of 0x" + strconv.FormatUint(addr, 16)})
+				chain.next = len(chain.words) - 1
+			} else if len(notes) == 0 {
+				notes = append(notes, "Functions return to " + map[string]string{"arm": "lr", "arm64": "x30", "mips": "$ra"}[arch.family] +
+					" rather than the stack, so anything after a call only runs if that was set to a gadget first.")
+			}
+		default:
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I can't read '" + step + "'. " + usage)
+			return
+		}
+	}
+
+	if !setRegisters() {
+		return
+	}
+
+	pack := "p" + strconv.Itoa(arch.wordSize * 8) + "(0x"
+	suffix := ")"
+
+	if arch.bigEndian {
+		suffix = ", endian=\"big\")"
+	}
+
+	out := "chain = b\"\"\n"
+	width := len(pack) + arch.wordSize * 2 + len(suffix) + len("chain += ") + 2
+
+	for _, word := range chain.words {
+		out += padRight("chain += " + pack + strconv.FormatUint(word.value, 16) + suffix, " ", width) + "# " + word.comment + "\n"
+	}
+
+	for _, g := range gadgets {
+		if len(g.unknown) > 0 {
+			notes = append(notes, "I assumed " + strings.Join(g.unknown, "; ") + " in the gadget at 0x" + strconv.FormatUint(g.addr, 16) + " leaves the stack alone.")
+		}
+
+		if g.next < 0 {
+			notes = append(notes, "The gadget at 0x" + strconv.FormatUint(g.addr, 16) + " doesn't return through the stack, so it's only used if it's called directly.")
+		}
+	}
+
+	content := strconv.Itoa(len(chain.words)) + " words, " + strconv.Itoa(len(chain.words) * arch.wordSize) + " bytes:"
+
+	if len(notes) > 0 {
+		out += "\n# " + strings.Join(notes, "\n# ") + "\n"
+	}
+
+	sendListing(s, m.ChannelID, content, "ropchain.py", out)
+}
+
+// Characters the encoders' output can be made of. The printable set leaves out space and backtick, which would
+// split the payload into arguments or end the code block it's shown in.
+const alnumChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func printableByte(b byte) bool {
+	return b > ' ' && b < 0x7f && b != '`'
+}
+
+// The alphanumeric decoder's multiplier and the b its loop stops at. Every byte value is ((a * multiplier) & 0xff) ^ b
+// for some pair of alphanumeric a and b, with b not the terminator.
+const (
+	alnumMultiplier = '0'
+	alnumTerminator = 'A'
+)
+
+// 32-bit x86 registers, by the number push and pop encode them with
+var x86Registers32 = StrList{"eax", "ecx", "edx", "ebx", "esp", "ebp", "esi", "edi"}
+
+// Encodes x86 code as alphanumeric characters behind a decoding loop, which needs its own address in the base
+// register. Each byte is encoded as a pair of characters a and b, that the loop decodes in place right after itself.
+// The loop's jnz back can't have an alphanumeric offset, so the decoder xors it into place before it gets there.
+func alnumEncode(code []byte, base int) []byte {
+	pairs := map[byte][2]byte{}
+
+	for _, a := range []byte(alnumChars) {
+		for _, b := range []byte(alnumChars) {
+			if _, ok := pairs[a * alnumMultiplier ^ b]; !ok && b != alnumTerminator {
+				pairs[a * alnumMultiplier ^ b] = [2]byte{a, b}
+			}
+		}
+	}
+
+	// ecx reads the pairs and edx writes the decoded bytes, both from 0x42 bytes ahead, where the decoder ends
+	loop := []byte{
+		0x6b, 0x41, 0x42, alnumMultiplier, // imul eax, [ecx+0x42], multiplier
+		0x32, 0x41, 0x43, // xor al, [ecx+0x43]
+		0x32, 0x42, 0x42, // xor al, [edx+0x42]
+		0x30, 0x42, 0x42, // xor [edx+0x42], al, which leaves the decoded byte there
+		0x41, 0x41, 0x42, // inc ecx; inc ecx; inc edx
+		0x38, 0x59, 0x43, // cmp [ecx+0x43], bl, the terminator
+		0x75, 0, // jnz back to the imul
+	}
+
+	// The offset is written as 0xff ^ key ^ offset, and the decoder xors it with al = 0xff ^ key
+	offset := byte(0x100 - len(loop))
+	key := byte(0)
+
+	for _, c := range []byte(alnumChars) {
+		if strings.IndexByte(alnumChars, 0xff ^ c ^ offset) >= 0 {
+			key = c
+			break
+		}
+	}
+
+	loop[len(loop) - 1] = 0xff ^ key ^ offset
+
+	prepare := []byte{
+		0x6a, 0x30, 0x58, 0x34, 0x30, 0x48, 0x34, key, // push 0x30; pop eax; xor al, 0x30; dec eax; xor al, key
+		0x30, 0x41, 0x41, // xor [ecx+0x41], al, the jnz's offset
+		0x50, 0x51, 0x51, 0x6a, alnumTerminator, 0x50, 0x55, 0x56, 0x57, 0x61, // popad, with ecx in edx and the terminator in ebx
+	}
+
+	// ecx starts at the decoder's address and decrements until 0x42 past it is where the decoder ends
+	decrements := (0x42 - 2 - len(prepare) - len(loop)) / 2
+
+	out := []byte{0x50 + byte(base), 0x59} // push base; pop ecx
+	out = append(out, []byte(strings.Repeat("I", decrements))...) // dec ecx
+	out = append(append(out, prepare...), loop...)
+
+	for _, b := range code {
+		out = append(out, pairs[b][0], pairs[b][1])
+	}
+
+	return append(out, 'A', alnumTerminator)
+}
+
+// Finds count printable bytes that add up to sum
+func printableBytes(sum int, count int) ([]byte, bool) {
+	if count == 0 {
+		return nil, sum == 0
+	}
+
+	for b := 0x21; b <= 0x7e; b++ {
+		// The rest of the sum has to be within what the other bytes can make
+		if rest := sum - b; !printableByte(byte(b)) || rest < (count - 1) * 0x21 || rest > (count - 1) * 0x7e {
+			continue
+		}
+
+		if others, ok := printableBytes(sum - b, count - 1); ok {
+			return append(others, byte(b)), true
+		}
+	}
+
+	return nil, false
+}
+
+// Splits value into count dwords of printable bytes that add up to it, with the carries between the bytes
+func printableSum(value uint32, count int) ([]uint32, bool) {
+	parts := make([]uint32, count)
+	carry := 0
+
+	for n := uint(0); n < 32; n += 8 {
+		found := false
+
+		// Each byte of value is the sum of count bytes and the carry in, less whatever it carries out
+		for out := 0; out < count && !found; out++ {
+			bytes, ok := printableBytes(int(value >> n & 0xff) + out * 0x100 - carry, count)
+
+			if ok {
+				for slot, b := range bytes {
+					parts[slot] |= uint32(b) << n
+				}
+
+				found, carry = true, out
+			}
+		}
+
+		if !found {
+			return nil, false
+		}
+	}
+
+	return parts, true
+}
+
+// Makes the printable instructions that subtract from eax until it's target
+func printableSubs(from uint32, target uint32, least int) []byte {
+	var out []byte
+
+	for count := least; count <= 4; count++ {
+		if parts, ok := printableSum(from - target, count); ok {
+			for _, part := range parts {
+				out = append(out, 0x2d, byte(part), byte(part >> 8), byte(part >> 16), byte(part >> 24)) // sub eax, part
+			}
+
+			return out
+		}
+	}
+
+	return nil
+}
+
+// Encodes x86 code as printable characters that push it onto a stack moved to just past themselves, from the last
+// dword up, with and and sub making each value in eax. The stack ends up right after the instructions, so they fall
+// through into the code they built. The stack needs the encoding's own address in the base register.
+func printableEncode(code []byte, base int) []byte {
+	for len(code) % 4 != 0 {
+		code = append(code, 0x90)
+	}
+
+	// eax is zeroed with a pair of ands and each dword is made from the last, subtracting at least once
+	body := []byte{0x25, 0x4a, 0x4d, 0x4e, 0x55, 0x25, 0x35, 0x32, 0x31, 0x2a} // and eax, 0x554e4d4a; and eax, 0x2a313235
+	eax := uint32(0)
+
+	for n := len(code) - 4; n >= 0; n -= 4 {
+		word := binary.LittleEndian.Uint32(code[n:])
+		body = append(append(body, printableSubs(eax, word, 1)...), 0x50) // push eax
+		eax = word
+	}
+
+	// Moving the stack is always 3 subs, so the instructions' length is known before the subs are made
+	length := 2 + 15 + 2 + len(body)
+	end := uint32(length + len(code))
+
+	out := []byte{0x50 + byte(base), 0x58} // push base; pop eax
+	out = append(out, printableSubs(0, end, 3)...)
+	out = append(append(out, 0x50, 0x5c), body...) // push eax; pop esp
+
+	// The code is pushed over these
+	return append(out, []byte(strings.Repeat("A", len(code)))...)
+}
+
+// Encodes x86 code into alphanumeric or printable characters, with a decoder in front that restores it when run
+func cmdAlphaenc(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	rest := args[1:]
+	printable := false
+	base := "eax"
+
+	if len(rest) > 0 && (StrList{"print", "printable", "alnum"}).contains(strings.ToLower(rest[0])) {
+		printable = strings.ToLower(rest[0]) != "alnum"
+		rest = rest[1:]
+	}
+
+	if len(rest) > 0 && x86Registers32.contains(strings.ToLower(rest[0])) {
+		base = strings.ToLower(rest[0])
+		rest = rest[1:]
+	}
+
+	code, err := parseOpcodes(strings.Join(rest, ""))
+
+	if err != nil || len(code) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, give the x86 code to encode as hex, i.e. '!alphaenc print eax 31 c0 40 cd 80'.")
+		return
+	}
+
+	if !checkLimit(s, m.ChannelID, "opcode bytes", len(code), MaxOpcodeBytes) {
+		return
+	}
+
+	register := 0
+
+	for n, reg := range x86Registers32 {
+		if reg == base {
+			register = n
+		}
+	}
+
+	var encoded []byte
+	content := ""
+
+	if printable {
+		encoded = printableEncode(code, register)
+		content = "Printable x86 encoding of " + strconv.Itoa(len(code)) + " bytes, " + strconv.Itoa(len(encoded)) + " characters. It moves the stack over itself to push the code, so it needs its own address in " + base + ":"
+	} else {
+		encoded = alnumEncode(code, register)
+		content = "Alphanumeric x86 encoding of " + strconv.Itoa(len(code)) + " bytes, " + strconv.Itoa(len(encoded)) + " characters. It decodes the code in place, so it needs its own address in " + base + " and writable memory, and a working stack:"
+	}
+
+	sendListing(s, m.ChannelID, content, "encoded.txt", string(encoded) + "\n")
+}
+
+// glibc malloc's sizes for a word size, from malloc.c with tcache (2.26 and later). i386 aligns chunks to 16 bytes
+// like x64 does, so its small bins are offset by one.
+type mallocSizes struct {
+	sizeSz, align, minSize uint64
+
+	// The largest chunks of the fastbins with the default M_MXFAST and of the tcache, and the smallest large bin
+	// chunk. tcacheMax is 0 without a tcache.
+	maxFast, tcacheMax, minLarge uint64
+}
+
+var mallocArchs = map[int]mallocSizes{
+	8: {8, 16, 0x20, 0x80, 0x410, 0x400},
+	4: {4, 16, 0x10, 0x40, 0x400, 0x3f0},
+}
+
+// Gives malloc's sizes for a word size and glibc 2.minor. Before 2.26 there's no tcache, and i386 aligned chunks
+// to 8 bytes.
+func mallocSizesFor(wordSize int, minor int) mallocSizes {
+	sizes := mallocArchs[wordSize]
+
+	if minor < 26 {
+		sizes.tcacheMax = 0
+
+		if wordSize == 4 {
+			sizes = mallocSizes{4, 8, 0x10, 0x40, 0, 0x200}
+		}
+	}
+
+	return sizes
+}
+
+// Works out the large bin a chunk size goes in, largebin_index_64, largebin_index_32_big and largebin_index_32 in
+// malloc.c
+func largeBinIndex(size uint64, sizes mallocSizes) uint64 {
+	first, limit := uint64(48), uint64(48)
+
+	switch {
+	case sizes.sizeSz == 4 && sizes.align == 16:
+		first, limit = 49, 45
+	case sizes.sizeSz == 4:
+		first, limit = 56, 38
+	}
+
+	switch {
+	case size >> 6 <= limit:
+		return first + size >> 6
+	case size >> 9 <= 20:
+		return 91 + size >> 9
+	case size >> 12 <= 10:
+		return 110 + size >> 12
+	case size >> 15 <= 4:
+		return 119 + size >> 15
+	case size >> 18 <= 2:
+		return 124 + size >> 18
+	}
+
+	return 126
+}
+
+// The indexes of the bins a chunk size goes in, tcache_idx, fastbin_index and smallbin_index in malloc.c
+func tcacheIndex(size uint64, sizes mallocSizes) uint64 {
+	return (size - sizes.minSize) / sizes.align
+}
+
+func fastbinIndex(size uint64, sizes mallocSizes) uint64 {
+	if sizes.sizeSz == 4 {
+		return size >> 3 - 2
+	}
+
+	return size >> 4 - 2
+}
+
+func smallBinIndex(size uint64, sizes mallocSizes) uint64 {
+	// The first small bin is left empty when chunks are aligned to more than two words
+	if sizes.align > 2 * sizes.sizeSz {
+		return size / sizes.align + 1
+	}
+
+	return size / sizes.align
+}
+
+// Names the small or large bin a chunk size is sorted into from the unsorted bin
+func sortedBin(size uint64, sizes mallocSizes) string {
+	if size < sizes.minLarge {
+		return "small bin " + strconv.FormatUint(smallBinIndex(size, sizes), 10) + " (0x" + strconv.FormatUint(size, 16) + " chunks)"
+	}
+
+	return "large bin " + strconv.FormatUint(largeBinIndex(size, sizes), 10)
+}
+
+// Describes which bins a chunk of the given size goes in when it's freed
+func chunkBins(size uint64, sizes mallocSizes) string {
+	hexSize := "0x" + strconv.FormatUint(size, 16)
+	var bins []string
+
+	if size <= sizes.tcacheMax {
+		bins = append(bins, "tcache bin " + strconv.FormatUint(tcacheIndex(size, sizes), 10) + " (" + hexSize + ") while it holds fewer than 7 chunks")
+	}
+
+	if size <= sizes.maxFast {
+		bins = append(bins, "fastbin " + strconv.FormatUint(fastbinIndex(size, sizes), 10) + " (" + hexSize + ")")
+	} else {
+		bins = append(bins, "the unsorted bin, and from there to " + sortedBin(size, sizes))
+	}
+
+	if len(bins) == 1 {
+		return "Freed, it goes to " + bins[0] + "."
+	}
+
+	return "Freed, it goes to " + bins[0] + ", then " + bins[1] + "."
+}
+
+// Decodes a glibc heap chunk's header, given as bytes or as words like gdb's x/gx shows them
+func cmdChunk(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	wordSize := 8
+	var words []string
+	hexBytes := ""
+
+	for _, arg := range args[1:] {
+		switch lower := strings.ToLower(arg); {
+		case lower == "x86" || lower == "32":
+			wordSize = 4
+		case lower == "x64" || lower == "x86_64" || lower == "64":
+			wordSize = 8
+		case strings.HasSuffix(lower, ":"):
+			// The address gdb starts each line with
+		default:
+			words = append(words, lower)
+			hexBytes += lower
+		}
+	}
+
+	var values []uint64
+
+	// Words are told apart from bytes by their 0x
+	if strings.Contains(strings.Join(words, " "), "0x") {
+		for _, word := range words {
+			value, ok := parseHexAddress(word)
+
+			if !ok {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + word + "' isn't a hex word.")
+				return
+			}
+
+			values = append(values, value)
+		}
+	} else {
+		data, err := parseOpcodes(hexBytes)
+
+		if err != nil {
+			data = nil
+		}
+
+		for n := 0; n + wordSize <= len(data); n += wordSize {
+			if wordSize == 4 {
+				values = append(values, uint64(binary.LittleEndian.Uint32(data[n:])))
+			} else {
+				values = append(values, binary.LittleEndian.Uint64(data[n:]))
+			}
+		}
+	}
+
+	if len(values) < 2 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, give the chunk's prev_size and size, as hex bytes from memory ('!chunk 0000000000000000 9100000000000000') or words like gdb shows them ('!chunk 0x0 0x91'). Add 'x86' for a 32-bit heap.")
+		return
+	}
+
+	sizes := mallocArchs[wordSize]
+	word := func(value uint64) string {
+		return "0x" + padLeft(strconv.FormatUint(value, 16), "0", wordSize * 2)
+	}
+
+	prevSize, raw := values[0], values[1]
+	size := raw &^ 7
+	prevInUse, mmapped, nonMain := raw & 1 != 0, raw & 2 != 0, raw & 4 != 0
+	hexSize := "0x" + strconv.FormatUint(size, 16)
+
+	out := ""
+	line := func(label string, value string) {
+		out += padRight(label, " ", 18) + value + "\n"
+	}
+
+	line("prev_size", word(prevSize))
+	line("size", word(raw))
+	line("  chunk size", hexSize + " (" + strconv.FormatUint(size, 10) + " bytes)")
+
+	switch {
+	case mmapped:
+		line("  PREV_INUSE", strconv.Itoa(int(raw & 1)) + " ignored for mmapped chunks")
+	case prevInUse:
+		line("  PREV_INUSE", "1 the previous chunk is in use, prev_size is the end of its data")
+	default:
+		line("  PREV_INUSE", "0 the previous chunk is free and 0x" + strconv.FormatUint(prevSize, 16) + " bytes long, they merge when this one is freed outside the tcache and fastbins")
+	}
+
+	if mmapped {
+		line("  IS_MMAPPED", "1 allocated with mmap, prev_size is the padding before it")
+	} else {
+		line("  IS_MMAPPED", "0 in the heap")
+	}
+
+	if nonMain {
+		line("  NON_MAIN_ARENA", "1 from a thread's arena, found at the start of its heap")
+	} else {
+		line("  NON_MAIN_ARENA", "0 from the main arena")
+	}
+
+	// The names malloc.c gives the words after the header while the chunk is free
+	for n, name := range []string{"fd", "bk", "fd_nextsize", "bk_nextsize"} {
+		if n + 2 < len(values) {
+			line(name, word(values[n + 2]))
+		}
+	}
+
+	var notes []string
+
+	switch {
+	case size < sizes.minSize || size % sizes.align != 0:
+		notes = append(notes, "The size isn't a valid chunk size, they're a multiple of " + strconv.FormatUint(sizes.align, 10) + " from 0x" + strconv.FormatUint(sizes.minSize, 16) + ", so free() would abort with 'free(): invalid size'.")
+	case mmapped:
+		usable := size - 2 * sizes.sizeSz
+		notes = append(notes, "Usable size 0x" + strconv.FormatUint(usable, 16) + " (" + strconv.FormatUint(usable, 10) + " bytes). Freed, it's given back with munmap rather than put in a bin.")
+
+		if (prevSize + size) & 0xfff != 0 {
+			notes = append(notes, "prev_size + size isn't a whole number of pages, so free() would abort with 'munmap_chunk(): invalid pointer'.")
+		}
+	default:
+		// malloc(n) makes a chunk of n + SIZE_SZ rounded up to the alignment, and at least MINSIZE
+		usable := size - sizes.sizeSz
+		least := uint64(0)
+
+		if size > sizes.minSize {
+			least = usable - sizes.align + 1
+		}
+
+		notes = append(notes, "Usable size 0x" + strconv.FormatUint(usable, 16) + " (" + strconv.FormatUint(usable, 10) + " bytes), it's what malloc(" + strconv.FormatUint(least, 10) + ") to malloc(" + strconv.FormatUint(usable, 10) + ") give.")
+		notes = append(notes, chunkBins(size, sizes))
+
+		if size <= sizes.tcacheMax && len(values) > 2 {
+			notes = append(notes, "In the tcache or a fastbin fd is mangled from glibc 2.32, it's (the address of fd >> 12) ^ the next chunk. In the tcache bk is the key that detects double frees.")
+		}
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "```\n" + out + "```" + strings.Join(notes, " "))
+}
+
+// Rounds a malloc request up to the size of the chunk it gets, request2size in malloc.c
+func requestChunkSize(request uint64, sizes mallocSizes) uint64 {
+	size := (request + sizes.sizeSz + sizes.align - 1) &^ (sizes.align - 1)
+
+	if size < sizes.minSize {
+		return sizes.minSize
+	}
+
+	return size
+}
+
+// Requests from this size are mmapped with the default M_MMAP_THRESHOLD
+const mallocMmapThreshold = 128 * 1024
+
+// Works out the chunk size of a malloc request and the bins it's freed into
+func cmdBin(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	request, err := strconv.ParseUint(strings.ToLower(args[1]), 0, 64)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, give the size passed to malloc, i.e. '!bin 0x88' or '!bin 136 2.27'.")
+		return
+	}
+
+	wordSize, minor := 8, -1
+
+	for _, option := range args[2:] {
+		option = strings.ToLower(option)
+		version := strings.TrimPrefix(strings.TrimPrefix(option, "glibc"), "-")
+
+		switch {
+		case option == "x86" || option == "32":
+			wordSize = 4
+		case option == "x64" || option == "x86_64" || option == "64":
+			wordSize = 8
+		case strings.HasPrefix(version, "2."):
+			minor, err = strconv.Atoi(strings.SplitN(version[2:], ".", 2)[0])
+
+			if err != nil {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, '" + option + "' isn't a glibc version, i.e. 2.31.")
+				return
+			}
+		default:
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I don't know the option '" + option + "', give a glibc version like 2.31 or 'x86' for a 32-bit heap.")
+			return
+		}
+	}
+
+	if wordSize == 4 && request > 0xffffffff {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, the size has to fit in 32 bits for a 32-bit heap.")
+		return
+	}
+
+	version, given := "glibc 2." + strconv.Itoa(minor), minor >= 0
+
+	if !given {
+		version, minor = "glibc 2.26 and later", 26
+	}
+
+	sizes := mallocSizesFor(wordSize, minor)
+	size := requestChunkSize(request, sizes)
+	hexSize := "0x" + strconv.FormatUint(size, 16)
+	arch := map[int]string{4: "i386", 8: "x64"}[wordSize]
+
+	out := ""
+	line := func(label string, value string) {
+		out += padRight(label, " ", 13) + value + "\n"
+	}
+
+	line("chunk size", hexSize + ", the request + " + strconv.FormatUint(sizes.sizeSz, 10) + " rounded up to " + strconv.FormatUint(sizes.align, 10) + ", at least 0x" + strconv.FormatUint(sizes.minSize, 16))
+	line("usable size", "0x" + strconv.FormatUint(size - sizes.sizeSz, 16) + " (" + strconv.FormatUint(size - sizes.sizeSz, 10) + " bytes)")
+
+	// mmapped chunks are whole pages, with the size field in front
+	if request >= mallocMmapThreshold {
+		line("mmapped", "0x" + strconv.FormatUint((size + sizes.sizeSz + 0xfff) &^ 0xfff, 16) + " bytes of pages, munmapped when it's freed")
+	}
+
+	switch {
+	case sizes.tcacheMax == 0:
+		line("tcache", "none, it's from glibc 2.26")
+	case size <= sizes.tcacheMax:
+		line("tcache", "bin " + strconv.FormatUint(tcacheIndex(size, sizes), 10) + ", up to 7 chunks")
+	default:
+		line("tcache", "no, larger than 0x" + strconv.FormatUint(sizes.tcacheMax, 16))
+	}
+
+	if size <= sizes.maxFast {
+		line("fastbin", strconv.FormatUint(fastbinIndex(size, sizes), 10))
+	} else {
+		line("fastbin", "no, larger than 0x" + strconv.FormatUint(sizes.maxFast, 16))
+	}
+
+	if size < sizes.minLarge {
+		line("small bin", strconv.FormatUint(smallBinIndex(size, sizes), 10) + ", through the unsorted bin")
+	} else {
+		line("large bin", strconv.FormatUint(largeBinIndex(size, sizes), 10) + ", through the unsorted bin")
+	}
+
+	var notes []string
+
+	if request >= mallocMmapThreshold {
+		notes = append(notes, "It's past the default mmap threshold of 128 KiB, so the bins are for when freeing an mmapped chunk has raised the threshold.")
+	}
+
+	if size <= sizes.tcacheMax {
+		switch {
+		case !given:
+			notes = append(notes, "The tcache catches double frees with its key in bk from 2.29, and from 2.32 its and the fastbins' fd pointers are mangled with safe-linking, (the address of fd >> 12) ^ the next chunk. Give a version before 2.26 to see it without the tcache.")
+		case minor < 29:
+			notes = append(notes, "The tcache doesn't check for double frees before 2.29.")
+		case minor < 32:
+			notes = append(notes, "From 2.29 the tcache's key in bk catches double frees.")
+		default:
+			notes = append(notes, "From 2.32 the tcache and fastbins' fd pointers are mangled with safe-linking, (the address of fd >> 12) ^ the next chunk, and from 2.29 the tcache's key in bk catches double frees.")
+		}
+	}
+
+	if minor >= 34 {
+		notes = append(notes, "__malloc_hook and __free_hook are gone from 2.34.")
+	}
+
+	content := "malloc(" + strconv.FormatUint(request, 10) + ") on " + arch + " with " + version + ": ```\n" + out + "```"
+	_, _ = s.ChannelMessageSend(m.ChannelID, content + strings.Join(notes, " "))
+}
@@ -0,0 +1,160 @@
+//go:build irc
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+// IRC servers cut off lines at 512 bytes including the command and prefix, so messages are kept well under that
+const ircMaxLineLength = 400
+
+// Serves the commands on IRC, build with -tags irc to include it
+type ircFrontend struct {
+	conn     *ircevent.Connection
+	maxLines int
+}
+
+func init() {
+	registerFrontend(&ircFrontend{})
+}
+
+func (f *ircFrontend) Name() string {
+	return "irc"
+}
+
+func (f *ircFrontend) Start() error {
+	server := getConfigPropertyAsStr("irc", "server")
+	channels := strings.Fields(strings.Replace(getConfigPropertyAsStr("irc", "channels"), ",", " ", -1))
+
+	if server == "" {
+		return errors.New("server must be set")
+	}
+
+	nick := getConfigPropertyAsStr("irc", "nick")
+
+	if nick == "" {
+		nick = "REBot"
+	}
+
+	f.maxLines = getConfigPropertyAsInt("irc", "max_lines", 4)
+
+	f.conn = &ircevent.Connection{
+		Server:       server,
+		Nick:         nick,
+		User:         nick,
+		RealName:     "REBot",
+		UseTLS:       getConfigPropertyAsStr("irc", "tls") != "false",
+		SASLLogin:    getConfigPropertyAsStr("irc", "sasl_login"),
+		SASLPassword: getConfigSecret("irc", "sasl_password"),
+		QuitMessage:  "Goodbye!",
+	}
+
+	f.conn.UseSASL = f.conn.SASLLogin != ""
+
+	f.conn.AddConnectCallback(func(e ircmsg.Message) {
+		for _, channel := range channels {
+			_ = f.conn.Join(channel)
+		}
+	})
+
+	f.conn.AddCallback("PRIVMSG", f.onMessage)
+
+	if err := f.conn.Connect(); err != nil {
+		return err
+	}
+
+	go f.conn.Loop()
+
+	return nil
+}
+
+func (f *ircFrontend) Stop() {
+	if f.conn != nil {
+		f.conn.Quit()
+	}
+}
+
+// Handler for PRIVMSGs received from IRC, both in channels and in private messages
+func (f *ircFrontend) onMessage(e ircmsg.Message) {
+	if len(e.Params) < 2 {
+		return
+	}
+
+	// Reply in the channel, or to the sender directly if it was a private message
+	target := e.Params[0]
+
+	if !strings.HasPrefix(target, "#") && !strings.HasPrefix(target, "&") {
+		target = e.Nick()
+	}
+
+	handleTextMessage("irc", e.Nick(), target, e.Params[1], func(reply textReply) {
+		f.send(target, reply)
+	})
+}
+
+// Sends a reply as IRC lines. Files can't be sent, so text files are linked on the pastebin instead.
+func (f *ircFrontend) send(target string, reply textReply) {
+	lines := f.formatOutput(plainText(reply.content))
+
+	for _, file := range reply.files {
+		if !utf8.Valid(file.data) {
+			lines = append(lines, file.name + " can't be sent on IRC.")
+			continue
+		}
+
+		url, err := uploadPaste(string(file.data))
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to upload " + file.name + " to the pastebin, ", err)
+			lines = append(lines, file.name + " couldn't be uploaded.")
+			continue
+		}
+
+		lines = append(lines, file.name + ": " + url)
+	}
+
+	for _, line := range lines {
+		if err := f.conn.Privmsg(target, line); err != nil {
+			fmt.Println("[ERROR] Failed to send IRC message, ", err)
+			return
+		}
+	}
+}
+
+// Splits output into IRC sized lines, falling back to a pastebin link when there are too many to send
+func (f *ircFrontend) formatOutput(out string) []string {
+	var lines []string
+
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		for len(line) > ircMaxLineLength {
+			lines = append(lines, line[:ircMaxLineLength])
+			line = line[ircMaxLineLength:]
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) <= f.maxLines {
+		return lines
+	}
+
+	url, err := uploadPaste(out)
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to upload IRC output to the pastebin, ", err)
+		return append(lines[:f.maxLines], "... output truncated, " + fmt.Sprint(len(lines)-f.maxLines) + " more lines.")
+	}
+
+	return []string{lines[0] + " ... full output: " + url}
+}
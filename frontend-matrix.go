@@ -0,0 +1,141 @@
+//go:build matrix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+	"maunium.net/go/mautrix/id"
+)
+
+// Serves the commands in Matrix rooms the bot's account has joined, build with -tags matrix to include it
+type matrixFrontend struct {
+	client  *mautrix.Client
+	cancel  context.CancelFunc
+	started int64
+	invites StrList
+}
+
+func init() {
+	registerFrontend(&matrixFrontend{})
+}
+
+func (f *matrixFrontend) Name() string {
+	return "matrix"
+}
+
+func (f *matrixFrontend) Start() error {
+	homeserver := getConfigPropertyAsStr("matrix", "homeserver")
+	userID := getConfigPropertyAsStr("matrix", "user_id")
+	accessToken := getConfigSecret("matrix", "access_token")
+
+	if homeserver == "" || userID == "" || accessToken == "" {
+		return errors.New("homeserver, user_id and access_token must all be set")
+	}
+
+	client, err := mautrix.NewClient(homeserver, id.UserID(userID), accessToken)
+
+	if err != nil {
+		return err
+	}
+
+	f.client = client
+	f.invites = strings.Fields(strings.Replace(getConfigPropertyAsStr("matrix", "invites"), ",", " ", -1))
+	f.started = time.Now().UnixNano() / int64(time.Millisecond)
+
+	syncer := client.Syncer.(*mautrix.DefaultSyncer)
+	syncer.OnEventType(event.EventMessage, f.onMessage)
+	syncer.OnEventType(event.StateMember, f.onMember)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+
+	go func() {
+		if err := client.SyncWithContext(ctx); err != nil && ctx.Err() == nil {
+			fmt.Println("[ERROR] Matrix sync stopped, ", err)
+		}
+	}()
+
+	return nil
+}
+
+func (f *matrixFrontend) Stop() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+
+	if f.client != nil {
+		f.client.StopSync()
+	}
+}
+
+// Accepts room invites so the bot can be added to rooms like it would be added to a Discord server. Only invites to
+// the rooms in [matrix] invites are accepted, or from users on the servers listed there.
+func (f *matrixFrontend) onMember(ctx context.Context, evt *event.Event) {
+	if evt.GetStateKey() != f.client.UserID.String() || evt.Content.AsMember().Membership != event.MembershipInvite {
+		return
+	}
+
+	if !f.invites.contains(evt.RoomID.String()) && !f.invites.contains(evt.Sender.Homeserver()) {
+		fmt.Println("[INFO] Ignored an invite to Matrix room " + evt.RoomID.String() + " from " + evt.Sender.String() + ".")
+		return
+	}
+
+	if _, err := f.client.JoinRoomByID(ctx, evt.RoomID); err != nil {
+		fmt.Println("[ERROR] Failed to join Matrix room " + evt.RoomID.String() + ", ", err)
+	}
+}
+
+// Handler for message events received from Matrix
+func (f *matrixFrontend) onMessage(ctx context.Context, evt *event.Event) {
+	// Don't process commands sent from the bot, or old messages replayed by the initial sync
+	if evt.Sender == f.client.UserID || evt.Timestamp < f.started {
+		return
+	}
+
+	msg := evt.Content.AsMessage()
+
+	if msg.MsgType != event.MsgText {
+		return
+	}
+
+	handleTextMessage("matrix", evt.Sender.String(), evt.RoomID.String(), msg.Body, func(reply textReply) {
+		f.send(ctx, evt.RoomID, reply)
+	})
+}
+
+// Sends a reply to a room, uploading its files as messages of their own
+func (f *matrixFrontend) send(ctx context.Context, roomID id.RoomID, reply textReply) {
+	if reply.content != "" {
+		// Matrix renders the same markdown Discord does, so the output can be sent as-is
+		content := format.RenderMarkdown(reply.content, true, false)
+		content.MsgType = event.MsgNotice
+
+		if _, err := f.client.SendMessageEvent(ctx, roomID, event.EventMessage, &content); err != nil {
+			fmt.Println("[ERROR] Failed to send Matrix message, ", err)
+		}
+	}
+
+	for _, file := range reply.files {
+		upload, err := f.client.UploadBytes(ctx, file.data, http.DetectContentType(file.data))
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to upload " + file.name + " to Matrix, ", err)
+			continue
+		}
+
+		content := event.MessageEventContent{MsgType: event.MsgFile, Body: file.name, URL: upload.ContentURI.CUString()}
+
+		if _, err := f.client.SendMessageEvent(ctx, roomID, event.EventMessage, &content); err != nil {
+			fmt.Println("[ERROR] Failed to send Matrix message, ", err)
+		}
+	}
+}
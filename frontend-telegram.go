@@ -0,0 +1,130 @@
+//go:build telegram
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram rejects messages longer than this, anything longer is sent as a file instead
+const telegramMaxMessageLength = 4096
+
+// Serves the commands as Telegram bot commands (/asm, /disassemble, ...), build with -tags telegram to include it
+type telegramFrontend struct {
+	bot *tgbotapi.BotAPI
+}
+
+func init() {
+	registerFrontend(&telegramFrontend{})
+}
+
+func (f *telegramFrontend) Name() string {
+	return "telegram"
+}
+
+func (f *telegramFrontend) Start() error {
+	token := getConfigSecret("telegram", "token")
+
+	if token == "" {
+		return errors.New("token must be set")
+	}
+
+	bot, err := tgbotapi.NewBotAPI(token)
+
+	if err != nil {
+		return err
+	}
+
+	f.bot = bot
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	updates := bot.GetUpdatesChan(u)
+
+	go func() {
+		for update := range updates {
+			if update.Message != nil && update.Message.IsCommand() {
+				f.onCommand(update.Message)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (f *telegramFrontend) Stop() {
+	if f.bot != nil {
+		f.bot.StopReceivingUpdates()
+	}
+}
+
+// Handler for bot commands received from Telegram, which are run like any other message. /asm x64 nop runs as
+// !asm x64 nop would, and since Telegram's commands can't have dashes, /disas_modes runs !disas-modes.
+func (f *telegramFrontend) onCommand(msg *tgbotapi.Message) {
+	// Posts in channels aren't from anyone
+	if msg.From == nil {
+		return
+	}
+
+	content := strings.TrimSpace(CommandPrefix + strings.Replace(msg.Command(), "_", "-", -1) + " " + msg.CommandArguments())
+
+	handleTextMessage("telegram", strconv.FormatInt(msg.From.ID, 10), strconv.FormatInt(msg.Chat.ID, 10), content, func(reply textReply) {
+		f.send(msg, reply)
+	})
+}
+
+// Sends a reply to a command, with its files as documents
+func (f *telegramFrontend) send(msg *tgbotapi.Message, reply textReply) {
+	files := reply.files
+
+	// Long output is uploaded as a file, so it isn't cut off
+	if len(reply.content) > telegramMaxMessageLength {
+		files = append([]textFile{{"output.txt", []byte(plainText(reply.content))}}, files...)
+	} else if reply.content != "" {
+		message := tgbotapi.NewMessage(msg.Chat.ID, telegramHTML(reply.content))
+		message.ParseMode = tgbotapi.ModeHTML
+		message.ReplyToMessageID = msg.MessageID
+
+		if _, err := f.bot.Send(message); err != nil {
+			fmt.Println("[ERROR] Failed to send Telegram message, ", err)
+		}
+	}
+
+	for _, file := range files {
+		doc := tgbotapi.NewDocument(msg.Chat.ID, tgbotapi.FileBytes{Name: file.name, Bytes: file.data})
+		doc.ReplyToMessageID = msg.MessageID
+
+		if _, err := f.bot.Send(doc); err != nil {
+			fmt.Println("[ERROR] Failed to send Telegram document, ", err)
+		}
+	}
+}
+
+// Converts markdown code fences to Telegram's HTML <pre> blocks, escaping everything else
+func telegramHTML(out string) string {
+	converted := ""
+
+	// Every odd part is inside a code fence
+	for i, part := range strings.Split(out, "```") {
+		if i%2 == 0 {
+			converted += html.EscapeString(part)
+			continue
+		}
+
+		// Drop the language tag on the first line of the fence
+		if nl := strings.Index(part, "\n"); nl != -1 && !strings.Contains(part[:nl], " ") {
+			part = part[nl+1:]
+		}
+
+		converted += "<pre>" + html.EscapeString(part) + "</pre>"
+	}
+
+	return converted
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A chat network other than Discord that the bot can serve commands on. Each frontend lives in its own file
+// guarded by a build tag, and registers itself from init() like a Module does.
+type Frontend interface {
+	// Unique name of the frontend, also the config.ini section it reads its settings from
+	Name() string
+
+	// Connects and starts handling messages in the background
+	Start() error
+
+	// Disconnects and frees resources
+	Stop()
+}
+
+// Stores every frontend that was compiled in
+var frontends []Frontend
+
+// Stores the frontends that started successfully
+var runningFrontends []Frontend
+
+// Registers a frontend, this should be called from the frontend's init()
+func registerFrontend(f Frontend) {
+	frontends = append(frontends, f)
+}
+
+// Starts every compiled in frontend that's enabled in config.ini
+func startFrontends() {
+	for _, f := range frontends {
+		if getConfigPropertyAsStr(f.Name(), "enabled") != "true" {
+			continue
+		}
+
+		if err := f.Start(); err != nil {
+			fmt.Println("[ERROR] Failed to start the " + f.Name() + " frontend, " + err.Error())
+			continue
+		}
+
+		runningFrontends = append(runningFrontends, f)
+		fmt.Println("[INFO] Started the " + f.Name() + " frontend.")
+	}
+}
+
+// Stops every running frontend
+func stopFrontends() {
+	for _, f := range runningFrontends {
+		f.Stop()
+	}
+
+	runningFrontends = nil
+}
+
+// A reply to a message from another chat network: the markdown Discord would have been sent, and any files
+type textReply struct {
+	content string
+	files   []textFile
+}
+
+// A file attached to a reply, read into memory so the frontend can upload it however its network does
+type textFile struct {
+	name string
+	data []byte
+}
+
+// Returned for anything a handler asks of Discord that the other chat networks don't have
+var errNotDiscord = errors.New("only available on Discord")
+
+// Adapts a conversation on another chat network to the Responder interface, so its messages go through the same
+// commands, checks and limits as Discord's. What handlers send to the conversation is passed on as text replies;
+// there are no guilds, DMs or messages to edit, and sent messages have no ID to link to.
+type textResponder struct {
+	channelID string
+	send      func(reply textReply)
+}
+
+func (t *textResponder) reply(channelID string, reply textReply) (*discordgo.Message, error) {
+	if channelID != t.channelID {
+		return nil, errNotDiscord
+	}
+
+	t.send(reply)
+
+	return &discordgo.Message{ChannelID: channelID}, nil
+}
+
+func (t *textResponder) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return t.reply(channelID, textReply{content: content})
+}
+
+func (t *textResponder) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return t.reply(channelID, textReply{content: embedText(embed)})
+}
+
+func (t *textResponder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	reply := textReply{content: data.Content}
+
+	for _, embed := range data.Embeds {
+		reply.content = strings.TrimSpace(reply.content + "\n" + embedText(embed))
+	}
+
+	for _, file := range data.Files {
+		contents, err := ioutil.ReadAll(file.Reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reply.files = append(reply.files, textFile{file.Name, contents})
+	}
+
+	return t.reply(channelID, reply)
+}
+
+func (t *textResponder) ChannelMessageEditComplex(data *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return nil, errNotDiscord
+}
+
+func (t *textResponder) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return nil, errNotDiscord
+}
+
+func (t *textResponder) WebhookExecute(webhookID, token string, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return nil, errNotDiscord
+}
+
+func (t *textResponder) GuildMemberRoleAdd(guildID string, userID string, roleID string, options ...discordgo.RequestOption) error {
+	return errNotDiscord
+}
+
+func (t *textResponder) Guilds() []*discordgo.Guild {
+	return nil
+}
+
+func (t *textResponder) ChannelPermissions(userID string, channelID string) (int64, error) {
+	return 0, errNotDiscord
+}
+
+func (t *textResponder) StateChannel(channelID string) (*discordgo.Channel, error) {
+	return nil, errNotDiscord
+}
+
+// Writes an embed out as markdown, for networks that can't show embeds
+func embedText(embed *discordgo.MessageEmbed) string {
+	if embed == nil {
+		return ""
+	}
+
+	var lines []string
+
+	if embed.Title != "" {
+		lines = append(lines, "**" + embed.Title + "**")
+	}
+
+	if embed.Description != "" {
+		lines = append(lines, embed.Description)
+	}
+
+	for _, field := range embed.Fields {
+		lines = append(lines, "**" + field.Name + "**: " + field.Value)
+	}
+
+	if embed.URL != "" {
+		lines = append(lines, embed.URL)
+	}
+
+	if embed.Footer != nil && embed.Footer.Text != "" {
+		lines = append(lines, embed.Footer.Text)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Handles a message from another chat network the same way a Discord message is handled. Users and conversations
+// are prefixed with the network's name, so they're never taken for Discord IDs (or developers), and there are no
+// guilds, so each user's settings are their own like in a DM.
+func handleTextMessage(network string, userID string, channelID string, content string, send func(reply textReply)) {
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{
+		ChannelID: network + ":" + channelID,
+		Author:    &discordgo.User{ID: network + ":" + userID, Username: userID},
+		Content:   content,
+	}}
+
+	handleMessage(&textResponder{m.ChannelID, send}, m)
+}
+
+// Matches the opening and closing markdown code fences, including the language tag
+var codeFenceRegexp = regexp.MustCompile("```[A-Za-z0-9]*\n?")
+
+// Strips markdown code fences for outputs that can't render them
+func plainText(out string) string {
+	return strings.TrimRight(codeFenceRegexp.ReplaceAllString(out, "\n"), "\n")
+}
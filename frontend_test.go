@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestHandleTextMessage(t *testing.T) {
+	buildCommandMap()
+
+	var replies []textReply
+	send := func(reply textReply) {
+		replies = append(replies, reply)
+	}
+
+	// Commands are looked up the same way as on Discord, aliases included
+	handleTextMessage("irc", "alice", "#rebot", CommandPrefix + "motivateme", send)
+
+	if len(replies) != 1 || replies[0].content != motivationalJapaneseFisherman {
+		t.Fatalf("got %+v, want the motivation", replies)
+	}
+
+	// Other messages aren't answered
+	handleTextMessage("irc", "alice", "#rebot", "motivateme", send)
+
+	if len(replies) != 1 {
+		t.Errorf("got %+v, want no reply to a plain message", replies)
+	}
+}
+
+func TestTextResponder(t *testing.T) {
+	var replies []textReply
+	r := &textResponder{"irc:#rebot", func(reply textReply) {
+		replies = append(replies, reply)
+	}}
+
+	embed := &discordgo.MessageEmbed{Title: "CVE-2014-0160", Description: "Heartbleed", Fields: []*discordgo.MessageEmbedField{{Name: "Score", Value: "7.5"}}}
+	_, _ = r.ChannelMessageSendComplex("irc:#rebot", &discordgo.MessageSend{
+		Content: "Found:",
+		Embeds:  []*discordgo.MessageEmbed{embed},
+		Files:   []*discordgo.File{{Name: "out.txt", Reader: strings.NewReader("nop")}},
+	})
+
+	if len(replies) != 1 || replies[0].content != "Found:\n**CVE-2014-0160**\nHeartbleed\n**Score**: 7.5" {
+		t.Fatalf("got %+v, want the embed as text", replies)
+	}
+
+	if files := replies[0].files; len(files) != 1 || files[0].name != "out.txt" || string(files[0].data) != "nop" {
+		t.Errorf("got %+v, want out.txt", files)
+	}
+
+	// Sent messages can't be linked to, and there's nowhere else to send them
+	if msg, err := r.ChannelMessageSend("irc:#rebot", "ok"); err != nil || msg.ID != "" {
+		t.Errorf("got %+v, %v, want a message without an ID", msg, err)
+	}
+
+	if _, err := r.ChannelMessageSend("irc:#other", "elsewhere"); err != errNotDiscord || len(replies) != 2 {
+		t.Errorf("got %v, want errNotDiscord", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The Discord session /healthz reports on, set once it's connected
+var healthSession *discordgo.Session
+
+// How long the engines get to assemble and disassemble an instruction before they're reported as stuck
+const healthEngineTimeout = 5 * time.Second
+
+// One check in a /healthz response, with what went wrong if it failed
+type healthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Response body for /healthz
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Uptime string                 `json:"uptime"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// Turns the error a check returned into its result
+func healthResult(err error) healthCheck {
+	if err != nil {
+		return healthCheck{false, err.Error()}
+	}
+
+	return healthCheck{OK: true}
+}
+
+// Checks the bot is connected to the Discord gateway and hearing back from it
+func checkGateway() error {
+	if healthSession == nil {
+		return errors.New("not connected yet")
+	}
+
+	// discordgo sets DataReady under the session's lock as the gateway connects and drops
+	healthSession.RLock()
+	ready := healthSession.DataReady
+	healthSession.RUnlock()
+
+	if !ready {
+		return errors.New("disconnected from the gateway")
+	}
+
+	return nil
+}
+
+// Checks Keystone and Capstone both start and give an answer in time, a wedged engine never returns
+func checkEngines() error {
+	done := make(chan error, 1)
+
+	go func() {
+		if _, err := assemble("x64", "nop", asmOptions{}); err != nil {
+			done <- errors.New("keystone: " + err.Error())
+			return
+		}
+
+		if _, err := disassemble("x64", []byte{0x90}, asmOptions{}); err != nil {
+			done <- errors.New("capstone: " + err.Error())
+			return
+		}
+
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(healthEngineTimeout):
+		return errors.New("the engines didn't answer in " + healthEngineTimeout.String())
+	}
+}
+
+// Checks the data directory can still be written to, the stores are saved there as they change
+func checkStorage() error {
+	dir := storeDir()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	probe := filepath.Join(dir, ".healthz")
+
+	if err := ioutil.WriteFile(probe, []byte("ok"), 0644); err != nil {
+		return err
+	}
+
+	return os.Remove(probe)
+}
+
+// GET /healthz, 200 when every check passes and 503 when one fails, so an orchestrator can restart the bot
+func apiHealth(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{
+		Status: "ok",
+		Uptime: time.Since(startTime).Round(time.Second).String(),
+		Checks: map[string]healthCheck{
+			"gateway": healthResult(checkGateway()),
+			"engines": healthResult(checkEngines()),
+			"storage": healthResult(checkStorage()),
+		},
+	}
+
+	status := http.StatusOK
+
+	for _, check := range resp.Checks {
+		if !check.OK {
+			resp.Status, status = "unhealthy", http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// The language assembly output is highlighted as when nothing else is set
+const defaultFenceLanguage = "x86asm"
+
+// Code block languages assembly output is highlighted as, read from the [highlight] section of config.ini. Keys are
+// an architecture, a command, "command.architecture" or "default". !reload swaps it under the lock.
+var (
+	FenceLanguages     map[string]string
+	fenceLanguagesLock sync.RWMutex
+)
+
+// Reads the highlight languages from config.ini
+func loadHighlight() {
+	languages := make(map[string]string)
+
+	for _, key := range getConfigSectionKeys("highlight") {
+		language := strings.TrimSpace(getConfigPropertyAsStr("highlight", key))
+		key = strings.ToLower(key)
+
+		// Architecture aliases work as keys too
+		if dot := strings.Index(key, "."); dot >= 0 {
+			key = key[:dot] + "." + canonicalArch(key[dot+1:])
+		} else {
+			key = canonicalArch(key)
+		}
+
+		if language != "" {
+			languages[key] = language
+		}
+	}
+
+	fenceLanguagesLock.Lock()
+	FenceLanguages = languages
+	fenceLanguagesLock.Unlock()
+}
+
+// Returns the first name of an architecture, so "x64" and "x86_64" look up the same language
+func canonicalArch(arch string) string {
+	arch = strings.ToLower(arch)
+
+	for _, names := range architectureNames(asm.AssembleArchs + ", " + asm.DisassembleArchs) {
+		if StrList(names).contains(arch) {
+			return names[0]
+		}
+	}
+
+	return arch
+}
+
+// The keys a command's output for an architecture is looked up under, most specific first
+func fenceLanguageKeys(command string, arch string) []string {
+	arch = canonicalArch(arch)
+
+	return []string{command + "." + arch, arch, command, "default"}
+}
+
+// Works out the language a command's output for an architecture is highlighted as. A guild's settings win over
+// config.ini, then the most specific key wins, i.e. "assemble.arm" over "arm" over "assemble".
+func fenceLanguage(scope string, command string, arch string) string {
+	overrides := getGuildSettings(scope).FenceLanguages
+
+	for _, key := range fenceLanguageKeys(command, arch) {
+		if language, ok := overrides[key]; ok {
+			return language
+		}
+	}
+
+	fenceLanguagesLock.RLock()
+	configured := FenceLanguages
+	fenceLanguagesLock.RUnlock()
+
+	for _, key := range fenceLanguageKeys(command, arch) {
+		if language, ok := configured[key]; ok {
+			return language
+		}
+	}
+
+	return defaultFenceLanguage
+}
+
+// Turns a key given to !settings highlight into the key it's looked up under, resolving command aliases and
+// architecture aliases. False if it isn't "default", an architecture, a command or "command.architecture".
+func normalizeFenceLanguageKey(key string) (string, bool) {
+	key = strings.ToLower(key)
+
+	if dot := strings.Index(key, "."); dot >= 0 {
+		command, ok := findCommand(strings.TrimPrefix(key[:dot], CommandPrefix))
+
+		if !ok || !isKnownArchitecture(key[dot+1:]) {
+			return "", false
+		}
+
+		return command.name + "." + canonicalArch(key[dot+1:]), true
+	}
+
+	if key == "default" {
+		return key, true
+	}
+
+	if isKnownArchitecture(key) {
+		return canonicalArch(key), true
+	}
+
+	if command, ok := findCommand(strings.TrimPrefix(key, CommandPrefix)); ok {
+		return command.name, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Number of previous commands remembered per user
+const maxHistory = 10
+
+// Commands that aren't added to the history, since re-running them would just loop
+var historyIgnored = StrList{"last", "redo", "history"}
+
+// Stores each user's most recent commands, newest first, keyed by Discord user ID
+var (
+	historyMap  = make(map[string][][]string)
+	historyLock sync.Mutex
+)
+
+// Records a command invocation for the user
+func addHistory(userID string, command Command, args []string) {
+	if historyIgnored.contains(command.name) {
+		return
+	}
+
+	// Store the canonical command name, so aliases all look the same in the history
+	entry := append([]string{command.name}, args[1:]...)
+
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	history := append([][]string{entry}, historyMap[userID]...)
+
+	if len(history) > maxHistory {
+		history = history[:maxHistory]
+	}
+
+	historyMap[userID] = history
+}
+
+// Returns the user's nth most recent command, starting from 1
+func getHistory(userID string, n int) ([]string, bool) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	history := historyMap[userID]
+
+	if n < 1 || n > len(history) {
+		return nil, false
+	}
+
+	return append([]string{}, history[n-1]...), true
+}
+
+// Lists the user's recent commands
+func cmdHistory(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	historyLock.Lock()
+	history := historyMap[m.Author.ID]
+	out := ""
+
+	for i, entry := range history {
+		out += strconv.Itoa(i+1) + ": " + CommandPrefix + strings.Join(entry, " ") + "\n"
+	}
+
+	historyLock.Unlock()
+
+	if out == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "You haven't run any commands yet.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Your recent commands: ```" + out + "```")
+}
+
+// Re-runs the user's most recent command
+func cmdLast(params cmdArguments) {
+	redo(params, 1, nil)
+}
+
+// Re-runs one of the user's recent commands, any extra arguments replace the old ones starting from the first,
+// i.e. "!redo 1 x86" re-runs "!disassemble x64 90 c3" as "!disassemble x86 90 c3"
+func cmdRedo(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	n, err := strconv.Atoi(args[1])
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "redo [n] {overrides ...}")
+		return
+	}
+
+	redo(params, n, args[2:])
+}
+
+// Re-runs the user's nth most recent command with the given argument overrides
+func redo(params cmdArguments, n int, overrides []string) {
+	s := params.s
+	m := params.m
+
+	entry, ok := getHistory(m.Author.ID, n)
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "There's no command #" + strconv.Itoa(n) + " in your history, see " + CommandPrefix + "history")
+		return
+	}
+
+	for i, override := range overrides {
+		if i+1 < len(entry) {
+			entry[i+1] = override
+		} else {
+			entry = append(entry, override)
+		}
+	}
+
+	command(s, m, entry, entry[0])
+}
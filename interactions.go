@@ -0,0 +1,382 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// Application commands registered with Discord when the bot connects. Message commands are in the "Apps"
+// menu when right clicking a message, slash commands run the text command of the same name.
+var applicationCommands = []*discordgo.ApplicationCommand{
+	{Name: "Disassemble", Type: discordgo.MessageApplicationCommand},
+	{
+		Name:        "assemble",
+		Type:        discordgo.ChatApplicationCommand,
+		Description: "Assemble instructions",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "arch", Description: "Architecture", Required: true, Autocomplete: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "instructions", Description: "Instructions, separated by ;", Required: true},
+		},
+	},
+	{
+		Name:        "disassemble",
+		Type:        discordgo.ChatApplicationCommand,
+		Description: "Disassemble opcodes",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "arch", Description: "Architecture", Required: true, Autocomplete: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "opcodes", Description: "Hex bytes", Required: true},
+		},
+	},
+}
+
+// The option each slash command takes its input from, after the architecture
+var slashCommandInputs = map[string]string{
+	"assemble":    "instructions",
+	"disassemble": "opcodes",
+}
+
+// Bytes picked out of a message with the Disassemble message command, waiting for the user to pick an architecture,
+// keyed by the interaction that asked
+type pendingDisassembly struct {
+	opcodes []byte
+	expires time.Time
+}
+
+var (
+	pendingDisassemblies     = make(map[string]pendingDisassembly)
+	pendingDisassembliesLock sync.Mutex
+)
+
+// How long the architecture menu keeps working, Discord stops accepting responses to an interaction after 15 minutes
+const pendingDisassemblyTTL = 15 * time.Minute
+
+// Registers the application commands and starts handling interactions
+func startInteractions(bot *discordgo.Session) {
+	bot.AddHandler(interactionCreate)
+
+	if _, err := bot.ApplicationCommandBulkOverwrite(bot.State.User.ID, "", applicationCommands); err != nil {
+		fmt.Println("[ERROR] Failed to register application commands, ", err)
+	}
+}
+
+// Handler for interaction events received from Discord
+func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		data := i.ApplicationCommandData()
+
+		if data.Name == "Disassemble" && data.CommandType == discordgo.MessageApplicationCommand {
+			disassembleMessageCommand(s, i, data)
+		} else if _, ok := slashCommandInputs[data.Name]; ok {
+			slashCommand(s, i, data)
+		}
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		archAutocomplete(s, i, i.ApplicationCommandData())
+	case discordgo.InteractionMessageComponent:
+		if data := i.MessageComponentData(); strings.HasPrefix(data.CustomID, "disassemble:") && len(data.Values) > 0 {
+			disassembleArchPicked(s, i, strings.TrimPrefix(data.CustomID, "disassemble:"), data.Values[0])
+		} else if strings.HasPrefix(data.CustomID, "rerender:") {
+			rerenderPressed(s, i, data.CustomID)
+		} else if strings.HasPrefix(data.CustomID, "cancel:") {
+			cancelPressed(s, i, strings.TrimPrefix(data.CustomID, "cancel:"))
+		}
+	}
+}
+
+// Responds to an interaction with a message only the user sees
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string, components []discordgo.MessageComponent) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: content, Components: components, Flags: discordgo.MessageFlagsEphemeral},
+	})
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to respond to an interaction, ", err)
+	}
+}
+
+// Picks the bytes out of a message's text: the longest run of hex bytes, as "55 48 89 e5", "0x55, 0x48",
+// "\x55\x48" or "554889e5", so a question around the bytes doesn't get in the way
+func extractHexBytes(text string) []byte {
+	text = strings.NewReplacer(`\x`, " ", "0x", " ", ",", " ", `"`, " ", "`", " ", ";", " ").Replace(text)
+
+	var best, run []byte
+
+	for _, word := range strings.Fields(text) {
+		if data, err := parseOpcodes(word); err == nil && len(data) > 0 {
+			run = append(run, data...)
+		} else {
+			run = nil
+		}
+
+		if len(run) > len(best) {
+			best = append([]byte{}, run...)
+		}
+	}
+
+	return best
+}
+
+// Splits a list of architectures formatted for display into each architecture's names, the first name and then its
+// aliases
+func architectureNames(archs string) [][]string {
+	var names [][]string
+
+	for _, arch := range strings.Split(archs, ", ") {
+		names = append(names, strings.Split(arch, "/"))
+	}
+
+	return names
+}
+
+// The architectures in the menu, the first name of each disassembler architecture
+func disassemblyArchOptions(chosen string) []discordgo.SelectMenuOption {
+	var options []discordgo.SelectMenuOption
+
+	for _, names := range architectureNames(asm.DisassembleArchs) {
+		options = append(options, discordgo.SelectMenuOption{Label: names[0], Value: names[0], Default: names[0] == chosen})
+	}
+
+	// A select menu holds 25 options at most
+	if len(options) > 25 {
+		options = options[:25]
+	}
+
+	return options
+}
+
+// Answers the Disassemble message command: finds the bytes in the message and asks which architecture they are
+func disassembleMessageCommand(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ApplicationCommandInteractionData) {
+	var target *discordgo.Message
+
+	if data.Resolved != nil {
+		target = data.Resolved.Messages[data.TargetID]
+	}
+
+	if target == nil {
+		respondEphemeral(s, i, "Sorry, Discord didn't send the message.", nil)
+		return
+	}
+
+	opcodes := extractHexBytes(target.Content)
+
+	if len(opcodes) == 0 {
+		respondEphemeral(s, i, "Sorry, there are no hex bytes in that message.", nil)
+		return
+	}
+
+	if MaxOpcodeBytes > 0 && len(opcodes) > MaxOpcodeBytes {
+		respondEphemeral(s, i, "Sorry, " + limitError{"opcode bytes", len(opcodes), MaxOpcodeBytes}.Error() + ".", nil)
+		return
+	}
+
+	pendingDisassembliesLock.Lock()
+
+	for id, pending := range pendingDisassemblies {
+		if time.Now().After(pending.expires) {
+			delete(pendingDisassemblies, id)
+		}
+	}
+
+	pendingDisassemblies[i.ID] = pendingDisassembly{opcodes, time.Now().Add(pendingDisassemblyTTL)}
+	pendingDisassembliesLock.Unlock()
+
+	menu := discordgo.SelectMenu{
+		CustomID:    "disassemble:" + i.ID,
+		Placeholder: "Architecture",
+		MaxValues:   1,
+		Options:     disassemblyArchOptions(getUserPrefs(interactionUser(i).ID).Arch),
+	}
+
+	preview := strings.TrimSpace(formatOpcodes(opcodes))
+
+	if len(opcodes) > 16 {
+		preview = strings.TrimSpace(formatOpcodes(opcodes[:16])) + " ..."
+	}
+
+	content := fmt.Sprintf("Found %d bytes, `%s`. Which architecture are they?", len(opcodes), preview)
+
+	respondEphemeral(s, i, content, []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{menu}}})
+}
+
+// Disassembles the bytes once an architecture is picked, running !disassemble as if the user had typed it
+func disassembleArchPicked(s *discordgo.Session, i *discordgo.InteractionCreate, id string, arch string) {
+	pendingDisassembliesLock.Lock()
+	pending, ok := pendingDisassemblies[id]
+	pendingDisassembliesLock.Unlock()
+
+	if !ok || time.Now().After(pending.expires) {
+		respondEphemeral(s, i, "Sorry, that menu has expired, use Disassemble on the message again.", nil)
+		return
+	}
+
+	runInteractionCommand(s, i, append([]string{"disassemble", arch}, strings.Fields(formatOpcodes(pending.opcodes))...))
+}
+
+// Runs a slash command as the text command of the same name, with the architecture before the input
+func slashCommand(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ApplicationCommandInteractionData) {
+	args := []string{data.Name}
+	input := ""
+
+	for _, option := range data.Options {
+		switch option.Name {
+		case "arch":
+			args = append(args, strings.TrimSpace(option.StringValue()))
+		case slashCommandInputs[data.Name]:
+			input = option.StringValue()
+		}
+	}
+
+	runInteractionCommand(s, i, append(args, splitCommandArgs(input)...))
+}
+
+// Runs a text command for an interaction, as if the user had typed it in the interaction's channel. The command's
+// first reply is the interaction's response.
+func runInteractionCommand(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        i.ID,
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		Author:    interactionUser(i),
+		Content:   CommandPrefix + strings.Join(args, " "),
+	}}
+
+	r := &interactionResponder{discordResponder: discordResponder{s}, interaction: i.Interaction}
+	command(r, m, args, args[0])
+
+	// Blocked users and commands limited to other channels can end without a reply, the interaction still needs one
+	if !r.responded {
+		respondEphemeral(s, i, "Sorry, that command can't be used here.", nil)
+	}
+}
+
+// Suggests architectures for the arch option as it's typed, the ones the command supports whose names or aliases
+// start with what's typed so far, then any that only contain it
+func archAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ApplicationCommandInteractionData) {
+	archs := asm.AssembleArchs
+
+	if data.Name == "disassemble" {
+		archs = asm.DisassembleArchs
+	}
+
+	typed := ""
+
+	for _, option := range data.Options {
+		if option.Focused {
+			typed = strings.ToLower(strings.TrimSpace(option.StringValue()))
+		}
+	}
+
+	var prefixed, contained []*discordgo.ApplicationCommandOptionChoice
+
+	for _, names := range architectureNames(archs) {
+		for _, name := range names {
+			choice := &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name}
+
+			if name != names[0] {
+				choice.Name = name + " (" + names[0] + ")"
+			}
+
+			if strings.HasPrefix(name, typed) {
+				prefixed = append(prefixed, choice)
+			} else if strings.Contains(name, typed) {
+				contained = append(contained, choice)
+			}
+		}
+	}
+
+	choices := append(prefixed, contained...)
+
+	// Discord shows 25 suggestions at most
+	if len(choices) > 25 {
+		choices = choices[:25]
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to respond to an interaction, ", err)
+	}
+}
+
+// Handles a job's Cancel button. The job edits its own message, so the button press only needs acknowledging.
+func cancelPressed(s *discordgo.Session, i *discordgo.InteractionCreate, id string) {
+	job, err := strconv.Atoi(id)
+
+	if err == nil {
+		err = cancelJob(job, interactionUser(i).ID)
+	}
+
+	if err != nil {
+		respondEphemeral(s, i, "Sorry, " + err.Error() + ".", nil)
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to respond to an interaction, ", err)
+	}
+}
+
+// The user that used an interaction, interactions in guilds come from a member
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+
+	return i.User
+}
+
+// Sends a command's first reply to the interaction's channel as the response to the interaction, so Discord shows
+// it as the answer to the menu. Anything after that is sent to the channel as usual.
+type interactionResponder struct {
+	discordResponder
+	interaction *discordgo.Interaction
+	responded   bool
+}
+
+// Checks if a message to the channel is the interaction's response
+func (r *interactionResponder) responds(channelID string) bool {
+	return !r.responded && channelID == r.interaction.ChannelID
+}
+
+func (r *interactionResponder) respond(channelID string, data *discordgo.InteractionResponseData) (*discordgo.Message, error) {
+	r.responded = true
+	err := r.discordResponder.InteractionRespond(r.interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: data})
+
+	return &discordgo.Message{ChannelID: channelID}, err
+}
+
+func (r *interactionResponder) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if r.responds(channelID) {
+		return r.respond(channelID, &discordgo.InteractionResponseData{Content: content})
+	}
+
+	return r.discordResponder.ChannelMessageSend(channelID, content, options...)
+}
+
+func (r *interactionResponder) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if r.responds(channelID) {
+		return r.respond(channelID, &discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{embed}})
+	}
+
+	return r.discordResponder.ChannelMessageSendEmbed(channelID, embed, options...)
+}
+
+func (r *interactionResponder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if r.responds(channelID) {
+		return r.respond(channelID, &discordgo.InteractionResponseData{Content: data.Content, Embeds: data.Embeds, Components: data.Components, Files: data.Files})
+	}
+
+	return r.discordResponder.ChannelMessageSendComplex(channelID, data, options...)
+}
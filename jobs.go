@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Commands that can take a while: disassembling, scanning or emulating a whole binary, or lifting and decompiling.
+// They post a working message straight away, which is kept up to date and then replaced by the result.
+var heavyCommands = StrList{
+	"objdump", "funcs", "xref", "scan", "yaragen", "fuzzyhash", "triage", "pseudo", "sctest", "strace",
+}
+
+// How often a working message is updated with how long the job has been running
+const jobProgressInterval = 5 * time.Second
+
+// How many heavy jobs run at once, read from the [jobs] section of config.ini. The rest wait in line.
+var JobWorkers int
+
+// What a job is guessed to take before any have finished
+const defaultJobDuration = 10 * time.Second
+
+// Returned for a cancelled job's replies, they're dropped instead of being sent
+var errJobCancelled = errors.New("the job was cancelled")
+
+// Runs a heavy command's handler, answering with a working message that's edited as the job goes on. The handler's
+// first reply to the channel replaces the working message, anything after it is sent as usual. Handlers that can
+// stop part way check the job's context.
+type jobResponder struct {
+	Responder
+	id        int
+	userID    string
+	channelID string
+	messageID string
+	name      string
+	started   time.Time
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	lock      sync.Mutex
+	status    string
+	replaced  bool
+	cancelled bool
+
+	// The job's place in line while it waits for a worker, 0 once it's running, and when it's expected to start
+	position  int
+	startsAt  time.Time
+}
+
+// Heavy jobs that are running or waiting, keyed by the ID users cancel them with. The jobs waiting for a worker
+// are in jobQueue in the order they were started, and wait on jobQueueCond for a worker to free up.
+var (
+	runningJobs     = make(map[int]*jobResponder)
+	runningJobsLock sync.Mutex
+	nextJobID       = 1
+	jobQueue        []*jobResponder
+	jobQueueCond    = sync.NewCond(&runningJobsLock)
+	activeJobs      int
+	jobDuration     = defaultJobDuration
+)
+
+// Reads the number of job workers from config.ini
+func loadJobs() {
+	workers := getConfigPropertyAsInt("jobs", "workers", 2)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	runningJobsLock.Lock()
+	JobWorkers = workers
+	runningJobsLock.Unlock()
+
+	// More workers can take jobs that are waiting
+	jobQueueCond.Broadcast()
+}
+
+// The working message's text, with how long the job has run and what it's doing if the handler said. A job that's
+// waiting says where it is in line instead.
+func (j *jobResponder) workingMessage() string {
+	if j.position > 0 {
+		content := "⏳ Job #" + strconv.Itoa(j.id) + ", " + CommandPrefix + j.name + " is number " + strconv.Itoa(j.position) + " in line"
+
+		if wait := time.Until(j.startsAt).Round(time.Second); wait > 0 {
+			content += ", starting in about " + wait.String()
+		} else {
+			content += ", starting any moment"
+		}
+
+		return content + ". `" + CommandPrefix + "cancel " + strconv.Itoa(j.id) + "` takes it out."
+	}
+
+	elapsed := time.Since(j.started).Round(time.Second)
+	content := "⏳ Job #" + strconv.Itoa(j.id) + ", working on " + CommandPrefix + j.name
+
+	if elapsed > 0 {
+		content += " (" + elapsed.String() + ")"
+	}
+
+	if j.status != "" {
+		content += ": " + j.status
+	}
+
+	return content + "... `" + CommandPrefix + "cancel " + strconv.Itoa(j.id) + "` stops it."
+}
+
+// The working message's Cancel button
+func (j *jobResponder) cancelButton() []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.Button{Label: "Cancel", Style: discordgo.DangerButton, CustomID: "cancel:" + strconv.Itoa(j.id)},
+	}}}
+}
+
+// Updates the working message, unless the result has already replaced it
+func (j *jobResponder) update() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.replaced {
+		return
+	}
+
+	_, _ = j.Responder.ChannelMessageEditComplex(&discordgo.MessageEdit{ID: j.messageID, Channel: j.channelID, Content: stringPtr(j.workingMessage())})
+}
+
+// Puts the job at the back of the line for a worker. Called with runningJobsLock held.
+func (j *jobResponder) enqueue() {
+	jobQueue = append(jobQueue, j)
+	j.queued()
+}
+
+// Works out the job's place in line and when it should start, from how long jobs have been taking. Called with
+// runningJobsLock held, returns true if the place changed.
+func (j *jobResponder) queued() bool {
+	position := 0
+
+	for n, queued := range jobQueue {
+		if queued == j {
+			position = n + 1
+		}
+	}
+
+	// Started once it's first in line and a worker is free
+	if position == 1 && activeJobs < JobWorkers {
+		position = 0
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if position == j.position {
+		return false
+	}
+
+	// Each round of workers takes about as long as a job does
+	rounds := (position + JobWorkers - 1) / JobWorkers
+	j.position, j.startsAt = position, time.Now().Add(time.Duration(rounds) * jobDuration)
+
+	if position == 0 {
+		j.started = time.Now()
+	}
+
+	return true
+}
+
+// Waits in line until a worker is free, updating the working message as the line moves. False if the job was
+// cancelled while it waited.
+func (j *jobResponder) waitForWorker() bool {
+	runningJobsLock.Lock()
+	defer runningJobsLock.Unlock()
+
+	for j.ctx.Err() == nil {
+		changed := j.queued()
+
+		if j.position == 0 {
+			break
+		}
+
+		// The message is edited without holding up the line, and the line checked again after
+		if changed {
+			runningJobsLock.Unlock()
+			j.update()
+			runningJobsLock.Lock()
+			continue
+		}
+
+		jobQueueCond.Wait()
+	}
+
+	for n, queued := range jobQueue {
+		if queued == j {
+			jobQueue = append(jobQueue[:n], jobQueue[n + 1:]...)
+			break
+		}
+	}
+
+	if j.ctx.Err() != nil {
+		jobQueueCond.Broadcast()
+		return false
+	}
+
+	activeJobs++
+	jobQueueCond.Broadcast()
+
+	return true
+}
+
+// Frees the job's worker for the next in line, and folds how long it took into the guess for the ones waiting
+func (j *jobResponder) release() {
+	runningJobsLock.Lock()
+	defer runningJobsLock.Unlock()
+
+	activeJobs--
+	jobDuration = (jobDuration * 3 + time.Since(j.started)) / 4
+	jobQueueCond.Broadcast()
+}
+
+// Checks if the job was cancelled, its handler may still be finishing up
+func (j *jobResponder) isCancelled() bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.cancelled
+}
+
+// Replaces the working message with a reply, false if it was already replaced, the reply goes somewhere else or
+// the edit failed. A failed edit leaves the reply to be sent as a message of its own.
+func (j *jobResponder) replace(channelID string, edit *discordgo.MessageEdit) (*discordgo.Message, bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.replaced || channelID != j.channelID {
+		return nil, false
+	}
+
+	j.replaced = true
+	edit.ID, edit.Channel = j.messageID, j.channelID
+
+	// The Cancel button goes with the working message
+	if edit.Components == nil {
+		edit.Components = &[]discordgo.MessageComponent{}
+	}
+
+	msg, err := j.Responder.ChannelMessageEditComplex(edit)
+
+	return msg, err == nil
+}
+
+func (j *jobResponder) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if j.isCancelled() {
+		return nil, errJobCancelled
+	}
+
+	if msg, ok := j.replace(channelID, &discordgo.MessageEdit{Content: &content}); ok {
+		return msg, nil
+	}
+
+	return j.Responder.ChannelMessageSend(channelID, content, options...)
+}
+
+func (j *jobResponder) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if j.isCancelled() {
+		return nil, errJobCancelled
+	}
+
+	if msg, ok := j.replace(channelID, &discordgo.MessageEdit{Content: stringPtr(""), Embeds: &[]*discordgo.MessageEmbed{embed}}); ok {
+		return msg, nil
+	}
+
+	return j.Responder.ChannelMessageSendEmbed(channelID, embed, options...)
+}
+
+func (j *jobResponder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if j.isCancelled() {
+		return nil, errJobCancelled
+	}
+
+	edit := &discordgo.MessageEdit{Content: &data.Content, Embeds: &data.Embeds, Files: data.Files}
+
+	if data.Components != nil {
+		edit.Components = &data.Components
+	}
+
+	if msg, ok := j.replace(channelID, edit); ok {
+		return msg, nil
+	}
+
+	return j.Responder.ChannelMessageSendComplex(channelID, data, options...)
+}
+
+// Tells the user what a heavy command is doing, i.e. "disassembling .text". Handlers call this as they go, it does
+// nothing when the command isn't running as a job.
+func reportProgress(s Responder, status string) {
+	if job, ok := s.(*jobResponder); ok {
+		job.lock.Lock()
+		job.status = status
+		job.lock.Unlock()
+
+		job.update()
+	}
+}
+
+// The context a handler's work is cancelled through, one that's never cancelled when it isn't running as a job
+func jobContext(s Responder) context.Context {
+	if job, ok := s.(*jobResponder); ok {
+		return job.ctx
+	}
+
+	return context.Background()
+}
+
+// Returns a pointer to the string, for the optional fields of a message edit
+func stringPtr(str string) *string {
+	return &str
+}
+
+// Runs a heavy command as a job: posts the working message, keeps it updated while the handler runs, and lets the
+// handler's reply take its place
+func runJob(s Responder, m *discordgo.MessageCreate, command Command, args []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runningJobsLock.Lock()
+	job := &jobResponder{Responder: s, id: nextJobID, userID: m.Author.ID, channelID: m.ChannelID, name: command.name, started: time.Now(), ctx: ctx, cancel: cancel}
+	nextJobID++
+	job.enqueue()
+	runningJobsLock.Unlock()
+
+	msg, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Content: job.workingMessage(), Components: job.cancelButton()})
+
+	// Without a message to edit, i.e. when answering an interaction, the handler just answers as usual once it's
+	// its turn
+	if err != nil || msg == nil || msg.ID == "" {
+		job.waitForWorker()
+		defer job.release()
+
+		command.handler(cmdArguments{s, m, args})
+		return
+	}
+
+	job.messageID = msg.ID
+
+	runningJobsLock.Lock()
+	runningJobs[job.id] = job
+	runningJobsLock.Unlock()
+
+	defer func() {
+		runningJobsLock.Lock()
+		delete(runningJobs, job.id)
+		runningJobsLock.Unlock()
+	}()
+
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(jobProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				job.update()
+			}
+		}
+	}()
+
+	// Cancelled while it waited, the message already says so
+	waited := job.position > 0
+
+	if !job.waitForWorker() {
+		close(done)
+		return
+	}
+
+	if waited {
+		job.update()
+	}
+	command.handler(cmdArguments{job, m, args})
+	job.release()
+	close(done)
+
+	// A handler that only answered elsewhere, i.e. in DMs, still shouldn't leave the message working
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	if !job.replaced {
+		job.replaced = true
+		content := "Done in " + strconv.FormatFloat(time.Since(job.started).Seconds(), 'f', 1, 64) + "s."
+		_, _ = s.ChannelMessageEditComplex(&discordgo.MessageEdit{ID: job.messageID, Channel: job.channelID, Content: &content, Components: &[]discordgo.MessageComponent{}})
+	}
+}
+
+// Cancels a running job for the user, who has to be the one that started it or a developer. The working message
+// says who cancelled it, and anything the handler sends after is dropped.
+func cancelJob(id int, userID string) error {
+	runningJobsLock.Lock()
+	job, ok := runningJobs[id]
+	runningJobsLock.Unlock()
+
+	if !ok {
+		return errors.New("there's no job #" + strconv.Itoa(id) + " running")
+	}
+
+	if job.userID != userID && !DeveloperList.contains(userID) {
+		return errors.New("job #" + strconv.Itoa(id) + " can only be cancelled by whoever started it")
+	}
+
+	job.cancel()
+
+	// Wakes the job if it's waiting in line, under the lock so it can't miss it
+	runningJobsLock.Lock()
+	jobQueueCond.Broadcast()
+	runningJobsLock.Unlock()
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	if job.replaced {
+		return errors.New("job #" + strconv.Itoa(id) + " has already finished")
+	}
+
+	job.cancelled, job.replaced = true, true
+	content := "🛑 Job #" + strconv.Itoa(id) + " (" + CommandPrefix + job.name + ") was cancelled by <@" + userID + ">."
+	_, _ = job.Responder.ChannelMessageEditComplex(&discordgo.MessageEdit{ID: job.messageID, Channel: job.channelID, Content: &content, Components: &[]discordgo.MessageComponent{}})
+
+	return nil
+}
+
+// Cancels a heavy job that's still running
+func cmdCancel(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "cancel [job id]")
+		return
+	}
+
+	if err := cancelJob(id, m.Author.ID); err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Job #" + strconv.Itoa(id) + " cancelled.")
+}
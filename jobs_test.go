@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// A job whose working message is already up, as runJob leaves it once the handler starts
+func testJob(f *fakeResponder) *jobResponder {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &jobResponder{Responder: f, id: 1, userID: "400", channelID: "200", messageID: "working", name: "objdump", ctx: ctx, cancel: cancel}
+}
+
+func TestJobReplacesWorkingMessage(t *testing.T) {
+	f := &fakeResponder{}
+	job := testJob(f)
+
+	msg, err := job.ChannelMessageSend("200", "the listing")
+
+	if err != nil || msg.ID != "working" {
+		t.Fatalf("got %+v, %v, want the working message", msg, err)
+	}
+
+	edits := f.edited()
+
+	if len(edits) != 1 || edits[0].ID != "working" || *edits[0].Content != "the listing" {
+		t.Fatalf("got %+v, want the working message edited", edits)
+	}
+
+	// The Cancel button goes
+	if edits[0].Components == nil || len(*edits[0].Components) != 0 {
+		t.Error("the Cancel button was left on the result")
+	}
+
+	// Only the first reply takes its place, the rest are sent as usual
+	_, _ = job.ChannelMessageSend("200", "and more")
+
+	if replies := f.sent(); len(replies) != 1 || replies[0].content != "and more" {
+		t.Errorf("got %+v, want the second reply sent", replies)
+	}
+}
+
+func TestJobRepliesElsewhere(t *testing.T) {
+	f := &fakeResponder{}
+	job := testJob(f)
+
+	// A reply in another channel, i.e. a DM, doesn't replace the working message
+	_, _ = job.ChannelMessageSend("dm-400", "a file for you")
+
+	if len(f.edited()) != 0 || len(f.sent()) != 1 {
+		t.Fatalf("got edits %+v and replies %+v, want one reply", f.edited(), f.sent())
+	}
+
+	_, _ = job.ChannelMessageSendEmbed("200", nil)
+
+	if edits := f.edited(); len(edits) != 1 || edits[0].Embeds == nil || *edits[0].Content != "" {
+		t.Errorf("got %+v, want the embed in place of the working message", edits)
+	}
+}
+
+func TestJobCancelled(t *testing.T) {
+	f := &fakeResponder{}
+	job := testJob(f)
+	job.cancelled = true
+
+	if _, err := job.ChannelMessageSend("200", "too late"); err != errJobCancelled {
+		t.Errorf("got %v, want errJobCancelled", err)
+	}
+
+	if len(f.sent()) != 0 || len(f.edited()) != 0 {
+		t.Error("a cancelled job's reply was sent")
+	}
+}
+
+func TestJobProgress(t *testing.T) {
+	f := &fakeResponder{}
+	job := testJob(f)
+
+	reportProgress(job, "disassembling .text")
+
+	if edits := f.edited(); len(edits) != 1 || !strings.Contains(*edits[0].Content, ": disassembling .text...") {
+		t.Errorf("got %+v, want the status in the working message", edits)
+	}
+
+	if jobContext(job) != job.ctx {
+		t.Error("the handler didn't get the job's context")
+	}
+
+	// Outside a job there's nothing to report to
+	reportProgress(f, "ignored")
+
+	if len(f.edited()) != 1 || jobContext(f) != context.Background() {
+		t.Error("a handler outside a job was treated as one")
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	loadJobs()
+
+	f := &fakeResponder{}
+	m := testMessage("!objdump")
+	command := Command{name: "objdump", handler: func(params cmdArguments) {
+		_, _ = params.s.ChannelMessageSend(params.m.ChannelID, "the listing")
+	}}
+
+	runJob(f, m, command, []string{"!objdump"})
+
+	replies, edits := f.sent(), f.edited()
+
+	if len(replies) != 1 || !strings.Contains(replies[0].content, "working on " + CommandPrefix + "objdump") {
+		t.Fatalf("got %+v, want the working message", replies)
+	}
+
+	if len(edits) == 0 || *edits[len(edits) - 1].Content != "the listing" || edits[len(edits) - 1].ID != "1" {
+		t.Errorf("got %+v, want the working message replaced by the listing", edits)
+	}
+
+	// A handler that doesn't answer in the channel still finishes the working message
+	f = &fakeResponder{}
+	command.handler = func(params cmdArguments) {}
+	runJob(f, m, command, []string{"!objdump"})
+
+	if edits := f.edited(); len(edits) == 0 || !strings.HasPrefix(*edits[len(edits) - 1].Content, "Done in") {
+		t.Errorf("got %+v, want the working message marked done", edits)
+	}
+}
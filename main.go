@@ -19,6 +19,7 @@ var (
 	GuildID 		string
 	DeveloperMode 	bool
 	DeveloperList 	StrList
+	CommandPrefix 	string
 	startTime 		time.Time
 )
 
@@ -27,14 +28,25 @@ func main() {
 	var bot *discordgo.Session
 	var err error
 
+	// "rebot cli ..." runs a single command in the terminal instead of connecting to Discord
+	if len(os.Args) > 1 && os.Args[1] == "cli" {
+		os.Exit(runCLI(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	startTime = time.Now()
-	botToken := getConfigPropertyAsStr("discord", "token")
+	botToken := getConfigSecret("discord", "token")
 
 	if bot, err = discordgo.New("Bot " + botToken); err != nil {
 		fmt.Println("[ERROR] Critical error creating Discord session, ", err)
 		return
 	}
 
+	GuildID = ""
+	DeveloperMode  = false
+	DeveloperList  = []string{"165177089035599873"} // List of discord user ID's that can access developer commands
+
+	loadAll()
+
 	// Handle messageCreate events sent from Discord
 	bot.AddHandler(messageCreate)
 
@@ -43,13 +55,19 @@ func main() {
 		return
 	}
 
-	GuildID = ""
-	DeveloperMode  = false
-	DeveloperList  = []string{"165177089035599873"} // List of discord user ID's that can access developer commands
+	healthSession = bot
+	startInteractions(bot)
 
-	// Build the alias maps for commands and dictionary definitions
-	buildDictionaryMap()
-	buildCommandMap()
+	// Serve the HTTP API and any other chat frontends if they're enabled
+	startAPIServer()
+	startFrontends()
+	startTrickSync()
+
+	// Start posting scheduled content to webhooks
+	startScheduledPosts(discordResponder{bot})
+	startChallengeSchedule(discordResponder{bot})
+	startManualLinkCheck(discordResponder{bot})
+	startManualMirror()
 
 	fmt.Println("[INFO] Bot is now running! Press CTRL-C to stop!")
 
@@ -58,10 +76,39 @@ func main() {
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
 	<-sc
 
-	// Close the client and free resources
+	// Close the clients and free resources
+	stopFrontends()
 	_ = bot.Close()
 }
 
+// Reads the settings from config.ini and everything they point at, builds the command list and loads the users' data
+func loadAll() {
+	// Read the command prefix and input size limits
+	loadPrefix()
+	loadLimits()
+	loadCache()
+	loadHighlight()
+	loadJobs()
+	loadAbuse()
+	loadDedupe()
+
+	// Build the alias maps for commands and dictionary definitions
+	buildDictionaryMap()
+	loadTricks()
+	loadManuals()
+	loadSignatures()
+	buildCommandMap()
+
+	// Load persistent user data, before any messages can be handled
+	loadPrefs()
+	loadSnippets()
+	loadSettings()
+	loadBlocklist()
+	loadTrickSubmissions()
+	loadPoints()
+	loadChallenges()
+}
+
 // Handler for message events received from Discord
 func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 	// Don't process commands sent from the bot
@@ -69,15 +116,25 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
+	handleMessage(discordResponder{s}, m)
+}
+
+// Handles a message from Discord or one of the other frontends, as a quiz answer or a command
+func handleMessage(s Responder, m *discordgo.MessageCreate) {
 	// Don't handle nil messages
 	if len(m.Content) <= 0 {
 		return
 	}
 
-	// When the first character is the command character, parse the command and pass it off to the generic command handler
-	if m.Content[0] == '!' {
-		cmd := strings.Replace(m.Content, "!", "", 1)
-		cmdParts := strings.Split(cmd, " ")
+	// Quiz answers are plain messages, so they're checked before looking for a command
+	if !strings.HasPrefix(m.Content, CommandPrefix) && checkQuizAnswer(s, m) {
+		return
+	}
+
+	// When the message starts with the command prefix, parse the command and pass it off to the generic command handler
+	if strings.HasPrefix(m.Content, CommandPrefix) {
+		cmd := strings.TrimPrefix(m.Content, CommandPrefix)
+		cmdParts := splitCommandArgs(cmd)
 
 		command(s, m, cmdParts, cmdParts[0])
 	}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Client used by the link checker, manuals are big so only the response headers are waited for
+var manualCheckClient = &http.Client{Timeout: 30 * time.Second}
+
+// Manuals whose links were broken at the last check, so the developers are only told once per breakage
+var (
+	brokenManuals    = make(map[string]bool)
+	brokenManualLock sync.Mutex
+)
+
+// Checks that a manual link still resolves. Some vendors refuse HEAD requests, so those get a GET instead.
+func checkManualLink(url string) error {
+	resp, err := manualCheckClient.Head(url)
+
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusForbidden) {
+		resp.Body.Close()
+		resp, err = manualCheckClient.Get(url)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return errors.New(resp.Status)
+	}
+
+	return nil
+}
+
+// Checks every manual and document link, and tells the developers about links that broke or were fixed since the
+// last check
+func checkManualLinks(s Responder) {
+	manualLock.RLock()
+	list := append([]manual{}, manuals...)
+	manualLock.RUnlock()
+
+	// Links are named like "x86" or "x86 vol3" in the messages
+	links := make(map[string]string)
+	var names []string
+
+	for _, man := range list {
+		if man.URL != "" {
+			links[man.Name] = man.URL
+			names = append(names, man.Name)
+		}
+
+		for _, doc := range man.Documents {
+			links[man.Name + " " + doc.Name] = doc.URL
+			names = append(names, man.Name + " " + doc.Name)
+		}
+	}
+
+	for _, name := range names {
+		url := links[name]
+		err := checkManualLink(url)
+
+		brokenManualLock.Lock()
+		wasBroken := brokenManuals[name]
+		brokenManuals[name] = err != nil
+		brokenManualLock.Unlock()
+
+		if err != nil && !wasBroken {
+			fmt.Println("[ERROR] The " + name + " manual link is broken, " + err.Error())
+			notifyDevelopers(s, "The " + name + " manual link <" + url + "> is broken (" + err.Error() + "), update it in manuals/manuals.json.")
+		} else if err == nil && wasBroken {
+			fmt.Println("[INFO] The " + name + " manual link works again.")
+			notifyDevelopers(s, "The " + name + " manual link <" + url + "> works again.")
+		}
+	}
+}
+
+// Checks the manual links periodically, every [manuals] check_hours (0 turns the checker off)
+func startManualLinkCheck(s Responder) {
+	hours := getConfigPropertyAsInt("manuals", "check_hours", 24)
+
+	if hours <= 0 {
+		return
+	}
+
+	go func() {
+		for {
+			checkManualLinks(s)
+			time.Sleep(time.Duration(hours) * time.Hour)
+		}
+	}()
+}
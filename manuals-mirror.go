@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Largest manual the mirror downloads, the combined Intel SDM is around 25MB
+const maxMirroredManualBytes = 200 * 1024 * 1024
+
+// Client used to download manuals, they're big so the timeout is generous
+var manualMirrorClient = &http.Client{Timeout: 10 * time.Minute}
+
+// Mirrored files by link name ("x86", "x86-vol3"), only filled in once a file has been downloaded
+var (
+	mirroredManuals  = make(map[string]string)
+	manualMirrorLock sync.RWMutex
+)
+
+// Returned for links that aren't PDFs, those are left to the vendor
+var errNotPDF = errors.New("not a PDF")
+
+// Checks if the manual mirror is turned on in the [mirror] section of config.ini. Mirrored manuals are served by the
+// HTTP API server, so it has to be listening too.
+func manualMirrorEnabled() bool {
+	return getConfigPropertyAsStr("mirror", "enabled") == "true" && getConfigPropertyAsStr("mirror", "public_url") != "" &&
+		getConfigPropertyAsStr("api", "listen") != ""
+}
+
+// Returns the directory mirrored manuals are kept in
+func manualMirrorDir() string {
+	dir := getConfigPropertyAsStr("mirror", "dir")
+
+	if dir == "" {
+		dir = "./mirror"
+	}
+
+	return dir
+}
+
+// Returns the mirror's link for a manual or document, or the vendor's link if it isn't mirrored
+func mirroredURL(name string, url string) string {
+	manualMirrorLock.RLock()
+	file, ok := mirroredManuals[name]
+	manualMirrorLock.RUnlock()
+
+	if !ok {
+		return url
+	}
+
+	return strings.TrimRight(getConfigPropertyAsStr("mirror", "public_url"), "/") + "/manuals/" + file
+}
+
+// Downloads a manual into the mirror. Only PDFs are kept, HTML pages don't work without the rest of the vendor's site.
+// The old copy is kept if the download fails, which is the point of the mirror.
+func mirrorManual(name string, url string) error {
+	resp, err := manualMirrorClient.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMirroredManualBytes + 1))
+
+	if err != nil {
+		return err
+	}
+
+	if len(data) > maxMirroredManualBytes {
+		return errors.New("the manual is over the mirror's size limit")
+	}
+
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return errNotPDF
+	}
+
+	dir := manualMirrorDir()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file := name + ".pdf"
+	path := filepath.Join(dir, file)
+
+	if err := ioutil.WriteFile(path + ".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path + ".tmp", path); err != nil {
+		return err
+	}
+
+	manualMirrorLock.Lock()
+	mirroredManuals[name] = file
+	manualMirrorLock.Unlock()
+
+	return nil
+}
+
+// Returns every manual and document link, named like "x86" and "x86-vol3"
+func manualLinks() map[string]string {
+	manualLock.RLock()
+	defer manualLock.RUnlock()
+
+	links := make(map[string]string)
+
+	for _, man := range manuals {
+		if man.URL != "" {
+			links[man.Name] = man.URL
+		}
+
+		for _, doc := range man.Documents {
+			links[man.Name + "-" + doc.Name] = doc.URL
+		}
+	}
+
+	return links
+}
+
+// Picks up manuals that were mirrored before a restart, so links work before the first refresh finishes
+func loadMirroredManuals() {
+	for name := range manualLinks() {
+		file := name + ".pdf"
+
+		if _, err := os.Stat(filepath.Join(manualMirrorDir(), file)); err == nil {
+			manualMirrorLock.Lock()
+			mirroredManuals[name] = file
+			manualMirrorLock.Unlock()
+		}
+	}
+}
+
+// Serves mirrored manuals under /manuals/, only files the mirror downloaded can be fetched
+func serveMirroredManual(w http.ResponseWriter, r *http.Request) {
+	file := strings.TrimPrefix(r.URL.Path, "/manuals/")
+
+	manualMirrorLock.RLock()
+	found := false
+	for _, mirrored := range mirroredManuals {
+		if mirrored == file {
+			found = true
+		}
+	}
+	manualMirrorLock.RUnlock()
+
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	http.ServeFile(w, r, filepath.Join(manualMirrorDir(), file))
+}
+
+// Downloads every manual into the mirror, then refreshes them every [mirror] refresh_hours
+func startManualMirror() {
+	if !manualMirrorEnabled() {
+		return
+	}
+
+	loadMirroredManuals()
+	hours := getConfigPropertyAsInt("mirror", "refresh_hours", 168)
+
+	if hours <= 0 {
+		hours = 168
+	}
+
+	go func() {
+		for {
+			for name, url := range manualLinks() {
+				if err := mirrorManual(name, url); err != nil && err != errNotPDF {
+					fmt.Println("[ERROR] Failed to mirror the " + name + " manual, " + err.Error())
+				}
+			}
+
+			time.Sleep(time.Duration(hours) * time.Hour)
+		}
+	}()
+}
@@ -0,0 +1,37 @@
+#!/bin/bash
+# Builds a !manual search index from a PDF's bookmarks, with page numbers, i.e.
+#   ./manuals/build-index.sh riscv-spec-20191213.pdf > manuals/index/riscv.json
+# Needs pdftk. Titles that start with a section number ("2.1.3 ModR/M and SIB Bytes") are split into the section and title.
+
+if [ $# -ne 1 ]; then
+	echo "Usage: $0 [manual.pdf]" >&2
+	exit 2
+fi
+
+pdftk "$1" dump_data_utf8 | awk '
+function escape(str) {
+	gsub(/\\/, "\\\\", str)
+	gsub(/"/, "\\\"", str)
+	return str
+}
+
+/^BookmarkTitle: / {
+	title = substr($0, 16)
+}
+
+/^BookmarkPageNumber: / {
+	section = ""
+
+	if (match(title, /^(CHAPTER |APPENDIX )?[0-9A-Z]+(\.[0-9]+)*[ \t]+/)) {
+		section = substr(title, 1, RLENGTH)
+		sub(/^(CHAPTER |APPENDIX )/, "", section)
+		sub(/[ \t]+$/, "", section)
+		title = substr(title, RLENGTH + 1)
+	}
+
+	printf "%s\t{\"section\": \"%s\", \"title\": \"%s\", \"page\": %d}", (count++ ? ",\n" : "[\n"), escape(section), escape(title), substr($0, 21)
+}
+
+END {
+	print (count ? "\n]" : "[]")
+}'
@@ -0,0 +1,35 @@
+//go:build !nocve
+
+package main
+
+// CVE look-ups scrape the NVD, build with -tags nocve to leave them out
+type cveModule struct{}
+
+func init() {
+	registerModule(cveModule{})
+}
+
+func (cveModule) Name() string {
+	return "cve"
+}
+
+func (cveModule) Init() error {
+	return nil
+}
+
+func (cveModule) Commands() []Command {
+	return []Command{
+		{
+			name:         "cve",
+			aliases:      []string{},
+			requiredArgs: 2,
+			usage:        "[CVE Identifier]",
+			handler:      cmdCve,
+			dev:          false,
+		},
+	}
+}
+
+func (cveModule) Help() []string {
+	return []string{"!cve [cve identifier] - Displays information on a given CVE from NVD."}
+}
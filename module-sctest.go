@@ -0,0 +1,797 @@
+//go:build unicorn
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+// Shellcode testing runs payloads under the Unicorn emulator, build with -tags unicorn to include it
+type sctestModule struct{}
+
+func init() {
+	registerModule(sctestModule{})
+}
+
+func (sctestModule) Name() string {
+	return "sctest"
+}
+
+func (sctestModule) Init() error {
+	return nil
+}
+
+func (sctestModule) Commands() []Command {
+	return []Command{
+		{
+			name:         "sctest",
+			aliases:      []string{"emulate"},
+			requiredArgs: 3,
+			usage:        "[architecture] [opcodes ...]",
+			handler:      cmdSctest,
+			dev:          false,
+		},
+		{
+			name:         "strace",
+			aliases:      []string{"sctrace"},
+			requiredArgs: 3,
+			usage:        "[architecture] [opcodes ...]",
+			handler:      cmdStrace,
+			dev:          false,
+		},
+	}
+}
+
+func (sctestModule) Help() []string {
+	return []string{"!sctest/emulate [architecture] [opcodes ...] - Runs shellcode in an emulator and reports the system calls it makes, i.e. the program it executes, the address it connects back to and the files it reads.",
+		"!strace/sctrace [architecture] [opcodes ...] - Runs shellcode in an emulator and lists every system call it makes in order, with its arguments decoded and the result it was given."}
+}
+
+// Where the shellcode, its stack and the memory it maps are put in the emulator
+const (
+	sctestCodeAddr  = 0x400000
+	sctestStackAddr = 0x7ff00000
+	sctestStackSize = 0x100000
+	sctestMmapAddr  = 0x10000000
+	sctestMmapSize  = 0x1000000
+
+	// Emulation is stopped after this many instructions, microseconds or system calls, whichever comes first
+	sctestMaxInstructions = 1000000
+	sctestTimeout         = 2000000
+	sctestMaxCalls        = 64
+)
+
+// How shellcode is run and makes system calls on an architecture
+type sctestArch struct {
+	arch, mode int
+	wordSize   int
+	pc, sp     int
+
+	// The register with the system call's number, the ones with its arguments in order and the one it returns in
+	number int
+	args   []int
+	ret    int
+
+	// The interrupt Linux system calls are made with, or -1 for x64's syscall instruction
+	interrupt int
+
+	// Names of the system calls by number, and the full table the ones not emulated are named from
+	syscalls map[uint64]string
+	table    string
+}
+
+// Linux system call numbers of the calls shellcode makes the most
+var (
+	sctestSyscallsX64 = map[uint64]string{
+		0: "read", 1: "write", 2: "open", 3: "close", 9: "mmap", 10: "mprotect", 33: "dup2", 40: "sendfile",
+		41: "socket", 42: "connect", 43: "accept", 49: "bind", 50: "listen", 57: "fork", 59: "execve", 60: "exit",
+		87: "unlink", 90: "chmod", 105: "setuid", 106: "setgid", 113: "setreuid", 231: "exit_group", 257: "openat",
+		288: "accept4", 292: "dup3", 322: "execveat",
+	}
+
+	sctestSyscallsX86 = map[uint64]string{
+		1: "exit", 2: "fork", 3: "read", 4: "write", 5: "open", 6: "close", 10: "unlink", 11: "execve", 15: "chmod",
+		23: "setuid", 46: "setgid", 63: "dup2", 70: "setreuid", 102: "socketcall", 125: "mprotect", 187: "sendfile",
+		192: "mmap2", 203: "setreuid32", 213: "setuid32", 214: "setgid32", 252: "exit_group", 295: "openat",
+		330: "dup3", 358: "execveat", 359: "socket", 361: "bind", 362: "connect", 363: "listen", 364: "accept4",
+	}
+
+	sctestSyscallsARM = map[uint64]string{
+		1: "exit", 2: "fork", 3: "read", 4: "write", 5: "open", 6: "close", 10: "unlink", 11: "execve", 15: "chmod",
+		23: "setuid", 46: "setgid", 63: "dup2", 70: "setreuid", 125: "mprotect", 187: "sendfile", 192: "mmap2",
+		203: "setreuid32", 213: "setuid32", 214: "setgid32", 248: "exit_group", 281: "socket", 282: "bind",
+		283: "connect", 284: "listen", 285: "accept", 322: "openat", 358: "dup3", 366: "accept4", 387: "execveat",
+	}
+
+	sctestSyscallsARM64 = map[uint64]string{
+		24: "dup3", 35: "unlinkat", 53: "fchmodat", 56: "openat", 57: "close", 63: "read", 64: "write",
+		71: "sendfile", 93: "exit", 94: "exit_group", 144: "setgid", 145: "setreuid", 146: "setuid", 198: "socket",
+		200: "bind", 201: "listen", 202: "accept", 203: "connect", 220: "clone", 221: "execve", 222: "mmap",
+		226: "mprotect", 242: "accept4", 281: "execveat",
+	}
+
+	// The calls multiplexed through socketcall on 32-bit x86, by the number in its first argument
+	sctestSocketcalls = map[uint64]string{1: "socket", 2: "bind", 3: "connect", 4: "listen", 5: "accept", 18: "accept4"}
+)
+
+// Registers from r0 or x0 up, ARM and ARM64 number them in order
+func sctestRegisters(first int, count int) []int {
+	regs := make([]int, count)
+
+	for n := range regs {
+		regs[n] = first + n
+	}
+
+	return regs
+}
+
+// The architectures !sctest can run, by the names users type
+var sctestArchs = map[string]sctestArch{
+	"x86": {unicorn.ARCH_X86, unicorn.MODE_32, 4, unicorn.X86_REG_EIP, unicorn.X86_REG_ESP, unicorn.X86_REG_EAX,
+		[]int{unicorn.X86_REG_EBX, unicorn.X86_REG_ECX, unicorn.X86_REG_EDX, unicorn.X86_REG_ESI, unicorn.X86_REG_EDI, unicorn.X86_REG_EBP},
+		unicorn.X86_REG_EAX, 0x80, sctestSyscallsX86, "x86"},
+	"x64": {unicorn.ARCH_X86, unicorn.MODE_64, 8, unicorn.X86_REG_RIP, unicorn.X86_REG_RSP, unicorn.X86_REG_RAX,
+		[]int{unicorn.X86_REG_RDI, unicorn.X86_REG_RSI, unicorn.X86_REG_RDX, unicorn.X86_REG_R10, unicorn.X86_REG_R8, unicorn.X86_REG_R9},
+		unicorn.X86_REG_RAX, -1, sctestSyscallsX64, "x64"},
+	"arm": {unicorn.ARCH_ARM, unicorn.MODE_ARM, 4, unicorn.ARM_REG_PC, unicorn.ARM_REG_SP, unicorn.ARM_REG_R7,
+		sctestRegisters(unicorn.ARM_REG_R0, 6), unicorn.ARM_REG_R0, 2, sctestSyscallsARM, ""},
+	"thumb": {unicorn.ARCH_ARM, unicorn.MODE_THUMB, 4, unicorn.ARM_REG_PC, unicorn.ARM_REG_SP, unicorn.ARM_REG_R7,
+		sctestRegisters(unicorn.ARM_REG_R0, 6), unicorn.ARM_REG_R0, 2, sctestSyscallsARM, ""},
+	"arm64": {unicorn.ARCH_ARM64, unicorn.MODE_ARM, 8, unicorn.ARM64_REG_PC, unicorn.ARM64_REG_SP, unicorn.ARM64_REG_X8,
+		sctestRegisters(unicorn.ARM64_REG_X0, 6), unicorn.ARM64_REG_X0, 2, sctestSyscallsARM64, "arm64"},
+}
+
+// Other names for the architectures
+var sctestArchAliases = map[string]string{"x86_64": "x64", "x86-64": "x64", "aarch64": "arm64"}
+
+// Architectures !sctest can run
+const sctestArchNames = "x86, x86_64/x64, arm, thumb, arm64/aarch64"
+
+// Socket families and types, to show socket() the way strace does
+var (
+	sctestFamilies    = map[uint64]string{1: "AF_UNIX", 2: "AF_INET", 10: "AF_INET6"}
+	sctestSocketTypes = map[uint64]string{1: "SOCK_STREAM", 2: "SOCK_DGRAM", 3: "SOCK_RAW"}
+)
+
+// The state of a shellcode run, built up by the system call hook
+type sctestRun struct {
+	mu   unicorn.Unicorn
+	arch sctestArch
+
+	// The system calls made and what they amount to for the verdict
+	calls   []sctestCall
+	actions StrList
+
+	// What each file descriptor the shellcode opened is, a path or "the socket"
+	fds    map[uint64]string
+	nextFd uint64
+
+	// The next address mmap gives out
+	mapped uint64
+
+	// Why emulation was stopped from the hook, empty if it ran until the end or an error
+	stopped bool
+	outcome string
+}
+
+// A system call the shellcode made, with its arguments as strace shows them and the result it was given. Returns is
+// unset for the calls that stopped the emulation, and via is set for calls made through socketcall.
+type sctestCall struct {
+	name, args string
+	result     int64
+	returns    bool
+	via        string
+}
+
+// Error numbers the emulated calls fail with, as strace names them
+var sctestErrnos = map[int64]string{12: "ENOMEM (Cannot allocate memory)", 38: "ENOSYS (Function not implemented)"}
+
+// Shows what a call returned, addresses in hex and errors by name
+func (c sctestCall) ret() string {
+	switch {
+	case !c.returns:
+		return "?"
+	case c.result < 0 && sctestErrnos[-c.result] != "":
+		return "-1 " + sctestErrnos[-c.result]
+	case c.result > 0 && strings.HasPrefix(c.name, "mmap"):
+		return "0x" + strconv.FormatInt(c.result, 16)
+	}
+
+	return strconv.FormatInt(c.result, 10)
+}
+
+// Shows the call a line of strace would
+func (c sctestCall) String() string {
+	text := c.name + "(" + c.args + ")"
+
+	if c.returns {
+		text += " = " + c.ret()
+	}
+
+	return text + c.via
+}
+
+// Reads a word of the shellcode's memory
+func (r *sctestRun) word(addr uint64) (uint64, bool) {
+	data, err := r.mu.MemRead(addr, uint64(r.arch.wordSize))
+
+	if err != nil {
+		return 0, false
+	}
+
+	if r.arch.wordSize == 4 {
+		return uint64(binary.LittleEndian.Uint32(data)), true
+	}
+
+	return binary.LittleEndian.Uint64(data), true
+}
+
+// Reads a NUL terminated string from the shellcode's memory, a byte at a time so one that ends just before
+// unmapped memory can still be read
+func (r *sctestRun) cString(addr uint64) (string, bool) {
+	var out []byte
+
+	for len(out) < 256 {
+		b, err := r.mu.MemRead(addr + uint64(len(out)), 1)
+
+		if err != nil {
+			return string(out), false
+		}
+
+		if b[0] == 0 {
+			return string(out), true
+		}
+
+		out = append(out, b[0])
+	}
+
+	return string(out), true
+}
+
+// Shows a string argument quoted, or its address if it can't be read
+func (r *sctestRun) stringArg(addr uint64) string {
+	if text, ok := r.cString(addr); ok {
+		return strconv.Quote(text)
+	}
+
+	return "0x" + strconv.FormatUint(addr, 16)
+}
+
+// Reads an argv style array of string pointers, up to the NULL at its end
+func (r *sctestRun) stringArray(addr uint64) []string {
+	var out []string
+
+	for addr != 0 && len(out) < 16 {
+		ptr, ok := r.word(addr + uint64(len(out) * r.arch.wordSize))
+
+		if !ok || ptr == 0 {
+			break
+		}
+
+		text, _ := r.cString(ptr)
+		out = append(out, text)
+	}
+
+	return out
+}
+
+// Shows a socket address as ip:port, [ip]:port or a unix socket's path
+func (r *sctestRun) sockaddr(addr uint64) string {
+	data, err := r.mu.MemRead(addr, 8)
+
+	if err != nil {
+		return "0x" + strconv.FormatUint(addr, 16)
+	}
+
+	port := strconv.Itoa(int(binary.BigEndian.Uint16(data[2:4])))
+
+	switch binary.LittleEndian.Uint16(data) {
+	case 1:
+		path, _ := r.cString(addr + 2)
+		return path
+	case 2:
+		return net.IP(data[4:8]).String() + ":" + port
+	case 10:
+		if ip, err := r.mu.MemRead(addr + 8, 16); err == nil {
+			return "[" + net.IP(ip).String() + "]:" + port
+		}
+	}
+
+	return "family " + strconv.Itoa(int(binary.LittleEndian.Uint16(data)))
+}
+
+// Gives a register value as the signed int it is in the architecture's word size, for file descriptors and errors
+func (r *sctestRun) signed(value uint64) int64 {
+	if r.arch.wordSize == 4 {
+		return int64(int32(value))
+	}
+
+	return int64(value)
+}
+
+// Describes a file descriptor by what the shellcode opened it as
+func (r *sctestRun) fdName(fd uint64) string {
+	switch {
+	case r.fds[fd] != "":
+		return r.fds[fd]
+	case fd == 0:
+		return "stdin"
+	case fd == 1:
+		return "stdout"
+	case fd == 2:
+		return "stderr"
+	}
+
+	return "fd " + strconv.FormatInt(r.signed(fd), 10)
+}
+
+// Adds to what the shellcode does, once each
+func (r *sctestRun) action(text string) {
+	if !r.actions.contains(text) {
+		r.actions = append(r.actions, text)
+	}
+}
+
+// Gives out a file descriptor for something the shellcode opened
+func (r *sctestRun) open(what string) uint64 {
+	fd := r.nextFd
+	r.nextFd++
+	r.fds[fd] = what
+
+	return fd
+}
+
+// Carries out a system call, as far as the shellcode can tell, and returns its result. Calls that replace or end
+// the process stop the emulation.
+func (r *sctestRun) syscall(name string, args []uint64) (string, int64) {
+	fd := strconv.FormatInt(r.signed(args[0]), 10)
+
+	// The 32-bit variants of the uid and gid calls, and mmap2, only differ in the size of their arguments
+	switch base := strings.TrimSuffix(name, "32"); base {
+	case "read":
+		if path := r.fds[args[0]]; path != "" && !strings.HasPrefix(path, "the ") {
+			r.action("reads " + path)
+		}
+
+		// Reading is always at the end of the file, there's nothing to give a stager
+		return "read(" + fd + ", 0x" + strconv.FormatUint(args[1], 16) + ", " + strconv.FormatUint(args[2], 10) + ")", 0
+
+	case "write":
+		length := args[2]
+
+		if length > 64 {
+			length = 64
+		}
+
+		data, _ := r.mu.MemRead(args[1], length)
+		text := string(data)
+
+		if args[0] == 1 || args[0] == 2 {
+			r.action("prints " + strconv.Quote(text))
+		} else {
+			r.action("writes to " + r.fdName(args[0]))
+		}
+
+		return "write(" + fd + ", " + strconv.Quote(text) + ", " + strconv.FormatUint(args[2], 10) + ")", int64(args[2])
+
+	case "open", "openat":
+		text := "open("
+
+		if base == "openat" {
+			text = "openat(" + strconv.FormatInt(r.signed(args[0]), 10) + ", "
+			args = args[1:]
+		}
+
+		path, _ := r.cString(args[0])
+		r.action("opens " + path)
+
+		return text + r.stringArg(args[0]) + ", 0x" + strconv.FormatUint(args[1], 16) + ")", int64(r.open(path))
+
+	case "close":
+		delete(r.fds, args[0])
+		return "close(" + fd + ")", 0
+
+	case "sendfile":
+		r.action("sends " + r.fdName(args[1]) + " to " + r.fdName(args[0]))
+		return "sendfile(" + fd + ", " + strconv.FormatInt(r.signed(args[1]), 10) + ", 0x" + strconv.FormatUint(args[2], 16) + ", " + strconv.FormatUint(args[3], 10) + ")", int64(args[3])
+
+	case "socket":
+		family, kind := sctestFamilies[args[0]], sctestSocketTypes[args[1] & 0xf]
+
+		if family == "" {
+			family = strconv.FormatUint(args[0], 10)
+		}
+
+		if kind == "" {
+			kind = strconv.FormatUint(args[1], 10)
+		}
+
+		return "socket(" + family + ", " + kind + ", " + strconv.FormatUint(args[2], 10) + ")", int64(r.open("the socket"))
+
+	case "connect":
+		addr := r.sockaddr(args[1])
+		r.action("connects to " + addr)
+		r.fds[args[0]] = "the socket"
+
+		return "connect(" + fd + ", {" + addr + "}, " + strconv.FormatUint(args[2], 10) + ")", 0
+
+	case "bind":
+		addr := r.sockaddr(args[1])
+		r.action("listens on " + addr)
+
+		return "bind(" + fd + ", {" + addr + "}, " + strconv.FormatUint(args[2], 10) + ")", 0
+
+	case "listen":
+		return "listen(" + fd + ", " + strconv.FormatUint(args[1], 10) + ")", 0
+
+	case "accept", "accept4":
+		r.action("accepts a connection")
+		return name + "(" + fd + ", 0x" + strconv.FormatUint(args[1], 16) + ", 0x" + strconv.FormatUint(args[2], 16) + ")", int64(r.open("the connection"))
+
+	case "dup2", "dup3":
+		if what := r.fds[args[0]]; what != "" {
+			r.action("redirects its standard streams to " + what)
+		}
+
+		return name + "(" + fd + ", " + strconv.FormatInt(r.signed(args[1]), 10) + ")", int64(args[1])
+
+	case "execve", "execveat":
+		text := "execve("
+
+		if base == "execveat" {
+			text = "execveat(" + strconv.FormatInt(r.signed(args[0]), 10) + ", "
+			args = args[1:]
+		}
+
+		path, _ := r.cString(args[0])
+		argv := r.stringArray(args[1])
+		quoted := make([]string, len(argv))
+
+		for n, arg := range argv {
+			quoted[n] = strconv.Quote(arg)
+		}
+
+		if len(argv) <= 1 {
+			r.action("runs " + path)
+		} else {
+			r.action("runs " + path + " with the arguments " + strings.Join(argv[1:], " "))
+		}
+
+		r.stopped = true
+		return text + r.stringArg(args[0]) + ", [" + strings.Join(quoted, ", ") + "], 0x" + strconv.FormatUint(args[2], 16) + ")", 0
+
+	case "exit", "exit_group":
+		r.stopped = true
+		r.outcome = "It exits with status " + strconv.FormatInt(r.signed(args[0]), 10) + "."
+
+		return name + "(" + fd + ")", 0
+
+	case "mmap", "mmap2":
+		size := (args[1] + 0xfff) &^ 0xfff
+		text := name + "(0x" + strconv.FormatUint(args[0], 16) + ", " + strconv.FormatUint(args[1], 10) + ", " + strconv.FormatUint(args[2], 10) + ")"
+
+		if size == 0 || r.mapped + size > sctestMmapAddr + sctestMmapSize || r.mu.MemMap(r.mapped, size) != nil {
+			return text, -12
+		}
+
+		r.mapped += size
+		return text, int64(r.mapped - size)
+
+	case "mprotect":
+		return "mprotect(0x" + strconv.FormatUint(args[0], 16) + ", " + strconv.FormatUint(args[1], 10) + ", " + strconv.FormatUint(args[2], 10) + ")", 0
+
+	case "setuid", "setgid":
+		r.action("calls " + name + "(" + fd + ")")
+		return name + "(" + fd + ")", 0
+
+	case "setreuid":
+		r.action("calls " + name + "(" + fd + ", " + strconv.FormatInt(r.signed(args[1]), 10) + ")")
+		return name + "(" + fd + ", " + strconv.FormatInt(r.signed(args[1]), 10) + ")", 0
+
+	case "chmod", "fchmodat":
+		text := name + "("
+
+		if base == "fchmodat" {
+			text += fd + ", "
+			args = args[1:]
+		}
+
+		path, _ := r.cString(args[0])
+		r.action("changes the mode of " + path + " to 0" + strconv.FormatUint(args[1], 8))
+
+		return text + r.stringArg(args[0]) + ", 0" + strconv.FormatUint(args[1], 8) + ")", 0
+
+	case "unlink", "unlinkat":
+		text := name + "("
+
+		if base == "unlinkat" {
+			text += fd + ", "
+			args = args[1:]
+		}
+
+		path, _ := r.cString(args[0])
+		r.action("deletes " + path)
+
+		return text + r.stringArg(args[0]) + ")", 0
+
+	case "fork", "clone":
+		// Carrying on as the child is what the payload after a fork usually is
+		r.action("forks")
+		return name + "()", 0
+	}
+
+	// Anything else fails with ENOSYS, so the shellcode can carry on if it doesn't check
+	return name + "(0x" + strconv.FormatUint(args[0], 16) + ", 0x" + strconv.FormatUint(args[1], 16) + ", 0x" + strconv.FormatUint(args[2], 16) + ")", -38
+}
+
+// Called on every system call instruction, reads the call from the registers, carries it out and sets its result
+func (r *sctestRun) hook(mu unicorn.Unicorn) {
+	number, _ := mu.RegRead(r.arch.number)
+	args := make([]uint64, len(r.arch.args))
+
+	for n, reg := range r.arch.args {
+		args[n], _ = mu.RegRead(reg)
+	}
+
+	name := r.arch.syscalls[number]
+	via := ""
+
+	// 32-bit x86 shellcode makes socket calls through socketcall, with the real arguments in an array
+	if name == "socketcall" && sctestSocketcalls[args[0]] != "" {
+		name, via = sctestSocketcalls[args[0]], " via socketcall"
+		array := args[1]
+
+		for n := range args {
+			args[n], _ = r.word(array + uint64(n * r.arch.wordSize))
+		}
+	}
+
+	if name == "" {
+		name = syscallName(syscallTables[r.arch.table], number)
+	}
+
+	text, result := r.syscall(name, args)
+	open := strings.Index(text, "(")
+
+	// The calls that stop the emulation don't return
+	r.calls = append(r.calls, sctestCall{text[:open], text[open + 1:len(text) - 1], result, !r.stopped, via})
+
+	_ = mu.RegWrite(r.arch.ret, uint64(result))
+
+	if !r.stopped && len(r.calls) >= sctestMaxCalls {
+		r.stopped = true
+		r.outcome = "It was stopped after " + strconv.Itoa(sctestMaxCalls) + " system calls."
+	}
+
+	if r.stopped {
+		_ = mu.Stop()
+	}
+}
+
+// Runs shellcode in the emulator with its stack set up, until it replaces or ends the process, crashes, runs off
+// its end, hits the limits or the context is cancelled
+func emulateShellcode(ctx context.Context, arch sctestArch, code []byte) (*sctestRun, error) {
+	mu, err := unicorn.NewUnicorn(arch.arch, arch.mode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer mu.Close()
+
+	r := &sctestRun{mu: mu, arch: arch, fds: map[uint64]string{}, nextFd: 3, mapped: sctestMmapAddr}
+
+	// The code is writable and has a page to spare, so self-decoding shellcode can write where it runs
+	size := uint64(len(code) + 0xfff) &^ 0xfff + 0x1000
+
+	if err := mu.MemMap(sctestCodeAddr, size); err != nil {
+		return nil, err
+	}
+
+	if err := mu.MemMap(sctestStackAddr, sctestStackSize); err != nil {
+		return nil, err
+	}
+
+	if err := mu.MemWrite(sctestCodeAddr, code); err != nil {
+		return nil, err
+	}
+
+	// The stack pointer is left a page below the top, shellcode sometimes reads above it
+	if err := mu.RegWrite(arch.sp, sctestStackAddr + sctestStackSize - 0x1000); err != nil {
+		return nil, err
+	}
+
+	if arch.interrupt < 0 {
+		_, err = mu.HookAdd(unicorn.HOOK_INSN, func(mu unicorn.Unicorn) {
+			r.hook(mu)
+		}, 1, 0, unicorn.X86_INS_SYSCALL)
+	} else {
+		_, err = mu.HookAdd(unicorn.HOOK_INTR, func(mu unicorn.Unicorn, intno uint32) {
+			if int(intno) == arch.interrupt {
+				r.hook(mu)
+				return
+			}
+
+			r.stopped = true
+			r.outcome = "It raised interrupt " + strconv.Itoa(int(intno)) + ", which isn't a system call."
+			_ = mu.Stop()
+		}, 1, 0)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Thumb code is started at an odd address, like a bx into it
+	begin, end := uint64(sctestCodeAddr), uint64(sctestCodeAddr + len(code))
+
+	if arch.mode == unicorn.MODE_THUMB {
+		begin |= 1
+	}
+
+	// A cancelled job stops the emulator from outside, it can't be told while it runs. The watcher is waited for, so
+	// it can't stop the engine after it's closed.
+	finished, watched := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(watched)
+
+		select {
+		case <-ctx.Done():
+			_ = mu.Stop()
+		case <-finished:
+		}
+	}()
+
+	err = mu.StartWithOptions(begin, end, &unicorn.UcOptions{Timeout: sctestTimeout, Count: sctestMaxInstructions})
+	close(finished)
+	<-watched
+	pc, _ := mu.RegRead(arch.pc)
+
+	switch {
+	case ctx.Err() != nil:
+		r.outcome = "It was cancelled."
+	case r.stopped:
+	case err != nil:
+		r.outcome = fmt.Sprintf("It crashed at 0x%x, %s.", pc, err.Error())
+	case pc &^ 1 == end:
+		r.outcome = "It ran off the end of the shellcode."
+	default:
+		r.outcome = "It was stopped after " + strconv.Itoa(sctestMaxInstructions) + " instructions or " + strconv.Itoa(sctestTimeout / 1000000) + " seconds, it may be stuck in a loop."
+	}
+
+	return r, nil
+}
+
+// Reads the architecture and shellcode from a command and runs it, replying with what went wrong if it couldn't.
+// The architecture is returned by the name it's run as.
+func sctestCommand(s Responder, m *discordgo.MessageCreate, args []string) (*sctestRun, string, bool) {
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+
+	if alias, ok := sctestArchAliases[asmArch]; ok {
+		asmArch = alias
+	}
+
+	arch, ok := sctestArchs[asmArch]
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, shellcode can only be tested on " + sctestArchNames + ".")
+		return nil, "", false
+	}
+
+	code, err := parseOpcodes(strings.Join(rest, ""))
+
+	if err != nil || len(code) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(errInvalidOpcodes, supportedArchsCapstone))
+		return nil, "", false
+	}
+
+	if !checkLimit(s, m.ChannelID, "opcode bytes", len(code), MaxOpcodeBytes) {
+		return nil, "", false
+	}
+
+	reportProgress(s, "emulating " + strconv.Itoa(len(code)) + " bytes")
+	r, err := emulateShellcode(jobContext(s), arch, code)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, the emulator couldn't be set up, " + err.Error() + ".")
+		return nil, "", false
+	}
+
+	return r, asmArch, true
+}
+
+// Runs shellcode under emulation and reports what it tried to do
+func cmdSctest(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	r, asmArch, ok := sctestCommand(s, m, args)
+
+	if !ok {
+		return
+	}
+
+	verdict := "Verdict: it doesn't do anything visible."
+
+	if len(r.actions) > 0 {
+		verdict = "Verdict: it " + joinWords(r.actions) + "."
+	}
+
+	if r.outcome != "" {
+		verdict += " " + r.outcome
+	}
+
+	calls := "(no system calls)"
+
+	if len(r.calls) > 0 {
+		lines := make([]string, len(r.calls))
+
+		for n, call := range r.calls {
+			lines[n] = call.String()
+		}
+
+		calls = strings.Join(lines, "\n")
+	}
+
+	content := verdict + "\nSystem calls made by the shellcode, run as " + asmArch + ":"
+	sendListing(s, m.ChannelID, content, "sctest.txt", calls + "\n")
+}
+
+// Lays out the system calls of a run as a table, in the order they were made
+func sctestTrace(calls []sctestCall) string {
+	nameWidth, argsWidth := len("CALL"), len("ARGUMENTS")
+
+	for _, call := range calls {
+		if len(call.name + call.via) > nameWidth {
+			nameWidth = len(call.name + call.via)
+		}
+
+		if len(call.args) > argsWidth {
+			argsWidth = len(call.args)
+		}
+	}
+
+	out := padRight("#", " ", 5) + padRight("CALL", " ", nameWidth + 2) + padRight("ARGUMENTS", " ", argsWidth + 2) + "RETURN\n"
+
+	for n, call := range calls {
+		out += padRight(strconv.Itoa(n + 1), " ", 5) + padRight(call.name + call.via, " ", nameWidth + 2) + padRight(call.args, " ", argsWidth + 2) + call.ret() + "\n"
+	}
+
+	return out
+}
+
+// Runs shellcode under emulation and lists its system calls in order
+func cmdStrace(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	r, asmArch, ok := sctestCommand(s, m, args)
+
+	if !ok {
+		return
+	}
+
+	if len(r.calls) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "The shellcode didn't make any system calls, run as " + asmArch + ". " + r.outcome)
+		return
+	}
+
+	content := strconv.Itoa(len(r.calls)) + " system calls made by the shellcode, run as " + asmArch + "."
+
+	if r.outcome != "" {
+		content += " " + r.outcome
+	}
+
+	sendListing(s, m.ChannelID, content, "strace.txt", sctestTrace(r.calls))
+}
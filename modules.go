@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Optional functionality is packaged as a Module. Each module lives in its own file guarded by a build tag, and
+// registers itself from init(), so heavy integrations can be compiled in or out without touching the dispatcher.
+type Module interface {
+	// Unique name of the module, used in config.ini and log output
+	Name() string
+
+	// Called once at startup, a module that fails to initialize won't have its commands registered
+	Init() error
+
+	// Commands provided by the module
+	Commands() []Command
+
+	// Lines to add to the !commands listing
+	Help() []string
+}
+
+// Stores every module that was compiled in, in registration order
+var modules []Module
+
+// Stores the modules that initialized successfully and had their commands registered
+var loadedModules []Module
+
+// Registers a module, this should be called from the module's init()
+func registerModule(mod Module) {
+	modules = append(modules, mod)
+}
+
+// Initializes compiled in modules that aren't disabled in config.ini and adds their commands to the command map
+func loadModules() {
+	disabled := StrList(strings.Fields(strings.Replace(getConfigPropertyAsStr("modules", "disabled"), ",", " ", -1)))
+	loadedModules = nil
+
+	for _, mod := range modules {
+		if disabled.contains(mod.Name()) {
+			fmt.Println("[INFO] Module '" + mod.Name() + "' is disabled.")
+			continue
+		}
+
+		if err := mod.Init(); err != nil {
+			fmt.Println("[ERROR] Failed to initialize module '" + mod.Name() + "', " + err.Error())
+			continue
+		}
+
+		for _, cmd := range mod.Commands() {
+			commandMap[cmd.name] = cmd
+		}
+
+		loadedModules = append(loadedModules, mod)
+		fmt.Println("[INFO] Loaded module '" + mod.Name() + "'.")
+	}
+}
@@ -0,0 +1,125 @@
+package asm
+
+import (
+	"github.com/bnagy/gapstone"
+	"github.com/keystone-engine/keystone/bindings/go/keystone"
+)
+
+// Architectures supported by Assemble and Disassemble, formatted for display. PowerPC is named by word size and
+// endianness, big endian when it isn't given, as the targets are; Keystone can't assemble 32-bit little endian
+// PowerPC or MIPS32 release 6, so those only disassemble.
+const (
+	AssembleArchs    = "x86, x86_16, x86_64/x64, arm, thumb, arm64/aarch64, ppc/ppc32/ppc32be, ppc64/ppc64be, ppc64le, mips/mips32, mipsel, mips64, mips64el"
+	DisassembleArchs = "x86, x86_64/x64, arm, thumb, arm64/aarch64, ppc/ppc32/ppc32be, ppc32le, ppc64/ppc64be, ppc64le, mips/mips32, mipsel, mips64, mips64el, mipsr6, avr, tricore, tricore13, riscv32/rv32gc, rv32g, riscv64/rv64gc/riscv, rv64g"
+)
+
+// gapstone predates Capstone 5's RISC-V and TriCore support, so these are the IDs Capstone 5 gives them. They only
+// work with gapstone built against Capstone 5 or later, older ones fail with CS_ERR_ARCH.
+const (
+	csArchRISCV      = 15
+	csModeRISCV32    = 1 << 0
+	csModeRISCV64    = 1 << 1
+	csModeRISCVC     = 1 << 2
+	csArchTriCore    = 17
+	csModeTriCore130 = 1 << 3
+	csModeTriCore162 = 1 << 7
+)
+
+// Returns the proper keystone architecture based on the user input string
+func parseArchitectureKeystone(arch string) (keystone.Architecture, keystone.Mode, bool) {
+	switch arch {
+	case "x86_16":
+		return keystone.ARCH_X86, keystone.MODE_16, true
+	case "x86":
+		return keystone.ARCH_X86, keystone.MODE_32, true
+	case "x64", "x86_64", "x86-64":
+		return keystone.ARCH_X86, keystone.MODE_64, true
+	case "arm":
+		return keystone.ARCH_ARM, keystone.MODE_ARM, true
+	case "thumb":
+		return keystone.ARCH_ARM, keystone.MODE_THUMB, true
+	case "aarch64", "arm64":
+		return keystone.ARCH_ARM64, keystone.MODE_LITTLE_ENDIAN, true
+	case "ppc", "ppc32", "ppc32be":
+		return keystone.ARCH_PPC, keystone.MODE_PPC32 | keystone.MODE_BIG_ENDIAN, true
+	case "ppc64", "ppc64be":
+		return keystone.ARCH_PPC, keystone.MODE_PPC64 | keystone.MODE_BIG_ENDIAN, true
+	case "ppc64le":
+		return keystone.ARCH_PPC, keystone.MODE_PPC64 | keystone.MODE_LITTLE_ENDIAN, true
+	case "mips", "mips32":
+		return keystone.ARCH_MIPS, keystone.MODE_MIPS32 | keystone.MODE_BIG_ENDIAN, true
+	case "mipsel":
+		return keystone.ARCH_MIPS, keystone.MODE_MIPS32 | keystone.MODE_LITTLE_ENDIAN, true
+	case "mips64":
+		return keystone.ARCH_MIPS, keystone.MODE_MIPS64 | keystone.MODE_BIG_ENDIAN, true
+	case "mips64el":
+		return keystone.ARCH_MIPS, keystone.MODE_MIPS64 | keystone.MODE_LITTLE_ENDIAN, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// Returns the proper capstone architecture based on the user input string
+func parseArchitectureCapstone(arch string) (int, int, bool) {
+	switch arch {
+	case "x86_16":
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_16, true
+	case "x86":
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_32, true
+	case "x64", "x86_64", "x86-64":
+		return gapstone.CS_ARCH_X86, gapstone.CS_MODE_64, true
+	case "arm":
+		return gapstone.CS_ARCH_ARM, gapstone.CS_MODE_ARM, true
+	case "thumb":
+		return gapstone.CS_ARCH_ARM, gapstone.CS_MODE_THUMB, true
+	case "aarch64", "arm64":
+		return gapstone.CS_ARCH_ARM64, gapstone.CS_MODE_ARM, true
+	case "ppc", "ppc32", "ppc32be":
+		return gapstone.CS_ARCH_PPC, gapstone.CS_MODE_32 | gapstone.CS_MODE_BIG_ENDIAN, true
+	case "ppc32le":
+		return gapstone.CS_ARCH_PPC, gapstone.CS_MODE_32 | gapstone.CS_MODE_LITTLE_ENDIAN, true
+	case "ppc64", "ppc64be":
+		return gapstone.CS_ARCH_PPC, gapstone.CS_MODE_64 | gapstone.CS_MODE_BIG_ENDIAN, true
+	case "ppc64le":
+		return gapstone.CS_ARCH_PPC, gapstone.CS_MODE_64 | gapstone.CS_MODE_LITTLE_ENDIAN, true
+	case "mips", "mips32":
+		return gapstone.CS_ARCH_MIPS, gapstone.CS_MODE_MIPS32 | gapstone.CS_MODE_BIG_ENDIAN, true
+	case "mipsel":
+		return gapstone.CS_ARCH_MIPS, gapstone.CS_MODE_MIPS32 | gapstone.CS_MODE_LITTLE_ENDIAN, true
+	case "mipsr6":
+		return gapstone.CS_ARCH_MIPS, gapstone.CS_MODE_MIPS32R6 | gapstone.CS_MODE_BIG_ENDIAN, true
+	case "mips64":
+		return gapstone.CS_ARCH_MIPS, gapstone.CS_MODE_MIPS64 | gapstone.CS_MODE_BIG_ENDIAN, true
+	case "mips64el":
+		return gapstone.CS_ARCH_MIPS, gapstone.CS_MODE_MIPS64 | gapstone.CS_MODE_LITTLE_ENDIAN, true
+	case "tricore":
+		// TC1.6.2, the AURIX cores in current ECUs, it decodes the older cores' code too
+		return csArchTriCore, csModeTriCore162, true
+	case "tricore13":
+		return csArchTriCore, csModeTriCore130, true
+	// The ISA strings say whether the C extension's 2-byte compressed instructions are decoded, without it they're
+	// rejected like any other invalid instruction
+	case "riscv32", "rv32gc":
+		return csArchRISCV, csModeRISCV32 | csModeRISCVC, true
+	case "rv32g":
+		return csArchRISCV, csModeRISCV32, true
+	case "riscv64", "rv64gc", "riscv":
+		return csArchRISCV, csModeRISCV64 | csModeRISCVC, true
+	case "rv64g":
+		return csArchRISCV, csModeRISCV64, true
+	default:
+		return -1, -1, false
+	}
+}
+
+// Checks if Assemble supports the given architecture
+func CanAssemble(arch string) bool {
+	_, _, ok := parseArchitectureKeystone(arch)
+	return ok
+}
+
+// Checks if Disassemble supports the given architecture
+func CanDisassemble(arch string) bool {
+	_, _, ok := parseArchitectureCapstone(arch)
+	return ok || arch == "avr"
+}
@@ -0,0 +1,319 @@
+// Package asm wraps the Keystone assembler and Capstone disassembler engines behind a small API that takes
+// architecture names as users type them (x86, x64, arm, thumb, ...). It's the core of REBot's assemble and
+// disassemble commands, and has no dependency on Discord.
+package asm
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/bnagy/gapstone"
+	"github.com/keystone-engine/keystone/bindings/go/keystone"
+)
+
+// Errors returned by Assemble and Disassemble. Errors from the engines themselves are returned as an *EngineError
+// wrapping one of these, with the engine's explanation.
+var (
+	ErrArchNotSupported = errors.New("architecture not supported")
+	ErrKeystoneEngine   = errors.New("keystone engine is not working")
+	ErrKeystoneOption   = errors.New("failed to set keystone option")
+	ErrAssemble         = errors.New("could not assemble the given assembly")
+	ErrCapstoneEngine   = errors.New("capstone engine is not working")
+	ErrCapstoneOption   = errors.New("failed to set gapstone option")
+	ErrDisassemble      = errors.New("could not disassemble the given opcodes")
+)
+
+// A single instruction. Instructions from Assemble have Source set, ones from Disassemble have Mnemonic and OpStr.
+// Disassembling WithDetail also fills in the instruction's groups and the registers it reads and writes implicitly.
+type Insn struct {
+	Address  uint64
+	Bytes    []byte
+	Source   string
+	Mnemonic string
+	OpStr    string
+
+	// Set for ARM instructions assembled in Thumb state, by the thumb architecture or a .thumb directive
+	Thumb bool
+
+	// Capstone's groups for the instruction, i.e. "call", "jump", "ret" or "int"
+	Groups []string
+
+	// Registers the instruction uses without naming them, i.e. rsp for push or the flags for cmp
+	ImplicitReads  []string
+	ImplicitWrites []string
+}
+
+// Configures Assemble and Disassemble
+type Option func(*options)
+
+type options struct {
+	syntax string
+	base   uint64
+	detail bool
+}
+
+// Selects the x86 syntax, "intel" (the default) or "att". Other architectures ignore it.
+func WithSyntax(syntax string) Option {
+	return func(o *options) {
+		o.syntax = syntax
+	}
+}
+
+// Sets the address of the first instruction when assembling, so relative branches are encoded correctly
+func WithBase(base uint64) Option {
+	return func(o *options) {
+		o.base = base
+	}
+}
+
+// Has Disassemble fill in the instructions' groups and implicit registers, it's slower so it's off by default
+func WithDetail() Option {
+	return func(o *options) {
+		o.detail = true
+	}
+}
+
+// Parts of a listing line that aren't the instruction: objdump's address and opcode columns, the symbol headers
+// between its functions, and comments after a ';' or a '#' on its own (not an ARM immediate like #1)
+var (
+	objdumpPrefixRegexp = regexp.MustCompile(`^\s*[0-9a-fA-F]+:\s+(?:[0-9a-fA-F]{2,8} )+\s+`)
+	objdumpSymbolRegexp = regexp.MustCompile(`^[0-9a-fA-F]+ <.*>:$`)
+	commentRegexp       = regexp.MustCompile(`;.*$|(?:^|\s)#(?:\s.*)?$`)
+)
+
+// Recognises the directives that switch ARM assembly between ARM and Thumb state, returning whether the code after
+// it is Thumb
+func armModeDirective(i string) (bool, bool) {
+	switch strings.Join(strings.Fields(strings.ToLower(i)), " ") {
+	case ".thumb", ".code 16":
+		return true, true
+	case ".arm", ".code 32":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// Splits source into individual instructions. On one line ';' is the termination character in assembly. Source
+// over several lines, like a listing copied from an editor or objdump, has an instruction on each line, and anything
+// after a ';' or '#' is a comment.
+func SplitInstructions(src string) []string {
+	var ins []string
+
+	if src = strings.TrimSpace(src); !strings.Contains(src, "\n") {
+		for _, i := range strings.Split(objdumpPrefixRegexp.ReplaceAllString(src, ""), ";") {
+			if i = strings.TrimSpace(i); i != "" {
+				ins = append(ins, strings.Replace(i, "\t", " ", -1))
+			}
+		}
+
+		return ins
+	}
+
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(objdumpPrefixRegexp.ReplaceAllString(line, ""))
+
+		if objdumpSymbolRegexp.MatchString(line) {
+			continue
+		}
+
+		line = strings.TrimSpace(commentRegexp.ReplaceAllString(line, ""))
+
+		if line != "" {
+			ins = append(ins, strings.Replace(line, "\t", " ", -1))
+		}
+	}
+
+	return ins
+}
+
+// Assembles the given instructions into opcodes via the given architecture, separated by ';' or one per line (see
+// SplitInstructions). ARM and Thumb source can switch between the two with .arm and .thumb (or .code 32 and
+// .code 16), for interworking code. When an instruction fails, the instructions before it are returned along with an *EngineError naming the failed one.
+func Assemble(arch string, src string, opts ...Option) ([]Insn, error) {
+	var out []Insn
+	var o options
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ksArch, ksMode, ok := parseArchitectureKeystone(arch)
+
+	if !ok {
+		return nil, ErrArchNotSupported
+	}
+
+	ks, err := keystone.New(ksArch, ksMode)
+
+	if err != nil {
+		return nil, engineError(ErrKeystoneEngine, err, keystoneReasons)
+	}
+
+	defer ks.Close()
+
+	// The engine for the other ARM state, made when a directive first switches to it
+	var other *keystone.Keystone
+	thumb := ksArch == keystone.ARCH_ARM && ksMode == keystone.MODE_THUMB
+	initialThumb := thumb
+
+	defer func() {
+		if other != nil {
+			other.Close()
+		}
+	}()
+
+	// Use intel syntax for x86 because AT&T syntax is ugly, unless the caller asked for it
+	if ksArch == keystone.ARCH_X86 {
+		syntax := keystone.OPT_SYNTAX_INTEL
+
+		if o.syntax == "att" {
+			syntax = keystone.OPT_SYNTAX_ATT
+		}
+
+		if err := ks.Option(keystone.OPT_SYNTAX, syntax); err != nil {
+			return nil, engineError(ErrKeystoneOption, err, keystoneReasons)
+		}
+	}
+
+	address := o.base
+
+	// Assemble each instruction individually so the caller can show them side by side with their opcodes
+	for n, i := range SplitInstructions(src) {
+		engine := ks
+
+		if ksArch == keystone.ARCH_ARM {
+			if switched, ok := armModeDirective(i); ok {
+				thumb = switched
+				continue
+			}
+
+			if thumb != initialThumb {
+				if other == nil {
+					mode := keystone.MODE_ARM
+
+					if thumb {
+						mode = keystone.MODE_THUMB
+					}
+
+					if other, err = keystone.New(ksArch, mode); err != nil {
+						other = nil
+						return out, engineError(ErrKeystoneEngine, err, keystoneReasons)
+					}
+				}
+
+				engine = other
+			}
+		}
+
+		ops, _, ok := engine.Assemble(i, address)
+
+		if !ok {
+			err := engineError(ErrAssemble, engine.LastError(), keystoneReasons)
+			err.Instruction = i
+			err.Index = n
+
+			// Give back what did assemble, so the caller can show how far it got
+			return out, err
+		}
+
+		if len(ops) > 0 {
+			out = append(out, Insn{
+				Address: address,
+				Bytes:   ops,
+				Source:  i,
+				Thumb:   thumb,
+			})
+		}
+
+		address += uint64(len(ops))
+	}
+
+	return out, nil
+}
+
+// Disassembles the given opcodes into instructions via the given architecture, starting at the base address.
+// Capstone stops at the first invalid instruction, so the instructions may cover less than all of the code. AVR,
+// which Capstone doesn't have, is decoded by this package and stops the same way.
+func Disassemble(arch string, code []byte, base uint64, opts ...Option) ([]Insn, error) {
+	var out []Insn
+	var o options
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if arch == "avr" {
+		return disassembleAVR(code, base, o), nil
+	}
+
+	csArch, csMode, ok := parseArchitectureCapstone(arch)
+
+	if !ok {
+		return nil, ErrArchNotSupported
+	}
+
+	gs, err := gapstone.New(csArch, uint(csMode))
+
+	if err != nil {
+		return nil, engineError(ErrCapstoneEngine, err, capstoneReasons)
+	}
+
+	defer gs.Close()
+
+	// Use intel syntax for x86 because AT&T syntax is ugly, unless the caller asked for it
+	if csArch == gapstone.CS_ARCH_X86 {
+		syntax := uint(gapstone.CS_OPT_SYNTAX_INTEL)
+
+		if o.syntax == "att" {
+			syntax = gapstone.CS_OPT_SYNTAX_ATT
+		}
+
+		if err := gs.SetOption(gapstone.CS_OPT_SYNTAX, syntax); err != nil {
+			return nil, engineError(ErrCapstoneOption, err, capstoneReasons)
+		}
+	}
+
+	if o.detail {
+		if err := gs.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON); err != nil {
+			return nil, engineError(ErrCapstoneOption, err, capstoneReasons)
+		}
+	}
+
+	ins, err := gs.Disasm(code, base, 0)
+
+	if err != nil {
+		return nil, engineError(ErrDisassemble, err, capstoneReasons)
+	}
+
+	// Capstone gives registers and groups as IDs, the names are what callers can do anything with
+	names := func(ids []uint, name func(uint) string) []string {
+		var out []string
+
+		for _, id := range ids {
+			out = append(out, name(id))
+		}
+
+		return out
+	}
+
+	for _, i := range ins {
+		insn := Insn{
+			Address:  uint64(i.Address),
+			Bytes:    i.Bytes,
+			Mnemonic: i.Mnemonic,
+			OpStr:    i.OpStr,
+		}
+
+		if o.detail {
+			insn.Groups = names(i.Groups, gs.GroupName)
+			insn.ImplicitReads = names(i.RegistersRead, gs.RegName)
+			insn.ImplicitWrites = names(i.RegistersWritten, gs.RegName)
+		}
+
+		out = append(out, insn)
+	}
+
+	return out, nil
+}
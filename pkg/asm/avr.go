@@ -0,0 +1,272 @@
+package asm
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Capstone has no AVR support, so AVR is decoded here. Instructions are 16-bit little endian words, lds, sts, jmp
+// and call take a second word.
+
+// Instructions with two registers anywhere in r0-r31, 0000 01xx to 0010 11xx in their top bits
+var avrRegisterOps = []string{"cpc", "sbc", "add", "cpse", "cp", "sub", "adc", "and", "eor", "or", "mov"}
+
+// Instructions with a register in r16-r31 and an 8-bit immediate, 0011 to 0111 in their top bits
+var avrImmediateOps = []string{"cpi", "sbci", "subi", "ori", "andi"}
+
+// Instructions with one register, 1001 010d dddd xxxx by the low bits
+var avrSingleOps = map[uint16]string{0x0: "com", 0x1: "neg", 0x2: "swap", 0x3: "inc", 0x5: "asr", 0x6: "lsr", 0x7: "ror", 0xa: "dec"}
+
+// Loads and stores of 1001 00sd dddd xxxx by the low bits, the pointer they go through and pop and push
+var (
+	avrLoads  = map[uint16]string{0x1: "ld %s, Z+", 0x2: "ld %s, -Z", 0x4: "lpm %s, Z", 0x5: "lpm %s, Z+", 0x6: "elpm %s, Z", 0x7: "elpm %s, Z+", 0x9: "ld %s, Y+", 0xa: "ld %s, -Y", 0xc: "ld %s, X", 0xd: "ld %s, X+", 0xe: "ld %s, -X", 0xf: "pop %s"}
+	avrStores = map[uint16]string{0x1: "st Z+, %s", 0x2: "st -Z, %s", 0x4: "xch Z, %s", 0x5: "las Z, %s", 0x6: "lac Z, %s", 0x7: "lat Z, %s", 0x9: "st Y+, %s", 0xa: "st -Y, %s", 0xc: "st X, %s", 0xd: "st X+, %s", 0xe: "st -X, %s", 0xf: "push %s"}
+)
+
+// Instructions without operands
+var avrFixed = map[uint16]string{
+	0x0000: "nop", 0x9508: "ret", 0x9518: "reti", 0x9588: "sleep", 0x9598: "break", 0x95a8: "wdr", 0x95c8: "lpm",
+	0x95d8: "elpm", 0x95e8: "spm", 0x95f8: "spm Z+", 0x9409: "ijmp", 0x9419: "eijmp", 0x9509: "icall", 0x9519: "eicall",
+}
+
+// Flag instructions by SREG bit, bset and bclr are written as these
+var (
+	avrSetFlags   = []string{"sec", "sez", "sen", "sev", "ses", "seh", "set", "sei"}
+	avrClearFlags = []string{"clc", "clz", "cln", "clv", "cls", "clh", "clt", "cli"}
+)
+
+// Branches by SREG bit, brbs and brbc are written as these
+var (
+	avrBranchIfSet   = []string{"brcs", "breq", "brmi", "brvs", "brlt", "brhs", "brts", "brie"}
+	avrBranchIfClear = []string{"brcc", "brne", "brpl", "brvc", "brge", "brhc", "brtc", "brid"}
+)
+
+// Bit instructions on I/O registers, 1001 10xx by those bits
+var avrIOBitOps = []string{"cbi", "sbic", "sbi", "sbis"}
+
+// Bit instructions on registers, 1111 1xxd by those bits
+var avrRegisterBitOps = []string{"bld", "bst", "sbrc", "sbrs"}
+
+// Names a register
+func avrRegister(n uint16) string {
+	return fmt.Sprintf("r%d", n)
+}
+
+// Sign extends the low bits of a value
+func avrSigned(value uint16, bits uint) int64 {
+	return int64(int16(value << (16 - bits)) >> (16 - bits))
+}
+
+// Decodes one AVR instruction at the address. Returns its length in bytes, its mnemonic and operands, and the group
+// it's in for WithDetail, or a length of 0 if it isn't valid.
+func decodeAVR(code []byte, address uint64) (int, string, string, string) {
+	if len(code) < 2 {
+		return 0, "", "", ""
+	}
+
+	w := binary.LittleEndian.Uint16(code)
+	d := w >> 4 & 0x1f
+	r := w & 0xf | w >> 5 & 0x10
+
+	// A relative branch target, k words from the next instruction
+	relative := func(k int64) string {
+		return fmt.Sprintf("0x%x", int64(address) + 2 + 2 * k)
+	}
+
+	// The second word of a 32-bit instruction
+	second := func() (uint16, bool) {
+		if len(code) < 4 {
+			return 0, false
+		}
+
+		return binary.LittleEndian.Uint16(code[2:]), true
+	}
+
+	if text, ok := avrFixed[w]; ok {
+		group := ""
+
+		switch text {
+		case "ret", "reti":
+			group = "ret"
+		case "ijmp", "eijmp":
+			group = "jump"
+		case "icall", "eicall":
+			group = "call"
+		}
+
+		mnemonic, operands := splitAVR(text)
+		return 2, mnemonic, operands, group
+	}
+
+	switch {
+	case w & 0xff00 == 0x0100:
+		return 2, "movw", avrRegister(w >> 4 & 0xf * 2) + ", " + avrRegister(w & 0xf * 2), ""
+	case w & 0xff00 == 0x0200:
+		return 2, "muls", avrRegister(16 + w >> 4 & 0xf) + ", " + avrRegister(16 + w & 0xf), ""
+	case w & 0xff00 == 0x0300:
+		mnemonic := []string{"mulsu", "fmul", "fmuls", "fmulsu"}[w >> 6 & 2 | w >> 3 & 1]
+		return 2, mnemonic, avrRegister(16 + w >> 4 & 7) + ", " + avrRegister(16 + w & 7), ""
+	case w >> 10 >= 0x1 && w >> 10 <= 0xb:
+		return 2, avrRegisterOps[w >> 10 - 1], avrRegister(d) + ", " + avrRegister(r), ""
+	case w >> 12 >= 0x3 && w >> 12 <= 0x7:
+		return 2, avrImmediateOps[w >> 12 - 3], fmt.Sprintf("%s, 0x%x", avrRegister(16 + w >> 4 & 0xf), w >> 4 & 0xf0 | w & 0xf), ""
+	case w & 0xd000 == 0x8000:
+		// ldd and std through Y or Z with a displacement, ld and st when it's 0
+		q := w >> 8 & 0x20 | w >> 7 & 0x18 | w & 7
+		pointer := "Z"
+
+		if w & 8 != 0 {
+			pointer = "Y"
+		}
+
+		if q != 0 {
+			pointer += fmt.Sprintf("+%d", q)
+		}
+
+		switch {
+		case w & 0x200 == 0 && q == 0:
+			return 2, "ld", avrRegister(d) + ", " + pointer, ""
+		case w & 0x200 == 0:
+			return 2, "ldd", avrRegister(d) + ", " + pointer, ""
+		case q == 0:
+			return 2, "st", pointer + ", " + avrRegister(d), ""
+		default:
+			return 2, "std", pointer + ", " + avrRegister(d), ""
+		}
+	case w & 0xfe0f == 0x9000:
+		k, ok := second()
+
+		if !ok {
+			return 0, "", "", ""
+		}
+
+		return 4, "lds", fmt.Sprintf("%s, 0x%x", avrRegister(d), k), ""
+	case w & 0xfe0f == 0x9200:
+		k, ok := second()
+
+		if !ok {
+			return 0, "", "", ""
+		}
+
+		return 4, "sts", fmt.Sprintf("0x%x, %s", k, avrRegister(d)), ""
+	case w & 0xfe00 == 0x9000:
+		if text, ok := avrLoads[w & 0xf]; ok {
+			mnemonic, operands := splitAVR(fmt.Sprintf(text, avrRegister(d)))
+			return 2, mnemonic, operands, ""
+		}
+	case w & 0xfe00 == 0x9200:
+		if text, ok := avrStores[w & 0xf]; ok {
+			mnemonic, operands := splitAVR(fmt.Sprintf(text, avrRegister(d)))
+			return 2, mnemonic, operands, ""
+		}
+	case w & 0xfe0c == 0x940c:
+		// jmp and call take a 22-bit word address, split between the words
+		k, ok := second()
+
+		if !ok {
+			return 0, "", "", ""
+		}
+
+		target := fmt.Sprintf("0x%x", (uint64(w >> 3 & 0x3e | w & 1) << 16 | uint64(k)) * 2)
+
+		if w & 2 == 0 {
+			return 4, "jmp", target, "jump"
+		}
+
+		return 4, "call", target, "call"
+	case w & 0xfe00 == 0x9400 && w & 0xf != 0x8 && w & 0xf != 0x9 && w & 0xf != 0xb:
+		if mnemonic, ok := avrSingleOps[w & 0xf]; ok {
+			return 2, mnemonic, avrRegister(d), ""
+		}
+	case w & 0xff8f == 0x9408:
+		return 2, avrSetFlags[w >> 4 & 7], "", ""
+	case w & 0xff8f == 0x9488:
+		return 2, avrClearFlags[w >> 4 & 7], "", ""
+	case w & 0xff0f == 0x940b:
+		return 2, "des", fmt.Sprintf("0x%x", w >> 4 & 0xf), ""
+	case w & 0xfe00 == 0x9600:
+		mnemonic := "adiw"
+
+		if w & 0x100 != 0 {
+			mnemonic = "sbiw"
+		}
+
+		return 2, mnemonic, fmt.Sprintf("%s, 0x%x", avrRegister(24 + w >> 4 & 3 * 2), w >> 2 & 0x30 | w & 0xf), ""
+	case w & 0xfc00 == 0x9800:
+		return 2, avrIOBitOps[w >> 8 & 3], fmt.Sprintf("0x%x, %d", w >> 3 & 0x1f, w & 7), ""
+	case w & 0xfc00 == 0x9c00:
+		return 2, "mul", avrRegister(d) + ", " + avrRegister(r), ""
+	case w & 0xf000 == 0xb000:
+		port := fmt.Sprintf("0x%x", w >> 5 & 0x30 | w & 0xf)
+
+		if w & 0x800 == 0 {
+			return 2, "in", avrRegister(d) + ", " + port, ""
+		}
+
+		return 2, "out", port + ", " + avrRegister(d), ""
+	case w & 0xe000 == 0xc000:
+		mnemonic, group := "rjmp", "jump"
+
+		if w & 0x1000 != 0 {
+			mnemonic, group = "rcall", "call"
+		}
+
+		return 2, mnemonic, relative(avrSigned(w & 0xfff, 12)), group
+	case w & 0xf000 == 0xe000:
+		return 2, "ldi", fmt.Sprintf("%s, 0x%x", avrRegister(16 + w >> 4 & 0xf), w >> 4 & 0xf0 | w & 0xf), ""
+	case w & 0xf800 == 0xf000:
+		mnemonic := avrBranchIfSet[w & 7]
+
+		if w & 0x400 != 0 {
+			mnemonic = avrBranchIfClear[w & 7]
+		}
+
+		return 2, mnemonic, relative(avrSigned(w >> 3 & 0x7f, 7)), "jump"
+	case w & 0xf808 == 0xf800:
+		return 2, avrRegisterBitOps[w >> 9 & 3], fmt.Sprintf("%s, %d", avrRegister(d), w & 7), ""
+	}
+
+	return 0, "", "", ""
+}
+
+// Splits "ld r24, Z+" into its mnemonic and operands
+func splitAVR(text string) (string, string) {
+	for n, c := range text {
+		if c == ' ' {
+			return text[:n], text[n+1:]
+		}
+	}
+
+	return text, ""
+}
+
+// Disassembles AVR code like Disassemble does for the architectures Capstone has, stopping at the first invalid
+// instruction
+func disassembleAVR(code []byte, base uint64, o options) []Insn {
+	var out []Insn
+
+	for offset := 0; offset < len(code); {
+		address := base + uint64(offset)
+		length, mnemonic, operands, group := decodeAVR(code[offset:], address)
+
+		if length == 0 {
+			break
+		}
+
+		insn := Insn{
+			Address:  address,
+			Bytes:    code[offset:offset + length],
+			Mnemonic: mnemonic,
+			OpStr:    operands,
+		}
+
+		if o.detail && group != "" {
+			insn.Groups = []string{group}
+		}
+
+		out = append(out, insn)
+		offset += length
+	}
+
+	return out
+}
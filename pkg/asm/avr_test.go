@@ -0,0 +1,106 @@
+package asm
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// Encodings from avr-objdump listings of avr-gcc output, mostly a crt and its vector table
+var avrTests = []struct {
+	code     string
+	address  uint64
+	length   int
+	mnemonic string
+	operands string
+	group    string
+}{
+	{"0000", 0, 2, "nop", "", ""},
+	{"0c943400", 0, 4, "jmp", "0x68", "jump"},
+	{"0e944000", 0x68, 4, "call", "0x80", "call"},
+	{"1124", 0x68, 2, "eor", "r1, r1", ""},
+	{"1fbe", 0x6a, 2, "out", "0x3f, r1", ""},
+	{"cfef", 0x6c, 2, "ldi", "r28, 0xff", ""},
+	{"d8e0", 0x6e, 2, "ldi", "r29, 0x8", ""},
+	{"debf", 0x70, 2, "out", "0x3e, r29", ""},
+	{"cdbf", 0x72, 2, "out", "0x3d, r28", ""},
+	{"8fb7", 0, 2, "in", "r24, 0x3f", ""},
+	{"0895", 0, 2, "ret", "", "ret"},
+	{"1895", 0, 2, "reti", "", "ret"},
+	{"0994", 0, 2, "ijmp", "", "jump"},
+	{"0995", 0, 2, "icall", "", "call"},
+	{"f894", 0, 2, "cli", "", ""},
+	{"7894", 0, 2, "sei", "", ""},
+	{"ffcf", 0x80, 2, "rjmp", "0x80", "jump"},
+	{"02d0", 0x80, 2, "rcall", "0x86", "call"},
+	{"e1f7", 0x90, 2, "brne", "0x8a", "jump"},
+	{"09f0", 0x90, 2, "breq", "0x94", "jump"},
+	{"80910001", 0, 4, "lds", "r24, 0x100", ""},
+	{"80930001", 0, 4, "sts", "0x100, r24", ""},
+	{"8f93", 0, 2, "push", "r24", ""},
+	{"8f91", 0, 2, "pop", "r24", ""},
+	{"8491", 0, 2, "lpm", "r24, Z", ""},
+	{"0d92", 0, 2, "st", "X+, r0", ""},
+	{"8881", 0, 2, "ld", "r24, Y", ""},
+	{"8981", 0, 2, "ldd", "r24, Y+1", ""},
+	{"8283", 0, 2, "std", "Z+2, r24", ""},
+	{"0196", 0, 2, "adiw", "r24, 0x1", ""},
+	{"1197", 0, 2, "sbiw", "r26, 0x1", ""},
+	{"c901", 0, 2, "movw", "r24, r18", ""},
+	{"9e01", 0, 2, "movw", "r18, r28", ""},
+	{"8a95", 0, 2, "dec", "r24", ""},
+	{"8395", 0, 2, "inc", "r24", ""},
+	{"8830", 0, 2, "cpi", "r24, 0x8", ""},
+	{"8f70", 0, 2, "andi", "r24, 0xf", ""},
+	{"2c0f", 0, 2, "add", "r18, r28", ""},
+	{"3d1f", 0, 2, "adc", "r19, r29", ""},
+	{"259a", 0, 2, "sbi", "0x4, 5", ""},
+	{"2d98", 0, 2, "cbi", "0x5, 5", ""},
+	{"87fd", 0, 2, "sbrc", "r24, 7", ""},
+	{"829f", 0, 2, "mul", "r24, r18", ""},
+}
+
+func TestDecodeAVR(t *testing.T) {
+	for _, test := range avrTests {
+		code, err := hex.DecodeString(test.code)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.code, err)
+		}
+
+		length, mnemonic, operands, group := decodeAVR(code, test.address)
+
+		if length != test.length || mnemonic != test.mnemonic || operands != test.operands || group != test.group {
+			t.Errorf("%s at 0x%x: got %d %q %q %q, want %d %q %q %q", test.code, test.address, length, mnemonic, operands, group,
+				test.length, test.mnemonic, test.operands, test.group)
+		}
+	}
+}
+
+func TestDecodeAVRInvalid(t *testing.T) {
+	// Truncated instructions, a jmp and an lds missing their second word, and an unallocated encoding
+	for _, code := range []string{"", "00", "0c94", "8091", "ffff"} {
+		raw, _ := hex.DecodeString(code)
+
+		if length, mnemonic, _, _ := decodeAVR(raw, 0); length != 0 {
+			t.Errorf("%q: got %d %q, want it rejected", code, length, mnemonic)
+		}
+	}
+}
+
+func TestDisassembleAVR(t *testing.T) {
+	code, _ := hex.DecodeString("0c9434001124ffff0895")
+	insns := disassembleAVR(code, 0x100, options{detail: true})
+
+	// Stops at the invalid word
+	if len(insns) != 2 {
+		t.Fatalf("got %d instructions, want 2", len(insns))
+	}
+
+	if insns[1].Address != 0x104 || insns[1].Mnemonic != "eor" || len(insns[1].Bytes) != 2 {
+		t.Errorf("second instruction: got %+v", insns[1])
+	}
+
+	if len(insns[0].Groups) != 1 || insns[0].Groups[0] != "jump" {
+		t.Errorf("jmp groups: got %v, want [jump]", insns[0].Groups)
+	}
+}
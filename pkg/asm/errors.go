@@ -0,0 +1,81 @@
+package asm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Returned when an engine rejects the input, wraps one of the Err* errors with the engine's explanation
+type EngineError struct {
+	// One of the Err* errors, so callers can still use errors.Is
+	Err error
+
+	// What the engine said was wrong, in plain English where it's known
+	Reason string
+
+	// The instruction that failed to assemble and its index (from 0) in the input, only set by Assemble
+	Instruction string
+	Index       int
+}
+
+func (e *EngineError) Error() string {
+	msg := e.Err.Error()
+
+	if e.Instruction != "" {
+		msg += " (instruction " + strconv.Itoa(e.Index+1) + ", '" + e.Instruction + "')"
+	}
+
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+
+	return msg
+}
+
+func (e *EngineError) Unwrap() error {
+	return e.Err
+}
+
+// Plain English explanations for common Keystone error codes. Keystone's own messages are terse, i.e.
+// "Invalid operand (KS_ERR_ASM_INVALIDOPERAND)".
+var keystoneReasons = map[string]string{
+	"KS_ERR_ASM_INVALIDOPERAND":   "invalid operand for this architecture/mode",
+	"KS_ERR_ASM_MNEMONICFAIL":     "unknown instruction, or not supported in this mode",
+	"KS_ERR_ASM_MISSINGFEATURE":   "instruction needs a CPU feature this mode doesn't have",
+	"KS_ERR_ASM_SYMBOL_MISSING":   "use of an undefined label or symbol",
+	"KS_ERR_ASM_SYMBOL_REDEFINED": "label or symbol defined more than once",
+	"KS_ERR_ASM_LABEL_INVALID":    "invalid label",
+	"KS_ERR_ASM_EXPR_TOKEN":       "unexpected token in expression",
+	"KS_ERR_ASM_DIRECTIVE_TOKEN":  "unexpected token in directive",
+	"KS_ERR_ASM_DIRECTIVE_ID":     "unknown directive",
+	"KS_ERR_MODE":                 "invalid mode for this architecture",
+	"KS_ERR_ARCH":                 "architecture isn't compiled into keystone",
+	"KS_ERR_NOMEM":                "keystone ran out of memory",
+}
+
+// Plain English explanations for common Capstone error codes
+var capstoneReasons = map[string]string{
+	"CS_ERR_OK":     "the first instruction isn't valid for this architecture/mode",
+	"CS_ERR_MODE":   "invalid mode for this architecture",
+	"CS_ERR_ARCH":   "architecture isn't compiled into capstone",
+	"CS_ERR_MEM":    "capstone ran out of memory",
+	"CS_ERR_OPTION": "invalid option",
+	"CS_ERR_DETAIL": "instruction details are unavailable",
+}
+
+// Builds an EngineError, translating the engine's error code when it's a known one
+func engineError(sentinel error, err error, reasons map[string]string) *EngineError {
+	if err == nil {
+		return &EngineError{Err: sentinel}
+	}
+
+	msg := err.Error()
+
+	for code, reason := range reasons {
+		if strings.Contains(msg, "(" + code + ")") || msg == code {
+			return &EngineError{Err: sentinel, Reason: reason}
+		}
+	}
+
+	return &EngineError{Err: sentinel, Reason: msg}
+}
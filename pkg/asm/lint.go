@@ -0,0 +1,351 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The longest instruction an x86 CPU will decode, anything longer raises #GP
+const x86MaxInstructionLength = 15
+
+// A suspicious construct found in assembled instructions
+type Warning struct {
+	// Index of the instruction the warning is about
+	Index   int
+	Message string
+}
+
+// Instructions a LOCK prefix is allowed on, with a memory destination. The CPU raises #UD for any other use.
+var x86Lockable = map[string]bool{
+	"add": true, "adc": true, "and": true, "btc": true, "btr": true, "bts": true, "cmpxchg": true, "cmpxchg8b": true,
+	"cmpxchg16b": true, "dec": true, "inc": true, "neg": true, "not": true, "or": true, "sbb": true, "sub": true,
+	"xor": true, "xadd": true, "xchg": true,
+}
+
+// Instructions whose memory operand's size can't be told from their register operand
+var x86SizeFromMemory = map[string]bool{"movzx": true, "movsx": true}
+
+// Prefixes that can come before the mnemonic in assembly source
+var x86SourcePrefixes = map[string]bool{
+	"lock": true, "rep": true, "repe": true, "repz": true, "repne": true, "repnz": true, "bnd": true, "notrack": true,
+}
+
+// The x86 mode each mode is compared against when looking for mode-dependent encodings
+var x86CompareModes = map[string]string{
+	"x86_16": "x86",
+	"x86":    "x64",
+	"x64":    "x86",
+	"x86_64": "x86",
+	"x86-64": "x86",
+}
+
+// Runs a warnings pass over assembled instructions, flagging constructs that assemble but probably don't do what
+// the user meant. x86 has most of the checks, ARM only checks the alignment of code after a .arm directive.
+func Lint(arch string, ins []Insn, opts ...Option) []Warning {
+	var warnings []Warning
+
+	warn := func(index int, format string, args ...interface{}) {
+		warnings = append(warnings, Warning{index, fmt.Sprintf(format, args...)})
+	}
+
+	if arch == "arm" || arch == "thumb" {
+		for n, i := range ins {
+			// Thumb code only keeps a halfword alignment, ARM code after it has to be word aligned to be branched to
+			if n > 0 && ins[n-1].Thumb && !i.Thumb && i.Address % 4 != 0 {
+				warn(n, "is ARM code at +%d, which isn't 4-byte aligned, pad the Thumb code before it with a nop", i.Address)
+			}
+		}
+
+		return warnings
+	}
+
+	other, isX86 := x86CompareModes[arch]
+
+	if !isX86 {
+		return nil
+	}
+
+	var o options
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	for n, i := range ins {
+		if len(i.Bytes) > x86MaxInstructionLength {
+			warn(n, "encoding is %d bytes, longer than the %d byte x86 limit, the CPU will raise #GP", len(i.Bytes), x86MaxInstructionLength)
+		}
+
+		// Checked against the Intel syntax decoding, whatever syntax the source is in
+		decoded, err := Disassemble(arch, i.Bytes, i.Address)
+		prefixes := x86OptionalPrefixes(arch, i.Bytes, decoded)
+
+		if err == nil && len(decoded) == 1 {
+			for _, message := range x86EncodingWarnings(i.Source, o.syntax == "att", prefixes, decoded[0]) {
+				warn(n, "%s", message)
+			}
+		}
+
+		for _, prefix := range prefixes {
+			switch prefix {
+			case 0x66:
+				warn(n, "has an implicit operand-size (0x66) prefix, the operand size isn't this mode's default")
+			case 0x67:
+				warn(n, "has an implicit address-size (0x67) prefix, the address size isn't this mode's default")
+			}
+		}
+
+		// The same source can assemble to different bytes in the other mode, i.e. `inc eax`
+		if otherIns, err := Assemble(other, i.Source, opts...); err == nil && len(otherIns) == 1 && string(otherIns[0].Bytes) != string(i.Bytes) {
+			warn(n, "encodes differently in %s mode (%s)", x86ModeName(other), hexBytes(otherIns[0].Bytes))
+		}
+
+		// And the same bytes can decode as something else entirely, i.e. 0x40 is a REX prefix in 64-bit mode.
+		// Only the operand size changing (push rbp vs. push ebp) is expected, so that isn't flagged.
+		this, err := Disassemble(arch, i.Bytes, 0, opts...)
+
+		if err != nil || len(this) == 0 {
+			continue
+		}
+
+		if decoded, err := Disassemble(other, i.Bytes, 0, opts...); err != nil || len(decoded) == 0 {
+			warn(n, "these bytes aren't a valid instruction in %s mode", x86ModeName(other))
+		} else if len(decoded) > 1 || len(decoded[0].Bytes) != len(i.Bytes) || decoded[0].Mnemonic != this[0].Mnemonic {
+			warn(n, "these bytes decode as `%s` in %s mode", strings.TrimSpace(decoded[0].Mnemonic + " " + decoded[0].OpStr), x86ModeName(other))
+		}
+	}
+
+	return warnings
+}
+
+// Checks an assembled instruction against its source for things Keystone accepts without complaint: a LOCK prefix
+// the instruction can't take, an immediate too big for its operand, and a memory operand whose size was guessed
+func x86EncodingWarnings(source string, att bool, prefixes []byte, decoded Insn) []string {
+	var warnings []string
+
+	mnemonic := strings.TrimPrefix(decoded.Mnemonic, "lock ")
+	operands := splitOperands(decoded.OpStr)
+
+	for _, prefix := range prefixes {
+		if prefix != 0xF0 {
+			continue
+		}
+
+		if !x86Lockable[mnemonic] {
+			warnings = append(warnings, fmt.Sprintf("has a LOCK prefix, which `%s` can't take, the CPU will raise #UD", mnemonic))
+		} else if len(operands) == 0 || !strings.Contains(operands[0], "[") {
+			warnings = append(warnings, "has a LOCK prefix without a memory destination, the CPU will raise #UD")
+		}
+	}
+
+	fields := strings.Fields(strings.ToLower(source))
+
+	for len(fields) > 0 && x86SourcePrefixes[fields[0]] {
+		fields = fields[1:]
+	}
+
+	if len(fields) < 2 {
+		return warnings
+	}
+
+	sourceOperands := splitOperands(strings.Join(fields[1:], " "))
+
+	// AT&T puts the operands the other way round
+	if att {
+		for l, r := 0, len(sourceOperands) - 1; l < r; l, r = l + 1, r - 1 {
+			sourceOperands[l], sourceOperands[r] = sourceOperands[r], sourceOperands[l]
+		}
+	}
+
+	if len(sourceOperands) != len(operands) {
+		return warnings
+	}
+
+	// Branch targets are addresses, not immediates
+	branch := strings.HasPrefix(mnemonic, "j") || strings.HasPrefix(mnemonic, "call") || strings.HasPrefix(mnemonic, "loop")
+	registers := false
+
+	for _, operand := range operands {
+		if _, ok := parseImmediate(operand); !ok && !strings.Contains(operand, "[") {
+			registers = true
+		}
+	}
+
+	for n, operand := range sourceOperands {
+		if value, ok := parseImmediate(operand); ok && !branch {
+			if encoded, ok := parseImmediate(operands[n]); ok && !immediateFits(value, uint64(encoded)) {
+				warnings = append(warnings, fmt.Sprintf("the immediate %s doesn't fit its operand, it was assembled as %s", strings.TrimPrefix(operand, "$"), operands[n]))
+			}
+		}
+
+		// Without a register to take the size from, Keystone picks one
+		if !att && strings.Contains(operand, "[") && !hasOperandSize(operand) && (!registers || x86SizeFromMemory[mnemonic]) && strings.Contains(operands[n], " ptr ") {
+			warnings = append(warnings, fmt.Sprintf("the memory operand has no size, it was assembled as `%s`", operands[n]))
+		}
+	}
+
+	return warnings
+}
+
+// Splits an instruction's operands on the commas between them, leaving the ones inside an AT&T memory operand
+func splitOperands(operands string) []string {
+	var out []string
+	depth, start := 0, 0
+
+	for n, c := range operands {
+		switch c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				out = append(out, strings.TrimSpace(operands[start:n]))
+				start = n + 1
+			}
+		}
+	}
+
+	if rest := strings.TrimSpace(operands[start:]); rest != "" || len(out) > 0 {
+		out = append(out, rest)
+	}
+
+	return out
+}
+
+// Parses an operand that's a plain number, with an AT&T $ or without
+func parseImmediate(operand string) (int64, bool) {
+	operand = strings.TrimPrefix(strings.TrimSpace(operand), "$")
+
+	if value, err := strconv.ParseInt(operand, 0, 64); err == nil {
+		return value, true
+	}
+
+	if value, err := strconv.ParseUint(operand, 0, 64); err == nil {
+		return int64(value), true
+	}
+
+	return 0, false
+}
+
+// Checks if an immediate was encoded as it was written. A negative one is shown as its two's complement in the
+// operand's width, which is fine as long as it fits that width.
+func immediateFits(value int64, encoded uint64) bool {
+	if uint64(value) == encoded {
+		return true
+	}
+
+	for _, bits := range []uint{8, 16, 32} {
+		mask := uint64(1) << bits - 1
+
+		if encoded <= mask && value < 0 && value >= -(1 << (bits - 1)) && uint64(value) & mask == encoded {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks if an Intel syntax memory operand says its size, i.e. "dword ptr [rax]" or "byte [rax]"
+func hasOperandSize(operand string) bool {
+	for _, word := range strings.Fields(strings.ToLower(operand)) {
+		switch word {
+		case "ptr", "byte", "word", "dword", "qword", "tword", "oword", "xmmword", "ymmword", "zmmword":
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the legacy prefixes at the start of an x86 instruction
+func x86LegacyPrefixes(code []byte) []byte {
+	var prefixes []byte
+
+	for _, b := range code {
+		switch b {
+		case 0xF0, 0xF2, 0xF3, 0x2E, 0x36, 0x3E, 0x26, 0x64, 0x65, 0x66, 0x67:
+			prefixes = append(prefixes, b)
+		default:
+			return prefixes
+		}
+	}
+
+	return prefixes
+}
+
+// Returns the legacy prefixes of an x86 instruction that change what it does, leaving out a mandatory prefix: the
+// 0x66, 0xF2 or 0xF3 that's part of the opcode of SSE instructions like movdqa (66 0F 6F) and popcnt (F3 0F B8).
+// 0x66 before a 0x0F opcode is still an operand-size override when the decoding has 16-bit operands, i.e. movzx ax.
+func x86OptionalPrefixes(arch string, code []byte, decoded []Insn) []byte {
+	prefixes := x86LegacyPrefixes(code)
+
+	if len(prefixes) == 0 {
+		return prefixes
+	}
+
+	opcode := code[len(prefixes):]
+
+	// A REX prefix goes between the legacy prefixes and the opcode
+	if x86ModeName(arch) == "64-bit" && len(opcode) > 0 && opcode[0] & 0xF0 == 0x40 {
+		opcode = opcode[1:]
+	}
+
+	last := prefixes[len(prefixes) - 1]
+
+	if len(opcode) == 0 || opcode[0] != 0x0F || (last != 0x66 && last != 0xF2 && last != 0xF3) {
+		return prefixes
+	}
+
+	if last == 0x66 && len(decoded) == 1 && x86OverridesOperandSize(arch, decoded[0]) {
+		return prefixes
+	}
+
+	return prefixes[:len(prefixes) - 1]
+}
+
+// The general purpose registers and memory operand size 0x66 switches an instruction to, by mode
+var x86OverriddenOperands = map[string][]string{
+	"16-bit": {"eax", "ebx", "ecx", "edx", "esi", "edi", "esp", "ebp", "dword ptr"},
+	"32-bit": {"ax", "bx", "cx", "dx", "si", "di", "sp", "bp", "word ptr"},
+	"64-bit": {"ax", "bx", "cx", "dx", "si", "di", "sp", "bp", "r8w", "r9w", "r10w", "r11w", "r12w", "r13w", "r14w", "r15w", "word ptr"},
+}
+
+// Checks if a decoded instruction's operands are the size a 0x66 prefix gives in the mode
+func x86OverridesOperandSize(arch string, decoded Insn) bool {
+	sizes := x86OverriddenOperands[x86ModeName(arch)]
+
+	for _, operand := range splitOperands(decoded.OpStr) {
+		for _, size := range sizes {
+			if operand == size || strings.HasPrefix(operand, size + " ") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns a readable name for an x86 mode
+func x86ModeName(arch string) string {
+	switch arch {
+	case "x86_16":
+		return "16-bit"
+	case "x86":
+		return "32-bit"
+	default:
+		return "64-bit"
+	}
+}
+
+// Formats bytes as space separated hex
+func hexBytes(code []byte) string {
+	var parts []string
+
+	for _, b := range code {
+		parts = append(parts, fmt.Sprintf("%02x", b))
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,204 @@
+package asm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitOperands(t *testing.T) {
+	tests := []struct {
+		operands string
+		want     []string
+	}{
+		{"", nil},
+		{"eax", []string{"eax"}},
+		{"eax, ebx", []string{"eax", "ebx"}},
+		{"dword ptr [rax + rbx*4], 1", []string{"dword ptr [rax + rbx*4]", "1"}},
+		{"$1, 0x10(%rax,%rbx,4)", []string{"$1", "0x10(%rax,%rbx,4)"}},
+		{"r0, [r1, #4]", []string{"r0", "[r1, #4]"}},
+	}
+
+	for _, test := range tests {
+		if got := splitOperands(test.operands); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitOperands(%q) = %q, want %q", test.operands, got, test.want)
+		}
+	}
+}
+
+func TestImmediateFits(t *testing.T) {
+	tests := []struct {
+		value   int64
+		encoded uint64
+		want    bool
+	}{
+		{1, 1, true},
+		{-1, 0xff, true},
+		{-1, 0xffff, true},
+		{-1, 0xffffffff, true},
+		{-128, 0x80, true},
+		{-129, 0x7f, false},
+		{0x100, 0, false},
+		{0x12345, 0x2345, false},
+		{255, 0xff, true},
+	}
+
+	for _, test := range tests {
+		if got := immediateFits(test.value, test.encoded); got != test.want {
+			t.Errorf("immediateFits(%d, 0x%x) = %v, want %v", test.value, test.encoded, got, test.want)
+		}
+	}
+}
+
+func TestParseImmediate(t *testing.T) {
+	tests := []struct {
+		operand string
+		value   int64
+		ok      bool
+	}{
+		{"0x10", 0x10, true},
+		{"$0x10", 0x10, true},
+		{"-1", -1, true},
+		{"0xffffffffffffffff", -1, true},
+		{"eax", 0, false},
+		{"[rax]", 0, false},
+	}
+
+	for _, test := range tests {
+		if value, ok := parseImmediate(test.operand); value != test.value || ok != test.ok {
+			t.Errorf("parseImmediate(%q) = %d, %v, want %d, %v", test.operand, value, ok, test.value, test.ok)
+		}
+	}
+}
+
+func TestHasOperandSize(t *testing.T) {
+	for operand, want := range map[string]bool{
+		"dword ptr [rax]": true, "byte [rax]": true, "XMMWORD PTR [rsp]": true, "[rax]": false, "[rax + 8]": false,
+	} {
+		if got := hasOperandSize(operand); got != want {
+			t.Errorf("hasOperandSize(%q) = %v, want %v", operand, got, want)
+		}
+	}
+}
+
+func TestX86OptionalPrefixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		arch    string
+		code    []byte
+		decoded Insn
+		want    []byte
+	}{
+		{"mov ax, bx", "x86", []byte{0x66, 0x89, 0xD8}, Insn{Mnemonic: "mov", OpStr: "ax, bx"}, []byte{0x66}},
+		{"movdqa", "x64", []byte{0x66, 0x0F, 0x6F, 0xC1}, Insn{Mnemonic: "movdqa", OpStr: "xmm0, xmm1"}, []byte{}},
+		{"movzx ax", "x64", []byte{0x66, 0x0F, 0xB6, 0xC3}, Insn{Mnemonic: "movzx", OpStr: "ax, bl"}, []byte{0x66}},
+		{"popcnt with REX.W", "x64", []byte{0xF3, 0x48, 0x0F, 0xB8, 0xC3}, Insn{Mnemonic: "popcnt", OpStr: "rax, rbx"}, []byte{}},
+		{"movsd", "x86", []byte{0xF2, 0x0F, 0x10, 0xC1}, Insn{Mnemonic: "movsd", OpStr: "xmm0, xmm1"}, []byte{}},
+		{"rep movsb", "x86", []byte{0xF3, 0xA4}, Insn{Mnemonic: "rep movsb", OpStr: "byte ptr es:[edi], byte ptr [esi]"}, []byte{0xF3}},
+		{"lock and a mandatory prefix", "x64", []byte{0xF0, 0x66, 0x0F, 0xC1, 0x00}, Insn{Mnemonic: "lock xadd", OpStr: "word ptr [rax], ax"}, []byte{0xF0, 0x66}},
+		{"no prefixes", "x64", []byte{0x90}, Insn{Mnemonic: "nop"}, nil},
+	}
+
+	for _, test := range tests {
+		got := x86OptionalPrefixes(test.arch, test.code, []Insn{test.decoded})
+
+		if len(got) != len(test.want) || (len(got) > 0 && !reflect.DeepEqual(got, test.want)) {
+			t.Errorf("%s: got % x, want % x", test.name, got, test.want)
+		}
+	}
+}
+
+func TestX86EncodingWarnings(t *testing.T) {
+	tests := []struct {
+		source   string
+		att      bool
+		prefixes []byte
+		decoded  Insn
+		want     string
+	}{
+		{"lock mov [rax], ebx", false, []byte{0xF0}, Insn{Mnemonic: "lock mov", OpStr: "dword ptr [rax], ebx"}, "`mov` can't take"},
+		{"lock add eax, ebx", false, []byte{0xF0}, Insn{Mnemonic: "lock add", OpStr: "eax, ebx"}, "without a memory destination"},
+		{"add al, 0x100", false, nil, Insn{Mnemonic: "add", OpStr: "al, 0"}, "the immediate 0x100 doesn't fit"},
+		{"addb $0x100, %al", true, nil, Insn{Mnemonic: "add", OpStr: "al, 0"}, "the immediate 0x100 doesn't fit"},
+		{"inc [rax]", false, nil, Insn{Mnemonic: "inc", OpStr: "dword ptr [rax]"}, "the memory operand has no size"},
+		{"movzx eax, [rax]", false, nil, Insn{Mnemonic: "movzx", OpStr: "eax, byte ptr [rax]"}, "the memory operand has no size"},
+	}
+
+	for _, test := range tests {
+		warnings := x86EncodingWarnings(test.source, test.att, test.prefixes, test.decoded)
+
+		if len(warnings) != 1 || !strings.Contains(warnings[0], test.want) {
+			t.Errorf("%q: got %q, want one warning with %q", test.source, warnings, test.want)
+		}
+	}
+
+	// Sized, in range and branch operands are fine
+	for _, test := range []struct {
+		source  string
+		decoded Insn
+	}{
+		{"lock add [rax], ebx", Insn{Mnemonic: "lock add", OpStr: "dword ptr [rax], ebx"}},
+		{"add al, -1", Insn{Mnemonic: "add", OpStr: "al, 0xff"}},
+		{"inc dword ptr [rax]", Insn{Mnemonic: "inc", OpStr: "dword ptr [rax]"}},
+		{"mov eax, [rax]", Insn{Mnemonic: "mov", OpStr: "eax, dword ptr [rax]"}},
+		{"jmp 0x12345", Insn{Mnemonic: "jmp", OpStr: "0x12345"}},
+	} {
+		prefixes := []byte(nil)
+
+		if strings.HasPrefix(test.source, "lock ") {
+			prefixes = []byte{0xF0}
+		}
+
+		if warnings := x86EncodingWarnings(test.source, false, prefixes, test.decoded); len(warnings) != 0 {
+			t.Errorf("%q: got %q, want no warnings", test.source, warnings)
+		}
+	}
+}
+
+func TestX86LegacyPrefixes(t *testing.T) {
+	tests := []struct {
+		code []byte
+		want []byte
+	}{
+		{[]byte{0x90}, nil},
+		{[]byte{0x66, 0x89, 0xD8}, []byte{0x66}},
+		{[]byte{0xF0, 0x66, 0x0F, 0xC1, 0x00}, []byte{0xF0, 0x66}},
+		{[]byte{0x64, 0x67, 0x8B, 0x00}, []byte{0x64, 0x67}},
+		{[]byte{0xF3, 0x48, 0xA5}, []byte{0xF3}},
+		{[]byte{0x66, 0x66}, []byte{0x66, 0x66}},
+	}
+
+	for _, test := range tests {
+		if got := x86LegacyPrefixes(test.code); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("x86LegacyPrefixes(% x) = % x, want % x", test.code, got, test.want)
+		}
+	}
+}
+
+func TestHexBytes(t *testing.T) {
+	if got := hexBytes([]byte{0x0F, 0x1F, 0x00}); got != "0f 1f 00" {
+		t.Errorf("got %q, want \"0f 1f 00\"", got)
+	}
+}
+
+func TestLintOtherArchitectures(t *testing.T) {
+	// The x86 checks don't apply to other architectures
+	if warnings := Lint("mips", []Insn{{Bytes: []byte{0x03, 0xe0, 0x00, 0x08}}}); warnings != nil {
+		t.Errorf("got %+v, want no warnings", warnings)
+	}
+}
+
+func TestLintARMAlignment(t *testing.T) {
+	ins := []Insn{
+		{Address: 0, Thumb: true},
+		{Address: 2, Thumb: false},
+		{Address: 4, Thumb: true},
+		{Address: 8, Thumb: false},
+	}
+
+	warnings := Lint("thumb", ins)
+
+	if len(warnings) != 1 || warnings[0].Index != 1 {
+		t.Errorf("got %+v, want one warning about the ARM code at +2", warnings)
+	}
+}
@@ -0,0 +1,264 @@
+// Package fuzzyhash computes and compares ssdeep and TLSH fuzzy hashes. Both give similar files similar hashes, so
+// samples can be compared without having both files. They're computed like the reference implementations compute
+// them, so hashes from other tools can be compared too.
+package fuzzyhash
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Errors returned for data that can't be hashed and hashes that can't be parsed
+var (
+	ErrTooShort    = errors.New("not enough data to hash")
+	ErrTooUniform  = errors.New("the data doesn't vary enough to hash")
+	ErrInvalidHash = errors.New("invalid hash")
+)
+
+const (
+	ssdeepWindow       = 7
+	ssdeepMinBlockSize = 3
+	ssdeepLength       = 64
+	ssdeepHashInit     = 0x28021967
+	ssdeepHashPrime    = 0x01000193
+	ssdeepBase64       = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+// The rolling hash ssdeep uses to decide where to split the data
+type ssdeepRoll struct {
+	window     [ssdeepWindow]uint32
+	h1, h2, h3 uint32
+	n          int
+}
+
+func (r *ssdeepRoll) hash(c byte) uint32 {
+	r.h2 -= r.h1
+	r.h2 += ssdeepWindow * uint32(c)
+
+	r.h1 += uint32(c)
+	r.h1 -= r.window[r.n % ssdeepWindow]
+
+	r.window[r.n % ssdeepWindow] = uint32(c)
+	r.n++
+
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+
+	return r.h1 + r.h2 + r.h3
+}
+
+// Computes the ssdeep hash of data, formatted as "blocksize:hash:hash" like the ssdeep tool formats it
+func SSDeep(data []byte) (string, error) {
+	blockSize := uint32(ssdeepMinBlockSize)
+	for blockSize * ssdeepLength < uint32(len(data)) {
+		blockSize *= 2
+	}
+
+	for {
+		var roll ssdeepRoll
+		var first [ssdeepLength]byte
+		var second [ssdeepLength / 2]byte
+		var h uint32
+
+		h2 := uint32(ssdeepHashInit)
+		h3 := uint32(ssdeepHashInit)
+		j, k := 0, 0
+
+		for _, c := range data {
+			h = roll.hash(c)
+			h2 = (h2 * ssdeepHashPrime) ^ uint32(c)
+			h3 = (h3 * ssdeepHashPrime) ^ uint32(c)
+
+			// Once a part is full its last character keeps being replaced, so it covers the rest of the data
+			if h % blockSize == blockSize - 1 {
+				first[j] = ssdeepBase64[h2 % 64]
+
+				if j < ssdeepLength - 1 {
+					h2 = ssdeepHashInit
+					j++
+				}
+			}
+
+			if h % (blockSize * 2) == blockSize * 2 - 1 {
+				second[k] = ssdeepBase64[h3 % 64]
+
+				if k < ssdeepLength / 2 - 1 {
+					h3 = ssdeepHashInit
+					k++
+				}
+			}
+		}
+
+		if h != 0 {
+			first[j] = ssdeepBase64[h2 % 64]
+			second[k] = ssdeepBase64[h3 % 64]
+		}
+
+		firstPart := strings.TrimRight(string(first[:]), "\x00")
+		secondPart := strings.TrimRight(string(second[:]), "\x00")
+
+		// A block size that splits the data into too few pieces gives a hash that's no use, so it's halved
+		if blockSize > ssdeepMinBlockSize && j < ssdeepLength / 2 {
+			blockSize /= 2
+			continue
+		}
+
+		return strconv.FormatUint(uint64(blockSize), 10) + ":" + firstPart + ":" + secondPart, nil
+	}
+}
+
+// Parses an ssdeep hash into its block size and two parts
+func parseSSDeep(hash string) (uint32, string, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(hash), ":", 3)
+
+	if len(parts) != 3 {
+		return 0, "", "", ErrInvalidHash
+	}
+
+	// Hashes from the ssdeep tool can have a file name after them
+	parts[2] = strings.SplitN(parts[2], ",", 2)[0]
+	blockSize, err := strconv.ParseUint(parts[0], 10, 32)
+
+	if err != nil || blockSize < ssdeepMinBlockSize || len(parts[1]) > ssdeepLength || len(parts[2]) > ssdeepLength {
+		return 0, "", "", ErrInvalidHash
+	}
+
+	return uint32(blockSize), parts[1], parts[2], nil
+}
+
+// Shortens runs of more than three of the same character, they carry little information and skew the score
+func eliminateSequences(s string) string {
+	var out []byte
+
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i - 1] && s[i] == s[i - 2] && s[i] == s[i - 3] {
+			continue
+		}
+
+		out = append(out, s[i])
+	}
+
+	return string(out)
+}
+
+// Checks if two strings share a substring as long as the rolling hash window, unrelated data rarely does
+func hasCommonSubstring(a string, b string) bool {
+	for i := 0; i + ssdeepWindow <= len(a); i++ {
+		if strings.Contains(b, a[i:i + ssdeepWindow]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Edit distance where an insertion or deletion costs 1 and a substitution costs 2
+func editDistance(a string, b string) uint32 {
+	prev := make([]uint32, len(b) + 1)
+	cur := make([]uint32, len(b) + 1)
+
+	for j := range prev {
+		prev[j] = uint32(j)
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = uint32(i)
+
+		for j := 1; j <= len(b); j++ {
+			cost := uint32(2)
+			if a[i - 1] == b[j - 1] {
+				cost = 0
+			}
+
+			cur[j] = prev[j - 1] + cost
+
+			if prev[j] + 1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+
+			if cur[j - 1] + 1 < cur[j] {
+				cur[j] = cur[j - 1] + 1
+			}
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// Scores two hash parts made with the same block size from 0 to 100
+func scoreStrings(a string, b string, blockSize uint32) uint32 {
+	if len(a) > ssdeepLength || len(b) > ssdeepLength || !hasCommonSubstring(a, b) {
+		return 0
+	}
+
+	score := editDistance(a, b)
+	score = (score * ssdeepLength) / uint32(len(a) + len(b))
+	score = (100 * score) / ssdeepLength
+
+	if score >= 100 {
+		return 0
+	}
+
+	score = 100 - score
+
+	// Small block sizes can't give a high score to short hashes, they're too likely to match by chance
+	if blockSize >= (99 + ssdeepWindow) / ssdeepWindow * ssdeepMinBlockSize {
+		return score
+	}
+
+	shortest := len(a)
+	if len(b) < shortest {
+		shortest = len(b)
+	}
+
+	if limit := blockSize / ssdeepMinBlockSize * uint32(shortest); score > limit {
+		score = limit
+	}
+
+	return score
+}
+
+// Compares two ssdeep hashes, from 0 (unrelated) to 100 (the same, or nearly)
+func SSDeepCompare(a string, b string) (int, error) {
+	blockA, a1, a2, err := parseSSDeep(a)
+	if err != nil {
+		return 0, err
+	}
+
+	blockB, b1, b2, err := parseSSDeep(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only hashes with the same block size, or one twice the other, can be compared
+	if blockA != blockB && blockA != blockB * 2 && blockB != blockA * 2 {
+		return 0, nil
+	}
+
+	a1, a2 = eliminateSequences(a1), eliminateSequences(a2)
+	b1, b2 = eliminateSequences(b1), eliminateSequences(b2)
+
+	if blockA == blockB && a1 == b1 {
+		return 100, nil
+	}
+
+	var score uint32
+
+	switch {
+	case blockA == blockB:
+		score = scoreStrings(a1, b1, blockA)
+
+		if second := scoreStrings(a2, b2, blockA * 2); second > score {
+			score = second
+		}
+	case blockA == blockB * 2:
+		score = scoreStrings(a1, b2, blockA)
+	default:
+		score = scoreStrings(a2, b1, blockB)
+	}
+
+	return int(score), nil
+}
@@ -0,0 +1,125 @@
+package fuzzyhash
+
+import (
+	"strings"
+	"testing"
+)
+
+// Bytes that vary like compiled code does, the same every run
+func testData(seed uint32, length int) []byte {
+	data := make([]byte, length)
+
+	for n := range data {
+		seed = seed * 1103515245 + 12345
+		data[n] = byte(seed >> 16)
+	}
+
+	return data
+}
+
+func TestSSDeepEmpty(t *testing.T) {
+	// The ssdeep tool gives empty files this hash
+	if hash, err := SSDeep(nil); err != nil || hash != "3::" {
+		t.Errorf("SSDeep(nil) = %q, %v, want \"3::\"", hash, err)
+	}
+}
+
+func TestSSDeepFormat(t *testing.T) {
+	hash, err := SSDeep(testData(1, 20000))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockSize, first, second, err := parseSSDeep(hash)
+
+	if err != nil {
+		t.Fatalf("%q doesn't parse: %v", hash, err)
+	}
+
+	// The block size is halved while it splits the data into fewer than 32 pieces
+	if blockSize > ssdeepMinBlockSize && len(first) < ssdeepLength / 2 {
+		t.Errorf("%q: block size %d only gives %d pieces", hash, blockSize, len(first))
+	}
+
+	if len(first) > ssdeepLength || len(second) > ssdeepLength / 2 {
+		t.Errorf("%q: parts are %d and %d long", hash, len(first), len(second))
+	}
+
+	for _, c := range first + second {
+		if !strings.ContainsRune(ssdeepBase64, c) {
+			t.Errorf("%q: %q isn't base64", hash, c)
+		}
+	}
+}
+
+func TestSSDeepCompare(t *testing.T) {
+	data := testData(1, 20000)
+	changed := append([]byte(nil), data...)
+
+	// A patched file, a few bytes changed in one place
+	copy(changed[10000:], "patched!")
+
+	hash, _ := SSDeep(data)
+	changedHash, _ := SSDeep(changed)
+	unrelatedHash, _ := SSDeep(testData(2, 20000))
+
+	if score, err := SSDeepCompare(hash, hash); err != nil || score != 100 {
+		t.Errorf("same hash: got %d, %v, want 100", score, err)
+	}
+
+	if score, _ := SSDeepCompare(hash, changedHash); score < 50 {
+		t.Errorf("patched file: got %d, want at least 50", score)
+	}
+
+	if score, _ := SSDeepCompare(hash, unrelatedHash); score != 0 {
+		t.Errorf("unrelated file: got %d, want 0", score)
+	}
+
+	// Only block sizes the same or a factor of two apart compare
+	if score, _ := SSDeepCompare("3:abcdefgh:abcd", "12:abcdefgh:abcd"); score != 0 {
+		t.Errorf("block sizes 3 and 12: got %d, want 0", score)
+	}
+}
+
+func TestParseSSDeep(t *testing.T) {
+	blockSize, first, second, err := parseSSDeep("96:KQhaGCVZGhr83h3bc:KQhaGCVZGhr83h3bc,\"sample.exe\"")
+
+	if err != nil || blockSize != 96 || first != "KQhaGCVZGhr83h3bc" || second != "KQhaGCVZGhr83h3bc" {
+		t.Errorf("got %d, %q, %q, %v", blockSize, first, second, err)
+	}
+
+	for _, hash := range []string{"", "96:abc", "x:abc:def", "2:abc:def", "3:" + strings.Repeat("A", 65) + ":"} {
+		if _, _, _, err := parseSSDeep(hash); err != ErrInvalidHash {
+			t.Errorf("parseSSDeep(%q): got %v, want ErrInvalidHash", hash, err)
+		}
+	}
+}
+
+func TestEliminateSequences(t *testing.T) {
+	for in, want := range map[string]string{"": "", "AAA": "AAA", "AAAAAB": "AAAB", "ABBBBBBC": "ABBBC", "ABAB": "ABAB"} {
+		if got := eliminateSequences(in); got != want {
+			t.Errorf("eliminateSequences(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want uint32
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"abc", "abd", 2},
+		{"abc", "ab", 1},
+		{"kitten", "sitting", 5},
+	}
+
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
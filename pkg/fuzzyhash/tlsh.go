@@ -0,0 +1,218 @@
+package fuzzyhash
+
+import (
+	"encoding/hex"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	tlshBuckets    = 128
+	tlshCodeSize   = tlshBuckets / 4
+	tlshMinLength  = 50
+	tlshWindow     = 5
+	tlshVersion    = "T1"
+	tlshHashLength = 3 + tlshCodeSize
+)
+
+// Pearson hash permutation, the same one the reference TLSH uses
+var tlshTable = [256]byte{
+	1, 87, 49, 12, 176, 178, 102, 166, 121, 193, 6, 84, 249, 230, 44, 163,
+	14, 197, 213, 181, 161, 85, 218, 80, 64, 239, 24, 226, 236, 142, 38, 200,
+	110, 177, 104, 103, 141, 253, 255, 50, 77, 101, 81, 18, 45, 96, 31, 222,
+	25, 107, 190, 70, 86, 237, 240, 34, 72, 242, 20, 214, 244, 227, 149, 235,
+	97, 234, 57, 22, 60, 250, 82, 175, 208, 5, 127, 199, 111, 62, 135, 248,
+	174, 169, 211, 58, 66, 154, 106, 195, 245, 171, 17, 187, 182, 179, 0, 243,
+	132, 56, 148, 75, 128, 133, 158, 100, 130, 126, 91, 13, 153, 246, 216, 219,
+	119, 68, 223, 78, 83, 88, 201, 99, 122, 11, 92, 32, 136, 114, 52, 10,
+	138, 30, 48, 183, 156, 35, 61, 26, 143, 74, 251, 94, 129, 162, 63, 152,
+	170, 7, 115, 167, 241, 206, 3, 150, 55, 59, 151, 220, 90, 53, 23, 131,
+	125, 173, 15, 238, 79, 95, 89, 16, 105, 137, 225, 224, 217, 160, 37, 123,
+	118, 73, 2, 157, 46, 116, 9, 145, 134, 228, 207, 212, 202, 215, 69, 229,
+	27, 188, 67, 124, 168, 252, 42, 4, 29, 108, 21, 247, 19, 205, 39, 203,
+	233, 40, 186, 147, 198, 192, 155, 33, 164, 191, 98, 204, 165, 180, 117, 76,
+	140, 36, 210, 172, 41, 54, 159, 8, 185, 232, 113, 196, 231, 47, 146, 120,
+	51, 65, 28, 144, 254, 221, 93, 189, 194, 139, 112, 43, 71, 109, 184, 209,
+}
+
+// Hashes three bytes and a salt into a bucket
+func tlshMapping(salt byte, i byte, j byte, k byte) byte {
+	h := tlshTable[salt]
+	h = tlshTable[h ^ i]
+	h = tlshTable[h ^ j]
+	return tlshTable[h ^ k]
+}
+
+// Encodes the data length logarithmically, so files of similar sizes get close values
+func tlshLength(length int) byte {
+	var i int
+	l := math.Log(float64(float32(length)))
+
+	switch {
+	case length <= 656:
+		i = int(math.Floor(l / 0.4054651))
+	case length <= 3199:
+		i = int(math.Floor(l / 0.26236426 - 8.72777))
+	default:
+		i = int(math.Floor(l / 0.095310180 - 62.5472))
+	}
+
+	return byte(i & 0xff)
+}
+
+// Swaps the nibbles of a byte, TLSH hashes store the header bytes that way
+func swapNibbles(b byte) byte {
+	return b >> 4 | b << 4
+}
+
+// Computes the TLSH hash of data, as 72 hex characters starting with the "T1" version. Needs at least 50 bytes.
+func TLSH(data []byte) (string, error) {
+	if len(data) < tlshMinLength {
+		return "", ErrTooShort
+	}
+
+	var buckets [256]uint32
+	var checksum byte
+
+	// Every 5 byte window adds six of its triplets to the buckets
+	for n := tlshWindow - 1; n < len(data); n++ {
+		c0, c1, c2, c3, c4 := data[n], data[n - 1], data[n - 2], data[n - 3], data[n - 4]
+
+		checksum = tlshMapping(0, c0, c1, checksum)
+
+		buckets[tlshMapping(2, c0, c1, c2)]++
+		buckets[tlshMapping(3, c0, c1, c3)]++
+		buckets[tlshMapping(5, c0, c2, c3)]++
+		buckets[tlshMapping(7, c0, c2, c4)]++
+		buckets[tlshMapping(11, c0, c1, c4)]++
+		buckets[tlshMapping(13, c0, c3, c4)]++
+	}
+
+	sorted := make([]uint32, tlshBuckets)
+	copy(sorted, buckets[:tlshBuckets])
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	q1, q2, q3 := sorted[tlshBuckets / 4 - 1], sorted[tlshBuckets / 2 - 1], sorted[tlshBuckets - tlshBuckets / 4 - 1]
+
+	nonzero := 0
+	for _, count := range buckets[:tlshBuckets] {
+		if count > 0 {
+			nonzero++
+		}
+	}
+
+	if q3 == 0 || nonzero <= tlshBuckets / 2 {
+		return "", ErrTooUniform
+	}
+
+	hash := make([]byte, tlshHashLength)
+	hash[0] = swapNibbles(checksum)
+	hash[1] = swapNibbles(tlshLength(len(data)))
+	hash[2] = swapNibbles(byte((q1 * 100 / q3) % 16) | byte((q2 * 100 / q3) % 16) << 4)
+
+	// Each bucket is two bits, which quartile it's in. The code is stored last bucket first.
+	for i := 0; i < tlshCodeSize; i++ {
+		var code byte
+
+		for j := 0; j < 4; j++ {
+			count := buckets[4 * i + j]
+
+			switch {
+			case count > q3:
+				code |= 3 << uint(j * 2)
+			case count > q2:
+				code |= 2 << uint(j * 2)
+			case count > q1:
+				code |= 1 << uint(j * 2)
+			}
+		}
+
+		hash[tlshHashLength - 1 - i] = code
+	}
+
+	return tlshVersion + strings.ToUpper(hex.EncodeToString(hash)), nil
+}
+
+// Parses a TLSH hash, with or without the version
+func parseTLSH(hash string) ([]byte, error) {
+	hash = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(hash)), tlshVersion)
+	data, err := hex.DecodeString(hash)
+
+	if err != nil || len(data) != tlshHashLength {
+		return nil, ErrInvalidHash
+	}
+
+	return data, nil
+}
+
+// Distance between two values on a circle of the given size
+func modDiff(x int, y int, size int) int {
+	d := x - y
+	if d < 0 {
+		d = -d
+	}
+
+	if size - d < d {
+		return size - d
+	}
+
+	return d
+}
+
+// Scores the difference between two TLSH hashes, 0 for the same file and rising with how different they are. Scores
+// under around 100 usually mean the files are related.
+func TLSHDiff(a string, b string) (int, error) {
+	ha, err := parseTLSH(a)
+	if err != nil {
+		return 0, err
+	}
+
+	hb, err := parseTLSH(b)
+	if err != nil {
+		return 0, err
+	}
+
+	diff := 0
+
+	if ha[0] != hb[0] {
+		diff++
+	}
+
+	if ldiff := modDiff(int(swapNibbles(ha[1])), int(swapNibbles(hb[1])), 256); ldiff == 1 {
+		diff++
+	} else if ldiff > 1 {
+		diff += ldiff * 12
+	}
+
+	qa, qb := swapNibbles(ha[2]), swapNibbles(hb[2])
+
+	for _, shift := range []uint{0, 4} {
+		if qdiff := modDiff(int(qa >> shift & 0xf), int(qb >> shift & 0xf), 16); qdiff <= 1 {
+			diff += qdiff
+		} else {
+			diff += (qdiff - 1) * 12
+		}
+	}
+
+	// Buckets a quartile apart add their distance, opposite quartiles add 6
+	for i := 3; i < tlshHashLength; i++ {
+		for shift := uint(0); shift < 8; shift += 2 {
+			d := int(ha[i] >> shift & 3) - int(hb[i] >> shift & 3)
+
+			if d < 0 {
+				d = -d
+			}
+
+			if d == 3 {
+				d = 6
+			}
+
+			diff += d
+		}
+	}
+
+	return diff, nil
+}
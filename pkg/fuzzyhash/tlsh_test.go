@@ -0,0 +1,100 @@
+package fuzzyhash
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTLSHTooShort(t *testing.T) {
+	if _, err := TLSH(testData(1, tlshMinLength - 1)); err != ErrTooShort {
+		t.Errorf("got %v, want ErrTooShort", err)
+	}
+
+	if _, err := TLSH(bytes.Repeat([]byte{0x90}, 1000)); err != ErrTooUniform {
+		t.Errorf("a run of one byte: got %v, want ErrTooUniform", err)
+	}
+}
+
+func TestTLSHFormat(t *testing.T) {
+	hash, err := TLSH(testData(1, 4096))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hash) != 72 || !strings.HasPrefix(hash, "T1") || strings.ToUpper(hash) != hash {
+		t.Errorf("got %q, want 72 upper case hex characters starting with T1", hash)
+	}
+
+	// Hashes from other tools may come without the version
+	if _, err := parseTLSH(strings.TrimPrefix(hash, "T1")); err != nil {
+		t.Errorf("without the version: %v", err)
+	}
+
+	for _, invalid := range []string{"", "T1", "T1ZZ", hash[:70]} {
+		if _, err := parseTLSH(invalid); err != ErrInvalidHash {
+			t.Errorf("parseTLSH(%q): got %v, want ErrInvalidHash", invalid, err)
+		}
+	}
+}
+
+func TestTLSHDiff(t *testing.T) {
+	data := testData(1, 4096)
+	changed := append([]byte(nil), data...)
+	copy(changed[2000:], "patched!")
+
+	hash, _ := TLSH(data)
+	changedHash, _ := TLSH(changed)
+	unrelatedHash, _ := TLSH(testData(2, 4096))
+
+	if diff, err := TLSHDiff(hash, hash); err != nil || diff != 0 {
+		t.Errorf("same hash: got %d, %v, want 0", diff, err)
+	}
+
+	if diff, _ := TLSHDiff(hash, changedHash); diff >= 100 {
+		t.Errorf("patched file: got %d, want under 100", diff)
+	}
+
+	near, _ := TLSHDiff(hash, changedHash)
+
+	if diff, _ := TLSHDiff(hash, unrelatedHash); diff <= near {
+		t.Errorf("unrelated file: got %d, want more than the patched file's %d", diff, near)
+	}
+}
+
+func TestTLSHLength(t *testing.T) {
+	// The reference implementation's l_capturing: log base 1.5 up to 656 bytes, then faster growing steps
+	tests := map[int]byte{50: 9, 100: 11, 656: 15, 1000: 17, 3199: 22, 10000: 34}
+
+	for length, want := range tests {
+		if got := tlshLength(length); got != want {
+			t.Errorf("tlshLength(%d) = %d, want %d", length, got, want)
+		}
+	}
+}
+
+func TestModDiff(t *testing.T) {
+	tests := []struct {
+		x, y, size, want int
+	}{
+		{3, 3, 16, 0},
+		{3, 10, 16, 7},
+		{0, 12, 16, 4},
+		{1, 255, 256, 2},
+	}
+
+	for _, test := range tests {
+		if got := modDiff(test.x, test.y, test.size); got != test.want {
+			t.Errorf("modDiff(%d, %d, %d) = %d, want %d", test.x, test.y, test.size, got, test.want)
+		}
+	}
+}
+
+func TestSwapNibbles(t *testing.T) {
+	for b, want := range map[byte]byte{0x12: 0x21, 0xf0: 0x0f, 0x00: 0x00, 0xab: 0xba} {
+		if got := swapNibbles(b); got != want {
+			t.Errorf("swapNibbles(0x%02x) = 0x%02x, want 0x%02x", b, got, want)
+		}
+	}
+}
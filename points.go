@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope points from challenges posted outside a guild are kept under
+const globalPointsScope = "global"
+
+// A user's points in a guild, with their name when they last scored so the leaderboard doesn't have to mention them
+type pointsUser struct {
+	Name   string `json:"name"`
+	Season int    `json:"season"`
+	Total  int    `json:"total"`
+}
+
+// The top of the leaderboard when a season ended
+type pastSeason struct {
+	Season  int          `json:"season"`
+	Ended   time.Time    `json:"ended"`
+	Winners []pointsUser `json:"winners"`
+}
+
+// A guild's leaderboard. Season points are reset when a season ends, the totals are kept, so role rewards (which are
+// based on the totals) aren't lost.
+type pointsBoard struct {
+	Season      int                    `json:"season"`
+	SeasonStart time.Time              `json:"season_start"`
+	Users       map[string]*pointsUser `json:"users"`
+	PastSeasons []pastSeason           `json:"past_seasons,omitempty"`
+}
+
+// Stores the leaderboard of every guild scope where points have been scored
+var (
+	pointsBoards map[string]*pointsBoard
+	pointsLock   sync.Mutex
+)
+
+// Loads the leaderboards from the data directory, along with the scores from before quizzes shared them
+func loadPoints() {
+	boards := make(map[string]*pointsBoard)
+
+	if err := loadStore("points", &boards); err != nil {
+		fmt.Println("[ERROR] Failed to load the leaderboards, " + err.Error())
+	}
+
+	if len(boards) == 0 {
+		var quizScores map[string]map[string]struct {
+			Name   string `json:"name"`
+			Points int    `json:"points"`
+		}
+
+		if err := loadStore("quiz", &quizScores); err == nil {
+			for scope, users := range quizScores {
+				board := newPointsBoard()
+
+				for id, score := range users {
+					board.Users[id] = &pointsUser{Name: score.Name, Season: score.Points, Total: score.Points}
+				}
+
+				boards[scope] = board
+			}
+		}
+	}
+
+	pointsLock.Lock()
+	pointsBoards = boards
+	pointsLock.Unlock()
+}
+
+// Makes an empty leaderboard, starting the first season
+func newPointsBoard() *pointsBoard {
+	return &pointsBoard{Season: 1, SeasonStart: time.Now(), Users: make(map[string]*pointsUser)}
+}
+
+// Returns the scope's leaderboard, the caller has to hold pointsLock
+func getPointsBoard(scope string) *pointsBoard {
+	board, ok := pointsBoards[scope]
+
+	if !ok {
+		board = newPointsBoard()
+		pointsBoards[scope] = board
+	}
+
+	if board.Users == nil {
+		board.Users = make(map[string]*pointsUser)
+	}
+
+	// Seasons end on their own after season_days, if it's set
+	days := getConfigPropertyAsInt("points", "season_days", 0)
+
+	if days > 0 && time.Since(board.SeasonStart) > time.Duration(days) * 24 * time.Hour {
+		board.endSeason()
+	}
+
+	return board
+}
+
+// Ranks the board's users by their season points, or their totals
+func (board *pointsBoard) ranking(allTime bool) []pointsUser {
+	var users []pointsUser
+
+	for _, user := range board.Users {
+		if (allTime && user.Total > 0) || (!allTime && user.Season > 0) {
+			users = append(users, *user)
+		}
+	}
+
+	sort.Slice(users, func(a, b int) bool {
+		pa, pb := users[a].Season, users[b].Season
+		if allTime {
+			pa, pb = users[a].Total, users[b].Total
+		}
+
+		if pa != pb {
+			return pa > pb
+		}
+
+		return users[a].Name < users[b].Name
+	})
+
+	return users
+}
+
+// Ends the season, keeping its top 3 and resetting everyone's season points
+func (board *pointsBoard) endSeason() {
+	winners := board.ranking(false)
+	if len(winners) > 3 {
+		winners = winners[:3]
+	}
+
+	board.PastSeasons = append(board.PastSeasons, pastSeason{Season: board.Season, Ended: time.Now(), Winners: winners})
+
+	for _, user := range board.Users {
+		user.Season = 0
+	}
+
+	board.Season++
+	board.SeasonStart = time.Now()
+}
+
+// Gives a user points in the scope, and any reward roles the guild has for the total they've reached. Returns the
+// user's points and the IDs of the roles they were given.
+func awardPoints(s Responder, scope string, userID string, name string, points int) (pointsUser, []string) {
+	pointsLock.Lock()
+
+	board := getPointsBoard(scope)
+	user, ok := board.Users[userID]
+
+	if !ok {
+		user = &pointsUser{}
+		board.Users[userID] = user
+	}
+
+	before := user.Total
+	user.Name = name
+	user.Season += points
+	user.Total += points
+	result := *user
+
+	err := saveStore("points", pointsBoards)
+	pointsLock.Unlock()
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to save the leaderboards, " + err.Error())
+	}
+
+	// Only guilds have roles, DM scopes start with "user:"
+	if scope == globalPointsScope || strings.HasPrefix(scope, "user:") {
+		return result, nil
+	}
+
+	var granted []string
+
+	for role, threshold := range getGuildSettings(scope).RoleRewards {
+		if before >= threshold || result.Total < threshold {
+			continue
+		}
+
+		if err := s.GuildMemberRoleAdd(scope, userID, role); err != nil {
+			fmt.Println("[ERROR] Failed to give user " + userID + " reward role " + role + ", " + err.Error())
+			continue
+		}
+
+		granted = append(granted, role)
+	}
+
+	return result, granted
+}
+
+// Describes the reward roles a user was given, for adding to the message that gave them the points
+func rewardNote(granted []string) string {
+	if len(granted) == 0 {
+		return ""
+	}
+
+	if len(granted) == 1 {
+		return " You've earned a new role!"
+	}
+
+	return " You've earned " + strconv.Itoa(len(granted)) + " new roles!"
+}
+
+// Shows the guild's leaderboard, all time or for the current season, or the winners of past seasons. Server admins
+// can end the season early with "reset".
+func cmdLeaderboard(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	scope := guildScope(m)
+	sub := ""
+
+	if len(args) > 1 {
+		sub = strings.ToLower(args[1])
+	}
+
+	pointsLock.Lock()
+	defer pointsLock.Unlock()
+
+	board := getPointsBoard(scope)
+
+	switch sub {
+	case "", "all":
+		users := board.ranking(sub == "all")
+
+		if len(users) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Nobody has scored any points yet, try " + CommandPrefix + "quiz.")
+			return
+		}
+
+		out := "**Leaderboard, season " + strconv.Itoa(board.Season) + ":**\n"
+		if sub == "all" {
+			out = "**Leaderboard, all time:**\n"
+		}
+
+		for n, user := range users {
+			if n == 10 {
+				break
+			}
+
+			points := user.Season
+			if sub == "all" {
+				points = user.Total
+			}
+
+			out += strconv.Itoa(n + 1) + ". " + user.Name + " - " + strconv.Itoa(points) + " points\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, out)
+	case "seasons":
+		if len(board.PastSeasons) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "This is the first season, it started " + board.SeasonStart.UTC().Format("2006-01-02") + ".")
+			return
+		}
+
+		out := ""
+
+		for _, season := range board.PastSeasons {
+			var winners []string
+
+			for _, user := range season.Winners {
+				winners = append(winners, user.Name + " (" + strconv.Itoa(user.Season) + ")")
+			}
+
+			if len(winners) == 0 {
+				winners = append(winners, "nobody scored")
+			}
+
+			out += "Season " + strconv.Itoa(season.Season) + ", ended " + season.Ended.UTC().Format("2006-01-02") + ": " + strings.Join(winners, ", ") + "\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "```" + out + "```")
+	case "reset":
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can end the season.")
+			return
+		}
+
+		board.endSeason()
+
+		if err := saveStore("points", pointsBoards); err != nil {
+			fmt.Println("[ERROR] Failed to save the leaderboards, " + err.Error())
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Season " + strconv.Itoa(board.Season - 1) + " is over, season " + strconv.Itoa(board.Season) + " starts now!")
+	default:
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "leaderboard {all|seasons|reset}")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// A user's saved defaults for the assemble/disassemble commands
+type userPrefs struct {
+	Arch   string `json:"arch,omitempty"`
+	Syntax string `json:"syntax,omitempty"`
+	Format string `json:"format,omitempty"`
+
+	// How disassembly is sent, "text" (the default) or "image" for a rendered PNG
+	Render string `json:"render,omitempty"`
+}
+
+// Stores the preferences of every user that has set any, keyed by Discord user ID
+var (
+	prefsMap  map[string]userPrefs
+	prefsLock sync.RWMutex
+)
+
+// Loads user preferences from the data directory
+func loadPrefs() {
+	prefs := make(map[string]userPrefs)
+
+	if err := loadStore("prefs", &prefs); err != nil {
+		fmt.Println("[ERROR] Failed to load user preferences, " + err.Error())
+	}
+
+	prefsLock.Lock()
+	prefsMap = prefs
+	prefsLock.Unlock()
+}
+
+// Returns the preferences for the given user, or the defaults if they haven't set any
+func getUserPrefs(userID string) userPrefs {
+	prefsLock.RLock()
+	defer prefsLock.RUnlock()
+
+	return prefsMap[userID]
+}
+
+// Saves the preferences for the given user
+func setUserPrefs(userID string, prefs userPrefs) error {
+	prefsLock.Lock()
+	defer prefsLock.Unlock()
+
+	if prefs == (userPrefs{}) {
+		delete(prefsMap, userID)
+	} else {
+		prefsMap[userID] = prefs
+	}
+
+	return saveStore("prefs", prefsMap)
+}
+
+// Returns the options the user's preferences imply for the assembler/disassembler core
+func (p userPrefs) asmOptions() asmOptions {
+	return asmOptions{syntax: p.Syntax}
+}
+
+// Renders the preferences for display
+func (p userPrefs) String() string {
+	orDefault := func(val string) string {
+		if val == "" {
+			return "(not set)"
+		}
+
+		return val
+	}
+
+	return "arch: " + orDefault(p.Arch) + "\nsyntax: " + orDefault(p.Syntax) + "\nformat: " + orDefault(p.Format) + "\nrender: " + orDefault(p.Render)
+}
+
+// Shows or changes the user's saved defaults
+func cmdPrefs(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	prefs := getUserPrefs(m.Author.ID)
+
+	// No arguments just shows the current preferences
+	if len(args) < 2 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Your preferences: ```" + prefs.String() + "```")
+		return
+	}
+
+	key := strings.ToLower(args[1])
+	val := ""
+
+	if len(args) > 2 {
+		val = strings.ToLower(args[2])
+	}
+
+	switch key {
+	case "arch":
+		if val != "" && !isKnownArchitecture(val) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, supportedArchsKeystone))
+			return
+		}
+
+		prefs.Arch = val
+	case "syntax":
+		if val != "" && val != "intel" && val != "att" {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Syntax must be one of: intel, att")
+			return
+		}
+
+		prefs.Syntax = val
+	case "format":
+		if val != "" && !StrList(assemblyFormats).contains(val) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Format must be one of: " + strings.Join(assemblyFormats, ", "))
+			return
+		}
+
+		prefs.Format = val
+	case "render":
+		if val != "" && val != "text" && val != "image" {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Render must be one of: text, image")
+			return
+		}
+
+		prefs.Render = val
+	case "reset":
+		prefs = userPrefs{}
+	default:
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "prefs [arch|syntax|format|render|reset] {value}")
+		return
+	}
+
+	if err := setUserPrefs(m.Author.ID, prefs); err != nil {
+		fmt.Println("[ERROR] Failed to save user preferences, " + err.Error())
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save your preferences.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Preferences saved! ```" + prefs.String() + "```")
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// Most bytes !pseudo lifts, it's meant for short checks like a crackme's rather than whole functions
+const maxPseudoBytes = 256
+
+// C comparison operators for condition codes, for the operands of the compare before them. A "u" marks unsigned
+// comparisons, and the sign tests compare the result with 0.
+var conditionOperators = map[string]string{
+	// x86
+	"e": "==", "z": "==", "ne": "!=", "nz": "!=",
+	"g": ">", "nle": ">", "ge": ">=", "nl": ">=", "l": "<", "nge": "<", "le": "<=", "ng": "<=",
+	"a": "u>", "nbe": "u>", "ae": "u>=", "nb": "u>=", "nc": "u>=", "b": "u<", "nae": "u<", "c": "u<", "be": "u<=", "na": "u<=",
+	"s": "s<", "ns": "s>=",
+
+	// ARM, where it isn't the same as x86
+	"eq": "==", "gt": ">", "lt": "<", "hi": "u>", "hs": "u>=", "cs": "u>=", "lo": "u<", "cc": "u<", "ls": "u<=",
+	"mi": "s<", "pl": "s>=",
+}
+
+// x86 instructions that set the flags from their result, so a conditional branch after them compares it with 0
+var x86FlagResults = StrList{"add", "sub", "and", "or", "xor", "inc", "dec", "neg", "shl", "sal", "shr", "sar", "adc", "sbb"}
+
+// What the last instruction to set the flags compared, so the conditional instruction after it can be lifted to
+// a comparison
+type pseudoFlags struct {
+	// "cmp" compares a with b, "test" is a & b, and "result" is a (the result of arithmetic) compared with 0
+	kind string
+	a    string
+	b    string
+}
+
+// Lifts the flags and a condition code to a C condition, i.e. "eax < 5"
+func (f pseudoFlags) condition(code string, cond string) string {
+	op, ok := conditionOperators[code]
+
+	if !ok || f.kind == "" {
+		return "/* " + cond + " */"
+	}
+
+	lhs, rhs := f.a, f.b
+
+	switch f.kind {
+	case "test":
+		if f.a != f.b {
+			lhs = "(" + f.a + " & " + f.b + ")"
+		}
+
+		rhs = "0"
+	case "result":
+		rhs = "0"
+	}
+
+	// Sign tests look at whether the subtraction (or the result) is negative
+	if strings.HasPrefix(op, "s") {
+		if f.kind == "cmp" && rhs != "0" {
+			lhs = "(" + lhs + " - " + rhs + ")"
+		}
+
+		return "(int)" + lhs + " " + op[1:] + " 0"
+	}
+
+	if strings.HasPrefix(op, "u") {
+		return "(unsigned)" + lhs + " " + op[1:] + " (unsigned)" + rhs
+	}
+
+	return lhs + " " + op + " " + rhs
+}
+
+// C types for memory accesses of each size
+var pseudoTypes = map[int]string{1: "uint8_t", 2: "uint16_t", 4: "uint32_t", 8: "uint64_t", 16: "uint128_t"}
+
+// Sizes of x86 memory operands, in bytes
+var x86OperandBytes = map[string]int{"byte": 1, "word": 2, "dword": 4, "qword": 8, "xmmword": 16}
+
+// Lifts instructions to pseudocode, keeping track of what's been set up for calls and what the flags hold
+type pseudoLifter struct {
+	family string
+	cc     callingConvention
+	ins    []explainedInsn
+
+	// Addresses branched to inside the snippet, which get labels
+	labels map[uint64]bool
+
+	flags pseudoFlags
+
+	// Argument registers set since the last call or system call, by their position, with the name they were set with
+	args        map[int]string
+	syscallArgs map[int]string
+
+	// Values pushed since the last call, cdecl passes arguments this way
+	pushed []string
+
+	// Name of the last register the return value was put in, "" if nothing has been
+	ret string
+}
+
+// Names the label of an address inside the snippet
+func pseudoLabel(address uint64) string {
+	return "loc_" + strconv.FormatUint(address, 16)
+}
+
+// Parses a branch or call target, Capstone writes them as immediates
+func branchTarget(op asmOperand) (uint64, bool) {
+	if op.reg != "" || op.mem != "" {
+		return 0, false
+	}
+
+	target, err := strconv.ParseUint(strings.TrimPrefix(op.text, "#"), 0, 64)
+	return target, err == nil
+}
+
+// Lifts an operand to a C expression: registers as they are, locals and stack arguments as variables, and other
+// memory as a dereference
+func (l *pseudoLifter) expr(e explainedInsn, n int) string {
+	if n >= len(e.ops) {
+		return "?"
+	}
+
+	op := e.ops[n]
+
+	switch {
+	case op.list != nil:
+		return strings.Join(op.list, ", ")
+	case op.mem != "":
+		return l.memory(e, op, l.accessBytes(e, op))
+	case op.reg != "":
+		if op.shift != "" {
+			return shiftExpression(op.reg, op.shift)
+		}
+
+		return op.reg
+	}
+
+	value := strings.TrimPrefix(op.text, "#")
+
+	if op.shift != "" {
+		return shiftExpression(value, op.shift)
+	}
+
+	return value
+}
+
+// Works out how many bytes a memory operand accesses
+func (l *pseudoLifter) accessBytes(e explainedInsn, op asmOperand) int {
+	if l.family == "x86" {
+		return x86OperandBytes[op.size]
+	}
+
+	return armAccessBytes(e.access, false, e.ops[0].reg)
+}
+
+// Lifts a memory operand of the given size to a C expression
+func (l *pseudoLifter) memory(e explainedInsn, op asmOperand, size int) string {
+	fields := strings.Fields(op.mem)
+	offset := ""
+
+	if len(fields) == 3 {
+		offset = strings.TrimPrefix(fields[2], "0x")
+	}
+
+	switch {
+	case isStackCanary(op):
+		return "__stack_chk_guard"
+	case len(fields) == 3 && sameRegister(l.family, fields[0], l.cc.fp) && fields[1] == "-":
+		return "local_" + offset
+	case len(fields) == 3 && sameRegister(l.family, fields[0], l.cc.fp) && fields[1] == "+" && l.cc.stackArgs:
+		return "arg_" + offset
+	}
+
+	ctype, ok := pseudoTypes[size]
+	if !ok {
+		ctype = "void"
+	}
+
+	address := op.mem
+
+	if target, ok := ripTarget(e, op); ok {
+		return "*(" + ctype + " *)0x" + strconv.FormatUint(target, 16)
+	}
+
+	if op.segment != "" {
+		address = op.segment + ":" + address
+	}
+
+	if len(fields) > 1 || op.segment != "" {
+		address = "(" + address + ")"
+	}
+
+	return "*(" + ctype + " *)" + address
+}
+
+// Works out the address a rip relative memory operand refers to, they're relative to the end of the instruction
+func ripTarget(e explainedInsn, op asmOperand) (uint64, bool) {
+	fields := strings.Fields(op.mem)
+
+	if len(fields) != 3 || fields[0] != "rip" {
+		return 0, false
+	}
+
+	disp, err := strconv.ParseInt(fields[1] + fields[2], 0, 64)
+	return e.Address + uint64(len(e.Bytes)) + uint64(disp), err == nil
+}
+
+// Lifts a branch target, to a label when it's inside the snippet
+func (l *pseudoLifter) target(e explainedInsn, n int) string {
+	if n >= len(e.ops) {
+		return "?"
+	}
+
+	if target, ok := branchTarget(e.ops[n]); ok && l.labels[target] {
+		return pseudoLabel(target)
+	}
+
+	if e.ops[n].reg != "" {
+		return "*" + e.ops[n].reg
+	}
+
+	return l.expr(e, n)
+}
+
+// Lifts a call, with the arguments that were set up for it
+func (l *pseudoLifter) call(e explainedInsn) string {
+	var args []string
+
+	if l.cc.stackArgs {
+		// The last push is the 1st argument
+		for n := len(l.pushed) - 1; n >= 0; n-- {
+			args = append(args, l.pushed[n])
+		}
+	} else {
+		for n := range l.cc.args {
+			name, ok := l.args[n]
+
+			if !ok {
+				break
+			}
+
+			args = append(args, name)
+		}
+	}
+
+	function := l.expr(e, 0)
+
+	if len(e.ops) == 0 {
+		function = "?"
+	} else if target, ok := branchTarget(e.ops[0]); ok {
+		function = "sub_" + strconv.FormatUint(target, 16)
+	} else if e.ops[0].reg != "" {
+		function = "(*" + function + ")"
+	} else if e.ops[0].mem != "" {
+		function = "(" + function + ")"
+	}
+
+	l.args = make(map[int]string)
+	l.syscallArgs = make(map[int]string)
+	l.pushed = nil
+	l.ret = l.cc.ret
+	l.flags = pseudoFlags{}
+
+	if l.cc.ret == "" {
+		return function + "(" + strings.Join(args, ", ") + ");"
+	}
+
+	return l.cc.ret + " = " + function + "(" + strings.Join(args, ", ") + ");"
+}
+
+// Lifts a system call, with the number and arguments that were set up for it
+func (l *pseudoLifter) syscall() string {
+	args := []string{l.cc.syscallNum}
+
+	for n := range l.cc.syscallArgs {
+		name, ok := l.syscallArgs[n]
+
+		if !ok {
+			break
+		}
+
+		args = append(args, name)
+	}
+
+	l.args = make(map[int]string)
+	l.syscallArgs = make(map[int]string)
+	l.ret = l.cc.syscallNum
+
+	return l.cc.syscallNum + " = syscall(" + strings.Join(args, ", ") + ");"
+}
+
+// Notes that the instruction set a register, for the arguments of the next call and the return value
+func (l *pseudoLifter) wrote(reg string) {
+	if reg == "" {
+		return
+	}
+
+	if n := registerIndex(l.family, l.cc.args, reg); n >= 0 {
+		l.args[n] = reg
+	}
+
+	if n := registerIndex(l.family, l.cc.syscallArgs, reg); n >= 0 {
+		l.syscallArgs[n] = reg
+	}
+
+	if sameRegister(l.family, reg, l.cc.ret) {
+		l.ret = reg
+	}
+}
+
+// Lifts an instruction to a statement, "" for instructions that are left out. Instructions it doesn't know are
+// kept as a comment.
+func (l *pseudoLifter) lift(e explainedInsn) string {
+	// The stack frame's setup and teardown aren't part of what the code does
+	if e.frameSetup(l.family, l.cc) || e.base == "nop" {
+		return ""
+	}
+
+	a, b, c := l.expr(e, 0), l.expr(e, 1), l.expr(e, 2)
+	dest := e.writes()
+	stmt := ""
+
+	// Flag setting compares first, the conditional instructions after them use what they compared
+	switch e.base {
+	case "cmp":
+		l.flags = pseudoFlags{"cmp", a, b}
+		return ""
+	case "cmn":
+		l.flags = pseudoFlags{"cmp", a, "-" + b}
+		return ""
+	case "test", "tst":
+		l.flags = pseudoFlags{"test", a, b}
+		return ""
+	}
+
+	switch {
+	case e.syscall:
+		if e.base == "int" && l.cc.syscallNum == "" {
+			return "interrupt(" + a + ");"
+		}
+
+		return l.syscall()
+	case e.call:
+		return l.call(e)
+	case e.ret:
+		if l.ret == "" {
+			return "return;"
+		}
+
+		return "return " + l.ret + ";"
+	case e.base == "jcc" || e.base == "b" && e.condCode != "":
+		return "if (" + l.flags.condition(e.condCode, e.cond) + ") goto " + l.target(e, 0) + ";"
+	case e.base == "jmp" || e.base == "b" || e.base == "br" || e.base == "bx":
+		return "goto " + l.target(e, 0) + ";"
+	case e.base == "cbz" || e.base == "cbnz":
+		op := map[string]string{"cbz": "==", "cbnz": "!="}[e.base]
+		return "if (" + a + " " + op + " 0) goto " + l.target(e, 1) + ";"
+	case e.base == "tbz" || e.base == "tbnz":
+		op := map[string]string{"tbz": "!", "tbnz": ""}[e.base]
+		return "if (" + op + "(" + a + " & (1 << " + b + "))) goto " + l.target(e, 2) + ";"
+	case e.base == "push":
+		l.pushed = append(l.pushed, a)
+		return ""
+	}
+
+	switch e.base {
+	case "mov", "movabs", "movzx", "movsx", "movsxd", "movz", "movw", "sxtw", "sxtb", "sxth", "uxtb", "uxth", "uxtw", "ldr", "adr", "adrp":
+		stmt = a + " = " + b + ";"
+
+		// ldr r0, [r1], #4 loads then moves the base register on
+		if e.base == "ldr" && len(e.ops) == 3 {
+			stmt += " " + strings.Fields(e.ops[1].mem)[0] + " += " + c + ";"
+		}
+	case "str":
+		stmt = b + " = " + a + ";"
+
+		if len(e.ops) == 3 {
+			stmt += " " + strings.Fields(e.ops[1].mem)[0] + " += " + c + ";"
+		}
+	case "ldp", "stp":
+		if len(e.ops) < 3 {
+			break
+		}
+
+		size := l.accessBytes(e, e.ops[2])
+		first := l.memory(e, e.ops[2], size)
+		second := l.memory(e, asmOperand{mem: e.ops[2].mem + " + " + strconv.Itoa(size)}, size)
+
+		if e.base == "ldp" {
+			stmt = a + " = " + first + "; " + b + " = " + second + ";"
+		} else {
+			stmt = first + " = " + a + "; " + second + " = " + b + ";"
+		}
+	case "lea":
+		stmt = a + " = &" + b + ";"
+
+		if target, ok := ripTarget(e, e.ops[1]); ok {
+			stmt = a + " = 0x" + strconv.FormatUint(target, 16) + ";"
+		} else if !strings.HasPrefix(b, "local_") && !strings.HasPrefix(b, "arg_") {
+			stmt = a + " = " + e.ops[1].mem + ";"
+		}
+	case "mvn", "not":
+		stmt = a + " = ~" + map[bool]string{true: b, false: a}[len(e.ops) > 1 && e.base == "mvn"] + ";"
+	case "neg":
+		stmt = a + " = -" + map[bool]string{true: b, false: a}[len(e.ops) > 1] + ";"
+	case "inc":
+		stmt = a + "++;"
+	case "dec":
+		stmt = a + "--;"
+	case "movk":
+		shift := "0"
+
+		if fields := strings.Fields(e.ops[1].shift); len(fields) > 1 {
+			shift = strings.TrimPrefix(fields[1], "#")
+		}
+
+		stmt = a + " = (" + a + " & ~(0xffff << " + shift + ")) | " + b + ";"
+	case "movt":
+		stmt = a + " = (" + a + " & 0xffff) | (" + b + " << 16);"
+	case "xchg":
+		stmt = "swap(" + a + ", " + b + ");"
+	case "div", "idiv":
+		acc := map[bool]string{true: "rax", false: "eax"}[strings.HasPrefix(a, "r") || strings.Contains(a, "uint64_t")]
+		rem := map[string]string{"rax": "rdx", "eax": "edx"}[acc]
+		stmt = rem + " = " + acc + " % " + a + "; " + acc + " = " + acc + " / " + a + ";"
+	case "setcc", "cset":
+		cond := e.condCode
+		if e.base == "cset" && len(e.ops) > 1 {
+			cond = e.ops[1].text
+		}
+
+		stmt = a + " = " + l.flags.condition(cond, armConditions[cond] + x86Conditions[cond]) + ";"
+	case "cmovcc":
+		stmt = "if (" + l.flags.condition(e.condCode, e.cond) + ") " + a + " = " + b + ";"
+	case "csel", "csinc", "csneg", "cinc":
+		if len(e.ops) < 3 {
+			break
+		}
+
+		code := e.ops[len(e.ops) - 1].text
+		cond := l.flags.condition(code, armConditions[code])
+
+		switch e.base {
+		case "csel":
+			stmt = a + " = " + cond + " ? " + b + " : " + c + ";"
+		case "csinc":
+			stmt = a + " = " + cond + " ? " + b + " : " + c + " + 1;"
+		case "csneg":
+			stmt = a + " = " + cond + " ? " + b + " : -" + c + ";"
+		case "cinc":
+			stmt = a + " = " + cond + " ? " + b + " + 1 : " + b + ";"
+		}
+	}
+
+	if stmt == "" {
+		stmt = l.arithmetic(e, a, b, c)
+	}
+
+	if stmt == "" {
+		return "// " + e.Mnemonic + " " + e.OpStr
+	}
+
+	// Conditional ARM instructions, like moveq
+	if e.condCode != "" && e.base != "setcc" && e.base != "cmovcc" {
+		stmt = "if (" + l.flags.condition(e.condCode, e.cond) + ") " + stmt
+	}
+
+	if e.setsFlags || l.family == "x86" && x86FlagResults.contains(e.base) {
+		l.flags = pseudoFlags{"result", a, ""}
+	}
+
+	l.wrote(dest)
+	return stmt
+}
+
+// C operators for arithmetic instructions
+var pseudoOperators = map[string]string{
+	"add": "+", "adc": "+", "sub": "-", "sbb": "-", "imul": "*", "mul": "*", "and": "&", "or": "|", "orr": "|",
+	"xor": "^", "eor": "^", "shl": "<<", "sal": "<<", "lsl": "<<", "shr": ">>", "sar": ">>", "lsr": ">>", "asr": ">>",
+	"sdiv": "/", "udiv": "/",
+}
+
+// Lifts arithmetic, in x86's two operand form (eax += 1) and ARM's three operand one (r0 = r1 + 1)
+func (l *pseudoLifter) arithmetic(e explainedInsn, a string, b string, c string) string {
+	ops := len(e.ops)
+
+	if e.zeroes() {
+		return a + " = 0;"
+	}
+
+	switch e.base {
+	case "madd", "mla":
+		return a + " = " + b + " * " + c + " + " + l.expr(e, 3) + ";"
+	case "msub", "mls":
+		return a + " = " + l.expr(e, 3) + " - " + b + " * " + c + ";"
+	case "rsb":
+		return a + " = " + c + " - " + b + ";"
+	case "bic":
+		return a + " = " + b + " & ~" + c + ";"
+	}
+
+	op, ok := pseudoOperators[e.base]
+
+	switch {
+	case !ok:
+		return ""
+	case ops == 2:
+		return a + " " + op + "= " + b + ";"
+	case ops == 3:
+		return a + " = " + b + " " + op + " " + c + ";"
+	}
+
+	return ""
+}
+
+// Lifts instructions to C-like pseudocode, a statement per line with labels for the branches inside the snippet
+func liftPseudocode(arch string, ins []asm.Insn) string {
+	l := pseudoLifter{family: instructionFamily(arch), ins: explainInstructions(arch, ins), labels: make(map[uint64]bool),
+		args: make(map[int]string), syscallArgs: make(map[int]string)}
+	l.cc = detectCallingConvention(arch, l.ins)
+
+	addresses := make(map[uint64]bool)
+
+	for _, e := range l.ins {
+		addresses[e.Address] = true
+	}
+
+	for _, e := range l.ins {
+		if !e.jump || len(e.ops) == 0 {
+			continue
+		}
+
+		if target, ok := branchTarget(e.ops[len(e.ops) - 1]); ok && addresses[target] {
+			l.labels[target] = true
+		}
+	}
+
+	out := ""
+
+	for _, e := range l.ins {
+		// Code can branch here, so whatever the flags held before could be from anywhere
+		if l.labels[e.Address] {
+			out += pseudoLabel(e.Address) + ":\n"
+			l.flags = pseudoFlags{}
+		}
+
+		if stmt := l.lift(e); stmt != "" {
+			out += "    " + stmt + "\n"
+		}
+	}
+
+	return out
+}
+
+// Lifts a short snippet of opcodes to C-like pseudocode
+func cmdPseudo(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+
+	if instructionFamily(asmArch) == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, explainArchs))
+		return
+	}
+
+	code, err := parseOpcodes(strings.Join(rest, ""))
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, explainArchs))
+		return
+	}
+
+	if !checkLimit(s, m.ChannelID, "bytes for pseudocode", len(code), maxPseudoBytes) {
+		return
+	}
+
+	ins, err := disassemble(asmArch, code, asmOptions{detail: true})
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, explainArchs))
+		return
+	}
+
+	out := liftPseudocode(asmArch, ins)
+
+	if stop := disassemblyStopNote(ins, code); stop != "" {
+		out += "    // " + strings.TrimPrefix(stop, "; ")
+	}
+
+	sendListing(s, m.ChannelID, "Pseudocode, lifted instruction by instruction (it's not a decompiler, check it against the disassembly):", "pseudo.c", out)
+}
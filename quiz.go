@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// How long users have to answer a quiz before the answer is revealed
+const quizTimeout = 60 * time.Second
+
+// Answers longer than this aren't instructions, so they aren't assembled
+const maxQuizAnswerLength = 100
+
+// Difficulty tiers, in the order they're listed, with the points a right answer is worth
+var quizTiers = []string{"easy", "medium", "hard"}
+
+// Instruction templates for each architecture and tier. Placeholders in angle brackets are filled in with random
+// registers and immediates (see quizPlaceholders), so the same template can give many questions.
+var quizTemplates = map[string]map[string][]string{
+	"x64": {
+		"easy": {"nop", "ret", "push <r64>", "pop <r64>", "mov <r64>, <r64>", "xor <r32>, <r32>", "inc <r32>",
+			"dec <r64>", "int3", "syscall", "leave", "cdq"},
+		"medium": {"mov <r32>, <imm32>", "add <r64>, <imm8>", "sub rsp, <imm8>", "lea <r64>, [<r64> + <imm8>]",
+			"cmp <r32>, <imm8>", "test <r32>, <r32>", "mov <r64>, qword ptr [<r64>]", "shl <r32>, <shift>",
+			"imul <r32>, <r32>", "call qword ptr [<r64>]", "movsxd <r64>, <r32>"},
+		"hard": {"movzx <r32>, byte ptr [<r64> + <idx64>*<scale> + <imm8>]", "cmovne <r64>, <r64>",
+			"lock cmpxchg qword ptr [<r64>], <r64>", "bt <r32>, <shift>", "pxor xmm<xmm>, xmm<xmm>",
+			"movaps xmm<xmm>, xmmword ptr [<r64>]", "rep movsb", "mov <r32>, dword ptr [rip + <imm32>]",
+			"imul <r64>, <r64>, <imm8>", "xchg <r64>, <r64>"},
+	},
+	"x86": {
+		"easy": {"nop", "ret", "push <r32>", "pop <r32>", "mov <r32>, <r32>", "xor <r32>, <r32>", "inc <r32>",
+			"dec <r32>", "int3", "leave", "cdq", "pushad"},
+		"medium": {"mov <r32>, <imm32>", "add <r32>, <imm8>", "sub esp, <imm8>", "lea <r32>, [<r32> + <imm8>]",
+			"cmp <r32>, <imm8>", "test <r32>, <r32>", "mov <r32>, dword ptr [<r32>]", "shl <r32>, <shift>",
+			"int 0x80", "call dword ptr [<r32>]"},
+		"hard": {"movzx <r32>, byte ptr [<r32> + <idx32>*<scale> + <imm8>]", "cmovne <r32>, <r32>",
+			"lock cmpxchg dword ptr [<r32>], <r32>", "bt <r32>, <shift>", "pxor xmm<xmm>, xmm<xmm>",
+			"rep stosd", "imul <r32>, <r32>, <imm8>", "xchg <r32>, <r32>", "mov <r32>, dword ptr fs:[0x30]"},
+	},
+	"arm": {
+		"easy": {"nop", "bx lr", "mov <ar>, <ar>", "add <ar>, <ar>, <ar>", "sub <ar>, <ar>, #<imm8>"},
+		"medium": {"ldr <ar>, [<ar>, #<off4>]", "str <ar>, [<ar>]", "push {<ar>, lr}", "cmp <ar>, #<imm8>",
+			"mov <ar>, #<imm8>", "lsl <ar>, <ar>, #<shift>", "pop {<ar>, pc}"},
+		"hard": {"ldr <ar>, [<ar>, <ar>, lsl #2]", "mla <ar>, <ar>, <ar>, <ar>", "ldrb <ar>, [<ar>, #<imm8>]!",
+			"movw <ar>, #<imm16>", "addeq <ar>, <ar>, <ar>", "eor <ar>, <ar>, <ar>, ror #<shift>"},
+	},
+	"thumb": {
+		"easy": {"nop", "bx lr", "movs <tr>, <tr>", "adds <tr>, <tr>, <tr>", "subs <tr>, <tr>, <tr>"},
+		"medium": {"ldr <tr>, [<tr>, #<off4>]", "str <tr>, [<tr>]", "push {<tr>, lr}", "movs <tr>, #<imm8>",
+			"cmp <tr>, #<imm8>", "pop {<tr>, pc}"},
+		"hard": {"lsls <tr>, <tr>, #<shift>", "muls <tr>, <tr>, <tr>", "ldrb <tr>, [<tr>, <tr>]", "uxtb <tr>, <tr>",
+			"rev <tr>, <tr>", "ldr.w <ar>, [<ar>, #<off4>]"},
+	},
+	"arm64": {
+		"easy": {"nop", "ret", "mov <xr>, <xr>", "add <xr>, <xr>, <xr>", "sub <wr>, <wr>, <wr>"},
+		"medium": {"ldr <xr>, [<xr>, #<off8>]", "stp x29, x30, [sp, #-16]!", "cmp <wr>, #<imm8>",
+			"mov <wr>, #<imm8>", "str <wr>, [<xr>]", "ldp x29, x30, [sp], #16"},
+		"hard": {"csel <xr>, <xr>, <xr>, eq", "ubfx <wr>, <wr>, #<shift>, #4", "madd <xr>, <xr>, <xr>, <xr>",
+			"ldr <xr>, [<xr>, <xr>, lsl #3]", "cbz <wr>, #0x40", "eor <xr>, <xr>, <xr>, lsr #<shift>"},
+	},
+}
+
+// Other names for the quiz architectures
+var quizArchAliases = map[string]string{"x86_64": "x64", "x86-64": "x64", "aarch64": "arm64"}
+
+// Values placeholders in the quiz templates are filled in with
+var quizPlaceholders = map[string]func() string{
+	"<r64>":   randomChoice("rax", "rbx", "rcx", "rdx", "rsi", "rdi", "rbp", "r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15"),
+	"<idx64>": randomChoice("rax", "rbx", "rcx", "rdx", "rsi", "rdi", "r8", "r9", "r10", "r11"),
+	"<r32>":   randomChoice("eax", "ebx", "ecx", "edx", "esi", "edi"),
+	"<idx32>": randomChoice("eax", "ebx", "ecx", "edx", "esi", "edi"),
+	"<ar>":    randomChoice("r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10", "r11", "r12"),
+	"<tr>":    randomChoice("r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7"),
+	"<xr>":    func() string { return "x" + strconv.Itoa(randomIntn(29)) },
+	"<wr>":    func() string { return "w" + strconv.Itoa(randomIntn(29)) },
+	"<xmm>":   func() string { return strconv.Itoa(randomIntn(8)) },
+	"<scale>": randomChoice("2", "4", "8"),
+	"<shift>": func() string { return strconv.Itoa(randomIntn(30) + 1) },
+	"<imm8>":  func() string { return fmt.Sprintf("0x%x", randomIntn(0x7e) + 1) },
+	"<imm16>": func() string { return fmt.Sprintf("0x%x", randomIntn(0xff00) + 0x100) },
+	"<imm32>": func() string { return fmt.Sprintf("0x%x", randomIntn(0xfff000) + 0x1000) },
+	"<off4>":  func() string { return fmt.Sprintf("0x%x", (randomIntn(31) + 1) * 4) },
+	"<off8>":  func() string { return fmt.Sprintf("0x%x", (randomIntn(63) + 1) * 8) },
+}
+
+// Matches a placeholder in a quiz template
+var quizPlaceholderRegexp = regexp.MustCompile(`<[a-z0-9]+>`)
+
+// A quiz waiting for an answer in a channel
+type quiz struct {
+	Arch   string
+	Tier   string
+	Answer string
+	Bytes  []byte
+	Scope  string
+}
+
+var (
+	// Quizzes in progress, keyed by channel ID
+	activeQuizzes = make(map[string]*quiz)
+
+	quizLock sync.Mutex
+)
+
+// Returns a function that picks one of the given values at random
+func randomChoice(values ...string) func() string {
+	return func() string {
+		return values[randomIntn(len(values))]
+	}
+}
+
+// Points a right answer in the tier is worth
+func quizPoints(tier string) int {
+	for n, name := range quizTiers {
+		if name == tier {
+			return n + 1
+		}
+	}
+
+	return 1
+}
+
+// Picks a random instruction for the architecture and tier and assembles it. Templates that happen to give an
+// instruction the assembler rejects (i.e. a register it doesn't allow there) are retried.
+func newQuiz(arch string, tier string) (*quiz, error) {
+	templates := quizTemplates[arch][tier]
+
+	for attempt := 0; attempt < 10; attempt++ {
+		instruction := quizPlaceholderRegexp.ReplaceAllStringFunc(templates[randomIntn(len(templates))], func(placeholder string) string {
+			return quizPlaceholders[placeholder]()
+		})
+
+		ins, err := asm.Assemble(arch, instruction)
+
+		if err != nil || len(ins) != 1 || len(ins[0].Bytes) == 0 {
+			continue
+		}
+
+		return &quiz{Arch: arch, Tier: tier, Answer: instruction, Bytes: ins[0].Bytes}, nil
+	}
+
+	return nil, fmt.Errorf("couldn't make a %s %s question", tier, arch)
+}
+
+// Normalizes an instruction for comparing answers that don't assemble, i.e. on architectures the assembler can't
+// check them for
+func normalizeInstruction(instruction string) string {
+	instruction = strings.ToLower(strings.Join(strings.Fields(instruction), " "))
+	instruction = strings.Replace(instruction, ", ", ",", -1)
+
+	return strings.Trim(instruction, "`")
+}
+
+// Checks a message in a channel with a quiz in progress, scoring the author if it's the right instruction. Returns
+// true if the message answered the quiz.
+func checkQuizAnswer(s Responder, m *discordgo.MessageCreate) bool {
+	quizLock.Lock()
+	q, ok := activeQuizzes[m.ChannelID]
+	quizLock.Unlock()
+
+	answer := strings.Trim(strings.TrimSpace(m.Content), "`")
+
+	if !ok || len(answer) > maxQuizAnswerLength || userBlocked(m.Author.ID, m.GuildID) {
+		return false
+	}
+
+	// Any instruction that assembles to the same bytes is right, so i.e. AT&T syntax or a different immediate format
+	// counts too
+	correct := normalizeInstruction(answer) == normalizeInstruction(q.Answer)
+
+	if !correct {
+		ins, err := asm.Assemble(q.Arch, answer, getUserPrefs(m.Author.ID).asmOptions().options()...)
+		correct = err == nil && len(ins) == 1 && bytes.Equal(ins[0].Bytes, q.Bytes)
+	}
+
+	if !correct {
+		return false
+	}
+
+	quizLock.Lock()
+
+	// Someone else could have answered while this answer was being assembled
+	if activeQuizzes[m.ChannelID] != q {
+		quizLock.Unlock()
+		return false
+	}
+
+	delete(activeQuizzes, m.ChannelID)
+	quizLock.Unlock()
+
+	points := quizPoints(q.Tier)
+	user, granted := awardPoints(s, q.Scope, m.Author.ID, m.Author.Username, points)
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Correct, <@" + m.Author.ID + ">! It's `" + q.Answer + "`. +" +
+		strconv.Itoa(points) + " points, you have " + strconv.Itoa(user.Season) + " this season." + rewardNote(granted))
+
+	return true
+}
+
+// Posts an instruction's bytes for users to identify, or shows the leaderboard or stops the quiz in progress
+func cmdQuiz(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	arch := getUserPrefs(m.Author.ID).Arch
+	tier := quizTiers[0]
+
+	for _, arg := range args[1:] {
+		arg = strings.ToLower(arg)
+
+		if alias, ok := quizArchAliases[arg]; ok {
+			arg = alias
+		}
+
+		switch {
+		case arg == "scores" || arg == "scoreboard":
+			cmdLeaderboard(cmdArguments{s, m, []string{"leaderboard"}})
+			return
+		case arg == "stop" || arg == "skip":
+			quizLock.Lock()
+			q, ok := activeQuizzes[m.ChannelID]
+			delete(activeQuizzes, m.ChannelID)
+			quizLock.Unlock()
+
+			if !ok {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "There's no quiz in progress here.")
+			} else {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "Skipped, it was `" + q.Answer + "`.")
+			}
+
+			return
+		case StrList(quizTiers).contains(arg):
+			tier = arg
+		case quizTemplates[arg] != nil:
+			arch = arg
+		default:
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "quiz {x86|x64|arm|thumb|arm64} {" +
+				strings.Join(quizTiers, "|") + "}, or " + CommandPrefix + "quiz scores")
+			return
+		}
+	}
+
+	if alias, ok := quizArchAliases[arch]; ok {
+		arch = alias
+	}
+
+	if quizTemplates[arch] == nil {
+		arch = "x64"
+	}
+
+	quizLock.Lock()
+	_, running := activeQuizzes[m.ChannelID]
+	quizLock.Unlock()
+
+	if running {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "There's already a quiz in progress here, answer it or skip it with " + CommandPrefix + "quiz skip.")
+		return
+	}
+
+	q, err := newQuiz(arch, tier)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	q.Scope = guildScope(m)
+
+	quizLock.Lock()
+	activeQuizzes[m.ChannelID] = q
+	quizLock.Unlock()
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("**Quiz (%s, %s, %d points):** what %s instruction is `%s`? First to reply with it wins, you have %d seconds.",
+		arch, tier, quizPoints(tier), arch, strings.TrimSpace(formatOpcodes(q.Bytes)), int(quizTimeout.Seconds())))
+
+	channelID := m.ChannelID
+	time.AfterFunc(quizTimeout, func() {
+		quizLock.Lock()
+		expired := activeQuizzes[channelID] == q
+		if expired {
+			delete(activeQuizzes, channelID)
+		}
+		quizLock.Unlock()
+
+		if expired {
+			_, _ = s.ChannelMessageSend(channelID, "Time's up! It was `" + q.Answer + "`.")
+		}
+	})
+}
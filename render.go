@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Colours of a rendered listing, a dark theme close to Discord's
+var (
+	renderBackground = color.RGBA{0x2b, 0x2d, 0x31, 0xff}
+	renderText       = color.RGBA{0xdb, 0xde, 0xe1, 0xff}
+	renderMnemonic   = color.RGBA{0x7a, 0xb8, 0xff, 0xff}
+	renderBytes      = color.RGBA{0xf0, 0xa4, 0x5e, 0xff}
+	renderComment    = color.RGBA{0x8a, 0x8f, 0x98, 0xff}
+)
+
+// How much a listing is scaled up by, the font is small for the phones the images are for
+const renderScale = 2
+
+// Padding around a rendered listing, in unscaled pixels
+const renderPadding = 8
+
+// A piece of a listing line drawn in one colour
+type renderSpan struct {
+	text   string
+	colour color.RGBA
+}
+
+// Splits a disassembly line into coloured spans: the mnemonic, its operands, the "; +offset = bytes" column with
+// the bytes picked out, then any notes. Lines that are only a comment are drawn as one.
+func renderSpans(line string) []renderSpan {
+	if strings.HasPrefix(strings.TrimSpace(line), ";") {
+		return []renderSpan{{line, renderComment}}
+	}
+
+	column := strings.Index(line, "; +")
+
+	if column < 0 {
+		return []renderSpan{{line, renderText}}
+	}
+
+	code, rest := line[:column], line[column:]
+	mnemonic := strings.IndexByte(code, ' ')
+
+	if mnemonic < 0 {
+		mnemonic = len(code)
+	}
+
+	spans := []renderSpan{{code[:mnemonic], renderMnemonic}, {code[mnemonic:], renderText}}
+
+	notes := ""
+
+	if end := strings.Index(rest[1:], "; "); end >= 0 {
+		rest, notes = rest[:end + 1], rest[end + 1:]
+	}
+
+	if equals := strings.Index(rest, "= "); equals >= 0 {
+		spans = append(spans, renderSpan{rest[:equals + 2], renderComment}, renderSpan{rest[equals + 2:], renderBytes})
+	} else {
+		spans = append(spans, renderSpan{rest, renderComment})
+	}
+
+	return append(spans, renderSpan{notes, renderComment})
+}
+
+// Renders a disassembly listing as a PNG in a fixed width font, so its columns stay lined up on clients that show
+// code blocks in a proportional font
+func renderListing(listing string) ([]byte, error) {
+	face := basicfont.Face7x13
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(listing, "\t", "    "), "\n"), "\n")
+	width := 0
+
+	for _, line := range lines {
+		if len(line) > width {
+			width = len(line)
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width * face.Advance + 2 * renderPadding, len(lines) * face.Height + 2 * renderPadding))
+	draw.Draw(img, img.Bounds(), image.NewUniform(renderBackground), image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: img, Face: face}
+
+	for n, line := range lines {
+		drawer.Dot = fixed.P(renderPadding, renderPadding + n * face.Height + face.Ascent)
+
+		for _, span := range renderSpans(line) {
+			drawer.Src = image.NewUniform(span.colour)
+			drawer.DrawString(span.text)
+		}
+	}
+
+	// Scaled up by repeating pixels, smoothing would blur the font
+	bounds := img.Bounds()
+	scaled := image.NewRGBA(image.Rect(0, 0, bounds.Dx() * renderScale, bounds.Dy() * renderScale))
+
+	for y := 0; y < scaled.Bounds().Dy(); y++ {
+		for x := 0; x < scaled.Bounds().Dx(); x++ {
+			scaled.SetRGBA(x, y, img.RGBAAt(x / renderScale, y / renderScale))
+		}
+	}
+
+	var out bytes.Buffer
+
+	if err := png.Encode(&out, scaled); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Commands that can take their input from the message they're a reply to, i.e. "!disassemble x64" answering a
+// message of pasted bytes, or "!triage" answering an uploaded binary
+var replyInputCommands = StrList{
+	"assemble", "disassemble", "disas-modes", "explain", "pseudo", "stackframe", "encoding", "sctest", "strace",
+	"alphaenc", "seccomp", "objdump", "funcs", "xref", "hexdump", "scan", "yaragen", "fuzzyhash", "peres", "reloc",
+	"dynamic", "deps", "triage", "ret2dlresolve",
+}
+
+// Fills in a command's input from the message it replies to. When the command was given without its input, the
+// replied to message's text is added to the arguments, and its attachments are used if the command has none of its
+// own. Anything else is returned as it was.
+func replyInput(m *discordgo.MessageCreate, command Command, args []string) (*discordgo.MessageCreate, []string) {
+	ref := m.ReferencedMessage
+
+	if ref == nil || !replyInputCommands.contains(command.name) {
+		return m, args
+	}
+
+	// Input given with the command wins, a reply isn't always about the message's contents
+	if len(args) >= requiredArgCount(m.Author.ID, command, args) && len(args) > 1 || len(m.Attachments) > 0 {
+		return m, args
+	}
+
+	if len(ref.Attachments) > 0 {
+		msg := *m.Message
+		msg.Attachments = ref.Attachments
+
+		return &discordgo.MessageCreate{Message: &msg}, args
+	}
+
+	content := strings.TrimSpace(ref.Content)
+
+	if content == "" {
+		return m, args
+	}
+
+	return m, append(args, splitCommandArgs(content)...)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The bytes behind a disassembly with re-render buttons, so a button can disassemble them again in another mode.
+// Keyed by the token in the buttons' custom IDs.
+type rerenderState struct {
+	opcodes []byte
+	prefs   userPrefs
+	scope   string
+	expires time.Time
+}
+
+var (
+	rerenderStates     = make(map[string]rerenderState)
+	rerenderStatesLock sync.Mutex
+)
+
+// How long a disassembly's buttons keep working
+const rerenderTTL = time.Hour
+
+// The other width of an architecture, for the 32/64-bit button
+var rerenderWidths = map[string]string{
+	"x86": "x86_64", "x86_64": "x86", "arm": "arm64", "arm64": "arm", "ppc": "ppc64", "ppc64": "ppc", "mips": "mips64",
+	"mips64": "mips", "mipsel": "mips64el", "mips64el": "mipsel", "ppc32le": "ppc64le", "ppc64le": "ppc32le",
+	"riscv32": "riscv64", "riscv64": "riscv32", "rv32g": "rv64g", "rv64g": "rv32g",
+}
+
+// The other instruction set of an ARM core, for the ARM/Thumb button, or a RISC-V core with or without the C extension
+var rerenderModes = map[string]string{"arm": "thumb", "thumb": "arm", "riscv32": "rv32g", "rv32g": "riscv32", "riscv64": "rv64g", "rv64g": "riscv64"}
+
+// Remembers the bytes of a disassembly for its buttons, returning the token the buttons carry
+func storeRerender(opcodes []byte, prefs userPrefs, scope string) string {
+	token := make([]byte, 8)
+	_, _ = rand.Read(token)
+
+	rerenderStatesLock.Lock()
+	defer rerenderStatesLock.Unlock()
+
+	now := time.Now()
+
+	for key, state := range rerenderStates {
+		if now.After(state.expires) {
+			delete(rerenderStates, key)
+		}
+	}
+
+	key := hex.EncodeToString(token)
+	rerenderStates[key] = rerenderState{opcodes, prefs, scope, now.Add(rerenderTTL)}
+
+	return key
+}
+
+// The buttons under a disassembly in the architecture, one for each mode it can be switched to
+func rerenderButtons(token string, arch string) []discordgo.MessageComponent {
+	var buttons []discordgo.MessageComponent
+
+	if width, ok := rerenderWidths[canonicalArch(arch)]; ok {
+		buttons = append(buttons, discordgo.Button{Label: "🔁 " + width, Style: discordgo.SecondaryButton, CustomID: "rerender:" + token + ":" + width})
+	}
+
+	if mode, ok := rerenderModes[canonicalArch(arch)]; ok {
+		buttons = append(buttons, discordgo.Button{Label: "🅰 " + mode, Style: discordgo.SecondaryButton, CustomID: "rerender:" + token + ":" + mode})
+	}
+
+	if len(buttons) == 0 {
+		return nil
+	}
+
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// Builds the reply to !disassemble, with buttons to disassemble the same bytes in the architecture's other modes
+func disassemblyReply(scope string, arch string, opcodes []byte, prefs userPrefs) (*discordgo.MessageSend, error) {
+	token := ""
+
+	if rerenderButtons("", arch) != nil {
+		token = storeRerender(opcodes, prefs, scope)
+	}
+
+	return renderDisassembly("Disassembly:", scope, arch, token, opcodes, prefs)
+}
+
+// Disassembles the bytes as text or an image, as the user prefers, with the buttons the token's state backs
+func renderDisassembly(header string, scope string, arch string, token string, opcodes []byte, prefs userPrefs) (*discordgo.MessageSend, error) {
+	out, err := annotatedDisassembly(arch, opcodes, prefs.asmOptions())
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &discordgo.MessageSend{Content: header + " ```" + fenceLanguage(scope, "disassemble", arch) + "\n" + out + "```"}
+
+	if prefs.Render == "image" {
+		if rendered, err := renderListing(out); err == nil {
+			msg.Content = header
+			msg.Files = []*discordgo.File{{Name: "disassembly.png", ContentType: "image/png", Reader: bytes.NewReader(rendered)}}
+		}
+	}
+
+	if token != "" {
+		msg.Components = rerenderButtons(token, arch)
+	}
+
+	return msg, nil
+}
+
+// Handles a re-render button, editing the disassembly to show the bytes in the mode the button is for
+func rerenderPressed(s *discordgo.Session, i *discordgo.InteractionCreate, customID string) {
+	parts := strings.Split(strings.TrimPrefix(customID, "rerender:"), ":")
+
+	rerenderStatesLock.Lock()
+	state, ok := rerenderStates[parts[0]]
+	rerenderStatesLock.Unlock()
+
+	if len(parts) != 2 || !ok || time.Now().After(state.expires) {
+		respondEphemeral(s, i, "Sorry, these buttons have expired, run " + CommandPrefix + "disassemble again.", nil)
+		return
+	}
+
+	arch := parts[1]
+	msg, err := renderDisassembly("Disassembly as " + arch + ":", state.scope, arch, parts[0], state.opcodes, state.prefs)
+
+	if err != nil {
+		// The buttons stay, so the user can switch back
+		msg = &discordgo.MessageSend{Content: asmErrorMessage(err, supportedArchsCapstone), Components: rerenderButtons(parts[0], arch)}
+	}
+
+	// An image from the previous mode is replaced, not added to
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{Content: msg.Content, Components: msg.Components, Files: msg.Files, Attachments: &[]*discordgo.MessageAttachment{}},
+	})
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to respond to an interaction, ", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// The parts of a Discord session that command handlers use. Handlers take a Responder instead of a
+// *discordgo.Session, so they can run against a fake session in tests or be adapted to other frontends.
+type Responder interface {
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditComplex(data *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	WebhookExecute(webhookID, token string, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error)
+
+	// Gives a guild member a role, for point rewards
+	GuildMemberRoleAdd(guildID string, userID string, roleID string, options ...discordgo.RequestOption) error
+
+	// Guilds the bot is in
+	Guilds() []*discordgo.Guild
+
+	// Permissions the user has in the channel
+	ChannelPermissions(userID string, channelID string) (int64, error)
+
+	// A channel from the session's state, to check which guild it's in
+	StateChannel(channelID string) (*discordgo.Channel, error)
+}
+
+// Adapts a live Discord session to the Responder interface
+type discordResponder struct {
+	*discordgo.Session
+}
+
+func (d discordResponder) Guilds() []*discordgo.Guild {
+	return d.State.Guilds
+}
+
+func (d discordResponder) ChannelPermissions(userID string, channelID string) (int64, error) {
+	return d.State.UserChannelPermissions(userID, channelID)
+}
+
+func (d discordResponder) StateChannel(channelID string) (*discordgo.Channel, error) {
+	return d.State.Channel(channelID)
+}
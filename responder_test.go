@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A message a handler sent through a fakeResponder, with the text of any files attached to it
+type fakeReply struct {
+	channelID string
+	content   string
+	embeds    []*discordgo.MessageEmbed
+	files     map[string]string
+}
+
+// A Responder that records what handlers send instead of talking to Discord. Messages get IDs counting up from 1.
+type fakeResponder struct {
+	lock     sync.Mutex
+	replies  []fakeReply
+	edits    []*discordgo.MessageEdit
+	dms      []string
+	roles    []string
+	nextID   int
+	channels map[string]*discordgo.Channel
+	guilds   []*discordgo.Guild
+
+	// Permissions every user has in every channel
+	permissions int64
+}
+
+func (f *fakeResponder) record(reply fakeReply) (*discordgo.Message, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.nextID++
+	f.replies = append(f.replies, reply)
+
+	return &discordgo.Message{ID: strconv.Itoa(f.nextID), ChannelID: reply.channelID, Content: reply.content}, nil
+}
+
+// The messages sent so far
+func (f *fakeResponder) sent() []fakeReply {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]fakeReply(nil), f.replies...)
+}
+
+// The message edits made so far
+func (f *fakeResponder) edited() []*discordgo.MessageEdit {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]*discordgo.MessageEdit(nil), f.edits...)
+}
+
+func (f *fakeResponder) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return f.record(fakeReply{channelID: channelID, content: content})
+}
+
+func (f *fakeResponder) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return f.record(fakeReply{channelID: channelID, embeds: []*discordgo.MessageEmbed{embed}})
+}
+
+func (f *fakeResponder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	reply := fakeReply{channelID: channelID, content: data.Content, embeds: data.Embeds, files: map[string]string{}}
+
+	for _, file := range data.Files {
+		text, err := ioutil.ReadAll(file.Reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reply.files[file.Name] = string(text)
+	}
+
+	return f.record(reply)
+}
+
+func (f *fakeResponder) ChannelMessageEditComplex(data *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.edits = append(f.edits, data)
+
+	return &discordgo.Message{ID: data.ID, ChannelID: data.Channel}, nil
+}
+
+func (f *fakeResponder) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.dms = append(f.dms, recipientID)
+
+	return &discordgo.Channel{ID: "dm-" + recipientID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (f *fakeResponder) WebhookExecute(webhookID, token string, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return f.record(fakeReply{channelID: "webhook-" + webhookID, content: data.Content, embeds: data.Embeds})
+}
+
+func (f *fakeResponder) GuildMemberRoleAdd(guildID string, userID string, roleID string, options ...discordgo.RequestOption) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.roles = append(f.roles, guildID + "/" + userID + "/" + roleID)
+
+	return nil
+}
+
+func (f *fakeResponder) Guilds() []*discordgo.Guild {
+	return f.guilds
+}
+
+func (f *fakeResponder) ChannelPermissions(userID string, channelID string) (int64, error) {
+	return f.permissions, nil
+}
+
+func (f *fakeResponder) StateChannel(channelID string) (*discordgo.Channel, error) {
+	if channel, ok := f.channels[channelID]; ok {
+		return channel, nil
+	}
+
+	return nil, errors.New("unknown channel")
+}
+
+// A message as a user sent it in a guild channel
+func testMessage(content string) *discordgo.MessageCreate {
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "100",
+		ChannelID: "200",
+		GuildID:   "300",
+		Content:   content,
+		Author:    &discordgo.User{ID: "400", Username: "tester"},
+	}}
+}
+
+// Runs a handler for a command line against a fakeResponder, and returns what it sent
+func runHandler(handler cmdHandler, content string) *fakeResponder {
+	f := &fakeResponder{}
+	m := testMessage(content)
+	handler(cmdArguments{f, m, strings.Split(content, " ")})
+
+	return f
+}
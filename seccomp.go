@@ -0,0 +1,682 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// One classic BPF instruction, a struct sock_filter
+type bpfInsn struct {
+	code   uint16
+	jt, jf uint8
+	k      uint32
+}
+
+// The most instructions a seccomp filter can have, BPF_MAXINSNS
+const maxBPFInsns = 4096
+
+// seccomp return actions, by SECCOMP_RET_ACTION_FULL. ERRNO and TRACE carry a value in the low 16 bits.
+var seccompActions = map[uint32]string{
+	0x80000000: "KILL_PROCESS",
+	0x00000000: "KILL",
+	0x00030000: "TRAP",
+	0x00050000: "ERRNO",
+	0x7fc00000: "USER_NOTIF",
+	0x7ff00000: "TRACE",
+	0x7ffc0000: "LOG",
+	0x7fff0000: "ALLOW",
+}
+
+// Architectures by their AUDIT_ARCH value in seccomp_data, with the name of the system call table for them
+var auditArchs = map[uint32]struct{ name, table string }{
+	0xc000003e: {"ARCH_X86_64", "x64"},
+	0x40000003: {"ARCH_I386", "x86"},
+	0xc00000b7: {"ARCH_AARCH64", "arm64"},
+	0xc00000f3: {"ARCH_RISCV64", "arm64"},
+	0x40000028: {"ARCH_ARM", ""},
+	0x00000008: {"ARCH_MIPS", ""},
+	0x40000008: {"ARCH_MIPSEL", ""},
+	0x80000015: {"ARCH_PPC64", ""},
+	0xc0000015: {"ARCH_PPC64LE", ""},
+	0x80000016: {"ARCH_S390X", ""},
+}
+
+// Names what a seccomp filter returns
+func seccompAction(ret uint32) string {
+	action, ok := seccompActions[ret & 0xffff0000]
+
+	switch {
+	case !ok:
+		// The kernel treats actions it doesn't know as the strictest one
+		return "KILL_PROCESS (unknown 0x" + strconv.FormatUint(uint64(ret), 16) + ")"
+	case action == "ERRNO" || action == "TRACE":
+		return action + "(" + strconv.Itoa(int(ret & 0xffff)) + ")"
+	}
+
+	return action
+}
+
+// Names the field of struct seccomp_data at an offset
+func seccompField(offset uint32) string {
+	switch {
+	case offset == 0:
+		return "sys_number"
+	case offset == 4:
+		return "arch"
+	case offset == 8:
+		return "instruction_pointer"
+	case offset == 12:
+		return "instruction_pointer >> 32"
+	case offset >= 16 && offset < 64 && offset % 8 == 0:
+		return "args[" + strconv.Itoa(int(offset - 16) / 8) + "]"
+	case offset >= 16 && offset < 64 && offset % 8 == 4:
+		return "args[" + strconv.Itoa(int(offset - 16) / 8) + "] >> 32"
+	}
+
+	return "data[" + strconv.Itoa(int(offset)) + "]"
+}
+
+// Operators of the BPF ALU instructions and jumps, by their op bits
+var (
+	bpfALUOps  = map[uint16]string{0x00: "+", 0x10: "-", 0x20: "*", 0x30: "/", 0x40: "|", 0x50: "&", 0x60: "<<", 0x70: ">>", 0x90: "%", 0xa0: "^"}
+	bpfJumpOps = map[uint16][2]string{0x10: {"==", "!="}, 0x20: {">", "<="}, 0x30: {">=", "<"}, 0x40: {"&", "!&"}}
+)
+
+// Reads a filter from raw sock_filter bytes, from seccomp-tools' dump listing or from a C array of
+// { code, jt, jf, k } initializers
+func parseBPF(text string, raw []byte) ([]bpfInsn, error) {
+	var insns []bpfInsn
+	var fields [][]string
+
+	if raw == nil {
+		dump := regexp.MustCompile(`\d{4}:\s+0x([0-9a-fA-F]+)\s+0x([0-9a-fA-F]+)\s+0x([0-9a-fA-F]+)\s+0x([0-9a-fA-F]+)`)
+		array := regexp.MustCompile(`\{\s*(0[xX][0-9a-fA-F]+|\d+)\s*,\s*(0[xX][0-9a-fA-F]+|\d+)\s*,\s*(0[xX][0-9a-fA-F]+|\d+)\s*,\s*(0[xX][0-9a-fA-F]+|\d+)[UuLl]*\s*\}`)
+
+		if matches := dump.FindAllStringSubmatch(text, -1); len(matches) > 0 {
+			for _, match := range matches {
+				fields = append(fields, []string{"0x" + match[1], "0x" + match[2], "0x" + match[3], "0x" + match[4]})
+			}
+		} else if matches := array.FindAllStringSubmatch(text, -1); len(matches) > 0 {
+			for _, match := range matches {
+				fields = append(fields, match[1:])
+			}
+		} else {
+			data, err := parseInlineBytes(strings.Join(strings.Fields(text), ""))
+
+			if err != nil {
+				return nil, err
+			}
+
+			raw = data
+		}
+	}
+
+	for _, field := range fields {
+		code, errCode := strconv.ParseUint(field[0], 0, 16)
+		jt, errJt := strconv.ParseUint(field[1], 0, 8)
+		jf, errJf := strconv.ParseUint(field[2], 0, 8)
+		k, errK := strconv.ParseUint(field[3], 0, 32)
+
+		if errCode != nil || errJt != nil || errJf != nil || errK != nil {
+			return nil, errors.New("'{" + strings.Join(field, ", ") + "}' isn't a BPF instruction")
+		}
+
+		insns = append(insns, bpfInsn{uint16(code), uint8(jt), uint8(jf), uint32(k)})
+	}
+
+	if raw != nil {
+		if len(raw) % 8 != 0 {
+			return nil, errors.New("a filter is a whole number of 8 byte instructions, but this is " + strconv.Itoa(len(raw)) + " bytes")
+		}
+
+		for n := 0; n < len(raw); n += 8 {
+			insns = append(insns, bpfInsn{binary.LittleEndian.Uint16(raw[n:]), raw[n + 2], raw[n + 3], binary.LittleEndian.Uint32(raw[n + 4:])})
+		}
+	}
+
+	if len(insns) == 0 || len(insns) > maxBPFInsns {
+		return nil, errors.New("a filter has 1 to " + strconv.Itoa(maxBPFInsns) + " instructions")
+	}
+
+	return insns, nil
+}
+
+// Works out which seccomp_data field A holds at each instruction, where every path there agrees, so the listing can
+// show system call and architecture names in comparisons
+func bpfASources(insns []bpfInsn) []string {
+	sources := make([]string, len(insns))
+	seen := make([]bool, len(insns))
+	seen[0] = true
+
+	flow := func(to int, source string) {
+		if to >= len(insns) {
+			return
+		}
+
+		if seen[to] && sources[to] != source {
+			source = ""
+		}
+
+		sources[to], seen[to] = source, true
+	}
+
+	// Jumps only go forward, so one pass in order sees every way into an instruction before it
+	for n, insn := range insns {
+		source := sources[n]
+
+		switch insn.code & 0x07 {
+		case 0x00, 0x04:
+			source = ""
+
+			if insn.code == 0x20 && (insn.k == 0 || insn.k == 4) {
+				source = seccompField(insn.k)
+			}
+		case 0x07:
+			if insn.code & 0xf8 == 0x80 {
+				source = ""
+			}
+		case 0x05:
+			if insn.code & 0xf0 == 0 {
+				flow(n + 1 + int(insn.k), source)
+			} else {
+				flow(n + 1 + int(insn.jt), source)
+				flow(n + 1 + int(insn.jf), source)
+			}
+
+			continue
+		case 0x06:
+			continue
+		}
+
+		flow(n + 1, source)
+	}
+
+	return sources
+}
+
+// Shows a constant the way it's compared, as a system call or architecture name when A holds one
+func bpfConstant(k uint32, source string, table []string) string {
+	switch {
+	case source == "sys_number" && table != nil && uint64(k) < uint64(len(table)) && table[k] != "":
+		return table[k]
+	case source == "arch" && auditArchs[k].name != "":
+		return auditArchs[k].name
+	}
+
+	return "0x" + strconv.FormatUint(uint64(k), 16)
+}
+
+// Disassembles a filter in the style of seccomp-tools, with the system call names from table
+func bpfListing(insns []bpfInsn, table []string) string {
+	sources := bpfASources(insns)
+	out := " line  CODE  JT   JF      K\n=================================\n"
+
+	for n, insn := range insns {
+		line := fmt.Sprintf(" %04d: 0x%02x 0x%02x 0x%02x 0x%08x  ", n, insn.code, insn.jt, insn.jf, insn.k)
+		k := "0x" + strconv.FormatUint(uint64(insn.k), 16)
+		target := func(offset uint32) string {
+			return fmt.Sprintf("%04d", n + 1 + int(offset))
+		}
+
+		switch class, op := insn.code & 0x07, insn.code & 0xf0; {
+		case insn.code == 0x20:
+			line += "A = " + seccompField(insn.k)
+		case insn.code == 0x80 || insn.code == 0x81:
+			line += string("AX"[class]) + " = sizeof(seccomp_data)"
+		case insn.code == 0x00 || insn.code == 0x01:
+			line += string("AX"[class]) + " = " + k
+		case insn.code == 0x60 || insn.code == 0x61:
+			line += string("AX"[class]) + " = mem[" + strconv.Itoa(int(insn.k)) + "]"
+		case insn.code == 0x02 || insn.code == 0x03:
+			line += "mem[" + strconv.Itoa(int(insn.k)) + "] = " + string("AX"[class - 2])
+		case class == 0x04 && op == 0x80:
+			line += "A = -A"
+		case class == 0x04 && bpfALUOps[op] != "":
+			operand := k
+
+			if insn.code & 0x08 != 0 {
+				operand = "X"
+			}
+
+			line += "A " + bpfALUOps[op] + "= " + operand
+		case insn.code == 0x05:
+			line += "goto " + target(insn.k)
+		case class == 0x05 && bpfJumpOps[op][0] != "":
+			operand := bpfConstant(insn.k, sources[n], table)
+
+			if insn.code & 0x08 != 0 {
+				operand = "X"
+			}
+
+			ops := bpfJumpOps[op]
+			condition := func(negate bool) string {
+				if op == 0x40 {
+					return map[bool]string{false: "if (A & " + operand + ")", true: "if (!(A & " + operand + "))"}[negate]
+				}
+
+				return "if (A " + ops[map[bool]int{false: 0, true: 1}[negate]] + " " + operand + ")"
+			}
+
+			switch {
+			case insn.jt == 0:
+				line += condition(true) + " goto " + target(uint32(insn.jf))
+			case insn.jf == 0:
+				line += condition(false) + " goto " + target(uint32(insn.jt))
+			default:
+				line += condition(false) + " goto " + target(uint32(insn.jt)) + " else goto " + target(uint32(insn.jf))
+			}
+		case insn.code == 0x06:
+			line += "return " + seccompAction(insn.k)
+		case insn.code == 0x16:
+			line += "return A"
+		case insn.code == 0x07:
+			line += "X = A"
+		case insn.code == 0x87:
+			line += "A = X"
+		default:
+			line += "??? not an instruction seccomp allows"
+		}
+
+		out += line + "\n"
+	}
+
+	return out
+}
+
+// A value while a filter is evaluated, known or an expression of the arguments
+type bpfValue struct {
+	known bool
+	value uint32
+	expr  string
+}
+
+func (v bpfValue) String() string {
+	if v.known {
+		return "0x" + strconv.FormatUint(uint64(v.value), 16)
+	}
+
+	return v.expr
+}
+
+// The registers and scratch memory of a filter being evaluated
+type bpfState struct {
+	a, x bpfValue
+	mem  [16]bpfValue
+}
+
+// One way through a filter, the conditions on the arguments it took and what it returned
+type bpfPath struct {
+	conditions []string
+	action     string
+}
+
+// Paths through a filter for one system call are only followed this far
+const maxBPFPaths = 32
+
+// Runs a filter for a system call number and architecture, with the arguments and instruction pointer unknown. Where
+// a jump depends on them both ways are followed, and every path is returned.
+func evaluateBPF(insns []bpfInsn, number uint32, arch uint32) []bpfPath {
+	var paths []bpfPath
+
+	var run func(pc int, st bpfState, conditions []string)
+	run = func(pc int, st bpfState, conditions []string) {
+		finish := func(action string) {
+			paths = append(paths, bpfPath{append([]string{}, conditions...), action})
+		}
+
+		for ; pc < len(insns); pc++ {
+			if len(paths) >= maxBPFPaths {
+				return
+			}
+
+			insn := insns[pc]
+			class, op := insn.code & 0x07, insn.code & 0xf0
+			operand := bpfValue{true, insn.k, ""}
+
+			if insn.code & 0x08 != 0 && (class == 0x04 || class == 0x05) {
+				operand = st.x
+			}
+
+			switch {
+			case insn.code == 0x20:
+				switch insn.k {
+				case 0:
+					st.a = bpfValue{true, number, ""}
+				case 4:
+					st.a = bpfValue{true, arch, ""}
+				default:
+					st.a = bpfValue{false, 0, seccompField(insn.k)}
+				}
+			case insn.code == 0x80:
+				st.a = bpfValue{true, 64, ""}
+			case insn.code == 0x81:
+				st.x = bpfValue{true, 64, ""}
+			case insn.code == 0x00:
+				st.a = operand
+			case insn.code == 0x01:
+				st.x = operand
+			case insn.code == 0x60:
+				st.a = st.mem[insn.k & 15]
+			case insn.code == 0x61:
+				st.x = st.mem[insn.k & 15]
+			case insn.code == 0x02:
+				st.mem[insn.k & 15] = st.a
+			case insn.code == 0x03:
+				st.mem[insn.k & 15] = st.x
+			case insn.code == 0x07:
+				st.x = st.a
+			case insn.code == 0x87:
+				st.a = st.x
+			case class == 0x04 && op == 0x80:
+				if st.a.known {
+					st.a.value = -st.a.value
+				} else {
+					st.a.expr = "-" + st.a.expr
+				}
+			case class == 0x04 && bpfALUOps[op] != "":
+				if !st.a.known || !operand.known {
+					st.a = bpfValue{false, 0, "(" + st.a.String() + " " + bpfALUOps[op] + " " + operand.String() + ")"}
+					break
+				}
+
+				a, b := st.a.value, operand.value
+
+				// Dividing by a zero in X ends the filter with 0, which kills
+				if (op == 0x30 || op == 0x90) && b == 0 {
+					finish(seccompAction(0))
+					return
+				}
+
+				switch op {
+				case 0x00: a += b
+				case 0x10: a -= b
+				case 0x20: a *= b
+				case 0x30: a /= b
+				case 0x40: a |= b
+				case 0x50: a &= b
+				case 0x60: a <<= b & 31
+				case 0x70: a >>= b & 31
+				case 0x90: a %= b
+				case 0xa0: a ^= b
+				}
+
+				st.a.value = a
+			case insn.code == 0x05:
+				pc += int(insn.k)
+			case class == 0x05 && bpfJumpOps[op][0] != "":
+				if st.a.known && operand.known {
+					a, b := st.a.value, operand.value
+					taken := map[uint16]bool{0x10: a == b, 0x20: a > b, 0x30: a >= b, 0x40: a & b != 0}[op]
+
+					if taken {
+						pc += int(insn.jt)
+					} else {
+						pc += int(insn.jf)
+					}
+
+					break
+				}
+
+				// Both ways are possible, the true one is followed here and the false one after it
+				ops := bpfJumpOps[op]
+				yes, no := st.a.String() + " " + ops[0] + " " + operand.String(), st.a.String() + " " + ops[1] + " " + operand.String()
+
+				if op == 0x40 {
+					yes, no = "(" + st.a.String() + " & " + operand.String() + ") != 0", "(" + st.a.String() + " & " + operand.String() + ") == 0"
+				}
+
+				run(pc + 1 + int(insn.jt), st, append(append([]string{}, conditions...), yes))
+				conditions = append(conditions, no)
+				pc += int(insn.jf)
+			case insn.code == 0x06:
+				finish(seccompAction(insn.k))
+				return
+			case insn.code == 0x16:
+				if st.a.known {
+					finish(seccompAction(st.a.value))
+				} else {
+					finish("the action in " + st.a.expr)
+				}
+
+				return
+			default:
+				finish("invalid, the kernel won't load the filter")
+				return
+			}
+		}
+
+		finish("invalid, it runs off the end")
+	}
+
+	run(0, bpfState{}, nil)
+	return paths
+}
+
+// Sums up what the paths through a filter for one system call do, i.e. "ALLOW" or
+// "ALLOW if args[0] == 0x1, otherwise KILL"
+func bpfOutcome(paths []bpfPath) string {
+	same := true
+
+	for _, path := range paths {
+		same = same && path.action == paths[0].action
+	}
+
+	if same {
+		return paths[0].action
+	}
+
+	var cases []string
+
+	for n, path := range paths {
+		if n == len(paths) - 1 {
+			cases = append(cases, "otherwise " + path.action)
+		} else {
+			cases = append(cases, path.action + " if " + strings.Join(path.conditions, " and "))
+		}
+	}
+
+	if len(paths) >= maxBPFPaths {
+		cases = append(cases[:len(cases) - 1], "and more")
+	}
+
+	return strings.Join(cases, ", ")
+}
+
+// Sums up a filter's policy for every system call of an architecture
+func seccompSummary(insns []bpfInsn, arch uint32, table []string) string {
+	outcomes := map[string][]string{}
+	var order []string
+	conditional := ""
+
+	for number, name := range table {
+		if name == "" {
+			continue
+		}
+
+		paths := evaluateBPF(insns, uint32(number), arch)
+		outcome := bpfOutcome(paths)
+
+		// Calls that depend on their arguments get a line each
+		if len(paths) > 1 && outcome != paths[0].action {
+			conditional += "    " + name + ": " + outcome + "\n"
+			continue
+		}
+
+		if _, ok := outcomes[outcome]; !ok {
+			order = append(order, outcome)
+		}
+
+		outcomes[outcome] = append(outcomes[outcome], name)
+	}
+
+	// The most common outcome is the default, the rest are listed
+	common := ""
+
+	for _, outcome := range order {
+		if common == "" || len(outcomes[outcome]) > len(outcomes[common]) {
+			common = outcome
+		}
+	}
+
+	out := ""
+
+	for _, outcome := range order {
+		if outcome != common {
+			out += "  " + outcome + ": " + strings.Join(outcomes[outcome], ", ") + "\n"
+		}
+	}
+
+	if common != "" {
+		out += "  " + common + ": everything else (" + strconv.Itoa(len(outcomes[common])) + " system calls)\n"
+	}
+
+	if conditional != "" {
+		out += "  Depending on the arguments:\n" + conditional
+	}
+
+	return out
+}
+
+// Disassembles a seccomp filter and sums up its policy for each system call
+func cmdSeccomp(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	// Filters that don't check the architecture are read as x86_64, unless another one is given
+	tableName := "x64"
+	var rest []string
+
+	for _, arg := range args[1:] {
+		switch strings.ToLower(arg) {
+		case "x64", "x86_64", "amd64":
+			tableName = "x64"
+		case "x86", "i386":
+			tableName = "x86"
+		case "arm64", "aarch64":
+			tableName = "arm64"
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	text := strings.Join(rest, " ")
+	var raw []byte
+
+	if len(m.Attachments) > 0 {
+		data, err := downloadAttachment(m.Attachments[0])
+
+		if err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, couldn't download the attachment, " + err.Error() + ".")
+			return
+		}
+
+		// A dump saved as text is read like one pasted in, anything else is the raw filter, whose instructions
+		// always have zero bytes
+		if bytes.IndexByte(data, 0) < 0 && utf8.Valid(data) {
+			text = string(data)
+		} else {
+			raw = data
+		}
+	}
+
+	if text == "" && raw == nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, give the filter as hex bytes, seccomp-tools' dump or a C array of sock_filters, or attach it.")
+		return
+	}
+
+	insns, err := parseBPF(text, raw)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	// The architectures the filter checks for are summed up separately
+	var arches []uint32
+	checksArch := false
+
+	sources := bpfASources(insns)
+
+	for n, insn := range insns {
+		checksArch = checksArch || insn.code == 0x20 && insn.k == 4
+
+		if insn.code & 0x07 == 0x05 && insn.code & 0xf8 == 0x10 && sources[n] == "arch" && auditArchs[insn.k].name != "" {
+			arches = append(arches, insn.k)
+		}
+	}
+
+	listingTable := syscallTables[tableName]
+
+	if len(arches) > 0 && auditArchs[arches[0]].table != "" {
+		listingTable = syscallTables[auditArchs[arches[0]].table]
+	}
+
+	out := bpfListing(insns, listingTable) + "\n"
+	var notes []string
+
+	if !checksArch {
+		for value, arch := range auditArchs {
+			if arch.table == tableName && value != 0xc00000f3 {
+				arches = append(arches, value)
+				break
+			}
+		}
+
+		if tableName == "x64" {
+			notes = append(notes, "It never checks the architecture, so system calls made the 32-bit way with int 0x80 are checked by their x86_64 numbers, i.e. i386's execve (11) is seen as munmap.")
+		} else {
+			notes = append(notes, "It never checks the architecture, so it's summed up for " + tableName + ".")
+		}
+	}
+
+	summed := map[uint32]bool{}
+
+	for _, arch := range arches {
+		if summed[arch] {
+			continue
+		}
+
+		summed[arch] = true
+
+		table := syscallTables[auditArchs[arch].table]
+
+		if table == nil {
+			out += auditArchs[arch].name + ": " + bpfOutcome(evaluateBPF(insns, 0, arch)) + " for system call 0, there's no table of its system calls\n"
+			continue
+		}
+
+		out += auditArchs[arch].name + ":\n" + seccompSummary(insns, arch, table)
+
+		// x32 system calls are x86_64 ones with bit 30 set, filters that forget them let them through
+		if arch == 0xc000003e {
+			var allowed []string
+
+			for number, name := range syscallsX64 {
+				if name != "" && bpfOutcome(evaluateBPF(insns, uint32(number) | 0x40000000, arch)) == "ALLOW" && bpfOutcome(evaluateBPF(insns, uint32(number), arch)) != "ALLOW" {
+					allowed = append(allowed, name)
+				}
+			}
+
+			if len(allowed) > 0 {
+				notes = append(notes, "x32 system calls (the number with bit 30 set, i.e. 0x40000000 | 59 for execve) get through where the x86_64 ones don't: " + joinWords(allowed) + ".")
+			}
+		}
+	}
+
+	if checksArch {
+		out += "Other architectures: " + bpfOutcome(evaluateBPF(insns, 0, 0)) + "\n"
+	}
+
+	if len(notes) > 0 {
+		out += "\n" + strings.Join(notes, "\n") + "\n"
+	}
+
+	sendListing(s, m.ChannelID, "Seccomp filter, " + strconv.Itoa(len(insns)) + " instructions:", "seccomp.txt", out)
+}
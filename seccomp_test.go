@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Kills execve and anything that isn't x86_64, allows the rest
+var seccompDenyExecve = []bpfInsn{
+	{0x20, 0, 0, 4},
+	{0x15, 0, 3, 0xc000003e},
+	{0x20, 0, 0, 0},
+	{0x15, 1, 0, 59},
+	{0x06, 0, 0, 0x7fff0000},
+	{0x06, 0, 0, 0},
+}
+
+// Allows write to stdout only, and read, and fails everything else with EPERM
+var seccompStdoutOnly = []bpfInsn{
+	{0x20, 0, 0, 0},
+	{0x15, 4, 0, 0},
+	{0x15, 0, 4, 1},
+	{0x20, 0, 0, 0x10},
+	{0x15, 0, 2, 1},
+	{0x06, 0, 0, 0x7fff0000},
+	{0x06, 0, 0, 0x7fff0000},
+	{0x06, 0, 0, 0x00050001},
+}
+
+// Encodes a filter as the sock_filter array the kernel takes
+func bpfBytes(insns []bpfInsn) []byte {
+	var raw []byte
+
+	for _, insn := range insns {
+		var b [8]byte
+		binary.LittleEndian.PutUint16(b[:], insn.code)
+		b[2], b[3] = insn.jt, insn.jf
+		binary.LittleEndian.PutUint32(b[4:], insn.k)
+		raw = append(raw, b[:]...)
+	}
+
+	return raw
+}
+
+func TestParseBPF(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		raw  []byte
+	}{
+		{"raw", "", bpfBytes(seccompDenyExecve)},
+		{"hex", hex.EncodeToString(bpfBytes(seccompDenyExecve)), nil},
+		{"seccomp-tools dump", ` line  CODE  JT   JF      K
+=================================
+ 0000: 0x20 0x00 0x00 0x00000004  A = arch
+ 0001: 0x15 0x00 0x03 0xc000003e  if (A != ARCH_X86_64) goto 0005
+ 0002: 0x20 0x00 0x00 0x00000000  A = sys_number
+ 0003: 0x15 0x01 0x00 0x0000003b  if (A == execve) goto 0005
+ 0004: 0x06 0x00 0x00 0x7fff0000  return ALLOW
+ 0005: 0x06 0x00 0x00 0x00000000  return KILL`, nil},
+		{"C array", `struct sock_filter filter[] = {
+	{ 0x20, 0, 0, 0x00000004 },
+	{ 0x15, 0, 3, 0xc000003eU },
+	{ 0x20, 0, 0, 0 },
+	{ 0x15, 1, 0, 59 },
+	{ 0x06, 0, 0, 0x7fff0000 },
+	{ 0x06, 0, 0, 0 },
+};`, nil},
+	}
+
+	for _, test := range tests {
+		insns, err := parseBPF(test.text, test.raw)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if len(insns) != len(seccompDenyExecve) {
+			t.Errorf("%s: got %d instructions, want %d", test.name, len(insns), len(seccompDenyExecve))
+			continue
+		}
+
+		for n, insn := range insns {
+			if insn != seccompDenyExecve[n] {
+				t.Errorf("%s: instruction %d is %+v, want %+v", test.name, n, insn, seccompDenyExecve[n])
+			}
+		}
+	}
+
+	if _, err := parseBPF("", bpfBytes(seccompDenyExecve)[:12]); err == nil {
+		t.Error("a filter cut short parsed")
+	}
+
+	if _, err := parseBPF("", []byte{}); err == nil {
+		t.Error("an empty filter parsed")
+	}
+}
+
+func TestBPFListing(t *testing.T) {
+	listing := bpfListing(seccompDenyExecve, syscallTables["x64"])
+	want := []string{
+		" 0000: 0x20 0x00 0x00 0x00000004  A = arch",
+		" 0001: 0x15 0x00 0x03 0xc000003e  if (A != ARCH_X86_64) goto 0005",
+		" 0002: 0x20 0x00 0x00 0x00000000  A = sys_number",
+		" 0003: 0x15 0x01 0x00 0x0000003b  if (A == execve) goto 0005",
+		" 0004: 0x06 0x00 0x00 0x7fff0000  return ALLOW",
+		" 0005: 0x06 0x00 0x00 0x00000000  return KILL",
+	}
+
+	lines := strings.Split(strings.TrimSuffix(listing, "\n"), "\n")
+
+	if len(lines) != len(want) + 2 {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want) + 2, listing)
+	}
+
+	for n, line := range lines[2:] {
+		if line != want[n] {
+			t.Errorf("line %d: got %q, want %q", n, line, want[n])
+		}
+	}
+}
+
+func TestEvaluateBPF(t *testing.T) {
+	tests := []struct {
+		name    string
+		insns   []bpfInsn
+		number  uint32
+		arch    uint32
+		outcome string
+	}{
+		{"execve", seccompDenyExecve, 59, 0xc000003e, "KILL"},
+		{"read", seccompDenyExecve, 0, 0xc000003e, "ALLOW"},
+		{"i386", seccompDenyExecve, 0, 0x40000003, "KILL"},
+		{"read", seccompStdoutOnly, 0, 0xc000003e, "ALLOW"},
+		{"write", seccompStdoutOnly, 1, 0xc000003e, "ALLOW if args[0] == 0x1, otherwise ERRNO(1)"},
+		{"open", seccompStdoutOnly, 2, 0xc000003e, "ERRNO(1)"},
+	}
+
+	for _, test := range tests {
+		if outcome := bpfOutcome(evaluateBPF(test.insns, test.number, test.arch)); outcome != test.outcome {
+			t.Errorf("%s: got %q, want %q", test.name, outcome, test.outcome)
+		}
+	}
+
+	// Dividing by zero ends the filter and kills
+	divide := []bpfInsn{{0x00, 0, 0, 1}, {0x01, 0, 0, 0}, {0x3c, 0, 0, 0}, {0x06, 0, 0, 0x7fff0000}}
+
+	if outcome := bpfOutcome(evaluateBPF(divide, 0, 0)); outcome != "KILL" {
+		t.Errorf("division by zero: got %q, want KILL", outcome)
+	}
+
+	// A filter has to return
+	if outcome := bpfOutcome(evaluateBPF([]bpfInsn{{0x20, 0, 0, 0}}, 0, 0)); !strings.Contains(outcome, "runs off the end") {
+		t.Errorf("no return: got %q", outcome)
+	}
+}
+
+func TestSeccompAction(t *testing.T) {
+	for ret, want := range map[uint32]string{
+		0x7fff0000: "ALLOW",
+		0x80000000: "KILL_PROCESS",
+		0x00000000: "KILL",
+		0x00050001: "ERRNO(1)",
+		0x7ff00010: "TRACE(16)",
+		0x12345678: "KILL_PROCESS (unknown 0x12345678)",
+	} {
+		if got := seccompAction(ret); got != want {
+			t.Errorf("seccompAction(0x%x) = %q, want %q", ret, got, want)
+		}
+	}
+}
+
+func TestSeccompField(t *testing.T) {
+	for offset, want := range map[uint32]string{
+		0: "sys_number", 4: "arch", 8: "instruction_pointer", 12: "instruction_pointer >> 32", 16: "args[0]",
+		28: "args[1] >> 32", 56: "args[5]", 64: "data[64]",
+	} {
+		if got := seccompField(offset); got != want {
+			t.Errorf("seccompField(%d) = %q, want %q", offset, got, want)
+		}
+	}
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Per-guild settings, changed by guild admins with !settings
+type guildSettings struct {
+	// Command aliases, i.e. "dis" -> "disassemble x64"
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// Channel command usage is logged to, empty if it's disabled
+	AuditChannel string `json:"audit_channel,omitempty"`
+
+	// Tool-specific trick packs given out by !retrick and !exploittrick, none are enabled by default
+	TrickPacks []string `json:"trick_packs,omitempty"`
+
+	// Links !manual gives instead of the default ones, keyed by manual name
+	ManualURLs map[string]string `json:"manual_urls,omitempty"`
+
+	// Roles users are given when their all time points reach a threshold, keyed by role ID
+	RoleRewards map[string]int `json:"role_rewards,omitempty"`
+
+	// Channels a command can only be used in, keyed by command name. Commands that aren't listed work everywhere.
+	ChannelCommands map[string][]string `json:"channel_commands,omitempty"`
+
+	// Code block languages assembly output is highlighted as, keyed like the [highlight] section of config.ini
+	FenceLanguages map[string]string `json:"fence_languages,omitempty"`
+}
+
+// Stores the settings of every guild that has changed any, keyed by guild scope
+var (
+	settingsMap  map[string]guildSettings
+	settingsLock sync.RWMutex
+)
+
+// Loads guild settings from the data directory
+func loadSettings() {
+	settings := make(map[string]guildSettings)
+
+	if err := loadStore("settings", &settings); err != nil {
+		fmt.Println("[ERROR] Failed to load guild settings, " + err.Error())
+	}
+
+	settingsLock.Lock()
+	settingsMap = settings
+	settingsLock.Unlock()
+}
+
+// Returns the settings for the given guild scope
+func getGuildSettings(scope string) guildSettings {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+
+	return settingsMap[scope]
+}
+
+// Applies a change to the settings for the given guild scope and saves them
+func updateGuildSettings(scope string, update func(settings *guildSettings)) error {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+
+	settings := settingsMap[scope]
+	update(&settings)
+	settingsMap[scope] = settings
+
+	return saveStore("settings", settingsMap)
+}
+
+// Checks if the message author can change the guild's settings. In DMs users manage their own settings.
+func isGuildAdmin(s Responder, m *discordgo.MessageCreate) bool {
+	if m.GuildID == "" || DeveloperList.contains(m.Author.ID) {
+		return true
+	}
+
+	perms, err := s.ChannelPermissions(m.Author.ID, m.ChannelID)
+
+	if err != nil {
+		return false
+	}
+
+	return perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0
+}
+
+// Checks that a channel is one of the guild's, so settings can't point at a channel in another server
+func isGuildChannel(s Responder, guildID string, channelID string) bool {
+	channel, err := s.StateChannel(channelID)
+	return err == nil && channel != nil && channel.GuildID == guildID
+}
+
+// Expands a guild alias into the command it stands for, aliases aren't expanded recursively
+func expandAlias(scope string, args []string) []string {
+	expansion, ok := getGuildSettings(scope).Aliases[strings.ToLower(args[0])]
+
+	if !ok {
+		return args
+	}
+
+	return append(strings.Fields(expansion), args[1:]...)
+}
+
+// Checks if the name is already taken by a built in command or one of its aliases
+func isCommandName(name string) bool {
+	for _, cmd := range commandMap {
+		if cmd.name == name || searchAliases(name, cmd.aliases) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Finds a built in command by its name or one of its aliases
+func findCommand(name string) (Command, bool) {
+	for _, cmd := range commandMap {
+		if cmd.name == name || searchAliases(name, cmd.aliases) {
+			return cmd, true
+		}
+	}
+
+	return Command{}, false
+}
+
+// Checks if a command can be used in the channel the message was sent in, returning the channels it's limited to if
+// it can't. The limits only apply in guilds.
+func channelAllowed(m *discordgo.MessageCreate, command Command) ([]string, bool) {
+	if m.GuildID == "" {
+		return nil, true
+	}
+
+	channels := getGuildSettings(guildScope(m)).ChannelCommands[command.name]
+
+	if len(channels) == 0 || StrList(channels).contains(m.ChannelID) {
+		return nil, true
+	}
+
+	return channels, false
+}
+
+// Shows or changes the guild's settings
+func cmdSettings(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	scope := guildScope(m)
+	usage := "Usage: " + CommandPrefix + "settings [aliases|alias|unalias|audit|packs|pack|manual|highlight|rewards|reward|channels|allow|disallow] {arguments ...}"
+
+	if len(args) < 2 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "aliases":
+		aliases := getGuildSettings(scope).Aliases
+
+		if len(aliases) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There are no aliases set up.")
+			return
+		}
+
+		var names []string
+
+		for name := range aliases {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		out := ""
+
+		for _, name := range names {
+			out += CommandPrefix + name + " -> " + CommandPrefix + aliases[name] + "\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Aliases: ```" + out + "```")
+		return
+	case "alias":
+		if len(args) < 4 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings alias [name] [command] {arguments ...}")
+			return
+		}
+
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can change settings.")
+			return
+		}
+
+		name := strings.ToLower(strings.TrimPrefix(args[2], CommandPrefix))
+		expansion := strings.TrimPrefix(strings.Join(args[3:], " "), CommandPrefix)
+
+		if isCommandName(name) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "'" + name + "' is already a command.")
+			return
+		}
+
+		fields := strings.Fields(expansion)
+
+		if len(fields) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings alias [name] [command] {arguments ...}")
+			return
+		}
+
+		if !isCommandName(fields[0]) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "'" + fields[0] + "' isn't a command.")
+			return
+		}
+
+		err := updateGuildSettings(scope, func(settings *guildSettings) {
+			if settings.Aliases == nil {
+				settings.Aliases = make(map[string]string)
+			}
+
+			settings.Aliases[name] = expansion
+		})
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save guild settings, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the settings.")
+			return
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Alias saved! " + CommandPrefix + name + " now runs " + CommandPrefix + expansion)
+		return
+	case "unalias":
+		if len(args) < 3 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings unalias [name]")
+			return
+		}
+
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can change settings.")
+			return
+		}
+
+		name := strings.ToLower(strings.TrimPrefix(args[2], CommandPrefix))
+
+		err := updateGuildSettings(scope, func(settings *guildSettings) {
+			delete(settings.Aliases, name)
+		})
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save guild settings, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the settings.")
+			return
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Alias removed.")
+		return
+	case "audit":
+		if len(args) < 3 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings audit [#channel|off]")
+			return
+		}
+
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can change settings.")
+			return
+		}
+
+		channel := parseChannelMention(args[2])
+
+		if strings.ToLower(channel) == "off" {
+			channel = ""
+		} else if !isGuildChannel(s, m.GuildID, channel) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, that isn't a channel in this server.")
+			return
+		}
+
+		err := updateGuildSettings(scope, func(settings *guildSettings) {
+			settings.AuditChannel = channel
+		})
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save guild settings, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the settings.")
+			return
+		}
+
+		if channel == "" {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Audit log disabled.")
+		} else {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Command usage will now be logged to <#" + channel + ">.")
+		}
+
+		return
+	case "packs":
+		names := trickPackNames()
+
+		if len(names) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There are no trick packs installed.")
+			return
+		}
+
+		enabled := StrList(getGuildSettings(scope).TrickPacks)
+		out := ""
+
+		for _, name := range names {
+			pack, _ := getTrickPack(name)
+			state := "off"
+
+			if enabled.contains(name) {
+				state = "on"
+			}
+
+			out += name + " (" + state + ") - " + pack.Description + ", " + strconv.Itoa(len(pack.Tricks)) + " " + pack.Kind + " tricks\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Trick packs: ```" + out + "```")
+		return
+	case "pack":
+		if len(args) < 4 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings pack [name] [on|off]")
+			return
+		}
+
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can change settings.")
+			return
+		}
+
+		name := strings.ToLower(args[2])
+		state := strings.ToLower(args[3])
+
+		if _, ok := getTrickPack(name); !ok {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There's no '" + name + "' trick pack, see " + CommandPrefix + "settings packs.")
+			return
+		}
+
+		if state != "on" && state != "off" {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings pack [name] [on|off]")
+			return
+		}
+
+		err := updateGuildSettings(scope, func(settings *guildSettings) {
+			var packs []string
+
+			for _, pack := range settings.TrickPacks {
+				if pack != name {
+					packs = append(packs, pack)
+				}
+			}
+
+			if state == "on" {
+				packs = append(packs, name)
+			}
+
+			settings.TrickPacks = packs
+		})
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save guild settings, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the settings.")
+			return
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "The " + name + " trick pack is now " + state + ".")
+		return
+	case "manual":
+		if len(args) < 4 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings manual [architecture] [url|reset]")
+			return
+		}
+
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can change settings.")
+			return
+		}
+
+		man, ok := findManual(strings.ToLower(args[2]))
+
+		if !ok {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There's no manual for '" + args[2] + "'. Supported architectures: ```" + supportedArchsManual() + "```")
+			return
+		}
+
+		link := strings.Trim(args[3], "<>")
+		reset := strings.ToLower(link) == "reset"
+
+		if !reset && !strings.HasPrefix(link, "https://") && !strings.HasPrefix(link, "http://") {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "The manual link has to be an http(s) URL.")
+			return
+		}
+
+		err := updateGuildSettings(scope, func(settings *guildSettings) {
+			if reset {
+				delete(settings.ManualURLs, man.Name)
+				return
+			}
+
+			if settings.ManualURLs == nil {
+				settings.ManualURLs = make(map[string]string)
+			}
+
+			settings.ManualURLs[man.Name] = link
+		})
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save guild settings, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the settings.")
+			return
+		}
+
+		if reset {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "The " + man.Name + " manual link is back to the default.")
+		} else {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "The " + man.Name + " manual now links to <" + link + ">.")
+		}
+
+		return
+	case "highlight":
+		if len(args) < 4 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings highlight [default|architecture|command|command.architecture] [language|reset]")
+			return
+		}
+
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can change settings.")
+			return
+		}
+
+		key, ok := normalizeFenceLanguageKey(args[2])
+
+		if !ok {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "'" + args[2] + "' isn't an architecture or command, use i.e. arm, disassemble or disassemble.arm.")
+			return
+		}
+
+		language := strings.ToLower(args[3])
+		reset := language == "reset"
+
+		if !reset && !fenceLanguageRegexp.MatchString(language) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "'" + args[3] + "' isn't a code block language, use i.e. x86asm, armasm or nasm.")
+			return
+		}
+
+		err := updateGuildSettings(scope, func(settings *guildSettings) {
+			if reset {
+				delete(settings.FenceLanguages, key)
+				return
+			}
+
+			if settings.FenceLanguages == nil {
+				settings.FenceLanguages = make(map[string]string)
+			}
+
+			settings.FenceLanguages[key] = language
+		})
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save guild settings, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the settings.")
+			return
+		}
+
+		if reset {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Output for " + key + " is highlighted as the bot's default again.")
+		} else {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Output for " + key + " is now highlighted as " + language + ".")
+		}
+
+		return
+	case "rewards":
+		rewards := getGuildSettings(scope).RoleRewards
+
+		if len(rewards) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There are no reward roles set up.")
+			return
+		}
+
+		var roles []string
+
+		for role := range rewards {
+			roles = append(roles, role)
+		}
+
+		sort.Slice(roles, func(a, b int) bool {
+			return rewards[roles[a]] < rewards[roles[b]]
+		})
+
+		out := ""
+
+		for _, role := range roles {
+			out += "Role " + role + " at " + strconv.Itoa(rewards[role]) + " points\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Reward roles: ```" + out + "```")
+		return
+	case "reward":
+		if len(args) < 4 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings reward [role ID] [points|off]")
+			return
+		}
+
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can change settings.")
+			return
+		}
+
+		if m.GuildID == "" {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Reward roles can only be set up in a server.")
+			return
+		}
+
+		role := strings.TrimSuffix(strings.TrimPrefix(args[2], "<@&"), ">")
+		off := strings.ToLower(args[3]) == "off"
+		threshold, err := strconv.Atoi(args[3])
+
+		if _, idErr := strconv.ParseUint(role, 10, 64); idErr != nil || (!off && (err != nil || threshold <= 0)) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Give the role's ID (or mention it) and a positive number of points, i.e. " + CommandPrefix + "settings reward 123456789 100")
+			return
+		}
+
+		err = updateGuildSettings(scope, func(settings *guildSettings) {
+			if off {
+				delete(settings.RoleRewards, role)
+				return
+			}
+
+			if settings.RoleRewards == nil {
+				settings.RoleRewards = make(map[string]int)
+			}
+
+			settings.RoleRewards[role] = threshold
+		})
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save guild settings, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the settings.")
+			return
+		}
+
+		if off {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Role " + role + " is no longer a reward.")
+		} else {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Users reaching " + strconv.Itoa(threshold) + " points will be given role " + role + ". The bot needs the Manage Roles permission, and its role has to be above the reward role.")
+		}
+
+		return
+	case "channels":
+		restricted := getGuildSettings(scope).ChannelCommands
+
+		if len(restricted) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Every command can be used in any channel.")
+			return
+		}
+
+		var names []string
+
+		for name := range restricted {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		out := ""
+
+		for _, name := range names {
+			var mentions []string
+
+			for _, channel := range restricted[name] {
+				mentions = append(mentions, "<#" + channel + ">")
+			}
+
+			out += CommandPrefix + name + " - " + strings.Join(mentions, ", ") + "\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Commands limited to channels:\n" + out)
+		return
+	case "allow", "disallow":
+		allow := strings.ToLower(args[1]) == "allow"
+
+		if len(args) < 4 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "settings " + strings.ToLower(args[1]) + " [#channel] [command ...]")
+			return
+		}
+
+		if !isGuildAdmin(s, m) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only server admins can change settings.")
+			return
+		}
+
+		if m.GuildID == "" {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Commands can only be limited to channels in a server.")
+			return
+		}
+
+		channel := parseChannelMention(args[2])
+
+		if _, err := strconv.ParseUint(channel, 10, 64); err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Mention the channel (or give its ID), i.e. " + CommandPrefix + "settings allow #re-tools disassemble emulate")
+			return
+		}
+
+		// A deleted channel can still be disallowed, to clean it out of the settings
+		if allow && !isGuildChannel(s, m.GuildID, channel) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, that isn't a channel in this server.")
+			return
+		}
+
+		var names []string
+
+		for _, arg := range args[3:] {
+			name := strings.ToLower(strings.TrimPrefix(arg, CommandPrefix))
+			cmd, ok := findCommand(name)
+
+			if !ok {
+				_, _ = s.ChannelMessageSend(m.ChannelID, "'" + name + "' isn't a command.")
+				return
+			}
+
+			// Settings can't be limited, so admins can't lock themselves out of changing them back
+			if cmd.name == "settings" {
+				_, _ = s.ChannelMessageSend(m.ChannelID, CommandPrefix + "settings can be used in any channel.")
+				return
+			}
+
+			names = append(names, cmd.name)
+		}
+
+		err := updateGuildSettings(scope, func(settings *guildSettings) {
+			if settings.ChannelCommands == nil {
+				settings.ChannelCommands = make(map[string][]string)
+			}
+
+			for _, name := range names {
+				var channels []string
+
+				for _, existing := range settings.ChannelCommands[name] {
+					if existing != channel {
+						channels = append(channels, existing)
+					}
+				}
+
+				if allow {
+					channels = append(channels, channel)
+				}
+
+				if len(channels) == 0 {
+					delete(settings.ChannelCommands, name)
+				} else {
+					settings.ChannelCommands[name] = channels
+				}
+			}
+		})
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save guild settings, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the settings.")
+			return
+		}
+
+		for n, name := range names {
+			names[n] = CommandPrefix + name
+		}
+
+		commands := joinWords(names)
+
+		if allow {
+			_, _ = s.ChannelMessageSend(m.ChannelID, commands + " can now be used in <#" + channel + ">, and only the channels they're allowed in.")
+		} else {
+			_, _ = s.ChannelMessageSend(m.ChannelID, commands + " can no longer be used in <#" + channel + ">. Commands that aren't left in any channel work everywhere again.")
+		}
+
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, usage)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSettingsAliasEmptyExpansion(t *testing.T) {
+	// Only spaces after the name leave nothing to run
+	for _, content := range []string{"!settings alias foo ", "!settings alias foo   "} {
+		f := &fakeResponder{permissions: discordgo.PermissionAdministrator}
+		m := testMessage(content)
+		cmdSettings(cmdArguments{f, m, strings.Split(content, " ")})
+
+		if replies := f.sent(); len(replies) != 1 || !strings.HasPrefix(replies[0].content, "Usage: ") {
+			t.Errorf("%q: got %+v, want the usage", content, replies)
+		}
+	}
+}
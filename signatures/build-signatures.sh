@@ -0,0 +1,143 @@
+#!/bin/bash
+# Builds a signature pack for !funcs from a static library, i.e.
+#   ./signatures/build-signatures.sh glibc-2.36-x64 x64 /usr/lib/x86_64-linux-gnu/libc.a > signatures/glibc-2.36-x64.json
+# Each function's signature is its first 64 bytes, with the bytes relocations fill in as wildcards. Functions with too
+# few fixed bytes to tell apart, and signatures more than one function has, are left out. Needs binutils.
+
+if [ $# -ne 3 ]; then
+	echo "Usage: $0 [pack name] [architecture] [library.a]" >&2
+	exit 2
+fi
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+objdump -t "$3" > "$tmp/symbols"
+objdump -dr "$3" > "$tmp/disassembly"
+
+awk '
+function hexnum(str,    n, i) {
+	n = 0
+
+	for (i = 1; i <= length(str); i++) {
+		n = n * 16 + index("0123456789abcdef", substr(str, i, 1)) - 1
+	}
+
+	return n
+}
+
+function preferred(a, b) {
+	# Prefer the public name of a function with aliases, i.e. printf over _IO_printf
+	match(a, /^_*/); ua = RLENGTH
+	match(b, /^_*/); ub = RLENGTH
+
+	return ua < ub || (ua == ub && length(a) < length(b))
+}
+
+function finish(    n, pattern, fixed) {
+	if (name == "" || count == 0) {
+		return
+	}
+
+	pattern = ""
+	fixed = 0
+
+	for (n = 0; n < count; n++) {
+		pattern = pattern (n ? " " : "") (n in masked ? "??" : toupper(bytes[n]))
+		fixed += !(n in masked)
+	}
+
+	if (fixed >= 12) {
+		if (pattern in names && names[pattern] != name) {
+			ambiguous[pattern] = 1
+		}
+
+		names[pattern] = name
+	}
+
+	name = ""
+}
+
+# objdump -t: "0000000000000000 g     F .text	00000000000000c2 _IO_printf", grouped by member, section and address
+FNR == NR {
+	if (/^In archive/ || $0 ~ /:     file format/) {
+		member = $1
+	}
+
+	if ($0 ~ / F / && $NF != "") {
+		split($0, parts, "\t")
+		split(parts[1], fields, " ")
+		key = member " " fields[length(fields)] " " $1
+
+		if (!(key in alias) || preferred($NF, alias[key])) {
+			alias[key] = $NF
+		}
+
+		byname[member " " $NF] = key
+	}
+
+	next
+}
+
+/:     file format/ {
+	finish()
+	member = $1
+}
+
+/^Disassembly of section / {
+	finish()
+	section = substr($4, 1, length($4) - 1)
+}
+
+# A function label, "0000000000000000 <_IO_printf>:"
+/^[0-9a-f]+ <.*>:$/ {
+	finish()
+	label = substr($2, 2, length($2) - 3)
+	key = byname[member " " label]
+	name = (key in alias) ? alias[key] : label
+	start = hexnum($1)
+	count = 0
+	delete bytes
+	delete masked
+}
+
+# An instruction or the rest of a long one, "   7:	48 89 74 24 28       	mov    %rsi,0x28(%rsp)"
+/^ +[0-9a-f]+:\t[0-9a-f][0-9a-f]( |\t|$)/ && name != "" {
+	split($0, parts, "\t")
+	n = split(parts[2], hex, " ")
+
+	for (i = 1; i <= n && count < 64; i++) {
+		bytes[count++] = hex[i]
+	}
+}
+
+# A relocation, "			7c: R_X86_64_PC32	stdout-0x4"
+/^\t\t\t[0-9a-f]+: R_/ && name != "" {
+	offset = hexnum(substr($1, 1, length($1) - 1)) - start
+	size = ($2 ~ /64$/) ? 8 : 4
+
+	for (i = offset; i < offset + size; i++) {
+		masked[i] = 1
+	}
+}
+
+END {
+	finish()
+
+	for (pattern in names) {
+		if (!(pattern in ambiguous)) {
+			print names[pattern] "\t" pattern
+		}
+	}
+}' "$tmp/symbols" "$tmp/disassembly" | sort | awk -F '\t' -v pack="$1" -v arch="$2" '
+BEGIN {
+	printf "{\n\t\"name\": \"%s\",\n\t\"arch\": \"%s\",\n\t\"signatures\": [", pack, arch
+}
+
+{
+	printf "%s\n\t\t{\"name\": \"%s\", \"pattern\": \"%s\"}", (NR > 1 ? "," : ""), $1, $2
+}
+
+END {
+	print "\n\t]\n}"
+}'
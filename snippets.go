@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Max number of snippets a single guild can save
+const maxSnippetsPerGuild = 100
+
+// A saved assembly snippet or byte blob
+type snippet struct {
+	Content string    `json:"content"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+}
+
+// Stores snippets per scope (guild, or user for DMs), then by name
+var (
+	snippetMap  map[string]map[string]snippet
+	snippetLock sync.RWMutex
+)
+
+// Snippet names are kept simple so they can be referenced inline
+var snippetNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,32}$`)
+
+// Matches a snippet reference in command arguments, i.e. "@snippet:stage1"
+var snippetRefRegexp = regexp.MustCompile(`^@snippet:([A-Za-z0-9_\-]{1,32})$`)
+
+// Loads saved snippets from the data directory
+func loadSnippets() {
+	snippets := make(map[string]map[string]snippet)
+
+	if err := loadStore("snippets", &snippets); err != nil {
+		fmt.Println("[ERROR] Failed to load snippets, " + err.Error())
+	}
+
+	snippetLock.Lock()
+	snippetMap = snippets
+	snippetLock.Unlock()
+}
+
+// Returns the scope snippets and other per-guild data are stored under, DMs are scoped to the user
+func guildScope(m *discordgo.MessageCreate) string {
+	if m.GuildID == "" {
+		return "user:" + m.Author.ID
+	}
+
+	return m.GuildID
+}
+
+// Looks up a snippet in the given scope
+func getSnippet(scope string, name string) (snippet, bool) {
+	snippetLock.RLock()
+	defer snippetLock.RUnlock()
+
+	sn, ok := snippetMap[scope][strings.ToLower(name)]
+	return sn, ok
+}
+
+// Replaces any @snippet:name arguments with the snippet's content, returns an error naming the first unknown snippet
+func expandSnippets(scope string, args []string) ([]string, error) {
+	var expanded []string
+
+	for _, arg := range args {
+		match := snippetRefRegexp.FindStringSubmatch(arg)
+
+		if match == nil {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		sn, ok := getSnippet(scope, match[1])
+
+		if !ok {
+			return nil, fmt.Errorf("There is no snippet named '%s'.", match[1])
+		}
+
+		// Split like the message was, so the lines of a multi-line snippet stay apart
+		for _, part := range strings.Split(sn.Content, " ") {
+			if part != "" {
+				expanded = append(expanded, part)
+			}
+		}
+	}
+
+	return expanded, nil
+}
+
+// Returns the text of a !save message after the snippet's name, as it was typed. Falls back to the arguments when
+// the message doesn't start with the name, i.e. when a guild alias put it there.
+func snippetContent(m *discordgo.MessageCreate, args []string) string {
+	content := strings.TrimLeft(m.Content, " \t\n")
+
+	// Skip the command, then the name
+	for n := 0; n < 2; n++ {
+		end := strings.IndexAny(content, " \t\n")
+
+		if end < 0 || (n == 1 && !strings.EqualFold(content[:end], args[1])) {
+			return strings.Join(args[2:], " ")
+		}
+
+		content = strings.TrimLeft(content[end:], " \t\n")
+	}
+
+	return strings.TrimRight(content, " \t\n")
+}
+
+// Saves a snippet for the guild. Only whoever saved a snippet, or a server admin, can save over it.
+func cmdSave(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	name := strings.ToLower(args[1])
+
+	if !snippetNameRegexp.MatchString(name) {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Snippet names can only contain letters, numbers, '_' and '-', and must be at most 32 characters.")
+		return
+	}
+
+	scope := guildScope(m)
+
+	// Checking for an admin asks Discord, so it's done before taking the lock
+	existing, exists := getSnippet(scope, name)
+	admin := exists && existing.Author != m.Author.ID && isGuildAdmin(s, m)
+
+	snippetLock.Lock()
+
+	if snippetMap[scope] == nil {
+		snippetMap[scope] = make(map[string]snippet)
+	}
+
+	if existing, ok := snippetMap[scope][name]; ok && existing.Author != m.Author.ID && !admin {
+		snippetLock.Unlock()
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, the snippet '" + name + "' was saved by someone else, pick another name.")
+		return
+	}
+
+	if _, exists := snippetMap[scope][name]; !exists && len(snippetMap[scope]) >= maxSnippetsPerGuild {
+		snippetLock.Unlock()
+		_, _ = s.ChannelMessageSend(m.ChannelID, limitError{"snippets", len(snippetMap[scope]) + 1, maxSnippetsPerGuild}.Error())
+		return
+	}
+
+	snippetMap[scope][name] = snippet{
+		Content: snippetContent(m, args),
+		Author:  m.Author.ID,
+		Created: time.Now(),
+	}
+
+	err := saveStore("snippets", snippetMap)
+	snippetLock.Unlock()
+
+	if err != nil {
+		fmt.Println("[ERROR] Failed to save snippets, " + err.Error())
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save the snippet.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Saved! Use `@snippet:" + name + "` in a command to use it.")
+}
+
+// Shows a saved snippet
+func cmdGet(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	sn, ok := getSnippet(guildScope(m), args[1])
+
+	if !ok {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "There is no snippet named '" + args[1] + "'.")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "```" + sn.Content + "```")
+}
+
+// Lists the guild's saved snippets
+func cmdList(params cmdArguments) {
+	s := params.s
+	m := params.m
+
+	snippetLock.RLock()
+	var names []string
+
+	for name := range snippetMap[guildScope(m)] {
+		names = append(names, name)
+	}
+
+	snippetLock.RUnlock()
+
+	if len(names) == 0 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "There are no saved snippets yet. Save one with " + CommandPrefix + "save [name] {content ...}")
+		return
+	}
+
+	sort.Strings(names)
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Saved snippets: ```" + strings.Join(names, ", ") + "```")
+}
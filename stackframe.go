@@ -0,0 +1,547 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/i509VCB/REBot/pkg/asm"
+)
+
+// Largest function !stackframe analyzes
+const maxStackframeBytes = 512
+
+// Something in a stack frame, at an offset from the stack pointer when the function was entered
+type frameSlot struct {
+	offset int64
+	size   int
+
+	// "ret" is the return address, then "saved", "canary", "arg", "local", "buffer" (a local whose address is
+	// taken, so its size is a guess) and "pushed" for pushes in the function's body
+	kind  string
+	label string
+}
+
+// A function's stack frame, worked out by !stackframe from its prologue and the stack accesses in it
+type stackFrame struct {
+	family string
+	cc     callingConvention
+
+	// Size of a stack slot, and how much of it the call pushed for the return address
+	slot    int
+	retSize int
+
+	// Where the frame pointer and the stack pointer are after the prologue, from the stack pointer on entry
+	hasFP   bool
+	fpDelta int64
+	spDelta int64
+
+	slots map[int64]*frameSlot
+}
+
+// Returns the size of a stack slot on the architecture
+func stackSlotBytes(arch string) int {
+	switch arch {
+	case "x86_16":
+		return 2
+	case "x86", "arm", "thumb":
+		return 4
+	}
+
+	return 8
+}
+
+// Parses an immediate operand like "0x30" or "#-0x10"
+func immediateOperand(op asmOperand) (int64, bool) {
+	if op.reg != "" || op.mem != "" || op.list != nil {
+		return 0, false
+	}
+
+	value, err := strconv.ParseInt(strings.TrimPrefix(op.text, "#"), 0, 64)
+	return value, err == nil
+}
+
+// Adds something found in the frame. The return address, saved registers and the canary aren't replaced by the
+// locals the code happens to read them as, and a local becomes a buffer when its address is taken.
+func (f *stackFrame) add(offset int64, size int, kind string, label string) {
+	slot, ok := f.slots[offset]
+
+	if !ok {
+		f.slots[offset] = &frameSlot{offset, size, kind, label}
+		return
+	}
+
+	if size > slot.size {
+		slot.size = size
+	}
+
+	switch {
+	case StrList{"ret", "saved", "canary"}.contains(slot.kind):
+	case StrList{"ret", "saved", "canary"}.contains(kind), kind == "buffer" && slot.kind == "local":
+		slot.kind, slot.label = kind, label
+	case kind == slot.kind && slot.label == "local":
+		slot.label = label
+	}
+}
+
+// Labels a stack access at the offset, as an argument above the return address or a local below it
+func (f *stackFrame) access(offset int64, size int, kind string, label string) {
+	if offset < int64(f.retSize) {
+		f.add(offset, size, kind, label)
+		return
+	}
+
+	// Arguments past the register ones are above the return address, Microsoft x64 leaves room for the register
+	// ones there too
+	n := int(offset - int64(f.retSize)) / f.slot + 1
+
+	if f.cc.shadowSpace && n <= len(f.cc.args) {
+		f.add(offset, size, "arg", "home of arg " + strconv.Itoa(n) + " (shadow space)")
+	} else if f.cc.shadowSpace {
+		f.add(offset, size, "arg", "arg " + strconv.Itoa(n))
+	} else {
+		f.add(offset, size, "arg", "arg " + strconv.Itoa(len(f.cc.args) + n))
+	}
+}
+
+// Works out a function's stack frame by following the stack pointer through it
+func analyzeStackFrame(arch string, ins []asm.Insn) *stackFrame {
+	family := instructionFamily(arch)
+	explained := explainInstructions(arch, ins)
+	cc := detectCallingConvention(arch, explained)
+	flow := explainDataflow(family, cc, explained)
+
+	f := &stackFrame{family: family, cc: cc, slot: stackSlotBytes(arch), slots: make(map[int64]*frameSlot)}
+
+	// The call pushes the return address on x86, ARM keeps it in the link register until the function saves it
+	if family == "x86" {
+		f.retSize = f.slot
+		f.add(0, f.slot, "ret", "return address")
+	}
+
+	delta := int64(0)
+	body := false
+	written := make(map[string]bool)
+	canary := make(map[string]bool)
+
+	isSP := func(reg string) bool {
+		return sameRegister(family, reg, cc.sp)
+	}
+
+	// A register stored before the function wrote to it is being saved for the caller
+	save := func(offset int64, reg string) bool {
+		switch {
+		case written[canonicalRegister(family, reg)]:
+			return false
+		case sameRegister(family, reg, "lr") || sameRegister(family, reg, "x30"):
+			f.add(offset, f.slot, "ret", "return address (saved " + reg + ")")
+		case canary[canonicalRegister(family, reg)]:
+			f.add(offset, f.slot, "canary", "stack canary")
+		case !body || registerIndex(family, cc.calleeSaved, reg) >= 0:
+			f.add(offset, f.slot, "saved", "saved " + reg)
+		default:
+			return false
+		}
+
+		return true
+	}
+
+	// The prologue lasts until the first branch, the stack pointer after it is where the frame ends
+	prologue := true
+
+	for n, e := range explained {
+		ops := e.ops
+		setup := e.frameSetup(family, cc)
+		body = body || !setup && e.base != "nop"
+
+		if e.ret {
+			// Code after a return is reached by a branch from the body, with the frame still in place
+			delta = f.spDelta
+			continue
+		}
+
+		// Locals that hold a copy of one of the function's register arguments, and pushes of a call's arguments
+		label, pushed := "local", "pushed"
+		for _, note := range flow[n] {
+			if note.kind == "incoming" && !strings.HasPrefix(note.from, "[") {
+				label = "local, arg " + strconv.Itoa(note.arg) + " from " + note.from
+			} else if note.kind == "stack arg" {
+				pushed = "arg " + strconv.Itoa(note.arg) + " of a call"
+			}
+		}
+
+		// Set when the instruction makes room in the frame, rather than pushing an argument
+		grows := false
+
+		switch {
+		case family == "x86" && e.base == "push" && len(ops) == 1:
+			delta -= int64(f.slot)
+			if ops[0].reg != "" && save(delta, ops[0].reg) {
+				grows = true
+			} else {
+				f.add(delta, f.slot, "pushed", pushed)
+			}
+		case family == "x86" && e.base == "pop":
+			delta += int64(f.slot)
+		case e.base == "leave":
+			delta = f.fpDelta + int64(f.slot)
+		case (e.base == "push" || e.base == "pop") && len(ops) == 1 && ops[0].list != nil:
+			size := int64(4 * len(ops[0].list))
+
+			if e.base == "pop" {
+				delta += size
+				break
+			}
+
+			// The lowest register is stored lowest
+			delta -= size
+			grows = true
+
+			for i, reg := range ops[0].list {
+				if !save(delta + int64(4 * i), reg) {
+					f.add(delta + int64(4 * i), 4, "pushed", "pushed " + reg)
+				}
+			}
+		case (e.base == "sub" || e.base == "add") && len(ops) > 1 && isSP(ops[0].reg) && (len(ops) == 2 || isSP(ops[1].reg)):
+			if value, ok := immediateOperand(ops[len(ops) - 1]); ok && e.base == "sub" {
+				delta -= value
+				grows = true
+			} else if ok {
+				delta += value
+			}
+		case (e.base == "mov" || e.base == "add") && len(ops) > 1 && sameRegister(family, ops[0].reg, cc.fp) && isSP(ops[1].reg):
+			f.hasFP, f.fpDelta = true, delta
+
+			if value, ok := immediateOperand(ops[len(ops) - 1]); ok && len(ops) == 3 {
+				f.fpDelta += value
+			}
+		case e.base == "mov" && len(ops) == 2 && isSP(ops[0].reg) && sameRegister(family, ops[1].reg, cc.fp):
+			delta = f.fpDelta
+		case (e.base == "add" || e.base == "sub") && len(ops) == 3 && !isSP(ops[0].reg):
+			// ARM takes the address of a local with add r0, sp, #8 or sub r0, r11, #0x20
+			value, ok := immediateOperand(ops[2])
+			base := delta
+
+			if sameRegister(family, ops[1].reg, cc.fp) && f.hasFP {
+				base = f.fpDelta
+			} else if !isSP(ops[1].reg) {
+				ok = false
+			}
+
+			if e.base == "sub" {
+				value = -value
+			}
+
+			if ok {
+				f.access(base + value, 0, "buffer", "buffer")
+			}
+		}
+
+		// Loads and stores relative to the stack or frame pointer
+		for i, op := range ops {
+			base, offset, ok := baseOffset(op)
+
+			if !ok || op.segment != "" || (i == 0 && family == "x86" && e.base == "push") {
+				continue
+			}
+
+			switch {
+			case isSP(base):
+			case sameRegister(family, base, cc.fp) && f.hasFP:
+				offset += f.fpDelta - delta
+			default:
+				continue
+			}
+
+			// ARM's pre-indexed addresses move the stack pointer first, and post-indexed ones after
+			post := int64(0)
+			if op.writeback && isSP(base) {
+				grows = offset < 0
+				delta += offset
+				offset = 0
+			} else if i + 1 < len(ops) && isSP(base) && family != "x86" {
+				post, _ = immediateOperand(ops[i + 1])
+			}
+
+			at := delta + offset
+
+			switch {
+			case family == "x86" && e.base == "lea":
+				f.access(at, 0, "buffer", "buffer")
+			case family == "x86" && i == 0 && len(ops) == 2 && ops[1].reg != "" && canary[canonicalRegister(family, ops[1].reg)]:
+				f.add(at, x86OperandBytes[op.size], "canary", "stack canary")
+			case family == "x86":
+				f.access(at, x86OperandBytes[op.size], "local", label)
+			default:
+				// ARM loads and stores have their registers before the address, two for pairs
+				for r, reg := range ops[:i] {
+					size := armAccessBytes(e.access, false, reg.reg)
+					if e.base == "ldr" || e.base == "ldp" || !save(at + int64(r * size), reg.reg) {
+						f.access(at + int64(r * size), size, "local", label)
+					}
+				}
+			}
+
+			delta += post
+		}
+
+		prologue = prologue && !e.call && !e.jump
+		if prologue && grows {
+			f.spDelta = delta
+		}
+
+		// The canary is loaded into a register to be stored in the frame
+		if reg := canonicalRegister(family, e.writes()); reg != "" {
+			loads := false
+			for _, op := range ops[1:] {
+				loads = loads || isStackCanary(op)
+			}
+
+			if loads {
+				canary[reg] = true
+			} else {
+				delete(canary, reg)
+				written[reg] = true
+			}
+		}
+	}
+
+	return f
+}
+
+// Returns the frame's slots from the lowest address up, with the gaps between them filled in and buffers sized to
+// the next thing above them
+func (f *stackFrame) layout() []frameSlot {
+	var sorted []frameSlot
+	for _, slot := range f.slots {
+		sorted = append(sorted, *slot)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].offset < sorted[j].offset
+	})
+
+	protected := StrList{"ret", "saved", "canary"}
+	var slots []frameSlot
+
+	for n, slot := range sorted {
+		if slot.size == 0 {
+			slot.size = f.slot
+			if n + 1 < len(sorted) {
+				slot.size = int(sorted[n + 1].offset - slot.offset)
+			}
+		}
+
+		// Accesses inside something already in the frame are part of it
+		if len(slots) > 0 {
+			last := &slots[len(slots) - 1]
+			end := last.offset + int64(last.size)
+
+			if slot.offset < end && !protected.contains(slot.kind) {
+				continue
+			} else if slot.offset < end {
+				last.size = int(slot.offset - last.offset)
+			}
+		}
+
+		slots = append(slots, slot)
+	}
+
+	bottom := f.spDelta
+	if len(slots) > 0 && slots[0].offset < bottom {
+		bottom = slots[0].offset
+	}
+
+	var filled []frameSlot
+
+	for _, slot := range slots {
+		if slot.offset > bottom {
+			filled = append(filled, frameSlot{offset: bottom, size: int(slot.offset - bottom), kind: "gap", label: "(not accessed)"})
+		}
+
+		filled = append(filled, slot)
+		bottom = slot.offset + int64(slot.size)
+	}
+
+	return filled
+}
+
+// Describes what overflowing a buffer runs into, the distances are counted from the start of the buffer
+func overflowNote(buffer frameSlot, slots []frameSlot) string {
+	var reaches []string
+
+	for _, slot := range slots {
+		if slot.offset <= buffer.offset {
+			continue
+		}
+
+		switch slot.kind {
+		case "canary":
+			reaches = append(reaches, "the canary after " + strconv.FormatInt(slot.offset - buffer.offset, 10) + " bytes")
+		case "ret":
+			reaches = append(reaches, "the return address after " + strconv.FormatInt(slot.offset - buffer.offset, 10))
+		}
+
+		if slot.kind == "ret" {
+			break
+		}
+	}
+
+	if len(reaches) == 0 {
+		for _, slot := range slots {
+			if slot.kind == "ret" && slot.offset < buffer.offset {
+				return "the return address is saved below it, overflowing it runs into the caller's frame"
+			}
+		}
+
+		return ""
+	}
+
+	return "overflowing it reaches " + joinWords(reaches)
+}
+
+// Draws the frame as an ASCII diagram, higher addresses at the top, with offsets from the frame pointer if the
+// function sets one up and the stack pointer after the prologue if it doesn't
+func (f *stackFrame) render() string {
+	slots := f.layout()
+
+	ref, refDelta := f.cc.sp, f.spDelta
+	if f.hasFP {
+		ref, refDelta = f.cc.fp, f.fpDelta
+	}
+
+	offsets := make([]string, len(slots))
+	labels := make([]string, len(slots))
+	sizes := make([]string, len(slots))
+	notes := make([]string, len(slots))
+	offsetWidth, labelWidth, sizeWidth := 0, 0, 0
+
+	for n, slot := range slots {
+		switch rel := slot.offset - refDelta; {
+		case rel > 0:
+			offsets[n] = ref + "+0x" + strconv.FormatInt(rel, 16)
+		case rel < 0:
+			offsets[n] = ref + "-0x" + strconv.FormatInt(-rel, 16)
+		default:
+			offsets[n] = ref
+		}
+
+		labels[n] = slot.label
+		sizes[n] = strconv.Itoa(slot.size) + " bytes"
+
+		if slot.size == 1 {
+			sizes[n] = "1 byte"
+		} else if slot.kind == "buffer" {
+			sizes[n] = "up to " + sizes[n]
+		}
+
+		var side, points []string
+		contains := func(delta int64) bool {
+			return delta >= slot.offset && delta < slot.offset + int64(slot.size)
+		}
+
+		if f.hasFP && contains(f.fpDelta) {
+			points = append(points, f.cc.fp)
+		}
+
+		if contains(f.spDelta) {
+			points = append(points, f.cc.sp)
+		}
+
+		// Leaf functions on System V can use the 128 bytes under the stack pointer without moving it
+		below := slot.offset + int64(slot.size) <= f.spDelta && slot.kind != "pushed"
+
+		switch {
+		case len(points) > 0:
+			side = append(side, "<- " + strings.Join(points, ", "))
+		case below && f.cc.name == "System V":
+			side = append(side, "below " + f.cc.sp + ", in the red zone")
+		case below:
+			side = append(side, "below " + f.cc.sp)
+		}
+
+		if slot.kind == "buffer" {
+			if note := overflowNote(slot, slots); note != "" {
+				side = append(side, note)
+			}
+		}
+
+		notes[n] = strings.Join(side, "; ")
+
+		if len(offsets[n]) > offsetWidth {
+			offsetWidth = len(offsets[n])
+		}
+
+		if len(labels[n]) > labelWidth {
+			labelWidth = len(labels[n])
+		}
+
+		if len(sizes[n]) > sizeWidth {
+			sizeWidth = len(sizes[n])
+		}
+	}
+
+	border := strings.Repeat(" ", offsetWidth + 2) + "+" + strings.Repeat("-", labelWidth + sizeWidth + 4) + "+\n"
+	out := border
+
+	for n := len(slots) - 1; n >= 0; n-- {
+		line := padRight(offsets[n], " ", offsetWidth + 2) + "| " + padRight(labels[n], " ", labelWidth + 1) + " " +
+			padLeft(sizes[n], " ", sizeWidth) + " |"
+
+		if notes[n] != "" {
+			line += " " + notes[n]
+		}
+
+		out += line + "\n" + border
+	}
+
+	return out
+}
+
+// Draws the stack frame of a function from its prologue and the way it accesses the stack
+func cmdStackframe(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	asmArch, rest := splitArchitectureArgs(m.Author.ID, args)
+
+	if instructionFamily(asmArch) == "" {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(asm.ErrArchNotSupported, explainArchs))
+		return
+	}
+
+	code, err := parseOpcodes(strings.Join(rest, ""))
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, explainArchs))
+		return
+	}
+
+	if !checkLimit(s, m.ChannelID, "bytes for a stack frame", len(code), maxStackframeBytes) {
+		return
+	}
+
+	ins, err := disassemble(asmArch, code, asmOptions{detail: true})
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, asmErrorMessage(err, explainArchs))
+		return
+	}
+
+	frame := analyzeStackFrame(asmArch, ins)
+
+	if !frame.hasFP && frame.spDelta == 0 && len(frame.slots) <= 1 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, I couldn't find a stack frame in that code. Give me the function from its prologue, i.e. `push rbp; mov rbp, rsp; sub rsp, 0x20`.")
+		return
+	}
+
+	content := "Stack frame"
+	if frame.cc.name != "" {
+		content += " (" + frame.cc.name + ")"
+	}
+
+	content += ", higher addresses at the top. It's worked out from the prologue and the stack accesses in the code, so buffer sizes are a guess:"
+
+	sendListing(s, m.ChannelID, content, "stackframe.txt", frame.render())
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Serializes access to the files in the data directory
+var storeLock sync.Mutex
+
+// Returns the directory persistent data is kept in, configured in the [storage] section of config.ini
+func storeDir() string {
+	dir := getConfigPropertyAsStr("storage", "dir")
+
+	if dir == "" {
+		dir = "./data"
+	}
+
+	return dir
+}
+
+// Decodes the named JSON store into v, a store that doesn't exist yet leaves v untouched
+func loadStore(name string, v interface{}) error {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	raw, err := ioutil.ReadFile(filepath.Join(storeDir(), name + ".json"))
+
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+// Encodes v into the named JSON store. The file is replaced atomically so a crash can't leave it half written.
+func saveStore(name string, v interface{}) error {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	raw, err := json.MarshalIndent(v, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	dir := storeDir()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, name + ".json.tmp")
+
+	if err := ioutil.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(dir, name + ".json"))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Only one sync runs at a time, whether it was scheduled or asked for with !trick sync
+var trickSyncLock sync.Mutex
+
+// Client used to download trick files, so a hanging server can't hold up the sync forever
+var trickSyncClient = &http.Client{Timeout: 30 * time.Second}
+
+// Returns the files to sync, relative to both the configured URL and the tricks directory
+func trickSyncFiles() []string {
+	var files []string
+
+	for _, kind := range trickKinds {
+		files = append(files, kind + ".json")
+	}
+
+	for _, pack := range strings.Fields(strings.Replace(getConfigPropertyAsStr("tricks", "sync_packs"), ",", " ", -1)) {
+		files = append(files, "packs/" + strings.ToLower(pack) + ".json")
+	}
+
+	return files
+}
+
+// Downloads a trick file, making sure it parses before it's used
+func fetchTrickFile(url string, file string) ([]byte, error) {
+	resp, err := trickSyncClient.Get(url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(file + ": server returned " + resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(file, "packs/") {
+		err = json.Unmarshal(data, &trickPack{})
+	} else {
+		err = json.Unmarshal(data, &[]trick{})
+	}
+
+	if err != nil {
+		return nil, errors.New(file + ": " + err.Error())
+	}
+
+	return data, nil
+}
+
+// Pulls the trick files from the URL configured in [tricks] sync_url, i.e. the raw URL of a GitHub repo's branch
+// or of a gist, then reloads the tricks if any of them changed. Returns the number of files that were updated.
+func syncTricks() (int, error) {
+	base := strings.TrimRight(getConfigPropertyAsStr("tricks", "sync_url"), "/")
+
+	if base == "" {
+		return 0, errors.New("no sync URL is configured")
+	}
+
+	trickSyncLock.Lock()
+	defer trickSyncLock.Unlock()
+
+	dir := tricksDir()
+	updated := 0
+
+	// Every file is downloaded and checked before any are written, so a broken commit upstream changes nothing
+	downloaded := make(map[string][]byte)
+
+	for _, file := range trickSyncFiles() {
+		data, err := fetchTrickFile(base + "/" + file, file)
+
+		if err != nil {
+			return 0, err
+		}
+
+		downloaded[file] = data
+	}
+
+	for file, data := range downloaded {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+
+		if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return updated, err
+		}
+
+		if err := ioutil.WriteFile(path + ".tmp", data, 0644); err != nil {
+			return updated, err
+		}
+
+		if err := os.Rename(path + ".tmp", path); err != nil {
+			return updated, err
+		}
+
+		updated++
+	}
+
+	if updated > 0 {
+		loadTricks()
+	}
+
+	return updated, nil
+}
+
+// Syncs the tricks periodically if a sync URL is configured
+func startTrickSync() {
+	if getConfigPropertyAsStr("tricks", "sync_url") == "" {
+		return
+	}
+
+	interval := time.Duration(getConfigPropertyAsInt("tricks", "sync_minutes", 60)) * time.Minute
+
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		for {
+			updated, err := syncTricks()
+
+			if err != nil {
+				fmt.Println("[ERROR] Failed to sync tricks, " + err.Error())
+			} else if updated > 0 {
+				fmt.Println("[INFO] Synced tricks, " + strconv.Itoa(updated) + " files updated.")
+			}
+
+			time.Sleep(interval)
+		}
+	}()
+
+	fmt.Println("[INFO] Syncing tricks every " + interval.String() + ".")
+}
@@ -0,0 +1,842 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A single trick, loaded from a JSON file in the tricks directory
+type trick struct {
+	// Unique across every data file and approved submission, so a trick can be recalled with "!trick <id>"
+	ID       int    `json:"id"`
+	Category string `json:"category"`
+	Text     string `json:"text"`
+
+	// Who to credit for the trick, and screenshots that go with it
+	Author string   `json:"author,omitempty"`
+	Images []string `json:"images,omitempty"`
+
+	// Set from the file (or submission) the trick came from
+	Kind string `json:"-"`
+}
+
+// Trick kinds, each loaded from "<kind>.json" in the tricks directory
+const (
+	trickKindRE      = "re"
+	trickKindExploit = "exploit"
+)
+
+var trickKinds = []string{trickKindRE, trickKindExploit}
+
+// Categories tricks of each kind can be filed under, tricks without one are "general"
+var trickCategories = map[string][]string{
+	trickKindRE:      {"general", "ida", "ghidra", "binja", "gdb", "x86", "arm", "malware"},
+	trickKindExploit: {"general", "heap", "rop", "shellcode", "kernel", "fmtstr", "patching", "x86", "gdb"},
+}
+
+// A curated pack of tool-specific tricks, loaded from "packs/<name>.json" in the tricks directory.
+// Packs are off until a guild enables them, and their tricks are filed under the pack's name as the category.
+type trickPack struct {
+	Name        string  `json:"-"`
+	Description string  `json:"description"`
+	Kind        string  `json:"kind"`
+	Tricks      []trick `json:"tricks"`
+}
+
+// Loaded tricks by kind, "re" tricks are given by !retrick and "exploit" tricks by !exploittrick
+var (
+	trickMap   = make(map[string][]trick)
+	trickPacks = make(map[string]trickPack)
+	trickLock  sync.RWMutex
+)
+
+// Longest trick text that can be submitted, and the most screenshots that can be attached to it
+const (
+	maxTrickLength = 1000
+	maxTrickImages = 4
+)
+
+// Review states of a submitted trick
+const (
+	trickPending  = "pending"
+	trickApproved = "approved"
+	trickRejected = "rejected"
+)
+
+// A trick submitted with !trick submit. Approved submissions are given out alongside the tricks from the data files.
+type trickSubmission struct {
+	ID         int       `json:"id"`
+	Kind       string    `json:"kind"`
+	Category   string    `json:"category"`
+	Text       string    `json:"text"`
+	Images     []string  `json:"images,omitempty"`
+	Author     string    `json:"author"`
+	AuthorName string    `json:"author_name"`
+	Submitted  time.Time `json:"submitted"`
+	Status     string    `json:"status"`
+	Reviewer   string    `json:"reviewer,omitempty"`
+}
+
+// Every trick submission, persisted under the "trick_submissions" store
+type trickQueue struct {
+	NextID      int               `json:"next_id"`
+	Submissions []trickSubmission `json:"submissions"`
+}
+
+var (
+	submissions    trickQueue
+	submissionLock sync.Mutex
+)
+
+// Returns the directory trick files are read from
+func tricksDir() string {
+	dir := getConfigPropertyAsStr("tricks", "dir")
+	if dir == "" {
+		dir = "./tricks"
+	}
+
+	return dir
+}
+
+// Reads a list of tricks of the given kind from a JSON file
+func readTricks(path string, kind string) ([]trick, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tricks []trick
+	if err := json.Unmarshal(data, &tricks); err != nil {
+		return nil, err
+	}
+
+	// Drop blank entries so they never get picked
+	kept := tricks[:0]
+	for i, t := range tricks {
+		if t.Text == "" {
+			continue
+		}
+
+		if t.ID <= 0 {
+			fmt.Println("[ERROR] Trick " + strconv.Itoa(i + 1) + " in " + path + " has no ID, skipping it")
+			continue
+		}
+
+		t.Kind = kind
+
+		if t.Category == "" {
+			t.Category = "general"
+		} else if !isTrickCategory(kind, t.Category) {
+			fmt.Println("[ERROR] Unknown " + kind + " trick category '" + t.Category + "' in " + path + ", filing it under general")
+			t.Category = "general"
+		}
+
+		kept = append(kept, t)
+	}
+
+	return kept, nil
+}
+
+// Loads the trick files from the configured directory
+func loadTricks() {
+	loadTricksFrom(tricksDir())
+}
+
+// Loads the trick files, keeping the previously loaded tricks for any file that fails to load
+func loadTricksFrom(dir string) {
+	seen := make(map[int]bool)
+
+	for _, kind := range trickKinds {
+		tricks, err := readTricks(filepath.Join(dir, kind + ".json"), kind)
+		if err != nil {
+			fmt.Println("[ERROR] Failed to load " + kind + " tricks, " + err.Error())
+			continue
+		}
+
+		// IDs have to stay unique for "!trick <id>" to be useful, the first trick with an ID wins
+		unique := tricks[:0]
+		for _, t := range tricks {
+			if seen[t.ID] {
+				fmt.Println("[ERROR] Duplicate trick ID #" + strconv.Itoa(t.ID) + " in " + kind + ".json, skipping it")
+				continue
+			}
+
+			seen[t.ID] = true
+			unique = append(unique, t)
+		}
+
+		trickLock.Lock()
+		trickMap[kind] = unique
+		trickLock.Unlock()
+	}
+
+	packs, err := readTrickPacks(filepath.Join(dir, "packs"))
+	if err != nil {
+		fmt.Println("[ERROR] Failed to load trick packs, " + err.Error())
+		return
+	}
+
+	for _, name := range sortedPackNames(packs) {
+		pack := packs[name]
+
+		unique := pack.Tricks[:0]
+		for _, t := range pack.Tricks {
+			if seen[t.ID] {
+				fmt.Println("[ERROR] Duplicate trick ID #" + strconv.Itoa(t.ID) + " in the " + name + " pack, skipping it")
+				continue
+			}
+
+			seen[t.ID] = true
+			unique = append(unique, t)
+		}
+
+		pack.Tricks = unique
+		packs[name] = pack
+	}
+
+	trickLock.Lock()
+	trickPacks = packs
+	trickLock.Unlock()
+}
+
+// Reads every trick pack in the directory, a missing directory just means there are no packs
+func readTrickPacks(dir string) (map[string]trickPack, error) {
+	packs := make(map[string]trickPack)
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return packs, err
+	}
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return packs, err
+		}
+
+		var pack trickPack
+		if err := json.Unmarshal(data, &pack); err != nil {
+			return packs, errors.New(filepath.Base(path) + ": " + err.Error())
+		}
+
+		pack.Name = strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".json"))
+
+		if !isTrickKind(pack.Kind) {
+			fmt.Println("[ERROR] Trick pack " + pack.Name + " has unknown kind '" + pack.Kind + "', skipping it")
+			continue
+		}
+
+		kept := pack.Tricks[:0]
+		for i, t := range pack.Tricks {
+			if t.Text == "" {
+				continue
+			}
+
+			if t.ID <= 0 {
+				fmt.Println("[ERROR] Trick " + strconv.Itoa(i + 1) + " in the " + pack.Name + " pack has no ID, skipping it")
+				continue
+			}
+
+			t.Kind = pack.Kind
+			t.Category = pack.Name
+			kept = append(kept, t)
+		}
+
+		pack.Tricks = kept
+		packs[pack.Name] = pack
+	}
+
+	return packs, nil
+}
+
+// Returns the names of the packs in alphabetical order
+func sortedPackNames(packs map[string]trickPack) []string {
+	var names []string
+
+	for name := range packs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Returns the names of every loaded trick pack
+func trickPackNames() []string {
+	trickLock.RLock()
+	defer trickLock.RUnlock()
+
+	return sortedPackNames(trickPacks)
+}
+
+// Looks up a loaded trick pack
+func getTrickPack(name string) (trickPack, bool) {
+	trickLock.RLock()
+	defer trickLock.RUnlock()
+
+	pack, ok := trickPacks[name]
+	return pack, ok
+}
+
+// Returns the highest ID used by the trick files
+func maxFileTrickID() int {
+	trickLock.RLock()
+	defer trickLock.RUnlock()
+
+	max := 0
+
+	for _, tricks := range trickMap {
+		for _, t := range tricks {
+			if t.ID > max {
+				max = t.ID
+			}
+		}
+	}
+
+	for _, pack := range trickPacks {
+		for _, t := range pack.Tricks {
+			if t.ID > max {
+				max = t.ID
+			}
+		}
+	}
+
+	return max
+}
+
+// Loads trick submissions from the data directory
+func loadTrickSubmissions() {
+	queue := trickQueue{NextID: 1}
+
+	if err := loadStore("trick_submissions", &queue); err != nil {
+		fmt.Println("[ERROR] Failed to load trick submissions, " + err.Error())
+	}
+
+	submissionLock.Lock()
+	submissions = queue
+	submissionLock.Unlock()
+}
+
+// Returns the approved submissions of the given kind
+func approvedTricks(kind string) []trick {
+	submissionLock.Lock()
+	defer submissionLock.Unlock()
+
+	var tricks []trick
+
+	for _, sub := range submissions.Submissions {
+		if sub.Kind == kind && sub.Status == trickApproved {
+			tricks = append(tricks, trick{ID: sub.ID, Category: sub.Category, Text: sub.Text, Author: sub.AuthorName, Images: sub.Images, Kind: sub.Kind})
+		}
+	}
+
+	return tricks
+}
+
+// Returns the tricks of the given kind from the data files and the given packs, followed by approved submissions
+func allTricks(kind string, packs []string) []trick {
+	trickLock.RLock()
+	tricks := append([]trick{}, trickMap[kind]...)
+
+	for _, name := range packs {
+		if pack, ok := trickPacks[name]; ok && pack.Kind == kind {
+			tricks = append(tricks, pack.Tricks...)
+		}
+	}
+	trickLock.RUnlock()
+
+	return append(tricks, approvedTricks(kind)...)
+}
+
+// Looks up a trick by its ID. Tricks from every pack can be recalled, enabled or not, so IDs work as permalinks.
+func findTrick(id int) (trick, bool) {
+	for _, kind := range trickKinds {
+		for _, t := range allTricks(kind, trickPackNames()) {
+			if t.ID == id {
+				return t, true
+			}
+		}
+	}
+
+	return trick{}, false
+}
+
+// Formats the trick with its ID, so it can be referenced later
+func (t trick) withID() string {
+	out := t.Text + " (trick #" + strconv.Itoa(t.ID)
+
+	if t.Author != "" {
+		out += ", submitted by " + t.Author
+	}
+
+	out += ")"
+
+	for _, image := range t.Images {
+		out += "\n" + image
+	}
+
+	return out
+}
+
+// Finds the tricks that contain every keyword, in their text or category, searching the given packs too
+func searchTricks(keywords []string, packs []string) []trick {
+	var found []trick
+
+	for _, kind := range trickKinds {
+		for _, t := range allTricks(kind, packs) {
+			haystack := strings.ToLower(t.Text + " " + kind + " " + t.Category)
+			matches := true
+
+			for _, keyword := range keywords {
+				if !strings.Contains(haystack, strings.ToLower(keyword)) {
+					matches = false
+					break
+				}
+			}
+
+			if matches {
+				found = append(found, t)
+			}
+		}
+	}
+
+	return found
+}
+
+// The tricks given out most recently in each scope (a channel, or a webhook post), newest last
+var (
+	recentTricks     = make(map[string][]int)
+	recentTricksLock sync.Mutex
+)
+
+// At most this many of the recently given tricks are held back, and never more than half of the ones to pick from
+const maxRecentTricks = 16
+
+// Picks one of the tricks at random, leaving out the ones given recently in the scope, and remembers it
+func pickTrick(scope string, tricks []trick) trick {
+	recentTricksLock.Lock()
+	defer recentTricksLock.Unlock()
+
+	held := maxRecentTricks
+
+	if len(tricks) / 2 < held {
+		held = len(tricks) / 2
+	}
+
+	recent := recentTricks[scope]
+
+	if len(recent) > held {
+		recent = recent[len(recent) - held:]
+	}
+
+	given := make(map[int]bool)
+
+	for _, id := range recent {
+		given[id] = true
+	}
+
+	var fresh []trick
+
+	for _, t := range tricks {
+		if !given[t.ID] {
+			fresh = append(fresh, t)
+		}
+	}
+
+	if len(fresh) == 0 {
+		fresh = tricks
+	}
+
+	picked := fresh[randomIntn(len(fresh))]
+	recentTricks[scope] = append(recent, picked.ID)
+
+	return picked
+}
+
+// Picks a random trick of the given kind and enabled packs, from the given category or any if it's empty. Tricks
+// given recently in the scope aren't picked again until others have been.
+func randomTrick(kind string, category string, packs []string, scope string) (trick, error) {
+	if category != "" && !isTrickCategory(kind, category) {
+		return trick{}, errors.New("unknown category '" + category + "', use one of: " + strings.Join(trickCategoryNames(kind), ", "))
+	}
+
+	tricks := allTricks(kind, packs)
+
+	if category != "" {
+		matching := tricks[:0]
+		for _, t := range tricks {
+			if t.Category == category {
+				matching = append(matching, t)
+			}
+		}
+
+		tricks = matching
+	}
+
+	if len(tricks) == 0 {
+		if pack, ok := getTrickPack(category); ok && pack.Kind == kind && !StrList(packs).contains(category) {
+			return trick{}, errors.New("the " + category + " trick pack isn't enabled here, a server admin can turn it on with " + CommandPrefix + "settings pack " + category + " on")
+		}
+
+		if category != "" {
+			return trick{}, errors.New("there are no " + category + " tricks yet")
+		}
+
+		return trick{}, errors.New("no " + kind + " tricks are loaded")
+	}
+
+	return pickTrick(kind + "\x00" + scope, tricks), nil
+}
+
+// Checks if the kind is one trick files are loaded for
+func isTrickKind(kind string) bool {
+	for _, k := range trickKinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the categories of the trick kind, including the names of its packs
+func trickCategoryNames(kind string) []string {
+	categories := append([]string{}, trickCategories[kind]...)
+
+	for _, name := range trickPackNames() {
+		if pack, _ := getTrickPack(name); pack.Kind == kind && !StrList(categories).contains(name) {
+			categories = append(categories, name)
+		}
+	}
+
+	return categories
+}
+
+// Checks if the category belongs to the trick kind's taxonomy, or is one of its packs
+func isTrickCategory(kind string, category string) bool {
+	return StrList(trickCategoryNames(kind)).contains(category)
+}
+
+// Parses a submission category, given as a kind ("re"), a kind and category ("re/ida"),
+// or a category that only belongs to one kind ("ida")
+func parseTrickCategory(arg string) (string, string, error) {
+	arg = strings.ToLower(arg)
+
+	if isTrickKind(arg) {
+		return arg, "general", nil
+	}
+
+	if parts := strings.SplitN(arg, "/", 2); len(parts) == 2 {
+		if !isTrickKind(parts[0]) {
+			return "", "", errors.New("unknown trick kind '" + parts[0] + "', use one of: " + strings.Join(trickKinds, ", "))
+		}
+
+		if !isTrickCategory(parts[0], parts[1]) {
+			return "", "", errors.New("unknown " + parts[0] + " category '" + parts[1] + "', use one of: " + strings.Join(trickCategoryNames(parts[0]), ", "))
+		}
+
+		return parts[0], parts[1], nil
+	}
+
+	var kinds []string
+
+	for _, kind := range trickKinds {
+		if isTrickCategory(kind, arg) {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	switch len(kinds) {
+	case 0:
+		return "", "", errors.New("unknown trick category '" + arg + "'")
+	case 1:
+		return kinds[0], arg, nil
+	}
+
+	return "", "", errors.New("'" + arg + "' is a category of " + strings.Join(kinds, " and ") + " tricks, give it as " + kinds[0] + "/" + arg)
+}
+
+// Queues a new trick for review and returns its ID
+func submitTrick(kind string, category string, text string, images []string, author *discordgo.User) (int, error) {
+	submissionLock.Lock()
+	defer submissionLock.Unlock()
+
+	// Submissions share the ID space with the trick files, so they're numbered after the highest file ID
+	id := submissions.NextID
+	if max := maxFileTrickID(); id <= max {
+		id = max + 1
+	}
+
+	submissions.NextID = id + 1
+	submissions.Submissions = append(submissions.Submissions, trickSubmission{
+		ID:         id,
+		Kind:       kind,
+		Category:   category,
+		Text:       text,
+		Images:     images,
+		Author:     author.ID,
+		AuthorName: author.Username,
+		Submitted:  time.Now().UTC(),
+		Status:     trickPending,
+	})
+
+	return id, saveStore("trick_submissions", submissions)
+}
+
+// Approves or rejects a pending submission
+func reviewTrick(id int, status string, reviewer string) (trickSubmission, error) {
+	submissionLock.Lock()
+	defer submissionLock.Unlock()
+
+	for i, sub := range submissions.Submissions {
+		if sub.ID != id {
+			continue
+		}
+
+		if sub.Status != trickPending {
+			return sub, errors.New("trick #" + strconv.Itoa(id) + " was already " + sub.Status)
+		}
+
+		submissions.Submissions[i].Status = status
+		submissions.Submissions[i].Reviewer = reviewer
+
+		return submissions.Submissions[i], saveStore("trick_submissions", submissions)
+	}
+
+	return trickSubmission{}, errors.New("there's no trick #" + strconv.Itoa(id))
+}
+
+// Returns the submissions still waiting for review
+func pendingTricks() []trickSubmission {
+	submissionLock.Lock()
+	defer submissionLock.Unlock()
+
+	var pending []trickSubmission
+
+	for _, sub := range submissions.Submissions {
+		if sub.Status == trickPending {
+			pending = append(pending, sub)
+		}
+	}
+
+	return pending
+}
+
+// Sends a random trick, from the category given as the first argument if there is one
+func sendTrick(params cmdArguments, kind string) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	category := ""
+	if len(args) > 1 {
+		category = strings.ToLower(args[1])
+	}
+
+	t, err := randomTrick(kind, category, getGuildSettings(guildScope(m)).TrickPacks, m.ChannelID)
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, t.withID())
+}
+
+// Gives a random reverse engineering trick
+func cmdReTrick(params cmdArguments) {
+	sendTrick(params, trickKindRE)
+}
+
+// Gives a random exploit development trick
+func cmdExploitTrick(params cmdArguments) {
+	sendTrick(params, trickKindExploit)
+}
+
+// Submits tricks, and lets developers review the submission queue
+func cmdTrick(params cmdArguments) {
+	s := params.s
+	m := params.m
+	args := params.args
+
+	usage := "Usage: " + CommandPrefix + "trick [id|submit|search|queue|approve|reject|sync] {arguments ...}"
+
+	if id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#")); err == nil {
+		t, ok := findTrick(id)
+
+		if !ok {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There's no trick #" + strconv.Itoa(id) + ".")
+			return
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "[" + t.Kind + "/" + t.Category + "] " + t.withID())
+		return
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "search":
+		if len(args) < 3 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "trick search [keywords ...]")
+			return
+		}
+
+		found := searchTricks(args[2:], getGuildSettings(guildScope(m)).TrickPacks)
+
+		if len(found) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "No tricks matched your search.")
+			return
+		}
+
+		out := ""
+
+		// Like the queue, only the first few are shown to stay under Discord's length limit
+		for i, t := range found {
+			if i == 5 {
+				out += "... and " + strconv.Itoa(len(found) - i) + " more, try adding more keywords\n"
+				break
+			}
+
+			out += "**#" + strconv.Itoa(t.ID) + "** [" + t.Kind + "/" + t.Category + "] " + t.Text + "\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Matching tricks:\n" + out)
+		return
+	case "submit":
+		if len(args) < 4 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "trick submit [category] [text ...], where the category is re, exploit, or a category like re/ida or exploit/heap")
+			return
+		}
+
+		kind, category, err := parseTrickCategory(args[2])
+
+		if err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, " + err.Error() + ".")
+			return
+		}
+
+		text := strings.Join(args[3:], " ")
+
+		if len(text) > maxTrickLength {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Tricks can be at most " + strconv.Itoa(maxTrickLength) + " characters long.")
+			return
+		}
+
+		// Screenshots are attached to the submission message
+		var images []string
+
+		for _, attachment := range m.Attachments {
+			if strings.HasPrefix(attachment.ContentType, "image/") && len(images) < maxTrickImages {
+				images = append(images, attachment.URL)
+			}
+		}
+
+		id, err := submitTrick(kind, category, text, images, m.Author)
+
+		if err != nil {
+			fmt.Println("[ERROR] Failed to save trick submission, " + err.Error())
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to save your trick.")
+			return
+		}
+
+		notifyDevelopers(s, "New " + kind + "/" + category + " trick #" + strconv.Itoa(id) + " from <@" + m.Author.ID + ">: " + text + "\n" + strings.Join(images, "\n"))
+
+		reply := "Thanks! Your trick was submitted as #" + strconv.Itoa(id) + " and will show up, credited to you, once it's approved."
+
+		// Confirmations for submissions made in a server go to DMs, so the channel isn't cluttered
+		if m.GuildID != "" {
+			if channel, err := s.UserChannelCreate(m.Author.ID); err == nil {
+				if _, err := s.ChannelMessageSend(channel.ID, reply + " Next time you can submit tricks here in DMs."); err == nil {
+					return
+				}
+			}
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, reply)
+		return
+	case "queue", "approve", "reject", "sync":
+		if !DeveloperList.contains(m.Author.ID) {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Only developers can review tricks.")
+			return
+		}
+	default:
+		_, _ = s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	if strings.ToLower(args[1]) == "sync" {
+		updated, err := syncTricks()
+
+		if err != nil {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "Couldn't sync the tricks, " + err.Error() + ".")
+			return
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Tricks synced, " + strconv.Itoa(updated) + " files updated.")
+		return
+	}
+
+	if strings.ToLower(args[1]) == "queue" {
+		pending := pendingTricks()
+
+		if len(pending) == 0 {
+			_, _ = s.ChannelMessageSend(m.ChannelID, "There are no tricks waiting for review.")
+			return
+		}
+
+		out := ""
+
+		// Only the oldest few are shown, so the message stays under Discord's length limit
+		for i, sub := range pending {
+			if i == 5 {
+				out += "... and " + strconv.Itoa(len(pending) - i) + " more\n"
+				break
+			}
+
+			out += "#" + strconv.Itoa(sub.ID) + " [" + sub.Kind + "/" + sub.Category + "] <@" + sub.Author + ">: " + sub.Text
+
+			if len(sub.Images) > 0 {
+				out += " (" + strconv.Itoa(len(sub.Images)) + " screenshots)"
+			}
+
+			out += "\n"
+		}
+
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Tricks waiting for review:\n" + out)
+		return
+	}
+
+	if len(args) < 3 {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Usage: " + CommandPrefix + "trick " + strings.ToLower(args[1]) + " [id]")
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(args[2], "#"))
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "'" + args[2] + "' isn't a trick ID.")
+		return
+	}
+
+	status := trickApproved
+	if strings.ToLower(args[1]) == "reject" {
+		status = trickRejected
+	}
+
+	sub, err := reviewTrick(id, status, m.Author.ID)
+
+	if err != nil {
+		_, _ = s.ChannelMessageSend(m.ChannelID, "Couldn't review the trick, " + err.Error() + ".")
+		return
+	}
+
+	_, _ = s.ChannelMessageSend(m.ChannelID, "Trick #" + strconv.Itoa(sub.ID) + " " + status + ".")
+}
@@ -1,15 +1,48 @@
 package main 
 
 import(
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// Random numbers for the tricks and quizzes. Handlers run concurrently, so the source is shared behind a lock, and
+// it's seeded from crypto/rand so restarts don't repeat the same picks.
+var (
+	randomSource = rand.New(rand.NewSource(randomSeed()))
+	randomLock   sync.Mutex
+)
+
+// Reads a seed from crypto/rand, falling back to the time if it can't
+func randomSeed() int64 {
+	var seed [8]byte
+
+	if _, err := cryptorand.Read(seed[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+
+	return int64(binary.LittleEndian.Uint64(seed[:]))
+}
+
+// Returns a random number in [0, n)
+func randomIntn(n int) int {
+	randomLock.Lock()
+	defer randomLock.Unlock()
+
+	return randomSource.Intn(n)
+}
+
 // Checks if a []string array contains a value
 func (strl StrList) contains(str string) bool {
 	for _, s := range strl {
@@ -78,6 +111,32 @@ func padRight(str string, pad string, length int) string {
 	return finalStr
 }
 
+// Formats a number as an ordinal, i.e. "1st", "2nd" or "11th"
+func ordinal(n int) string {
+	suffix := "th"
+
+	switch {
+	case n % 100 >= 11 && n % 100 <= 13:
+	case n % 10 == 1:
+		suffix = "st"
+	case n % 10 == 2:
+		suffix = "nd"
+	case n % 10 == 3:
+		suffix = "rd"
+	}
+
+	return strconv.Itoa(n) + suffix
+}
+
+// Joins words into a list for a sentence, i.e. "r4, r5 and lr"
+func joinWords(words []string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+
+	return strings.Join(words[:len(words) - 1], ", ") + " and " + words[len(words) - 1]
+}
+
 // Uses HTTP to get page contents of the given URL
 func getPageContents(url string) string {
 	resp, err := http.Get(url)
@@ -119,7 +178,7 @@ func downloadPageContents(filename string, url string) error {
 }
 
 // Creates an embed message to send in Discord.
-func discordSendEmbeddedMsg(s *discordgo.Session, channel string, sections []embedField, footer string, color int, thumbnail string) {
+func discordSendEmbeddedMsg(s Responder, channel string, sections []embedField, footer string, color int, thumbnail string) {
 	embed := discordgo.MessageEmbed{
 		Type:  "rich",
 		Color: color,
@@ -159,7 +218,7 @@ func discordSendEmbeddedMsg(s *discordgo.Session, channel string, sections []emb
 }
 
 // Creates an embed message to send in Discord, but automatically creates 1 embed field. Good for quick, one field messages like errors.
-func discordSendQuickEmbeddedMsg(s *discordgo.Session, channel string, title string, body string, footer string, color int, thumbnail string) {
+func discordSendQuickEmbeddedMsg(s Responder, channel string, title string, body string, footer string, color int, thumbnail string) {
 	embed := discordgo.MessageEmbed{
 		Type:  "rich",
 		Color: color,
@@ -196,4 +255,56 @@ func discordSendQuickEmbeddedMsg(s *discordgo.Session, channel string, title str
 	_, _ = s.ChannelMessageSendEmbed(channel, &embed)
 }
 
+// Returned when user input exceeds one of the configured size limits
+type limitError struct {
+	what  string
+	given int
+	limit int
+}
+
+func (e limitError) Error() string {
+	return "Too many " + e.what + "! The limit is " + strconv.Itoa(e.limit) + ", but you gave " + strconv.Itoa(e.given) + "."
+}
+
+// Checks a user supplied size against a limit, and tells the user what they exceeded if it's too large
+func checkLimit(s Responder, channel string, what string, given int, limit int) bool {
+	if limit > 0 && given > limit {
+		_, _ = s.ChannelMessageSend(channel, limitError{what, given, limit}.Error())
+		return false
+	}
+
+	return true
+}
+
+// Client used to upload to the pastebin, so a hanging pastebin can't hold up the frontend's reply forever
+var pasteClient = &http.Client{Timeout: 30 * time.Second}
+
+// Uploads text to the configured pastebin for output that's too long for the frontend, returns the paste's URL
+func uploadPaste(text string) (string, error) {
+	pasteURL := getConfigPropertyAsStr("paste", "url")
 
+	if pasteURL == "" {
+		pasteURL = "https://paste.rs"
+	}
+
+	resp, err := pasteClient.Post(pasteURL, "text/plain; charset=utf-8", strings.NewReader(text))
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", errors.New("pastebin returned " + resp.Status)
+	}
+
+	// Services like paste.rs reply with the URL of the paste as the whole body
+	return strings.TrimSpace(string(body)), nil
+}
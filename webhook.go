@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A post that's made to a configured webhook once a day, instead of in reply to a command
+type scheduledPost struct {
+	name    string
+	content func() (string, error)
+}
+
+// Posts that can be scheduled from the [webhooks] section of config.ini
+var scheduledPosts = []scheduledPost{
+	{"trick_of_the_day", func() (string, error) { return trickPost("**RE trick of the day:** ", trickKindRE) }},
+	{"exploit_trick_of_the_day", func() (string, error) { return trickPost("**Exploit dev trick of the day:** ", trickKindExploit) }},
+}
+
+// Builds a trick post with the given heading
+func trickPost(heading string, kind string) (string, error) {
+	t, err := randomTrick(kind, "", nil, "webhook")
+	if err != nil {
+		return "", err
+	}
+
+	return heading + t.withID(), nil
+}
+
+// Splits a Discord webhook URL (https://discord.com/api/webhooks/{id}/{token}) into its ID and token
+func parseWebhookURL(url string) (string, string, error) {
+	parts := strings.Split(strings.TrimRight(url, "/"), "/")
+
+	if len(parts) < 2 || !strings.Contains(url, "/webhooks/") {
+		return "", "", errors.New("invalid webhook URL")
+	}
+
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+// Posts a message to a Discord webhook
+func sendWebhook(s Responder, url string, content string) error {
+	id, token, err := parseWebhookURL(url)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.WebhookExecute(id, token, false, &discordgo.WebhookParams{
+		Content:  content,
+		Username: "REBot",
+	})
+
+	return err
+}
+
+// Returns how long until the next daily post at the given "HH:MM" UTC time
+func untilNextPost(at string, now time.Time) (time.Duration, error) {
+	t, err := time.Parse("15:04", at)
+
+	if err != nil {
+		return 0, err
+	}
+
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+
+	return next.Sub(now), nil
+}
+
+// Starts a goroutine for every scheduled post that has a webhook configured
+func startScheduledPosts(s Responder) {
+	for _, post := range scheduledPosts {
+		url := getConfigSecret("webhooks", post.name)
+
+		if url == "" {
+			continue
+		}
+
+		at := getConfigPropertyAsStr("webhooks", post.name + "_time")
+
+		if at == "" {
+			at = "12:00"
+		}
+
+		if _, err := untilNextPost(at, time.Now()); err != nil {
+			fmt.Println("[ERROR] Invalid time '" + at + "' for scheduled post '" + post.name + "', expected HH:MM")
+			continue
+		}
+
+		go func(post scheduledPost, url string, at string) {
+			for {
+				wait, _ := untilNextPost(at, time.Now())
+				time.Sleep(wait)
+
+				content, err := post.content()
+				if err != nil {
+					fmt.Println("[ERROR] Skipping scheduled post '" + post.name + "', ", err)
+					continue
+				}
+
+				if err := sendWebhook(s, url, content); err != nil {
+					fmt.Println("[ERROR] Failed to send scheduled post '" + post.name + "', ", err)
+				}
+			}
+		}(post, url, at)
+
+		fmt.Println("[INFO] Scheduled post '" + post.name + "' daily at " + at + " UTC.")
+	}
+}